@@ -0,0 +1,94 @@
+/*
+Package atomicfile writes files atomically, so that readers see either the
+old or the complete new file, even after a crash.
+*/
+package atomicfile
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// WriteFile writes data into a temporary file in the directory of filename,
+// syncs it to disk and renames it to filename. The name of the temporary
+// file starts with a dot, so that it is ignored by tools that watch the
+// directory.
+func WriteFile(filename string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, tempPrefix(base))
+	if err != nil {
+		return errors.Wrapf(err, "creating temp file for %s", filename)
+	}
+	tmpname := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpname)
+		return errors.Wrapf(err, "writing %s", tmpname)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpname)
+		return errors.Wrapf(err, "syncing %s", tmpname)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpname)
+		return errors.Wrapf(err, "writing %s", tmpname)
+	}
+	if err := os.Chmod(tmpname, perm); err != nil {
+		os.Remove(tmpname)
+		return errors.Wrapf(err, "writing %s", tmpname)
+	}
+	if err := os.Rename(tmpname, filename); err != nil {
+		os.Remove(tmpname)
+		return errors.Wrapf(err, "renaming %s", tmpname)
+	}
+	syncDir(dir)
+	return nil
+}
+
+// tempPrefix returns the prefix of the temporary files for base.
+func tempPrefix(base string) string {
+	return "." + base + ".tmp"
+}
+
+// RemoveTempFiles removes temporary files of filename that were left by
+// WriteFile calls that did not complete, e.g. after a crash. It must not
+// be called while other processes write to filename.
+func RemoveTempFiles(filename string) {
+	dir, base := filepath.Split(filename)
+	matches, _ := filepath.Glob(filepath.Join(dir, tempPrefix(base)+"*"))
+	for _, m := range matches {
+		os.Remove(m)
+	}
+}
+
+// syncDir syncs the directory to persist the rename. Errors are ignored,
+// as not all platforms support syncing directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// Checksum returns the hex encoded SHA256 checksum of data.
+func Checksum(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// WriteChecksumFile writes the checksum of data into filename.sha256, in
+// the format of sha256sum. The file can be verified with sha256sum -c.
+func WriteChecksumFile(filename string, data []byte) error {
+	line := fmt.Sprintf("%s  %s\n", Checksum(data), filepath.Base(filename))
+	return WriteFile(filename+".sha256", []byte(line), 0644)
+}
@@ -0,0 +1,78 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_atomicfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "test.txt")
+	for _, content := range []string{"hello\n", "world\n"} {
+		if err := WriteFile(fname, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("unexpected content %q", b)
+		}
+	}
+
+	if err := WriteChecksumFile(fname, []byte("world\n")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(fname + ".sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "e258d248fda94c63753607f7c4494ee0fcbe92f1a76bfdac795c9d84101eb317  test.txt\n"
+	if string(b) != expected {
+		t.Errorf("unexpected checksum file %q", b)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("unexpected files %v", files)
+	}
+}
+
+func TestRemoveTempFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_atomicfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "test.txt")
+	for _, name := range []string{".test.txt.tmp123", ".test.txt.tmp456", ".other.txt.tmp123", "test.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	RemoveTempFiles(fname)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	if len(names) != 2 || names[0] != ".other.txt.tmp123" || names[1] != "test.txt" {
+		t.Errorf("unexpected files %v", names)
+	}
+}
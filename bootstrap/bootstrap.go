@@ -0,0 +1,273 @@
+package bootstrap
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/omniscale/imposm3/atomicfile"
+	"github.com/omniscale/imposm3/config"
+	"github.com/omniscale/imposm3/geom/limit"
+	"github.com/omniscale/imposm3/import_"
+	"github.com/omniscale/imposm3/log"
+	"github.com/pkg/errors"
+)
+
+var flags = flag.NewFlagSet("bootstrap", flag.ExitOnError)
+
+var (
+	region      = flags.String("region", "", "Geofabrik region (e.g. europe/germany)")
+	dir         = flags.String("dir", ".", "directory for the extract, config, cache and diff files")
+	mappingFile = flags.String("mapping", "", "mapping file for the config")
+	connection  = flags.String("connection", "", "connection parameters for the config")
+	overwrite   = flags.Bool("overwrite", false, "download the extract and write the config again, even if they exist")
+	startImport = flags.Bool("import", false, "start the import (-read -write -diff) with the new config")
+)
+
+// geofabrikInterval is the replication interval of all Geofabrik updates.
+const geofabrikInterval = "24h"
+
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s %s: [args] [-- import args]\n\n", os.Args[0], os.Args[1])
+	flags.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nDownload a Geofabrik extract and write a config for the import and the")
+	fmt.Fprintln(os.Stderr, "updates of this region. Additional arguments are passed to the import.")
+	os.Exit(1)
+}
+
+// bootstrapConfig is the subset of the config options that are written by
+// bootstrap.
+type bootstrapConfig struct {
+	CacheDir            string `json:"cachedir"`
+	DiffDir             string `json:"diffdir"`
+	Connection          string `json:"connection,omitempty"`
+	MappingFile         string `json:"mapping,omitempty"`
+	LimitTo             string `json:"limitto"`
+	ReplicationURL      string `json:"replication_url"`
+	ReplicationInterval string `json:"replication_interval"`
+}
+
+// Bootstrap downloads the extract of a Geofabrik region, writes the
+// limitto polygon and a config with the replication URL of the region, and
+// optionally starts the import.
+func Bootstrap(args []string) {
+	flags.Usage = Usage
+	flags.Parse(args)
+	if *region == "" {
+		Usage()
+	}
+	if *startImport && (*mappingFile == "" || *connection == "") {
+		log.Fatal("[fatal] -import requires -mapping and -connection")
+	}
+
+	r, err := limit.FindGeofabrikRegion(*region)
+	if err != nil {
+		log.Fatal("[fatal] ", err)
+	}
+	if r.PBFURL == "" || r.UpdatesURL == "" {
+		log.Fatalf("[fatal] region %q has no extract or updates at Geofabrik", *region)
+	}
+
+	absDir, err := filepath.Abs(*dir)
+	if err != nil {
+		log.Fatal("[fatal] ", err)
+	}
+	if err := os.MkdirAll(absDir, 0755); err != nil {
+		log.Fatal("[fatal] creating directory: ", err)
+	}
+
+	pbfFile := filepath.Join(absDir, path.Base(r.PBFURL))
+	if _, err := os.Stat(pbfFile); err == nil && !*overwrite {
+		log.Printf("[info] Using existing extract %s", pbfFile)
+	} else {
+		if err := download(r.PBFURL, pbfFile); err != nil {
+			log.Fatal("[fatal] downloading extract: ", err)
+		}
+	}
+
+	limitTo := filepath.Join(absDir, r.ID+".geojson")
+	if err := atomicfile.WriteFile(limitTo, r.Geometry, 0644); err != nil {
+		log.Fatal("[fatal] writing limitto polygon: ", err)
+	}
+
+	configFile := filepath.Join(absDir, "config.json")
+	if _, err := os.Stat(configFile); err == nil && !*overwrite {
+		log.Printf("[info] Keeping existing config %s, use -overwrite to replace it", configFile)
+	} else {
+		mapping := *mappingFile
+		if mapping != "" {
+			if mapping, err = filepath.Abs(mapping); err != nil {
+				log.Fatal("[fatal] ", err)
+			}
+		}
+		conf := bootstrapConfig{
+			CacheDir:            filepath.Join(absDir, "cache"),
+			DiffDir:             filepath.Join(absDir, "diff"),
+			Connection:          *connection,
+			MappingFile:         mapping,
+			LimitTo:             limitTo,
+			ReplicationURL:      r.UpdatesURL,
+			ReplicationInterval: geofabrikInterval,
+		}
+		b, err := json.MarshalIndent(conf, "", "  ")
+		if err != nil {
+			log.Fatal("[fatal] ", err)
+		}
+		if err := atomicfile.WriteFile(configFile, append(b, '\n'), 0644); err != nil {
+			log.Fatal("[fatal] writing config: ", err)
+		}
+		log.Printf("[info] Wrote config for %s to %s", r.ID, configFile)
+	}
+
+	importArgs := append([]string{"-config", configFile, "-read", pbfFile, "-write", "-diff"}, flags.Args()...)
+	if !*startImport {
+		log.Printf("[info] Start the import with: %s import %s", os.Args[0], strings.Join(importArgs, " "))
+	} else {
+		import_.Import(config.ParseImport(importArgs))
+	}
+	if !hasFlag(importArgs, "deployproduction") {
+		// run updates the production schema
+		log.Printf("[info] Deploy the import with: %s import -config %s -deployproduction", os.Args[0], configFile)
+	}
+	log.Printf("[info] Start the updates with: %s run -config %s", os.Args[0], configFile)
+}
+
+// hasFlag returns whether args contain the boolean flag name.
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		arg = strings.TrimLeft(arg, "-")
+		if arg == name || (strings.HasPrefix(arg, name+"=") && arg != name+"=false") {
+			return true
+		}
+	}
+	return false
+}
+
+// httpClient fails requests to unresponsive servers. It has no overall
+// timeout, as large extracts take hours to download, see idleTimeout.
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+// idleTimeout cancels a download that did not receive any data for this
+// duration.
+const idleTimeout = 2 * time.Minute
+
+// checksumTimeout is the timeout for requesting the MD5 checksum.
+const checksumTimeout = 30 * time.Second
+
+// idleReader cancels the request of the body if a Read does not return
+// within idleTimeout.
+type idleReader struct {
+	r     io.Reader
+	timer *time.Timer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	r.timer.Reset(idleTimeout)
+	return r.r.Read(p)
+}
+
+// download writes url into filename. The file is downloaded into a
+// temporary file and verified with the MD5 checksum of Geofabrik, if
+// available.
+func download(url, filename string) error {
+	log.Printf("[info] Downloading %s", url)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timer := time.AfterFunc(idleTimeout, cancel)
+	defer timer.Stop()
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("requesting %s: %s", url, resp.Status)
+	}
+
+	tmpname := filename + ".tmp"
+	f, err := os.Create(tmpname)
+	if err != nil {
+		return err
+	}
+	hash := md5.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), bufio.NewReader(&idleReader{r: resp.Body, timer: timer}))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpname)
+		return errors.Wrapf(err, "writing %s", tmpname)
+	}
+
+	expected, err := md5Checksum(url + ".md5")
+	if err != nil {
+		log.Printf("[warn] Unable to verify %s: %s", url, err)
+	} else if sum := hex.EncodeToString(hash.Sum(nil)); sum != expected {
+		os.Remove(tmpname)
+		return errors.Errorf("checksum of %s is %s, expected %s", url, sum, expected)
+	}
+
+	if err := os.Rename(tmpname, filename); err != nil {
+		os.Remove(tmpname)
+		return err
+	}
+	log.Printf("[info] Downloaded %d MB into %s", n/1024/1024, filename)
+	return nil
+}
+
+// md5Checksum returns the checksum from an md5sum file.
+func md5Checksum(url string) (string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), checksumTimeout)
+	defer cancel()
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("requesting %s: %s", url, resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return "", errors.Errorf("empty checksum in %s", url)
+	}
+	return fields[0], nil
+}
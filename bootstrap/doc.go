@@ -0,0 +1,5 @@
+/*
+Package bootstrap provides the bootstrap sub command to set up an import of
+a Geofabrik extract with matching replication settings.
+*/
+package bootstrap
@@ -7,64 +7,73 @@ import (
 	osm "github.com/omniscale/go-osm"
 )
 
+// MarshalDeltaNodes encodes the nodes as delta encoded varints: the number
+// of nodes, followed by all IDs, all longitudes and all latitudes. buf is
+// reused if it has enough capacity for the worst case length.
 func MarshalDeltaNodes(nodes []osm.Node, buf []byte) []byte {
-	estimatedLength := len(nodes)*4*3 + binary.MaxVarintLen64
-
-	if cap(buf) < estimatedLength {
-		buf = make([]byte, estimatedLength)
+	maxLength := (1 + len(nodes)*3) * binary.MaxVarintLen64
+	if cap(buf) < maxLength {
+		buf = make([]byte, maxLength)
 	} else {
-		// resize slice to full capacity
-		buf = buf[:cap(buf)-1]
+		buf = buf[:maxLength]
 	}
 
-	lastID := int64(0)
 	nextPos := binary.PutUvarint(buf, uint64(len(nodes)))
 
+	lastID := int64(0)
 	for i := range nodes {
-		if len(buf)-nextPos < binary.MaxVarintLen64 {
-			tmp := make([]byte, len(buf)*3/2)
-			copy(tmp, buf)
-			buf = tmp
-		}
-		nextPos += binary.PutVarint(buf[nextPos:], nodes[i].ID-lastID)
+		nextPos = putVarint(buf, nextPos, nodes[i].ID-lastID)
 		lastID = nodes[i].ID
 	}
 
 	lastLong := int64(0)
 	for i := range nodes {
-		if len(buf)-nextPos < binary.MaxVarintLen64 {
-			tmp := make([]byte, len(buf)*3/2)
-			copy(tmp, buf)
-			buf = tmp
-		}
 		long := int64(CoordToInt(nodes[i].Long))
-		nextPos += binary.PutVarint(buf[nextPos:], long-lastLong)
+		nextPos = putVarint(buf, nextPos, long-lastLong)
 		lastLong = long
 	}
 
 	lastLat := int64(0)
 	for i := range nodes {
-		if len(buf)-nextPos < binary.MaxVarintLen64 {
-			tmp := make([]byte, len(buf)*3/2)
-			copy(tmp, buf)
-			buf = tmp
-		}
 		lat := int64(CoordToInt(nodes[i].Lat))
-		nextPos += binary.PutVarint(buf[nextPos:], lat-lastLat)
+		nextPos = putVarint(buf, nextPos, lat-lastLat)
 		lastLat = lat
 	}
 
 	return buf[:nextPos]
 }
 
+// putVarint writes v zigzag encoded at pos and returns the next position.
+// Identical to binary.PutVarint, but with a fast path for the small deltas
+// of sorted IDs and nearby coordinates.
+func putVarint(buf []byte, pos int, v int64) int {
+	ux := uint64(v) << 1
+	if v < 0 {
+		ux = ^ux
+	}
+	for ux >= 0x80 {
+		buf[pos] = byte(ux) | 0x80
+		ux >>= 7
+		pos++
+	}
+	buf[pos] = byte(ux)
+	return pos + 1
+}
+
 var errVarInt = errors.New("unmarshal delta coords: missing data for varint or overflow")
 
+// UnmarshalDeltaNodes decodes nodes encoded with MarshalDeltaNodes. nodes is
+// reused if it has enough capacity.
 func UnmarshalDeltaNodes(buf []byte, nodes []osm.Node) ([]osm.Node, error) {
 	length, n := binary.Uvarint(buf)
 	if n <= 0 {
 		return nil, errVarInt
 	}
-	var offset = n
+	offset := n
+	// each value requires at least one byte, check before we allocate
+	if length > uint64(len(buf)-offset)/3 {
+		return nil, errVarInt
+	}
 
 	if uint64(cap(nodes)) < length {
 		nodes = make([]osm.Node, length)
@@ -72,41 +81,53 @@ func UnmarshalDeltaNodes(buf []byte, nodes []osm.Node) ([]osm.Node, error) {
 		nodes = nodes[:length]
 	}
 
+	var v int64
+	var ok bool
+
 	lastID := int64(0)
-	for i := 0; uint64(i) < length; i++ {
-		id, n := binary.Varint(buf[offset:])
-		if n <= 0 {
+	for i := range nodes {
+		if v, offset, ok = varint(buf, offset); !ok {
 			return nil, errVarInt
 		}
-		offset += n
-		id = lastID + id
-		nodes[i].ID = id
-		lastID = id
+		lastID += v
+		nodes[i].ID = lastID
 	}
 
 	lastLong := int64(0)
-	for i := 0; uint64(i) < length; i++ {
-		long, n := binary.Varint(buf[offset:])
-		if n <= 0 {
+	for i := range nodes {
+		if v, offset, ok = varint(buf, offset); !ok {
 			return nil, errVarInt
 		}
-		offset += n
-		long = lastLong + long
-		nodes[i].Long = IntToCoord(uint32(long))
-		lastLong = long
+		lastLong += v
+		nodes[i].Long = IntToCoord(uint32(lastLong))
 	}
 
 	lastLat := int64(0)
-	for i := 0; uint64(i) < length; i++ {
-		lat, n := binary.Varint(buf[offset:])
-		if n <= 0 {
+	for i := range nodes {
+		if v, offset, ok = varint(buf, offset); !ok {
 			return nil, errVarInt
 		}
-		offset += n
-		lat = lastLat + lat
-		nodes[i].Lat = IntToCoord(uint32(lat))
-		lastLat = lat
+		lastLat += v
+		nodes[i].Lat = IntToCoord(uint32(lastLat))
 	}
 
 	return nodes, nil
 }
+
+// varint reads a zigzag encoded varint at pos and returns the value and
+// the next position. Identical to binary.Varint, but with a fast path for
+// single byte values.
+func varint(buf []byte, pos int) (int64, int, bool) {
+	if pos < len(buf) && buf[pos] < 0x80 {
+		ux := uint64(buf[pos])
+		return int64(ux>>1) ^ -int64(ux&1), pos + 1, true
+	}
+	if pos >= len(buf) {
+		return 0, pos, false
+	}
+	v, n := binary.Varint(buf[pos:])
+	if n <= 0 {
+		return 0, pos, false
+	}
+	return v, pos + n, true
+}
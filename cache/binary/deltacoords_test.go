@@ -1,6 +1,7 @@
 package binary
 
 import (
+	"bytes"
 	"math"
 	"math/rand"
 	"testing"
@@ -47,6 +48,47 @@ func TestMarshalDeltaCoords(t *testing.T) {
 	compareNodes(t, nodes, nodes2)
 }
 
+// TestMarshalDeltaCoordsStable checks that the encoding is byte-identical
+// on all architectures, so that caches can be moved between amd64 and arm64.
+func TestMarshalDeltaCoordsStable(t *testing.T) {
+	nodes := []osm.Node{
+		{Element: osm.Element{ID: 1000}, Long: 8.5, Lat: 53.1},
+		{Element: osm.Element{ID: 1001}, Long: 8.5000001, Lat: 53.1000002},
+		{Element: osm.Element{ID: 998}, Long: -179.9999999, Lat: -89.9999999},
+		{Element: osm.Element{ID: 5000000000}, Long: 179.9999999, Lat: 89.9999999},
+	}
+	expected := []byte{
+		0x4, 0xd0, 0xf, 0x2, 0x5, 0xb4, 0xb8, 0xaf, 0xa0, 0x25,
+		0xea, 0x82, 0xdb, 0xe0, 0x10, 0x2, 0xe9, 0x82, 0xdb, 0xe0,
+		0x10, 0xf8, 0xff, 0xff, 0xff, 0x1f, 0xb6, 0xbd, 0x94, 0xdc,
+		0x14, 0x4, 0xb9, 0xbd, 0x94, 0xdc, 0xc, 0xfc, 0xff, 0xff,
+		0xff, 0xf,
+	}
+	buf := MarshalDeltaNodes(nodes, nil)
+	if !bytes.Equal(buf, expected) {
+		t.Fatalf("unexpected encoding %#v", buf)
+	}
+	nodes2, err := UnmarshalDeltaNodes(expected, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareNodes(t, nodes, nodes2)
+}
+
+func TestUnmarshalDeltaCoordsInvalid(t *testing.T) {
+	buf := MarshalDeltaNodes(nodes, nil)
+	for _, data := range [][]byte{
+		nil,
+		buf[:len(buf)-1],
+		// length larger than data
+		{0xff, 0xff, 0xff, 0xff, 0x0f, 0x02, 0x02, 0x02},
+	} {
+		if _, err := UnmarshalDeltaNodes(data, nil); err != errVarInt {
+			t.Errorf("expected errVarInt for %v, got %v", data, err)
+		}
+	}
+}
+
 func BenchmarkMarshalDeltaCoords(b *testing.B) {
 	b.ReportAllocs()
 	var buf []byte
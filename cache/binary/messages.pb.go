@@ -12,6 +12,7 @@
 		Way
 		Relation
 		DeltaCoords
+		Metadata
 */
 package binary
 
@@ -72,9 +73,10 @@ func (Relation_MemberType) EnumDescriptor() ([]byte, []int) {
 }
 
 type Node struct {
-	Long uint32   `protobuf:"varint,1,req,name=long" json:"long"`
-	Lat  uint32   `protobuf:"varint,2,req,name=lat" json:"lat"`
-	Tags []string `protobuf:"bytes,3,rep,name=tags" json:"tags,omitempty"`
+	Long     uint32    `protobuf:"varint,1,req,name=long" json:"long"`
+	Lat      uint32    `protobuf:"varint,2,req,name=lat" json:"lat"`
+	Tags     []string  `protobuf:"bytes,3,rep,name=tags" json:"tags,omitempty"`
+	Metadata *Metadata `protobuf:"bytes,4,opt,name=metadata" json:"metadata,omitempty"`
 }
 
 func (m *Node) Reset()                    { *m = Node{} }
@@ -103,9 +105,17 @@ func (m *Node) GetTags() []string {
 	return nil
 }
 
+func (m *Node) GetMetadata() *Metadata {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
 type Way struct {
-	Tags []string `protobuf:"bytes,1,rep,name=tags" json:"tags,omitempty"`
-	Refs []int64  `protobuf:"varint,2,rep,packed,name=refs" json:"refs,omitempty"`
+	Tags     []string  `protobuf:"bytes,1,rep,name=tags" json:"tags,omitempty"`
+	Refs     []int64   `protobuf:"varint,2,rep,packed,name=refs" json:"refs,omitempty"`
+	Metadata *Metadata `protobuf:"bytes,3,opt,name=metadata" json:"metadata,omitempty"`
 }
 
 func (m *Way) Reset()                    { *m = Way{} }
@@ -127,11 +137,19 @@ func (m *Way) GetRefs() []int64 {
 	return nil
 }
 
+func (m *Way) GetMetadata() *Metadata {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
 type Relation struct {
 	Tags        []string              `protobuf:"bytes,1,rep,name=tags" json:"tags,omitempty"`
 	MemberIds   []int64               `protobuf:"varint,2,rep,name=member_ids,json=memberIds" json:"member_ids,omitempty"`
 	MemberTypes []Relation_MemberType `protobuf:"varint,3,rep,name=member_types,json=memberTypes,enum=binary.Relation_MemberType" json:"member_types,omitempty"`
 	MemberRoles []string              `protobuf:"bytes,4,rep,name=member_roles,json=memberRoles" json:"member_roles,omitempty"`
+	Metadata    *Metadata             `protobuf:"bytes,5,opt,name=metadata" json:"metadata,omitempty"`
 }
 
 func (m *Relation) Reset()                    { *m = Relation{} }
@@ -167,6 +185,13 @@ func (m *Relation) GetMemberRoles() []string {
 	return nil
 }
 
+func (m *Relation) GetMetadata() *Metadata {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
 type DeltaCoords struct {
 	Ids  []int64 `protobuf:"zigzag64,1,rep,packed,name=ids" json:"ids,omitempty"`
 	Lats []int64 `protobuf:"zigzag64,2,rep,packed,name=lats" json:"lats,omitempty"`
@@ -199,11 +224,60 @@ func (m *DeltaCoords) GetLons() []int64 {
 	return nil
 }
 
+type Metadata struct {
+	Version   int32  `protobuf:"varint,1,opt,name=version" json:"version"`
+	Timestamp int64  `protobuf:"varint,2,opt,name=timestamp" json:"timestamp"`
+	Changeset int64  `protobuf:"varint,3,opt,name=changeset" json:"changeset"`
+	Uid       int32  `protobuf:"varint,4,opt,name=uid" json:"uid"`
+	User      string `protobuf:"bytes,5,opt,name=user" json:"user"`
+}
+
+func (m *Metadata) Reset()                    { *m = Metadata{} }
+func (m *Metadata) String() string            { return proto.CompactTextString(m) }
+func (*Metadata) ProtoMessage()               {}
+func (*Metadata) Descriptor() ([]byte, []int) { return fileDescriptorMessages, []int{4} }
+
+func (m *Metadata) GetVersion() int32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *Metadata) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *Metadata) GetChangeset() int64 {
+	if m != nil {
+		return m.Changeset
+	}
+	return 0
+}
+
+func (m *Metadata) GetUid() int32 {
+	if m != nil {
+		return m.Uid
+	}
+	return 0
+}
+
+func (m *Metadata) GetUser() string {
+	if m != nil {
+		return m.User
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*Node)(nil), "binary.Node")
 	proto.RegisterType((*Way)(nil), "binary.Way")
 	proto.RegisterType((*Relation)(nil), "binary.Relation")
 	proto.RegisterType((*DeltaCoords)(nil), "binary.DeltaCoords")
+	proto.RegisterType((*Metadata)(nil), "binary.Metadata")
 	proto.RegisterEnum("binary.Relation_MemberType", Relation_MemberType_name, Relation_MemberType_value)
 }
 func (m *Node) Marshal() (dAtA []byte, err error) {
@@ -242,6 +316,16 @@ func (m *Node) MarshalTo(dAtA []byte) (int, error) {
 			i += copy(dAtA[i:], s)
 		}
 	}
+	if m.Metadata != nil {
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintMessages(dAtA, i, uint64(m.Metadata.Size()))
+		n1, err := m.Metadata.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n1
+	}
 	return i, nil
 }
 
@@ -276,22 +360,32 @@ func (m *Way) MarshalTo(dAtA []byte) (int, error) {
 		}
 	}
 	if len(m.Refs) > 0 {
-		dAtA2 := make([]byte, len(m.Refs)*10)
-		var j1 int
+		dAtA3 := make([]byte, len(m.Refs)*10)
+		var j2 int
 		for _, num1 := range m.Refs {
 			num := uint64(num1)
 			for num >= 1<<7 {
-				dAtA2[j1] = uint8(uint64(num)&0x7f | 0x80)
+				dAtA3[j2] = uint8(uint64(num)&0x7f | 0x80)
 				num >>= 7
-				j1++
+				j2++
 			}
-			dAtA2[j1] = uint8(num)
-			j1++
+			dAtA3[j2] = uint8(num)
+			j2++
 		}
 		dAtA[i] = 0x12
 		i++
-		i = encodeVarintMessages(dAtA, i, uint64(j1))
-		i += copy(dAtA[i:], dAtA2[:j1])
+		i = encodeVarintMessages(dAtA, i, uint64(j2))
+		i += copy(dAtA[i:], dAtA3[:j2])
+	}
+	if m.Metadata != nil {
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintMessages(dAtA, i, uint64(m.Metadata.Size()))
+		n4, err := m.Metadata.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n4
 	}
 	return i, nil
 }
@@ -355,6 +449,16 @@ func (m *Relation) MarshalTo(dAtA []byte) (int, error) {
 			i += copy(dAtA[i:], s)
 		}
 	}
+	if m.Metadata != nil {
+		dAtA[i] = 0x2a
+		i++
+		i = encodeVarintMessages(dAtA, i, uint64(m.Metadata.Size()))
+		n5, err := m.Metadata.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n5
+	}
 	return i, nil
 }
 
@@ -374,27 +478,9 @@ func (m *DeltaCoords) MarshalTo(dAtA []byte) (int, error) {
 	var l int
 	_ = l
 	if len(m.Ids) > 0 {
-		var j3 int
-		dAtA5 := make([]byte, len(m.Ids)*10)
-		for _, num := range m.Ids {
-			x4 := (uint64(num) << 1) ^ uint64((num >> 63))
-			for x4 >= 1<<7 {
-				dAtA5[j3] = uint8(uint64(x4)&0x7f | 0x80)
-				j3++
-				x4 >>= 7
-			}
-			dAtA5[j3] = uint8(x4)
-			j3++
-		}
-		dAtA[i] = 0xa
-		i++
-		i = encodeVarintMessages(dAtA, i, uint64(j3))
-		i += copy(dAtA[i:], dAtA5[:j3])
-	}
-	if len(m.Lats) > 0 {
 		var j6 int
-		dAtA8 := make([]byte, len(m.Lats)*10)
-		for _, num := range m.Lats {
+		dAtA8 := make([]byte, len(m.Ids)*10)
+		for _, num := range m.Ids {
 			x7 := (uint64(num) << 1) ^ uint64((num >> 63))
 			for x7 >= 1<<7 {
 				dAtA8[j6] = uint8(uint64(x7)&0x7f | 0x80)
@@ -404,15 +490,15 @@ func (m *DeltaCoords) MarshalTo(dAtA []byte) (int, error) {
 			dAtA8[j6] = uint8(x7)
 			j6++
 		}
-		dAtA[i] = 0x12
+		dAtA[i] = 0xa
 		i++
 		i = encodeVarintMessages(dAtA, i, uint64(j6))
 		i += copy(dAtA[i:], dAtA8[:j6])
 	}
-	if len(m.Lons) > 0 {
+	if len(m.Lats) > 0 {
 		var j9 int
-		dAtA11 := make([]byte, len(m.Lons)*10)
-		for _, num := range m.Lons {
+		dAtA11 := make([]byte, len(m.Lats)*10)
+		for _, num := range m.Lats {
 			x10 := (uint64(num) << 1) ^ uint64((num >> 63))
 			for x10 >= 1<<7 {
 				dAtA11[j9] = uint8(uint64(x10)&0x7f | 0x80)
@@ -422,11 +508,63 @@ func (m *DeltaCoords) MarshalTo(dAtA []byte) (int, error) {
 			dAtA11[j9] = uint8(x10)
 			j9++
 		}
-		dAtA[i] = 0x1a
+		dAtA[i] = 0x12
 		i++
 		i = encodeVarintMessages(dAtA, i, uint64(j9))
 		i += copy(dAtA[i:], dAtA11[:j9])
 	}
+	if len(m.Lons) > 0 {
+		var j12 int
+		dAtA14 := make([]byte, len(m.Lons)*10)
+		for _, num := range m.Lons {
+			x13 := (uint64(num) << 1) ^ uint64((num >> 63))
+			for x13 >= 1<<7 {
+				dAtA14[j12] = uint8(uint64(x13)&0x7f | 0x80)
+				j12++
+				x13 >>= 7
+			}
+			dAtA14[j12] = uint8(x13)
+			j12++
+		}
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintMessages(dAtA, i, uint64(j12))
+		i += copy(dAtA[i:], dAtA14[:j12])
+	}
+	return i, nil
+}
+
+func (m *Metadata) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Metadata) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	dAtA[i] = 0x8
+	i++
+	i = encodeVarintMessages(dAtA, i, uint64(m.Version))
+	dAtA[i] = 0x10
+	i++
+	i = encodeVarintMessages(dAtA, i, uint64(m.Timestamp))
+	dAtA[i] = 0x18
+	i++
+	i = encodeVarintMessages(dAtA, i, uint64(m.Changeset))
+	dAtA[i] = 0x20
+	i++
+	i = encodeVarintMessages(dAtA, i, uint64(m.Uid))
+	dAtA[i] = 0x2a
+	i++
+	i = encodeVarintMessages(dAtA, i, uint64(len(m.User)))
+	i += copy(dAtA[i:], m.User)
 	return i, nil
 }
 
@@ -450,6 +588,10 @@ func (m *Node) Size() (n int) {
 			n += 1 + l + sovMessages(uint64(l))
 		}
 	}
+	if m.Metadata != nil {
+		l = m.Metadata.Size()
+		n += 1 + l + sovMessages(uint64(l))
+	}
 	return n
 }
 
@@ -469,6 +611,10 @@ func (m *Way) Size() (n int) {
 		}
 		n += 1 + sovMessages(uint64(l)) + l
 	}
+	if m.Metadata != nil {
+		l = m.Metadata.Size()
+		n += 1 + l + sovMessages(uint64(l))
+	}
 	return n
 }
 
@@ -497,6 +643,10 @@ func (m *Relation) Size() (n int) {
 			n += 1 + l + sovMessages(uint64(l))
 		}
 	}
+	if m.Metadata != nil {
+		l = m.Metadata.Size()
+		n += 1 + l + sovMessages(uint64(l))
+	}
 	return n
 }
 
@@ -527,6 +677,18 @@ func (m *DeltaCoords) Size() (n int) {
 	return n
 }
 
+func (m *Metadata) Size() (n int) {
+	var l int
+	_ = l
+	n += 1 + sovMessages(uint64(m.Version))
+	n += 1 + sovMessages(uint64(m.Timestamp))
+	n += 1 + sovMessages(uint64(m.Changeset))
+	n += 1 + sovMessages(uint64(m.Uid))
+	l = len(m.User)
+	n += 1 + l + sovMessages(uint64(l))
+	return n
+}
+
 func sovMessages(x uint64) (n int) {
 	for {
 		n++
@@ -639,6 +801,39 @@ func (m *Node) Unmarshal(dAtA []byte) error {
 			}
 			m.Tags = append(m.Tags, string(dAtA[iNdEx:postIndex]))
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Metadata", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessages
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthMessages
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Metadata == nil {
+				m.Metadata = &Metadata{}
+			}
+			if err := m.Metadata.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipMessages(dAtA[iNdEx:])
@@ -786,6 +981,39 @@ func (m *Way) Unmarshal(dAtA []byte) error {
 			} else {
 				return fmt.Errorf("proto: wrong wireType = %d for field Refs", wireType)
 			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Metadata", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessages
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthMessages
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Metadata == nil {
+				m.Metadata = &Metadata{}
+			}
+			if err := m.Metadata.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipMessages(dAtA[iNdEx:])
@@ -1018,6 +1246,39 @@ func (m *Relation) Unmarshal(dAtA []byte) error {
 			}
 			m.MemberRoles = append(m.MemberRoles, string(dAtA[iNdEx:postIndex]))
 			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Metadata", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessages
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthMessages
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Metadata == nil {
+				m.Metadata = &Metadata{}
+			}
+			if err := m.Metadata.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipMessages(dAtA[iNdEx:])
@@ -1281,6 +1542,161 @@ func (m *DeltaCoords) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *Metadata) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowMessages
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Metadata: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Metadata: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			}
+			m.Version = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessages
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Version |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Timestamp", wireType)
+			}
+			m.Timestamp = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessages
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Timestamp |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Changeset", wireType)
+			}
+			m.Changeset = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessages
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Changeset |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Uid", wireType)
+			}
+			m.Uid = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessages
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Uid |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field User", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessages
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthMessages
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.User = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipMessages(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthMessages
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipMessages(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
@@ -1389,27 +1805,33 @@ var (
 func init() { proto.RegisterFile("cache/binary/messages.proto", fileDescriptorMessages) }
 
 var fileDescriptorMessages = []byte{
-	// 334 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x90, 0xd1, 0x4e, 0xc2, 0x30,
-	0x14, 0x86, 0xe9, 0xda, 0x28, 0x1c, 0xd0, 0x2c, 0x8d, 0x21, 0x4b, 0x88, 0x13, 0x77, 0xc5, 0x8d,
-	0x23, 0xfa, 0x00, 0x26, 0x20, 0x5c, 0x90, 0x20, 0x24, 0x95, 0x84, 0x78, 0x65, 0x0a, 0xab, 0x48,
-	0xb2, 0xad, 0x64, 0xed, 0xcd, 0xde, 0xc2, 0xc7, 0xe2, 0x4e, 0x9f, 0xc0, 0x18, 0x7c, 0x11, 0xb3,
-	0x16, 0x86, 0x17, 0xde, 0x9d, 0xff, 0xfb, 0xcf, 0xbf, 0x9d, 0xbf, 0xd0, 0x5a, 0xf2, 0xe5, 0x9b,
-	0xe8, 0x2e, 0xd6, 0x29, 0xcf, 0xf2, 0x6e, 0x22, 0x94, 0xe2, 0x2b, 0xa1, 0xc2, 0x4d, 0x26, 0xb5,
-	0xa4, 0x27, 0x16, 0x07, 0x63, 0x20, 0x13, 0x19, 0x09, 0xea, 0x01, 0x89, 0x65, 0xba, 0xf2, 0x50,
-	0xdb, 0xe9, 0x9c, 0xf5, 0xc9, 0xf6, 0xeb, 0xaa, 0xc2, 0x0c, 0xa1, 0x4d, 0xc0, 0x31, 0xd7, 0x9e,
-	0xf3, 0xc7, 0x28, 0x00, 0xa5, 0x40, 0x34, 0x5f, 0x29, 0x0f, 0xb7, 0x71, 0xa7, 0xc6, 0xcc, 0x1c,
-	0xdc, 0x02, 0x9e, 0xf3, 0xbc, 0xb4, 0xd0, 0xd1, 0xa2, 0x4d, 0x20, 0x99, 0x78, 0x55, 0x9e, 0xd3,
-	0xc6, 0x1d, 0xdc, 0x77, 0x5c, 0xc4, 0x8c, 0x0e, 0x3e, 0x10, 0x54, 0x99, 0x88, 0xb9, 0x5e, 0xcb,
-	0xf4, 0xdf, 0xe0, 0x25, 0x40, 0x22, 0x92, 0x85, 0xc8, 0x5e, 0xd6, 0xd1, 0x3e, 0xce, 0x6a, 0x96,
-	0x8c, 0x22, 0x45, 0xef, 0xa1, 0xb1, 0xb7, 0x75, 0xbe, 0x11, 0xf6, 0x9c, 0xf3, 0xbb, 0x56, 0x68,
-	0xfb, 0x85, 0x87, 0x4f, 0x87, 0x8f, 0x66, 0x69, 0x96, 0x6f, 0x04, 0xab, 0x27, 0xe5, 0xac, 0xe8,
-	0x75, 0x99, 0xcf, 0x64, 0x2c, 0x94, 0x47, 0xcc, 0xaf, 0xf7, 0x2b, 0xac, 0x40, 0xc1, 0x0d, 0xc0,
-	0x31, 0x4d, 0xab, 0x40, 0x26, 0xd3, 0xc1, 0xd0, 0xad, 0xd0, 0x53, 0xc0, 0xf3, 0xde, 0xb3, 0x8b,
-	0x68, 0x03, 0xaa, 0x6c, 0x38, 0xee, 0xcd, 0x46, 0xd3, 0x89, 0xeb, 0x04, 0x4f, 0x50, 0x1f, 0x88,
-	0x58, 0xf3, 0x07, 0x29, 0xb3, 0x48, 0xd1, 0x0b, 0xc0, 0xc5, 0xe1, 0x45, 0x25, 0x6a, 0x7a, 0x17,
-	0xb2, 0x78, 0x8e, 0x98, 0x6b, 0xdb, 0xc7, 0x62, 0xa3, 0x0d, 0x97, 0xa9, 0xad, 0x71, 0xe0, 0x32,
-	0x55, 0x7d, 0x77, 0xbb, 0xf3, 0xd1, 0xe7, 0xce, 0x47, 0xdf, 0x3b, 0x1f, 0xbd, 0xff, 0xf8, 0x95,
-	0xdf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x7f, 0x85, 0x01, 0xea, 0xdf, 0x01, 0x00, 0x00,
+	// 444 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x92, 0xd1, 0x6a, 0xd4, 0x40,
+	0x14, 0x86, 0x77, 0x32, 0x53, 0x9b, 0x3d, 0x5b, 0x25, 0x0c, 0x52, 0x06, 0x8a, 0x31, 0xe6, 0x2a,
+	0x17, 0xba, 0x85, 0x3e, 0x80, 0xd0, 0xb5, 0xbd, 0x28, 0xd8, 0x2d, 0x8c, 0x85, 0xe2, 0x55, 0x99,
+	0x6e, 0x8e, 0xdb, 0x40, 0x92, 0x59, 0x32, 0x53, 0x61, 0x7d, 0x0a, 0x1f, 0xc2, 0x87, 0xe9, 0xa5,
+	0x4f, 0x20, 0xb2, 0x3e, 0x87, 0x20, 0x99, 0x49, 0xd2, 0x2d, 0x08, 0xbd, 0x9b, 0xf3, 0x9d, 0x3f,
+	0xe7, 0xcf, 0x7f, 0x38, 0x70, 0xb0, 0x50, 0x8b, 0x5b, 0x3c, 0xbc, 0x29, 0x6a, 0xd5, 0xac, 0x0f,
+	0x2b, 0x34, 0x46, 0x2d, 0xd1, 0x4c, 0x57, 0x8d, 0xb6, 0x9a, 0x3f, 0xf3, 0x38, 0xfd, 0x06, 0x6c,
+	0xae, 0x73, 0xe4, 0x02, 0x58, 0xa9, 0xeb, 0xa5, 0x20, 0x49, 0x90, 0x3d, 0x9f, 0xb1, 0xfb, 0x5f,
+	0xaf, 0x47, 0xd2, 0x11, 0xbe, 0x0f, 0xb4, 0x54, 0x56, 0x04, 0x5b, 0x8d, 0x16, 0x70, 0x0e, 0xcc,
+	0xaa, 0xa5, 0x11, 0x34, 0xa1, 0xd9, 0x58, 0xba, 0x37, 0x7f, 0x0b, 0x61, 0x85, 0x56, 0xe5, 0xca,
+	0x2a, 0xc1, 0x12, 0x92, 0x4d, 0x8e, 0xa2, 0xa9, 0x37, 0x9a, 0x9e, 0x77, 0x5c, 0x0e, 0x8a, 0xf4,
+	0x1a, 0xe8, 0x95, 0x5a, 0x0f, 0x83, 0xc8, 0xd6, 0xa0, 0x7d, 0x60, 0x0d, 0x7e, 0x31, 0x22, 0x48,
+	0x68, 0x46, 0x67, 0x41, 0x44, 0xa4, 0xab, 0x1f, 0x19, 0xd0, 0x27, 0x0d, 0xfe, 0x12, 0x08, 0x25,
+	0x96, 0xca, 0x16, 0xba, 0xfe, 0xaf, 0xcd, 0x2b, 0x80, 0x0a, 0xab, 0x1b, 0x6c, 0xae, 0x8b, 0xbc,
+	0x33, 0x93, 0x63, 0x4f, 0xce, 0x72, 0xc3, 0xdf, 0xc3, 0x5e, 0xd7, 0xb6, 0xeb, 0x15, 0xfa, 0xa8,
+	0x2f, 0x8e, 0x0e, 0x7a, 0xc7, 0x7e, 0xf4, 0xf4, 0xdc, 0x89, 0x2e, 0xd7, 0x2b, 0x94, 0x93, 0x6a,
+	0x78, 0x1b, 0xfe, 0x66, 0xf8, 0xbe, 0xd1, 0x25, 0x1a, 0xc1, 0x9c, 0x75, 0x27, 0x91, 0x2d, 0x7a,
+	0x14, 0x68, 0xe7, 0xc9, 0x40, 0xef, 0x00, 0x1e, 0xbc, 0x78, 0x08, 0x6c, 0x7e, 0x71, 0x72, 0x1a,
+	0x8d, 0xf8, 0x2e, 0xd0, 0xab, 0xe3, 0xcf, 0x11, 0xe1, 0x7b, 0x10, 0xca, 0xd3, 0x8f, 0xc7, 0x97,
+	0x67, 0x17, 0xf3, 0x28, 0x48, 0x3f, 0xc1, 0xe4, 0x04, 0x4b, 0xab, 0x3e, 0x68, 0xdd, 0xe4, 0x86,
+	0xbf, 0x04, 0x5a, 0xe4, 0x7e, 0x01, 0xdc, 0xed, 0xb4, 0x2d, 0xdb, 0x55, 0x97, 0xca, 0xfa, 0xf4,
+	0x1e, 0xbb, 0xda, 0x71, 0x5d, 0xfb, 0xd0, 0x3d, 0xd7, 0xb5, 0x49, 0x7f, 0x10, 0x08, 0xfb, 0x5f,
+	0xe3, 0x31, 0xec, 0x7e, 0xc5, 0xc6, 0x14, 0xba, 0x16, 0x24, 0x21, 0xd9, 0x4e, 0x77, 0x20, 0x3d,
+	0xe4, 0x29, 0x8c, 0x6d, 0x51, 0xa1, 0xb1, 0xaa, 0x5a, 0x89, 0x20, 0x21, 0x19, 0xed, 0x14, 0x0f,
+	0xb8, 0xd5, 0x2c, 0x6e, 0x55, 0xbd, 0x44, 0x83, 0x56, 0xd0, 0x6d, 0xcd, 0x80, 0xdb, 0x23, 0xbc,
+	0x2b, 0x72, 0xc1, 0xb6, 0x3c, 0x5a, 0xd0, 0x9e, 0xed, 0x9d, 0xc1, 0xc6, 0xad, 0x6e, 0xdc, 0x35,
+	0x1c, 0x99, 0x45, 0xf7, 0x9b, 0x98, 0xfc, 0xdc, 0xc4, 0xe4, 0xf7, 0x26, 0x26, 0xdf, 0xff, 0xc4,
+	0xa3, 0x7f, 0x03, 0x00, 0xd5, 0x2c, 0xd8, 0x66, 0x10, 0x03, 0x00, 0x00,
 }
-
@@ -1,6 +1,10 @@
 package binary
 
-import osm "github.com/omniscale/go-osm"
+import (
+	"time"
+
+	osm "github.com/omniscale/go-osm"
+)
 
 const coordFactor float64 = 11930464.7083 // ((2<<31)-1)/360.0
 
@@ -16,6 +20,7 @@ func MarshalNode(node *osm.Node) ([]byte, error) {
 	pbfNode := &Node{}
 	pbfNode.fromWgsCoord(node.Long, node.Lat)
 	pbfNode.Tags = tagsAsArray(node.Tags)
+	pbfNode.Metadata = metadataToPbf(node.Metadata)
 	return pbfNode.Marshal()
 }
 
@@ -29,6 +34,7 @@ func UnmarshalNode(data []byte) (node *osm.Node, err error) {
 	node = &osm.Node{}
 	node.Long, node.Lat = pbfNode.wgsCoord()
 	node.Tags = tagsFromArray(pbfNode.Tags)
+	node.Metadata = metadataFromPbf(pbfNode.Metadata)
 	return node, nil
 }
 
@@ -57,6 +63,7 @@ func MarshalWay(way *osm.Way) ([]byte, error) {
 	deltaPack(way.Refs)
 	pbfWay.Refs = way.Refs
 	pbfWay.Tags = tagsAsArray(way.Tags)
+	pbfWay.Metadata = metadataToPbf(way.Metadata)
 	return pbfWay.Marshal()
 }
 
@@ -71,6 +78,7 @@ func UnmarshalWay(data []byte) (way *osm.Way, err error) {
 	deltaUnpack(pbfWay.Refs)
 	way.Refs = pbfWay.Refs
 	way.Tags = tagsFromArray(pbfWay.Tags)
+	way.Metadata = metadataFromPbf(pbfWay.Metadata)
 	return way, nil
 }
 
@@ -85,6 +93,7 @@ func MarshalRelation(relation *osm.Relation) ([]byte, error) {
 		pbfRelation.MemberRoles[i] = m.Role
 	}
 	pbfRelation.Tags = tagsAsArray(relation.Tags)
+	pbfRelation.Metadata = metadataToPbf(relation.Metadata)
 	return pbfRelation.Marshal()
 }
 
@@ -104,5 +113,34 @@ func UnmarshalRelation(data []byte) (relation *osm.Relation, err error) {
 	}
 	//relation.Nodes = pbfRelation.Node
 	relation.Tags = tagsFromArray(pbfRelation.Tags)
+	relation.Metadata = metadataFromPbf(pbfRelation.Metadata)
 	return relation, nil
 }
+
+// metadataToPbf returns nil if md is nil. Metadata is only parsed and
+// stored if the mapping requires it.
+func metadataToPbf(md *osm.Metadata) *Metadata {
+	if md == nil {
+		return nil
+	}
+	return &Metadata{
+		Version:   md.Version,
+		Timestamp: md.Timestamp.Unix(),
+		Changeset: md.Changeset,
+		Uid:       md.UserID,
+		User:      md.UserName,
+	}
+}
+
+func metadataFromPbf(md *Metadata) *osm.Metadata {
+	if md == nil {
+		return nil
+	}
+	return &osm.Metadata{
+		Version:   md.Version,
+		Timestamp: time.Unix(md.Timestamp, 0).UTC(),
+		Changeset: md.Changeset,
+		UserID:    md.Uid,
+		UserName:  md.User,
+	}
+}
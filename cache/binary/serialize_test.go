@@ -2,6 +2,7 @@ package binary
 
 import (
 	"testing"
+	"time"
 
 	osm "github.com/omniscale/go-osm"
 )
@@ -155,3 +156,35 @@ func TestDeltaUnpack(t *testing.T) {
 		}
 	}
 }
+
+func TestMarshalMetadata(t *testing.T) {
+	md := &osm.Metadata{
+		Version:   3,
+		Timestamp: time.Date(2019, 5, 23, 10, 0, 0, 0, time.UTC),
+		Changeset: 70123456,
+		UserID:    42,
+		UserName:  "mapper",
+	}
+
+	way := &osm.Way{Element: osm.Element{ID: 12345, Metadata: md}}
+	way.Refs = append(way.Refs, 1, 2, 3, 4)
+	data, _ := MarshalWay(way)
+	way, _ = UnmarshalWay(data)
+	if way.Metadata == nil || *way.Metadata != *md {
+		t.Errorf("metadata does not match: %v", way.Metadata)
+	}
+
+	node := &osm.Node{Element: osm.Element{ID: 12345}}
+	data, _ = MarshalNode(node)
+	node, _ = UnmarshalNode(data)
+	if node.Metadata != nil {
+		t.Errorf("unexpected metadata: %v", node.Metadata)
+	}
+
+	rel := &osm.Relation{Element: osm.Element{ID: 12345, Metadata: md}}
+	data, _ = MarshalRelation(rel)
+	rel, _ = UnmarshalRelation(data)
+	if rel.Metadata == nil || *rel.Metadata != *md {
+		t.Errorf("metadata does not match: %v", rel.Metadata)
+	}
+}
@@ -0,0 +1,60 @@
+package binary
+
+import (
+	bin "encoding/binary"
+	"errors"
+	"math"
+
+	osm "github.com/omniscale/go-osm"
+)
+
+const (
+	wkbLittleEndian byte   = 1
+	wkbLineString   uint32 = 2
+	wkbHeaderSize          = 1 + 4 + 4
+)
+
+// MarshalWayGeom returns the nodes of the way as little endian WKB
+// LineString. The coordinates are stored as-is (without conversion to
+// integers) and can be already projected.
+func MarshalWayGeom(nodes []osm.Node) []byte {
+	buf := make([]byte, wkbHeaderSize+len(nodes)*16)
+	buf[0] = wkbLittleEndian
+	bin.LittleEndian.PutUint32(buf[1:], wkbLineString)
+	bin.LittleEndian.PutUint32(buf[5:], uint32(len(nodes)))
+	offset := wkbHeaderSize
+	for _, nd := range nodes {
+		bin.LittleEndian.PutUint64(buf[offset:], math.Float64bits(nd.Long))
+		bin.LittleEndian.PutUint64(buf[offset+8:], math.Float64bits(nd.Lat))
+		offset += 16
+	}
+	return buf
+}
+
+// UnmarshalWayGeom returns the nodes from a WKB LineString written by
+// MarshalWayGeom. The IDs of the nodes are set from refs, which need to
+// contain one ID for each point.
+func UnmarshalWayGeom(data []byte, refs []int64) ([]osm.Node, error) {
+	if len(data) < wkbHeaderSize || data[0] != wkbLittleEndian {
+		return nil, errors.New("invalid WKB header")
+	}
+	if bin.LittleEndian.Uint32(data[1:]) != wkbLineString {
+		return nil, errors.New("WKB is not a LineString")
+	}
+	n := int(bin.LittleEndian.Uint32(data[5:]))
+	if len(data) != wkbHeaderSize+n*16 {
+		return nil, errors.New("invalid WKB length")
+	}
+	if n != len(refs) {
+		return nil, errors.New("WKB does not match refs")
+	}
+	nodes := make([]osm.Node, n)
+	offset := wkbHeaderSize
+	for i := range nodes {
+		nodes[i].ID = refs[i]
+		nodes[i].Long = math.Float64frombits(bin.LittleEndian.Uint64(data[offset:]))
+		nodes[i].Lat = math.Float64frombits(bin.LittleEndian.Uint64(data[offset+8:]))
+		offset += 16
+	}
+	return nodes, nil
+}
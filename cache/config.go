@@ -29,6 +29,7 @@ type osmCacheOptions struct {
 	Relations   cacheOptions
 	CoordsIndex cacheOptions
 	WaysIndex   cacheOptions
+	MemberGeoms cacheOptions
 }
 
 const defaultConfig = `
@@ -82,6 +83,14 @@ const defaultConfig = `
         "MaxOpenFiles": 64,
         "MaxFileSizeM": 8,
         "BlockRestartInterval": 128
+    },
+    "MemberGeoms": {
+        "CacheSizeM": 16,
+        "WriteBufferSizeM": 64,
+        "BlockSizeK": 0,
+        "MaxOpenFiles": 64,
+        "MaxFileSizeM": 32,
+        "BlockRestartInterval": 128
     }
 }
 `
@@ -1,10 +1,12 @@
 package cache
 
 import (
+	"bytes"
 	"container/list"
 	"sort"
 	"sync"
 
+	"github.com/jmhodges/levigo"
 	osm "github.com/omniscale/go-osm"
 	"github.com/omniscale/imposm3/cache/binary"
 )
@@ -15,6 +17,12 @@ func (s byID) Len() int           { return len(s) }
 func (s byID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s byID) Less(i, j int) bool { return s[i].ID < s[j].ID }
 
+// packBufPool stores *[]byte, as storing slices in a sync.Pool
+// allocates for each Put.
+var packBufPool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
 type coordsBunch struct {
 	sync.Mutex
 	id         int64
@@ -278,10 +286,12 @@ func (c *DeltaCoordsCache) putCoordsPacked(bunchID int64, nodes []osm.Node) erro
 		return c.db.Delete(c.wo, keyBuf)
 	}
 
-	data := make([]byte, 512)
-	data = binary.MarshalDeltaNodes(nodes, data)
-
+	// LevelDB copies the data, the buffer can be reused after Put
+	buf := packBufPool.Get().(*[]byte)
+	data := binary.MarshalDeltaNodes(nodes, *buf)
 	err := c.db.Put(c.wo, keyBuf, data)
+	*buf = data[:0]
+	packBufPool.Put(buf)
 	if err != nil {
 		return err
 	}
@@ -308,6 +318,86 @@ func (c *DeltaCoordsCache) getCoordsPacked(bunchID int64, nodes []osm.Node) ([]o
 	return nodes, nil
 }
 
+// Prefetch loads the coordinate bunches for all refs of the ways that are
+// not already cached in memory. The bunches are read in sorted order with a
+// single LevelDB iterator, which is faster than individual gets as bunches
+// are written in sorted order during the import. Prefetch loads at most
+// half of the bunch cache capacity to keep the other cached bunches.
+// Prefetch must not be called while coordinates are updated concurrently.
+func (c *DeltaCoordsCache) Prefetch(ways []*osm.Way) error {
+	if len(ways) == 0 {
+		return nil
+	}
+	needed := make(map[int64]struct{})
+	c.mu.Lock()
+	for _, w := range ways {
+		for _, ref := range w.Refs {
+			bunchID := c.getBunchID(ref)
+			if _, ok := c.table[bunchID]; !ok {
+				needed[bunchID] = struct{}{}
+			}
+		}
+	}
+	c.mu.Unlock()
+	if len(needed) < 2 {
+		// nothing to gain for a single bunch
+		return nil
+	}
+
+	bunchIDs := make([]int64, 0, len(needed))
+	for bunchID := range needed {
+		bunchIDs = append(bunchIDs, bunchID)
+	}
+	sort.Slice(bunchIDs, func(i, j int) bool { return bunchIDs[i] < bunchIDs[j] })
+	if max := int(c.capacity / 2); len(bunchIDs) > max {
+		bunchIDs = bunchIDs[:max]
+	}
+
+	ro := levigo.NewReadOptions()
+	defer ro.Close()
+	it := c.db.NewIterator(ro)
+	defer it.Close()
+
+	bunches := make([]*coordsBunch, 0, len(bunchIDs))
+	for _, bunchID := range bunchIDs {
+		key := idToKeyBuf(bunchID)
+		// Next is cheaper than Seek for adjacent bunches
+		if it.Valid() && bytes.Compare(it.Key(), key) < 0 {
+			it.Next()
+		}
+		if !it.Valid() || !bytes.Equal(it.Key(), key) {
+			it.Seek(key)
+		}
+		if !it.Valid() {
+			break
+		}
+		if !bytes.Equal(it.Key(), key) {
+			// not in cache
+			continue
+		}
+		nodes, err := binary.UnmarshalDeltaNodes(it.Value(), make([]osm.Node, 0, c.bunchSize))
+		if err != nil {
+			return err
+		}
+		bunches = append(bunches, &coordsBunch{id: bunchID, coords: nodes})
+	}
+	if err := it.GetError(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, bunch := range bunches {
+		if _, ok := c.table[bunch.id]; ok {
+			// loaded in the meantime
+			continue
+		}
+		bunch.elem = c.lruList.PushFront(bunch.id)
+		c.table[bunch.id] = bunch
+	}
+	return c.CheckCapacity()
+}
+
 func (c *DeltaCoordsCache) getBunchID(nodeID int64) int64 {
 	return nodeID / c.bunchSize
 }
@@ -247,3 +247,108 @@ func BenchmarkReadDeltaCoords(b *testing.B) {
 		}
 	}
 }
+
+func TestPrefetchDeltaCoords(t *testing.T) {
+	cacheDir, _ := ioutil.TempDir("", "imposm_test")
+	defer os.RemoveAll(cacheDir)
+
+	cache, err := newDeltaCoordsCache(cacheDir)
+	if err != nil {
+		t.Fatal()
+	}
+	nodes := []osm.Node{}
+	for i := int64(0); i < 1000; i += 7 {
+		nodes = append(nodes, mknode(i))
+	}
+	if err := cache.PutCoords(nodes); err != nil {
+		t.Fatal(err)
+	}
+	cache.Close()
+
+	cache, err = newDeltaCoordsCache(cacheDir)
+	if err != nil {
+		t.Fatal()
+	}
+	defer cache.Close()
+
+	ways := []*osm.Way{
+		{Element: osm.Element{ID: 1}, Refs: []int64{0, 7, 700, 994}},
+		{Element: osm.Element{ID: 2}, Refs: []int64{350, 1001}},
+	}
+	if err := cache.Prefetch(ways); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.table) < 3 {
+		t.Errorf("expected prefetched bunches, got %d", len(cache.table))
+	}
+	if err := cache.FillWay(ways[0]); err != nil {
+		t.Fatal(err)
+	}
+	for i, nd := range ways[0].Nodes {
+		if nd.ID != ways[0].Refs[i] || nd.Long != 8 || nd.Lat != 10 {
+			t.Errorf("unexpected node %v", nd)
+		}
+	}
+	if err := cache.FillWay(ways[1]); err != NotFound {
+		t.Error("expected NotFound for missing coord, got", err)
+	}
+}
+
+// BenchmarkFillWays compares filling the ways of a relation with and
+// without Prefetch, with an empty bunch cache for each iteration.
+func BenchmarkFillWays(b *testing.B) {
+	cacheDir, _ := ioutil.TempDir("", "imposm_test")
+	defer os.RemoveAll(cacheDir)
+
+	cache, err := newDeltaCoordsCache(cacheDir)
+	if err != nil {
+		b.Fatal()
+	}
+	nodes := make([]osm.Node, 200000)
+	for i := range nodes {
+		nodes[i] = mknode(int64(i))
+	}
+	if err := cache.PutCoords(nodes); err != nil {
+		b.Fatal(err)
+	}
+	cache.Close()
+
+	ways := make([]*osm.Way, 50)
+	for i := range ways {
+		refs := make([]int64, 100)
+		for j := range refs {
+			refs[j] = rand.Int63n(int64(len(nodes)))
+		}
+		ways[i] = &osm.Way{Element: osm.Element{ID: int64(i)}, Refs: refs}
+	}
+
+	for _, prefetch := range []bool{false, true} {
+		name := "get"
+		if prefetch {
+			name = "prefetch"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				cache, err := newDeltaCoordsCache(cacheDir)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				if prefetch {
+					if err := cache.Prefetch(ways); err != nil {
+						b.Fatal(err)
+					}
+				}
+				for _, w := range ways {
+					if err := cache.FillWay(w); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StopTimer()
+				cache.Close()
+				b.StartTimer()
+			}
+		})
+	}
+}
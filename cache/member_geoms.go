@@ -0,0 +1,73 @@
+package cache
+
+import (
+	bin "encoding/binary"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/cache/binary"
+)
+
+// MemberGeomsCache stores the built geometries of relation member ways as
+// WKB, so that relations can be rebuilt without loading the coordinates of
+// all unchanged members. Entries are keyed by the way ID and store the way
+// version. Entries need to be deleted if the way or any of its nodes changes,
+// as node modifications do not change the version of the way.
+type MemberGeomsCache struct {
+	cache
+}
+
+func newMemberGeomsCache(path string) (*MemberGeomsCache, error) {
+	cache := MemberGeomsCache{}
+	cache.options = &globalCacheOptions.MemberGeoms
+	err := cache.open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &cache, err
+}
+
+func wayVersion(way *osm.Way) int32 {
+	if way.Metadata == nil {
+		return 0
+	}
+	return way.Metadata.Version
+}
+
+// PutWayGeom stores the (projected) nodes of the way.
+func (c *MemberGeomsCache) PutWayGeom(way *osm.Way) error {
+	if way.ID == SKIP || len(way.Nodes) == 0 {
+		return nil
+	}
+	wkb := binary.MarshalWayGeom(way.Nodes)
+	data := make([]byte, 4+len(wkb))
+	bin.BigEndian.PutUint32(data, uint32(wayVersion(way)))
+	copy(data[4:], wkb)
+	return c.db.Put(c.wo, idToKeyBuf(way.ID), data)
+}
+
+// FillWay sets the nodes of the way from the cached geometry. Returns
+// NotFound if the way is not cached or if the cached geometry is from
+// another version of the way.
+func (c *MemberGeomsCache) FillWay(way *osm.Way) error {
+	data, err := c.db.Get(c.ro, idToKeyBuf(way.ID))
+	if err != nil {
+		return err
+	}
+	if len(data) < 4 {
+		return NotFound
+	}
+	if int32(bin.BigEndian.Uint32(data)) != wayVersion(way) {
+		return NotFound
+	}
+	nodes, err := binary.UnmarshalWayGeom(data[4:], way.Refs)
+	if err != nil {
+		// refs changed without version change
+		return NotFound
+	}
+	way.Nodes = nodes
+	return nil
+}
+
+func (c *MemberGeomsCache) DeleteWay(id int64) error {
+	return c.db.Delete(c.wo, idToKeyBuf(id))
+}
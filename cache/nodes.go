@@ -8,6 +8,13 @@ import (
 
 type NodesCache struct {
 	cache
+	includeUntagged bool
+}
+
+// SetIncludeUntagged enables caching of nodes without tags, for mappings
+// with include_untagged point tables.
+func (p *NodesCache) SetIncludeUntagged(includeUntagged bool) {
+	p.includeUntagged = includeUntagged
 }
 
 func newNodesCache(path string) (*NodesCache, error) {
@@ -24,7 +31,7 @@ func (p *NodesCache) PutNode(node *osm.Node) error {
 	if node.ID == SKIP {
 		return nil
 	}
-	if node.Tags == nil {
+	if node.Tags == nil && !p.includeUntagged {
 		return nil
 	}
 	keyBuf := idToKeyBuf(node.ID)
@@ -44,7 +51,7 @@ func (p *NodesCache) PutNodes(nodes []osm.Node) (int, error) {
 		if node.ID == SKIP {
 			continue
 		}
-		if len(node.Tags) == 0 {
+		if len(node.Tags) == 0 && !p.includeUntagged {
 			continue
 		}
 		keyBuf := idToKeyBuf(node.ID)
@@ -17,12 +17,13 @@ var (
 const SKIP int64 = -1
 
 type OSMCache struct {
-	dir       string
-	Coords    *DeltaCoordsCache
-	Ways      *WaysCache
-	Nodes     *NodesCache
-	Relations *RelationsCache
-	opened    bool
+	dir         string
+	Coords      *DeltaCoordsCache
+	Ways        *WaysCache
+	Nodes       *NodesCache
+	Relations   *RelationsCache
+	MemberGeoms *MemberGeomsCache
+	opened      bool
 }
 
 func (c *OSMCache) Close() {
@@ -42,6 +43,10 @@ func (c *OSMCache) Close() {
 		c.Relations.Close()
 		c.Relations = nil
 	}
+	if c.MemberGeoms != nil {
+		c.MemberGeoms.Close()
+		c.MemberGeoms = nil
+	}
 }
 
 func NewOSMCache(dir string) *OSMCache {
@@ -50,10 +55,20 @@ func NewOSMCache(dir string) *OSMCache {
 }
 
 func (c *OSMCache) Open() error {
+	existing := c.Exists()
 	err := os.MkdirAll(c.dir, 0755)
 	if err != nil {
 		return err
 	}
+	if existing {
+		if err := checkVersion(c.dir); err != nil {
+			return err
+		}
+	} else {
+		if err := writeVersion(c.dir); err != nil {
+			return err
+		}
+	}
 	c.Coords, err = newDeltaCoordsCache(filepath.Join(c.dir, "coords"))
 	if err != nil {
 		return err
@@ -73,6 +88,11 @@ func (c *OSMCache) Open() error {
 		c.Close()
 		return err
 	}
+	c.MemberGeoms, err = newMemberGeomsCache(filepath.Join(c.dir, "member_geoms"))
+	if err != nil {
+		c.Close()
+		return err
+	}
 	c.opened = true
 	return nil
 }
@@ -96,6 +116,9 @@ func (c *OSMCache) Exists() bool {
 	if _, err := os.Stat(filepath.Join(c.dir, "inserted_ways")); !os.IsNotExist(err) {
 		return true
 	}
+	if _, err := os.Stat(filepath.Join(c.dir, "member_geoms")); !os.IsNotExist(err) {
+		return true
+	}
 	return false
 }
 
@@ -118,6 +141,12 @@ func (c *OSMCache) Remove() error {
 	if err := os.RemoveAll(filepath.Join(c.dir, "inserted_ways")); err != nil {
 		return err
 	}
+	if err := os.RemoveAll(filepath.Join(c.dir, "member_geoms")); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(c.dir, versionFilename)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
 	return nil
 }
 
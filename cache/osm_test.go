@@ -179,3 +179,56 @@ func TestIDs(t *testing.T) {
 	}
 
 }
+
+func TestReadWriteMemberGeom(t *testing.T) {
+	cacheDir, _ := ioutil.TempDir("", "imposm_test")
+	defer os.RemoveAll(cacheDir)
+
+	cache, err := newMemberGeomsCache(cacheDir)
+	if err != nil {
+		t.Fatal()
+	}
+	defer cache.Close()
+
+	way := &osm.Way{
+		Element: osm.Element{ID: 1234, Metadata: &osm.Metadata{Version: 3}},
+		Refs:    []int64{1, 2, 3},
+		Nodes: []osm.Node{
+			{Element: osm.Element{ID: 1}, Long: 1000.5, Lat: 2000.25},
+			{Element: osm.Element{ID: 2}, Long: 1010, Lat: 2000},
+			{Element: osm.Element{ID: 3}, Long: 1010, Lat: 2010.125},
+		},
+	}
+	if err := cache.PutWayGeom(way); err != nil {
+		t.Fatal(err)
+	}
+
+	filled := &osm.Way{Element: way.Element, Refs: way.Refs}
+	if err := cache.FillWay(filled); err != nil {
+		t.Fatal(err)
+	}
+	for i, nd := range filled.Nodes {
+		if nd.ID != way.Nodes[i].ID || nd.Long != way.Nodes[i].Long || nd.Lat != way.Nodes[i].Lat {
+			t.Errorf("unexpected node %d: %v != %v", i, nd, way.Nodes[i])
+		}
+	}
+
+	// other version
+	filled = &osm.Way{Element: osm.Element{ID: 1234, Metadata: &osm.Metadata{Version: 4}}, Refs: way.Refs}
+	if err := cache.FillWay(filled); err != NotFound {
+		t.Error("expected NotFound for other version, got", err)
+	}
+	// other refs
+	filled = &osm.Way{Element: way.Element, Refs: []int64{1, 2}}
+	if err := cache.FillWay(filled); err != NotFound {
+		t.Error("expected NotFound for other refs, got", err)
+	}
+
+	if err := cache.DeleteWay(1234); err != nil {
+		t.Fatal(err)
+	}
+	filled = &osm.Way{Element: way.Element, Refs: way.Refs}
+	if err := cache.FillWay(filled); err != NotFound {
+		t.Error("expected NotFound for deleted way, got", err)
+	}
+}
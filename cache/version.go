@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/omniscale/imposm3"
+	"github.com/omniscale/imposm3/log"
+)
+
+// FormatVersion is the version of the format of the cache files. It is
+// increased with every change that makes existing caches unreadable or
+// that would corrupt them (e.g. serialization of elements or keys).
+//
+// Format 2 adds the OSM metadata of elements and the geometries of relation
+// member ways (member_geoms).
+const FormatVersion = 2
+
+// versionFilename is the file in the cache directory with the format
+// version and the Imposm version that created the cache.
+const versionFilename = "cache.version"
+
+type cacheVersion struct {
+	Format int    `json:"format"`
+	Imposm string `json:"imposm"`
+}
+
+// IncompatibleVersionError is returned for caches with a different format
+// version. Imposm is empty for caches of older versions without version
+// file.
+type IncompatibleVersionError struct {
+	Dir    string
+	Format int
+	Imposm string
+}
+
+func (e *IncompatibleVersionError) Error() string {
+	hint := "import again with -read -overwritecache"
+	if e.Imposm != "" {
+		hint = fmt.Sprintf("use Imposm %s or %s", e.Imposm, hint)
+	}
+	return fmt.Sprintf("cache in %s has format %d, but Imposm %s requires cache format %d: %s",
+		e.Dir, e.Format, imposm3.Version, FormatVersion, hint)
+}
+
+func writeVersion(dir string) error {
+	b, err := json.Marshal(cacheVersion{Format: FormatVersion, Imposm: imposm3.Version})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, versionFilename), append(b, '\n'), 0644)
+}
+
+// checkVersion returns an IncompatibleVersionError if the cache in dir has
+// a different format version. Caches of older Imposm versions without
+// version file have format 1, the version file is added if this format is
+// still compatible.
+func checkVersion(dir string) error {
+	b, err := ioutil.ReadFile(filepath.Join(dir, versionFilename))
+	if os.IsNotExist(err) {
+		if FormatVersion != 1 {
+			return &IncompatibleVersionError{Dir: dir, Format: 1}
+		}
+		log.Printf("[info] Adding version file to cache %s", dir)
+		return writeVersion(dir)
+	}
+	if err != nil {
+		return err
+	}
+	v := cacheVersion{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("reading %s: %s", filepath.Join(dir, versionFilename), err)
+	}
+	if v.Format != FormatVersion {
+		return &IncompatibleVersionError{Dir: dir, Format: v.Format, Imposm: v.Imposm}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_version_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// caches without version file have format 1
+	err = checkVersion(dir)
+	if verr, ok := err.(*IncompatibleVersionError); !ok || verr.Format != 1 || verr.Imposm != "" {
+		t.Fatal("expected IncompatibleVersionError, got", err)
+	}
+
+	if err := writeVersion(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkVersion(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, versionFilename), []byte(`{"format": 99, "imposm": "9.9.9"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = checkVersion(dir)
+	if verr, ok := err.(*IncompatibleVersionError); !ok || verr.Format != 99 || verr.Imposm != "9.9.9" {
+		t.Fatal("expected IncompatibleVersionError, got", err)
+	}
+}
@@ -0,0 +1,246 @@
+// Package changes records all rows that are inserted, updated or deleted
+// during a diff import and writes them as newline delimited JSON.
+package changes
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	Insert = "insert"
+	Update = "update"
+	Delete = "delete"
+)
+
+// Change is a single line in the exported files.
+type Change struct {
+	Op  string                 `json:"op"`
+	ID  int64                  `json:"id"`
+	Row map[string]interface{} `json:"row,omitempty"`
+}
+
+type tableChanges struct {
+	deleted  map[int64]struct{}
+	inserted map[int64][]map[string]interface{}
+}
+
+// Recorder wraps a database.Deleter and records all inserted and deleted
+// rows. Rows of elements that are deleted and inserted again are exported as
+// updates.
+type Recorder struct {
+	database.Deleter
+
+	mu      sync.Mutex
+	columns map[string][]string
+	tables  map[string]*tableChanges
+	out     string
+}
+
+func NewRecorder(db database.Deleter, m *config.Mapping, out string) *Recorder {
+	columns := make(map[string][]string)
+	for name, t := range m.Tables {
+		for _, c := range t.Columns {
+			columns[name] = append(columns[name], c.Name)
+		}
+	}
+	return &Recorder{
+		Deleter: db,
+		columns: columns,
+		tables:  make(map[string]*tableChanges),
+		out:     out,
+	}
+}
+
+func (r *Recorder) table(name string) *tableChanges {
+	tc, ok := r.tables[name]
+	if !ok {
+		tc = &tableChanges{
+			deleted:  make(map[int64]struct{}),
+			inserted: make(map[int64][]map[string]interface{}),
+		}
+		r.tables[name] = tc
+	}
+	return tc
+}
+
+func (r *Recorder) record(id int64, matches []mapping.Match, row func(m *mapping.Match) []interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range matches {
+		m := &matches[i]
+		values := row(m)
+		cols := r.columns[m.Table.Name]
+		rowMap := make(map[string]interface{}, len(values))
+		for i, v := range values {
+			if i < len(cols) {
+				rowMap[cols[i]] = v
+			}
+		}
+		tc := r.table(m.Table.Name)
+		tc.inserted[id] = append(tc.inserted[id], rowMap)
+	}
+}
+
+func (r *Recorder) InsertPoint(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	if err := r.Deleter.InsertPoint(elem, geom, matches); err != nil {
+		return err
+	}
+	r.record(elem.ID, matches, func(m *mapping.Match) []interface{} { return m.Row(&elem, &geom) })
+	return nil
+}
+
+func (r *Recorder) InsertLineString(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	if err := r.Deleter.InsertLineString(elem, geom, matches); err != nil {
+		return err
+	}
+	r.record(elem.ID, matches, func(m *mapping.Match) []interface{} { return m.Row(&elem, &geom) })
+	return nil
+}
+
+func (r *Recorder) InsertPolygon(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	if err := r.Deleter.InsertPolygon(elem, geom, matches); err != nil {
+		return err
+	}
+	r.record(elem.ID, matches, func(m *mapping.Match) []interface{} { return m.Row(&elem, &geom) })
+	return nil
+}
+
+func (r *Recorder) InsertRelationMember(rel osm.Relation, member osm.Member, geom geom.Geometry, matches []mapping.Match) error {
+	if err := r.Deleter.InsertRelationMember(rel, member, geom, matches); err != nil {
+		return err
+	}
+	r.record(rel.ID, matches, func(m *mapping.Match) []interface{} { return m.MemberRow(&rel, &member, &geom) })
+	return nil
+}
+
+func (r *Recorder) Delete(id int64, matches []mapping.Match) error {
+	if err := r.Deleter.Delete(id, matches); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range matches {
+		r.table(m.Table.Name).deleted[id] = struct{}{}
+	}
+	return nil
+}
+
+// InsertReject passes the reject to the database, if it supports rejects.
+func (r *Recorder) InsertReject(elemType string, id int64, reason, message string, tags osm.Tags) error {
+	if rw, ok := r.Deleter.(database.RejectWriter); ok {
+		return rw.InsertReject(elemType, id, reason, message, tags)
+	}
+	return nil
+}
+
+// DeleteRejects passes the deletion to the database, if it supports rejects.
+func (r *Recorder) DeleteRejects(elemType string, id int64) error {
+	if rw, ok := r.Deleter.(database.RejectWriter); ok {
+		return rw.DeleteRejects(elemType, id)
+	}
+	return nil
+}
+
+// Changes returns all recorded changes for the table, sorted by ID.
+func (r *Recorder) Changes(table string) []Change {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tc, ok := r.tables[table]
+	if !ok {
+		return nil
+	}
+
+	var changes []Change
+	for id, rows := range tc.inserted {
+		op := Insert
+		if _, ok := tc.deleted[id]; ok {
+			op = Update
+		}
+		for _, row := range rows {
+			changes = append(changes, Change{Op: op, ID: id, Row: row})
+		}
+	}
+	for id := range tc.deleted {
+		if _, ok := tc.inserted[id]; !ok {
+			changes = append(changes, Change{Op: Delete, ID: id})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+	return changes
+}
+
+// Flush writes one .ndjson file for each table with changes into a new
+// directory (YYYYmmdd/HHMMSS.sss) inside the output directory.
+// The directory is renamed into place after all files are written.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	var tables []string
+	for name := range r.tables {
+		tables = append(tables, name)
+	}
+	r.mu.Unlock()
+	if len(tables) == 0 {
+		return nil
+	}
+	sort.Strings(tables)
+
+	now := time.Now().UTC()
+	dayDir := filepath.Join(r.out, now.Format("20060102"))
+	if err := os.MkdirAll(dayDir, 0755); err != nil {
+		return err
+	}
+	name := now.Format("150405.000")
+	tmpDir := filepath.Join(dayDir, "."+name+".tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if err := writeChanges(filepath.Join(tmpDir, table+".ndjson"), r.Changes(table)); err != nil {
+			os.RemoveAll(tmpDir)
+			return err
+		}
+	}
+	if err := os.Rename(tmpDir, filepath.Join(dayDir, name)); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	r.mu.Lock()
+	r.tables = make(map[string]*tableChanges)
+	r.mu.Unlock()
+	return nil
+}
+
+func writeChanges(fileName string, changes []Change) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, c := range changes {
+		if err := enc.Encode(c); err != nil {
+			f.Close()
+			return errors.Wrapf(err, "encoding change for %d", c.ID)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,130 @@
+package changes
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping"
+)
+
+type nullDeleter struct{}
+
+func (*nullDeleter) InsertPoint(osm.Element, geom.Geometry, []mapping.Match) error      { return nil }
+func (*nullDeleter) InsertLineString(osm.Element, geom.Geometry, []mapping.Match) error { return nil }
+func (*nullDeleter) InsertPolygon(osm.Element, geom.Geometry, []mapping.Match) error    { return nil }
+func (*nullDeleter) InsertRelationMember(osm.Relation, osm.Member, geom.Geometry, []mapping.Match) error {
+	return nil
+}
+func (*nullDeleter) Delete(int64, []mapping.Match) error { return nil }
+
+const testMapping = `
+tables:
+  pois:
+    type: point
+    columns:
+      - name: osm_id
+        type: id
+      - name: name
+        type: string
+        key: name
+    mapping:
+      amenity: [__any__]
+`
+
+func TestRecorder(t *testing.T) {
+	m, err := mapping.New([]byte(testMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpdir, err := ioutil.TempDir("", "imposm3_changes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	r := NewRecorder(&nullDeleter{}, &m.Conf, tmpdir)
+
+	node := func(id int64, name string) *osm.Node {
+		n := &osm.Node{}
+		n.ID = id
+		n.Tags = osm.Tags{"amenity": "pub", "name": name}
+		return n
+	}
+	insert := func(n *osm.Node) {
+		matches := m.PointMatcher.MatchNode(n)
+		if err := r.InsertPoint(n.Element, geom.Geometry{}, matches); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// modified
+	n := node(1, "Old")
+	if err := r.Delete(1, m.PointMatcher.MatchNode(n)); err != nil {
+		t.Fatal(err)
+	}
+	insert(node(1, "New"))
+	// created
+	insert(node(2, "Created"))
+	// deleted
+	if err := r.Delete(3, m.PointMatcher.MatchNode(node(3, "Deleted"))); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := r.Changes("pois")
+	if len(changes) != 3 {
+		t.Fatal("unexpected changes", changes)
+	}
+	for i, expected := range []Change{
+		{Op: Update, ID: 1, Row: map[string]interface{}{"osm_id": int64(1), "name": "New"}},
+		{Op: Insert, ID: 2, Row: map[string]interface{}{"osm_id": int64(2), "name": "Created"}},
+		{Op: Delete, ID: 3},
+	} {
+		c := changes[i]
+		if c.Op != expected.Op || c.ID != expected.ID || len(c.Row) != len(expected.Row) {
+			t.Errorf("unexpected change %v != %v", c, expected)
+		}
+		for k, v := range expected.Row {
+			if c.Row[k] != v {
+				t.Errorf("unexpected %s value in %v != %v", k, c, expected)
+			}
+		}
+	}
+
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(tmpdir, "*", "*", "pois.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatal("expected single pois.ndjson file", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	lines := 0
+	for scanner.Scan() {
+		var c Change
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			t.Fatal(err)
+		}
+		lines++
+	}
+	if lines != 3 {
+		t.Error("unexpected number of lines", lines)
+	}
+	if r.Changes("pois") != nil {
+		t.Error("changes not reset after Flush")
+	}
+}
@@ -7,10 +7,15 @@ import (
 	"strings"
 
 	"github.com/omniscale/imposm3"
+	"github.com/omniscale/imposm3/bootstrap"
 	"github.com/omniscale/imposm3/cache/query"
 	"github.com/omniscale/imposm3/config"
 	"github.com/omniscale/imposm3/import_"
 	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping/diffmapping"
+	"github.com/omniscale/imposm3/mapping/explain"
+	"github.com/omniscale/imposm3/mapping/testmapping"
+	"github.com/omniscale/imposm3/serve"
 	"github.com/omniscale/imposm3/stats"
 	"github.com/omniscale/imposm3/update"
 )
@@ -19,9 +24,16 @@ func PrintCmds() {
 	fmt.Fprintf(os.Stderr, "Usage: %s COMMAND [args]\n\n", os.Args[0])
 	fmt.Println("Available commands:")
 	fmt.Println("\timport")
+	fmt.Println("\treimport-table")
 	fmt.Println("\tdiff")
 	fmt.Println("\trun")
 	fmt.Println("\tquery-cache")
+	fmt.Println("\ttest-mapping")
+	fmt.Println("\texplain")
+	fmt.Println("\tdiff-mapping")
+	fmt.Println("\tsoak-test")
+	fmt.Println("\tbootstrap")
+	fmt.Println("\tserve")
 	fmt.Println("\tversion")
 }
 
@@ -45,23 +57,62 @@ func Main(usage func()) {
 		if opts.Base.HTTPProfile != "" {
 			stats.StartHTTPPProf(opts.Base.HTTPProfile)
 		}
+		if opts.Base.OTLPEndpoint != "" {
+			stats.StartTracing(opts.Base.OTLPEndpoint)
+		}
 		import_.Import(opts)
+		stats.StopTracing()
+	case "reimport-table":
+		opts := config.ParseReimport(os.Args[2:])
+		if opts.Base.HTTPProfile != "" {
+			stats.StartHTTPPProf(opts.Base.HTTPProfile)
+		}
+		if opts.Base.OTLPEndpoint != "" {
+			stats.StartTracing(opts.Base.OTLPEndpoint)
+		}
+		import_.Reimport(opts)
+		stats.StopTracing()
 	case "diff":
 		opts, files := config.ParseDiffImport(os.Args[2:])
 
 		if opts.HTTPProfile != "" {
 			stats.StartHTTPPProf(opts.HTTPProfile)
 		}
+		if opts.OTLPEndpoint != "" {
+			stats.StartTracing(opts.OTLPEndpoint)
+		}
 		update.Diff(opts, files)
+		stats.StopTracing()
 	case "run":
 		opts := config.ParseRunImport(os.Args[2:])
 
 		if opts.HTTPProfile != "" {
 			stats.StartHTTPPProf(opts.HTTPProfile)
 		}
+		if opts.OTLPEndpoint != "" {
+			stats.StartTracing(opts.OTLPEndpoint)
+		}
 		update.Run(opts)
+		stats.StopTracing()
 	case "query-cache":
 		query.Query(os.Args[2:])
+	case "soak-test":
+		opts := config.ParseSoakTest(os.Args[2:])
+		if opts.Base.OTLPEndpoint != "" {
+			stats.StartTracing(opts.Base.OTLPEndpoint)
+		}
+		update.SoakTest(opts)
+		stats.StopTracing()
+	case "bootstrap":
+		bootstrap.Bootstrap(os.Args[2:])
+	case "serve":
+		serve.Serve(config.ParseServe(os.Args[2:]))
+	case "test-mapping":
+		testmapping.TestMapping(os.Args[2:])
+	case "explain":
+		explain.Explain(os.Args[2:])
+	case "diff-mapping":
+		diffmapping.DiffMapping(os.Args[2:])
 	case "version":
 		fmt.Println(imposm3.Version)
 		os.Exit(0)
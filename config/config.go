@@ -6,6 +6,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/omniscale/imposm3/log"
@@ -18,13 +20,24 @@ type Config struct {
 	MappingFile         string          `json:"mapping"`
 	LimitTo             string          `json:"limitto"`
 	LimitToCacheBuffer  float64         `json:"limitto_cache_buffer"`
+	LimitToCacheBbox    bool            `json:"limitto_cache_bbox"`
+	LimitToMode         string          `json:"limitto_mode"`
 	Srid                int             `json:"srid"`
 	Schemas             Schemas         `json:"schemas"`
 	ExpireTilesDir      string          `json:"expiretiles_dir"`
 	ExpireTilesZoom     int             `json:"expiretiles_zoom"`
+	ExpireTilesChecksum bool            `json:"expiretiles_checksum"`
+	ExportChangesDir    string          `json:"export_changes_dir"`
 	ReplicationURL      string          `json:"replication_url"`
 	ReplicationInterval MinutesInterval `json:"replication_interval"`
 	DiffStateBefore     MinutesInterval `json:"diff_state_before"`
+	OTLPEndpoint        string          `json:"otlp_endpoint"`
+	ThrottleWindows     []string        `json:"throttle_windows"`
+	ThrottleRate        int             `json:"throttle_rate"`
+
+	// Profiles contain named sets of options that overwrite the options
+	// above when selected with -profile.
+	Profiles map[string]json.RawMessage `json:"profiles"`
 }
 
 type Schemas struct {
@@ -47,16 +60,37 @@ type Base struct {
 	Srid                int
 	LimitTo             string
 	LimitToCacheBuffer  float64
+	LimitToCacheBbox    bool
+	LimitToMode         string
 	ConfigFile          string
+	Profile             string
 	HTTPProfile         string
 	Quiet               bool
 	Schemas             Schemas
 	ExpireTilesDir      string
 	ExpireTilesZoom     int
+	ExpireTilesChecksum bool
+	ExportChangesDir    string
 	ReplicationURL      string
 	ReplicationInterval time.Duration
 	DiffStateBefore     time.Duration
 	ForceDiffImport     bool
+	ForceMappingChange  bool
+	// VacuumThreshold is the ratio of dead tuples of a table that triggers
+	// a VACUUM (or a recommendation) in run mode. Zero disables checks.
+	VacuumThreshold float64
+	Vacuum          bool
+	// OTLPEndpoint is the OpenTelemetry collector for traces
+	// (OTLP/HTTP), e.g. http://localhost:4318.
+	OTLPEndpoint string
+	// ThrottleWindows are time windows in the crontab format, during
+	// which -write and diff imports are limited to ThrottleRate rows
+	// per second.
+	ThrottleWindows []string
+	ThrottleRate    int
+	// RepairState restores last.state.txt from the sequence that is
+	// recorded in the database before diff imports.
+	RepairState bool
 }
 
 func (o *Base) updateFromConfig() error {
@@ -70,6 +104,7 @@ func (o *Base) updateFromConfig() error {
 		if err != nil {
 			return err
 		}
+		defer f.Close()
 		decoder := json.NewDecoder(f)
 
 		err = decoder.Decode(&conf)
@@ -77,6 +112,11 @@ func (o *Base) updateFromConfig() error {
 			return err
 		}
 	}
+	if o.Profile != "" {
+		if err := conf.applyProfile(o.Profile); err != nil {
+			return err
+		}
+	}
 
 	if conf.Schemas.Import != "" && o.Schemas.Import == defaultSchemaImport {
 		o.Schemas.Import = conf.Schemas.Import
@@ -110,6 +150,15 @@ func (o *Base) updateFromConfig() error {
 	if o.LimitToCacheBuffer == 0.0 {
 		o.LimitToCacheBuffer = conf.LimitToCacheBuffer
 	}
+	if !o.LimitToCacheBbox {
+		o.LimitToCacheBbox = conf.LimitToCacheBbox
+	}
+	if o.LimitToMode == "" {
+		o.LimitToMode = conf.LimitToMode
+	}
+	if o.LimitToMode == "" {
+		o.LimitToMode = "clip"
+	}
 	if o.CacheDir == defaultCacheDir {
 		o.CacheDir = conf.CacheDir
 	}
@@ -120,9 +169,15 @@ func (o *Base) updateFromConfig() error {
 	if o.ExpireTilesZoom == 0 {
 		o.ExpireTilesZoom = conf.ExpireTilesZoom
 	}
+	if !o.ExpireTilesChecksum {
+		o.ExpireTilesChecksum = conf.ExpireTilesChecksum
+	}
 	if o.ExpireTilesZoom < 6 || o.ExpireTilesZoom > 18 {
 		o.ExpireTilesZoom = 14
 	}
+	if o.ExportChangesDir == "" {
+		o.ExportChangesDir = conf.ExportChangesDir
+	}
 
 	if conf.ReplicationInterval.Duration != 0 && o.ReplicationInterval == time.Minute {
 		o.ReplicationInterval = conf.ReplicationInterval.Duration
@@ -144,6 +199,32 @@ func (o *Base) updateFromConfig() error {
 	if conf.DiffStateBefore.Duration != 0 && o.DiffStateBefore == 0 {
 		o.DiffStateBefore = conf.DiffStateBefore.Duration
 	}
+
+	if o.OTLPEndpoint == "" {
+		o.OTLPEndpoint = conf.OTLPEndpoint
+	}
+	if o.OTLPEndpoint == "" {
+		o.OTLPEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+
+	if len(o.ThrottleWindows) == 0 {
+		o.ThrottleWindows = conf.ThrottleWindows
+	}
+	if o.ThrottleRate == 0 {
+		o.ThrottleRate = conf.ThrottleRate
+	}
+	return nil
+}
+
+// applyProfile overwrites all options that are set in the named profile.
+func (c *Config) applyProfile(name string) error {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q in config", name)
+	}
+	if err := json.Unmarshal(profile, c); err != nil {
+		return fmt.Errorf("parsing profile %q: %s", name, err)
+	}
 	return nil
 }
 
@@ -155,6 +236,11 @@ func (o *Base) check() []error {
 	if o.MappingFile == "" {
 		errs = append(errs, errors.New("missing mapping"))
 	}
+	switch o.LimitToMode {
+	case "", "clip", "intersects", "centroid-within":
+	default:
+		errs = append(errs, fmt.Errorf("unknown -limittomode %q (clip, intersects or centroid-within)", o.LimitToMode))
+	}
 	return errs
 }
 
@@ -169,6 +255,30 @@ type Import struct {
 	DeployProduction bool
 	RevertDeploy     bool
 	RemoveBackup     bool
+	SkipDiskSpace    bool
+	// Resume continues an interrupted -write after the last completed
+	// phase.
+	Resume bool
+	// DeployLockTimeout and DeployRetries configure how -deployproduction,
+	// -revertdeploy and -removebackup handle locked tables.
+	DeployLockTimeout time.Duration
+	DeployRetries     int
+	// SkippedReportDir enables the report of skipped elements during
+	// -write. SkippedReportLimit and SkippedReportSample limit the
+	// number of reported IDs.
+	SkippedReportDir    string
+	SkippedReportLimit  int
+	SkippedReportSample int
+	// MultipolygonReportDir enables the report of multipolygon errors
+	// during -write. MultipolygonErrorsTable also writes the errors into
+	// the rejects table.
+	MultipolygonReportDir   string
+	MultipolygonErrorsTable bool
+	// Ordered enables ordered writes for reproducible imports.
+	Ordered bool
+	// WriteConcurrency is the number of concurrent COPY connections
+	// during -write.
+	WriteConcurrency int
 }
 
 func addBaseFlags(opts *Base, flags *flag.FlagSet) {
@@ -179,12 +289,30 @@ func addBaseFlags(opts *Base, flags *flag.FlagSet) {
 	flags.IntVar(&opts.Srid, "srid", defaultSrid, "srs id")
 	flags.StringVar(&opts.LimitTo, "limitto", "", "limit to geometries")
 	flags.Float64Var(&opts.LimitToCacheBuffer, "limittocachebuffer", 0.0, "limit to buffer for cache")
+	flags.BoolVar(&opts.LimitToCacheBbox, "limittocachebbox", false, "only cache nodes, ways and relations within the bbox of -limitto (with 0.5 degrees margin)")
+	flags.StringVar(&opts.LimitToMode, "limittomode", "", "clip geometries to -limitto or import complete geometries that intersect it or that have their centroid within it (clip, intersects or centroid-within)")
 	flags.StringVar(&opts.ConfigFile, "config", "", "config (json)")
+	flags.StringVar(&opts.Profile, "profile", "", "use options from this profile of the config")
 	flags.StringVar(&opts.HTTPProfile, "httpprofile", "", "bind address for profile server")
+	flags.StringVar(&opts.OTLPEndpoint, "otlp-endpoint", "", "export traces to this OpenTelemetry collector (OTLP/HTTP)")
 	flags.BoolVar(&opts.Quiet, "quiet", false, "quiet log output")
 	flags.StringVar(&opts.Schemas.Import, "dbschema-import", defaultSchemaImport, "db schema for imports")
 	flags.StringVar(&opts.Schemas.Production, "dbschema-production", defaultSchemaProduction, "db schema for production")
 	flags.StringVar(&opts.Schemas.Backup, "dbschema-backup", defaultSchemaBackup, "db schema for backups")
+	flags.Var((*stringList)(&opts.ThrottleWindows), "throttle-window", "throttle during this time window (crontab format, e.g. \"* 8-19 * * 1-5\"), can be repeated")
+	flags.IntVar(&opts.ThrottleRate, "throttle-rate", 0, "max number of written rows per second during the throttle windows")
+}
+
+// stringList is a flag that can be set multiple times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
 }
 
 func ParseImport(args []string) Import {
@@ -196,13 +324,24 @@ func ParseImport(args []string) Import {
 	flags.BoolVar(&opts.Appendcache, "appendcache", false, "append cache")
 	flags.StringVar(&opts.Read, "read", "", "read")
 	flags.BoolVar(&opts.Write, "write", false, "write")
+	flags.BoolVar(&opts.Resume, "resume", false, "resume an interrupted -write after the last completed phase")
 	flags.BoolVar(&opts.Optimize, "optimize", false, "optimize")
 	flags.BoolVar(&opts.Diff, "diff", false, "enable diff support")
 	flags.BoolVar(&opts.DeployProduction, "deployproduction", false, "deploy production")
 	flags.BoolVar(&opts.RevertDeploy, "revertdeploy", false, "revert deploy to production")
 	flags.BoolVar(&opts.RemoveBackup, "removebackup", false, "remove backups from deploy")
+	flags.BoolVar(&opts.SkipDiskSpace, "skip-diskspace-check", false, "do not check for free disk space of the cache and local output files before -read")
+	flags.DurationVar(&opts.DeployLockTimeout, "deploy-lock-timeout", 0, "lock timeout for each deploy transaction (e.g. 10s), 0 for no timeout")
+	flags.IntVar(&opts.DeployRetries, "deploy-retries", 0, "number of retries of a deploy transaction after a lock timeout")
+	flags.StringVar(&opts.SkippedReportDir, "skipped-report-dir", "", "write report of skipped elements into this directory")
+	flags.IntVar(&opts.SkippedReportLimit, "skipped-report-limit", 10000, "max number of reported IDs for each reason and element type")
+	flags.IntVar(&opts.SkippedReportSample, "skipped-report-sample", 1, "only report every n-th ID")
+	flags.StringVar(&opts.MultipolygonReportDir, "multipolygon-report-dir", "", "write report of multipolygon errors into this directory")
+	flags.BoolVar(&opts.MultipolygonErrorsTable, "multipolygon-errors-table", false, "write multipolygon errors into the rejects table")
 	flags.DurationVar(&opts.Base.DiffStateBefore, "diff-state-before", 0, "set initial diff sequence before")
 	flags.DurationVar(&opts.Base.ReplicationInterval, "replication-interval", time.Minute, "replication interval as duration (1m, 1h, 24h)")
+	flags.BoolVar(&opts.Ordered, "ordered", false, "write all rows in a reproducible order")
+	flags.IntVar(&opts.WriteConcurrency, "writeconcurrency", 0, "number of concurrent COPY connections during -write, at least one for each table (0 for one for each table)")
 
 	flags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s %s [args]\n\n", os.Args[0], os.Args[1])
@@ -237,7 +376,11 @@ func ParseDiffImport(args []string) (Base, []string) {
 	addBaseFlags(&opts, flags)
 	flags.StringVar(&opts.ExpireTilesDir, "expiretiles-dir", "", "write expire tiles into dir")
 	flags.IntVar(&opts.ExpireTilesZoom, "expiretiles-zoom", 14, "write expire tiles in this zoom level")
+	flags.BoolVar(&opts.ExpireTilesChecksum, "expiretiles-checksum", false, "write the SHA256 checksum of each expire tiles file into a .sha256 file")
+	flags.StringVar(&opts.ExportChangesDir, "exportchanges-dir", "", "write changed rows as ndjson into dir")
+	flags.BoolVar(&opts.ForceMappingChange, "force-mapping-change", false, "run with a mapping that changed since the import")
 	flags.BoolVar(&opts.ForceDiffImport, "force", false, "force import of diff if sequence was already imported")
+	flags.BoolVar(&opts.RepairState, "repair-state", false, "restore last.state.txt from the sequence in the database")
 
 	flags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s %s [args] [.osc.gz, ...]\n\n", os.Args[0], os.Args[1])
@@ -275,7 +418,13 @@ func ParseRunImport(args []string) Base {
 	addBaseFlags(&opts, flags)
 	flags.StringVar(&opts.ExpireTilesDir, "expiretiles-dir", "", "write expire tiles into dir")
 	flags.IntVar(&opts.ExpireTilesZoom, "expiretiles-zoom", 14, "write expire tiles in this zoom level")
+	flags.BoolVar(&opts.ExpireTilesChecksum, "expiretiles-checksum", false, "write the SHA256 checksum of each expire tiles file into a .sha256 file")
+	flags.StringVar(&opts.ExportChangesDir, "exportchanges-dir", "", "write changed rows as ndjson into dir")
+	flags.BoolVar(&opts.ForceMappingChange, "force-mapping-change", false, "run with a mapping that changed since the import")
 	flags.DurationVar(&opts.ReplicationInterval, "replication-interval", time.Minute, "replication interval as duration (1m, 1h, 24h)")
+	flags.Float64Var(&opts.VacuumThreshold, "vacuum-threshold", 0, "ratio of dead tuples (e.g. 0.2) that triggers a vacuum of a table, 0 to disable")
+	flags.BoolVar(&opts.Vacuum, "vacuum", false, "vacuum tables above -vacuum-threshold, otherwise only log a recommendation")
+	flags.BoolVar(&opts.RepairState, "repair-state", false, "restore last.state.txt from the sequence in the database")
 
 	flags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s %s [args] [.osc.gz, ...]\n\n", os.Args[0], os.Args[1])
@@ -306,6 +455,214 @@ func ParseRunImport(args []string) Base {
 	return opts
 }
 
+// Reimport contains the options of the reimport-table command.
+type Reimport struct {
+	Base Base
+	// Tables are the names of the tables that are imported again from the
+	// existing cache.
+	Tables           []string
+	Diff             bool
+	DeployProduction bool
+	// DeployLockTimeout and DeployRetries configure how -deployproduction
+	// handles locked tables.
+	DeployLockTimeout time.Duration
+	DeployRetries     int
+}
+
+func ParseReimport(args []string) Reimport {
+	flags := flag.NewFlagSet("reimport-table", flag.ExitOnError)
+	opts := Reimport{}
+
+	var tables string
+	addBaseFlags(&opts.Base, flags)
+	flags.StringVar(&tables, "table", "", "comma separated list of tables to import again")
+	flags.BoolVar(&opts.Diff, "diff", false, "update the diff cache of an import with -diff")
+	flags.BoolVar(&opts.Base.ForceMappingChange, "force-mapping-change", false, "run with a mapping that changed since the import")
+	flags.BoolVar(&opts.DeployProduction, "deployproduction", false, "deploy the tables to production")
+	flags.DurationVar(&opts.DeployLockTimeout, "deploy-lock-timeout", 0, "lock timeout for the deploy transaction (e.g. 10s), 0 for no timeout")
+	flags.IntVar(&opts.DeployRetries, "deploy-retries", 0, "number of retries of the deploy transaction after a lock timeout")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [args]\n\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = opts.Base.updateFromConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, t := range strings.Split(tables, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			opts.Tables = append(opts.Tables, t)
+		}
+	}
+	errs := opts.Base.check()
+	if len(opts.Tables) == 0 {
+		errs = append(errs, errors.New("missing table"))
+	}
+	if opts.Base.Connection == "" {
+		errs = append(errs, errors.New("missing connection"))
+	}
+	if len(errs) != 0 {
+		reportErrors(errs)
+		flags.Usage()
+	}
+
+	return opts
+}
+
+// SoakTest contains the options of the soak-test command.
+type SoakTest struct {
+	Base Base
+	// Diffs is the number of synthetic diffs, each with Changes
+	// modified or deleted elements.
+	Diffs    int
+	Changes  int
+	Interval time.Duration
+	Seed     int64
+	// Schema and CacheDir are the production schema and the cache of a
+	// separate test import. They replace the schema and the cache of the
+	// configuration, unless WritesProduction is set.
+	Schema           string
+	CacheDir         string
+	WritesProduction bool
+}
+
+func ParseSoakTest(args []string) SoakTest {
+	flags := flag.NewFlagSet("soak-test", flag.ExitOnError)
+	opts := SoakTest{}
+
+	addBaseFlags(&opts.Base, flags)
+	flags.IntVar(&opts.Diffs, "diffs", 10, "number of synthetic diffs")
+	flags.IntVar(&opts.Changes, "changes", 1000, "number of changes for each diff")
+	flags.DurationVar(&opts.Interval, "interval", 0, "pause between diffs (e.g. 1m)")
+	flags.Int64Var(&opts.Seed, "seed", 0, "seed for the random changes, 0 for a random seed")
+	flags.StringVar(&opts.Schema, "soak-schema", "", "production schema of a separate test import")
+	flags.StringVar(&opts.CacheDir, "soak-cachedir", "", "cache directory of a separate test import")
+	flags.BoolVar(&opts.WritesProduction, "i-know-this-writes-production", false, "import the changes into the configured production schema and cache")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [args]\n\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = opts.Base.updateFromConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	errs := opts.Base.check()
+	errs = append(errs, opts.useTestImport()...)
+	if len(errs) != 0 {
+		reportErrors(errs)
+		flags.Usage()
+	}
+
+	return opts
+}
+
+// useTestImport replaces the production schema and the cache with the
+// ones of the test import. The soak test modifies both.
+func (o *SoakTest) useTestImport() []error {
+	if o.WritesProduction {
+		if o.Schema != "" || o.CacheDir != "" {
+			return []error{errors.New("-i-know-this-writes-production can not be combined with -soak-schema and -soak-cachedir")}
+		}
+		return nil
+	}
+	if o.Schema == "" || o.CacheDir == "" {
+		return []error{errors.New("soak-test requires -soak-schema and -soak-cachedir of a separate test import (or -i-know-this-writes-production)")}
+	}
+	var errs []error
+	if o.Schema == o.Base.Schemas.Production {
+		errs = append(errs, errors.New("-soak-schema needs to differ from the production schema"))
+	}
+	if filepath.Clean(o.CacheDir) == filepath.Clean(o.Base.CacheDir) {
+		errs = append(errs, errors.New("-soak-cachedir needs to differ from the cache directory"))
+	}
+	o.Base.Schemas.Production = o.Schema
+	o.Base.CacheDir = o.CacheDir
+	o.Base.DiffDir = o.CacheDir
+	return errs
+}
+
+// Serve contains the options of the serve command.
+type Serve struct {
+	Base Base
+	// Addr is the listen address of the HTTP server.
+	Addr string
+	// Preview enables the web map of the production tables.
+	Preview bool
+	// MinZoom is the lowest zoom level with features, lower tiles are
+	// empty.
+	MinZoom int
+}
+
+func ParseServe(args []string) Serve {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	opts := Serve{}
+
+	addBaseFlags(&opts.Base, flags)
+	flags.StringVar(&opts.Addr, "addr", "localhost:8080", "listen address of the HTTP server")
+	flags.BoolVar(&opts.Preview, "preview", false, "serve a web map of the production tables")
+	flags.IntVar(&opts.MinZoom, "minzoom", 10, "lowest zoom level with features")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [args]\n\n", os.Args[0], os.Args[1])
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = opts.Base.updateFromConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	errs := opts.Base.check()
+	if opts.Base.Connection == "" {
+		errs = append(errs, errors.New("missing connection"))
+	}
+	if opts.MinZoom < 0 || opts.MinZoom > 22 {
+		errs = append(errs, errors.New("-minzoom needs to be between 0 and 22"))
+	}
+	if len(errs) != 0 {
+		reportErrors(errs)
+		flags.Usage()
+	}
+
+	return opts
+}
+
 func reportErrors(errs []error) {
 	fmt.Println("errors in config/options:")
 	for _, err := range errs {
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const profileConfig = `{
+	"cachedir": "/var/cache/imposm",
+	"connection": "postgis://localhost/osm",
+	"mapping": "mapping.yml",
+	"replication_interval": "1m",
+	"profiles": {
+		"import": {
+			"connection": "postgis://localhost/osm?copyconnections=4",
+			"cachedir": "/fast/imposm"
+		},
+		"hourly": {
+			"replication_interval": "1h"
+		}
+	}
+}`
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(fname, []byte(profileConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newBase := func(profile string) Base {
+		return Base{
+			ConfigFile:          fname,
+			Profile:             profile,
+			CacheDir:            defaultCacheDir,
+			Srid:                defaultSrid,
+			ReplicationInterval: time.Minute,
+		}
+	}
+
+	opts := newBase("")
+	if err := opts.updateFromConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Connection != "postgis://localhost/osm" || opts.CacheDir != "/var/cache/imposm" {
+		t.Errorf("unexpected options %#v", opts)
+	}
+
+	opts = newBase("import")
+	if err := opts.updateFromConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Connection != "postgis://localhost/osm?copyconnections=4" || opts.CacheDir != "/fast/imposm" {
+		t.Errorf("unexpected options %#v", opts)
+	}
+	if opts.MappingFile != "mapping.yml" {
+		t.Errorf("options not in profile should be kept: %#v", opts)
+	}
+
+	opts = newBase("hourly")
+	if err := opts.updateFromConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if opts.ReplicationInterval != time.Hour || opts.CacheDir != "/var/cache/imposm" {
+		t.Errorf("unexpected options %#v", opts)
+	}
+
+	opts = newBase("missing")
+	if err := opts.updateFromConfig(); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+func TestSoakTestUseTestImport(t *testing.T) {
+	base := Base{CacheDir: "/data/cache", Schemas: Schemas{Production: "public"}}
+
+	o := SoakTest{Base: base}
+	if errs := o.useTestImport(); len(errs) != 1 {
+		t.Errorf("expected error without test import, got %v", errs)
+	}
+
+	o = SoakTest{Base: base, Schema: "public", CacheDir: "/data/cache/"}
+	if errs := o.useTestImport(); len(errs) != 2 {
+		t.Errorf("expected errors for production schema and cache, got %v", errs)
+	}
+
+	o = SoakTest{Base: base, Schema: "soak", CacheDir: "/tmp/soak"}
+	if errs := o.useTestImport(); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if o.Base.Schemas.Production != "soak" || o.Base.CacheDir != "/tmp/soak" || o.Base.DiffDir != "/tmp/soak" {
+		t.Errorf("test import not used %v", o.Base)
+	}
+
+	o = SoakTest{Base: base, WritesProduction: true}
+	if errs := o.useTestImport(); len(errs) != 0 || o.Base.CacheDir != "/data/cache" {
+		t.Errorf("unexpected result %v %v", errs, o.Base)
+	}
+}
@@ -3,11 +3,13 @@ package database
 import (
 	"errors"
 	"strings"
+	"time"
 
 	osm "github.com/omniscale/go-osm"
 	"github.com/omniscale/imposm3/geom"
 	"github.com/omniscale/imposm3/mapping"
 	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/omniscale/imposm3/stats"
 )
 
 type Config struct {
@@ -16,8 +18,32 @@ type Config struct {
 	ImportSchema     string
 	ProductionSchema string
 	BackupSchema     string
+	// DeployLockTimeout sets the lock_timeout for the DDL statements of
+	// a deploy. Zero waits without timeout.
+	DeployLockTimeout time.Duration
+	// DeployRetries is the number of retries of a deploy (group) after
+	// a lock timeout.
+	DeployRetries int
+	// PartialImport is set if only some tables of the mapping are imported
+	// (reimport-table). The stats and errors tables are not recreated, the
+	// stats of the imported tables are updated after the deploy.
+	PartialImport bool
+	// Ordered is set for imports with reproducible row order. Rows need
+	// to be written in the order of the inserts.
+	Ordered bool
+	// WriteConcurrency is the number of concurrent COPY connections of a
+	// bulk import. Zero uses the default of the database.
+	WriteConcurrency int
+	// MappingChecksum is the checksum of the mapping of the import. It is
+	// recorded with the imported tables.
+	MappingChecksum string
 }
 
+// FormatVersion is the version of the layout of the imported tables. It is
+// increased with every change that makes diff imports into existing tables
+// of older versions fail or corrupt them.
+const FormatVersion = 1
+
 type DB interface {
 	Begin() error
 	End() error
@@ -31,6 +57,13 @@ type BulkBeginner interface {
 	BeginBulk() error
 }
 
+// BulkTruncater is implemented by databases that can start a bulk import
+// that only truncates the given tables, e.g. to continue an interrupted
+// import. Rows of all other tables are appended.
+type BulkTruncater interface {
+	BeginBulkTruncate(tables []string) error
+}
+
 type Inserter interface {
 	// InsertXxx inserts element of that type into the database.
 	// element.Geom is set to that type.
@@ -40,6 +73,13 @@ type Inserter interface {
 	InsertRelationMember(osm.Relation, osm.Member, geom.Geometry, []mapping.Match) error
 }
 
+// FileOutput is implemented by databases that write into local files.
+type FileOutput interface {
+	// OutputPath returns the file or directory of the output, e.g. to
+	// check the free disk space before an import.
+	OutputPath() string
+}
+
 type Deployer interface {
 	Deploy() error
 	RevertDeploy() error
@@ -61,10 +101,88 @@ type Deleter interface {
 	Delete(int64, []mapping.Match) error
 }
 
+// SequenceRecorder is implemented by databases that record the sequence
+// of the imported diff.
+type SequenceRecorder interface {
+	SetSequence(seq int)
+}
+
+// SequenceReader is implemented by databases that return the last
+// recorded sequence and the time of the last modification, e.g. to restore
+// a lost state file.
+type SequenceReader interface {
+	LastSequence() (int, time.Time, error)
+}
+
+// VersionChecker is implemented by databases that record the Imposm version
+// and the FormatVersion of the imported tables. CheckVersion returns an
+// error if the production tables have a different format.
+type VersionChecker interface {
+	CheckVersion() error
+}
+
+// MappingChecksumChecker is implemented by databases that record the
+// checksum of the mapping of the imported tables. CheckMappingChecksum
+// returns an error if the production tables were imported with another
+// mapping. If force is true, checksum replaces the recorded checksum.
+type MappingChecksumChecker interface {
+	CheckMappingChecksum(checksum string, force bool) error
+}
+
+// RowCounter is implemented by databases that count the inserted and
+// deleted rows of the current diff import, e.g. to throttle the imports.
+type RowCounter interface {
+	WrittenRows() int64
+}
+
 type Optimizer interface {
 	Optimize() error
 }
 
+// TableStats contains the number of live and dead tuples of a table.
+type TableStats struct {
+	Table      string
+	LiveTuples int64
+	DeadTuples int64
+}
+
+// Vacuumer is implemented by databases that report the bloat of all tables
+// and that can vacuum single tables.
+type Vacuumer interface {
+	TableStats() ([]TableStats, error)
+	Vacuum(table string) error
+}
+
+// MultipolygonErrorWriter is implemented by databases that can store the
+// multipolygon errors of an import in a table.
+type MultipolygonErrorWriter interface {
+	WriteMultipolygonErrors([]stats.MultipolygonError) error
+}
+
+// RejectWriter is implemented by databases that store the elements that
+// matched the mapping but were not imported (e.g. invalid geometries) with
+// the reason and the tags. elemType is node, way or relation and id is the
+// OSM ID. DeleteRejects removes the rejects of an element before a diff
+// import writes it again.
+type RejectWriter interface {
+	InsertReject(elemType string, id int64, reason, message string, tags osm.Tags) error
+	DeleteRejects(elemType string, id int64) error
+}
+
+// TileLayer is a layer of the vector tiles of a TileRenderer.
+type TileLayer struct {
+	Name         string
+	GeometryType string
+}
+
+// TileRenderer is implemented by databases that render Mapbox vector tiles
+// of the imported tables on the fly. Tile returns the tile with a layer for
+// each table.
+type TileRenderer interface {
+	TileLayers() []TileLayer
+	Tile(z, x, y int) ([]byte, error)
+}
+
 var databases map[string]func(Config, *config.Mapping) (DB, error)
 
 func init() {
@@ -0,0 +1,8 @@
+/*
+Package file implements the database interfaces for file outputs.
+
+Each table is streamed into a separate file, either as newline delimited
+GeoJSON (GeoJSONSeq), as FlatGeobuf or as GeoParquet. The files are only
+written sequentially, updates and generalized tables are not supported.
+*/
+package file
@@ -0,0 +1,6 @@
+/*
+Package fgb contains the FlatBuffers tables of the FlatGeobuf header and
+features, generated from the header.fbs and feature.fbs schemas of
+FlatGeobuf 3.
+*/
+package fgb
@@ -0,0 +1,462 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/geom/wkb"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	formatGeoJSONSeq = "geojsonseq"
+	formatFlatGeobuf = "flatgeobuf"
+	formatGeoParquet = "geoparquet"
+)
+
+var extensions = map[string]string{
+	formatGeoJSONSeq: ".geojsonl",
+	formatFlatGeobuf: ".fgb",
+	formatGeoParquet: ".parquet",
+}
+
+type column struct {
+	name   string
+	goType string
+}
+
+func (c column) isGeometry() bool {
+	return strings.HasSuffix(c.goType, "geometry")
+}
+
+// tableSchema describes the output of a table. The values of all columns
+// except the geometry columns are written as properties. The geometry of
+// the feature is the column geomIdx, other geometry columns are dropped.
+type tableSchema struct {
+	name         string
+	geometryType string
+	srid         int
+	columns      []column
+	properties   []int
+	geomIdx      int
+}
+
+func newTableSchema(name string, t *config.Table, srid int) (*tableSchema, error) {
+	s := &tableSchema{
+		name:         name,
+		geometryType: string(t.Type),
+		srid:         srid,
+		geomIdx:      -1,
+	}
+	for i, c := range t.Columns {
+		colType, err := mapping.MakeColumnType(c)
+		if err != nil {
+			return nil, err
+		}
+		col := column{name: c.Name, goType: colType.GoType}
+		s.columns = append(s.columns, col)
+		if !col.isGeometry() {
+			s.properties = append(s.properties, i)
+		} else if s.geomIdx == -1 && (col.goType == "geometry" || col.goType == "validated_geometry") {
+			s.geomIdx = i
+		}
+	}
+	if s.geomIdx == -1 {
+		// tables with only extra geometries (e.g. geometry_centroid)
+		for i, col := range s.columns {
+			if col.isGeometry() {
+				s.geomIdx = i
+				break
+			}
+		}
+	}
+	return s, nil
+}
+
+// geometry returns the decoded feature geometry of row, or nil if the table
+// or the row has no geometry.
+func (s *tableSchema) geometry(row []interface{}) (*wkb.Geometry, error) {
+	if s.geomIdx == -1 {
+		return nil, nil
+	}
+	hexWKB, ok := row[s.geomIdx].(string)
+	if !ok || hexWKB == "" {
+		return nil, nil
+	}
+	g, err := wkb.ParseHex(hexWKB)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// propertyValue converts a value of a row to string, bool, int64 or float64.
+// Columns return their own named types (e.g. osm.MemberType).
+func propertyValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return fmt.Sprint(v)
+}
+
+type tableWriter interface {
+	writeRow(row []interface{}) error
+	flush() error
+	close() error
+}
+
+// File writes all tables into separate files of a directory. Each file
+// is written sequentially, updates and generalized tables are not
+// supported.
+type File struct {
+	Dir    string
+	Prefix string
+	Format string
+	Config database.Config
+	// RowGroupSize is the number of rows of each GeoParquet row group.
+	RowGroupSize int
+
+	tables map[string]*tableSchema
+
+	mu      sync.Mutex
+	writers map[string]tableWriter
+}
+
+func (f *File) filename(table string) string {
+	return filepath.Join(f.Dir, f.Prefix+table+extensions[f.Format])
+}
+
+// OutputPath returns the output directory.
+func (f *File) OutputPath() string {
+	return f.Dir
+}
+
+func (f *File) Init() error {
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return errors.Wrap(err, "creating output directory")
+	}
+	if err := f.closeWriters(); err != nil {
+		return err
+	}
+	return f.openWriters(f.tableNames(), true)
+}
+
+func (f *File) tableNames() []string {
+	names := make([]string, 0, len(f.tables))
+	for name := range f.tables {
+		names = append(names, name)
+	}
+	return names
+}
+
+// openWriters opens the files of the named tables that are not open.
+// Existing files are truncated, or appended if truncate is false (resumed
+// imports).
+func (f *File) openWriters(names []string, truncate bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	writers := make(map[string]tableWriter)
+	for _, name := range names {
+		schema, ok := f.tables[name]
+		if !ok {
+			continue
+		}
+		if _, ok := f.writers[name]; ok {
+			continue
+		}
+		filename := f.filename(name)
+		flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		writeHeader := truncate
+		if truncate {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		} else if _, err := os.Stat(filename); os.IsNotExist(err) {
+			writeHeader = true
+		}
+		fd, err := os.OpenFile(filename, flags, 0644)
+		if err != nil {
+			for _, w := range writers {
+				w.close()
+			}
+			return errors.Wrapf(err, "opening output for %q", name)
+		}
+		var w tableWriter
+		if f.Format == formatFlatGeobuf {
+			w, err = newFlatGeobufWriter(fd, schema, writeHeader)
+		} else if f.Format == formatGeoParquet {
+			w, err = newGeoParquetWriter(fd, schema, writeHeader, f.RowGroupSize)
+		} else {
+			w = newGeoJSONSeqWriter(fd, schema)
+		}
+		if err != nil {
+			fd.Close()
+			for _, w := range writers {
+				w.close()
+			}
+			return errors.Wrapf(err, "writing header for %q", name)
+		}
+		writers[name] = w
+	}
+	if f.writers == nil {
+		f.writers = writers
+	} else {
+		for name, w := range writers {
+			f.writers[name] = w
+		}
+	}
+	return nil
+}
+
+func (f *File) closeWriters() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var firstErr error
+	for name, w := range f.writers {
+		if err := w.close(); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "closing output for %q", name)
+		}
+	}
+	f.writers = nil
+	return firstErr
+}
+
+func (f *File) Begin() error {
+	return f.openWriters(f.tableNames(), false)
+}
+
+// BeginBulkTruncate truncates the files of the given tables, e.g. to write
+// the tables of an interrupted import again. Other files are not opened,
+// so that GeoParquet files are never appended.
+func (f *File) BeginBulkTruncate(tables []string) error {
+	f.mu.Lock()
+	for _, name := range tables {
+		if w, ok := f.writers[name]; ok {
+			delete(f.writers, name)
+			if err := w.close(); err != nil {
+				f.mu.Unlock()
+				return errors.Wrapf(err, "closing output for %q", name)
+			}
+		}
+	}
+	f.mu.Unlock()
+	return f.openWriters(tables, true)
+}
+
+func (f *File) End() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, w := range f.writers {
+		if err := w.flush(); err != nil {
+			return errors.Wrapf(err, "writing output for %q", name)
+		}
+	}
+	return nil
+}
+
+// Abort flushes all written rows. Files can not be rolled back, they are
+// truncated with the next Init.
+func (f *File) Abort() error {
+	log.Printf("[warn] Aborted import, output files in %s are incomplete", f.Dir)
+	return f.End()
+}
+
+func (f *File) Close() error {
+	return f.closeWriters()
+}
+
+func (f *File) insert(table string, row []interface{}) error {
+	f.mu.Lock()
+	w, ok := f.writers[table]
+	f.mu.Unlock()
+	if !ok {
+		return errors.Errorf("output for %q not open", table)
+	}
+	if err := w.writeRow(row); err != nil {
+		return errors.Wrapf(err, "writing row to %q", table)
+	}
+	return nil
+}
+
+func (f *File) InsertPoint(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	return f.insertElement(elem, geom, matches)
+}
+
+func (f *File) InsertLineString(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	return f.insertElement(elem, geom, matches)
+}
+
+func (f *File) InsertPolygon(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	return f.insertElement(elem, geom, matches)
+}
+
+func (f *File) insertElement(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	for _, match := range matches {
+		row := match.Row(&elem, &geom)
+		if err := f.insert(match.Table.Name, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *File) InsertRelationMember(rel osm.Relation, m osm.Member, geom geom.Geometry, matches []mapping.Match) error {
+	for _, match := range matches {
+		row := match.MemberRow(&rel, &m, &geom)
+		if err := f.insert(match.Table.Name, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Generalize does nothing, generalized tables are not supported.
+func (f *File) Generalize() error {
+	return nil
+}
+
+func (f *File) EnableGeneralizeUpdates() {}
+
+func (f *File) GeneralizeUpdates() error {
+	return nil
+}
+
+// Finish closes all files.
+func (f *File) Finish() error {
+	if err := f.closeWriters(); err != nil {
+		return err
+	}
+	log.Printf("[info] Wrote %d tables to %s", len(f.tables), f.Dir)
+	return nil
+}
+
+// parseConnectionParams returns the output directory, the format, the
+// file prefix and the row group size of connection strings like
+// file:///path/to/dir/?format=flatgeobuf&prefix=osm_. The format defaults to
+// geojsonseq, the prefix defaults to osm_ and prefix=NONE disables the
+// prefix. rowgroupsize is only used by geoparquet.
+func parseConnectionParams(params string) (dir, format, prefix string, rowGroupSize int, err error) {
+	params = strings.TrimPrefix(strings.TrimSpace(params), "file:")
+	params = strings.TrimPrefix(params, "//")
+
+	dir = params
+	format = formatGeoJSONSeq
+	rowGroupSize = defaultRowGroupSize
+	if idx := strings.Index(params, "?"); idx >= 0 {
+		dir = params[:idx]
+		query, err := url.ParseQuery(params[idx+1:])
+		if err != nil {
+			return "", "", "", 0, errors.Wrap(err, "parsing connection parameters")
+		}
+		for key := range query {
+			if key != "format" && key != "prefix" && key != "rowgroupsize" {
+				return "", "", "", 0, errors.Errorf("unknown connection parameter %q", key)
+			}
+		}
+		if query.Get("format") != "" {
+			format = query.Get("format")
+		}
+		prefix = query.Get("prefix")
+		if v := query.Get("rowgroupsize"); v != "" {
+			rowGroupSize, err = strconv.Atoi(v)
+			if err != nil || rowGroupSize <= 0 {
+				return "", "", "", 0, errors.Errorf("invalid rowgroupsize %q", v)
+			}
+		}
+	}
+	if dir == "" {
+		return "", "", "", 0, errors.New("missing output directory in connection")
+	}
+	if _, ok := extensions[format]; !ok {
+		return "", "", "", 0, errors.Errorf("unknown file format %q, use %s, %s or %s",
+			format, formatGeoJSONSeq, formatFlatGeobuf, formatGeoParquet)
+	}
+
+	if prefix == "NONE" {
+		return dir, format, "", rowGroupSize, nil
+	}
+	if prefix == "" {
+		// default
+		prefix = "osm_"
+	}
+	if prefix[len(prefix)-1] != '_' {
+		// always separated by _
+		prefix = prefix + "_"
+	}
+	return dir, format, prefix, rowGroupSize, nil
+}
+
+func New(conf database.Config, m *config.Mapping) (database.DB, error) {
+	f := &File{Config: conf, tables: make(map[string]*tableSchema)}
+
+	var err error
+	f.Dir, f.Format, f.Prefix, f.RowGroupSize, err = parseConnectionParams(conf.ConnectionParams)
+	if err != nil {
+		return nil, err
+	}
+	if f.Format == formatGeoJSONSeq && conf.Srid != 4326 && conf.Srid != 3857 {
+		return nil, errors.Errorf("geojsonseq output requires -srid 4326 or 3857, not %d", conf.Srid)
+	}
+
+	for name, table := range m.Tables {
+		schema, err := newTableSchema(name, table, conf.Srid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating output schema for %q", name)
+		}
+		f.tables[name] = schema
+	}
+	if len(m.GeneralizedTables) > 0 {
+		log.Printf("[warn] Generalized tables are not supported by the file output and are skipped")
+	}
+	return f, nil
+}
+
+func init() {
+	database.Register("file", New)
+}
+
+// bufferedFile is the buffered file of a table writer.
+type bufferedFile struct {
+	fd *os.File
+	w  *bufio.Writer
+}
+
+func newBufferedFile(fd *os.File) bufferedFile {
+	return bufferedFile{fd: fd, w: bufio.NewWriterSize(fd, 256*1024)}
+}
+
+func (b bufferedFile) flush() error {
+	return b.w.Flush()
+}
+
+func (b bufferedFile) close() error {
+	if err := b.w.Flush(); err != nil {
+		b.fd.Close()
+		return err
+	}
+	return b.fd.Close()
+}
@@ -0,0 +1,442 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/omniscale/imposm3/database/file/fgb"
+	"github.com/omniscale/imposm3/geom/wkb"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func TestParseConnectionParams(t *testing.T) {
+	for _, tt := range []struct {
+		params       string
+		dir          string
+		format       string
+		prefix       string
+		rowGroupSize int
+		err          bool
+	}{
+		{"file:///tmp/out/", "/tmp/out/", "geojsonseq", "osm_", defaultRowGroupSize, false},
+		{"file:///tmp/out?format=flatgeobuf&prefix=NONE", "/tmp/out", "flatgeobuf", "", defaultRowGroupSize, false},
+		{"file://out?prefix=foo", "out", "geojsonseq", "foo_", defaultRowGroupSize, false},
+		{"file://out?format=geoparquet&rowgroupsize=1000", "out", "geoparquet", "osm_", 1000, false},
+		{"file://out?format=geoparquet&rowgroupsize=0", "", "", "", 0, true},
+		{"file:///tmp/out?format=shp", "", "", "", 0, true},
+		{"file:///tmp/out?foo=bar", "", "", "", 0, true},
+		{"file://", "", "", "", 0, true},
+	} {
+		t.Run(tt.params, func(t *testing.T) {
+			dir, format, prefix, rowGroupSize, err := parseConnectionParams(tt.params)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dir != tt.dir || format != tt.format || prefix != tt.prefix || rowGroupSize != tt.rowGroupSize {
+				t.Errorf("unexpected result %q %q %q %d", dir, format, prefix, rowGroupSize)
+			}
+		})
+	}
+}
+
+// polygonWKB returns hex EWKB of a polygon with srid 3857.
+func polygonWKB(rings ...[]float64) string {
+	buf := &bytes.Buffer{}
+	buf.WriteByte(1)
+	binary.Write(buf, binary.LittleEndian, uint32(wkb.Polygon|0x20000000))
+	binary.Write(buf, binary.LittleEndian, uint32(3857))
+	binary.Write(buf, binary.LittleEndian, uint32(len(rings)))
+	for _, ring := range rings {
+		binary.Write(buf, binary.LittleEndian, uint32(len(ring)/2))
+		binary.Write(buf, binary.LittleEndian, ring)
+	}
+	return hex.EncodeToString(buf.Bytes())
+}
+
+var testSchema = &tableSchema{
+	name:         "buildings",
+	geometryType: "polygon",
+	srid:         3857,
+	columns: []column{
+		{"osm_id", "int64"},
+		{"geometry", "geometry"},
+		{"name", "string"},
+		{"area", "float32"},
+	},
+	properties: []int{0, 2, 3},
+	geomIdx:    1,
+}
+
+func TestGeoJSONSeq(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_file_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fd, err := os.Create(filepath.Join(dir, "out.geojsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newGeoJSONSeqWriter(fd, testSchema)
+	row := []interface{}{int64(-42), polygonWKB([]float64{0, 0, 1000, 0, 1000, 1000, 0, 0}), "Foo", nil}
+	if err := w.writeRow(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.writeRow([]interface{}{int64(1), nil, nil, float32(1.5)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "out.geojsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two lines, got %q", b)
+	}
+	expected := `{"type":"Feature","properties":{"name":"Foo","osm_id":-42},"geometry":{"type":"Polygon","coordinates":[[[0.0000000,0.0000000],[0.0089832,0.0000000],[0.0089832,0.0089832],[0.0000000,0.0000000]]]}}`
+	if lines[0] != expected {
+		t.Errorf("unexpected feature\n%s\n%s", lines[0], expected)
+	}
+	expected = `{"type":"Feature","properties":{"area":1.5,"osm_id":1},"geometry":null}`
+	if lines[1] != expected {
+		t.Errorf("unexpected feature\n%s\n%s", lines[1], expected)
+	}
+}
+
+// flatGeobufIndexSearch returns the offsets of all features that intersect
+// the bbox, by searching the packed R-tree like FlatGeobuf readers do.
+func flatGeobufIndexSearch(index []byte, numItems, nodeSize int, minX, minY, maxX, maxY float64) []uint64 {
+	// [start, end) of each level, from the leaves up to the root
+	levelNumNodes := []int{numItems}
+	numNodes := numItems
+	for n := numItems; n != 1 || len(levelNumNodes) == 1; {
+		n = (n + nodeSize - 1) / nodeSize
+		numNodes += n
+		levelNumNodes = append(levelNumNodes, n)
+	}
+	levelBounds := make([][2]int, len(levelNumNodes))
+	n := numNodes
+	for i, size := range levelNumNodes {
+		levelBounds[i] = [2]int{n - size, n}
+		n -= size
+	}
+	node := func(i int) (float64, float64, float64, float64, uint64) {
+		b := index[i*40:]
+		return math.Float64frombits(binary.LittleEndian.Uint64(b[0:])),
+			math.Float64frombits(binary.LittleEndian.Uint64(b[8:])),
+			math.Float64frombits(binary.LittleEndian.Uint64(b[16:])),
+			math.Float64frombits(binary.LittleEndian.Uint64(b[24:])),
+			binary.LittleEndian.Uint64(b[32:])
+	}
+
+	var result []uint64
+	queue := [][2]int{{0, len(levelBounds) - 1}}
+	for len(queue) > 0 {
+		nodeIndex, level := queue[0][0], queue[0][1]
+		queue = queue[1:]
+		end := nodeIndex + nodeSize
+		if levelEnd := levelBounds[level][1]; end > levelEnd {
+			end = levelEnd
+		}
+		for pos := nodeIndex; pos < end; pos++ {
+			nMinX, nMinY, nMaxX, nMaxY, offset := node(pos)
+			if maxX < nMinX || maxY < nMinY || minX > nMaxX || minY > nMaxY {
+				continue
+			}
+			if nodeIndex >= numNodes-numItems {
+				result = append(result, offset)
+			} else {
+				queue = append(queue, [2]int{int(offset), level - 1})
+			}
+		}
+	}
+	return result
+}
+
+func TestFlatGeobuf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_file_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fd, err := os.Create(filepath.Join(dir, "out.fgb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := newFlatGeobufWriter(fd, testSchema, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 40 features require two levels of index nodes
+	for i := 0; i < 40; i++ {
+		x := float64(i * 10)
+		row := []interface{}{int64(i), polygonWKB(
+			[]float64{x, 0, x + 5, 0, x + 5, 5, x, 0},
+			[]float64{x + 1, 1, x + 2, 1, x + 2, 2, x + 1, 1},
+		), "Foo", float32(1.5)}
+		if err := w.writeRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Errorf("temporary file not removed %v %v", files, err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "out.fgb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b[:8], flatGeobufMagic) {
+		t.Fatalf("missing magic bytes %v", b[:8])
+	}
+
+	headerSize := int(binary.LittleEndian.Uint32(b[8:]))
+	header := fgb.GetRootAsHeader(b[12:12+headerSize], 0)
+	if name := string(header.Name()); name != "buildings" {
+		t.Errorf("unexpected name %q", name)
+	}
+	if n := header.FeaturesCount(); n != 40 {
+		t.Errorf("unexpected features_count %d", n)
+	}
+	if n := header.IndexNodeSize(); n != 16 {
+		t.Errorf("unexpected index_node_size %d", n)
+	}
+	envelope := []float64{}
+	for i := 0; i < header.EnvelopeLength(); i++ {
+		envelope = append(envelope, header.Envelope(i))
+	}
+	if !reflect.DeepEqual(envelope, []float64{0, 0, 395, 5}) {
+		t.Errorf("unexpected envelope %v", envelope)
+	}
+	if n := header.ColumnsLength(); n != 3 {
+		t.Fatalf("unexpected number of columns %d", n)
+	}
+	col := &fgb.Column{}
+	header.Columns(col, 1)
+	if name := string(col.Name()); name != "name" {
+		t.Errorf("unexpected column name %q", name)
+	}
+	if typ := col.Type(); typ != fgb.ColumnTypeString {
+		t.Errorf("unexpected column type %d", typ)
+	}
+	if code := header.Crs(nil).Code(); code != 3857 {
+		t.Errorf("unexpected crs %d", code)
+	}
+
+	// 40 leaves, 3 nodes and the root
+	indexStart := 12 + headerSize
+	featuresStart := indexStart + (40+3+1)*40
+	all := flatGeobufIndexSearch(b[indexStart:featuresStart], 40, 16, -1, -1, 1000, 1000)
+	if len(all) != 40 {
+		t.Errorf("expected all features in index, got %d", len(all))
+	}
+	offsets := flatGeobufIndexSearch(b[indexStart:featuresStart], 40, 16, 172, 1, 173, 2)
+	if len(offsets) != 1 {
+		t.Fatalf("expected one feature, got %v", offsets)
+	}
+
+	offset := featuresStart + int(offsets[0])
+	featureSize := int(binary.LittleEndian.Uint32(b[offset:]))
+	feature := fgb.GetRootAsFeature(b[offset+4:offset+4+featureSize], 0)
+	geom := feature.Geometry(nil)
+	if typ := geom.Type(); typ != fgb.GeometryTypePolygon {
+		t.Errorf("unexpected geometry type %d", typ)
+	}
+	if n := geom.XyLength(); n != 16 {
+		t.Fatalf("unexpected number of coordinates %d", n)
+	}
+	if x := geom.Xy(2); x != 175 {
+		t.Errorf("unexpected coordinate %v", x)
+	}
+	if geom.EndsLength() != 2 || geom.Ends(0) != 4 || geom.Ends(1) != 8 {
+		t.Errorf("unexpected ends")
+	}
+
+	expected := []byte{
+		0, 0, 17, 0, 0, 0, 0, 0, 0, 0, // osm_id 17
+		1, 0, 3, 0, 0, 0, 'F', 'o', 'o', // name
+		2, 0, 0, 0, 0xc0, 0x3f, // area 1.5
+	}
+	if props := feature.PropertiesBytes(); !bytes.Equal(props, expected) {
+		t.Errorf("unexpected properties %v", props)
+	}
+}
+
+func TestFlatGeobufWithoutGeometry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_file_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fd, err := os.Create(filepath.Join(dir, "out.fgb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := newFlatGeobufWriter(fd, testSchema, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.writeRow([]interface{}{int64(1), polygonWKB([]float64{0, 0, 1, 0, 1, 1, 0, 0}), nil, nil}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.writeRow([]interface{}{int64(2), nil, nil, nil}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "out.fgb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerSize := int(binary.LittleEndian.Uint32(b[8:]))
+	header := fgb.GetRootAsHeader(b[12:12+headerSize], 0)
+	if n := header.FeaturesCount(); n != 2 {
+		t.Errorf("unexpected features_count %d", n)
+	}
+	if n := header.IndexNodeSize(); n != 0 {
+		t.Errorf("features without geometry need to disable the index, got index_node_size %d", n)
+	}
+
+	// features are written in the original order without index
+	offset := 12 + headerSize
+	for _, id := range []byte{1, 2} {
+		featureSize := int(binary.LittleEndian.Uint32(b[offset:]))
+		feature := fgb.GetRootAsFeature(b[offset+4:offset+4+featureSize], 0)
+		if props := feature.PropertiesBytes(); len(props) < 3 || props[2] != id {
+			t.Errorf("unexpected properties %v", props)
+		}
+		if g := feature.Geometry(nil); (g != nil) != (id == 1) {
+			t.Errorf("unexpected geometry for feature %d", id)
+		}
+		offset += 4 + featureSize
+	}
+	if offset != len(b) {
+		t.Errorf("unexpected file size %d, expected %d", len(b), offset)
+	}
+}
+
+func TestGeoParquet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_file_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fd, err := os.Create(filepath.Join(dir, "out.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := newGeoParquetWriter(fd, testSchema, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]interface{}{
+		{int64(-42), polygonWKB([]float64{0, 0, 10, 0, 10, 10, 0, 0}), "Foo", float32(1.5)},
+		{int64(1), nil, nil, nil},
+		{int64(2), nil, "Bar", nil},
+	} {
+		if err := w.writeRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+	// read with an independent reader
+	pf, err := local.NewLocalFileReader(filepath.Join(dir, "out.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Close()
+	pr, err := reader.NewParquetColumnReader(pf, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := pr.GetNumRows(); n != 3 {
+		t.Errorf("unexpected number of rows %d", n)
+	}
+	if n := len(pr.Footer.RowGroups); n != 2 {
+		t.Errorf("unexpected number of row groups %d", n)
+	}
+
+	column := func(name string) []interface{} {
+		values, _, _, err := pr.ReadColumnByPath(pr.SchemaHandler.GetRootExName()+"."+name, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return values
+	}
+	if ids := column("osm_id"); !reflect.DeepEqual(ids, []interface{}{int64(-42), int64(1), int64(2)}) {
+		t.Errorf("unexpected ids %v", ids)
+	}
+	if names := column("name"); !reflect.DeepEqual(names, []interface{}{"Foo", nil, "Bar"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+	if areas := column("area"); !reflect.DeepEqual(areas, []interface{}{float32(1.5), nil, nil}) {
+		t.Errorf("unexpected areas %v", areas)
+	}
+	geoms := column("geometry")
+	if len(geoms) != 3 || geoms[1] != nil || geoms[2] != nil {
+		t.Fatalf("unexpected geometries %v", geoms)
+	}
+	// WKB without SRID
+	g, err := wkb.Parse(strings.NewReader(geoms[0].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rings := g.Rings(); len(rings) != 1 || !reflect.DeepEqual(rings[0], []float64{0, 0, 10, 0, 10, 10, 0, 0}) {
+		t.Errorf("unexpected geometry %v", g)
+	}
+	if geoms[0].(string)[1:5] != "\x03\x00\x00\x00" {
+		t.Errorf("unexpected WKB type in %x", geoms[0])
+	}
+
+	var geoJSON string
+	for _, kv := range pr.Footer.KeyValueMetadata {
+		if kv.Key == "geo" {
+			geoJSON = kv.GetValue()
+		}
+	}
+	geo := struct {
+		PrimaryColumn string `json:"primary_column"`
+		Columns       map[string]struct {
+			Encoding string
+			CRS      struct {
+				ID struct{ Code int }
+			}
+		}
+	}{}
+	if err := json.Unmarshal([]byte(geoJSON), &geo); err != nil {
+		t.Fatal(err)
+	}
+	if geo.PrimaryColumn != "geometry" || geo.Columns["geometry"].Encoding != "WKB" ||
+		geo.Columns["geometry"].CRS.ID.Code != 3857 {
+		t.Errorf("unexpected geo metadata %s", geoJSON)
+	}
+}
@@ -0,0 +1,530 @@
+package file
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/omniscale/imposm3/database/file/fgb"
+	"github.com/omniscale/imposm3/geom/wkb"
+	"github.com/pkg/errors"
+)
+
+var flatGeobufMagic = []byte{0x66, 0x67, 0x62, 0x03, 0x66, 0x67, 0x62, 0x00}
+
+const flatGeobufIndexNodeSize = 16
+
+var flatGeobufTypes = map[string]fgb.ColumnType{
+	"bool":          fgb.ColumnTypeBool,
+	"int8":          fgb.ColumnTypeByte,
+	"int32":         fgb.ColumnTypeInt,
+	"int64":         fgb.ColumnTypeLong,
+	"float32":       fgb.ColumnTypeFloat,
+	"string":        fgb.ColumnTypeString,
+	"hstore_string": fgb.ColumnTypeString,
+	"string_array":  fgb.ColumnTypeString,
+	"timestamp":     fgb.ColumnTypeDateTime,
+	"date":          fgb.ColumnTypeDateTime,
+}
+
+// flatGeobufWriter writes a FlatGeobuf file with a packed Hilbert R-tree
+// index. The header and the index require all features, so the features
+// are collected in a temporary file and the output is written on close.
+type flatGeobufWriter struct {
+	mu       sync.Mutex
+	fd       *os.File
+	tmp      bufferedFile
+	tmpSize  int64
+	schema   *tableSchema
+	types    []fgb.ColumnType
+	features []flatGeobufFeature
+	// noIndex is set if a feature has no or an empty geometry and can't
+	// be indexed
+	noIndex bool
+}
+
+// flatGeobufFeature is a feature in the temporary file. size includes the
+// size prefix.
+type flatGeobufFeature struct {
+	node    flatGeobufNode
+	pos     int64
+	size    int64
+	hilbert uint32
+}
+
+func newFlatGeobufWriter(fd *os.File, schema *tableSchema, writeHeader bool) (*flatGeobufWriter, error) {
+	if !writeHeader {
+		return nil, errors.New("appending to FlatGeobuf files is not supported, start a new -write without -resume")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fd.Name()), "."+filepath.Base(fd.Name())+".")
+	if err != nil {
+		return nil, err
+	}
+	w := &flatGeobufWriter{fd: fd, tmp: newBufferedFile(tmp), schema: schema}
+	for _, i := range schema.properties {
+		typ, ok := flatGeobufTypes[schema.columns[i].goType]
+		if !ok {
+			typ = fgb.ColumnTypeString
+		}
+		w.types = append(w.types, typ)
+	}
+	return w, nil
+}
+
+func (w *flatGeobufWriter) header(b *flatbuffers.Builder, extent flatGeobufNode, indexNodeSize uint16) []byte {
+	geometryType := fgb.GeometryTypeUnknown // set for each feature
+	if w.schema.geometryType == "point" {
+		geometryType = fgb.GeometryTypePoint
+	}
+	name := b.CreateString(w.schema.name)
+
+	columns := make([]flatbuffers.UOffsetT, len(w.schema.properties))
+	for n, i := range w.schema.properties {
+		colName := b.CreateString(w.schema.columns[i].name)
+		fgb.ColumnStart(b)
+		fgb.ColumnAddName(b, colName)
+		fgb.ColumnAddType(b, w.types[n])
+		columns[n] = fgb.ColumnEnd(b)
+	}
+	var columnsVec flatbuffers.UOffsetT
+	if len(columns) > 0 {
+		fgb.HeaderStartColumnsVector(b, len(columns))
+		for i := len(columns) - 1; i >= 0; i-- {
+			b.PrependUOffsetT(columns[i])
+		}
+		columnsVec = b.EndVector(len(columns))
+	}
+
+	var envelope flatbuffers.UOffsetT
+	if len(w.features) > 0 {
+		fgb.HeaderStartEnvelopeVector(b, 4)
+		b.PrependFloat64(extent.maxY)
+		b.PrependFloat64(extent.maxX)
+		b.PrependFloat64(extent.minY)
+		b.PrependFloat64(extent.minX)
+		envelope = b.EndVector(4)
+	}
+
+	var crs flatbuffers.UOffsetT
+	if w.schema.srid != 0 {
+		org := b.CreateString("EPSG")
+		fgb.CrsStart(b)
+		fgb.CrsAddOrg(b, org)
+		fgb.CrsAddCode(b, int32(w.schema.srid))
+		crs = fgb.CrsEnd(b)
+	}
+
+	fgb.HeaderStart(b)
+	fgb.HeaderAddName(b, name)
+	fgb.HeaderAddGeometryType(b, geometryType)
+	if columnsVec != 0 {
+		fgb.HeaderAddColumns(b, columnsVec)
+	}
+	if envelope != 0 {
+		fgb.HeaderAddEnvelope(b, envelope)
+	}
+	if crs != 0 {
+		fgb.HeaderAddCrs(b, crs)
+	}
+	fgb.HeaderAddFeaturesCount(b, uint64(len(w.features)))
+	fgb.HeaderAddIndexNodeSize(b, indexNodeSize)
+	b.Finish(fgb.HeaderEnd(b))
+	return b.FinishedBytes()
+}
+
+func writeSizePrefixed(w io.Writer, b []byte) error {
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(b)))
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func (w *flatGeobufWriter) writeRow(row []interface{}) error {
+	g, err := w.schema.geometry(row)
+	if err != nil {
+		return err
+	}
+	props, err := w.properties(row)
+	if err != nil {
+		return err
+	}
+	b := flatbuffers.NewBuilder(1024)
+	var geometry, properties flatbuffers.UOffsetT
+	if g != nil {
+		geometry = flatGeobufGeometry(b, g)
+	}
+	if len(props) > 0 {
+		properties = b.CreateByteVector(props)
+	}
+	fgb.FeatureStart(b)
+	if geometry != 0 {
+		fgb.FeatureAddGeometry(b, geometry)
+	}
+	if properties != 0 {
+		fgb.FeatureAddProperties(b, properties)
+	}
+	b.Finish(fgb.FeatureEnd(b))
+	buf := b.FinishedBytes()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f := flatGeobufFeature{pos: w.tmpSize, size: int64(4 + len(buf))}
+	if g != nil {
+		f.node = geometryBounds(g)
+	}
+	if g == nil || math.IsInf(f.node.minX, 0) {
+		w.noIndex = true
+	}
+	if err := writeSizePrefixed(w.tmp.w, buf); err != nil {
+		return err
+	}
+	w.tmpSize += f.size
+	w.features = append(w.features, f)
+	return nil
+}
+
+// properties encodes all non-null values as column index, followed by the
+// little endian value.
+func (w *flatGeobufWriter) properties(row []interface{}) ([]byte, error) {
+	var b []byte
+	for n, i := range w.schema.properties {
+		v := propertyValue(row[i])
+		if v == nil {
+			continue
+		}
+		name := w.schema.columns[i].name
+		b = append(b, byte(n), byte(n>>8))
+		switch w.types[n] {
+		case fgb.ColumnTypeBool:
+			if v == true {
+				b = append(b, 1)
+			} else {
+				b = append(b, 0)
+			}
+		case fgb.ColumnTypeByte:
+			x, ok := v.(int64)
+			if !ok {
+				return nil, errors.Errorf("invalid value %v for column %q", v, name)
+			}
+			b = append(b, byte(int8(x)))
+		case fgb.ColumnTypeInt, fgb.ColumnTypeLong:
+			x, ok := v.(int64)
+			if !ok {
+				return nil, errors.Errorf("invalid value %v for column %q", v, name)
+			}
+			if w.types[n] == fgb.ColumnTypeInt {
+				b = appendUint32(b, uint32(int32(x)))
+			} else {
+				b = appendUint64(b, uint64(x))
+			}
+		case fgb.ColumnTypeFloat, fgb.ColumnTypeDouble:
+			f, ok := v.(float64)
+			if !ok {
+				return nil, errors.Errorf("invalid value %v for column %q", v, name)
+			}
+			if w.types[n] == fgb.ColumnTypeFloat {
+				b = appendUint32(b, math.Float32bits(float32(f)))
+			} else {
+				b = appendUint64(b, math.Float64bits(f))
+			}
+		default:
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.Errorf("invalid value %v for column %q", v, name)
+			}
+			b = appendUint32(b, uint32(len(s)))
+			b = append(b, s...)
+		}
+	}
+	return b, nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v)), uint32(v>>32))
+}
+
+// flatGeobufGeometry builds the Geometry table of g. Multipolygons and
+// collections store their parts as separate geometries.
+func flatGeobufGeometry(b *flatbuffers.Builder, g *wkb.Geometry) flatbuffers.UOffsetT {
+	var parts, xy, ends flatbuffers.UOffsetT
+	if len(g.Parts) > 0 {
+		offsets := make([]flatbuffers.UOffsetT, len(g.Parts))
+		for i := range g.Parts {
+			offsets[i] = flatGeobufGeometry(b, &g.Parts[i])
+		}
+		fgb.GeometryStartPartsVector(b, len(offsets))
+		for i := len(offsets) - 1; i >= 0; i-- {
+			b.PrependUOffsetT(offsets[i])
+		}
+		parts = b.EndVector(len(offsets))
+	} else {
+		if len(g.XY) > 0 {
+			fgb.GeometryStartXyVector(b, len(g.XY))
+			for i := len(g.XY) - 1; i >= 0; i-- {
+				b.PrependFloat64(g.XY[i])
+			}
+			xy = b.EndVector(len(g.XY))
+		}
+		if len(g.Ends) > 1 {
+			fgb.GeometryStartEndsVector(b, len(g.Ends))
+			for i := len(g.Ends) - 1; i >= 0; i-- {
+				b.PrependUint32(g.Ends[i])
+			}
+			ends = b.EndVector(len(g.Ends))
+		}
+	}
+	fgb.GeometryStart(b)
+	if parts != 0 {
+		fgb.GeometryAddParts(b, parts)
+	}
+	if xy != 0 {
+		fgb.GeometryAddXy(b, xy)
+	}
+	if ends != 0 {
+		fgb.GeometryAddEnds(b, ends)
+	}
+	fgb.GeometryAddType(b, fgb.GeometryType(g.Type))
+	return fgb.GeometryEnd(b)
+}
+
+func (w *flatGeobufWriter) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.tmp.flush()
+}
+
+// close writes the header, the index and the features from the temporary
+// file into the output file.
+func (w *flatGeobufWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	defer os.Remove(w.tmp.fd.Name())
+	if err := w.tmp.close(); err != nil {
+		w.fd.Close()
+		return err
+	}
+	if err := w.writeFile(); err != nil {
+		w.fd.Close()
+		return err
+	}
+	return w.fd.Close()
+}
+
+func (w *flatGeobufWriter) writeFile() error {
+	tmp, err := os.Open(w.tmp.fd.Name())
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+
+	var extent flatGeobufNode
+	var nodes []flatGeobufNode
+	indexNodeSize := uint16(0)
+	if len(w.features) > 0 {
+		extent = featuresExtent(w.features)
+		if !w.noIndex {
+			hilbertSort(w.features, extent)
+			nodes = packedRTree(w.features, flatGeobufIndexNodeSize)
+			indexNodeSize = flatGeobufIndexNodeSize
+		}
+	}
+
+	out := bufio.NewWriterSize(w.fd, 256*1024)
+	if _, err := out.Write(flatGeobufMagic); err != nil {
+		return err
+	}
+	header := w.header(flatbuffers.NewBuilder(1024), extent, indexNodeSize)
+	if err := writeSizePrefixed(out, header); err != nil {
+		return err
+	}
+	var node [40]byte
+	for _, n := range nodes {
+		binary.LittleEndian.PutUint64(node[0:], math.Float64bits(n.minX))
+		binary.LittleEndian.PutUint64(node[8:], math.Float64bits(n.minY))
+		binary.LittleEndian.PutUint64(node[16:], math.Float64bits(n.maxX))
+		binary.LittleEndian.PutUint64(node[24:], math.Float64bits(n.maxY))
+		binary.LittleEndian.PutUint64(node[32:], n.offset)
+		if _, err := out.Write(node[:]); err != nil {
+			return err
+		}
+	}
+	for _, f := range w.features {
+		if _, err := io.Copy(out, io.NewSectionReader(tmp, f.pos, f.size)); err != nil {
+			return err
+		}
+	}
+	return out.Flush()
+}
+
+// flatGeobufNode is a node of the packed R-tree. offset is the offset of
+// the feature (relative to the first feature) for leaf nodes, and the
+// index of the first child node otherwise.
+type flatGeobufNode struct {
+	minX, minY, maxX, maxY float64
+	offset                 uint64
+}
+
+func (n *flatGeobufNode) expand(o flatGeobufNode) {
+	n.minX = math.Min(n.minX, o.minX)
+	n.minY = math.Min(n.minY, o.minY)
+	n.maxX = math.Max(n.maxX, o.maxX)
+	n.maxY = math.Max(n.maxY, o.maxY)
+}
+
+func emptyNode(offset uint64) flatGeobufNode {
+	return flatGeobufNode{
+		minX: math.Inf(1), minY: math.Inf(1),
+		maxX: math.Inf(-1), maxY: math.Inf(-1),
+		offset: offset,
+	}
+}
+
+func geometryBounds(g *wkb.Geometry) flatGeobufNode {
+	n := emptyNode(0)
+	for i := 0; i+1 < len(g.XY); i += 2 {
+		n.expand(flatGeobufNode{minX: g.XY[i], minY: g.XY[i+1], maxX: g.XY[i], maxY: g.XY[i+1]})
+	}
+	for i := range g.Parts {
+		n.expand(geometryBounds(&g.Parts[i]))
+	}
+	return n
+}
+
+func featuresExtent(features []flatGeobufFeature) flatGeobufNode {
+	extent := emptyNode(0)
+	for _, f := range features {
+		extent.expand(f.node)
+	}
+	if math.IsInf(extent.minX, 0) {
+		// only empty geometries or features without geometries
+		return flatGeobufNode{}
+	}
+	return extent
+}
+
+// hilbertSort sorts the features by the Hilbert value of the center of
+// their bounds, in the same (descending) order as the reference
+// implementation.
+func hilbertSort(features []flatGeobufFeature, extent flatGeobufNode) {
+	const hilbertMax = (1 << 16) - 1
+	width := extent.maxX - extent.minX
+	height := extent.maxY - extent.minY
+	for i := range features {
+		f := &features[i]
+		var x, y uint32
+		if width != 0 {
+			x = uint32(math.Floor(hilbertMax * ((f.node.minX+f.node.maxX)/2 - extent.minX) / width))
+		}
+		if height != 0 {
+			y = uint32(math.Floor(hilbertMax * ((f.node.minY+f.node.maxY)/2 - extent.minY) / height))
+		}
+		f.hilbert = hilbert(x, y)
+	}
+	sort.SliceStable(features, func(i, j int) bool {
+		return features[i].hilbert > features[j].hilbert
+	})
+}
+
+// hilbert returns the position of x/y on the Hilbert curve, based on
+// http://threadlocalmutex.com/?p=126 as used by FlatGeobuf.
+func hilbert(x, y uint32) uint32 {
+	a := x ^ y
+	b := 0xFFFF ^ a
+	c := 0xFFFF ^ (x | y)
+	d := x & (y ^ 0xFFFF)
+
+	A := a | (b >> 1)
+	B := (a >> 1) ^ a
+	C := ((c >> 1) ^ (b & (d >> 1))) ^ c
+	D := ((a & (c >> 1)) ^ (d >> 1)) ^ d
+
+	a, b, c, d = A, B, C, D
+	A = (a & (a >> 2)) ^ (b & (b >> 2))
+	B = (a & (b >> 2)) ^ (b & ((a ^ b) >> 2))
+	C ^= (a & (c >> 2)) ^ (b & (d >> 2))
+	D ^= (b & (c >> 2)) ^ ((a ^ b) & (d >> 2))
+
+	a, b, c, d = A, B, C, D
+	A = (a & (a >> 4)) ^ (b & (b >> 4))
+	B = (a & (b >> 4)) ^ (b & ((a ^ b) >> 4))
+	C ^= (a & (c >> 4)) ^ (b & (d >> 4))
+	D ^= (b & (c >> 4)) ^ ((a ^ b) & (d >> 4))
+
+	a, b, c, d = A, B, C, D
+	C ^= (a & (c >> 8)) ^ (b & (d >> 8))
+	D ^= (b & (c >> 8)) ^ ((a ^ b) & (d >> 8))
+
+	a = C ^ (C >> 1)
+	b = D ^ (D >> 1)
+
+	i0 := x ^ y
+	i1 := b | (0xFFFF ^ (i0 | a))
+
+	return (interleave(i1) << 1) | interleave(i0)
+}
+
+func interleave(v uint32) uint32 {
+	v = (v | (v << 8)) & 0x00FF00FF
+	v = (v | (v << 4)) & 0x0F0F0F0F
+	v = (v | (v << 2)) & 0x33333333
+	v = (v | (v << 1)) & 0x55555555
+	return v
+}
+
+// packedRTree returns all nodes of the packed R-tree of the sorted
+// features, starting with the root node. The leaf nodes are at the end and
+// reference the features in their new order.
+func packedRTree(features []flatGeobufFeature, nodeSize int) []flatGeobufNode {
+	// number of nodes per level, from the leaves up to the root
+	levelNumNodes := []int{len(features)}
+	numNodes := len(features)
+	for n := len(features); n != 1 || len(levelNumNodes) == 1; {
+		n = (n + nodeSize - 1) / nodeSize
+		numNodes += n
+		levelNumNodes = append(levelNumNodes, n)
+	}
+	levelOffsets := make([]int, len(levelNumNodes))
+	n := numNodes
+	for i, size := range levelNumNodes {
+		levelOffsets[i] = n - size
+		n -= size
+	}
+
+	nodes := make([]flatGeobufNode, numNodes)
+	offset := uint64(0)
+	for i, f := range features {
+		leaf := f.node
+		leaf.offset = offset
+		nodes[levelOffsets[0]+i] = leaf
+		offset += uint64(f.size)
+	}
+	for level := 0; level < len(levelNumNodes)-1; level++ {
+		pos := levelOffsets[level]
+		end := pos + levelNumNodes[level]
+		parent := levelOffsets[level+1]
+		for pos < end {
+			node := emptyNode(uint64(pos))
+			for j := 0; j < nodeSize && pos < end; j++ {
+				node.expand(nodes[pos])
+				pos++
+			}
+			nodes[parent] = node
+			parent++
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,147 @@
+package file
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/omniscale/imposm3/geom/wkb"
+	"github.com/omniscale/imposm3/proj"
+)
+
+// geoJSONSeqWriter writes one GeoJSON feature per line (newline delimited
+// GeoJSON). Coordinates are always WGS84 (RFC 7946).
+type geoJSONSeqWriter struct {
+	mu     sync.Mutex
+	file   bufferedFile
+	schema *tableSchema
+	buf    []byte
+}
+
+func newGeoJSONSeqWriter(fd *os.File, schema *tableSchema) *geoJSONSeqWriter {
+	return &geoJSONSeqWriter{file: newBufferedFile(fd), schema: schema}
+}
+
+func (w *geoJSONSeqWriter) writeRow(row []interface{}) error {
+	g, err := w.schema.geometry(row)
+	if err != nil {
+		return err
+	}
+	props := make(map[string]interface{}, len(w.schema.properties))
+	for _, i := range w.schema.properties {
+		if v := propertyValue(row[i]); v != nil {
+			props[w.schema.columns[i].name] = v
+		}
+	}
+	propsJSON, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	b := w.buf[:0]
+	b = append(b, `{"type":"Feature","properties":`...)
+	b = append(b, propsJSON...)
+	b = append(b, `,"geometry":`...)
+	if g == nil {
+		b = append(b, "null"...)
+	} else {
+		b = appendGeoJSONGeometry(b, g, w.schema.srid == 3857)
+	}
+	b = append(b, "}\n"...)
+	w.buf = b
+	_, err = w.file.w.Write(b)
+	return err
+}
+
+func (w *geoJSONSeqWriter) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.flush()
+}
+
+func (w *geoJSONSeqWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.close()
+}
+
+var geoJSONTypes = map[uint32]string{
+	wkb.Point:              "Point",
+	wkb.LineString:         "LineString",
+	wkb.Polygon:            "Polygon",
+	wkb.MultiPoint:         "MultiPoint",
+	wkb.MultiLineString:    "MultiLineString",
+	wkb.MultiPolygon:       "MultiPolygon",
+	wkb.GeometryCollection: "GeometryCollection",
+}
+
+func appendGeoJSONGeometry(b []byte, g *wkb.Geometry, fromMerc bool) []byte {
+	b = append(b, `{"type":"`...)
+	b = append(b, geoJSONTypes[g.Type]...)
+	if g.Type == wkb.GeometryCollection {
+		b = append(b, `","geometries":[`...)
+		for i := range g.Parts {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendGeoJSONGeometry(b, &g.Parts[i], fromMerc)
+		}
+		return append(b, "]}"...)
+	}
+	b = append(b, `","coordinates":`...)
+	switch g.Type {
+	case wkb.Point:
+		b = appendCoord(b, g.XY, fromMerc)
+	case wkb.LineString, wkb.MultiPoint:
+		b = appendCoords(b, g.XY, fromMerc)
+	case wkb.Polygon, wkb.MultiLineString:
+		b = appendRings(b, g, fromMerc)
+	case wkb.MultiPolygon:
+		b = append(b, '[')
+		for i := range g.Parts {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendRings(b, &g.Parts[i], fromMerc)
+		}
+		b = append(b, ']')
+	}
+	return append(b, '}')
+}
+
+func appendRings(b []byte, g *wkb.Geometry, fromMerc bool) []byte {
+	b = append(b, '[')
+	for i, ring := range g.Rings() {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendCoords(b, ring, fromMerc)
+	}
+	return append(b, ']')
+}
+
+func appendCoords(b []byte, xy []float64, fromMerc bool) []byte {
+	b = append(b, '[')
+	for i := 0; i+1 < len(xy); i += 2 {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendCoord(b, xy[i:i+2], fromMerc)
+	}
+	return append(b, ']')
+}
+
+func appendCoord(b []byte, xy []float64, fromMerc bool) []byte {
+	x, y := xy[0], xy[1]
+	if fromMerc {
+		x, y = proj.MercToWgs(x, y)
+	}
+	b = append(b, '[')
+	b = strconv.AppendFloat(b, x, 'f', 7, 64)
+	b = append(b, ',')
+	b = strconv.AppendFloat(b, y, 'f', 7, 64)
+	return append(b, ']')
+}
@@ -0,0 +1,233 @@
+package file
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/omniscale/imposm3/geom/wkb"
+	"github.com/pkg/errors"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// defaultRowGroupSize is the number of rows of each row group.
+const defaultRowGroupSize = 65536
+
+// parquetTypes are the Parquet types of the Go types of the columns, other
+// columns are stored as UTF-8 strings.
+var parquetTypes = map[string]string{
+	"bool":    "BOOLEAN",
+	"int8":    "INT32",
+	"int32":   "INT32",
+	"int64":   "INT64",
+	"float32": "FLOAT",
+	"float64": "DOUBLE",
+}
+
+// parquetColumn is a column of the Parquet file and the index of the
+// column in the rows.
+type parquetColumn struct {
+	name     string
+	typ      string
+	idx      int
+	geometry bool
+}
+
+// geoParquetWriter writes a GeoParquet file. The rows are buffered by the
+// Parquet writer till a row group is complete. The geometry is stored as
+// WKB.
+type geoParquetWriter struct {
+	mu           sync.Mutex
+	file         bufferedFile
+	pw           *writer.CSVWriter
+	schema       *tableSchema
+	rowGroupSize int
+	columns      []parquetColumn
+	rows         int
+}
+
+func newGeoParquetWriter(fd *os.File, schema *tableSchema, writeHeader bool, rowGroupSize int) (*geoParquetWriter, error) {
+	if !writeHeader {
+		return nil, errors.New("appending to GeoParquet files is not supported, start a new -write without -resume")
+	}
+	if rowGroupSize <= 0 {
+		rowGroupSize = defaultRowGroupSize
+	}
+	w := &geoParquetWriter{file: newBufferedFile(fd), schema: schema, rowGroupSize: rowGroupSize}
+	for _, i := range schema.properties {
+		typ, ok := parquetTypes[schema.columns[i].goType]
+		if !ok {
+			typ = "UTF8"
+		}
+		w.columns = append(w.columns, parquetColumn{name: schema.columns[i].name, typ: typ, idx: i})
+	}
+	if schema.geomIdx != -1 {
+		w.columns = append(w.columns, parquetColumn{
+			name:     schema.columns[schema.geomIdx].name,
+			typ:      "BYTE_ARRAY",
+			idx:      schema.geomIdx,
+			geometry: true,
+		})
+	}
+	md := make([]string, len(w.columns))
+	for i, col := range w.columns {
+		if strings.ContainsAny(col.name, ",=") {
+			return nil, errors.Errorf("column name %q not supported by GeoParquet output", col.name)
+		}
+		md[i] = fmt.Sprintf("name=%s, type=%s", col.name, col.typ)
+	}
+	pw, err := writer.NewCSVWriterFromWriter(md, w.file.w, 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	w.pw = pw
+	return w, nil
+}
+
+func (w *geoParquetWriter) writeRow(row []interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	rec := make([]interface{}, len(w.columns))
+	for i, col := range w.columns {
+		v, err := col.value(row[col.idx])
+		if err != nil {
+			return err
+		}
+		rec[i] = v
+	}
+	if err := w.pw.Write(rec); err != nil {
+		return err
+	}
+	w.rows++
+	if w.rows >= w.rowGroupSize {
+		return w.writeRowGroup()
+	}
+	return nil
+}
+
+// value returns v as the Go type of the Parquet type of the column, or nil.
+func (c parquetColumn) value(v interface{}) (interface{}, error) {
+	if c.geometry {
+		hexWKB, ok := v.(string)
+		if !ok || hexWKB == "" {
+			return nil, nil
+		}
+		b, err := hex.DecodeString(hexWKB)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding hex WKB")
+		}
+		if b, err = wkb.RemoveSRID(b); err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+
+	v = propertyValue(v)
+	if v == nil {
+		return nil, nil
+	}
+	var ok bool
+	switch c.typ {
+	case "BOOLEAN":
+		_, ok = v.(bool)
+	case "INT32", "INT64":
+		var x int64
+		if x, ok = v.(int64); ok && c.typ == "INT32" {
+			v = int32(x)
+		}
+	case "FLOAT", "DOUBLE":
+		var f float64
+		if f, ok = v.(float64); ok && c.typ == "FLOAT" {
+			v = float32(f)
+		}
+	default:
+		_, ok = v.(string)
+	}
+	if !ok {
+		return nil, errors.Errorf("invalid value %v for column %q", v, c.name)
+	}
+	return v, nil
+}
+
+// writeRowGroup writes the buffered rows as a row group.
+func (w *geoParquetWriter) writeRowGroup() error {
+	if w.rows == 0 {
+		return nil
+	}
+	w.rows = 0
+	return w.pw.Flush(true)
+}
+
+// geoMetadata returns the JSON of the geo metadata key, or an empty string
+// for tables without geometry.
+func (w *geoParquetWriter) geoMetadata() (string, error) {
+	if w.schema.geomIdx == -1 {
+		return "", nil
+	}
+	name := w.schema.columns[w.schema.geomIdx].name
+	column := map[string]interface{}{
+		"encoding":       "WKB",
+		"geometry_types": []string{},
+	}
+	// missing crs defaults to OGC:CRS84 (lon/lat)
+	if w.schema.srid != 4326 {
+		column["crs"] = map[string]interface{}{
+			"$schema": "https://proj.org/schemas/v0.7/projjson.schema.json",
+			"type":    "ProjectedCRS",
+			"name":    crsName(w.schema.srid),
+			"id":      map[string]interface{}{"authority": "EPSG", "code": w.schema.srid},
+		}
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"version":        "1.0.0",
+		"primary_column": name,
+		"columns":        map[string]interface{}{name: column},
+	})
+	return string(b), err
+}
+
+func crsName(srid int) string {
+	if srid == 3857 {
+		return "WGS 84 / Pseudo-Mercator"
+	}
+	return "EPSG:" + strconv.Itoa(srid)
+}
+
+func (w *geoParquetWriter) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.flush()
+}
+
+// close writes the last row group and the footer with the GeoParquet
+// metadata.
+func (w *geoParquetWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.writeRowGroup(); err != nil {
+		w.file.close()
+		return err
+	}
+	geo, err := w.geoMetadata()
+	if err != nil {
+		w.file.close()
+		return err
+	}
+	if geo != "" {
+		w.pw.Footer.KeyValueMetadata = append(w.pw.Footer.KeyValueMetadata,
+			&parquet.KeyValue{Key: "geo", Value: &geo})
+	}
+	createdBy := "imposm"
+	w.pw.Footer.CreatedBy = &createdBy
+	if err := w.pw.WriteStop(); err != nil {
+		w.file.close()
+		return err
+	}
+	return w.file.close()
+}
@@ -0,0 +1,12 @@
+/*
+Package mvt implements a database that renders all tables with a tiles
+configuration into Mapbox Vector Tiles of an MBTiles file.
+
+The features are clipped to the tiles of each zoom level during the import
+and staged in the MBTiles file. Finish assembles the staged features into
+the gzipped vector tiles and writes the MBTiles metadata.
+
+Imposm needs to be built with the sqlite build tag to include the SQLite
+driver (github.com/mattn/go-sqlite3).
+*/
+package mvt
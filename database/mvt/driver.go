@@ -0,0 +1,9 @@
+//go:build sqlite
+// +build sqlite
+
+package mvt
+
+import (
+	// registers the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
@@ -0,0 +1,635 @@
+package mvt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/geom/wkb"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/omniscale/imposm3/proj"
+	"github.com/pkg/errors"
+)
+
+const driverName = "sqlite3"
+
+// maxZoom is the highest zoom level of the tiles configuration.
+const maxZoom = 18
+
+// stagingTable contains the clipped features of each tile till Finish.
+const stagingTable = "imposm_features"
+
+// layer is the vector tile layer of a table.
+type layer struct {
+	name       string
+	minZoom    int
+	maxZoom    int
+	columns    []column
+	properties []int
+	geomIdx    int
+}
+
+type column struct {
+	name   string
+	goType string
+}
+
+func (c column) isGeometry() bool {
+	return strings.HasSuffix(c.goType, "geometry")
+}
+
+// fieldType returns the type of the column for the vector_layers metadata.
+func (c column) fieldType() string {
+	switch {
+	case c.goType == "bool":
+		return "Boolean"
+	case strings.HasPrefix(c.goType, "int"), strings.HasPrefix(c.goType, "float"):
+		return "Number"
+	}
+	return "String"
+}
+
+func newLayer(name string, t *config.Table) (*layer, error) {
+	l := &layer{
+		name:    t.Tiles.Layer,
+		minZoom: t.Tiles.MinZoom,
+		maxZoom: t.Tiles.MaxZoom,
+		geomIdx: -1,
+	}
+	if l.name == "" {
+		l.name = name
+	}
+	if l.minZoom < 0 || l.maxZoom < l.minZoom || l.maxZoom > maxZoom {
+		return nil, errors.Errorf("invalid zoom range %d-%d, requires 0 <= minzoom <= maxzoom <= %d",
+			l.minZoom, l.maxZoom, maxZoom)
+	}
+	for i, c := range t.Columns {
+		colType, err := mapping.MakeColumnType(c)
+		if err != nil {
+			return nil, err
+		}
+		col := column{name: c.Name, goType: colType.GoType}
+		l.columns = append(l.columns, col)
+		if !col.isGeometry() {
+			l.properties = append(l.properties, i)
+		} else if l.geomIdx == -1 && (col.goType == "geometry" || col.goType == "validated_geometry") {
+			l.geomIdx = i
+		}
+	}
+	if l.geomIdx == -1 {
+		// tables with only extra geometries (e.g. geometry_centroid)
+		for i, col := range l.columns {
+			if col.isGeometry() {
+				l.geomIdx = i
+				break
+			}
+		}
+	}
+	if l.geomIdx == -1 {
+		return nil, errors.New("table has no geometry column")
+	}
+	return l, nil
+}
+
+// propertiesJSON returns the properties of the row as JSON.
+func (l *layer) propertiesJSON(row []interface{}) (string, error) {
+	props := make(map[string]interface{}, len(l.properties))
+	for _, i := range l.properties {
+		if v := propertyValue(row[i]); v != nil {
+			props[l.columns[i].name] = v
+		}
+	}
+	b, err := json.Marshal(props)
+	return string(b), err
+}
+
+// propertyValue converts a value of a row to string, bool, int64 or float64.
+// Columns return their own named types (e.g. osm.MemberType).
+func propertyValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return fmt.Sprint(v)
+}
+
+// decodeProperties decodes the JSON of propertiesJSON. Integer numbers
+// are returned as int64.
+func decodeProperties(s string) (map[string]interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	props := make(map[string]interface{})
+	if err := dec.Decode(&props); err != nil {
+		return nil, err
+	}
+	for k, v := range props {
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				props[k] = i
+			} else if f, err := n.Float64(); err == nil {
+				props[k] = f
+			}
+		}
+	}
+	return props, nil
+}
+
+// MBTiles renders all tables with a tiles configuration into the vector
+// tiles of an MBTiles file. Tables without tiles configuration are
+// skipped.
+type MBTiles struct {
+	Db     *sql.DB
+	Path   string
+	Config database.Config
+
+	layers map[string]*layer
+
+	mu   sync.Mutex
+	tx   *sql.Tx
+	stmt *sql.Stmt
+}
+
+func driverRegistered() bool {
+	for _, name := range sql.Drivers() {
+		if name == driverName {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputPath returns the output file.
+func (m *MBTiles) OutputPath() string {
+	return m.Path
+}
+
+func (m *MBTiles) Open() error {
+	if !driverRegistered() {
+		return errors.New("SQLite support not included, build Imposm with -tags sqlite")
+	}
+	var err error
+	m.Db, err = sql.Open(driverName, m.Path)
+	if err != nil {
+		return errors.Wrap(err, "opening MBTiles file")
+	}
+	// SQLite only supports a single writer
+	m.Db.SetMaxOpenConns(1)
+	return nil
+}
+
+// Init creates the MBTiles tables and the staging table, drops existing
+// tiles and features.
+func (m *MBTiles) Init() error {
+	for _, stmt := range []string{
+		`DROP TABLE IF EXISTS tiles`,
+		`DROP TABLE IF EXISTS metadata`,
+		`DROP TABLE IF EXISTS ` + stagingTable,
+		`CREATE TABLE metadata (name TEXT, value TEXT)`,
+		`CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB)`,
+		`CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row)`,
+		`CREATE TABLE ` + stagingTable + ` (z INTEGER, x INTEGER, y INTEGER, layer TEXT, id INTEGER, type INTEGER, geometry BLOB, properties TEXT)`,
+	} {
+		if _, err := m.Db.Exec(stmt); err != nil {
+			return errors.Wrapf(err, "initializing MBTiles with %q", stmt)
+		}
+	}
+	return nil
+}
+
+func (m *MBTiles) Begin() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var err error
+	m.tx, err = m.Db.Begin()
+	if err != nil {
+		return err
+	}
+	m.stmt, err = m.tx.Prepare(`INSERT INTO ` + stagingTable + ` (z, x, y, layer, id, type, geometry, properties) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		m.tx.Rollback()
+		m.tx = nil
+		return errors.Wrap(err, "preparing insert of features, MBTiles not initialized with -write?")
+	}
+	return nil
+}
+
+func (m *MBTiles) End() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tx == nil {
+		return nil
+	}
+	m.stmt.Close()
+	err := m.tx.Commit()
+	m.tx = nil
+	return err
+}
+
+func (m *MBTiles) Abort() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tx == nil {
+		return nil
+	}
+	m.stmt.Close()
+	err := m.tx.Rollback()
+	m.tx = nil
+	return err
+}
+
+func (m *MBTiles) Close() error {
+	return m.Db.Close()
+}
+
+type stagedFeature struct {
+	tile     tileID
+	geometry []byte
+}
+
+// insert clips the geometry of the row to all tiles of the zoom levels of
+// the layer and stages the features.
+func (m *MBTiles) insert(table string, id int64, row []interface{}) error {
+	l, ok := m.layers[table]
+	if !ok {
+		return nil
+	}
+	hexWKB, ok := row[l.geomIdx].(string)
+	if !ok || hexWKB == "" {
+		return nil
+	}
+	g, err := wkb.ParseHex(hexWKB)
+	if err != nil {
+		return err
+	}
+	s, ok := newShape(&g)
+	if !ok {
+		return nil
+	}
+	props, err := l.propertiesJSON(row)
+	if err != nil {
+		return err
+	}
+
+	var features []stagedFeature
+	for z := l.minZoom; z <= l.maxZoom; z++ {
+		for _, t := range s.tiles(z) {
+			if cmds := s.encode(t); len(cmds) > 0 {
+				features = append(features, stagedFeature{t, packCommands(cmds)})
+			}
+		}
+	}
+	if len(features) == 0 {
+		return nil
+	}
+
+	var featureID interface{}
+	if id >= 0 {
+		featureID = id
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tx == nil {
+		return errors.New("no transaction")
+	}
+	for _, f := range features {
+		if _, err := m.stmt.Exec(f.tile.z, f.tile.x, f.tile.y, l.name, featureID, s.typ, f.geometry, props); err != nil {
+			return errors.Wrapf(err, "staging feature for %q", table)
+		}
+	}
+	return nil
+}
+
+func (m *MBTiles) InsertPoint(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	return m.insertElement(elem, geom, matches)
+}
+
+func (m *MBTiles) InsertLineString(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	return m.insertElement(elem, geom, matches)
+}
+
+func (m *MBTiles) InsertPolygon(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	return m.insertElement(elem, geom, matches)
+}
+
+func (m *MBTiles) insertElement(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	for _, match := range matches {
+		row := match.Row(&elem, &geom)
+		if err := m.insert(match.Table.Name, elem.ID, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MBTiles) InsertRelationMember(rel osm.Relation, mb osm.Member, geom geom.Geometry, matches []mapping.Match) error {
+	for _, match := range matches {
+		row := match.MemberRow(&rel, &mb, &geom)
+		if err := m.insert(match.Table.Name, rel.ID, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Generalize does nothing, generalized tables are not supported.
+func (m *MBTiles) Generalize() error {
+	return nil
+}
+
+func (m *MBTiles) EnableGeneralizeUpdates() {}
+
+func (m *MBTiles) GeneralizeUpdates() error {
+	return nil
+}
+
+// Finish assembles the staged features into the vector tiles, writes the
+// metadata and removes the staging table.
+func (m *MBTiles) Finish() error {
+	defer log.Step("Writing vector tiles")()
+
+	tx, err := m.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, stmt := range []string{
+		`DELETE FROM tiles`,
+		`DELETE FROM metadata`,
+		`CREATE INDEX IF NOT EXISTS ` + stagingTable + `_tile ON ` + stagingTable + ` (z, x, y, layer)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return errors.Wrapf(err, "preparing tiles with %q", stmt)
+		}
+	}
+
+	insert, err := tx.Prepare(`INSERT INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	rows, err := tx.Query(`SELECT z, x, y, layer, id, type, geometry, properties FROM ` +
+		stagingTable + ` ORDER BY z, x, y, layer, rowid`)
+	if err != nil {
+		return errors.Wrap(err, "querying staged features")
+	}
+	defer rows.Close()
+
+	var tiles int
+	var cur tileID
+	var layers []*layerBuilder
+	writeTile := func() error {
+		if len(layers) == 0 {
+			return nil
+		}
+		data, err := gzipTile(encodeTile(layers))
+		if err != nil {
+			return err
+		}
+		// MBTiles uses the TMS scheme with the origin at the bottom
+		row := (1 << uint(cur.z)) - 1 - cur.y
+		if _, err := insert.Exec(cur.z, cur.x, row, data); err != nil {
+			return errors.Wrapf(err, "inserting tile %d/%d/%d", cur.z, cur.x, cur.y)
+		}
+		tiles++
+		return nil
+	}
+	for rows.Next() {
+		var t tileID
+		var name, props string
+		var id sql.NullInt64
+		var typ int
+		var geometry []byte
+		if err := rows.Scan(&t.z, &t.x, &t.y, &name, &id, &typ, &geometry, &props); err != nil {
+			return errors.Wrap(err, "reading staged features")
+		}
+		if len(layers) == 0 || t != cur {
+			if err := writeTile(); err != nil {
+				return err
+			}
+			cur = t
+			layers = layers[:0]
+		}
+		if len(layers) == 0 || layers[len(layers)-1].name != name {
+			layers = append(layers, newLayerBuilder(name))
+		}
+		properties, err := decodeProperties(props)
+		if err != nil {
+			return errors.Wrap(err, "decoding staged properties")
+		}
+		featureID := int64(-1)
+		if id.Valid {
+			featureID = id.Int64
+		}
+		layers[len(layers)-1].addFeature(featureID, typ, geometry, properties)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "reading staged features")
+	}
+	if err := writeTile(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	if err := m.writeMetadata(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DROP TABLE ` + stagingTable); err != nil {
+		return errors.Wrap(err, "dropping staged features")
+	}
+	err = tx.Commit()
+	tx = nil
+	if err != nil {
+		return err
+	}
+	log.Printf("[info] Wrote %d vector tiles to %s", tiles, m.Path)
+
+	if _, err := m.Db.Exec("VACUUM"); err != nil {
+		return errors.Wrap(err, "vacuum MBTiles file")
+	}
+	return nil
+}
+
+func gzipTile(tile []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(tile); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type vectorLayer struct {
+	ID      string            `json:"id"`
+	Fields  map[string]string `json:"fields"`
+	MinZoom int               `json:"minzoom"`
+	MaxZoom int               `json:"maxzoom"`
+}
+
+// writeMetadata writes the MBTiles metadata with the zoom range, the
+// bounds of all tiles and the vector_layers of all layers.
+func (m *MBTiles) writeMetadata(tx *sql.Tx) error {
+	minZ, maxZ := maxZoom, 0
+	layers := make(map[string]*vectorLayer)
+	for _, l := range m.layers {
+		if l.minZoom < minZ {
+			minZ = l.minZoom
+		}
+		if l.maxZoom > maxZ {
+			maxZ = l.maxZoom
+		}
+		vl, ok := layers[l.name]
+		if !ok {
+			vl = &vectorLayer{ID: l.name, Fields: make(map[string]string), MinZoom: l.minZoom, MaxZoom: l.maxZoom}
+			layers[l.name] = vl
+		}
+		// multiple tables can share a layer
+		if l.minZoom < vl.MinZoom {
+			vl.MinZoom = l.minZoom
+		}
+		if l.maxZoom > vl.MaxZoom {
+			vl.MaxZoom = l.maxZoom
+		}
+		for _, i := range l.properties {
+			vl.Fields[l.columns[i].name] = l.columns[i].fieldType()
+		}
+	}
+	names := make([]string, 0, len(layers))
+	for name := range layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vectorLayers := make([]*vectorLayer, 0, len(names))
+	for _, name := range names {
+		vectorLayers = append(vectorLayers, layers[name])
+	}
+	layersJSON, err := json.Marshal(map[string]interface{}{"vector_layers": vectorLayers})
+	if err != nil {
+		return err
+	}
+
+	bounds, err := m.bounds(tx)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(m.Path), filepath.Ext(m.Path))
+	for _, kv := range [][2]string{
+		{"name", name},
+		{"format", "pbf"},
+		{"type", "baselayer"},
+		{"minzoom", fmt.Sprint(minZ)},
+		{"maxzoom", fmt.Sprint(maxZ)},
+		{"bounds", bounds},
+		{"json", string(layersJSON)},
+	} {
+		if _, err := tx.Exec(`INSERT INTO metadata (name, value) VALUES (?, ?)`, kv[0], kv[1]); err != nil {
+			return errors.Wrap(err, "writing metadata")
+		}
+	}
+	return nil
+}
+
+// bounds returns the WGS84 bounds of all tiles of the highest zoom level
+// as "west,south,east,north".
+func (m *MBTiles) bounds(tx *sql.Tx) (string, error) {
+	var z, minX, maxX, minY, maxY sql.NullInt64
+	err := tx.QueryRow(`SELECT z, MIN(x), MAX(x), MIN(y), MAX(y) FROM `+stagingTable+
+		` WHERE z = (SELECT MAX(z) FROM `+stagingTable+`) GROUP BY z`).Scan(&z, &minX, &maxX, &minY, &maxY)
+	if err == sql.ErrNoRows {
+		return "-180,-85.0511,180,85.0511", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "querying bounds")
+	}
+	size := tileSize(int(z.Int64))
+	west, north := proj.MercToWgs(-worldExtent+float64(minX.Int64)*size, worldExtent-float64(minY.Int64)*size)
+	east, south := proj.MercToWgs(-worldExtent+float64(maxX.Int64+1)*size, worldExtent-float64(maxY.Int64+1)*size)
+	return fmt.Sprintf("%.6f,%.6f,%.6f,%.6f", west, south, east, north), nil
+}
+
+// parseConnectionParams returns the path of connection strings like
+// mbtiles:///path/to/tiles.mbtiles.
+func parseConnectionParams(params string) (string, error) {
+	path := strings.TrimPrefix(strings.TrimSpace(params), "mbtiles:")
+	path = strings.TrimPrefix(path, "//")
+	if path == "" {
+		return "", errors.New("missing path of MBTiles file in connection")
+	}
+	if strings.Contains(path, "?") {
+		return "", errors.New("mbtiles connection does not support parameters")
+	}
+	return path, nil
+}
+
+func New(conf database.Config, m *config.Mapping) (database.DB, error) {
+	if conf.Srid != 3857 {
+		return nil, errors.Errorf("mbtiles output requires -srid 3857, not %d", conf.Srid)
+	}
+	db := &MBTiles{Config: conf, layers: make(map[string]*layer)}
+
+	var err error
+	db.Path, err = parseConnectionParams(conf.ConnectionParams)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, table := range m.Tables {
+		if table.Tiles == nil {
+			log.Printf("[warn] Table %s has no tiles configuration and is skipped", name)
+			continue
+		}
+		l, err := newLayer(name, table)
+		if err != nil {
+			return nil, errors.Wrapf(err, "tiles of table %s", name)
+		}
+		db.layers[name] = l
+	}
+	if len(db.layers) == 0 {
+		return nil, errors.New("mbtiles output requires tables with tiles configuration")
+	}
+	if len(m.GeneralizedTables) > 0 {
+		log.Printf("[warn] Generalized tables are not supported by the mbtiles output and are skipped")
+	}
+
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func init() {
+	database.Register("mbtiles", New)
+}
@@ -0,0 +1,93 @@
+//go:build sqlite
+// +build sqlite
+
+package mvt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/mapping"
+)
+
+func pointWKB(x, y float64) string {
+	buf := &bytes.Buffer{}
+	buf.WriteByte(1)
+	binary.Write(buf, binary.LittleEndian, uint32(1))
+	binary.Write(buf, binary.LittleEndian, math.Float64bits(x))
+	binary.Write(buf, binary.LittleEndian, math.Float64bits(y))
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func TestMBTiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_mbtiles_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m, err := mapping.New([]byte(`
+tables:
+  pois:
+    type: point
+    columns:
+      - {name: osm_id, type: id}
+      - {name: geometry, type: geometry}
+      - {name: name, type: string, key: name}
+    mapping:
+      amenity: [__any__]
+    tiles:
+      minzoom: 0
+      maxzoom: 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.mbtiles")
+	db, err := New(database.Config{ConnectionParams: "mbtiles:" + path, Srid: 3857}, &m.Conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mbt := db.(*MBTiles)
+
+	if err := mbt.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mbt.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mbt.insert("pois", 1, []interface{}{int64(1), pointWKB(1000, 1000), "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mbt.End(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mbt.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the point is in one tile of each zoom level and in the buffer of
+	// the neighbouring tiles
+	var zooms int
+	if err := mbt.Db.QueryRow(`SELECT count(DISTINCT zoom_level) FROM tiles`).Scan(&zooms); err != nil {
+		t.Fatal(err)
+	}
+	if zooms != 3 {
+		t.Errorf("expected tiles for three zoom levels, got %d", zooms)
+	}
+	var format string
+	if err := mbt.Db.QueryRow(`SELECT value FROM metadata WHERE name = 'format'`).Scan(&format); err != nil {
+		t.Fatal(err)
+	}
+	if format != "pbf" {
+		t.Errorf("unexpected format %q", format)
+	}
+}
@@ -0,0 +1,125 @@
+package mvt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/omniscale/imposm3/geom/wkb"
+)
+
+func TestClipSegment(t *testing.T) {
+	for _, tt := range []struct {
+		in       [4]float64
+		expected [4]float64
+		ok       bool
+	}{
+		{[4]float64{1, 1, 5, 5}, [4]float64{1, 1, 5, 5}, true},
+		{[4]float64{-10, 5, 20, 5}, [4]float64{0, 5, 10, 5}, true},
+		{[4]float64{5, 5, 5, 20}, [4]float64{5, 5, 5, 10}, true},
+		{[4]float64{-5, -5, -1, 20}, [4]float64{}, false},
+		{[4]float64{11, 0, 20, 10}, [4]float64{}, false},
+	} {
+		x0, y0, x1, y1, ok := clipSegment(tt.in[0], tt.in[1], tt.in[2], tt.in[3], 0, 10)
+		if ok != tt.ok {
+			t.Errorf("%v: unexpected ok %v", tt.in, ok)
+			continue
+		}
+		if ok && [4]float64{x0, y0, x1, y1} != tt.expected {
+			t.Errorf("%v: unexpected segment %v %v %v %v", tt.in, x0, y0, x1, y1)
+		}
+	}
+}
+
+func TestClipLine(t *testing.T) {
+	// leaves and re-enters the square
+	lines := clipLine([]float64{1, 1, 5, 1, 5, 20, 8, 20, 8, 5}, 0, 10)
+	expected := [][]float64{{1, 1, 5, 1, 5, 10}, {8, 10, 8, 5}}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("unexpected lines %v", lines)
+	}
+}
+
+func TestClipRing(t *testing.T) {
+	ring := clipRing([]float64{-5, -5, 5, -5, 5, 5, -5, 5}, 0, 10)
+	if area := ringArea(quantize(ring, true)); area != 50 && area != -50 {
+		t.Errorf("unexpected ring %v with area %d", ring, area)
+	}
+	if ring := clipRing([]float64{20, 20, 30, 20, 30, 30}, 0, 10); len(ring) != 0 {
+		t.Errorf("expected empty ring, got %v", ring)
+	}
+}
+
+func TestShapeTiles(t *testing.T) {
+	s, ok := newShape(&wkb.Geometry{Type: wkb.Point, XY: []float64{1, 1}})
+	if !ok {
+		t.Fatal("no shape")
+	}
+	// point near the center is in the buffer of all four tiles
+	if tiles := s.tiles(1); len(tiles) != 4 {
+		t.Errorf("unexpected tiles %v", tiles)
+	}
+	if tiles := s.tiles(0); len(tiles) != 1 || tiles[0] != (tileID{0, 0, 0}) {
+		t.Errorf("unexpected tiles %v", tiles)
+	}
+	if cmds := s.encode(tileID{1, 1, 0}); !reflect.DeepEqual(cmds, []uint32{9, 0, 8192}) {
+		t.Errorf("unexpected commands %v", cmds)
+	}
+	if cmds := s.encode(tileID{2, 3, 0}); cmds != nil {
+		t.Errorf("expected no commands, got %v", cmds)
+	}
+}
+
+func TestEncodePolygon(t *testing.T) {
+	// counter-clockwise in map coordinates, needs to be reversed as the
+	// y-axis of tile coordinates points down
+	size := tileSize(0)
+	s, _ := newShape(&wkb.Geometry{
+		Type: wkb.Polygon,
+		XY: []float64{
+			0, 0, size / 4, 0, size / 4, size / 4, 0, size / 4, 0, 0,
+		},
+		Ends: []uint32{5},
+	})
+	cmds := s.encode(tileID{0, 0, 0})
+	// MoveTo(2048,1024) LineTo(+1024,0)(0,+1024)(-1024,0) ClosePath
+	expected := []uint32{9, 4096, 2048, 26, 2048, 0, 0, 2048, 2047, 0, 15}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("unexpected commands %v", cmds)
+	}
+}
+
+func TestLayerBuilder(t *testing.T) {
+	l := newLayerBuilder("roads")
+	l.addFeature(42, typePoint, packCommands([]uint32{9, 2, 2}), map[string]interface{}{
+		"name":  "Foo",
+		"lanes": int64(2),
+	})
+	l.addFeature(-1, typePoint, packCommands([]uint32{9, 4, 4}), map[string]interface{}{
+		"name": "Foo",
+	})
+	if !reflect.DeepEqual(l.keys, []string{"lanes", "name"}) {
+		t.Errorf("unexpected keys %v", l.keys)
+	}
+	if len(l.values) != 2 {
+		t.Errorf("unexpected values %v", l.values)
+	}
+	b := encodeTile([]*layerBuilder{l})
+	// tile.layers field 3 with name and version 2
+	if b[0] != 3<<3|wireBytes || !bytes.Contains(b, []byte("\x0a\x05roads")) || !bytes.Contains(b, []byte{15<<3 | wireVarint, 2}) {
+		t.Errorf("unexpected tile %v", b)
+	}
+	// feature with id 42, tags 0:0 1:1, type 1
+	if !bytes.Contains(b, []byte{0x08, 42, 0x12, 4, 0, 0, 1, 1, 0x18, 1}) {
+		t.Errorf("unexpected feature in tile %v", b)
+	}
+}
+
+func TestParseConnectionParams(t *testing.T) {
+	if path, err := parseConnectionParams("mbtiles:///tmp/osm.mbtiles"); err != nil || path != "/tmp/osm.mbtiles" {
+		t.Errorf("unexpected path %q %v", path, err)
+	}
+	if _, err := parseConnectionParams("mbtiles://"); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,552 @@
+package mvt
+
+import (
+	"math"
+	"sort"
+
+	"github.com/omniscale/imposm3/geom/wkb"
+)
+
+const (
+	// extent is the size of a tile in tile coordinates.
+	extent = 4096
+	// buffer is the number of tile coordinates that features extend into
+	// the neighbouring tiles, so that lines and polygons are rendered
+	// without gaps at the tile borders.
+	buffer = 64
+
+	worldExtent = 20037508.342789244
+)
+
+// MVT geometry types
+const (
+	typePoint      = 1
+	typeLineString = 2
+	typePolygon    = 3
+)
+
+// MVT geometry commands
+const (
+	cmdMoveTo    = 1
+	cmdLineTo    = 2
+	cmdClosePath = 7
+)
+
+type tileID struct {
+	z, x, y int
+}
+
+// shape is a geometry in EPSG:3857 split into the parts of a vector tile
+// feature. Polygons contain the exterior ring first and then the holes.
+type shape struct {
+	typ      int
+	points   []float64
+	lines    [][]float64
+	polygons [][][]float64
+	bbox     [4]float64
+}
+
+// newShape converts g into a shape. It returns false for empty geometries
+// and geometry collections, as features of a vector tile only have a
+// single geometry type.
+func newShape(g *wkb.Geometry) (*shape, bool) {
+	s := &shape{}
+	switch g.Type {
+	case wkb.Point, wkb.MultiPoint:
+		s.typ = typePoint
+		s.points = g.XY
+	case wkb.LineString:
+		s.typ = typeLineString
+		s.lines = [][]float64{g.XY}
+	case wkb.MultiLineString:
+		s.typ = typeLineString
+		s.lines = g.Rings()
+	case wkb.Polygon:
+		s.typ = typePolygon
+		s.polygons = [][][]float64{g.Rings()}
+	case wkb.MultiPolygon:
+		s.typ = typePolygon
+		for i := range g.Parts {
+			s.polygons = append(s.polygons, g.Parts[i].Rings())
+		}
+	default:
+		return nil, false
+	}
+
+	s.bbox = [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	s.extend(s.points)
+	for _, l := range s.lines {
+		s.extend(l)
+	}
+	for _, p := range s.polygons {
+		if len(p) > 0 {
+			s.extend(p[0])
+		}
+	}
+	if s.bbox[0] > s.bbox[2] {
+		return nil, false
+	}
+	return s, true
+}
+
+func (s *shape) extend(xy []float64) {
+	for i := 0; i+1 < len(xy); i += 2 {
+		s.bbox[0] = math.Min(s.bbox[0], xy[i])
+		s.bbox[1] = math.Min(s.bbox[1], xy[i+1])
+		s.bbox[2] = math.Max(s.bbox[2], xy[i])
+		s.bbox[3] = math.Max(s.bbox[3], xy[i+1])
+	}
+}
+
+func tileSize(z int) float64 {
+	return 2 * worldExtent / float64(int(1)<<uint(z))
+}
+
+// tiles returns all tiles of zoom level z that intersect the bbox of the
+// shape, including the buffer.
+func (s *shape) tiles(z int) []tileID {
+	n := 1 << uint(z)
+	size := tileSize(z)
+	buf := size * buffer / extent
+	clamp := func(v float64) int {
+		i := int(math.Floor(v / size))
+		if i < 0 {
+			return 0
+		}
+		if i >= n {
+			return n - 1
+		}
+		return i
+	}
+	x0 := clamp(s.bbox[0] - buf + worldExtent)
+	x1 := clamp(s.bbox[2] + buf + worldExtent)
+	y0 := clamp(worldExtent - s.bbox[3] - buf)
+	y1 := clamp(worldExtent - s.bbox[1] + buf)
+
+	tiles := make([]tileID, 0, (x1-x0+1)*(y1-y0+1))
+	for x := x0; x <= x1; x++ {
+		for y := y0; y <= y1; y++ {
+			tiles = append(tiles, tileID{z, x, y})
+		}
+	}
+	return tiles
+}
+
+// transform returns the coordinates in the tile coordinates of t. The
+// y-axis of tile coordinates points down.
+func transform(t tileID, xy []float64) []float64 {
+	size := tileSize(t.z)
+	minx := -worldExtent + float64(t.x)*size
+	maxy := worldExtent - float64(t.y)*size
+	scale := extent / size
+	result := make([]float64, len(xy))
+	for i := 0; i+1 < len(xy); i += 2 {
+		result[i] = (xy[i] - minx) * scale
+		result[i+1] = (maxy - xy[i+1]) * scale
+	}
+	return result
+}
+
+// encode returns the geometry commands of the shape clipped to the tile
+// t, or nil if nothing remains.
+func (s *shape) encode(t tileID) []uint32 {
+	const lo, hi = -buffer, extent + buffer
+	e := &geomEncoder{}
+	switch s.typ {
+	case typePoint:
+		var points []int32
+		xy := transform(t, s.points)
+		for i := 0; i+1 < len(xy); i += 2 {
+			if xy[i] >= lo && xy[i] <= hi && xy[i+1] >= lo && xy[i+1] <= hi {
+				points = append(points, round(xy[i]), round(xy[i+1]))
+			}
+		}
+		if len(points) > 0 {
+			e.command(cmdMoveTo, len(points)/2)
+			e.coords(points)
+		}
+	case typeLineString:
+		for _, l := range s.lines {
+			for _, part := range clipLine(transform(t, l), lo, hi) {
+				line := quantize(part, false)
+				if len(line) < 4 {
+					continue
+				}
+				e.command(cmdMoveTo, 1)
+				e.coords(line[:2])
+				e.command(cmdLineTo, len(line)/2-1)
+				e.coords(line[2:])
+			}
+		}
+	case typePolygon:
+		for _, p := range s.polygons {
+			for i, r := range p {
+				ring := quantize(clipRing(transform(t, r), lo, hi), true)
+				area := ringArea(ring)
+				if area == 0 {
+					if i == 0 {
+						// exterior ring outside of this tile
+						break
+					}
+					continue
+				}
+				// exterior rings have a positive area, holes a negative
+				if (i == 0) != (area > 0) {
+					reverse(ring)
+				}
+				e.command(cmdMoveTo, 1)
+				e.coords(ring[:2])
+				e.command(cmdLineTo, len(ring)/2-1)
+				e.coords(ring[2:])
+				e.command(cmdClosePath, 1)
+			}
+		}
+	}
+	return e.cmds
+}
+
+func round(v float64) int32 {
+	return int32(math.Floor(v + 0.5))
+}
+
+// quantize rounds the coordinates to integers and removes repeated
+// points. The closing point of rings is removed.
+func quantize(xy []float64, ring bool) []int32 {
+	result := make([]int32, 0, len(xy))
+	for i := 0; i+1 < len(xy); i += 2 {
+		x, y := round(xy[i]), round(xy[i+1])
+		if n := len(result); n > 0 && result[n-2] == x && result[n-1] == y {
+			continue
+		}
+		result = append(result, x, y)
+	}
+	if n := len(result); ring && n >= 4 && result[0] == result[n-2] && result[1] == result[n-1] {
+		result = result[:n-2]
+	}
+	return result
+}
+
+// ringArea returns the doubled area of the ring (surveyor's formula).
+// Rings with less than three points have no area.
+func ringArea(ring []int32) int64 {
+	if len(ring) < 6 {
+		return 0
+	}
+	var area int64
+	n := len(ring)
+	for i := 0; i < n; i += 2 {
+		j := (i + 2) % n
+		area += int64(ring[i])*int64(ring[j+1]) - int64(ring[j])*int64(ring[i+1])
+	}
+	return area
+}
+
+func reverse(ring []int32) {
+	for i, j := 0, len(ring)-2; i < j; i, j = i+2, j-2 {
+		ring[i], ring[j] = ring[j], ring[i]
+		ring[i+1], ring[j+1] = ring[j+1], ring[i+1]
+	}
+}
+
+// clipRing clips a ring to the square lo/hi with the Sutherland-Hodgman
+// algorithm. Parts of rings outside of the square collapse to the border,
+// which is not visible when rendering the tile.
+func clipRing(ring []float64, lo, hi float64) []float64 {
+	for edge := 0; edge < 4; edge++ {
+		if len(ring) < 2 {
+			return nil
+		}
+		out := make([]float64, 0, len(ring)+8)
+		px, py := ring[len(ring)-2], ring[len(ring)-1]
+		prevInside := inside(edge, px, py, lo, hi)
+		for i := 0; i+1 < len(ring); i += 2 {
+			x, y := ring[i], ring[i+1]
+			in := inside(edge, x, y, lo, hi)
+			if in != prevInside {
+				ix, iy := intersection(edge, px, py, x, y, lo, hi)
+				out = append(out, ix, iy)
+			}
+			if in {
+				out = append(out, x, y)
+			}
+			px, py, prevInside = x, y, in
+		}
+		ring = out
+	}
+	return ring
+}
+
+func inside(edge int, x, y, lo, hi float64) bool {
+	switch edge {
+	case 0:
+		return x >= lo
+	case 1:
+		return x <= hi
+	case 2:
+		return y >= lo
+	default:
+		return y <= hi
+	}
+}
+
+func intersection(edge int, x0, y0, x1, y1, lo, hi float64) (float64, float64) {
+	switch edge {
+	case 0:
+		return lo, y0 + (y1-y0)*(lo-x0)/(x1-x0)
+	case 1:
+		return hi, y0 + (y1-y0)*(hi-x0)/(x1-x0)
+	case 2:
+		return x0 + (x1-x0)*(lo-y0)/(y1-y0), lo
+	default:
+		return x0 + (x1-x0)*(hi-y0)/(y1-y0), hi
+	}
+}
+
+// clipLine clips a linestring to the square lo/hi. It returns a separate
+// line for each part that is inside the square.
+func clipLine(line []float64, lo, hi float64) [][]float64 {
+	var lines [][]float64
+	var cur []float64
+	for i := 0; i+3 < len(line); i += 2 {
+		x0, y0, x1, y1, ok := clipSegment(line[i], line[i+1], line[i+2], line[i+3], lo, hi)
+		if !ok {
+			if cur != nil {
+				lines = append(lines, cur)
+				cur = nil
+			}
+			continue
+		}
+		if n := len(cur); n == 0 || cur[n-2] != x0 || cur[n-1] != y0 {
+			if cur != nil {
+				lines = append(lines, cur)
+			}
+			cur = []float64{x0, y0}
+		}
+		cur = append(cur, x1, y1)
+	}
+	if cur != nil {
+		lines = append(lines, cur)
+	}
+	return lines
+}
+
+// clipSegment clips a segment to the square lo/hi with the Liang-Barsky
+// algorithm. Points inside of the square are returned unchanged.
+func clipSegment(x0, y0, x1, y1, lo, hi float64) (float64, float64, float64, float64, bool) {
+	dx, dy := x1-x0, y1-y0
+	t0, t1 := 0.0, 1.0
+	for _, pq := range [4][2]float64{{-dx, x0 - lo}, {dx, hi - x0}, {-dy, y0 - lo}, {dy, hi - y0}} {
+		p, q := pq[0], pq[1]
+		if p == 0 {
+			if q < 0 {
+				return 0, 0, 0, 0, false
+			}
+			continue
+		}
+		r := q / p
+		if p < 0 {
+			if r > t1 {
+				return 0, 0, 0, 0, false
+			}
+			if r > t0 {
+				t0 = r
+			}
+		} else {
+			if r < t0 {
+				return 0, 0, 0, 0, false
+			}
+			if r < t1 {
+				t1 = r
+			}
+		}
+	}
+	if t1 < 1 {
+		x1, y1 = x0+t1*dx, y0+t1*dy
+	}
+	if t0 > 0 {
+		x0, y0 = x0+t0*dx, y0+t0*dy
+	}
+	return x0, y0, x1, y1, true
+}
+
+// geomEncoder encodes geometry commands with zigzag encoded deltas.
+type geomEncoder struct {
+	cmds []uint32
+	x, y int32
+}
+
+func (e *geomEncoder) command(id, count int) {
+	e.cmds = append(e.cmds, uint32(id&0x7|count<<3))
+}
+
+func (e *geomEncoder) coords(xy []int32) {
+	for i := 0; i+1 < len(xy); i += 2 {
+		e.cmds = append(e.cmds, zigzag(xy[i]-e.x), zigzag(xy[i+1]-e.y))
+		e.x, e.y = xy[i], xy[i+1]
+	}
+}
+
+func zigzag(v int32) uint32 {
+	return uint32((v << 1) ^ (v >> 31))
+}
+
+// Protocol Buffers encoding of vector tiles
+// (https://github.com/mapbox/vector-tile-spec/blob/master/2.1/vector_tile.proto)
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, field, wire int) []byte {
+	return appendVarint(b, uint64(field<<3|wire))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// packCommands returns the packed encoding of the geometry commands.
+func packCommands(cmds []uint32) []byte {
+	b := make([]byte, 0, len(cmds)*2)
+	for _, c := range cmds {
+		b = appendVarint(b, uint64(c))
+	}
+	return b
+}
+
+// layerBuilder collects the features of a layer of a single tile.
+type layerBuilder struct {
+	name     string
+	features []byte
+	keys     []string
+	keyIdx   map[string]uint32
+	values   [][]byte
+	valueIdx map[interface{}]uint32
+}
+
+func newLayerBuilder(name string) *layerBuilder {
+	return &layerBuilder{
+		name:     name,
+		keyIdx:   make(map[string]uint32),
+		valueIdx: make(map[interface{}]uint32),
+	}
+}
+
+// addFeature adds a feature with the packed geometry commands. Properties
+// need to be string, bool, int64 or float64, other values are skipped.
+// Negative IDs are not encoded.
+func (l *layerBuilder) addFeature(id int64, typ int, geometry []byte, props map[string]interface{}) {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var tags []byte
+	for _, k := range keys {
+		v, ok := l.value(props[k])
+		if !ok {
+			continue
+		}
+		tags = appendVarint(tags, uint64(l.key(k)))
+		tags = appendVarint(tags, uint64(v))
+	}
+
+	var f []byte
+	if id >= 0 {
+		f = appendTag(f, 1, wireVarint)
+		f = appendVarint(f, uint64(id))
+	}
+	if len(tags) > 0 {
+		f = appendBytes(f, 2, tags)
+	}
+	f = appendTag(f, 3, wireVarint)
+	f = appendVarint(f, uint64(typ))
+	f = appendBytes(f, 4, geometry)
+	l.features = appendBytes(l.features, 2, f)
+}
+
+func (l *layerBuilder) key(k string) uint32 {
+	idx, ok := l.keyIdx[k]
+	if !ok {
+		idx = uint32(len(l.keys))
+		l.keys = append(l.keys, k)
+		l.keyIdx[k] = idx
+	}
+	return idx
+}
+
+func (l *layerBuilder) value(v interface{}) (uint32, bool) {
+	if idx, ok := l.valueIdx[v]; ok {
+		return idx, true
+	}
+	var b []byte
+	switch v := v.(type) {
+	case string:
+		b = appendBytes(b, 1, []byte(v))
+	case float64:
+		b = appendTag(b, 3, wireFixed64)
+		bits := math.Float64bits(v)
+		for i := uint(0); i < 64; i += 8 {
+			b = append(b, byte(bits>>i))
+		}
+	case int64:
+		if v >= 0 {
+			b = appendTag(b, 5, wireVarint)
+			b = appendVarint(b, uint64(v))
+		} else {
+			b = appendTag(b, 6, wireVarint)
+			b = appendVarint(b, uint64((v<<1)^(v>>63)))
+		}
+	case bool:
+		b = appendTag(b, 7, wireVarint)
+		if v {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+	default:
+		return 0, false
+	}
+	idx := uint32(len(l.values))
+	l.values = append(l.values, b)
+	l.valueIdx[v] = idx
+	return idx, true
+}
+
+func (l *layerBuilder) encode() []byte {
+	var b []byte
+	b = appendTag(b, 15, wireVarint)
+	b = appendVarint(b, 2)
+	b = appendBytes(b, 1, []byte(l.name))
+	b = append(b, l.features...)
+	for _, k := range l.keys {
+		b = appendBytes(b, 3, []byte(k))
+	}
+	for _, v := range l.values {
+		b = appendBytes(b, 4, v)
+	}
+	b = appendTag(b, 5, wireVarint)
+	return appendVarint(b, extent)
+}
+
+// encodeTile returns the vector tile with all layers.
+func encodeTile(layers []*layerBuilder) []byte {
+	var b []byte
+	for _, l := range layers {
+		b = appendBytes(b, 3, l.encode())
+	}
+	return b
+}
@@ -0,0 +1,194 @@
+package postgis
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/omniscale/imposm3/log"
+	"github.com/pkg/errors"
+)
+
+// defaultCopyChunkRetries is the number of retries of a failed chunk if
+// copychunkretries is not set.
+const defaultCopyChunkRetries = 5
+
+// chunkLoop copies the rows in chunks of copyChunkSize, each in a separate
+// transaction.
+func (tt *bulkTableTx) chunkLoop() {
+	defer tt.wg.Done()
+	for row := range tt.rows {
+		tt.chunk = append(tt.chunk, row)
+		if len(tt.chunk) < tt.Pg.copyChunkSize {
+			continue
+		}
+		if err := tt.copyChunk(); err != nil {
+			log.Fatalf("[fatal] bulk insert into %q: %s", tt.Table, err)
+		}
+	}
+	if len(tt.chunk) > 0 {
+		if err := tt.copyChunk(); err != nil {
+			log.Fatalf("[fatal] bulk insert into %q: %s", tt.Table, err)
+		}
+	}
+}
+
+// copyChunk copies and commits all rows of the chunk. The chunk is copied
+// again with a new connection if the transaction failed with a transient
+// error (e.g. lost connection or deadlock). All previous chunks are already
+// committed and only the rows of this chunk are lost with the transaction.
+// The COMMIT itself can fail after the server committed the chunk, so the
+// chunk is only copied again if its last transaction was not committed.
+func (tt *bulkTableTx) copyChunk() error {
+	defer func() { tt.chunk = tt.chunk[:0] }()
+	tt.chunkTxid = 0
+	copied, rejected := tt.copied, tt.rejected
+	delay := time.Second
+	for i := 0; ; i++ {
+		committed, err := tt.chunkCommitted()
+		if err == nil && committed {
+			log.Printf("[warn] COPY of %d rows into %q was committed before the connection was lost, not copying them again",
+				len(tt.chunk), tt.Table)
+			if !tt.Pg.copyRetry {
+				tt.copied += int64(len(tt.chunk))
+			}
+			return nil
+		}
+		if err == nil {
+			// counted rows of copyretry were rolled back
+			tt.copied, tt.rejected = copied, rejected
+			err = tt.copyChunkTx()
+			if err == nil {
+				if !tt.Pg.copyRetry {
+					tt.copied += int64(len(tt.chunk))
+				}
+				return nil
+			}
+			if i >= tt.Pg.copyChunkRetries || !isTransientError(err) {
+				return &SQLError{tt.InsertSQL, err}
+			}
+		} else if i >= tt.Pg.copyChunkRetries || !isTransientError(err) {
+			return err
+		}
+		tt.retriedChunks++
+		log.Printf("[warn] COPY of %d rows into %q failed, retrying in %s (%d/%d): %s",
+			len(tt.chunk), tt.Table, delay, i+1, tt.Pg.copyChunkRetries, err)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxConnectDelay {
+			delay = maxConnectDelay
+		}
+	}
+}
+
+// errChunkInProgress is returned by chunkCommitted if the server did not
+// finish the transaction of the chunk yet.
+var errChunkInProgress = errors.New("transaction of the failed chunk is still in progress")
+
+// chunkCommitted returns whether the last transaction of the chunk was
+// committed. Returns false if there was no transaction yet.
+func (tt *bulkTableTx) chunkCommitted() (bool, error) {
+	if tt.chunkTxid == 0 {
+		return false, nil
+	}
+	var status sql.NullString
+	if err := tt.Pg.Db.QueryRow("SELECT txid_status($1)", tt.chunkTxid).Scan(&status); err != nil {
+		return false, errors.Wrap(err, "checking the commit of the failed chunk")
+	}
+	switch status.String {
+	case "committed":
+		return true, nil
+	case "aborted":
+		return false, nil
+	case "in progress":
+		return false, errChunkInProgress
+	}
+	return false, errors.Errorf("status of transaction %d of the failed chunk is unknown, use -resume to write %q again",
+		tt.chunkTxid, tt.Table)
+}
+
+// copyChunkTx copies the rows of the chunk within a new transaction.
+func (tt *bulkTableTx) copyChunkTx() (err error) {
+	tt.Tx, err = tt.Pg.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tt.Tx != nil {
+			// the connection might be lost already
+			tt.Tx.Rollback()
+			tt.Tx = nil
+		}
+	}()
+	// the ID of the transaction is required to check the commit after a
+	// lost connection, see chunkCommitted
+	if err := tt.Tx.QueryRow("SELECT txid_current()").Scan(&tt.chunkTxid); err != nil {
+		return err
+	}
+
+	// Commits use synchronous_commit, as committed chunks are not copied
+	// again if the server crashes.
+	if tt.Pg.copyRetry {
+		// statements are prepared for each transaction
+		tt.retryStmt, tt.rejectStmt = nil, nil
+		for i := 0; i < len(tt.chunk); i += copyBatchSize {
+			end := i + copyBatchSize
+			if end > len(tt.chunk) {
+				end = len(tt.chunk)
+			}
+			tt.batch = append(tt.batch[:0], tt.chunk[i:end]...)
+			if err := tt.copyBatch(); err != nil {
+				return err
+			}
+		}
+	} else {
+		stmt, err := tt.Tx.Prepare(tt.InsertSQL)
+		if err != nil {
+			return err
+		}
+		for _, row := range tt.chunk {
+			if _, err := stmt.Exec(row...); err != nil {
+				stmt.Close()
+				return err
+			}
+		}
+		// finish COPY
+		if _, err := stmt.Exec(); err != nil {
+			stmt.Close()
+			return err
+		}
+		stmt.Close()
+	}
+
+	err = tt.Tx.Commit()
+	tt.Tx = nil
+	return err
+}
+
+// isTransientError returns whether a failed transaction can succeed if it
+// is repeated.
+func isTransientError(err error) bool {
+	switch err := errors.Cause(err).(type) {
+	case *pq.Error:
+		switch err.Code.Class() {
+		case "08", // connection exception
+			"53": // insufficient resources (e.g. out_of_memory)
+			return true
+		}
+		switch err.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03": // cannot_connect_now
+			return true
+		}
+		return false
+	case net.Error:
+		return true
+	}
+	err = errors.Cause(err)
+	return err == errChunkInProgress || err == driver.ErrBadConn || err == io.EOF || err == io.ErrUnexpectedEOF
+}
@@ -44,8 +44,8 @@ func (t *geometryType) PrepareInsertSQL(i int, spec *TableSpec) string {
 }
 
 func (t *geometryType) GeneralizeSQL(colSpec *ColumnSpec, spec *GeneralizedTableSpec) string {
-	return fmt.Sprintf(`ST_SimplifyPreserveTopology("%s", %f) as "%s"`,
-		colSpec.Name, spec.Tolerance, colSpec.Name,
+	return fmt.Sprintf(`%s as "%s"`,
+		spec.simplifySQL(`"`+colSpec.Name+`"`), colSpec.Name,
 	)
 }
 
@@ -58,23 +58,40 @@ func (t *validatedGeometryType) GeneralizeSQL(colSpec *ColumnSpec, spec *General
 		// TODO return warning earlier
 		log.Printf("[warn] validated_geometry column returns polygon geometries for %s", spec.FullName)
 	}
-	return fmt.Sprintf(`ST_Buffer(ST_SimplifyPreserveTopology("%s", %f), 0) as "%s"`,
-		colSpec.Name, spec.Tolerance, colSpec.Name,
+	return fmt.Sprintf(`ST_Buffer(%s, 0) as "%s"`,
+		spec.simplifySQL(`"`+colSpec.Name+`"`), colSpec.Name,
 	)
 }
 
+// extraGeometryType is for additional geometry columns (e.g. centroids or
+// simplified geometries). geomType is the PostGIS geometry type, the type
+// of the table is used if it is empty.
+type extraGeometryType struct {
+	geometryType
+	geomType string
+}
+
+func (t *extraGeometryType) GeneralizeSQL(colSpec *ColumnSpec, spec *GeneralizedTableSpec) string {
+	return "\"" + colSpec.Name + "\""
+}
+
 var pgTypes map[string]ColumnType
 
 func init() {
 	pgTypes = map[string]ColumnType{
-		"string":             &simpleColumnType{"VARCHAR"},
-		"bool":               &simpleColumnType{"BOOL"},
-		"int8":               &simpleColumnType{"SMALLINT"},
-		"int32":              &simpleColumnType{"INT"},
-		"int64":              &simpleColumnType{"BIGINT"},
-		"float32":            &simpleColumnType{"REAL"},
-		"hstore_string":      &simpleColumnType{"HSTORE"},
-		"geometry":           &geometryType{"GEOMETRY"},
-		"validated_geometry": &validatedGeometryType{geometryType{"GEOMETRY"}},
+		"string":              &simpleColumnType{"VARCHAR"},
+		"bool":                &simpleColumnType{"BOOL"},
+		"int8":                &simpleColumnType{"SMALLINT"},
+		"int32":               &simpleColumnType{"INT"},
+		"int64":               &simpleColumnType{"BIGINT"},
+		"float32":             &simpleColumnType{"REAL"},
+		"hstore_string":       &simpleColumnType{"HSTORE"},
+		"string_array":        &simpleColumnType{"TEXT[]"},
+		"timestamp":           &simpleColumnType{"TIMESTAMP WITH TIME ZONE"},
+		"date":                &simpleColumnType{"DATE"},
+		"geometry":            &geometryType{"GEOMETRY"},
+		"validated_geometry":  &validatedGeometryType{geometryType{"GEOMETRY"}},
+		"point_geometry":      &extraGeometryType{geometryType{"GEOMETRY"}, "POINT"},
+		"simplified_geometry": &extraGeometryType{geometryType{"GEOMETRY"}, ""},
 	}
 }
@@ -0,0 +1,160 @@
+package postgis
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/omniscale/imposm3/log"
+	"github.com/pkg/errors"
+)
+
+// defaultKeepAlive is the interval of the TCP keepalive probes. Without
+// probes, firewalls and NAT gateways can drop the connections of long
+// running statements (e.g. CREATE INDEX) without notice.
+const defaultKeepAlive = 60 * time.Second
+
+// maxConnectDelay is the max wait time between two connection attempts.
+const maxConnectDelay = 60 * time.Second
+
+type poolOptions struct {
+	// maxConnections limits the number of open connections, 0 for no limit
+	maxConnections int
+	// keepAlive is the TCP keepalive interval, negative to disable probes
+	keepAlive time.Duration
+	// connectRetries is the number of retries for failed connections
+	connectRetries int
+}
+
+// dialer creates the TCP connections for lib/pq with keepalive probes.
+// Connecting is aborted when ctx is done.
+type dialer struct {
+	keepAlive time.Duration
+	ctx       context.Context
+}
+
+func (d dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialTimeout(network, address, 0)
+}
+
+func (d dialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx := d.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	nd := net.Dialer{Timeout: timeout, KeepAlive: d.keepAlive}
+	return nd.DialContext(ctx, network, address)
+}
+
+// connector opens new connections for the connection pool of database/sql.
+// Failed attempts are retried with an increasing delay, so that a restart
+// of the database server does not abort a long import.
+type connector struct {
+	params  string
+	dialer  dialer
+	retries int
+	// delay is the wait time before the first retry, one second if 0
+	delay time.Duration
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	delay := c.delay
+	if delay == 0 {
+		delay = time.Second
+	}
+	d := c.dialer
+	d.ctx = ctx
+	for i := 0; ; i++ {
+		conn, err := pq.DialOpen(d, c.params)
+		if err == nil || i >= c.retries || !isTransientConnectError(err) {
+			return conn, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("[warn] Connecting to PostgreSQL failed, retrying in %s (%d/%d): %s", delay, i+1, c.retries, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if delay *= 2; delay > maxConnectDelay {
+			delay = maxConnectDelay
+		}
+	}
+}
+
+func (c *connector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// isTransientConnectError returns whether a connection attempt can succeed
+// later. Errors from the server are permanent (e.g. failed authentication),
+// unless the server is starting up, shutting down or has too many clients.
+func isTransientConnectError(err error) bool {
+	if _, ok := err.(*pq.Error); !ok {
+		// network errors
+		return true
+	}
+	return isTransientError(err)
+}
+
+// checkMaxConnections returns an error if maxconnections is too low for
+// -write. The bulk import keeps one transaction open for each table till
+// the end and waiting for more connections would block forever. Additional
+// COPY connections are limited by limitCopyConnections.
+func (pg *PostGIS) checkMaxConnections() error {
+	if pg.pool.maxConnections == 0 {
+		return nil
+	}
+	// one more for the statements outside of the COPY transactions
+	required := len(pg.Tables) + 1
+	if pg.pool.maxConnections < required {
+		return errors.Errorf("maxconnections=%d is too low, imports of this mapping require at least %d connections",
+			pg.pool.maxConnections, required)
+	}
+	return nil
+}
+
+// limitCopyConnections limits copyconnections to the connections that are
+// available for COPY, so that the total number of connections is bound by
+// maxconnections and by the free connections of the server
+// (max_connections without the reserved and the open connections). Each
+// table still gets one connection.
+func (pg *PostGIS) limitCopyConnections() error {
+	if pg.copyConnections <= len(pg.Tables) {
+		return nil
+	}
+	var free int
+	sql := `SELECT current_setting('max_connections')::int
+		- current_setting('superuser_reserved_connections')::int
+		- (SELECT count(*) FROM pg_stat_activity)::int`
+	if err := pg.Db.QueryRow(sql).Scan(&free); err != nil {
+		return &SQLError{sql, err}
+	}
+	if limit := copyConnectionsLimit(pg.copyConnections, len(pg.Tables), pg.pool.maxConnections, free); limit < pg.copyConnections {
+		log.Printf("[warn] Limiting copyconnections from %d to %d available connections", pg.copyConnections, limit)
+		pg.copyConnections = limit
+	}
+	return nil
+}
+
+// copyConnectionsLimit returns the number of COPY connections for the
+// requested copyconnections, limited by maxconnections (0 for no limit)
+// and the free connections of the server, but at least one for each table.
+func copyConnectionsLimit(requested, tables, maxConnections, free int) int {
+	limit := requested
+	if maxConnections > 0 && maxConnections-1 < limit {
+		// one for the statements outside of the COPY transactions
+		limit = maxConnections - 1
+	}
+	if free < limit {
+		limit = free
+	}
+	if limit < tables {
+		limit = tables
+	}
+	return limit
+}
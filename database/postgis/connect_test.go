@@ -0,0 +1,215 @@
+package postgis
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCopyConnectionsLimit(t *testing.T) {
+	for _, tt := range []struct {
+		requested, tables, maxConnections, free int
+		expected                                int
+	}{
+		{16, 4, 0, 100, 16},
+		{16, 4, 10, 100, 9},
+		{16, 4, 0, 12, 12},
+		{16, 4, 10, 5, 5},
+		// one connection for each table
+		{16, 4, 0, 2, 4},
+		{16, 4, 0, -3, 4},
+	} {
+		if limit := copyConnectionsLimit(tt.requested, tt.tables, tt.maxConnections, tt.free); limit != tt.expected {
+			t.Errorf("%v: unexpected limit %d", tt, limit)
+		}
+	}
+}
+
+func TestTablePrefix(t *testing.T) {
+	for _, tt := range []struct {
+		connection string
+		expected   string
+	}{
+		{"postgis://localhost/osm", "osm_"},
+		{"postgis://localhost/osm?prefix=my_osm", "my_osm_"},
+		{"postgis://localhost/osm?prefix=my_osm_", "my_osm_"},
+		{"postgis://localhost/osm?prefix=NONE", ""},
+		{"postgres: host=localhost prefix=planet", "planet_"},
+		{"file:///tmp/export?format=geojson", ""},
+	} {
+		prefix, err := TablePrefix(tt.connection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prefix != tt.expected {
+			t.Errorf("%s: unexpected prefix %q", tt.connection, prefix)
+		}
+	}
+}
+
+func TestStripPoolFromConnectionParams(t *testing.T) {
+	for _, tt := range []struct {
+		params   string
+		expected poolOptions
+		rest     string
+		err      bool
+	}{
+		{"host=localhost", poolOptions{keepAlive: defaultKeepAlive}, "host=localhost", false},
+		{"host=localhost maxconnections=20 keepalive=30s connectretries=5",
+			poolOptions{maxConnections: 20, keepAlive: 30 * time.Second, connectRetries: 5}, "host=localhost", false},
+		{"keepalive=0 host=localhost", poolOptions{keepAlive: -1}, "host=localhost", false},
+		{"maxconnections=-1", poolOptions{}, "", true},
+		{"keepalive=30", poolOptions{}, "", true},
+		{"connectretries=many", poolOptions{}, "", true},
+	} {
+		rest, opts, err := stripPoolFromConnectionParams(tt.params)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.params)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts != tt.expected || rest != tt.rest {
+			t.Errorf("%s: unexpected options %+v %q", tt.params, opts, rest)
+		}
+	}
+}
+
+// testServer accepts connections and handles each with handle. It returns
+// the connection parameters for lib/pq, the number of accepted connections
+// and the listener to close.
+func testServer(t *testing.T, handle func(net.Conn)) (string, *int32, net.Listener) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var accepted int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+	return fmt.Sprintf("host=127.0.0.1 port=%d user=osm sslmode=disable", addr.Port), &accepted, l
+}
+
+// rejectStartup reads the startup message and responds with an
+// ErrorResponse with the SQLSTATE code.
+func rejectStartup(code string) func(net.Conn) {
+	return func(conn net.Conn) {
+		var size int32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if _, err := io.CopyN(ioutil.Discard, conn, int64(size-4)); err != nil {
+			return
+		}
+		fields := "SFATAL\x00C" + code + "\x00Mrejected\x00\x00"
+		msg := []byte{'E', 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(msg[1:], uint32(len(fields)+4))
+		conn.Write(append(msg, fields...))
+	}
+}
+
+func TestConnectorRetries(t *testing.T) {
+	// connections are closed without response
+	params, accepted, l := testServer(t, func(net.Conn) {})
+	defer l.Close()
+	c := &connector{params: params, retries: 2, delay: time.Millisecond}
+	if _, err := c.Connect(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	if n := atomic.LoadInt32(accepted); n != 3 {
+		t.Errorf("expected 3 connection attempts, got %d", n)
+	}
+
+	// server is starting up
+	params, accepted, l = testServer(t, rejectStartup("57P03"))
+	defer l.Close()
+	c = &connector{params: params, retries: 1, delay: time.Millisecond}
+	if _, err := c.Connect(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	if n := atomic.LoadInt32(accepted); n != 2 {
+		t.Errorf("expected 2 connection attempts, got %d", n)
+	}
+}
+
+func TestConnectorPermanentError(t *testing.T) {
+	// invalid password
+	params, accepted, l := testServer(t, rejectStartup("28P01"))
+	defer l.Close()
+	c := &connector{params: params, retries: 5, delay: time.Millisecond}
+	if _, err := c.Connect(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	if n := atomic.LoadInt32(accepted); n != 1 {
+		t.Errorf("expected 1 connection attempt, got %d", n)
+	}
+}
+
+func TestConnectorCancel(t *testing.T) {
+	params, _, l := testServer(t, func(net.Conn) {})
+	defer l.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := &connector{params: params, retries: 10, delay: time.Minute}
+	start := time.Now()
+	if _, err := c.Connect(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("connector did not stop after cancel")
+	}
+}
+
+func TestDialerKeepAlive(t *testing.T) {
+	_, _, l := testServer(t, func(conn net.Conn) { io.Copy(ioutil.Discard, conn) })
+	defer l.Close()
+
+	for _, tt := range []struct {
+		keepAlive time.Duration
+		expected  bool
+	}{
+		{defaultKeepAlive, true},
+		{-1, false},
+	} {
+		conn, err := dialer{keepAlive: tt.keepAlive}.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := conn.(*net.TCPConn).SyscallConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var enabled int
+		raw.Control(func(fd uintptr) {
+			enabled, err = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_KEEPALIVE)
+		})
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (enabled != 0) != tt.expected {
+			t.Errorf("keepalive %s: unexpected SO_KEEPALIVE %d", tt.keepAlive, enabled)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package postgis
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	pq "github.com/lib/pq"
+	"github.com/omniscale/imposm3/element"
+	"github.com/omniscale/imposm3/log"
+)
+
+// elementsTable is the name (without prefix) of the table with the ID,
+// the type and the last sequence of all imported elements. The id columns
+// of the tables of the mapping reference it with a deferred foreign key.
+const elementsTable = "elements"
+
+// elementTypeSQL returns the element type of the mangled ID of a single ID
+// space (see mapping.SingleIDSpace).
+func elementTypeSQL(col string) string {
+	return fmt.Sprintf(`CASE WHEN %[1]s >= 0 THEN 'node' WHEN %[1]s > %[2]d THEN 'way' ELSE 'relation' END`,
+		col, int64(element.RelIDOffset))
+}
+
+// createElementsTable (re)creates the elements table with the IDs of all
+// tables and adds the foreign keys of the tables. Called after a full
+// import.
+func (pg *PostGIS) createElementsTable() error {
+	defer log.Step("Creating elements table")()
+	tx, err := pg.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollbackIfTx(&tx)
+
+	schema := pg.Config.ImportSchema
+	elementsName := pg.Prefix + elementsTable
+	if err := dropElementsTableIfExists(tx, schema, elementsName); err != nil {
+		return err
+	}
+	sql := fmt.Sprintf(`CREATE TABLE "%s"."%s" (
+		id BIGINT NOT NULL,
+		type TEXT NOT NULL,
+		deleted BOOL NOT NULL DEFAULT false,
+		last_sequence BIGINT
+	)`, schema, elementsName)
+	if _, err := tx.Exec(sql); err != nil {
+		return &SQLError{sql, err}
+	}
+
+	names := make([]string, 0, len(pg.Tables))
+	for name := range pg.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ids := []string{}
+	refs := []*TableSpec{}
+	for _, name := range names {
+		spec := pg.Tables[name]
+		idx := spec.idColumn()
+		if idx < 0 {
+			continue
+		}
+		ids = append(ids, fmt.Sprintf(`SELECT "%s" AS id FROM "%s"."%s"`,
+			spec.Columns[idx].Name, schema, spec.FullName))
+		refs = append(refs, spec)
+	}
+	if len(ids) > 0 {
+		sql = fmt.Sprintf(`INSERT INTO "%s"."%s" (id, type) SELECT id, %s FROM (%s) AS ids`,
+			schema, elementsName, elementTypeSQL("id"), strings.Join(ids, " UNION "))
+		if _, err := tx.Exec(sql); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+	sql = fmt.Sprintf(`ALTER TABLE "%s"."%s" ADD PRIMARY KEY (id)`, schema, elementsName)
+	if _, err := tx.Exec(sql); err != nil {
+		return &SQLError{sql, err}
+	}
+	// Deferred, as diff imports insert the rows of the tables before the
+	// elements.
+	for _, spec := range refs {
+		sql = fmt.Sprintf(`ALTER TABLE "%s"."%s" ADD CONSTRAINT "%s_elements_fkey"
+			FOREIGN KEY ("%s") REFERENCES "%s"."%s" (id) DEFERRABLE INITIALLY DEFERRED`,
+			schema, spec.FullName, spec.FullName, spec.Columns[spec.idColumn()].Name, schema, elementsName)
+		if _, err := tx.Exec(sql); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	tx = nil // set nil to prevent rollback
+	return nil
+}
+
+// dropElementsTableIfExists drops the elements table, after dropping the
+// foreign keys of all tables that reference it.
+func dropElementsTableIfExists(tx *sql.Tx, schema, table string) error {
+	exists, err := tableExists(tx, schema, table)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	stmt := `SELECT conrelid::regclass::text, conname FROM pg_constraint
+		WHERE contype = 'f' AND confrelid = to_regclass($1)`
+	rows, err := tx.Query(stmt, fmt.Sprintf(`"%s"."%s"`, schema, table))
+	if err != nil {
+		return &SQLError{stmt, err}
+	}
+	var constraints [][2]string
+	for rows.Next() {
+		var rel, name string
+		if err := rows.Scan(&rel, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		constraints = append(constraints, [2]string{rel, name})
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for _, c := range constraints {
+		stmt = fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT "%s"`, c[0], c[1])
+		if _, err := tx.Exec(stmt); err != nil {
+			return &SQLError{stmt, err}
+		}
+	}
+	return dropTableIfExists(tx, schema, table)
+}
+
+// beginElementUpdates enables the updates of the elements table for a diff
+// import, if the table exists.
+func (pg *PostGIS) beginElementUpdates() error {
+	pg.elementUpdates = nil
+	exists, err := tableExists(pg.txRouter.tx, pg.Config.ImportSchema, pg.Prefix+elementsTable)
+	if err != nil {
+		return err
+	}
+	if exists {
+		pg.elementUpdates = make(map[int64]bool)
+	}
+	return nil
+}
+
+// markElement records an inserted or deleted element for the elements
+// table. An element that is deleted and inserted again (i.e. modified) is
+// not deleted.
+func (pg *PostGIS) markElement(id int64, deleted bool) {
+	if pg.elementUpdates == nil {
+		return
+	}
+	pg.elementUpdatesMu.Lock()
+	pg.elementUpdates[id] = deleted
+	pg.elementUpdatesMu.Unlock()
+}
+
+// updateElementsTable inserts or updates all marked elements within the
+// transaction of the diff import. Deleted elements are kept with deleted
+// set, so that their last sequence is still known.
+func (pg *PostGIS) updateElementsTable() error {
+	if len(pg.elementUpdates) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(pg.elementUpdates))
+	deleted := make([]bool, 0, len(pg.elementUpdates))
+	for id, del := range pg.elementUpdates {
+		ids = append(ids, id)
+		deleted = append(deleted, del)
+	}
+	var seq interface{}
+	if pg.sequence != 0 {
+		seq = pg.sequence
+	}
+	sql := fmt.Sprintf(`INSERT INTO "%s"."%s" (id, type, deleted, last_sequence)
+		SELECT id, %s, deleted, $3 FROM unnest($1::BIGINT[], $2::BOOL[]) AS e(id, deleted)
+		ON CONFLICT (id) DO UPDATE SET deleted = excluded.deleted, last_sequence = excluded.last_sequence`,
+		pg.Config.ImportSchema, pg.Prefix+elementsTable, elementTypeSQL("id"))
+	if _, err := pg.txRouter.tx.Exec(sql, pq.Array(ids), pq.Array(deleted), seq); err != nil {
+		return &SQLError{sql, err}
+	}
+	pg.elementUpdates = make(map[int64]bool)
+	return nil
+}
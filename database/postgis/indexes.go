@@ -0,0 +1,46 @@
+package postgis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/omniscale/imposm3/log"
+)
+
+// CreateSQL returns the statement to create the index on the table in
+// schema, if it does not exist.
+func (idx *IndexSpec) CreateSQL(schema string, spec *TableSpec) string {
+	sql := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "%s" ON "%s"."%s" USING %s ("%s")%s`,
+		idx.FullName, schema, spec.FullName, strings.ToUpper(idx.Method),
+		strings.Join(idx.Columns, `", "`), spec.indexTablespaceSQL())
+	if idx.Where != "" {
+		sql += " WHERE " + idx.Where
+	}
+	return sql
+}
+
+// createCustomIndexes creates the indexes from the mapping that do not
+// exist. Missing tables (e.g. after partial imports) are skipped.
+func createCustomIndexes(pg *PostGIS, spec *TableSpec) error {
+	if len(spec.Indexes) == 0 {
+		return nil
+	}
+	exists, err := tableExists(pg.Db, pg.Config.ImportSchema, spec.FullName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		log.Printf("[warn] skipping indexes of %s, table does not exist in %s", spec.FullName, pg.Config.ImportSchema)
+		return nil
+	}
+	for _, idx := range spec.Indexes {
+		sql := idx.CreateSQL(pg.Config.ImportSchema, spec)
+		step := log.Step(fmt.Sprintf("Creating index %s on %s", idx.FullName, spec.FullName))
+		_, err := pg.Db.Exec(sql)
+		step()
+		if err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+	return nil
+}
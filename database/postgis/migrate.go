@@ -0,0 +1,275 @@
+package postgis
+
+import (
+	"fmt"
+
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
+)
+
+// MigrationSQL returns the SQL statements to migrate the tables of an
+// existing import in schema from the old to the new mapping of the diff.
+// Changes that can not be migrated (e.g. new tables or changed filters)
+// are returned as SQL comments. prefix is the table prefix, as in the
+// connection parameters. Type changes of columns that can lose values
+// (e.g. from string to integer) are refused, unless lossyCasts is true.
+func MigrationSQL(diff mapping.MappingDiff, newConf *config.Mapping, schema, prefix string, srid int, lossyCasts bool) ([]string, error) {
+	pg := &PostGIS{
+		Config:            database.Config{ImportSchema: schema, Srid: srid},
+		Tables:            make(map[string]*TableSpec),
+		GeneralizedTables: make(map[string]*GeneralizedTableSpec),
+	}
+	_, pg.Prefix = stripPrefixFromConnectionParams("prefix=" + prefix)
+
+	// specs of all tables, for the generalized tables
+	for name, table := range newConf.Tables {
+		spec, err := NewTableSpec(pg, table)
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating table spec for %q", name)
+		}
+		pg.Tables[name] = spec
+	}
+	for name, table := range newConf.GeneralizedTables {
+		pg.GeneralizedTables[name] = NewGeneralizedTableSpec(pg, table)
+	}
+	var err error
+	pg.generalizedOrder, err = mapping.SortedGeneralizedTables(newConf)
+	if err != nil {
+		return nil, err
+	}
+	if err := pg.prepareGeneralizedTableSources(); err != nil {
+		return nil, err
+	}
+
+	if diff.Empty() {
+		return []string{"-- mappings are equal"}, nil
+	}
+
+	stmts := []string{"BEGIN;"}
+	comment := func(format string, args ...interface{}) {
+		stmts = append(stmts, "-- "+fmt.Sprintf(format, args...))
+	}
+
+	for _, name := range diff.AddedTables {
+		spec, err := NewTableSpec(pg, newConf.Tables[name])
+		if err != nil {
+			return nil, err
+		}
+		comment("new table %s, rows are only inserted by the next import", spec.FullName)
+		// tables are only unlogged during the import
+		spec.Unlogged = false
+		stmts = append(stmts, spec.CreateTableSQL())
+		for _, col := range spec.Columns {
+			if col.Type.Name() == "GEOMETRY" {
+				stmts = append(stmts, spec.addGeometryColumnSQL(spec.FullName, col))
+			}
+		}
+		for _, sql := range spec.ColumnStorageSQL() {
+			stmts = append(stmts, sql+";")
+		}
+		for _, sql := range spec.CommentSQL() {
+			stmts = append(stmts, sql+";")
+		}
+		if spec.Shard != nil {
+			for _, sql := range spec.CreatePartitionsSQL() {
+				stmts = append(stmts, sql+";")
+			}
+		}
+		for _, idx := range spec.Indexes {
+			stmts = append(stmts, idx.CreateSQL(schema, spec)+";")
+		}
+	}
+
+	for _, name := range diff.RemovedTables {
+		comment("removed table %s", pg.Prefix+name)
+		stmts = append(stmts, fmt.Sprintf(`DROP TABLE IF EXISTS "%s"."%s";`, schema, pg.Prefix+name))
+	}
+
+	// source tables of generalized tables that need to be generalized
+	// again, or that need to be imported again
+	changedSources := make(map[string]bool)
+	reimportSources := make(map[string]bool)
+	for _, td := range diff.ChangedTables {
+		spec := pg.Tables[td.Name]
+		tableName := spec.FullName
+		if td.TypeChanged {
+			comment("type of table %s changed, the table needs to be imported again", tableName)
+			reimportSources[td.Name] = true
+			continue
+		}
+		if td.PartitionsChanged {
+			comment("partitioning of table %s changed, the table needs to be imported again", tableName)
+			reimportSources[td.Name] = true
+			continue
+		}
+		if len(td.AddedColumns) > 0 || len(td.RemovedColumns) > 0 || len(td.ChangedColumns) > 0 || td.SridChanged {
+			changedSources[td.Name] = true
+		}
+		if td.MatchingChanged {
+			comment("mapping or filters of table %s changed, existing rows are not updated", tableName)
+		}
+		for _, idx := range td.RemovedIndexes {
+			comment("removed or changed index %s", pg.Prefix+idx.Name)
+			stmts = append(stmts, fmt.Sprintf(`DROP INDEX IF EXISTS "%s"."%s";`, schema, pg.Prefix+idx.Name))
+		}
+		for _, c := range td.RemovedColumns {
+			comment("removed column %s.%s", tableName, c.Name)
+			stmts = append(stmts, fmt.Sprintf(`ALTER TABLE "%s"."%s" DROP COLUMN IF EXISTS "%s";`,
+				schema, tableName, c.Name))
+		}
+		for _, c := range td.AddedColumns {
+			col, err := specColumn(spec, c.Name)
+			if err != nil {
+				return nil, err
+			}
+			comment("new column %s.%s, values are only set for inserted or modified elements", tableName, c.Name)
+			if col.Type.Name() == "GEOMETRY" {
+				stmts = append(stmts, spec.addGeometryColumnSQL(tableName, col))
+			} else {
+				stmts = append(stmts, fmt.Sprintf(`ALTER TABLE "%s"."%s" ADD COLUMN "%s" %s;`,
+					schema, tableName, c.Name, col.Type.Name()))
+			}
+			if col.Description != "" {
+				stmts = append(stmts, fmt.Sprintf(`COMMENT ON COLUMN "%s"."%s"."%s" IS %s;`,
+					schema, tableName, c.Name, quoteLiteral(col.Description)))
+			}
+		}
+		if td.SridChanged {
+			comment("srid of table %s changed, geometries are transformed", tableName)
+			for _, col := range spec.Columns {
+				if col.Type.Name() != "GEOMETRY" {
+					continue
+				}
+				stmts = append(stmts, fmt.Sprintf(`ALTER TABLE "%s"."%s" ALTER COLUMN "%s" TYPE geometry(%s, %d) USING ST_Transform("%s", %d);`,
+					schema, tableName, col.Name, spec.geometryType(col), spec.Srid, col.Name, spec.Srid))
+			}
+		}
+		if td.StorageChanged {
+			comment("tablespace or fillfactor of table %s changed", tableName)
+			for _, sql := range spec.alterStorageSQL(schema) {
+				stmts = append(stmts, sql+";")
+			}
+		}
+		if td.CommentsChanged {
+			comment("descriptions of table %s changed", tableName)
+			stmts = append(stmts, fmt.Sprintf(`COMMENT ON TABLE "%s"."%s" IS %s;`,
+				schema, tableName, commentLiteral(spec.Description)))
+			for _, col := range spec.Columns {
+				stmts = append(stmts, fmt.Sprintf(`COMMENT ON COLUMN "%s"."%s"."%s" IS %s;`,
+					schema, tableName, col.Name, commentLiteral(col.Description)))
+			}
+		}
+		for _, c := range td.ChangedColumns {
+			col, err := specColumn(spec, c.New.Name)
+			if err != nil {
+				return nil, err
+			}
+			oldType, err := mapping.MakeColumnType(c.Old)
+			if err != nil {
+				return nil, err
+			}
+			oldPgType, ok := pgTypes[oldType.GoType]
+			if ok && oldPgType.Name() != col.Type.Name() && col.Type.Name() != "GEOMETRY" {
+				if !lossyCasts && !losslessCast(oldPgType.Name(), col.Type.Name()) {
+					return nil, errors.Errorf("type of column %s.%s changed from %s to %s, this can lose values of existing rows, use -allow-lossy-casts to convert them anyway",
+						tableName, c.New.Name, oldPgType.Name(), col.Type.Name())
+				}
+				comment("type of column %s.%s changed, values of existing rows are converted", tableName, c.New.Name)
+				stmts = append(stmts, fmt.Sprintf(`ALTER TABLE "%s"."%s" ALTER COLUMN "%s" TYPE %s USING "%s"::%s;`,
+					schema, tableName, c.New.Name, col.Type.Name(), c.New.Name, col.Type.Name()))
+			} else {
+				comment("column %s.%s changed, values of existing rows are not updated", tableName, c.New.Name)
+			}
+		}
+		for _, idx := range td.AddedIndexes {
+			for _, is := range spec.Indexes {
+				if is.FullName == pg.Prefix+idx.Name {
+					comment("new or changed index %s", is.FullName)
+					stmts = append(stmts, is.CreateSQL(schema, spec)+";")
+				}
+			}
+		}
+	}
+
+	for _, name := range diff.RemovedGeneralizedTables {
+		comment("removed generalized table %s", pg.Prefix+name)
+		stmts = append(stmts, fmt.Sprintf(`DROP TABLE IF EXISTS "%s"."%s";`, schema, pg.Prefix+name))
+	}
+
+	// generalized tables are created again from their (migrated) source,
+	// sources are before the generalized tables in generalizedOrder
+	regeneralize := make(map[string]bool)
+	for _, name := range diff.AddedGeneralizedTables {
+		regeneralize[name] = true
+	}
+	for _, name := range diff.ChangedGeneralizedTables {
+		regeneralize[name] = true
+	}
+	for _, name := range pg.generalizedOrder {
+		table := pg.GeneralizedTables[name]
+		if reimportSources[table.Source.Name] {
+			comment("source of generalized table %s needs to be imported again", table.FullName)
+			continue
+		}
+		if !regeneralize[name] && !changedSources[table.SourceName] && !regeneralize[table.SourceName] {
+			continue
+		}
+		regeneralize[name] = true
+		comment("new or changed generalized table %s, or its source changed, the table is generalized again", table.FullName)
+		stmts = append(stmts, fmt.Sprintf(`DROP TABLE IF EXISTS "%s"."%s";`, schema, table.FullName))
+		stmts = append(stmts, fmt.Sprintf(`CREATE TABLE "%s"."%s" AS (%s);`, schema, table.FullName, table.SelectSQL()))
+		for _, sql := range table.CommentSQL() {
+			stmts = append(stmts, sql+";")
+		}
+		for _, idx := range indexSQL(schema, table.FullName, table.Columns(), true, "") {
+			stmts = append(stmts, idx.sql+";")
+		}
+		if table.Merge {
+			stmts = append(stmts, table.MergedIDsIndexSQL()+";")
+		}
+	}
+
+	stmts = append(stmts, "COMMIT;")
+	return stmts, nil
+}
+
+// commentLiteral returns the quoted description, or NULL to remove the
+// comment.
+func commentLiteral(description string) string {
+	if description == "" {
+		return "NULL"
+	}
+	return quoteLiteral(description)
+}
+
+func specColumn(spec *TableSpec, name string) (ColumnSpec, error) {
+	for _, col := range spec.Columns {
+		if col.Name == name {
+			return col, nil
+		}
+	}
+	return ColumnSpec{}, errors.Errorf("missing column %s in table %s", name, spec.FullName)
+}
+
+// losslessCasts are the type changes that keep all values.
+var losslessCasts = map[string][]string{
+	"SMALLINT": {"INT", "BIGINT", "REAL"},
+	"INT":      {"BIGINT"},
+	"DATE":     {"TIMESTAMP WITH TIME ZONE"},
+}
+
+// losslessCast returns whether all values of type from can be converted to
+// type to without losing values. All types can be converted to VARCHAR.
+func losslessCast(from, to string) bool {
+	if to == "VARCHAR" {
+		return true
+	}
+	for _, t := range losslessCasts[from] {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
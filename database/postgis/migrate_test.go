@@ -0,0 +1,112 @@
+package postgis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/omniscale/imposm3/mapping"
+)
+
+const migrateOldMapping = `
+tables:
+  roads:
+    type: linestring
+    columns:
+      - {name: osm_id, type: id}
+      - {name: geometry, type: geometry}
+      - {name: name, type: string, key: name}
+      - {name: lanes, type: string, key: lanes}
+    mapping:
+      highway: [__any__]
+generalized_tables:
+  roads_gen0:
+    source: roads
+    tolerance: 50
+  roads_gen1:
+    source: roads_gen0
+    tolerance: 200
+`
+
+func TestMigrationSQLGeneralizedTables(t *testing.T) {
+	old, err := mapping.New([]byte(migrateOldMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := mapping.New([]byte(strings.Replace(migrateOldMapping,
+		"- {name: lanes, type: string, key: lanes}",
+		"- {name: lanes, type: string, key: lanes}\n      - {name: ref, type: string, key: ref}", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := MigrationSQL(mapping.DiffMappings(old, new), &new.Conf, "public", "osm_", 3857, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := strings.Join(stmts, "\n")
+	for _, expected := range []string{
+		`ALTER TABLE "public"."osm_roads" ADD COLUMN "ref" VARCHAR;`,
+		`CREATE TABLE "public"."osm_roads_gen0" AS (`,
+		`CREATE TABLE "public"."osm_roads_gen1" AS (`,
+		`CREATE INDEX "osm_roads_gen1_geom" ON "public"."osm_roads_gen1" USING GIST ("geometry");`,
+	} {
+		if !strings.Contains(sql, expected) {
+			t.Errorf("missing %q in\n%s", expected, sql)
+		}
+	}
+	if strings.Index(sql, `"osm_roads_gen1" AS`) < strings.Index(sql, `"osm_roads_gen0" AS`) {
+		t.Error("roads_gen1 generalized before its source roads_gen0")
+	}
+}
+
+func TestMigrationSQLLossyCasts(t *testing.T) {
+	old, err := mapping.New([]byte(migrateOldMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := mapping.New([]byte(strings.Replace(migrateOldMapping,
+		"{name: lanes, type: string", "{name: lanes, type: integer", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := mapping.DiffMappings(old, new)
+	if _, err := MigrationSQL(diff, &new.Conf, "public", "osm_", 3857, false); err == nil {
+		t.Error("expected error for lossy cast from VARCHAR to INT")
+	}
+	stmts, err := MigrationSQL(diff, &new.Conf, "public", "osm_", 3857, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql := strings.Join(stmts, "\n"); !strings.Contains(sql, `ALTER COLUMN "lanes" TYPE INT USING "lanes"::INT;`) {
+		t.Errorf("missing cast in\n%s", sql)
+	}
+
+	// reversed, integer to string keeps all values
+	diff = mapping.DiffMappings(new, old)
+	if _, err := MigrationSQL(diff, &old.Conf, "public", "osm_", 3857, false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrationSQLGeneralizedTableSrid(t *testing.T) {
+	old, err := mapping.New([]byte(strings.Replace(migrateOldMapping,
+		"    type: linestring\n", "    type: linestring\n    srid: 4326\n", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := mapping.New([]byte(strings.Replace(migrateOldMapping,
+		"    type: linestring\n", "    type: linestring\n    srid: 4326\n", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new.Conf.GeneralizedTables["roads_gen0"].Tolerance = 100
+	stmts, err := MigrationSQL(mapping.DiffMappings(old, new), &new.Conf, "public", "osm_", 3857, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := strings.Join(stmts, "\n")
+	// tolerance is in the unit of the import SRID
+	expected := `ST_Transform(ST_SimplifyPreserveTopology(ST_Transform("geometry", 3857), 100.000000), 4326) as "geometry"`
+	if !strings.Contains(sql, expected) {
+		t.Errorf("missing %q in\n%s", expected, sql)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"runtime"
 	"strings"
 	"sync"
-	"sync/atomic"
 
 	pq "github.com/lib/pq"
 	osm "github.com/omniscale/go-osm"
@@ -27,6 +26,11 @@ func (e *SQLError) Error() string {
 	return fmt.Sprintf("SQL Error: %s in query %s", e.originalError.Error(), e.query)
 }
 
+// Cause returns the error of the database driver, see errors.Cause.
+func (e *SQLError) Cause() error {
+	return e.originalError
+}
+
 type SQLInsertError struct {
 	SQLError
 	data interface{}
@@ -55,35 +59,63 @@ func createTable(tx *sql.Tx, spec TableSpec) error {
 	if err != nil {
 		return err
 	}
+
+	for _, sql := range spec.ColumnStorageSQL() {
+		_, err = tx.Exec(sql)
+		if err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+
+	for _, sql := range spec.CommentSQL() {
+		_, err = tx.Exec(sql)
+		if err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+
+	if spec.Shard != nil {
+		for _, sql := range spec.CreatePartitionsSQL() {
+			_, err = tx.Exec(sql)
+			if err != nil {
+				return &SQLError{sql, err}
+			}
+		}
+	}
 	return nil
 }
 
 func addGeometryColumn(tx *sql.Tx, tableName string, spec TableSpec) error {
-	colName := ""
 	for _, col := range spec.Columns {
-		if col.Type.Name() == "GEOMETRY" {
-			colName = col.Name
-			break
+		if col.Type.Name() != "GEOMETRY" {
+			continue
+		}
+		sql := spec.addGeometryColumnSQL(tableName, col)
+		row := tx.QueryRow(sql)
+		var void interface{}
+		err := row.Scan(&void)
+		if err != nil {
+			return &SQLError{sql, err}
 		}
 	}
+	return nil
+}
 
-	if colName == "" {
-		return nil
-	}
+func (spec *TableSpec) addGeometryColumnSQL(tableName string, col ColumnSpec) string {
+	return fmt.Sprintf("SELECT AddGeometryColumn('%s', '%s', '%s', '%d', '%s', 2);",
+		spec.Schema, tableName, col.Name, spec.Srid, spec.geometryType(col))
+}
 
+// geometryType returns the PostGIS geometry type of a geometry column.
+func (spec *TableSpec) geometryType(col ColumnSpec) string {
 	geomType := strings.ToUpper(spec.GeometryType)
 	if geomType == "POLYGON" {
 		geomType = "GEOMETRY" // for multipolygon support
 	}
-	sql := fmt.Sprintf("SELECT AddGeometryColumn('%s', '%s', '%s', '%d', '%s', 2);",
-		spec.Schema, tableName, colName, spec.Srid, geomType)
-	row := tx.QueryRow(sql)
-	var void interface{}
-	err := row.Scan(&void)
-	if err != nil {
-		return &SQLError{sql, err}
+	if extra, ok := col.Type.(*extraGeometryType); ok && extra.geomType != "" {
+		geomType = extra.geomType
 	}
-	return nil
+	return geomType
 }
 
 func isPostGIS2(tx *sql.Tx) (bool, error) {
@@ -143,6 +175,14 @@ func (pg *PostGIS) Init() error {
 		return err
 	}
 
+	if pg.copyConnections > 0 {
+		var err error
+		pg.tableSizes, err = pg.existingTableSizes()
+		if err != nil {
+			return errors.Wrap(err, "querying table sizes")
+		}
+	}
+
 	tx, err := pg.Db.Begin()
 	if err != nil {
 		return err
@@ -153,6 +193,16 @@ func (pg *PostGIS) Init() error {
 			return err
 		}
 	}
+	// remove the elements and rejects of a previous import, they are
+	// created again if enabled
+	if !pg.Config.PartialImport {
+		if err := dropElementsTableIfExists(tx, pg.Config.ImportSchema, pg.Prefix+elementsTable); err != nil {
+			return err
+		}
+		if err := dropTableIfExists(tx, pg.Config.ImportSchema, pg.Prefix+rejectsTable); err != nil {
+			return err
+		}
+	}
 	err = tx.Commit()
 	if err != nil {
 		return err
@@ -161,6 +211,24 @@ func (pg *PostGIS) Init() error {
 	return nil
 }
 
+// existingTableSizes returns the size of all tables from a previous import.
+// Used to assign parallel COPY connections before the tables are recreated.
+func (pg *PostGIS) existingTableSizes() (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	for name, spec := range pg.Tables {
+		var size sql.NullInt64
+		stmt := fmt.Sprintf(`SELECT pg_total_relation_size(to_regclass('"%s"."%s"'))`,
+			pg.Config.ImportSchema, spec.FullName)
+		if err := pg.Db.QueryRow(stmt).Scan(&size); err != nil {
+			return nil, &SQLError{stmt, err}
+		}
+		if size.Valid {
+			sizes[name] = size.Int64
+		}
+	}
+	return sizes, nil
+}
+
 // Finish creates spatial indices on all tables.
 func (pg *PostGIS) Finish() error {
 	defer log.Step("Creating geometry indices")()
@@ -175,7 +243,10 @@ func (pg *PostGIS) Finish() error {
 		tableName := tbl.FullName
 		table := tbl
 		p.in <- func() error {
-			return createIndex(pg, tableName, table.Columns, false)
+			if err := createIndex(pg, tableName, table.Columns, false, table.indexTablespaceSQL()); err != nil {
+				return err
+			}
+			return createCustomIndexes(pg, table)
 		}
 	}
 
@@ -183,7 +254,16 @@ func (pg *PostGIS) Finish() error {
 		tableName := tbl.FullName
 		table := tbl
 		p.in <- func() error {
-			return createIndex(pg, tableName, table.Source.Columns, true)
+			if err := createIndex(pg, tableName, table.Columns(), true, ""); err != nil {
+				return err
+			}
+			if table.Merge {
+				sql := table.MergedIDsIndexSQL()
+				if _, err := pg.Db.Exec(sql); err != nil {
+					return &SQLError{sql, err}
+				}
+			}
+			return nil
 		}
 	}
 
@@ -192,10 +272,38 @@ func (pg *PostGIS) Finish() error {
 		return err
 	}
 
+	if pg.Config.PartialImport {
+		// stats are updated after the deploy
+		return nil
+	}
+	if pg.elementsTable {
+		if err := pg.createElementsTable(); err != nil {
+			return err
+		}
+	}
+	return pg.createTableStats()
+}
+
+func createIndex(pg *PostGIS, tableName string, columns []ColumnSpec, generalizedTable bool, tablespaceSQL string) error {
+	for _, idx := range indexSQL(pg.Config.ImportSchema, tableName, columns, generalizedTable, tablespaceSQL) {
+		step := log.Step(fmt.Sprintf("Creating %s on %s", idx.description, tableName))
+		_, err := pg.Db.Exec(idx.sql)
+		step()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func createIndex(pg *PostGIS, tableName string, columns []ColumnSpec, generalizedTable bool) error {
+type indexStmt struct {
+	sql         string
+	description string
+}
+
+// indexSQL returns the statements for the geometry indices and the OSM ID
+// index of the table.
+func indexSQL(schema, tableName string, columns []ColumnSpec, generalizedTable bool, tablespaceSQL string) []indexStmt {
 	foundIDCol := false
 	for _, cs := range columns {
 		if cs.Name == "id" {
@@ -203,16 +311,15 @@ func createIndex(pg *PostGIS, tableName string, columns []ColumnSpec, generalize
 		}
 	}
 
+	var stmts []indexStmt
 	for _, col := range columns {
 		if col.Type.Name() == "GEOMETRY" {
-			sql := fmt.Sprintf(`CREATE INDEX "%s_geom" ON "%s"."%s" USING GIST ("%s")`,
-				tableName, pg.Config.ImportSchema, tableName, col.Name)
-			step := log.Step(fmt.Sprintf("Creating geometry index on %s", tableName))
-			_, err := pg.Db.Exec(sql)
-			step()
-			if err != nil {
-				return err
+			indexName := tableName + "_geom"
+			if _, ok := col.Type.(*extraGeometryType); ok {
+				indexName = tableName + "_" + col.Name + "_geom"
 			}
+			stmts = append(stmts, indexStmt{fmt.Sprintf(`CREATE INDEX "%s" ON "%s"."%s" USING GIST ("%s")%s`,
+				indexName, schema, tableName, col.Name, tablespaceSQL), "geometry index"})
 		}
 		if col.FieldType.Name == "id" && (foundIDCol || generalizedTable) {
 			// Create index for OSM ID required for diff updates, but only if
@@ -220,28 +327,46 @@ func createIndex(pg *PostGIS, tableName string, columns []ColumnSpec, generalize
 			// The explicit `id` column prevented the creation of our composite
 			// PRIMARY KEY index of id (serial) and OSM ID.
 			// Generalized tables also do not have a PRIMARY KEY.
-			sql := fmt.Sprintf(`CREATE INDEX "%s_%s_idx" ON "%s"."%s" USING BTREE ("%s")`,
-				tableName, col.Name, pg.Config.ImportSchema, tableName, col.Name)
-			step := log.Step(fmt.Sprintf("Creating OSM id index on %s", tableName))
-			_, err := pg.Db.Exec(sql)
-			step()
-			if err != nil {
-				return err
-			}
+			stmts = append(stmts, indexStmt{fmt.Sprintf(`CREATE INDEX "%s_%s_idx" ON "%s"."%s" USING BTREE ("%s")%s`,
+				tableName, col.Name, schema, tableName, col.Name, tablespaceSQL), "OSM id index"})
 		}
 	}
-	return nil
+	return stmts
 }
 
+// GeneralizeUpdates inserts all elements that were inserted into the source
+// tables since EnableGeneralizeUpdates into the generalized tables.
+// Generalized tables with generalized sources are updated after their
+// sources.
 func (pg *PostGIS) GeneralizeUpdates() error {
 	defer log.Step("Updating generalized tables")()
 	for _, table := range pg.sortedGeneralizedTables() {
-		if ids, ok := pg.updatedIDs[table]; ok {
-			for _, id := range ids {
-				pg.txRouter.Insert(table, []interface{}{id})
+		ids, ok := pg.updatedIDs[table]
+		if !ok {
+			continue
+		}
+		if spec := pg.GeneralizedTables[table]; spec.Merge {
+			// merged polygons can contain any number of elements, merge
+			// all polygons that contain or touch the changed elements again
+			idList := make([]int64, 0, len(ids))
+			for id := range ids {
+				idList = append(idList, id)
+			}
+			if err := pg.txRouter.Exec(spec.MergeUpdateSQL(), pq.Array(idList)); err != nil {
+				return errors.Wrapf(err, "updating merged table %q", table)
+			}
+			pg.recountTables = append(pg.recountTables, table)
+			log.Printf("[info] Merged %d elements in generalized table %s", len(ids), table)
+			continue
+		}
+		for id := range ids {
+			if err := pg.txRouter.Insert(table, []interface{}{id}); err != nil {
+				return errors.Wrapf(err, "generalizing %d into %q", id, table)
 			}
 		}
+		log.Printf("[info] Updated %d elements in generalized table %s", len(ids), table)
 	}
+	pg.updatedIDs = make(map[string]map[int64]struct{})
 	return nil
 }
 
@@ -252,52 +377,42 @@ func (pg *PostGIS) Generalize() error {
 	if worker < 1 {
 		worker = 1
 	}
-	// generalized tables can depend on other generalized tables
-	// create tables with non-generalized sources first
-	p := newWorkerPool(worker, len(pg.GeneralizedTables))
-	for _, table := range pg.GeneralizedTables {
-		if table.SourceGeneralized == nil {
+	// generalized tables can depend on other generalized tables, create
+	// all tables of one level in parallel, starting with the tables with
+	// non-generalized sources
+	for _, level := range pg.generalizedTableLevels() {
+		p := newWorkerPool(worker, len(level))
+		for _, table := range level {
 			tbl := table // for following closure
 			p.in <- func() error {
-				if err := pg.generalizeTable(tbl); err != nil {
-					return err
-				}
-				tbl.created = true
-				return nil
+				return pg.generalizeTable(tbl)
 			}
 		}
+		if err := p.wait(); err != nil {
+			return err
+		}
 	}
-	err := p.wait()
-	if err != nil {
-		return err
-	}
-
-	// next create tables with created generalized sources until
-	// no new source is created
-	created := int32(1)
-	for created == 1 {
-		created = 0
+	return nil
+}
 
-		p := newWorkerPool(worker, len(pg.GeneralizedTables))
-		for _, table := range pg.GeneralizedTables {
-			if !table.created && table.SourceGeneralized.created {
-				tbl := table // for following closure
-				p.in <- func() error {
-					if err := pg.generalizeTable(tbl); err != nil {
-						return err
-					}
-					tbl.created = true
-					atomic.StoreInt32(&created, 1)
-					return nil
-				}
-			}
+// generalizedTableLevels groups the generalized tables by the number of
+// generalized tables in their source chain.
+func (pg *PostGIS) generalizedTableLevels() [][]*GeneralizedTableSpec {
+	depth := map[string]int{}
+	levels := [][]*GeneralizedTableSpec{}
+	for _, name := range pg.generalizedOrder {
+		tbl := pg.GeneralizedTables[name]
+		d := 0
+		if tbl.SourceGeneralized != nil {
+			d = depth[tbl.SourceGeneralized.Name] + 1
 		}
-		err := p.wait()
-		if err != nil {
-			return err
+		depth[name] = d
+		if d == len(levels) {
+			levels = append(levels, nil)
 		}
+		levels[d] = append(levels[d], tbl)
 	}
-	return nil
+	return levels
 }
 
 func (pg *PostGIS) generalizeTable(table *GeneralizedTableSpec) error {
@@ -310,37 +425,24 @@ func (pg *PostGIS) generalizeTable(table *GeneralizedTableSpec) error {
 	}
 	defer rollbackIfTx(&tx)
 
-	var where string
-	if table.Where != "" {
-		where = " WHERE " + table.Where
-	}
-	var cols []string
-
-	for _, col := range table.Source.Columns {
-		cols = append(cols, col.Type.GeneralizeSQL(&col, table))
-	}
-
 	if err := dropTableIfExists(tx, pg.Config.ImportSchema, table.FullName); err != nil {
 		return errors.Wrap(err, "dropping existing table")
 	}
 
-	columnSQL := strings.Join(cols, ",\n")
-
-	var sourceTable string
-	if table.SourceGeneralized != nil {
-		sourceTable = table.SourceGeneralized.FullName
-	} else {
-		sourceTable = table.Source.FullName
-	}
-	sql := fmt.Sprintf(`CREATE TABLE "%s"."%s" AS (SELECT %s FROM "%s"."%s"%s)`,
-		pg.Config.ImportSchema, table.FullName, columnSQL, pg.Config.ImportSchema,
-		sourceTable, where)
+	sql := fmt.Sprintf(`CREATE TABLE "%s"."%s" AS (%s)`,
+		pg.Config.ImportSchema, table.FullName, table.SelectSQL())
 
 	_, err = tx.Exec(sql)
 	if err != nil {
 		return &SQLError{sql, err}
 	}
 
+	for _, sql := range table.CommentSQL() {
+		if _, err := tx.Exec(sql); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+
 	isPG2, err := isPostGIS2(tx)
 	if err != nil {
 		return errors.Wrap(err, "detecting PostGIS version")
@@ -369,11 +471,27 @@ func (pg *PostGIS) Optimize() error {
 		worker = 1
 	}
 
-	p := newWorkerPool(worker, len(pg.Tables)+len(pg.GeneralizedTables))
+	tasks := len(pg.Tables) + len(pg.GeneralizedTables)
+	for _, tbl := range pg.Tables {
+		if tbl.Shard != nil {
+			tasks += len(tbl.Shard.Partitions)
+		}
+	}
+	p := newWorkerPool(worker, tasks)
 
 	for _, tbl := range pg.Tables {
 		tableName := tbl.FullName
 		table := tbl
+		if table.Shard != nil {
+			// partitioned tables can not be clustered, only their partitions
+			for _, part := range table.Shard.Partitions {
+				partName := part.FullName
+				p.in <- func() error {
+					return clusterTable(pg, partName, table.Srid, table.Columns)
+				}
+			}
+			continue
+		}
 		p.in <- func() error {
 			return clusterTable(pg, tableName, table.Srid, table.Columns)
 		}
@@ -382,7 +500,7 @@ func (pg *PostGIS) Optimize() error {
 		tableName := tbl.FullName
 		table := tbl
 		p.in <- func() error {
-			return clusterTable(pg, tableName, table.Source.Srid, table.Source.Columns)
+			return clusterTable(pg, tableName, table.Source.Srid, table.Columns())
 		}
 	}
 
@@ -391,11 +509,21 @@ func (pg *PostGIS) Optimize() error {
 		return errors.Wrap(err, "optimizing database")
 	}
 
+	// create indexes that were added to the mapping after the import
+	for _, tbl := range pg.Tables {
+		if err := createCustomIndexes(pg, tbl); err != nil {
+			return errors.Wrap(err, "optimizing database")
+		}
+	}
+
 	return nil
 }
 
 func clusterTable(pg *PostGIS, tableName string, srid int, columns []ColumnSpec) error {
 	for _, col := range columns {
+		if _, ok := col.Type.(*extraGeometryType); ok {
+			continue
+		}
 		if col.Type.Name() == "GEOMETRY" {
 			step := log.Step(fmt.Sprintf("Indexing %q on geohash", tableName))
 			sql := fmt.Sprintf(`CREATE INDEX "%s_geom_geohash" ON "%s"."%s" (ST_GeoHash(ST_Transform(ST_SetSRID(Box2D(%s), %d), 4326)))`,
@@ -431,26 +559,59 @@ func clusterTable(pg *PostGIS, tableName string, srid int, columns []ColumnSpec)
 }
 
 type PostGIS struct {
-	Db                      *sql.DB
-	Params                  string
-	Config                  database.Config
-	Tables                  map[string]*TableSpec
-	GeneralizedTables       map[string]*GeneralizedTableSpec
+	Db                *sql.DB
+	Params            string
+	Config            database.Config
+	Tables            map[string]*TableSpec
+	GeneralizedTables map[string]*GeneralizedTableSpec
+	generalizedOrder  []string
+	DeployGroups      []config.DeployGroup
+	// sequence of the diff import and merged tables that need to be
+	// counted after the diff import, for the stats table
+	sequence                int
+	recountTables           []string
 	Prefix                  string
 	txRouter                *TxRouter
 	updateGeneralizedTables bool
+	enableCopyFreeze        bool
+	copyFreeze              bool
+	copyConnections         int
+	copyRetry               bool
+	copyChunkSize           int
+	copyChunkRetries        int
+	pool                    poolOptions
+	tableSizes              map[string]int64
+	// bulkTruncate are the tables that are truncated by a bulk import
+	bulkTruncate map[string]bool
 
 	updateIDsMu sync.Mutex
-	updatedIDs  map[string][]int64
+	updatedIDs  map[string]map[int64]struct{}
+
+	// elementsTable enables the elements table for imports, elementUpdates
+	// are the changes of the elements table during diff imports
+	elementsTable    bool
+	elementUpdatesMu sync.Mutex
+	elementUpdates   map[int64]bool
+
+	// rejectsTable enables the rejects table for imports, rejectsTx is the
+	// transaction for the rejects of bulk imports
+	rejectsTable     bool
+	rejectsMu        sync.Mutex
+	rejectsTx        *sql.Tx
+	rejectsBulk      bool
+	rejects          []reject
+	deleteRejectStmt *sql.Stmt
 }
 
 func (pg *PostGIS) Open() error {
 	var err error
 
-	pg.Db, err = sql.Open("postgres", pg.Params)
-	if err != nil {
-		return errors.Wrap(err, "opening Postgres DB")
-	}
+	pg.Db = sql.OpenDB(&connector{
+		params:  pg.Params,
+		dialer:  dialer{keepAlive: pg.pool.keepAlive},
+		retries: pg.pool.connectRetries,
+	})
+	pg.Db.SetMaxOpenConns(pg.pool.maxConnections)
 	// check that the connection actually works
 	err = pg.Db.Ping()
 	if err != nil {
@@ -462,62 +623,67 @@ func (pg *PostGIS) Open() error {
 func (pg *PostGIS) InsertPoint(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
 	for _, match := range matches {
 		row := match.Row(&elem, &geom)
+		if err := pg.reproject(match.Table.Name, row, &geom); err != nil {
+			// only skip the row of this table
+			log.Printf("[warn] %s", err)
+			continue
+		}
 		if err := pg.txRouter.Insert(match.Table.Name, row); err != nil {
 			return err
 		}
 	}
+	pg.markElement(elem.ID, false)
+	pg.markGeneralizeUpdates(elem.ID, matches)
 	return nil
 }
 
 func (pg *PostGIS) InsertLineString(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
 	for _, match := range matches {
 		row := match.Row(&elem, &geom)
+		if err := pg.reproject(match.Table.Name, row, &geom); err != nil {
+			// only skip the row of this table
+			log.Printf("[warn] %s", err)
+			continue
+		}
 		if err := pg.txRouter.Insert(match.Table.Name, row); err != nil {
 			return err
 		}
 	}
-	if pg.updateGeneralizedTables {
-		genMatches := pg.generalizedFromMatches(matches)
-		if len(genMatches) > 0 {
-			pg.updateIDsMu.Lock()
-			for _, generalizedTable := range genMatches {
-				pg.updatedIDs[generalizedTable.Name] = append(pg.updatedIDs[generalizedTable.Name], elem.ID)
-
-			}
-			pg.updateIDsMu.Unlock()
-		}
-	}
+	pg.markElement(elem.ID, false)
+	pg.markGeneralizeUpdates(elem.ID, matches)
 	return nil
 }
 
 func (pg *PostGIS) InsertPolygon(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
 	for _, match := range matches {
 		row := match.Row(&elem, &geom)
+		if err := pg.reproject(match.Table.Name, row, &geom); err != nil {
+			// only skip the row of this table
+			log.Printf("[warn] %s", err)
+			continue
+		}
 		if err := pg.txRouter.Insert(match.Table.Name, row); err != nil {
 			return err
 		}
 	}
-	if pg.updateGeneralizedTables {
-		genMatches := pg.generalizedFromMatches(matches)
-		if len(genMatches) > 0 {
-			pg.updateIDsMu.Lock()
-			for _, generalizedTable := range genMatches {
-				pg.updatedIDs[generalizedTable.Name] = append(pg.updatedIDs[generalizedTable.Name], elem.ID)
-
-			}
-			pg.updateIDsMu.Unlock()
-		}
-	}
+	pg.markElement(elem.ID, false)
+	pg.markGeneralizeUpdates(elem.ID, matches)
 	return nil
 }
 
 func (pg *PostGIS) InsertRelationMember(rel osm.Relation, m osm.Member, geom geom.Geometry, matches []mapping.Match) error {
 	for _, match := range matches {
 		row := match.MemberRow(&rel, &m, &geom)
+		if err := pg.reproject(match.Table.Name, row, &geom); err != nil {
+			// only skip the row of this table
+			log.Printf("[warn] %s", err)
+			continue
+		}
 		if err := pg.txRouter.Insert(match.Table.Name, row); err != nil {
 			return err
 		}
 	}
+	pg.markElement(rel.ID, false)
 	return nil
 }
 
@@ -527,8 +693,14 @@ func (pg *PostGIS) Delete(id int64, matches []mapping.Match) error {
 			return errors.Wrapf(err, "deleting %d from %q", id, match.Table.Name)
 		}
 	}
+	pg.markElement(id, true)
 	if pg.updateGeneralizedTables {
 		for _, generalizedTable := range pg.generalizedFromMatches(matches) {
+			if generalizedTable.Merge {
+				// merged tables are updated in GeneralizeUpdates
+				pg.markGeneralizedIDs(id, []*GeneralizedTableSpec{generalizedTable})
+				continue
+			}
 			if err := pg.txRouter.Delete(generalizedTable.Name, id); err != nil {
 				return errors.Wrapf(err, "deleting %d from %q", id, generalizedTable.Name)
 			}
@@ -537,6 +709,32 @@ func (pg *PostGIS) Delete(id int64, matches []mapping.Match) error {
 	return nil
 }
 
+// markGeneralizeUpdates records the ID of an inserted element for all
+// generalized tables of the matched tables. Each ID is only recorded once,
+// even if an element is inserted multiple times (e.g. clipped polygons).
+func (pg *PostGIS) markGeneralizeUpdates(id int64, matches []mapping.Match) {
+	if !pg.updateGeneralizedTables {
+		return
+	}
+	pg.markGeneralizedIDs(id, pg.generalizedFromMatches(matches))
+}
+
+func (pg *PostGIS) markGeneralizedIDs(id int64, tables []*GeneralizedTableSpec) {
+	if len(tables) == 0 {
+		return
+	}
+	pg.updateIDsMu.Lock()
+	for _, generalizedTable := range tables {
+		ids, ok := pg.updatedIDs[generalizedTable.Name]
+		if !ok {
+			ids = make(map[int64]struct{})
+			pg.updatedIDs[generalizedTable.Name] = ids
+		}
+		ids[id] = struct{}{}
+	}
+	pg.updateIDsMu.Unlock()
+}
+
 func (pg *PostGIS) generalizedFromMatches(matches []mapping.Match) []*GeneralizedTableSpec {
 	generalizedTables := []*GeneralizedTableSpec{}
 	for _, match := range matches {
@@ -547,61 +745,127 @@ func (pg *PostGIS) generalizedFromMatches(matches []mapping.Match) []*Generalize
 }
 
 func (pg *PostGIS) sortedGeneralizedTables() []string {
-	added := map[string]bool{}
-	sorted := []string{}
-
-	for len(pg.GeneralizedTables) > len(sorted) {
-		for _, tbl := range pg.GeneralizedTables {
-			if _, ok := added[tbl.Name]; !ok {
-				if tbl.Source != nil || added[tbl.SourceGeneralized.Name] {
-					added[tbl.Name] = true
-					sorted = append(sorted, tbl.Name)
-				}
-			}
-		}
-	}
-	return sorted
+	return pg.generalizedOrder
 }
 
 func (pg *PostGIS) EnableGeneralizeUpdates() {
 	pg.updateGeneralizedTables = true
-	pg.updatedIDs = make(map[string][]int64)
+	pg.updatedIDs = make(map[string]map[int64]struct{})
 }
 
 func (pg *PostGIS) Begin() error {
 	var err error
 	pg.txRouter, err = newTxRouter(pg, false)
-	return err
+	if err != nil {
+		return err
+	}
+	if err := pg.beginDiffRejects(); err != nil {
+		return err
+	}
+	return pg.beginElementUpdates()
 }
 
 func (pg *PostGIS) BeginBulk() error {
+	pg.bulkTruncate = make(map[string]bool, len(pg.Tables))
+	for name := range pg.Tables {
+		pg.bulkTruncate[name] = true
+	}
+	return pg.beginBulk()
+}
+
+// BeginBulkTruncate starts a bulk import that only truncates the given
+// tables, e.g. to continue an interrupted import. Rows of all other tables
+// are appended. Only truncated tables are copied with FREEZE.
+func (pg *PostGIS) BeginBulkTruncate(tables []string) error {
+	pg.bulkTruncate = make(map[string]bool, len(tables))
+	for _, name := range tables {
+		pg.bulkTruncate[name] = true
+	}
+	return pg.beginBulk()
+}
+
+func (pg *PostGIS) beginBulk() error {
 	var err error
+	if pg.enableCopyFreeze {
+		pg.copyFreeze, err = pg.supportsCopyFreeze()
+		if err != nil {
+			return errors.Wrap(err, "checking for COPY FREEZE support")
+		}
+	}
+	if pg.copyRetry {
+		if err := pg.createRejectsTable(); err != nil {
+			return err
+		}
+	}
+	if err := pg.beginBulkRejects(); err != nil {
+		return err
+	}
+	if err := pg.limitCopyConnections(); err != nil {
+		return errors.Wrap(err, "checking available connections")
+	}
 	pg.txRouter, err = newTxRouter(pg, true)
 	return err
 }
 
+// supportsCopyFreeze checks if the server supports COPY FREEZE (PostgreSQL
+// 9.3 and newer). It also logs a hint if wal_level does not allow to skip
+// WAL writes for the initial import.
+func (pg *PostGIS) supportsCopyFreeze() (bool, error) {
+	var version int
+	sql := "SHOW server_version_num"
+	if err := pg.Db.QueryRow(sql).Scan(&version); err != nil {
+		return false, &SQLError{sql, err}
+	}
+	if version < 90300 {
+		return false, nil
+	}
+
+	var walLevel string
+	sql = "SHOW wal_level"
+	if err := pg.Db.QueryRow(sql).Scan(&walLevel); err != nil {
+		return false, &SQLError{sql, err}
+	}
+	if walLevel != "minimal" {
+		log.Printf("[info] wal_level is %s, set wal_level=minimal and max_wal_senders=0 to skip WAL writes during -write", walLevel)
+	}
+	return true, nil
+}
+
 func (pg *PostGIS) Abort() error {
+	pg.endRejects(false)
 	return pg.txRouter.Abort()
 }
 
 func (pg *PostGIS) End() error {
-	return pg.txRouter.End()
+	if err := pg.updateTableStats(); err != nil {
+		pg.txRouter.Abort()
+		return errors.Wrap(err, "updating table stats")
+	}
+	if err := pg.updateElementsTable(); err != nil {
+		pg.txRouter.Abort()
+		return errors.Wrap(err, "updating elements table")
+	}
+	if pg.rejectsTx != nil && !pg.rejectsBulk {
+		// rejects of diff imports are committed with the diff
+		if err := pg.endRejects(true); err != nil {
+			pg.txRouter.Abort()
+			return errors.Wrap(err, "updating rejects")
+		}
+	}
+	if err := pg.txRouter.End(); err != nil {
+		pg.endRejects(false)
+		return err
+	}
+	return errors.Wrap(pg.endRejects(true), "committing rejects")
 }
 
 func (pg *PostGIS) Close() error {
 	return pg.Db.Close()
 }
 
-func New(conf database.Config, m *config.Mapping) (database.DB, error) {
-	db := &PostGIS{}
-
-	db.Tables = make(map[string]*TableSpec)
-	db.GeneralizedTables = make(map[string]*GeneralizedTableSpec)
-
-	db.Config = conf
-
-	connStr := db.Config.ConnectionParams
-
+// connectionParams returns the params list of a postgis: or postgres:
+// connection URL or params list.
+func connectionParams(connStr string) (string, error) {
 	// we accept postgis as an alias, replace for pq.ParseURL
 	if strings.HasPrefix(connStr, "postgis:") {
 		connStr = strings.Replace(
@@ -610,21 +874,77 @@ func New(conf database.Config, m *config.Mapping) (database.DB, error) {
 		)
 	}
 
-	var err error
-	var params string
 	if strings.HasPrefix(connStr, "postgres://") {
 		// connStr is a URL
-		params, err = pq.ParseURL(connStr)
+		params, err := pq.ParseURL(connStr)
 		if err != nil {
-			return nil, errors.Wrap(err, "parsing database connection URL")
+			return "", errors.Wrap(err, "parsing database connection URL")
 		}
-	} else {
-		// connStr is already a params list (postgres: host=localhost ...)
-		params = strings.TrimSpace(strings.TrimPrefix(connStr, "postgres:"))
+		return params, nil
+	}
+	// connStr is already a params list (postgres: host=localhost ...)
+	return strings.TrimSpace(strings.TrimPrefix(connStr, "postgres:")), nil
+}
+
+// TablePrefix returns the table prefix of the connection (osm_ by default,
+// or the prefix parameter). Returns an empty string for connections of
+// other databases.
+func TablePrefix(connection string) (string, error) {
+	if !strings.HasPrefix(connection, "postgis:") && !strings.HasPrefix(connection, "postgres:") {
+		return "", nil
+	}
+	params, err := connectionParams(connection)
+	if err != nil {
+		return "", err
+	}
+	_, prefix := stripPrefixFromConnectionParams(params)
+	return prefix, nil
+}
+
+func New(conf database.Config, m *config.Mapping) (database.DB, error) {
+	db := &PostGIS{}
+
+	db.Tables = make(map[string]*TableSpec)
+	db.GeneralizedTables = make(map[string]*GeneralizedTableSpec)
+
+	db.Config = conf
+
+	params, err := connectionParams(db.Config.ConnectionParams)
+	if err != nil {
+		return nil, err
 	}
 
 	params = disableDefaultSsl(params)
 	params, db.Prefix = stripPrefixFromConnectionParams(params)
+	params, db.enableCopyFreeze = stripCopyFreezeFromConnectionParams(params)
+	params, db.copyRetry = stripCopyRetryFromConnectionParams(params)
+	params, db.copyConnections, err = stripCopyConnectionsFromConnectionParams(params)
+	if err != nil {
+		return nil, err
+	}
+	if conf.WriteConcurrency > 0 {
+		// -writeconcurrency overrides the copyconnections parameter
+		db.copyConnections = conf.WriteConcurrency
+	}
+	if conf.Ordered && db.copyConnections > 0 {
+		// rows of multiple COPY connections are not ordered
+		log.Printf("[info] Ignoring copyconnections and -writeconcurrency for import with -ordered")
+		db.copyConnections = 0
+	}
+	params, db.copyChunkSize, db.copyChunkRetries, err = stripCopyChunksFromConnectionParams(params)
+	if err != nil {
+		return nil, err
+	}
+	params, db.pool, err = stripPoolFromConnectionParams(params)
+	if err != nil {
+		return nil, err
+	}
+	params, db.elementsTable = stripElementsTableFromConnectionParams(params)
+	params, db.rejectsTable = stripRejectsTableFromConnectionParams(params)
+	if db.elementsTable && !m.SingleIDSpace {
+		// IDs of nodes, ways and relations overlap otherwise
+		return nil, errors.New("elementstable requires use_single_id_space in the mapping")
+	}
 
 	for name, table := range m.Tables {
 		db.Tables[name], err = NewTableSpec(db, table)
@@ -635,6 +955,17 @@ func New(conf database.Config, m *config.Mapping) (database.DB, error) {
 	for name, table := range m.GeneralizedTables {
 		db.GeneralizedTables[name] = NewGeneralizedTableSpec(db, table)
 	}
+	if err := db.checkStatsTableName(); err != nil {
+		return nil, err
+	}
+	if err := db.checkMaxConnections(); err != nil {
+		return nil, err
+	}
+	db.DeployGroups = m.DeployGroups
+	db.generalizedOrder, err = mapping.SortedGeneralizedTables(m)
+	if err != nil {
+		return nil, err
+	}
 	if err := db.prepareGeneralizedTableSources(); err != nil {
 		return nil, errors.Wrap(err, "preparing generalized table sources")
 	}
@@ -663,16 +994,12 @@ func (pg *PostGIS) prepareGeneralizedTableSources() error {
 		}
 	}
 
-	// set source table until all generalized tables have a source
-	for filled := true; filled; {
-		filled = false
-		for _, table := range pg.GeneralizedTables {
-			if table.Source == nil {
-				if source, ok := pg.GeneralizedTables[table.SourceName]; ok && source.Source != nil {
-					table.Source = source.Source
-				}
-				filled = true
-			}
+	// set source table, sources are before the generalized tables in
+	// generalizedOrder
+	for _, name := range pg.generalizedOrder {
+		table := pg.GeneralizedTables[name]
+		if table.Source == nil {
+			table.Source = table.SourceGeneralized.Source
 		}
 	}
 	return nil
@@ -0,0 +1,330 @@
+package postgis
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/stats"
+)
+
+// rejectsTable is the name (without prefix) of the table with the elements
+// that failed to import, the rows that PostgreSQL rejected with copyretry
+// and the multipolygon errors.
+const rejectsTable = "rejects"
+
+// Kinds of rejects in the rejects table.
+const (
+	// rejectElement is an element that was skipped by the writer, e.g.
+	// because of an invalid geometry
+	rejectElement = "element"
+	// rejectRow is a row that PostgreSQL rejected during a bulk import
+	// with copyretry
+	rejectRow = "row"
+	// rejectMultipolygon is a problem of a multipolygon relation
+	rejectMultipolygon = "multipolygon"
+)
+
+// rejectedRowReason is the reason of all rejected rows, the message
+// contains the error of PostgreSQL.
+const rejectedRowReason = "rejected_row"
+
+// copyBatchSize is the number of rows of each COPY with copyretry.
+const copyBatchSize = 10000
+
+// rejectsBatchSize is the number of buffered element rejects that are
+// copied at once during bulk imports.
+const rejectsBatchSize = 1000
+
+// reject is a buffered element reject.
+type reject struct {
+	elemType string
+	id       int64
+	reason   string
+	message  string
+	tags     osm.Tags
+}
+
+// createRejectsTable creates the rejects table, if it does not exist.
+func (pg *PostGIS) createRejectsTable() error {
+	schema := pg.Config.ImportSchema
+	rejectsName := pg.Prefix + rejectsTable
+	for _, sql := range []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s"."%s" (
+			id SERIAL PRIMARY KEY,
+			kind TEXT NOT NULL,
+			osm_type TEXT,
+			osm_id BIGINT,
+			reason TEXT NOT NULL,
+			message TEXT,
+			tags JSONB,
+			table_name TEXT,
+			row_values TEXT,
+			member_id BIGINT,
+			geometry geometry(Point, %d),
+			created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		)`, schema, rejectsName, pg.Config.Srid),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "%s_osm_idx" ON "%s"."%s" USING BTREE (osm_type, osm_id)`,
+			rejectsName, schema, rejectsName),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "%s_geom" ON "%s"."%s" USING GIST (geometry)`,
+			rejectsName, schema, rejectsName),
+	} {
+		if _, err := pg.Db.Exec(sql); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+	return nil
+}
+
+// beginBulkRejects starts a separate transaction for the rejects of a bulk
+// import, if enabled with rejectstable. Partial imports do not write
+// rejects, as the rejects of the other tables would be lost.
+func (pg *PostGIS) beginBulkRejects() error {
+	if !pg.rejectsTable || pg.Config.PartialImport {
+		return nil
+	}
+	if err := pg.createRejectsTable(); err != nil {
+		return err
+	}
+	tx, err := pg.Db.Begin()
+	if err != nil {
+		return err
+	}
+	pg.rejectsTx = tx
+	pg.rejectsBulk = true
+	return nil
+}
+
+// beginDiffRejects updates the rejects within the transaction of a diff
+// import, if the rejects table exists.
+func (pg *PostGIS) beginDiffRejects() error {
+	tx := pg.txRouter.tx
+	exists, err := tableExists(tx, pg.Config.ImportSchema, pg.Prefix+rejectsTable)
+	if err != nil || !exists {
+		return err
+	}
+	sql := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE kind = '%s' AND osm_type = $1 AND osm_id = $2`,
+		pg.Config.ImportSchema, pg.Prefix+rejectsTable, rejectElement)
+	if pg.deleteRejectStmt, err = tx.Prepare(sql); err != nil {
+		return &SQLError{sql, err}
+	}
+	pg.rejectsTx = tx
+	pg.rejectsBulk = false
+	return nil
+}
+
+// InsertReject stores an element for the rejects table. Does nothing if
+// the table is not enabled. The rejects are copied in batches during bulk
+// imports and with the end of diff imports.
+func (pg *PostGIS) InsertReject(elemType string, id int64, reason, message string, tags osm.Tags) error {
+	pg.rejectsMu.Lock()
+	defer pg.rejectsMu.Unlock()
+	if pg.rejectsTx == nil {
+		return nil
+	}
+	pg.rejects = append(pg.rejects, reject{elemType, id, reason, message, tags})
+	if pg.rejectsBulk && len(pg.rejects) >= rejectsBatchSize {
+		return pg.copyRejects()
+	}
+	return nil
+}
+
+// DeleteRejects removes all rejects of an element during a diff import.
+func (pg *PostGIS) DeleteRejects(elemType string, id int64) error {
+	pg.rejectsMu.Lock()
+	defer pg.rejectsMu.Unlock()
+	if pg.deleteRejectStmt == nil {
+		return nil
+	}
+	// remove rejects that are not copied yet
+	buffered := pg.rejects[:0]
+	for _, r := range pg.rejects {
+		if r.elemType != elemType || r.id != id {
+			buffered = append(buffered, r)
+		}
+	}
+	pg.rejects = buffered
+	if _, err := pg.deleteRejectStmt.Exec(elemType, id); err != nil {
+		return &SQLInsertError{SQLError{"DELETE rejects", err}, id}
+	}
+	return nil
+}
+
+// copyRejects copies all buffered rejects into the rejects table.
+// Requires rejectsMu.
+func (pg *PostGIS) copyRejects() error {
+	if len(pg.rejects) == 0 {
+		return nil
+	}
+	sql := fmt.Sprintf(`COPY "%s"."%s" (kind, osm_type, osm_id, reason, message, tags) FROM STDIN`,
+		pg.Config.ImportSchema, pg.Prefix+rejectsTable)
+	stmt, err := pg.rejectsTx.Prepare(sql)
+	if err != nil {
+		return &SQLError{sql, err}
+	}
+	defer stmt.Close()
+	for _, r := range pg.rejects {
+		var msg interface{}
+		if r.message != "" {
+			msg = r.message
+		}
+		tagsJSON, err := rejectTagsJSON(r.tags)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(rejectElement, r.elemType, r.id, r.reason, msg, tagsJSON); err != nil {
+			return &SQLInsertError{SQLError{sql, err}, r.id}
+		}
+	}
+	// finish COPY
+	if _, err := stmt.Exec(); err != nil {
+		return &SQLError{sql, err}
+	}
+	pg.rejects = pg.rejects[:0]
+	return nil
+}
+
+// endRejects copies the remaining rejects. The rejects of a bulk import
+// are committed, the rejects of a diff import need to be ended before the
+// diff is committed.
+func (pg *PostGIS) endRejects(commit bool) error {
+	pg.rejectsMu.Lock()
+	defer pg.rejectsMu.Unlock()
+	if pg.rejectsTx == nil {
+		return nil
+	}
+	tx := pg.rejectsTx
+	bulk := pg.rejectsBulk
+	var err error
+	if commit {
+		err = pg.copyRejects()
+	}
+	pg.rejectsTx, pg.deleteRejectStmt, pg.rejects = nil, nil, nil
+	if !bulk {
+		return err
+	}
+	if !commit || err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("[info] Rejected elements are stored in %s%s", pg.Prefix, rejectsTable)
+	return nil
+}
+
+// insertRejectedRowSQL returns the statement to store a row that
+// PostgreSQL rejected during a bulk import with copyretry.
+func (pg *PostGIS) insertRejectedRowSQL() string {
+	return fmt.Sprintf(`INSERT INTO "%s"."%s" (kind, reason, table_name, osm_id, message, row_values) VALUES ('%s', '%s', $1, $2, $3, $4)`,
+		pg.Config.ImportSchema, pg.Prefix+rejectsTable, rejectRow, rejectedRowReason)
+}
+
+// WriteMultipolygonErrors replaces the multipolygon errors in the rejects
+// table with errs.
+func (pg *PostGIS) WriteMultipolygonErrors(errs []stats.MultipolygonError) error {
+	defer log.Step("Writing multipolygon errors")()
+	if err := pg.createRejectsTable(); err != nil {
+		return err
+	}
+	tx, err := pg.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollbackIfTx(&tx)
+
+	if err := pg.insertMultipolygonErrors(tx, errs); err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	tx = nil // set nil to prevent rollback
+	return nil
+}
+
+// insertMultipolygonErrors replaces the multipolygon errors in the rejects
+// table. Errors with a location are inserted as points for QA overlays.
+func (pg *PostGIS) insertMultipolygonErrors(tx *sql.Tx, errs []stats.MultipolygonError) error {
+	schema := pg.Config.ImportSchema
+	rejectsName := pg.Prefix + rejectsTable
+	sql := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE kind = '%s'`, schema, rejectsName, rejectMultipolygon)
+	if _, err := tx.Exec(sql); err != nil {
+		return &SQLError{sql, err}
+	}
+
+	sql = fmt.Sprintf(`INSERT INTO "%s"."%s" (kind, osm_type, osm_id, member_id, reason, message, geometry)
+		VALUES ('%s', 'relation', $1, $2, $3, $4,
+			CASE WHEN $5::bool THEN ST_SetSRID(ST_MakePoint($6, $7), %d) END)`,
+		schema, rejectsName, rejectMultipolygon, pg.Config.Srid)
+	stmt, err := tx.Prepare(sql)
+	if err != nil {
+		return &SQLError{sql, err}
+	}
+	defer stmt.Close()
+	for _, e := range errs {
+		var memberID interface{}
+		if e.MemberID != 0 {
+			memberID = e.MemberID
+		}
+		var x, y float64
+		hasLocation := len(e.Location) == 2
+		if hasLocation {
+			x, y = e.Location[0], e.Location[1]
+		}
+		if _, err := stmt.Exec(e.RelationID, memberID, e.Reason, e.Message, hasLocation, x, y); err != nil {
+			return &SQLInsertError{SQLError{sql, err}, e}
+		}
+	}
+	return nil
+}
+
+// idColumn returns the index of the id column or -1.
+func (spec *TableSpec) idColumn() int {
+	for i, col := range spec.Columns {
+		if col.FieldType.Name == "id" {
+			return i
+		}
+	}
+	return -1
+}
+
+// formatRow returns the values of a row for the rejects table.
+func formatRow(spec *TableSpec, row []interface{}) string {
+	parts := make([]string, len(row))
+	for i, v := range row {
+		name := fmt.Sprint(i)
+		if i < len(spec.Columns) {
+			name = spec.Columns[i].Name
+		}
+		if str, ok := v.(string); ok {
+			// quoted, as the row may contain invalid UTF-8
+			parts[i] = fmt.Sprintf("%s=%q", name, str)
+		} else {
+			parts[i] = fmt.Sprintf("%s=%v", name, v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// rejectTagsJSON returns the tags as a JSON object. NUL characters are
+// removed, as PostgreSQL does not allow them in JSONB.
+func rejectTagsJSON(tags osm.Tags) (interface{}, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	clean := make(map[string]string, len(tags))
+	for k, v := range tags {
+		clean[strings.Replace(k, "\x00", "", -1)] = strings.Replace(v, "\x00", "", -1)
+	}
+	b, err := json.Marshal(clean)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,43 @@
+package postgis
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/geom/wkb"
+)
+
+// reproject transforms the geometries of a row into the SRID of the table,
+// for tables with a different SRID than the import. Transformed geometries
+// are shared between all tables of geom with the same SRID.
+func (pg *PostGIS) reproject(table string, row []interface{}, geom *geom.Geometry) error {
+	spec, ok := pg.Tables[table]
+	if !ok || spec.transform == nil {
+		return nil
+	}
+	transformed := geom.Shared("reprojected:"+strconv.Itoa(spec.Srid), func() interface{} {
+		return map[string]string{}
+	}).(map[string]string)
+	for i, col := range spec.Columns {
+		if col.Type.Name() != "GEOMETRY" || i >= len(row) {
+			continue
+		}
+		v, ok := row[i].(string)
+		if !ok || v == "" {
+			continue
+		}
+		if g, ok := transformed[v]; ok {
+			row[i] = g
+			continue
+		}
+		g, err := wkb.TransformHex([]byte(v), spec.Srid, spec.transform)
+		if err != nil {
+			return errors.Wrapf(err, "transforming %s of %s into EPSG:%d", col.Name, table, spec.Srid)
+		}
+		transformed[v] = string(g)
+		row[i] = string(g)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package postgis
+
+import (
+	"testing"
+
+	"github.com/omniscale/imposm3/geom"
+)
+
+func TestReprojectShared(t *testing.T) {
+	calls := 0
+	transform := func(x, y float64) (float64, float64) {
+		calls++
+		return x * 2, y * 2
+	}
+	columns := []ColumnSpec{
+		{Name: "id", Type: &simpleColumnType{"BIGINT"}},
+		{Name: "geometry", Type: &geometryType{"GEOMETRY"}},
+	}
+	pg := &PostGIS{Tables: map[string]*TableSpec{
+		"a": {Name: "a", Srid: 4326, Columns: columns, transform: transform},
+		"b": {Name: "b", Srid: 4326, Columns: columns, transform: transform},
+	}}
+
+	// POINT(1 2)
+	point := "0101000000000000000000F03F0000000000000040"
+	g := geom.Geometry{Wkb: []byte(point)}
+	var rows [][]interface{}
+	for _, table := range []string{"a", "b"} {
+		row := []interface{}{int64(1), point}
+		if err := pg.reproject(table, row, &g); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	if calls != 1 {
+		t.Errorf("expected one transformation, got %d", calls)
+	}
+	if rows[0][1] == point || rows[0][1] != rows[1][1] {
+		t.Errorf("unexpected geometries %v %v", rows[0][1], rows[1][1])
+	}
+}
@@ -1,9 +1,15 @@
 package postgis
 
 import (
+	"database/sql"
 	"fmt"
+	"sort"
+	"time"
 
+	pq "github.com/lib/pq"
 	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
 )
 
 func (pg *PostGIS) rotate(source, dest, backup string) error {
@@ -17,13 +23,32 @@ func (pg *PostGIS) rotate(source, dest, backup string) error {
 		return err
 	}
 
-	tx, err := pg.Db.Begin()
-	if err != nil {
-		return err
+	for _, group := range pg.deployGroups() {
+		if group.Name != "" {
+			log.Printf("[info] Rotating deploy group %s", group.Name)
+		}
+		if err := pg.rotateTables(group.Tables, source, dest, backup); err != nil {
+			if group.Name != "" {
+				return errors.Wrapf(err, "rotating deploy group %s", group.Name)
+			}
+			return err
+		}
 	}
-	defer rollbackIfTx(&tx)
+	if pg.Config.PartialImport {
+		return pg.updatePartialTableStats(dest)
+	}
+	return nil
+}
 
-	for _, tableName := range pg.tableNames() {
+// rotateTables rotates all tables in a single transaction.
+func (pg *PostGIS) rotateTables(tableNames []string, source, dest, backup string) error {
+	return pg.withLockRetry(tableNames, []string{source, dest, backup}, func(tx *sql.Tx) error {
+		return pg.rotateTablesTx(tx, tableNames, source, dest, backup)
+	})
+}
+
+func (pg *PostGIS) rotateTablesTx(tx *sql.Tx, tableNames []string, source, dest, backup string) error {
+	for _, tableName := range tableNames {
 		tableName = pg.Prefix + tableName
 
 		log.Printf("[info] Rotating %s from %s -> %s -> %s", tableName, source, dest, backup)
@@ -42,6 +67,10 @@ func (pg *PostGIS) rotate(source, dest, backup string) error {
 		}
 
 		if !sourceExists {
+			if tableName == pg.Prefix+elementsTable || tableName == pg.Prefix+rejectsTable {
+				// elements and rejects tables are optional
+				continue
+			}
 			log.Printf("[warn] skipping rotate of %s, table does not exists in %s", tableName, source)
 			continue
 		}
@@ -49,34 +78,61 @@ func (pg *PostGIS) rotate(source, dest, backup string) error {
 		if destExists {
 			log.Printf("[info] backup of %s, to %s", tableName, backup)
 			if backupExists {
-				err = dropTableIfExists(tx, backup, tableName)
+				if tableName == pg.Prefix+elementsTable {
+					err = dropElementsTableIfExists(tx, backup, tableName)
+				} else {
+					err = dropTableIfExists(tx, backup, tableName)
+				}
 				if err != nil {
 					return err
 				}
 			}
-			sql := fmt.Sprintf(`ALTER TABLE "%s"."%s" SET SCHEMA "%s"`, dest, tableName, backup)
-			_, err = tx.Exec(sql)
-			if err != nil {
+			if err := setSchema(tx, dest, tableName, backup); err != nil {
 				return err
 			}
 		}
 
-		sql := fmt.Sprintf(`ALTER TABLE "%s"."%s" SET SCHEMA "%s"`, source, tableName, dest)
-		_, err = tx.Exec(sql)
-		if err != nil {
+		if err := setSchema(tx, source, tableName, dest); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	err = tx.Commit()
-	if err != nil {
-		return err
+// deployGroups returns the configured deploy groups in order, followed by a
+// group (without name) with all remaining tables. Returns a single group
+// with all tables if no deploy groups are configured.
+func (pg *PostGIS) deployGroups() []config.DeployGroup {
+	grouped := make(map[string]bool)
+	groups := []config.DeployGroup{}
+	for _, g := range pg.DeployGroups {
+		groups = append(groups, g)
+		for _, name := range g.Tables {
+			grouped[name] = true
+		}
 	}
-	tx = nil // set nil to prevent rollback
-	return nil
+	var remaining []string
+	for _, name := range pg.tableNames() {
+		if !grouped[name] {
+			remaining = append(remaining, name)
+		}
+	}
+	if len(remaining) > 0 {
+		sort.Strings(remaining)
+		groups = append(groups, config.DeployGroup{Tables: remaining})
+	}
+	return groups
 }
 
 func (pg *PostGIS) Deploy() error {
+	if err := pg.setLogged(); err != nil {
+		return err
+	}
+	for _, spec := range pg.Tables {
+		if err := createCustomIndexes(pg, spec); err != nil {
+			return err
+		}
+	}
 	return pg.rotate(pg.Config.ImportSchema, pg.Config.ProductionSchema, pg.Config.BackupSchema)
 }
 
@@ -85,30 +141,72 @@ func (pg *PostGIS) RevertDeploy() error {
 }
 
 func (pg *PostGIS) RemoveBackup() error {
-	tx, err := pg.Db.Begin()
-	if err != nil {
-		return err
-	}
-	defer rollbackIfTx(&tx)
-
 	backup := pg.Config.BackupSchema
+	tableNames := pg.tableNames()
+	return pg.withLockRetry(tableNames, []string{backup}, func(tx *sql.Tx) error {
+		for _, tableName := range tableNames {
+			tableName = pg.Prefix + tableName
 
-	for _, tableName := range pg.tableNames() {
-		tableName = pg.Prefix + tableName
-
-		backupExists, err := tableExists(tx, backup, tableName)
-		if err != nil {
-			return err
-		}
-		if backupExists {
-			log.Printf("[info] removing backup of %s from %s", tableName, backup)
-			err = dropTableIfExists(tx, backup, tableName)
+			backupExists, err := tableExists(tx, backup, tableName)
 			if err != nil {
 				return err
 			}
+			if backupExists {
+				log.Printf("[info] removing backup of %s from %s", tableName, backup)
+				if tableName == pg.Prefix+elementsTable {
+					err = dropElementsTableIfExists(tx, backup, tableName)
+				} else {
+					err = dropTableIfExists(tx, backup, tableName)
+				}
+				if err != nil {
+					return err
+				}
 
+			}
+		}
+		return nil
+	})
+}
+
+// withLockRetry calls f within a new transaction and commits it. The
+// transaction is retried with an increasing delay up to DeployRetries times
+// if a lock could not be acquired within DeployLockTimeout. The backends
+// that hold locks on the tables in schemas are logged before each retry.
+func (pg *PostGIS) withLockRetry(tableNames []string, schemas []string, f func(tx *sql.Tx) error) error {
+	delay := time.Second
+	for retry := 0; ; retry++ {
+		err := pg.lockTimeoutTx(f)
+		if err == nil || !isLockNotAvailable(err) {
+			return err
+		}
+		pg.logLockingBackends(tableNames, schemas)
+		if retry >= pg.Config.DeployRetries {
+			return errors.Wrapf(err, "tables still locked after %d retries", retry)
+		}
+		log.Printf("[warn] lock timeout, retrying in %s (%d/%d)", delay, retry+1, pg.Config.DeployRetries)
+		time.Sleep(delay)
+		if delay < time.Minute {
+			delay *= 2
 		}
 	}
+}
+
+func (pg *PostGIS) lockTimeoutTx(f func(tx *sql.Tx) error) error {
+	tx, err := pg.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollbackIfTx(&tx)
+
+	if pg.Config.DeployLockTimeout > 0 {
+		sql := fmt.Sprintf("SET LOCAL lock_timeout = %d", pg.Config.DeployLockTimeout/time.Millisecond)
+		if _, err := tx.Exec(sql); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+	if err := f(tx); err != nil {
+		return err
+	}
 
 	err = tx.Commit()
 	if err != nil {
@@ -118,7 +216,51 @@ func (pg *PostGIS) RemoveBackup() error {
 	return nil
 }
 
-// tableNames returns a list of all tables (without prefix).
+// isLockNotAvailable returns whether err was caused by a lock_timeout.
+func isLockNotAvailable(err error) bool {
+	if pqErr, ok := errors.Cause(err).(*pq.Error); ok && pqErr.Code == "55P03" {
+		return true
+	}
+	return false
+}
+
+// logLockingBackends logs all other backends that hold locks on the tables.
+func (pg *PostGIS) logLockingBackends(tableNames []string, schemas []string) {
+	var names []string
+	for _, name := range tableNames {
+		names = append(names, pg.Prefix+name)
+	}
+	rows, err := pg.Db.Query(`
+		SELECT DISTINCT a.pid, coalesce(a.usename, ''), coalesce(a.state, ''), n.nspname || '.' || c.relname, coalesce(left(a.query, 100), '')
+		FROM pg_locks l
+		JOIN pg_class c ON c.oid = l.relation
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.granted AND l.pid <> pg_backend_pid()
+		AND c.relname = ANY($1) AND n.nspname = ANY($2)`,
+		pq.Array(names), pq.Array(schemas),
+	)
+	if err != nil {
+		log.Printf("[warn] querying locking backends: %s", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pid int
+		var user, state, table, query string
+		if err := rows.Scan(&pid, &user, &state, &table, &query); err != nil {
+			log.Printf("[warn] querying locking backends: %s", err)
+			return
+		}
+		log.Printf("[warn] table %s locked by pid %d (user: %s, state: %s): %s", table, pid, user, state, query)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("[warn] querying locking backends: %s", err)
+	}
+}
+
+// tableNames returns a list of all tables (without prefix), including the
+// stats and errors table for complete imports.
 func (pg *PostGIS) tableNames() []string {
 	var names []string
 	for name := range pg.Tables {
@@ -127,5 +269,8 @@ func (pg *PostGIS) tableNames() []string {
 	for name := range pg.GeneralizedTables {
 		names = append(names, name)
 	}
+	if !pg.Config.PartialImport {
+		names = append(names, statsTable, elementsTable, rejectsTable)
+	}
 	return names
 }
@@ -0,0 +1,27 @@
+package postgis
+
+import (
+	"testing"
+
+	pq "github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+func TestIsLockNotAvailable(t *testing.T) {
+	lockErr := &pq.Error{Code: "55P03"}
+	for _, tc := range []struct {
+		err      error
+		expected bool
+	}{
+		{lockErr, true},
+		{&SQLError{"ALTER TABLE", lockErr}, true},
+		{errors.Wrap(&SQLError{"ALTER TABLE", lockErr}, "rotating"), true},
+		{&SQLInsertError{SQLError{"INSERT", lockErr}, nil}, true},
+		{&SQLError{"ALTER TABLE", &pq.Error{Code: "42P01"}}, false},
+		{errors.New("lock timeout"), false},
+	} {
+		if got := isLockNotAvailable(tc.err); got != tc.expected {
+			t.Errorf("isLockNotAvailable(%v) = %v, expected %v", tc.err, got, tc.expected)
+		}
+	}
+}
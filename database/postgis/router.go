@@ -2,6 +2,7 @@ package postgis
 
 import (
 	"database/sql"
+	"sort"
 
 	"github.com/pkg/errors"
 )
@@ -18,8 +19,14 @@ func newTxRouter(pg *PostGIS, bulkImport bool) (*TxRouter, error) {
 	}
 
 	if bulkImport {
+		connections := copyConnections(pg.Tables, pg.tableSizes, pg.copyConnections)
 		for tableName, table := range pg.Tables {
-			tt := NewBulkTableTx(pg, table)
+			var tt TableTx
+			if connections[tableName] > 1 {
+				tt = newParallelBulkTableTx(pg, table, connections[tableName])
+			} else {
+				tt = NewBulkTableTx(pg, table)
+			}
 			err := tt.Begin(nil)
 			if err != nil {
 				return nil, err
@@ -41,6 +48,10 @@ func newTxRouter(pg *PostGIS, bulkImport bool) (*TxRouter, error) {
 			txr.Tables[tableName] = tt
 		}
 		for tableName, table := range pg.GeneralizedTables {
+			if table.Merge {
+				// merged tables are updated with Exec, see GeneralizeUpdates
+				continue
+			}
 			tt := NewSynchronousTableTx(pg, table.FullName, table)
 			err := tt.Begin(tx)
 			if err != nil {
@@ -97,3 +108,53 @@ func (txr *TxRouter) Delete(table string, id int64) error {
 	}
 	return tt.Delete(id)
 }
+
+// Exec executes sql within the transaction. Only supported for non-bulk
+// imports.
+func (txr *TxRouter) Exec(sql string, args ...interface{}) error {
+	if txr.tx == nil {
+		return errors.New("Exec requires a transaction")
+	}
+	if _, err := txr.tx.Exec(sql, args...); err != nil {
+		return &SQLError{sql, err}
+	}
+	return nil
+}
+
+// copyConnections distributes the number of COPY connections to all tables.
+// Each table gets at least one connection. Additional connections are
+// assigned to the largest tables, based on sizes from previous imports.
+// Tables without known size are all treated equally.
+func copyConnections(tables map[string]*TableSpec, sizes map[string]int64, total int) map[string]int {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	connections := make(map[string]int, len(names))
+	for _, name := range names {
+		connections[name] = 1
+	}
+	if len(names) == 0 {
+		return connections
+	}
+
+	weight := func(name string) float64 {
+		if size := sizes[name]; size > 0 {
+			return float64(size)
+		}
+		return 1
+	}
+	for extra := total - len(names); extra > 0; extra-- {
+		// next connection for table with the most data per connection
+		best := names[0]
+		for _, name := range names[1:] {
+			if weight(name)/float64(connections[name]) > weight(best)/float64(connections[best]) {
+				best = name
+			}
+		}
+		connections[best]++
+	}
+	return connections
+}
@@ -0,0 +1,149 @@
+package postgis
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+// ShardSpec partitions a table by the values of a column. List partitions
+// have a partition for each value (e.g. each region) and a default
+// partition for all other rows. Hash partitions have Modulus partitions.
+type ShardSpec struct {
+	Column     string
+	Modulus    int
+	Partitions []PartitionSpec
+}
+
+type PartitionSpec struct {
+	FullName string
+	// Value is empty for the default partition and for hash partitions.
+	Value     string
+	Remainder int
+}
+
+func newShardSpec(fullName string, s *config.Shard) (*ShardSpec, error) {
+	regions, err := mapping.ShardRegions(s)
+	if err != nil {
+		return nil, err
+	}
+	return newListSpec(fullName, s.Column, regions)
+}
+
+func newPartitionSpec(fullName string, p *config.Partition) (*ShardSpec, error) {
+	if p.By != "hash" {
+		return newListSpec(fullName, p.Column, mapping.PartitionValues(p))
+	}
+	spec := ShardSpec{Column: p.Column, Modulus: p.Partitions}
+	for i := 0; i < p.Partitions; i++ {
+		spec.Partitions = append(spec.Partitions, PartitionSpec{
+			FullName:  fmt.Sprintf("%s_p%d", fullName, i),
+			Remainder: i,
+		})
+	}
+	return &spec, nil
+}
+
+func newListSpec(fullName, column string, values []string) (*ShardSpec, error) {
+	spec := ShardSpec{Column: column}
+	names := map[string]string{"default": ""}
+	for _, v := range values {
+		suffix := partitionSuffix(v)
+		if other, ok := names[suffix]; ok {
+			return nil, errors.Errorf("values %q and %q result in the same partition name", other, v)
+		}
+		names[suffix] = v
+		spec.Partitions = append(spec.Partitions, PartitionSpec{FullName: fullName + "_" + suffix, Value: v})
+	}
+	spec.Partitions = append(spec.Partitions, PartitionSpec{FullName: fullName + "_default"})
+	return &spec, nil
+}
+
+// partitionSuffix returns the value in lower case, with all characters
+// except a-z and 0-9 replaced by _.
+func partitionSuffix(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(value))
+}
+
+// PartitionBySQL returns the PARTITION BY clause of a sharded table.
+func (spec *ShardSpec) PartitionBySQL() string {
+	if spec.Modulus > 0 {
+		return fmt.Sprintf(` PARTITION BY HASH ("%s")`, spec.Column)
+	}
+	return fmt.Sprintf(` PARTITION BY LIST ("%s")`, spec.Column)
+}
+
+// CreatePartitionsSQL returns the statements to create all partitions of
+// a sharded table.
+func (spec *TableSpec) CreatePartitionsSQL() []string {
+	var stmts []string
+	for _, p := range spec.Shard.Partitions {
+		bounds := "DEFAULT"
+		if spec.Shard.Modulus > 0 {
+			bounds = fmt.Sprintf("FOR VALUES WITH (MODULUS %d, REMAINDER %d)", spec.Shard.Modulus, p.Remainder)
+		} else if p.Value != "" {
+			bounds = "FOR VALUES IN (" + quoteLiteral(p.Value) + ")"
+		}
+		unlogged := ""
+		if spec.Unlogged {
+			unlogged = "UNLOGGED "
+		}
+		stmts = append(stmts, fmt.Sprintf(`CREATE %sTABLE "%s"."%s" PARTITION OF "%s"."%s" %s%s`,
+			unlogged, spec.Schema, p.FullName, spec.Schema, spec.FullName, bounds, spec.partitionStorageSQL()))
+	}
+	return stmts
+}
+
+// partitions returns the schema and name of all partitions of a table.
+func partitions(tx *sql.Tx, schema, table string) ([][2]string, error) {
+	rows, err := tx.Query(`
+		SELECT cn.nspname, c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_namespace cn ON cn.oid = c.relnamespace
+		JOIN pg_class p ON p.oid = i.inhparent
+		JOIN pg_namespace pn ON pn.oid = p.relnamespace
+		WHERE pn.nspname = $1 AND p.relname = $2`, schema, table)
+	if err != nil {
+		return nil, errors.Wrapf(err, "querying partitions of %s.%s", schema, table)
+	}
+	defer rows.Close()
+	var result [][2]string
+	for rows.Next() {
+		var p [2]string
+		if err := rows.Scan(&p[0], &p[1]); err != nil {
+			return nil, errors.Wrapf(err, "querying partitions of %s.%s", schema, table)
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
+
+// setSchema moves a table and all its partitions to another schema.
+func setSchema(tx *sql.Tx, schema, table, newSchema string) error {
+	parts, err := partitions(tx, schema, table)
+	if err != nil {
+		return err
+	}
+	sql := fmt.Sprintf(`ALTER TABLE "%s"."%s" SET SCHEMA "%s"`, schema, table, newSchema)
+	if _, err := tx.Exec(sql); err != nil {
+		return &SQLError{sql, err}
+	}
+	for _, p := range parts {
+		sql := fmt.Sprintf(`ALTER TABLE "%s"."%s" SET SCHEMA "%s"`, p[0], p[1], newSchema)
+		if _, err := tx.Exec(sql); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+	return nil
+}
@@ -6,22 +6,44 @@ import (
 
 	"github.com/omniscale/imposm3/mapping"
 	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/omniscale/imposm3/proj"
 	"github.com/pkg/errors"
 )
 
 type ColumnSpec struct {
-	Name      string
-	FieldType mapping.ColumnType
-	Type      ColumnType
+	Name        string
+	FieldType   mapping.ColumnType
+	Type        ColumnType
+	Storage     string
+	Compression string
+	Description string
 }
 type TableSpec struct {
-	Name            string
-	FullName        string
-	Schema          string
-	Columns         []ColumnSpec
-	GeometryType    string
-	Srid            int
+	Name         string
+	FullName     string
+	Schema       string
+	Columns      []ColumnSpec
+	GeometryType string
+	Srid         int
+	// transform is set for tables with a different SRID than the import.
+	transform       func(x, y float64) (float64, float64)
 	Generalizations []*GeneralizedTableSpec
+	// Shard is set for tables that are partitioned by region or with the
+	// partition option.
+	Shard       *ShardSpec
+	Description string
+	Tablespace  string
+	Fillfactor  int
+	Unlogged    bool
+	Indexes     []IndexSpec
+}
+
+// IndexSpec is an additional index of a table from the mapping.
+type IndexSpec struct {
+	FullName string
+	Columns  []string
+	Method   string
+	Where    string
 }
 
 type GeneralizedTableSpec struct {
@@ -33,8 +55,13 @@ type GeneralizedTableSpec struct {
 	SourceGeneralized *GeneralizedTableSpec
 	Tolerance         float64
 	Where             string
-	created           bool
+	ExtraColumns      []config.GeneralizedColumn
+	Merge             bool
+	GroupBy           []string
 	Generalizations   []*GeneralizedTableSpec
+	Description       string
+	// ImportSrid is the SRID of the import, the unit of the Tolerance.
+	ImportSrid int
 }
 
 func (col *ColumnSpec) AsSQL() string {
@@ -70,19 +97,120 @@ func (spec *TableSpec) CreateTableSQL() string {
 	// Make composite PRIMARY KEY of serial `id` and OSM ID. But only if the
 	// user did not provide a custom `id` colum which might not be unique.
 	if pkCols != nil && !foundIDCol {
-		cols = append(cols, `PRIMARY KEY ("`+strings.Join(pkCols, `", "`)+`")`)
+		if spec.Shard != nil {
+			// primary keys of partitioned tables need the partition column
+			found := false
+			for _, c := range pkCols {
+				if c == spec.Shard.Column {
+					found = true
+				}
+			}
+			if !found {
+				pkCols = append(pkCols, spec.Shard.Column)
+			}
+		}
+		pk := `PRIMARY KEY ("` + strings.Join(pkCols, `", "`) + `")`
+		if spec.Tablespace != "" && spec.Shard == nil {
+			pk += fmt.Sprintf(` USING INDEX TABLESPACE "%s"`, spec.Tablespace)
+		}
+		cols = append(cols, pk)
 	}
 	columnSQL := strings.Join(cols, ",\n")
+	// storage options of partitioned tables are set for each partition
+	partitionSQL := ""
+	if spec.Shard != nil {
+		partitionSQL = spec.Shard.PartitionBySQL()
+	}
 	return fmt.Sprintf(`
-        CREATE TABLE IF NOT EXISTS "%s"."%s" (
+        CREATE %sTABLE IF NOT EXISTS "%s"."%s" (
             %s
-        );`,
+        )%s;`,
+		spec.unloggedSQL(),
 		spec.Schema,
 		spec.FullName,
 		columnSQL,
+		partitionSQL+spec.storageSQL(),
 	)
 }
 
+// unloggedSQL returns UNLOGGED for unlogged tables and partitions.
+func (spec *TableSpec) unloggedSQL() string {
+	if spec.Unlogged && spec.Shard == nil {
+		return "UNLOGGED "
+	}
+	return ""
+}
+
+// storageSQL returns the WITH and TABLESPACE clauses of tables and
+// partitions.
+func (spec *TableSpec) storageSQL() string {
+	if spec.Shard != nil {
+		return ""
+	}
+	return spec.partitionStorageSQL()
+}
+
+func (spec *TableSpec) partitionStorageSQL() string {
+	sql := ""
+	if spec.Fillfactor != 0 {
+		sql += fmt.Sprintf(" WITH (fillfactor=%d)", spec.Fillfactor)
+	}
+	if spec.Tablespace != "" {
+		sql += fmt.Sprintf(` TABLESPACE "%s"`, spec.Tablespace)
+	}
+	return sql
+}
+
+// ColumnStorageSQL returns ALTER TABLE statements for all columns with
+// custom storage or compression options.
+func (spec *TableSpec) ColumnStorageSQL() []string {
+	var stmts []string
+	for _, col := range spec.Columns {
+		if col.Storage != "" {
+			stmts = append(stmts, fmt.Sprintf(`ALTER TABLE "%s"."%s" ALTER COLUMN "%s" SET STORAGE %s`,
+				spec.Schema, spec.FullName, col.Name, col.Storage))
+		}
+		if col.Compression != "" {
+			stmts = append(stmts, fmt.Sprintf(`ALTER TABLE "%s"."%s" ALTER COLUMN "%s" SET COMPRESSION %s`,
+				spec.Schema, spec.FullName, col.Name, col.Compression))
+		}
+	}
+	return stmts
+}
+
+// CommentSQL returns the COMMENT statements for the descriptions of the
+// table and the columns.
+func (spec *TableSpec) CommentSQL() []string {
+	return commentSQL(spec.Schema, spec.FullName, spec.Description, spec.Columns)
+}
+
+// CommentSQL returns the COMMENT statements for the description of the
+// generalized table and the descriptions of the columns of the source table.
+func (spec *GeneralizedTableSpec) CommentSQL() []string {
+	return commentSQL(spec.Schema, spec.FullName, spec.Description, spec.Columns())
+}
+
+func commentSQL(schema, table, description string, columns []ColumnSpec) []string {
+	var stmts []string
+	if description != "" {
+		stmts = append(stmts, fmt.Sprintf(`COMMENT ON TABLE "%s"."%s" IS %s`,
+			schema, table, quoteLiteral(description)))
+	}
+	for _, col := range columns {
+		if col.Description != "" {
+			stmts = append(stmts, fmt.Sprintf(`COMMENT ON COLUMN "%s"."%s"."%s" IS %s`,
+				schema, table, col.Name, quoteLiteral(col.Description)))
+		}
+	}
+	return stmts
+}
+
+// quoteLiteral quotes s as SQL string literal. Backslashes are literal
+// with standard_conforming_strings, the default since PostgreSQL 9.1.
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
 func (spec *TableSpec) InsertSQL() string {
 	var cols []string
 	var vars []string
@@ -140,6 +268,8 @@ func NewTableSpec(pg *PostGIS, t *config.Table) (*TableSpec, error) {
 	var geomType string
 	if mapping.TableType(t.Type) == mapping.RelationMemberTable {
 		geomType = "geometry"
+	} else if t.RouteGeometry != nil {
+		geomType = "multilinestring"
 	} else {
 		geomType = string(t.Type)
 	}
@@ -150,6 +280,21 @@ func NewTableSpec(pg *PostGIS, t *config.Table) (*TableSpec, error) {
 		Schema:       pg.Config.ImportSchema,
 		GeometryType: geomType,
 		Srid:         pg.Config.Srid,
+		Description:  t.Description,
+		Tablespace:   t.Tablespace,
+		Fillfactor:   t.Fillfactor,
+		Unlogged:     t.Unlogged,
+	}
+	if t.Srid != 0 && t.Srid != pg.Config.Srid {
+		transform, err := proj.Transformer(pg.Config.Srid, t.Srid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "srid of table %s", t.Name)
+		}
+		spec.Srid = t.Srid
+		spec.transform = transform
+	}
+	if spec.Fillfactor != 0 && (spec.Fillfactor < 10 || spec.Fillfactor > 100) {
+		return nil, errors.Errorf("fillfactor of table %s needs to be between 10 and 100", t.Name)
 	}
 	for _, column := range t.Columns {
 		columnType, err := mapping.MakeColumnType(column)
@@ -160,71 +305,346 @@ func NewTableSpec(pg *PostGIS, t *config.Table) (*TableSpec, error) {
 		if !ok {
 			return nil, errors.Errorf("unhandled column type %v, using string type", columnType)
 		}
-		col := ColumnSpec{column.Name, *columnType, pgType}
+		col := ColumnSpec{
+			Name:        column.Name,
+			FieldType:   *columnType,
+			Type:        pgType,
+			Description: column.Description,
+		}
+		if column.Storage != "" {
+			col.Storage = strings.ToUpper(column.Storage)
+			switch col.Storage {
+			case "PLAIN", "EXTERNAL", "EXTENDED", "MAIN":
+			default:
+				return nil, errors.Errorf("unknown storage %q for column %s (PLAIN, EXTERNAL, EXTENDED or MAIN)", column.Storage, column.Name)
+			}
+		}
+		if column.Compression != "" {
+			col.Compression = strings.ToLower(column.Compression)
+			switch col.Compression {
+			case "pglz", "lz4", "default":
+			default:
+				return nil, errors.Errorf("unknown compression %q for column %s (pglz or lz4)", column.Compression, column.Name)
+			}
+		}
 		spec.Columns = append(spec.Columns, col)
 	}
+	for _, idx := range t.Indexes {
+		spec.Indexes = append(spec.Indexes, IndexSpec{
+			FullName: pg.Prefix + idx.Name,
+			Columns:  idx.Columns,
+			Method:   idx.Method,
+			Where:    idx.Where,
+		})
+	}
+	if t.Shard != nil {
+		shard, err := newShardSpec(spec.FullName, t.Shard)
+		if err != nil {
+			return nil, err
+		}
+		spec.Shard = shard
+	}
+	if t.Partition != nil {
+		shard, err := newPartitionSpec(spec.FullName, t.Partition)
+		if err != nil {
+			return nil, err
+		}
+		spec.Shard = shard
+	}
 	return &spec, nil
 }
 
 func NewGeneralizedTableSpec(pg *PostGIS, t *config.GeneralizedTable) *GeneralizedTableSpec {
 	spec := GeneralizedTableSpec{
-		Name:       t.Name,
-		FullName:   pg.Prefix + t.Name,
-		Schema:     pg.Config.ImportSchema,
-		Tolerance:  t.Tolerance,
-		Where:      t.SQLFilter,
-		SourceName: t.SourceTableName,
+		Name:         t.Name,
+		FullName:     pg.Prefix + t.Name,
+		Schema:       pg.Config.ImportSchema,
+		Tolerance:    t.Tolerance,
+		Where:        t.SQLFilter,
+		SourceName:   t.SourceTableName,
+		ExtraColumns: t.Columns,
+		Merge:        t.Merge,
+		GroupBy:      t.GroupBy,
+		Description:  t.Description,
+		ImportSrid:   pg.Config.Srid,
 	}
 	return &spec
 }
 
-func (spec *GeneralizedTableSpec) DeleteSQL() string {
-	var idColumnName string
-	for _, col := range spec.Source.Columns {
-		if col.FieldType.Name == "id" {
-			idColumnName = col.Name
-			break
-		}
+// simplifySQL returns the SQL to simplify the geometry expr with the
+// tolerance. Geometries of tables with a custom srid are simplified in the
+// SRID of the import, as the tolerance is in the unit of the import.
+func (spec *GeneralizedTableSpec) simplifySQL(expr string) string {
+	if spec.Source == nil || spec.ImportSrid == 0 || spec.Source.Srid == spec.ImportSrid {
+		return fmt.Sprintf(`ST_SimplifyPreserveTopology(%s, %f)`, expr, spec.Tolerance)
 	}
+	return fmt.Sprintf(`ST_Transform(ST_SimplifyPreserveTopology(ST_Transform(%s, %d), %f), %d)`,
+		expr, spec.ImportSrid, spec.Tolerance, spec.Source.Srid)
+}
 
-	if idColumnName == "" {
-		panic("missing id column")
+// sourceTable returns the schema and name of the table the generalized
+// table selects from.
+func (spec *GeneralizedTableSpec) sourceTable() (string, string) {
+	if spec.SourceGeneralized != nil {
+		return spec.SourceGeneralized.Schema, spec.SourceGeneralized.FullName
 	}
+	return spec.Source.Schema, spec.Source.FullName
+}
 
-	return fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE "%s" = $1`,
-		spec.Schema,
-		spec.FullName,
-		idColumnName,
-	)
+// Columns returns the columns of the generalized table, without the extra
+// SQL columns. Merged tables only contain the ID, the geometry and the
+// group_by columns of the source.
+func (spec *GeneralizedTableSpec) Columns() []ColumnSpec {
+	var source []ColumnSpec
+	if spec.SourceGeneralized != nil {
+		source = spec.SourceGeneralized.Columns()
+	} else {
+		source = spec.Source.Columns
+	}
+	if !spec.Merge {
+		return source
+	}
+
+	groupBy := make(map[string]bool, len(spec.GroupBy))
+	for _, name := range spec.GroupBy {
+		groupBy[name] = true
+	}
+	var cols []ColumnSpec
+	for _, col := range source {
+		if col.FieldType.Name == "id" || isMainGeometry(col) || groupBy[col.Name] {
+			cols = append(cols, col)
+		}
+	}
+	return cols
 }
 
-func (spec *GeneralizedTableSpec) InsertSQL() string {
-	var idColumnName string
+func isMainGeometry(col ColumnSpec) bool {
+	if _, ok := col.Type.(*extraGeometryType); ok {
+		return false
+	}
+	return col.Type.Name() == "GEOMETRY"
+}
+
+func (spec *GeneralizedTableSpec) idColumn() string {
 	for _, col := range spec.Source.Columns {
 		if col.FieldType.Name == "id" {
-			idColumnName = col.Name
-			break
+			return col.Name
 		}
 	}
+	panic("missing id column")
+}
 
-	if idColumnName == "" {
-		panic("missing id column")
+// extraColumnNames returns the names of the extra SQL columns of the
+// table, including the extra columns that are copied from a generalized
+// source table. Merged tables only contain their own extra columns.
+func (spec *GeneralizedTableSpec) extraColumnNames() []string {
+	names := spec.inheritedColumnNames()
+	for _, col := range spec.ExtraColumns {
+		names = append(names, col.Name)
+	}
+	return names
+}
+
+// inheritedColumnNames returns the names of the extra columns of the
+// generalized source table, without columns that are replaced by an extra
+// column of the same name.
+func (spec *GeneralizedTableSpec) inheritedColumnNames() []string {
+	if spec.SourceGeneralized == nil || spec.Merge {
+		return nil
+	}
+	own := make(map[string]bool, len(spec.ExtraColumns))
+	for _, col := range spec.ExtraColumns {
+		own[col.Name] = true
 	}
+	var names []string
+	for _, name := range spec.SourceGeneralized.extraColumnNames() {
+		if !own[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
 
+// selectColumnsSQL returns the (generalized) columns of the source,
+// followed by the extra columns of the source and of the table.
+func (spec *GeneralizedTableSpec) selectColumnsSQL() string {
 	var cols []string
-	for _, col := range spec.Source.Columns {
+	for _, col := range spec.Columns() {
 		cols = append(cols, col.Type.GeneralizeSQL(&col, spec))
 	}
+	for _, name := range spec.inheritedColumnNames() {
+		cols = append(cols, `"`+name+`"`)
+	}
+	for _, col := range spec.ExtraColumns {
+		cols = append(cols, fmt.Sprintf(`(%s) as "%s"`, col.SQL, col.Name))
+	}
+	return strings.Join(cols, ",\n")
+}
 
-	where := fmt.Sprintf(` WHERE "%s" = $1`, idColumnName)
+// SelectSQL returns the query for all rows of the generalized table.
+func (spec *GeneralizedTableSpec) SelectSQL() string {
+	if spec.Merge {
+		return spec.mergedSelectSQL("")
+	}
+	var where string
+	if spec.Where != "" {
+		where = " WHERE " + spec.Where
+	}
+	schema, table := spec.sourceTable()
+	return fmt.Sprintf(`SELECT %s FROM "%s"."%s"%s`,
+		spec.selectColumnsSQL(), schema, table, where)
+}
+
+// mergedIDsColumn is the column of merged tables with the IDs of all
+// source rows of a merged polygon. It is required to update only the
+// changed polygons during diff imports.
+const mergedIDsColumn = "imposm_ids"
+
+// mergedSelectSQL returns the query for merged tables. Touching polygons
+// with the same group_by values are clustered with ST_ClusterDBSCAN and
+// then dissolved with ST_Union. The ID of a merged polygon is the smallest
+// ID of the cluster. Extra columns need to be aggregate expressions. Only
+// source rows that match filter are merged, if it is not empty.
+func (spec *GeneralizedTableSpec) mergedSelectSQL(filter string) string {
+	var cols, groupBy []string
+	var geomColumn string
+	for _, col := range spec.Columns() {
+		switch {
+		case col.FieldType.Name == "id":
+			cols = append(cols, fmt.Sprintf(`min("%s") as "%s"`, col.Name, col.Name))
+		case isMainGeometry(col):
+			if geomColumn == "" {
+				geomColumn = col.Name
+			}
+			union := spec.simplifySQL(fmt.Sprintf(`ST_Union("%s")`, col.Name))
+			if _, ok := col.Type.(*validatedGeometryType); ok {
+				union = fmt.Sprintf(`ST_Buffer(%s, 0)`, union)
+			}
+			cols = append(cols, fmt.Sprintf(`%s as "%s"`, union, col.Name))
+		default:
+			cols = append(cols, `"`+col.Name+`"`)
+			groupBy = append(groupBy, `"`+col.Name+`"`)
+		}
+	}
+	for _, col := range spec.ExtraColumns {
+		cols = append(cols, fmt.Sprintf(`(%s) as "%s"`, col.SQL, col.Name))
+	}
+	if spec.mergedSource() {
+		// IDs of the source elements, not of the merged source polygons
+		cols = append(cols, fmt.Sprintf(`string_to_array(string_agg(array_to_string("%[1]s", ','), ','), ',')::bigint[] as "%[1]s"`, mergedIDsColumn))
+	} else {
+		cols = append(cols, fmt.Sprintf(`array_agg("%s") as "%s"`, spec.idColumn(), mergedIDsColumn))
+	}
+
+	var partition string
+	if len(groupBy) > 0 {
+		partition = "PARTITION BY " + strings.Join(groupBy, ", ")
+	}
+	return fmt.Sprintf(`SELECT %s FROM (SELECT *, ST_ClusterDBSCAN("%s", 0, 1) OVER (%s) AS imposm_cluster FROM (%s) AS source) AS clustered GROUP BY %s`,
+		strings.Join(cols, ",\n"), geomColumn, partition, spec.mergedSourceSQL(filter),
+		strings.Join(append(groupBy, "imposm_cluster"), ", "),
+	)
+}
+
+// mergedSourceSQL returns the query for the source rows of a merged table
+// that match the where option and filter, if it is not empty.
+func (spec *GeneralizedTableSpec) mergedSourceSQL(filter string) string {
+	var conds []string
+	if spec.Where != "" {
+		conds = append(conds, "("+spec.Where+")")
+	}
+	if filter != "" {
+		conds = append(conds, "("+filter+")")
+	}
+	var where string
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	schema, table := spec.sourceTable()
+	return fmt.Sprintf(`SELECT * FROM "%s"."%s"%s`, schema, table, where)
+}
+
+// mergedSource returns whether the source is a merged table. The source
+// rows are then identified by the IDs of all their merged elements.
+func (spec *GeneralizedTableSpec) mergedSource() bool {
+	return spec.SourceGeneralized != nil && spec.SourceGeneralized.Merge
+}
+
+// MergeUpdateSQL returns the statement to update a merged table after the
+// elements with the IDs in $1 (bigint[]) were inserted or deleted. Only
+// the merged polygons that contain one of these elements, or that touch
+// one of the inserted elements, are removed and merged again.
+func (spec *GeneralizedTableSpec) MergeUpdateSQL() string {
+	id := spec.idColumn()
+	var geomColumn string
+	touches := []string{}
+	for _, col := range spec.Columns() {
+		switch {
+		case col.FieldType.Name == "id":
+		case isMainGeometry(col):
+			if geomColumn == "" {
+				geomColumn = col.Name
+			}
+		default:
+			touches = append(touches, fmt.Sprintf(`changed."%s" IS NOT DISTINCT FROM other."%s"`, col.Name, col.Name))
+		}
+	}
+	touches = append(touches,
+		fmt.Sprintf(`changed."%s" && other."%s"`, geomColumn, geomColumn),
+		fmt.Sprintf(`ST_Intersects(changed."%s", other."%s")`, geomColumn, geomColumn),
+	)
+
+	// source rows with the changed elements, the IDs of the touching
+	// elements and the source rows that need to be merged again
+	changed := fmt.Sprintf(`changed."%s" = ANY($1)`, id)
+	touchingIDs := fmt.Sprintf(`other."%s"`, id)
+	remerge := fmt.Sprintf(`"%s" IN (SELECT id FROM touching UNION ALL SELECT unnest("%s") FROM deleted)`, id, mergedIDsColumn)
+	if spec.mergedSource() {
+		changed = fmt.Sprintf(`changed."%s" && $1::bigint[]`, mergedIDsColumn)
+		touchingIDs = fmt.Sprintf(`unnest(other."%s")`, mergedIDsColumn)
+		remerge = fmt.Sprintf(`"%[1]s" && ARRAY(SELECT id FROM touching UNION ALL SELECT unnest("%[1]s") FROM deleted)`, mergedIDsColumn)
+	}
+
+	source := spec.mergedSourceSQL("")
+	return fmt.Sprintf(`WITH touching AS (
+	SELECT %[1]s AS id FROM (%[2]s) AS changed JOIN (%[2]s) AS other ON %[3]s
+	WHERE %[4]s
+), deleted AS (
+	DELETE FROM "%[5]s"."%[6]s" WHERE "%[7]s" && (ARRAY(SELECT id FROM touching) || $1::bigint[])
+	RETURNING "%[7]s"
+)
+INSERT INTO "%[5]s"."%[6]s" (%[8]s)`,
+		touchingIDs, source, strings.Join(touches, " AND "), changed,
+		spec.Schema, spec.FullName, mergedIDsColumn,
+		spec.mergedSelectSQL(remerge),
+	)
+}
+
+// MergedIDsIndexSQL returns the statement for the index of the IDs of the
+// source rows of a merged table.
+func (spec *GeneralizedTableSpec) MergedIDsIndexSQL() string {
+	return fmt.Sprintf(`CREATE INDEX "%s_%s_idx" ON "%s"."%s" USING GIN ("%s")`,
+		spec.FullName, mergedIDsColumn, spec.Schema, spec.FullName, mergedIDsColumn)
+}
+
+func (spec *GeneralizedTableSpec) DeleteSQL() string {
+	return fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE "%s" = $1`,
+		spec.Schema,
+		spec.FullName,
+		spec.idColumn(),
+	)
+}
+
+func (spec *GeneralizedTableSpec) InsertSQL() string {
+	where := fmt.Sprintf(` WHERE "%s" = $1`, spec.idColumn())
 	if spec.Where != "" {
 		where += " AND (" + spec.Where + ")"
 	}
 
-	columnSQL := strings.Join(cols, ",\n")
+	// select from the generalized source, as in the initial generalization
+	sourceSchema, sourceTable := spec.sourceTable()
 	sql := fmt.Sprintf(`INSERT INTO "%s"."%s" (SELECT %s FROM "%s"."%s"%s)`,
-		spec.Schema, spec.FullName, columnSQL, spec.Source.Schema,
-		spec.Source.FullName, where)
+		spec.Schema, spec.FullName, spec.selectColumnsSQL(), sourceSchema,
+		sourceTable, where)
 	return sql
-
 }
@@ -0,0 +1,167 @@
+package postgis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/mapping"
+)
+
+func TestMergeUpdateSQL(t *testing.T) {
+	m, err := mapping.New([]byte(`
+tables:
+  landuse:
+    type: polygon
+    columns:
+      - {name: osm_id, type: id}
+      - {name: geometry, type: geometry}
+      - {name: type, type: mapping_value}
+    mapping:
+      landuse: [forest, meadow]
+generalized_tables:
+  landuse_merged:
+    source: landuse
+    tolerance: 10
+    merge: true
+    group_by: [type]
+  landuse_merged_gen1:
+    source: landuse_merged
+    tolerance: 50
+    merge: true
+    group_by: [type]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg := &PostGIS{
+		Config:            database.Config{ImportSchema: "public", Srid: 3857},
+		Prefix:            "osm_",
+		Tables:            make(map[string]*TableSpec),
+		GeneralizedTables: make(map[string]*GeneralizedTableSpec),
+	}
+	for name, table := range m.Conf.Tables {
+		spec, err := NewTableSpec(pg, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pg.Tables[name] = spec
+	}
+	for name, table := range m.Conf.GeneralizedTables {
+		pg.GeneralizedTables[name] = NewGeneralizedTableSpec(pg, table)
+	}
+	if pg.generalizedOrder, err = mapping.SortedGeneralizedTables(&m.Conf); err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.prepareGeneralizedTableSources(); err != nil {
+		t.Fatal(err)
+	}
+	spec := pg.GeneralizedTables["landuse_merged"]
+
+	if sql := spec.SelectSQL(); !strings.Contains(sql, `array_agg("osm_id") as "imposm_ids"`) {
+		t.Errorf("missing source IDs in\n%s", sql)
+	}
+
+	sql := spec.MergeUpdateSQL()
+	for _, expected := range []string{
+		// rows that touch the changed rows within the same group
+		`changed."type" IS NOT DISTINCT FROM other."type" AND changed."geometry" && other."geometry" AND ST_Intersects(changed."geometry", other."geometry")`,
+		// only merged polygons with changed or touching rows are removed
+		`DELETE FROM "public"."osm_landuse_merged" WHERE "imposm_ids" && (ARRAY(SELECT id FROM touching) || $1::bigint[])`,
+		// and merged again from their remaining rows
+		`WHERE ("osm_id" IN (SELECT id FROM touching UNION ALL SELECT unnest("imposm_ids") FROM deleted))`,
+		`INSERT INTO "public"."osm_landuse_merged" (SELECT min("osm_id") as "osm_id"`,
+	} {
+		if !strings.Contains(sql, expected) {
+			t.Errorf("missing %q in\n%s", expected, sql)
+		}
+	}
+
+	// merged source rows are identified by the IDs of their elements
+	spec = pg.GeneralizedTables["landuse_merged_gen1"]
+	if sql := spec.SelectSQL(); !strings.Contains(sql, `string_to_array(string_agg(array_to_string("imposm_ids", ','), ','), ',')::bigint[] as "imposm_ids"`) {
+		t.Errorf("missing element IDs in\n%s", sql)
+	}
+	sql = spec.MergeUpdateSQL()
+	for _, expected := range []string{
+		`SELECT unnest(other."imposm_ids") AS id FROM`,
+		`WHERE changed."imposm_ids" && $1::bigint[]`,
+		`WHERE ("imposm_ids" && ARRAY(SELECT id FROM touching UNION ALL SELECT unnest("imposm_ids") FROM deleted))`,
+	} {
+		if !strings.Contains(sql, expected) {
+			t.Errorf("missing %q in\n%s", expected, sql)
+		}
+	}
+}
+
+func TestGeneralizedExtraColumns(t *testing.T) {
+	m, err := mapping.New([]byte(`
+tables:
+  roads:
+    type: linestring
+    columns:
+      - {name: osm_id, type: id}
+      - {name: geometry, type: geometry}
+      - {name: type, type: mapping_value}
+    mapping:
+      highway: [__any__]
+generalized_tables:
+  roads_gen1:
+    source: roads
+    tolerance: 10
+    columns:
+      - name: length
+        sql: ST_Length(geometry)
+      - name: major
+        sql: type IN ('motorway', 'trunk')
+  roads_gen0:
+    source: roads_gen1
+    tolerance: 50
+    columns:
+      - name: major
+        sql: type = 'motorway'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg := &PostGIS{
+		Config:            database.Config{ImportSchema: "public", Srid: 3857},
+		Prefix:            "osm_",
+		Tables:            make(map[string]*TableSpec),
+		GeneralizedTables: make(map[string]*GeneralizedTableSpec),
+	}
+	for name, table := range m.Conf.Tables {
+		spec, err := NewTableSpec(pg, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pg.Tables[name] = spec
+	}
+	for name, table := range m.Conf.GeneralizedTables {
+		pg.GeneralizedTables[name] = NewGeneralizedTableSpec(pg, table)
+	}
+	if pg.generalizedOrder, err = mapping.SortedGeneralizedTables(&m.Conf); err != nil {
+		t.Fatal(err)
+	}
+	if err := pg.prepareGeneralizedTableSources(); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := pg.GeneralizedTables["roads_gen0"]
+	if names := spec.extraColumnNames(); len(names) != 2 || names[0] != "length" || names[1] != "major" {
+		t.Errorf("unexpected extra columns %v", names)
+	}
+	sql := spec.SelectSQL()
+	for _, expected := range []string{
+		`"length"`,
+		`(type = 'motorway') as "major"`,
+		`FROM "public"."osm_roads_gen1"`,
+	} {
+		if !strings.Contains(sql, expected) {
+			t.Errorf("missing %q in\n%s", expected, sql)
+		}
+	}
+	if strings.Contains(sql, `IN ('motorway', 'trunk')`) || strings.Count(sql, `"major"`) != 1 {
+		t.Errorf("replaced column of the source in\n%s", sql)
+	}
+}
@@ -0,0 +1,87 @@
+package postgis
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/omniscale/imposm3/log"
+	"github.com/pkg/errors"
+)
+
+// storageTables returns the names of the table or of all partitions of a
+// sharded table, as the storage options are set for each partition.
+func (spec *TableSpec) storageTables() []string {
+	if spec.Shard == nil {
+		return []string{spec.FullName}
+	}
+	var names []string
+	for _, p := range spec.Shard.Partitions {
+		names = append(names, p.FullName)
+	}
+	return names
+}
+
+// indexTablespaceSQL returns the TABLESPACE clause for the indexes of the
+// table. Indexes of sharded tables are in the default tablespace.
+func (spec *TableSpec) indexTablespaceSQL() string {
+	if spec.Tablespace == "" || spec.Shard != nil {
+		return ""
+	}
+	return fmt.Sprintf(` TABLESPACE "%s"`, spec.Tablespace)
+}
+
+// alterStorageSQL returns the statements to set the tablespace and
+// fillfactor of an existing table in schema.
+func (spec *TableSpec) alterStorageSQL(schema string) []string {
+	var stmts []string
+	for _, name := range spec.storageTables() {
+		if spec.Fillfactor != 0 {
+			stmts = append(stmts, fmt.Sprintf(`ALTER TABLE "%s"."%s" SET (fillfactor=%d)`,
+				schema, name, spec.Fillfactor))
+		} else {
+			stmts = append(stmts, fmt.Sprintf(`ALTER TABLE "%s"."%s" RESET (fillfactor)`, schema, name))
+		}
+		tablespace := "pg_default"
+		if spec.Tablespace != "" {
+			tablespace = spec.Tablespace
+		}
+		stmts = append(stmts, fmt.Sprintf(`ALTER TABLE "%s"."%s" SET TABLESPACE "%s"`,
+			schema, name, tablespace))
+	}
+	return stmts
+}
+
+// setLogged converts all unlogged tables in the import schema to logged
+// tables. PostgreSQL writes the complete table to the WAL.
+func (pg *PostGIS) setLogged() error {
+	schema := pg.Config.ImportSchema
+	for _, spec := range pg.Tables {
+		if !spec.Unlogged {
+			continue
+		}
+		for _, name := range spec.storageTables() {
+			var unlogged bool
+			err := pg.Db.QueryRow(`
+				SELECT c.relpersistence = 'u'
+				FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+				WHERE n.nspname = $1 AND c.relname = $2`, schema, name).Scan(&unlogged)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "checking persistence of %s", name)
+			}
+			if !unlogged {
+				continue
+			}
+			step := log.Step(fmt.Sprintf("Converting %s to logged table", name))
+			stmt := fmt.Sprintf(`ALTER TABLE "%s"."%s" SET LOGGED`, schema, name)
+			_, err = pg.Db.Exec(stmt)
+			step()
+			if err != nil {
+				return &SQLError{stmt, err}
+			}
+		}
+	}
+	return nil
+}
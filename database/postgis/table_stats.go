@@ -0,0 +1,227 @@
+package postgis
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	pq "github.com/lib/pq"
+	"github.com/omniscale/imposm3"
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/log"
+	"github.com/pkg/errors"
+)
+
+// statsTable is the name (without prefix) of the table with the row count,
+// the last modification and the last full rebuild of all tables.
+const statsTable = "table_stats"
+
+// SetSequence sets the sequence of the imported diff that is stored as
+// last_sequence for all modified tables.
+func (pg *PostGIS) SetSequence(seq int) {
+	pg.sequence = seq
+}
+
+// WrittenRows returns the number of inserted and deleted rows of the
+// current diff import.
+func (pg *PostGIS) WrittenRows() int64 {
+	if pg.txRouter == nil {
+		return 0
+	}
+	var rows int64
+	for _, tt := range pg.txRouter.Tables {
+		if stt, ok := tt.(*syncTableTx); ok {
+			rows += atomic.LoadInt64(&stt.changes)
+		}
+	}
+	return rows
+}
+
+// createTableStats (re)creates the stats table with the row counts of all
+// tables. Called after a full import.
+func (pg *PostGIS) createTableStats() error {
+	defer log.Step("Creating table stats")()
+	tx, err := pg.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollbackIfTx(&tx)
+
+	schema := pg.Config.ImportSchema
+	statsName := pg.Prefix + statsTable
+	if err := dropTableIfExists(tx, schema, statsName); err != nil {
+		return err
+	}
+	sql := fmt.Sprintf(`CREATE TABLE "%s"."%s" (
+		table_name TEXT PRIMARY KEY,
+		row_count BIGINT NOT NULL,
+		last_sequence BIGINT,
+		last_modified TIMESTAMP WITH TIME ZONE,
+		last_rebuild TIMESTAMP WITH TIME ZONE,
+		imposm_version TEXT,
+		format_version INT,
+		mapping_checksum TEXT
+	)`, schema, statsName)
+	if _, err := tx.Exec(sql); err != nil {
+		return &SQLError{sql, err}
+	}
+
+	for _, name := range pg.tableNames() {
+		switch name {
+		case statsTable, elementsTable, rejectsTable:
+			continue
+		}
+		sql := fmt.Sprintf(`INSERT INTO "%s"."%s"
+			SELECT '%s', count(*), NULL, now(), now(), $1, $2, $3 FROM "%s"."%s"`,
+			schema, statsName, pg.Prefix+name, schema, pg.Prefix+name)
+		if _, err := tx.Exec(sql, imposm3.Version, database.FormatVersion, pg.mappingChecksum()); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	tx = nil // set nil to prevent rollback
+	return nil
+}
+
+// updateTableStats updates the row counts of all modified tables within the
+// transaction of a diff import. Does nothing for bulk imports or if the
+// stats table does not exist (e.g. for imports from older versions).
+func (pg *PostGIS) updateTableStats() error {
+	tx := pg.txRouter.tx
+	if tx == nil {
+		return nil
+	}
+	schema := pg.Config.ImportSchema
+	statsName := pg.Prefix + statsTable
+	exists, err := tableExists(tx, schema, statsName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	var seq interface{}
+	if pg.sequence != 0 {
+		seq = pg.sequence
+	}
+	for name, tt := range pg.txRouter.Tables {
+		stt, ok := tt.(*syncTableTx)
+		if !ok {
+			continue
+		}
+		if atomic.LoadInt64(&stt.changes) == 0 {
+			continue
+		}
+		rows := atomic.LoadInt64(&stt.rows)
+		sql := fmt.Sprintf(`UPDATE "%s"."%s" SET row_count = row_count + $1,
+			last_sequence = coalesce($2, last_sequence), last_modified = now()
+			WHERE table_name = $3`, schema, statsName)
+		if _, err := tx.Exec(sql, rows, seq, pg.Prefix+name); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+	for _, name := range pg.recountTables {
+		sql := fmt.Sprintf(`UPDATE "%s"."%s" SET row_count = (SELECT count(*) FROM "%s"."%s"),
+			last_sequence = coalesce($1, last_sequence), last_modified = now()
+			WHERE table_name = $2`, schema, statsName, schema, pg.Prefix+name)
+		if _, err := tx.Exec(sql, seq, pg.Prefix+name); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+	pg.recountTables = nil
+	return nil
+}
+
+// checkStatsTableName returns an error if a table of the mapping conflicts
+// with the stats, elements or rejects table.
+func (pg *PostGIS) checkStatsTableName() error {
+	for _, name := range []string{statsTable, elementsTable, rejectsTable} {
+		if _, ok := pg.Tables[name]; ok {
+			return errors.Errorf("table name %q is reserved", name)
+		}
+		if _, ok := pg.GeneralizedTables[name]; ok {
+			return errors.Errorf("table name %q is reserved", name)
+		}
+	}
+	return nil
+}
+
+// updatePartialTableStats updates the row counts and the last rebuild of
+// the tables of a partial import in the stats table of schema. Does
+// nothing if the stats table does not exist.
+func (pg *PostGIS) updatePartialTableStats(schema string) error {
+	tx, err := pg.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollbackIfTx(&tx)
+
+	statsName := pg.Prefix + statsTable
+	exists, err := tableExists(tx, schema, statsName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	// stats tables of older versions have no version columns
+	sql := fmt.Sprintf(`ALTER TABLE "%s"."%s" ADD COLUMN IF NOT EXISTS imposm_version TEXT,
+		ADD COLUMN IF NOT EXISTS format_version INT,
+		ADD COLUMN IF NOT EXISTS mapping_checksum TEXT`, schema, statsName)
+	if _, err := tx.Exec(sql); err != nil {
+		return &SQLError{sql, err}
+	}
+	for _, name := range pg.tableNames() {
+		sql := fmt.Sprintf(`UPDATE "%s"."%s" SET row_count = (SELECT count(*) FROM "%s"."%s"),
+			last_modified = now(), last_rebuild = now(), imposm_version = $2, format_version = $3
+			WHERE table_name = $1`, schema, statsName, schema, pg.Prefix+name)
+		res, err := tx.Exec(sql, pg.Prefix+name, imposm3.Version, database.FormatVersion)
+		if err != nil {
+			return &SQLError{sql, err}
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			continue
+		}
+		// new table
+		sql = fmt.Sprintf(`INSERT INTO "%s"."%s"
+			SELECT '%s', count(*), NULL, now(), now(), $1, $2 FROM "%s"."%s"`,
+			schema, statsName, pg.Prefix+name, schema, pg.Prefix+name)
+		if _, err := tx.Exec(sql, imposm3.Version, database.FormatVersion); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+	// the mapping applies to all tables, not only to the imported tables
+	if checksum := pg.mappingChecksum(); checksum != nil {
+		sql := fmt.Sprintf(`UPDATE "%s"."%s" SET mapping_checksum = $1`, schema, statsName)
+		if _, err := tx.Exec(sql, checksum); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	tx = nil // set nil to prevent rollback
+	return nil
+}
+
+// LastSequence returns the highest sequence and the last modification
+// time of all tables from the stats table. Returns 0 if no sequence was
+// recorded.
+func (pg *PostGIS) LastSequence() (int, time.Time, error) {
+	var seq sql.NullInt64
+	var modified pq.NullTime
+	stmt := fmt.Sprintf(`SELECT max(last_sequence), max(last_modified) FROM "%s"."%s"`,
+		pg.Config.ImportSchema, pg.Prefix+statsTable)
+	if err := pg.Db.QueryRow(stmt).Scan(&seq, &modified); err != nil {
+		return 0, time.Time{}, &SQLError{stmt, err}
+	}
+	return int(seq.Int64), modified.Time, nil
+}
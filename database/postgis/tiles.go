@@ -0,0 +1,99 @@
+package postgis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/omniscale/imposm3/database"
+)
+
+// tileExtent is the extent of the rendered vector tiles, tileBuffer the
+// buffer around each tile in tile coordinates.
+const (
+	tileExtent = 4096
+	tileBuffer = 64
+)
+
+// webmercMax is the max x/y coordinate of EPSG:3857.
+const webmercMax = 20037508.342789244
+
+// TileLayers returns a layer for each table, sorted by name. Generalized
+// tables are not rendered.
+func (pg *PostGIS) TileLayers() []database.TileLayer {
+	layers := make([]database.TileLayer, 0, len(pg.Tables))
+	for name, spec := range pg.Tables {
+		layers = append(layers, database.TileLayer{Name: name, GeometryType: spec.GeometryType})
+	}
+	sort.Slice(layers, func(i, j int) bool { return layers[i].Name < layers[j].Name })
+	return layers
+}
+
+// Tile renders the vector tile z/x/y with ST_AsMVT. Each table is queried
+// separately and the layers are concatenated.
+func (pg *PostGIS) Tile(z, x, y int) ([]byte, error) {
+	size := 2 * webmercMax / math.Pow(2, float64(z))
+	minx := -webmercMax + float64(x)*size
+	maxy := webmercMax - float64(y)*size
+	buffer := size * tileBuffer / tileExtent
+
+	var tile []byte
+	for _, layer := range pg.TileLayers() {
+		sql := pg.Tables[layer.Name].tileSQL(layer.Name)
+		if sql == "" {
+			continue
+		}
+		var b []byte
+		if err := pg.Db.QueryRow(sql, minx, maxy-size, minx+size, maxy, buffer).Scan(&b); err != nil {
+			return nil, &SQLError{sql, err}
+		}
+		tile = append(tile, b...)
+	}
+	return tile, nil
+}
+
+// tileSQL returns the query for the vector tile layer of the table, or an
+// empty string for tables without geometry. The query expects the bbox of
+// the tile in EPSG:3857 and the buffer as parameters. Additional geometry
+// columns are not included, columns without a vector tile type (e.g. hstore)
+// are converted to text.
+func (spec *TableSpec) tileSQL(layer string) string {
+	geom := ""
+	cols := []string{}
+	for _, col := range spec.Columns {
+		if col.Type.Name() == "GEOMETRY" {
+			if geom == "" {
+				geom = col.Name
+			}
+			continue
+		}
+		switch col.Type.Name() {
+		case "VARCHAR", "BOOL", "SMALLINT", "INT", "BIGINT", "REAL":
+			cols = append(cols, fmt.Sprintf(`"%s"`, col.Name))
+		default:
+			cols = append(cols, fmt.Sprintf(`"%s"::text AS "%s"`, col.Name, col.Name))
+		}
+	}
+	if geom == "" {
+		return ""
+	}
+	envelope := "ST_MakeEnvelope($1, $2, $3, $4, 3857)"
+	return fmt.Sprintf(`SELECT ST_AsMVT(q, '%s', %d, '__geom') FROM (
+			SELECT ST_AsMVTGeom(ST_Transform("%s", 3857), %s, %d, %d, true) AS __geom%s
+			FROM "%s"."%s"
+			WHERE "%s" && ST_Transform(ST_Expand(%s, $5), %d)
+		) AS q WHERE __geom IS NOT NULL`,
+		strings.Replace(layer, "'", "''", -1), tileExtent,
+		geom, envelope, tileExtent, tileBuffer, prefixColumns(cols),
+		spec.Schema, spec.FullName,
+		geom, envelope, spec.Srid,
+	)
+}
+
+func prefixColumns(cols []string) string {
+	if len(cols) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(cols, ", ")
+}
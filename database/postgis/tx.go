@@ -4,8 +4,11 @@ import (
 	"database/sql"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/stats"
+	"github.com/pkg/errors"
 )
 
 type TableTx interface {
@@ -26,15 +29,33 @@ type bulkTableTx struct {
 	InsertSQL  string
 	wg         *sync.WaitGroup
 	rows       chan []interface{}
+	truncate   bool
+	// copied rows, only accessed by loop till End
+	copied int64
+	span   *stats.Span
+	// batch of rows for copyretry, see copyBatch
+	batch      [][]interface{}
+	retryStmt  *sql.Stmt
+	rejectStmt *sql.Stmt
+	rejected   int64
+	// chunk of rows for copychunksize, see copyChunk
+	chunk         [][]interface{}
+	chunkTxid     int64
+	retriedChunks int64
 }
 
 func NewBulkTableTx(pg *PostGIS, spec *TableSpec) TableTx {
+	return newBulkTableTx(pg, spec, make(chan []interface{}, 64), true)
+}
+
+func newBulkTableTx(pg *PostGIS, spec *TableSpec, rows chan []interface{}, truncate bool) *bulkTableTx {
 	tt := &bulkTableTx{
-		Pg:    pg,
-		Table: spec.FullName,
-		Spec:  spec,
-		wg:    &sync.WaitGroup{},
-		rows:  make(chan []interface{}, 64),
+		Pg:       pg,
+		Table:    spec.FullName,
+		Spec:     spec,
+		wg:       &sync.WaitGroup{},
+		rows:     rows,
+		truncate: truncate,
 	}
 	tt.wg.Add(1)
 	go tt.loop()
@@ -43,6 +64,9 @@ func NewBulkTableTx(pg *PostGIS, spec *TableSpec) TableTx {
 
 func (tt *bulkTableTx) Begin(tx *sql.Tx) error {
 	var err error
+	if tt.Pg.copyChunkSize > 0 {
+		return tt.beginChunks()
+	}
 	if tx == nil {
 		tx, err = tt.Pg.Db.Begin()
 		if err != nil {
@@ -50,13 +74,28 @@ func (tt *bulkTableTx) Begin(tx *sql.Tx) error {
 		}
 	}
 	tt.Tx = tx
+	tt.span = stats.StartChildSpan(nil, "copy "+tt.Table)
+	tt.span.SetAttribute("imposm.table", tt.Table)
 
-	_, err = tx.Exec(fmt.Sprintf(`TRUNCATE TABLE "%s"."%s" RESTART IDENTITY`, tt.Pg.Config.ImportSchema, tt.Table))
+	if tt.truncate && tt.Pg.bulkTruncate[tt.Spec.Name] {
+		_, err = tx.Exec(fmt.Sprintf(`TRUNCATE TABLE "%s"."%s" RESTART IDENTITY`, tt.Pg.Config.ImportSchema, tt.Table))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Commits of the bulk import do not need to wait for the WAL flush.
+	// The import is repeated anyway if the server crashes.
+	_, err = tx.Exec("SET LOCAL synchronous_commit TO OFF")
 	if err != nil {
 		return err
 	}
 
-	tt.InsertSQL = tt.Spec.CopySQL()
+	tt.InsertSQL = tt.copySQL()
+	if tt.Pg.copyRetry {
+		// COPY is prepared for each batch
+		return nil
+	}
 
 	stmt, err := tt.Tx.Prepare(tt.InsertSQL)
 	if err != nil {
@@ -67,12 +106,51 @@ func (tt *bulkTableTx) Begin(tx *sql.Tx) error {
 	return nil
 }
 
+// copySQL returns the COPY statement for the rows of the table.
+func (tt *bulkTableTx) copySQL() string {
+	sql := tt.Spec.CopySQL()
+	if tt.Pg.copyFreeze && tt.truncate && tt.Pg.bulkTruncate[tt.Spec.Name] && !tt.Pg.copyRetry && tt.Spec.Shard == nil {
+		// Table was truncated within this transaction, so we can insert rows
+		// already frozen. This avoids rewriting all rows for hint bits and
+		// the following VACUUM. Not possible with copyretry, as the rows
+		// are copied in savepoints, and PostgreSQL does not support FREEZE
+		// for partitioned tables (shard and partition).
+		sql += " WITH (FREEZE)"
+	}
+	return sql
+}
+
+// beginChunks prepares the copy of the rows in chunks. Each chunk is
+// copied in a separate transaction, so the table is truncated in a separate
+// transaction and COPY FREEZE is not used.
+func (tt *bulkTableTx) beginChunks() error {
+	tt.span = stats.StartChildSpan(nil, "copy "+tt.Table)
+	tt.span.SetAttribute("imposm.table", tt.Table)
+
+	if tt.truncate && tt.Pg.bulkTruncate[tt.Spec.Name] {
+		sql := fmt.Sprintf(`TRUNCATE TABLE "%s"."%s" RESTART IDENTITY`, tt.Pg.Config.ImportSchema, tt.Table)
+		if _, err := tt.Pg.Db.Exec(sql); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+	tt.InsertSQL = tt.Spec.CopySQL()
+	return nil
+}
+
 func (tt *bulkTableTx) Insert(row []interface{}) error {
 	tt.rows <- row
 	return nil
 }
 
 func (tt *bulkTableTx) loop() {
+	if tt.Pg.copyChunkSize > 0 {
+		tt.chunkLoop()
+		return
+	}
+	if tt.Pg.copyRetry {
+		tt.batchLoop()
+		return
+	}
 	for row := range tt.rows {
 		_, err := tt.InsertStmt.Exec(row...)
 		if err != nil {
@@ -80,10 +158,124 @@ func (tt *bulkTableTx) loop() {
 			// Abort the import as the whole transaction is lost anyway.
 			log.Fatalf("[fatal] bulk insert into %q: %s", tt.Table, &SQLError{tt.InsertSQL, err})
 		}
+		tt.copied++
 	}
 	tt.wg.Done()
 }
 
+// batchLoop copies the rows in batches of copyBatchSize.
+func (tt *bulkTableTx) batchLoop() {
+	defer tt.wg.Done()
+	for row := range tt.rows {
+		tt.batch = append(tt.batch, row)
+		if len(tt.batch) < copyBatchSize {
+			continue
+		}
+		if err := tt.copyBatch(); err != nil {
+			log.Fatalf("[fatal] bulk insert into %q: %s", tt.Table, err)
+		}
+	}
+	if len(tt.batch) > 0 {
+		if err := tt.copyBatch(); err != nil {
+			log.Fatalf("[fatal] bulk insert into %q: %s", tt.Table, err)
+		}
+	}
+}
+
+// copyBatch copies all rows of the batch within a savepoint. The rows of
+// a rejected batch (e.g. invalid encoding or constraint violations) are
+// inserted one by one and the rejected rows are stored in the rejected
+// rows table.
+func (tt *bulkTableTx) copyBatch() error {
+	defer func() { tt.batch = tt.batch[:0] }()
+	copyErr, err := tt.copyRows(tt.batch)
+	if err != nil {
+		return err
+	}
+	if copyErr == nil {
+		tt.copied += int64(len(tt.batch))
+		return nil
+	}
+	log.Printf("[warn] COPY of %d rows into %q failed, inserting rows one by one: %s",
+		len(tt.batch), tt.Table, copyErr)
+	for _, row := range tt.batch {
+		if err := tt.insertRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyRows copies the rows within a savepoint. Returns copyErr if the COPY
+// failed and the savepoint was rolled back, err for all other errors.
+func (tt *bulkTableTx) copyRows(rows [][]interface{}) (copyErr error, err error) {
+	if _, err := tt.Tx.Exec("SAVEPOINT imposm_copy"); err != nil {
+		return nil, err
+	}
+	stmt, err := tt.Tx.Prepare(tt.InsertSQL)
+	if err != nil {
+		return nil, &SQLError{tt.InsertSQL, err}
+	}
+	for _, row := range rows {
+		if _, copyErr = stmt.Exec(row...); copyErr != nil {
+			break
+		}
+	}
+	if copyErr == nil {
+		// finish COPY
+		_, copyErr = stmt.Exec()
+	}
+	// stmt needs to be closed to end the COPY, even after errors
+	stmt.Close()
+	if copyErr != nil {
+		if _, err := tt.Tx.Exec("ROLLBACK TO SAVEPOINT imposm_copy"); err != nil {
+			return nil, err
+		}
+		return copyErr, nil
+	}
+	_, err = tt.Tx.Exec("RELEASE SAVEPOINT imposm_copy")
+	return nil, err
+}
+
+// insertRow inserts a single row within a savepoint. Rejected rows are
+// inserted into the rejects table.
+func (tt *bulkTableTx) insertRow(row []interface{}) error {
+	if tt.retryStmt == nil {
+		var err error
+		insertSQL := tt.Spec.InsertSQL()
+		if tt.retryStmt, err = tt.Tx.Prepare(insertSQL); err != nil {
+			return &SQLError{insertSQL, err}
+		}
+		rejectSQL := tt.Pg.insertRejectedRowSQL()
+		if tt.rejectStmt, err = tt.Tx.Prepare(rejectSQL); err != nil {
+			return &SQLError{rejectSQL, err}
+		}
+	}
+	if _, err := tt.Tx.Exec("SAVEPOINT imposm_row"); err != nil {
+		return err
+	}
+	_, insertErr := tt.retryStmt.Exec(row...)
+	if insertErr == nil {
+		tt.copied++
+		_, err := tt.Tx.Exec("RELEASE SAVEPOINT imposm_row")
+		return err
+	}
+	if _, err := tt.Tx.Exec("ROLLBACK TO SAVEPOINT imposm_row"); err != nil {
+		return err
+	}
+
+	var osmID interface{}
+	if idx := tt.Spec.idColumn(); idx >= 0 && idx < len(row) {
+		osmID = row[idx]
+	}
+	log.Printf("[warn] rejected row of %q (osm_id %v): %s", tt.Table, osmID, insertErr)
+	tt.rejected++
+	if _, err := tt.rejectStmt.Exec(tt.Table, osmID, insertErr.Error(), formatRow(tt.Spec, row)); err != nil {
+		return &SQLInsertError{SQLError{tt.Pg.insertRejectedRowSQL(), err}, row}
+	}
+	return nil
+}
+
 func (tt *bulkTableTx) Delete(id int64) error {
 	panic("unable to delete in bulkImport mode")
 }
@@ -95,13 +287,34 @@ func (tt *bulkTableTx) End() {
 
 func (tt *bulkTableTx) Commit() error {
 	tt.End()
+	return tt.commit()
+}
+
+// commit finishes the COPY and commits the transaction. Requires that
+// all rows are inserted (End).
+func (tt *bulkTableTx) commit() (err error) {
+	defer func() {
+		tt.span.SetAttribute("imposm.rows", tt.copied)
+		if tt.rejected > 0 {
+			tt.span.SetAttribute("imposm.rejected_rows", tt.rejected)
+			log.Printf("[warn] %d rows of %q rejected, see %s%s", tt.rejected, tt.Table, tt.Pg.Prefix, rejectsTable)
+		}
+		if tt.retriedChunks > 0 {
+			tt.span.SetAttribute("imposm.retried_chunks", tt.retriedChunks)
+		}
+		tt.span.SetError(err)
+		tt.span.End()
+	}()
+	if tt.Tx == nil {
+		// all chunks are already committed
+		return nil
+	}
 	if tt.InsertStmt != nil {
-		_, err := tt.InsertStmt.Exec()
-		if err != nil {
+		if _, err = tt.InsertStmt.Exec(); err != nil {
 			return err
 		}
 	}
-	err := tt.Tx.Commit()
+	err = tt.Tx.Commit()
 	if err != nil {
 		return err
 	}
@@ -110,10 +323,95 @@ func (tt *bulkTableTx) Commit() error {
 }
 
 func (tt *bulkTableTx) Rollback() {
+	if tt.Tx != nil {
+		tt.span.SetError(errors.New("rollback"))
+		tt.span.End()
+	}
 	rollbackIfTx(&tt.Tx)
 }
 
+// parallelBulkTableTx inserts rows into a single table with multiple
+// COPY connections.
+// The table is truncated in a separate transaction. COPY FREEZE is not
+// used, as it requires that the table is truncated in the same transaction.
+type parallelBulkTableTx struct {
+	Pg      *PostGIS
+	Table   string
+	Spec    *TableSpec
+	workers []*bulkTableTx
+	rows    chan []interface{}
+	end     sync.Once
+}
+
+func newParallelBulkTableTx(pg *PostGIS, spec *TableSpec, connections int) TableTx {
+	tt := &parallelBulkTableTx{
+		Pg:    pg,
+		Table: spec.FullName,
+		Spec:  spec,
+		rows:  make(chan []interface{}, 64*connections),
+	}
+	for i := 0; i < connections; i++ {
+		tt.workers = append(tt.workers, newBulkTableTx(pg, spec, tt.rows, false))
+	}
+	return tt
+}
+
+func (tt *parallelBulkTableTx) Begin(tx *sql.Tx) error {
+	if tt.Pg.bulkTruncate[tt.Spec.Name] {
+		sql := fmt.Sprintf(`TRUNCATE TABLE "%s"."%s" RESTART IDENTITY`, tt.Pg.Config.ImportSchema, tt.Table)
+		if _, err := tt.Pg.Db.Exec(sql); err != nil {
+			return &SQLError{sql, err}
+		}
+	}
+	for _, w := range tt.workers {
+		if err := w.Begin(nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tt *parallelBulkTableTx) Insert(row []interface{}) error {
+	tt.rows <- row
+	return nil
+}
+
+func (tt *parallelBulkTableTx) Delete(id int64) error {
+	panic("unable to delete in bulkImport mode")
+}
+
+func (tt *parallelBulkTableTx) End() {
+	tt.end.Do(func() {
+		close(tt.rows)
+		for _, w := range tt.workers {
+			w.wg.Wait()
+		}
+	})
+}
+
+func (tt *parallelBulkTableTx) Commit() error {
+	tt.End()
+	for _, w := range tt.workers {
+		if err := w.commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tt *parallelBulkTableTx) Rollback() {
+	for _, w := range tt.workers {
+		w.Rollback()
+	}
+}
+
 type syncTableTx struct {
+	// rows is the number of inserted minus the number of deleted rows,
+	// changes the number of all inserted and deleted rows (first for
+	// 64-bit alignment of atomic operations)
+	rows    int64
+	changes int64
+
 	Pg         *PostGIS
 	Tx         *sql.Tx
 	Table      string
@@ -122,6 +420,7 @@ type syncTableTx struct {
 	DeleteStmt *sql.Stmt
 	InsertSQL  string
 	DeleteSQL  string
+	span       *stats.Span
 }
 
 type tableSpec interface {
@@ -147,6 +446,8 @@ func (tt *syncTableTx) Begin(tx *sql.Tx) error {
 		}
 	}
 	tt.Tx = tx
+	tt.span = stats.StartChildSpan(nil, "update "+tt.Table)
+	tt.span.SetAttribute("imposm.table", tt.Table)
 
 	tt.InsertSQL = tt.Spec.InsertSQL()
 
@@ -167,26 +468,41 @@ func (tt *syncTableTx) Begin(tx *sql.Tx) error {
 }
 
 func (tt *syncTableTx) Insert(row []interface{}) error {
-	_, err := tt.InsertStmt.Exec(row...)
+	res, err := tt.InsertStmt.Exec(row...)
 	if err != nil {
 		return &SQLInsertError{SQLError{tt.InsertSQL, err}, row}
 	}
+	tt.count(res, 1)
 	return nil
 }
 
 func (tt *syncTableTx) Delete(id int64) error {
-	_, err := tt.DeleteStmt.Exec(id)
+	res, err := tt.DeleteStmt.Exec(id)
 	if err != nil {
 		return &SQLInsertError{SQLError{tt.DeleteSQL, err}, id}
 	}
+	tt.count(res, -1)
 	return nil
 }
 
+// count adds the affected rows to the row counts for the stats table.
+func (tt *syncTableTx) count(res sql.Result, sign int64) {
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return
+	}
+	atomic.AddInt64(&tt.rows, sign*n)
+	atomic.AddInt64(&tt.changes, n)
+}
+
 func (tt *syncTableTx) End() {
 }
 
 func (tt *syncTableTx) Commit() error {
+	tt.span.SetAttribute("imposm.rows", atomic.LoadInt64(&tt.changes))
 	err := tt.Tx.Commit()
+	tt.span.SetError(err)
+	tt.span.End()
 	if err != nil {
 		return err
 	}
@@ -195,5 +511,9 @@ func (tt *syncTableTx) Commit() error {
 }
 
 func (tt *syncTableTx) Rollback() {
+	if tt.Tx != nil {
+		tt.span.SetError(errors.New("rollback"))
+		tt.span.End()
+	}
 	rollbackIfTx(&tt.Tx)
 }
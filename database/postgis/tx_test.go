@@ -0,0 +1,62 @@
+package postgis
+
+import (
+	"io"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+func TestBulkTableTxCopySQL(t *testing.T) {
+	spec := &TableSpec{
+		Name:     "roads",
+		Schema:   "import",
+		FullName: "osm_roads",
+		Columns:  []ColumnSpec{{Name: "osm_id"}, {Name: "geometry"}},
+	}
+	pg := &PostGIS{copyFreeze: true, bulkTruncate: map[string]bool{"roads": true}}
+
+	tt := &bulkTableTx{Pg: pg, Spec: spec, truncate: true}
+	if sql := tt.copySQL(); sql != `COPY "import"."osm_roads" ("osm_id", "geometry") FROM STDIN WITH (FREEZE)` {
+		t.Error("unexpected COPY for table", sql)
+	}
+
+	tt.truncate = false
+	if sql := tt.copySQL(); sql != `COPY "import"."osm_roads" ("osm_id", "geometry") FROM STDIN` {
+		t.Error("unexpected COPY for table without truncate", sql)
+	}
+
+	// appended tables of a resumed import
+	tt.truncate = true
+	pg.bulkTruncate = map[string]bool{}
+	if sql := tt.copySQL(); sql != `COPY "import"."osm_roads" ("osm_id", "geometry") FROM STDIN` {
+		t.Error("unexpected COPY for appended table", sql)
+	}
+
+	// FREEZE is not supported for partitioned tables
+	pg.bulkTruncate = map[string]bool{"roads": true}
+	spec.Shard = &ShardSpec{Column: "region"}
+	tt.truncate = true
+	if sql := tt.copySQL(); sql != `COPY "import"."osm_roads" ("osm_id", "geometry") FROM STDIN` {
+		t.Error("unexpected COPY for sharded table", sql)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		transient bool
+	}{
+		{&pq.Error{Code: "08006"}, true},
+		{&pq.Error{Code: "40P01"}, true},
+		{&pq.Error{Code: "23505"}, false},
+		{errChunkInProgress, true},
+		{errors.Wrap(io.EOF, "copy"), true},
+		{errors.New("other"), false},
+	} {
+		if isTransientError(tc.err) != tc.transient {
+			t.Errorf("unexpected result for %v", tc.err)
+		}
+	}
+}
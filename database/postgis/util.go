@@ -4,10 +4,13 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/omniscale/imposm3/log"
+	"github.com/pkg/errors"
 )
 
 // disableDefaultSsl adds sslmode=disable to params
@@ -62,7 +65,142 @@ func stripPrefixFromConnectionParams(params string) (string, string) {
 	return params, prefix
 }
 
-func tableExists(tx *sql.Tx, schema, table string) (bool, error) {
+// stripCopyFreezeFromConnectionParams removes the copyfreeze parameter from
+// params. Returns false if copyfreeze=false was set.
+func stripCopyFreezeFromConnectionParams(params string) (string, bool) {
+	parts := strings.Fields(params)
+	for i, p := range parts {
+		if strings.HasPrefix(p, "copyfreeze=") {
+			value := strings.Replace(p, "copyfreeze=", "", 1)
+			parts = append(parts[:i], parts[i+1:]...)
+			params = strings.Join(parts, " ")
+			return params, !(value == "false" || value == "no" || value == "0")
+		}
+	}
+	return params, true
+}
+
+// stripCopyRetryFromConnectionParams removes the copyretry parameter from
+// params. Returns true if copyretry=true was set.
+func stripCopyRetryFromConnectionParams(params string) (string, bool) {
+	parts := strings.Fields(params)
+	for i, p := range parts {
+		if strings.HasPrefix(p, "copyretry=") {
+			value := strings.Replace(p, "copyretry=", "", 1)
+			parts = append(parts[:i], parts[i+1:]...)
+			params = strings.Join(parts, " ")
+			return params, value == "true" || value == "yes" || value == "1"
+		}
+	}
+	return params, false
+}
+
+// stripElementsTableFromConnectionParams removes the elementstable
+// parameter from params. Returns true if elementstable=true was set.
+func stripElementsTableFromConnectionParams(params string) (string, bool) {
+	params, value := stripConnectionParam(params, "elementstable")
+	return params, value == "true" || value == "yes" || value == "1"
+}
+
+// stripRejectsTableFromConnectionParams removes the rejectstable parameter
+// from params. Returns true if rejectstable=true was set.
+func stripRejectsTableFromConnectionParams(params string) (string, bool) {
+	params, value := stripConnectionParam(params, "rejectstable")
+	return params, value == "true" || value == "yes" || value == "1"
+}
+
+// stripCopyConnectionsFromConnectionParams removes the copyconnections
+// parameter from params. Returns 0 if it is not set.
+func stripCopyConnectionsFromConnectionParams(params string) (string, int, error) {
+	parts := strings.Fields(params)
+	for i, p := range parts {
+		if strings.HasPrefix(p, "copyconnections=") {
+			value := strings.Replace(p, "copyconnections=", "", 1)
+			parts = append(parts[:i], parts[i+1:]...)
+			params = strings.Join(parts, " ")
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return params, 0, errors.Errorf("invalid copyconnections=%s", value)
+			}
+			return params, n, nil
+		}
+	}
+	return params, 0, nil
+}
+
+// stripConnectionParam removes the key parameter from params and returns its
+// value. Returns an empty value if it is not set.
+func stripConnectionParam(params, key string) (string, string) {
+	parts := strings.Fields(params)
+	for i, p := range parts {
+		if strings.HasPrefix(p, key+"=") {
+			value := strings.Replace(p, key+"=", "", 1)
+			parts = append(parts[:i], parts[i+1:]...)
+			return strings.Join(parts, " "), value
+		}
+	}
+	return params, ""
+}
+
+// stripCopyChunksFromConnectionParams removes the copychunksize and
+// copychunkretries parameters from params. The size is 0 if it is not set.
+func stripCopyChunksFromConnectionParams(params string) (string, int, int, error) {
+	size, retries := 0, defaultCopyChunkRetries
+	var value string
+	var err error
+	if params, value = stripConnectionParam(params, "copychunksize"); value != "" {
+		size, err = strconv.Atoi(value)
+		if err != nil || size < 0 {
+			return params, 0, 0, errors.Errorf("invalid copychunksize=%s", value)
+		}
+	}
+	if params, value = stripConnectionParam(params, "copychunkretries"); value != "" {
+		retries, err = strconv.Atoi(value)
+		if err != nil || retries < 0 {
+			return params, 0, 0, errors.Errorf("invalid copychunkretries=%s", value)
+		}
+	}
+	return params, size, retries, nil
+}
+
+// stripPoolFromConnectionParams removes the maxconnections, keepalive and
+// connectretries parameters from params. maxconnections and connectretries
+// are 0 and keepalive is defaultKeepAlive if they are not set.
+func stripPoolFromConnectionParams(params string) (string, poolOptions, error) {
+	opts := poolOptions{keepAlive: defaultKeepAlive}
+	var value string
+	var err error
+	if params, value = stripConnectionParam(params, "maxconnections"); value != "" {
+		opts.maxConnections, err = strconv.Atoi(value)
+		if err != nil || opts.maxConnections < 0 {
+			return params, opts, errors.Errorf("invalid maxconnections=%s", value)
+		}
+	}
+	if params, value = stripConnectionParam(params, "keepalive"); value != "" {
+		if value == "0" {
+			opts.keepAlive = -1 // disabled
+		} else {
+			opts.keepAlive, err = time.ParseDuration(value)
+			if err != nil || opts.keepAlive <= 0 {
+				return params, opts, errors.Errorf("invalid keepalive=%s", value)
+			}
+		}
+	}
+	if params, value = stripConnectionParam(params, "connectretries"); value != "" {
+		opts.connectRetries, err = strconv.Atoi(value)
+		if err != nil || opts.connectRetries < 0 {
+			return params, opts, errors.Errorf("invalid connectretries=%s", value)
+		}
+	}
+	return params, opts, nil
+}
+
+// queryRower is implemented by *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func tableExists(tx queryRower, schema, table string) (bool, error) {
 	var exists bool
 	sql := fmt.Sprintf(`SELECT EXISTS(SELECT * FROM information_schema.tables WHERE table_name='%s' AND table_schema='%s')`,
 		table, schema)
@@ -0,0 +1,57 @@
+package postgis
+
+import (
+	"fmt"
+	"sort"
+
+	pq "github.com/lib/pq"
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/log"
+	"github.com/pkg/errors"
+)
+
+// TableStats returns the number of live and dead tuples of all tables in the
+// import schema (the production schema for diff imports), as reported by the
+// statistics collector.
+func (pg *PostGIS) TableStats() ([]database.TableStats, error) {
+	var names []string
+	for _, name := range pg.tableNames() {
+		names = append(names, pg.Prefix+name)
+	}
+	sort.Strings(names)
+
+	rows, err := pg.Db.Query(`
+		SELECT relname, n_live_tup, n_dead_tup
+		FROM pg_stat_user_tables
+		WHERE schemaname = $1 AND relname = ANY($2)
+		ORDER BY relname`,
+		pg.Config.ImportSchema, pq.Array(names),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying table stats")
+	}
+	defer rows.Close()
+
+	var stats []database.TableStats
+	for rows.Next() {
+		s := database.TableStats{}
+		if err := rows.Scan(&s.Table, &s.LiveTuples, &s.DeadTuples); err != nil {
+			return nil, errors.Wrap(err, "querying table stats")
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "querying table stats")
+	}
+	return stats, nil
+}
+
+// Vacuum runs VACUUM ANALYZE on a single table of the import schema.
+func (pg *PostGIS) Vacuum(table string) error {
+	defer log.Step(fmt.Sprintf("Vacuum %s", table))()
+	sql := fmt.Sprintf(`VACUUM ANALYZE "%s"."%s"`, pg.Config.ImportSchema, table)
+	if _, err := pg.Db.Exec(sql); err != nil {
+		return &SQLError{sql, err}
+	}
+	return nil
+}
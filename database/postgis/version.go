@@ -0,0 +1,106 @@
+package postgis
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/omniscale/imposm3"
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/log"
+	"github.com/pkg/errors"
+)
+
+// CheckVersion returns an error if tables in the production schema were
+// imported with a different database.FormatVersion. The version is stored
+// in the stats table. Tables of older versions without version in the
+// stats table are accepted.
+func (pg *PostGIS) CheckVersion() error {
+	schema := pg.Config.ProductionSchema
+	statsName := pg.Prefix + statsTable
+
+	var hasVersion bool
+	stmt := `SELECT EXISTS(SELECT * FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2 AND column_name = 'format_version')`
+	if err := pg.Db.QueryRow(stmt, schema, statsName).Scan(&hasVersion); err != nil {
+		return &SQLError{stmt, err}
+	}
+	if !hasVersion {
+		return nil
+	}
+
+	stmt = fmt.Sprintf(`SELECT table_name, imposm_version, format_version FROM "%s"."%s"
+		WHERE format_version <> $1 ORDER BY table_name`, schema, statsName)
+	rows, err := pg.Db.Query(stmt, database.FormatVersion)
+	if err != nil {
+		return &SQLError{stmt, err}
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		var version sql.NullString
+		var format int
+		if err := rows.Scan(&name, &version, &format); err != nil {
+			return &SQLError{stmt, err}
+		}
+		tables = append(tables, fmt.Sprintf("%s (Imposm %s, format %d)", name, version.String, format))
+	}
+	if err := rows.Err(); err != nil {
+		return &SQLError{stmt, err}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	return errors.Errorf("tables in schema %s have an incompatible database format: %s, but Imposm %s requires format %d: "+
+		"use the Imposm version of the import or import all tables again",
+		schema, strings.Join(tables, ", "), imposm3.Version, database.FormatVersion)
+}
+
+// mappingChecksum returns the checksum of the mapping for the stats table,
+// or nil if it is unknown.
+func (pg *PostGIS) mappingChecksum() interface{} {
+	if pg.Config.MappingChecksum == "" {
+		return nil
+	}
+	return pg.Config.MappingChecksum
+}
+
+// CheckMappingChecksum returns an error if tables in the production schema
+// were imported with a mapping with another checksum. The checksum is
+// stored in the stats table. Tables of older versions without checksum are
+// accepted. If force is true, the stored checksum is replaced.
+func (pg *PostGIS) CheckMappingChecksum(checksum string, force bool) error {
+	schema := pg.Config.ProductionSchema
+	statsName := pg.Prefix + statsTable
+
+	var hasChecksum bool
+	stmt := `SELECT EXISTS(SELECT * FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2 AND column_name = 'mapping_checksum')`
+	if err := pg.Db.QueryRow(stmt, schema, statsName).Scan(&hasChecksum); err != nil {
+		return &SQLError{stmt, err}
+	}
+	if !hasChecksum {
+		return nil
+	}
+
+	var changed bool
+	stmt = fmt.Sprintf(`SELECT EXISTS(SELECT * FROM "%s"."%s"
+		WHERE mapping_checksum <> $1)`, schema, statsName)
+	if err := pg.Db.QueryRow(stmt, checksum).Scan(&changed); err != nil {
+		return &SQLError{stmt, err}
+	}
+	if !changed {
+		return nil
+	}
+	if !force {
+		return errors.Errorf("tables in schema %s were imported with another mapping, re-import or use -force-mapping-change", schema)
+	}
+	log.Printf("[warn] Mapping changed since the import, updating mapping checksum in schema %s (-force-mapping-change)", schema)
+	stmt = fmt.Sprintf(`UPDATE "%s"."%s" SET mapping_checksum = $1`, schema, statsName)
+	if _, err := pg.Db.Exec(stmt, checksum); err != nil {
+		return &SQLError{stmt, err}
+	}
+	return nil
+}
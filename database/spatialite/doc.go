@@ -0,0 +1,12 @@
+/*
+Package spatialite implements the database interfaces for SpatiaLite files.
+
+The import, production and backup schemas are emulated with table name
+prefixes, as SQLite can not move tables between attached databases. The
+tables of the production schema have no schema prefix.
+
+Imposm needs to be built with the sqlite build tag to include the SQLite
+driver (github.com/mattn/go-sqlite3). SpatiaLite 5 is loaded as the
+mod_spatialite extension.
+*/
+package spatialite
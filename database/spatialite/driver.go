@@ -0,0 +1,15 @@
+// +build sqlite
+
+package spatialite
+
+import (
+	"database/sql"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		Extensions: []string{"mod_spatialite"},
+	})
+}
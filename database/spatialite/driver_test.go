@@ -0,0 +1,11 @@
+// +build sqlite
+
+package spatialite
+
+import "testing"
+
+func TestDriverRegistered(t *testing.T) {
+	if !driverRegistered() {
+		t.Errorf("%s driver not registered with sqlite build tag", driverName)
+	}
+}
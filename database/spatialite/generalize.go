@@ -0,0 +1,186 @@
+package spatialite
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/pkg/errors"
+)
+
+// Generalize creates all generalized tables. Tables with generalized
+// sources are created after their sources.
+func (sl *SpatiaLite) Generalize() error {
+	defer log.Step("Creating generalized tables")()
+
+	for _, name := range sl.generalizedOrder {
+		if err := sl.generalizeTable(sl.GeneralizedTables[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceTable returns the name of the table the generalized table selects
+// from.
+func (sl *SpatiaLite) sourceTable(spec *GeneralizedTableSpec) string {
+	if spec.SourceGeneralized != nil {
+		return sl.importTable(spec.SourceGeneralized.FullName)
+	}
+	return sl.importTable(spec.Source.FullName)
+}
+
+func (sl *SpatiaLite) generalizeTable(spec *GeneralizedTableSpec) error {
+	defer log.Step(fmt.Sprintf("Generalizing %s into %s",
+		spec.Source.FullName, spec.FullName))()
+
+	tx, err := sl.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollbackIfTx(&tx)
+
+	table := sl.importTable(spec.FullName)
+	if err := sl.dropTableIfExists(tx, table); err != nil {
+		return errors.Wrap(err, "dropping existing table")
+	}
+	if err := sl.createTable(tx, table, spec.Columns(), spec.extraColumnNames(), spec.Source.GeometryType, spec.Source.Srid); err != nil {
+		return err
+	}
+	stmt := spec.InsertSQL(table, sl.sourceTable(spec), false)
+	if _, err := tx.Exec(stmt); err != nil {
+		return &SQLError{stmt, err}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "commiting tx for generalized table %q", spec.FullName)
+	}
+	tx = nil // set nil to prevent rollback
+	return nil
+}
+
+func (sl *SpatiaLite) EnableGeneralizeUpdates() {
+	sl.updateGeneralizedTables = true
+	sl.updatedIDs = make(map[string]map[int64]struct{})
+}
+
+// GeneralizeUpdates inserts all elements that were inserted into the source
+// tables since EnableGeneralizeUpdates into the generalized tables.
+func (sl *SpatiaLite) GeneralizeUpdates() error {
+	defer log.Step("Updating generalized tables")()
+	for _, name := range sl.generalizedOrder {
+		ids, ok := sl.updatedIDs[name]
+		if !ok {
+			continue
+		}
+		spec := sl.GeneralizedTables[name]
+		insertSQL := spec.InsertSQL(sl.importTable(spec.FullName), sl.sourceTable(spec), true)
+		for id := range ids {
+			if err := sl.exec(insertSQL, id); err != nil {
+				return errors.Wrapf(err, "generalizing %d into %q", id, name)
+			}
+		}
+		log.Printf("[info] Updated %d elements in generalized table %s", len(ids), name)
+	}
+	sl.updatedIDs = make(map[string]map[int64]struct{})
+	return nil
+}
+
+// markGeneralizeUpdates records the ID of an inserted element for all
+// generalized tables of the matched tables.
+func (sl *SpatiaLite) markGeneralizeUpdates(id int64, matches []mapping.Match) {
+	if !sl.updateGeneralizedTables {
+		return
+	}
+	tables := sl.generalizedFromMatches(matches)
+	if len(tables) == 0 {
+		return
+	}
+	sl.mu.Lock()
+	for _, generalizedTable := range tables {
+		ids, ok := sl.updatedIDs[generalizedTable.Name]
+		if !ok {
+			ids = make(map[int64]struct{})
+			sl.updatedIDs[generalizedTable.Name] = ids
+		}
+		ids[id] = struct{}{}
+	}
+	sl.mu.Unlock()
+}
+
+func (sl *SpatiaLite) generalizedFromMatches(matches []mapping.Match) []*GeneralizedTableSpec {
+	generalizedTables := []*GeneralizedTableSpec{}
+	for _, match := range matches {
+		if tbl, ok := sl.Tables[match.Table.Name]; ok {
+			generalizedTables = append(generalizedTables, tbl.Generalizations...)
+		}
+	}
+	return generalizedTables
+}
+
+// Finish creates spatial indices and indices on the ID columns of all
+// tables.
+func (sl *SpatiaLite) Finish() error {
+	defer log.Step("Creating geometry indices")()
+
+	for _, spec := range sl.Tables {
+		if err := sl.createIndices(sl.importTable(spec.FullName), spec.Columns); err != nil {
+			return err
+		}
+	}
+	for _, spec := range sl.GeneralizedTables {
+		if err := sl.createIndices(sl.importTable(spec.FullName), spec.Columns()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sl *SpatiaLite) createIndices(table string, columns []ColumnSpec) error {
+	step := log.Step(fmt.Sprintf("Creating indices on %s", table))
+	defer step()
+	var featureCol string
+	if sl.format == gpkgGeometry {
+		featureCol = featureColumn(columns)
+	}
+	for _, col := range columns {
+		var stmt string
+		if col.isGeometry() && sl.format == gpkgGeometry {
+			if col.Name != featureCol {
+				continue
+			}
+			stmt = fmt.Sprintf(`SELECT gpkgAddSpatialIndex('%s', '%s')`, table, col.Name)
+		} else if col.isGeometry() {
+			stmt = fmt.Sprintf(`SELECT CreateSpatialIndex('%s', '%s')`, table, col.Name)
+		} else if col.FieldType.Name == "id" {
+			// index names are not changed when tables are renamed during
+			// the deploy, add a suffix to keep them unique
+			stmt = fmt.Sprintf(`CREATE INDEX "%s_%s_%s" ON "%s" ("%s")`,
+				table, col.Name, strconv.FormatInt(time.Now().UnixNano(), 36), table, col.Name)
+		} else {
+			continue
+		}
+		if _, err := sl.Db.Exec(stmt); err != nil {
+			return &SQLError{stmt, err}
+		}
+	}
+	return nil
+}
+
+// Optimize updates the statistics of all tables and compacts the file.
+func (sl *SpatiaLite) Optimize() error {
+	defer log.Step("Analysing tables")()
+
+	stmts := []string{`ANALYZE`, `VACUUM`}
+	if sl.format == spatialiteGeometry {
+		stmts = append([]string{`SELECT UpdateLayerStatistics()`}, stmts...)
+	}
+	for _, stmt := range stmts {
+		if _, err := sl.Db.Exec(stmt); err != nil {
+			return errors.Wrap(&SQLError{stmt, err}, "optimizing database")
+		}
+	}
+	return nil
+}
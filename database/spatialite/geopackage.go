@@ -0,0 +1,66 @@
+package spatialite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// initGeoPackage creates the GeoPackage metadata tables and adds the SRID
+// of the import.
+func (sl *SpatiaLite) initGeoPackage() error {
+	var exists bool
+	stmt := `SELECT EXISTS(SELECT * FROM sqlite_master WHERE type = 'table' AND name = 'gpkg_contents')`
+	if err := sl.Db.QueryRow(stmt).Scan(&exists); err != nil {
+		return &SQLError{stmt, err}
+	}
+	if !exists {
+		// application_id and user_version mark the file as GeoPackage 1.2
+		for _, stmt := range []string{
+			`PRAGMA application_id = 1196444487`,
+			`PRAGMA user_version = 10200`,
+			`SELECT gpkgCreateBaseTables()`,
+		} {
+			if _, err := sl.Db.Exec(stmt); err != nil {
+				return &SQLError{stmt, err}
+			}
+		}
+	}
+
+	stmt = `SELECT EXISTS(SELECT * FROM gpkg_spatial_ref_sys WHERE srs_id = ?)`
+	if err := sl.Db.QueryRow(stmt, sl.Config.Srid).Scan(&exists); err != nil {
+		return &SQLError{stmt, err}
+	}
+	if !exists {
+		stmt = `SELECT gpkgInsertEpsgSRID(?)`
+		if _, err := sl.Db.Exec(stmt, sl.Config.Srid); err != nil {
+			return &SQLError{stmt, err}
+		}
+	}
+	return nil
+}
+
+// dropGeoPackageTable drops the table with the spatial index and removes
+// all references from the metadata tables.
+func dropGeoPackageTable(tx *sql.Tx, table string) error {
+	var column string
+	stmt := `SELECT column_name FROM gpkg_geometry_columns WHERE table_name = ?`
+	err := tx.QueryRow(stmt, table).Scan(&column)
+	if err != nil && err != sql.ErrNoRows {
+		return &SQLError{stmt, err}
+	}
+
+	var stmts []string
+	if column != "" {
+		stmts = append(stmts, fmt.Sprintf(`DROP TABLE IF EXISTS "rtree_%s_%s"`, table, column))
+	}
+	for _, meta := range []string{"gpkg_extensions", "gpkg_geometry_columns", "gpkg_contents"} {
+		stmts = append(stmts, fmt.Sprintf(`DELETE FROM %s WHERE table_name = '%s'`, meta, table))
+	}
+	stmts = append(stmts, fmt.Sprintf(`DROP TABLE "%s"`, table))
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return &SQLError{stmt, err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package spatialite
+
+import (
+	"database/sql"
+
+	"github.com/omniscale/imposm3/log"
+	"github.com/pkg/errors"
+)
+
+// rotate renames all tables from the source to the dest schema and the
+// existing tables in dest to the backup schema in a single transaction.
+func (sl *SpatiaLite) rotate(source, dest, backup string) error {
+	defer log.Step("Rotating tables")()
+
+	tx, err := sl.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollbackIfTx(&tx)
+
+	for _, name := range sl.tableNames() {
+		sourceTable := sl.tableName(source, name)
+		destTable := sl.tableName(dest, name)
+		backupTable := sl.tableName(backup, name)
+
+		log.Printf("[info] Rotating %s from %s -> %s -> %s", name, source, dest, backup)
+
+		sourceExists, err := tableExists(tx, sourceTable)
+		if err != nil {
+			return err
+		}
+		if !sourceExists {
+			log.Printf("[warn] skipping rotate of %s, table does not exists in %s", name, source)
+			continue
+		}
+		destExists, err := tableExists(tx, destTable)
+		if err != nil {
+			return err
+		}
+		if destExists {
+			log.Printf("[info] backup of %s, to %s", name, backup)
+			if err := sl.dropTableIfExists(tx, backupTable); err != nil {
+				return err
+			}
+			if err := renameTable(tx, destTable, backupTable); err != nil {
+				return err
+			}
+		}
+		if err := renameTable(tx, sourceTable, destTable); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	tx = nil
+	return nil
+}
+
+func (sl *SpatiaLite) Deploy() error {
+	if sl.format == gpkgGeometry {
+		log.Println("[info] GeoPackage tables are imported without schema, nothing to deploy")
+		return nil
+	}
+	return sl.rotate(sl.Config.ImportSchema, sl.Config.ProductionSchema, sl.Config.BackupSchema)
+}
+
+func (sl *SpatiaLite) RevertDeploy() error {
+	if sl.format == gpkgGeometry {
+		return errors.New("GeoPackage has no backup tables")
+	}
+	return sl.rotate(sl.Config.BackupSchema, sl.Config.ProductionSchema, sl.Config.ImportSchema)
+}
+
+func (sl *SpatiaLite) RemoveBackup() error {
+	if sl.format == gpkgGeometry {
+		return errors.New("GeoPackage has no backup tables")
+	}
+	tx, err := sl.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollbackIfTx(&tx)
+
+	for _, name := range sl.tableNames() {
+		table := sl.tableName(sl.Config.BackupSchema, name)
+		exists, err := tableExists(tx, table)
+		if err != nil {
+			return err
+		}
+		if exists {
+			log.Printf("[info] removing backup of %s from %s", name, sl.Config.BackupSchema)
+			if err := sl.dropTableIfExists(tx, table); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	tx = nil
+	return nil
+}
+
+// tableNames returns the names of all tables and generalized tables, with
+// prefix.
+func (sl *SpatiaLite) tableNames() []string {
+	var names []string
+	for _, spec := range sl.Tables {
+		names = append(names, spec.FullName)
+	}
+	for _, spec := range sl.GeneralizedTables {
+		names = append(names, spec.FullName)
+	}
+	return names
+}
+
+func renameTable(tx *sql.Tx, from, to string) error {
+	// RenameTable of SpatiaLite 5 also renames the spatial index and
+	// updates the geometry_columns
+	stmt := "SELECT RenameTable('main', '" + from + "', '" + to + "')"
+	var ok int
+	if err := tx.QueryRow(stmt).Scan(&ok); err != nil {
+		return &SQLError{stmt, err}
+	}
+	return nil
+}
@@ -0,0 +1,414 @@
+package spatialite
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
+)
+
+// driverName is the name of the database/sql driver with the SpatiaLite
+// extension. It is only registered if Imposm is built with the sqlite tag.
+const driverName = "sqlite3_spatialite"
+
+type SQLError struct {
+	query         string
+	originalError error
+}
+
+func (e *SQLError) Error() string {
+	return fmt.Sprintf("SQL Error: %s in query %s", e.originalError.Error(), e.query)
+}
+
+type SpatiaLite struct {
+	Db                *sql.DB
+	Path              string
+	Config            database.Config
+	Tables            map[string]*TableSpec
+	GeneralizedTables map[string]*GeneralizedTableSpec
+	generalizedOrder  []string
+	Prefix            string
+	format            geometryFormat
+
+	tx *sql.Tx
+	// mu guards stmts, the transaction itself is safe for concurrent use
+	mu      sync.Mutex
+	stmts   map[string]*sql.Stmt
+	bulk    bool
+	noFsync bool
+
+	updateGeneralizedTables bool
+	updatedIDs              map[string]map[int64]struct{}
+}
+
+// tableName returns the name of the table in the emulated schema. Tables
+// of the production schema and all tables of GeoPackages have no prefix.
+func (sl *SpatiaLite) tableName(schema, name string) string {
+	if schema == sl.Config.ProductionSchema || sl.format == gpkgGeometry {
+		return name
+	}
+	return schema + "_" + name
+}
+
+func (sl *SpatiaLite) importTable(name string) string {
+	return sl.tableName(sl.Config.ImportSchema, name)
+}
+
+// OutputPath returns the output file.
+func (sl *SpatiaLite) OutputPath() string {
+	return sl.Path
+}
+
+func (sl *SpatiaLite) Open() error {
+	if !driverRegistered() {
+		return errors.New("SQLite support not included, build Imposm with -tags sqlite")
+	}
+	var err error
+	sl.Db, err = sql.Open(driverName, sl.Path)
+	if err != nil {
+		return errors.Wrap(err, "opening SQLite DB")
+	}
+	// SQLite only supports a single writer, all inserts of a transaction
+	// use the same connection
+	sl.Db.SetMaxOpenConns(1)
+
+	var version string
+	if err := sl.Db.QueryRow("SELECT spatialite_version()").Scan(&version); err != nil {
+		return errors.Wrap(err, "querying SpatiaLite version, mod_spatialite not available?")
+	}
+	log.Printf("[info] Using SpatiaLite %s for %s", version, sl.Path)
+	return nil
+}
+
+func driverRegistered() bool {
+	for _, name := range sql.Drivers() {
+		if name == driverName {
+			return true
+		}
+	}
+	return false
+}
+
+// Init creates the spatial metadata and all tables, drops existing data.
+func (sl *SpatiaLite) Init() error {
+	if sl.format == gpkgGeometry {
+		if err := sl.initGeoPackage(); err != nil {
+			return err
+		}
+	} else {
+		var exists bool
+		stmt := `SELECT EXISTS(SELECT * FROM sqlite_master WHERE type = 'table' AND name = 'geometry_columns')`
+		if err := sl.Db.QueryRow(stmt).Scan(&exists); err != nil {
+			return &SQLError{stmt, err}
+		}
+		if !exists {
+			stmt = `SELECT InitSpatialMetadata(1)`
+			if _, err := sl.Db.Exec(stmt); err != nil {
+				return &SQLError{stmt, err}
+			}
+		}
+	}
+
+	tx, err := sl.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollbackIfTx(&tx)
+	for _, spec := range sl.Tables {
+		table := sl.importTable(spec.FullName)
+		if err := sl.dropTableIfExists(tx, table); err != nil {
+			return err
+		}
+		if err := sl.createTable(tx, table, spec.Columns, nil, spec.GeometryType, spec.Srid); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	tx = nil
+	return nil
+}
+
+func (sl *SpatiaLite) createTable(tx *sql.Tx, table string, columns []ColumnSpec, extra []string, geometryType string, srid int) error {
+	for _, stmt := range sl.format.createTableSQL(table, columns, extra, geometryType, srid) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return &SQLError{stmt, err}
+		}
+	}
+	return nil
+}
+
+func (sl *SpatiaLite) Begin() error {
+	sl.bulk = false
+	return sl.begin(nil)
+}
+
+// BeginBulk starts a transaction for the initial import. Existing rows are
+// removed and fsync is disabled till the transaction ends.
+func (sl *SpatiaLite) BeginBulk() error {
+	sl.bulk = true
+	truncate := make([]string, 0, len(sl.Tables))
+	for name := range sl.Tables {
+		truncate = append(truncate, name)
+	}
+	return sl.begin(truncate)
+}
+
+// BeginBulkTruncate starts a bulk import that only removes the existing
+// rows of the given tables, e.g. to continue an interrupted import.
+func (sl *SpatiaLite) BeginBulkTruncate(tables []string) error {
+	sl.bulk = true
+	return sl.begin(tables)
+}
+
+func (sl *SpatiaLite) begin(truncate []string) error {
+	if sl.bulk {
+		if _, err := sl.Db.Exec("PRAGMA synchronous = OFF"); err != nil {
+			return errors.Wrap(err, "disabling synchronous writes")
+		}
+		sl.noFsync = true
+	}
+	var err error
+	sl.tx, err = sl.Db.Begin()
+	if err != nil {
+		return err
+	}
+	sl.stmts = make(map[string]*sql.Stmt)
+	for _, name := range truncate {
+		spec, ok := sl.Tables[name]
+		if !ok {
+			continue
+		}
+		stmt := fmt.Sprintf(`DELETE FROM "%s"`, sl.importTable(spec.FullName))
+		if _, err := sl.tx.Exec(stmt); err != nil {
+			return &SQLError{stmt, err}
+		}
+	}
+	return nil
+}
+
+// stmt returns the prepared statement for sql in the current transaction.
+func (sl *SpatiaLite) stmt(sql string) (*sql.Stmt, error) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if stmt, ok := sl.stmts[sql]; ok {
+		return stmt, nil
+	}
+	stmt, err := sl.tx.Prepare(sql)
+	if err != nil {
+		return nil, &SQLError{sql, err}
+	}
+	sl.stmts[sql] = stmt
+	return stmt, nil
+}
+
+func (sl *SpatiaLite) insert(tableName string, row []interface{}) error {
+	spec, ok := sl.Tables[tableName]
+	if !ok {
+		return errors.Errorf("unknown table %q", tableName)
+	}
+	stmt, err := sl.stmt(spec.insertSQL)
+	if err != nil {
+		return err
+	}
+	if _, err := stmt.Exec(row...); err != nil {
+		return errors.Wrapf(err, "inserting into %q", spec.FullName)
+	}
+	return nil
+}
+
+func (sl *SpatiaLite) InsertPoint(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	return sl.insertElement(elem, geom, matches)
+}
+
+func (sl *SpatiaLite) InsertLineString(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	return sl.insertElement(elem, geom, matches)
+}
+
+func (sl *SpatiaLite) InsertPolygon(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	return sl.insertElement(elem, geom, matches)
+}
+
+func (sl *SpatiaLite) insertElement(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	for _, match := range matches {
+		row := match.Row(&elem, &geom)
+		if err := sl.insert(match.Table.Name, row); err != nil {
+			return err
+		}
+	}
+	sl.markGeneralizeUpdates(elem.ID, matches)
+	return nil
+}
+
+func (sl *SpatiaLite) InsertRelationMember(rel osm.Relation, m osm.Member, geom geom.Geometry, matches []mapping.Match) error {
+	for _, match := range matches {
+		row := match.MemberRow(&rel, &m, &geom)
+		if err := sl.insert(match.Table.Name, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sl *SpatiaLite) Delete(id int64, matches []mapping.Match) error {
+	for _, match := range matches {
+		spec, ok := sl.Tables[match.Table.Name]
+		if !ok {
+			return errors.Errorf("unknown table %q", match.Table.Name)
+		}
+		if err := sl.exec(spec.deleteSQL, id); err != nil {
+			return errors.Wrapf(err, "deleting %d from %q", id, match.Table.Name)
+		}
+	}
+	if sl.updateGeneralizedTables {
+		for _, generalizedTable := range sl.generalizedFromMatches(matches) {
+			if err := sl.exec(generalizedTable.DeleteSQL(sl.importTable(generalizedTable.FullName)), id); err != nil {
+				return errors.Wrapf(err, "deleting %d from %q", id, generalizedTable.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (sl *SpatiaLite) exec(sql string, args ...interface{}) error {
+	stmt, err := sl.stmt(sql)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(args...)
+	return err
+}
+
+func (sl *SpatiaLite) Abort() error {
+	if sl.tx == nil {
+		return nil
+	}
+	err := sl.tx.Rollback()
+	sl.tx = nil
+	if syncErr := sl.restoreSync(); err == nil {
+		err = syncErr
+	}
+	return err
+}
+
+func (sl *SpatiaLite) End() error {
+	if sl.tx == nil {
+		return nil
+	}
+	err := sl.tx.Commit()
+	sl.tx = nil
+	if syncErr := sl.restoreSync(); err == nil {
+		err = syncErr
+	}
+	return err
+}
+
+func (sl *SpatiaLite) restoreSync() error {
+	if !sl.noFsync {
+		return nil
+	}
+	sl.noFsync = false
+	_, err := sl.Db.Exec("PRAGMA synchronous = FULL")
+	return err
+}
+
+func (sl *SpatiaLite) Close() error {
+	return sl.Db.Close()
+}
+
+func New(conf database.Config, m *config.Mapping) (database.DB, error) {
+	return newSpatiaLite(conf, m, spatialiteGeometry)
+}
+
+// NewGeoPackage returns a database that writes all tables into an OGC
+// GeoPackage.
+func NewGeoPackage(conf database.Config, m *config.Mapping) (database.DB, error) {
+	return newSpatiaLite(conf, m, gpkgGeometry)
+}
+
+func newSpatiaLite(conf database.Config, m *config.Mapping, format geometryFormat) (database.DB, error) {
+	db := &SpatiaLite{format: format}
+
+	db.Tables = make(map[string]*TableSpec)
+	db.GeneralizedTables = make(map[string]*GeneralizedTableSpec)
+
+	db.Config = conf
+
+	var err error
+	db.Path, db.Prefix, err = parseConnectionParams(conf.ConnectionParams)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, table := range m.Tables {
+		spec, err := NewTableSpec(db, table)
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating table spec for %q", name)
+		}
+		spec.insertSQL = spec.InsertSQL(db.importTable(spec.FullName))
+		spec.deleteSQL = spec.DeleteSQL(db.importTable(spec.FullName))
+		db.Tables[name] = spec
+	}
+	for name, table := range m.GeneralizedTables {
+		db.GeneralizedTables[name], err = NewGeneralizedTableSpec(db, table)
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating generalized table spec for %q", name)
+		}
+	}
+	db.generalizedOrder, err = mapping.SortedGeneralizedTables(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.prepareGeneralizedTableSources(); err != nil {
+		return nil, errors.Wrap(err, "preparing generalized table sources")
+	}
+
+	err = db.Open()
+	if err != nil {
+		return nil, errors.Wrap(err, "opening db")
+	}
+	return db, nil
+}
+
+// prepareGeneralizedTableSources checks if all generalized table have an
+// existing source and sets .Source to the original source (works even
+// when source is allready generalized).
+func (sl *SpatiaLite) prepareGeneralizedTableSources() error {
+	for name, table := range sl.GeneralizedTables {
+		if source, ok := sl.Tables[table.SourceName]; ok {
+			table.Source = source
+		} else if source, ok := sl.GeneralizedTables[table.SourceName]; ok {
+			table.SourceGeneralized = source
+		} else {
+			return errors.Errorf("missing source %q for generalized table %q",
+				table.SourceName, name)
+		}
+	}
+
+	// sources are before the generalized tables in generalizedOrder
+	for _, name := range sl.generalizedOrder {
+		table := sl.GeneralizedTables[name]
+		if table.Source == nil {
+			table.Source = table.SourceGeneralized.Source
+		}
+		table.Source.Generalizations = append(table.Source.Generalizations, table)
+		if table.SourceGeneralized != nil {
+			table.SourceGeneralized.Generalizations = append(table.SourceGeneralized.Generalizations, table)
+		}
+	}
+	return nil
+}
+
+func init() {
+	database.Register("sqlite", New)
+	database.Register("spatialite", New)
+	database.Register("gpkg", NewGeoPackage)
+}
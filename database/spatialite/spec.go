@@ -0,0 +1,367 @@
+package spatialite
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
+)
+
+// columnType is the SQLite column type of a mapping column. Columns with
+// the GEOMETRY type are added with AddGeometryColumn, geomType overrides
+// the geometry type of the table.
+type columnType struct {
+	name      string
+	geomType  string
+	validated bool
+	extra     bool
+}
+
+var sqliteTypes = map[string]columnType{
+	"string":              {name: "TEXT"},
+	"bool":                {name: "BOOLEAN"},
+	"int8":                {name: "INTEGER"},
+	"int32":               {name: "INTEGER"},
+	"int64":               {name: "INTEGER"},
+	"float32":             {name: "REAL"},
+	"hstore_string":       {name: "TEXT"},
+	"string_array":        {name: "TEXT"},
+	"timestamp":           {name: "TEXT"},
+	"date":                {name: "TEXT"},
+	"geometry":            {name: "GEOMETRY"},
+	"validated_geometry":  {name: "GEOMETRY", validated: true},
+	"point_geometry":      {name: "GEOMETRY", geomType: "POINT", extra: true},
+	"simplified_geometry": {name: "GEOMETRY", extra: true},
+}
+
+type ColumnSpec struct {
+	Name      string
+	FieldType mapping.ColumnType
+	Type      columnType
+}
+
+func (col *ColumnSpec) isGeometry() bool {
+	return col.Type.name == "GEOMETRY"
+}
+
+func (col *ColumnSpec) isMainGeometry() bool {
+	return col.isGeometry() && !col.Type.extra
+}
+
+type TableSpec struct {
+	Name            string
+	FullName        string
+	Columns         []ColumnSpec
+	GeometryType    string
+	Srid            int
+	Generalizations []*GeneralizedTableSpec
+
+	format geometryFormat
+
+	// statements for the table in the import schema
+	insertSQL string
+	deleteSQL string
+}
+
+type GeneralizedTableSpec struct {
+	Name              string
+	FullName          string
+	SourceName        string
+	Source            *TableSpec
+	SourceGeneralized *GeneralizedTableSpec
+	Tolerance         float64
+	Where             string
+	ExtraColumns      []config.GeneralizedColumn
+	Generalizations   []*GeneralizedTableSpec
+}
+
+func NewTableSpec(sl *SpatiaLite, t *config.Table) (*TableSpec, error) {
+	var geomType string
+	if mapping.TableType(t.Type) == mapping.RelationMemberTable {
+		geomType = "geometry"
+	} else if t.RouteGeometry != nil {
+		geomType = "multilinestring"
+	} else {
+		geomType = string(t.Type)
+	}
+	if t.Shard != nil {
+		return nil, errors.New("shard is not supported by SpatiaLite")
+	}
+
+	spec := TableSpec{
+		Name:         t.Name,
+		FullName:     sl.Prefix + t.Name,
+		GeometryType: geomType,
+		Srid:         sl.Config.Srid,
+		format:       sl.format,
+	}
+	for _, column := range t.Columns {
+		colType, err := mapping.MakeColumnType(column)
+		if err != nil {
+			return nil, err
+		}
+		sqliteType, ok := sqliteTypes[colType.GoType]
+		if !ok {
+			return nil, errors.Errorf("unhandled column type %v", colType)
+		}
+		spec.Columns = append(spec.Columns, ColumnSpec{
+			Name:      column.Name,
+			FieldType: *colType,
+			Type:      sqliteType,
+		})
+	}
+	return &spec, nil
+}
+
+func NewGeneralizedTableSpec(sl *SpatiaLite, t *config.GeneralizedTable) (*GeneralizedTableSpec, error) {
+	if t.Merge {
+		return nil, errors.New("merge is not supported by SpatiaLite")
+	}
+	return &GeneralizedTableSpec{
+		Name:         t.Name,
+		FullName:     sl.Prefix + t.Name,
+		Tolerance:    t.Tolerance,
+		Where:        t.SQLFilter,
+		SourceName:   t.SourceTableName,
+		ExtraColumns: t.Columns,
+	}, nil
+}
+
+func (spec *TableSpec) idColumn() string {
+	for _, col := range spec.Columns {
+		if col.FieldType.Name == "id" {
+			return col.Name
+		}
+	}
+	panic("missing id column")
+}
+
+// geometryFormat is the encoding of the geometries in the database.
+type geometryFormat int
+
+const (
+	spatialiteGeometry geometryFormat = iota
+	// gpkgGeometry are GeoPackage binary geometries. SpatiaLite
+	// functions require geometries in the SpatiaLite format, geometries are
+	// converted with GeomFromGPB and AsGPB.
+	gpkgGeometry
+)
+
+// fromEWKB returns the SQL to convert the hex EWKB of expr.
+func (f geometryFormat) fromEWKB(expr string) string {
+	if f == gpkgGeometry {
+		return "AsGPB(GeomFromEWKB(" + expr + "))"
+	}
+	return "GeomFromEWKB(" + expr + ")"
+}
+
+// toGeometry returns the SQL to convert the column to a SpatiaLite
+// geometry.
+func (f geometryFormat) toGeometry(column string) string {
+	if f == gpkgGeometry {
+		return `GeomFromGPB("` + column + `")`
+	}
+	return `"` + column + `"`
+}
+
+// fromGeometry returns the SQL to convert the SpatiaLite geometry of expr.
+func (f geometryFormat) fromGeometry(expr string) string {
+	if f == gpkgGeometry {
+		return "AsGPB(" + expr + ")"
+	}
+	return expr
+}
+
+// featureColumn returns the geometry column that is registered for tables
+// in GeoPackages. GeoPackage only supports one geometry column per table,
+// additional geometry columns are stored as BLOB.
+func featureColumn(columns []ColumnSpec) string {
+	for _, col := range columns {
+		if col.isMainGeometry() {
+			return col.Name
+		}
+	}
+	for _, col := range columns {
+		if col.isGeometry() {
+			return col.Name
+		}
+	}
+	return ""
+}
+
+// createTableSQL returns the CREATE TABLE statement, followed by the
+// statements to add the geometry columns. extra columns are added without
+// type.
+func (f geometryFormat) createTableSQL(table string, columns []ColumnSpec, extra []string, geometryType string, srid int) []string {
+	var featureCol string
+	if f == gpkgGeometry {
+		featureCol = featureColumn(columns)
+	}
+	foundIDCol := false
+	for _, col := range columns {
+		if col.Name == "id" {
+			foundIDCol = true
+		}
+	}
+	cols := []string{}
+	if !foundIDCol {
+		// Create explicit id column only if there is no id configured.
+		cols = append(cols, "id INTEGER PRIMARY KEY AUTOINCREMENT")
+	}
+	var geomCols []ColumnSpec
+	for _, col := range columns {
+		if col.isGeometry() {
+			if f == gpkgGeometry && col.Name != featureCol {
+				cols = append(cols, fmt.Sprintf(`"%s" BLOB`, col.Name))
+			} else {
+				geomCols = append(geomCols, col)
+			}
+			continue
+		}
+		cols = append(cols, fmt.Sprintf(`"%s" %s`, col.Name, col.Type.name))
+	}
+	for _, name := range extra {
+		cols = append(cols, `"`+name+`"`)
+	}
+	stmts := []string{fmt.Sprintf(`CREATE TABLE "%s" (%s)`, table, strings.Join(cols, ", "))}
+
+	for _, col := range geomCols {
+		geomType := strings.ToUpper(geometryType)
+		if geomType == "POLYGON" {
+			geomType = "GEOMETRY" // for multipolygon support
+		}
+		if col.Type.geomType != "" {
+			geomType = col.Type.geomType
+		} else if col.Type.extra {
+			geomType = "GEOMETRY"
+		}
+		if f == gpkgGeometry {
+			stmts = append(stmts,
+				fmt.Sprintf(`INSERT INTO gpkg_contents (table_name, data_type, identifier, srs_id) VALUES ('%s', 'features', '%s', %d)`,
+					table, table, srid),
+				fmt.Sprintf(`SELECT gpkgAddGeometryColumn('%s', '%s', '%s', 0, 0, %d)`,
+					table, col.Name, geomType, srid),
+			)
+			continue
+		}
+		stmts = append(stmts, fmt.Sprintf(`SELECT AddGeometryColumn('%s', '%s', %d, '%s', 'XY')`,
+			table, col.Name, srid, geomType))
+	}
+	return stmts
+}
+
+func (spec *TableSpec) InsertSQL(table string) string {
+	var cols []string
+	var vars []string
+	for _, col := range spec.Columns {
+		cols = append(cols, `"`+col.Name+`"`)
+		if col.isGeometry() {
+			vars = append(vars, spec.format.fromEWKB("?"))
+		} else {
+			vars = append(vars, "?")
+		}
+	}
+	return fmt.Sprintf(`INSERT INTO "%s" (%s) VALUES (%s)`,
+		table, strings.Join(cols, ", "), strings.Join(vars, ", "))
+}
+
+func (spec *TableSpec) DeleteSQL(table string) string {
+	return fmt.Sprintf(`DELETE FROM "%s" WHERE "%s" = ?`, table, spec.idColumn())
+}
+
+// Columns returns the columns of the generalized table, without the extra
+// SQL columns.
+func (spec *GeneralizedTableSpec) Columns() []ColumnSpec {
+	return spec.Source.Columns
+}
+
+func (spec *GeneralizedTableSpec) columnNames() []string {
+	var cols []string
+	for _, col := range spec.Columns() {
+		cols = append(cols, `"`+col.Name+`"`)
+	}
+	for _, name := range spec.extraColumnNames() {
+		cols = append(cols, `"`+name+`"`)
+	}
+	return cols
+}
+
+// extraColumnNames returns the names of the extra SQL columns of the
+// table, including the extra columns that are copied from a generalized
+// source table.
+func (spec *GeneralizedTableSpec) extraColumnNames() []string {
+	cols := spec.inheritedColumnNames()
+	for _, col := range spec.ExtraColumns {
+		cols = append(cols, col.Name)
+	}
+	return cols
+}
+
+// inheritedColumnNames returns the names of the extra columns of the
+// generalized source table, without columns that are replaced by an extra
+// column of the same name.
+func (spec *GeneralizedTableSpec) inheritedColumnNames() []string {
+	if spec.SourceGeneralized == nil {
+		return nil
+	}
+	own := make(map[string]bool, len(spec.ExtraColumns))
+	for _, col := range spec.ExtraColumns {
+		own[col.Name] = true
+	}
+	var cols []string
+	for _, name := range spec.SourceGeneralized.extraColumnNames() {
+		if !own[name] {
+			cols = append(cols, name)
+		}
+	}
+	return cols
+}
+
+// selectColumnsSQL returns the (generalized) columns of the source,
+// followed by the extra columns of the source and of the table.
+func (spec *GeneralizedTableSpec) selectColumnsSQL() string {
+	var cols []string
+	for _, col := range spec.Columns() {
+		if !col.isMainGeometry() {
+			cols = append(cols, `"`+col.Name+`"`)
+			continue
+		}
+		format := spec.Source.format
+		simplified := fmt.Sprintf(`SimplifyPreserveTopology(%s, %f)`, format.toGeometry(col.Name), spec.Tolerance)
+		if col.Type.validated {
+			simplified = fmt.Sprintf(`ST_Buffer(%s, 0)`, simplified)
+		}
+		cols = append(cols, format.fromGeometry(simplified))
+	}
+	for _, name := range spec.inheritedColumnNames() {
+		cols = append(cols, `"`+name+`"`)
+	}
+	for _, col := range spec.ExtraColumns {
+		cols = append(cols, "("+col.SQL+")")
+	}
+	return strings.Join(cols, ", ")
+}
+
+// InsertSQL returns the statement to generalize all rows of the source
+// table into table. The rows are limited to a single ID if byID is true.
+func (spec *GeneralizedTableSpec) InsertSQL(table, source string, byID bool) string {
+	var where []string
+	if byID {
+		where = append(where, fmt.Sprintf(`"%s" = ?`, spec.Source.idColumn()))
+	}
+	if spec.Where != "" {
+		where = append(where, "("+spec.Where+")")
+	}
+	var whereSQL string
+	if len(where) > 0 {
+		whereSQL = " WHERE " + strings.Join(where, " AND ")
+	}
+	return fmt.Sprintf(`INSERT INTO "%s" (%s) SELECT %s FROM "%s"%s`,
+		table, strings.Join(spec.columnNames(), ", "), spec.selectColumnsSQL(), source, whereSQL)
+}
+
+func (spec *GeneralizedTableSpec) DeleteSQL(table string) string {
+	return fmt.Sprintf(`DELETE FROM "%s" WHERE "%s" = ?`, table, spec.Source.idColumn())
+}
@@ -0,0 +1,95 @@
+package spatialite
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/omniscale/imposm3/log"
+	"github.com/pkg/errors"
+)
+
+// parseConnectionParams returns the path of the database file and the
+// table prefix of connection strings like
+// sqlite:///path/to/osm.sqlite?prefix=osm_ or gpkg://osm.gpkg. The prefix
+// defaults to osm_ and prefix=NONE disables the prefix.
+func parseConnectionParams(params string) (string, string, error) {
+	for _, scheme := range []string{"sqlite:", "spatialite:", "gpkg:"} {
+		if strings.HasPrefix(params, scheme) {
+			params = strings.TrimPrefix(params, scheme)
+			break
+		}
+	}
+	params = strings.TrimPrefix(strings.TrimSpace(params), "//")
+
+	path := params
+	prefix := ""
+	if idx := strings.Index(params, "?"); idx >= 0 {
+		path = params[:idx]
+		query, err := url.ParseQuery(params[idx+1:])
+		if err != nil {
+			return "", "", errors.Wrap(err, "parsing connection parameters")
+		}
+		for key := range query {
+			if key != "prefix" {
+				return "", "", errors.Errorf("unknown connection parameter %q", key)
+			}
+		}
+		prefix = query.Get("prefix")
+	}
+	if path == "" {
+		return "", "", errors.New("missing path of the SQLite file in connection")
+	}
+
+	if prefix == "NONE" {
+		return path, "", nil
+	}
+	if prefix == "" {
+		// default
+		prefix = "osm_"
+	}
+	if prefix[len(prefix)-1] != '_' {
+		// always separated by _
+		prefix = prefix + "_"
+	}
+	return path, prefix, nil
+}
+
+func tableExists(tx *sql.Tx, table string) (bool, error) {
+	var exists bool
+	stmt := fmt.Sprintf(`SELECT EXISTS(SELECT * FROM sqlite_master WHERE type = 'table' AND name = '%s')`, table)
+	if err := tx.QueryRow(stmt).Scan(&exists); err != nil {
+		return false, &SQLError{stmt, err}
+	}
+	return exists, nil
+}
+
+func (sl *SpatiaLite) dropTableIfExists(tx *sql.Tx, table string) error {
+	exists, err := tableExists(tx, table)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	if sl.format == gpkgGeometry {
+		return dropGeoPackageTable(tx, table)
+	}
+	// DropTable of SpatiaLite 5 also removes the spatial index and the
+	// entries in geometry_columns
+	stmt := fmt.Sprintf(`SELECT DropTable('main', '%s')`, table)
+	var ok int
+	if err := tx.QueryRow(stmt).Scan(&ok); err != nil {
+		return &SQLError{stmt, err}
+	}
+	return nil
+}
+
+func rollbackIfTx(tx **sql.Tx) {
+	if *tx != nil {
+		if err := (*tx).Rollback(); err != nil {
+			log.Fatal("[error] rollback failed", err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package expire
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"math"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/atomicfile"
 	"github.com/omniscale/imposm3/proj"
 )
 
@@ -47,6 +49,8 @@ type TileList struct {
 
 	zoom int
 	out  string
+	// checksums enables the .sha256 file of each tiles file
+	checksums bool
 }
 
 type tileKey struct {
@@ -63,6 +67,12 @@ func NewTileList(zoom int, out string) *TileList {
 	}
 }
 
+// EnableChecksums writes the SHA256 checksum of each tiles file into a
+// .tiles.sha256 file, before the tiles file is written.
+func (tl *TileList) EnableChecksums() {
+	tl.checksums = true
+}
+
 func (tl *TileList) Expire(long, lat float64) {
 	tl.addCoord(long, lat)
 }
@@ -161,19 +171,23 @@ func (tl *TileList) Flush() error {
 	if err != nil {
 		return err
 	}
-	fileName := filepath.Join(dir, now.Format("150405.000")+".tiles~")
-	f, err := os.Create(fileName)
-	if err != nil {
+	fileName := filepath.Join(dir, now.Format("150405.000")+".tiles")
+	var buf bytes.Buffer
+	if err := tl.writeTiles(&buf); err != nil {
 		return err
 	}
-	err = tl.writeTiles(f)
-	f.Close()
-	if err != nil {
+	if tl.checksums {
+		// write the checksum first, so that it is available as soon as the
+		// tiles file appears
+		if err := atomicfile.WriteChecksumFile(fileName, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := atomicfile.WriteFile(fileName, buf.Bytes(), 0644); err != nil {
 		return err
 	}
 	tl.tiles = make(map[tileKey]struct{})
-	// wrote to .tiles~ and now atomically move file to .tiles
-	return os.Rename(fileName, fileName[0:len(fileName)-1])
+	return nil
 }
 
 type bbox struct {
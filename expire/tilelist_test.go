@@ -1,6 +1,9 @@
 package expire
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	osm "github.com/omniscale/go-osm"
@@ -81,3 +84,36 @@ func TestTileList_ExpireNodes(t *testing.T) {
 		}
 	}
 }
+
+func TestTileList_FlushChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_expire_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, checksums := range []bool{false, true} {
+		out := filepath.Join(dir, "checksums")
+		if !checksums {
+			out = filepath.Join(dir, "plain")
+		}
+		tl := NewTileList(14, out)
+		if checksums {
+			tl.EnableChecksums()
+		}
+		tl.Expire(8.30, 53.26)
+		if err := tl.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		files, err := filepath.Glob(filepath.Join(out, "*", "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if checksums && (len(files) != 2 || filepath.Ext(files[1]) != ".sha256") {
+			t.Errorf("expected tiles and checksum file, got %v", files)
+		}
+		if !checksums && (len(files) != 1 || filepath.Ext(files[0]) != ".tiles") {
+			t.Errorf("expected only tiles file, got %v", files)
+		}
+	}
+}
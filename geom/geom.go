@@ -16,6 +16,53 @@ type GeometryError struct {
 type Geometry struct {
 	Geom *geos.Geom
 	Wkb  []byte
+	// MemberNodes are the node members of a relation, e.g. the
+	// admin_centre and label nodes of boundaries.
+	MemberNodes []MemberNode
+	// Geos is the handle Geom was created with. Derived geometries (e.g.
+	// centroids) are built with this handle, if set.
+	Geos *geos.Geos
+	// shared values for all tables of this geometry, see Shared
+	shared map[string]interface{}
+}
+
+// MemberNode is a node member of a relation with the EWKB hex of its
+// point.
+type MemberNode struct {
+	ID   int64
+	Role string
+	Wkb  []byte
+}
+
+// Shared returns the value for key. The value is built with build on the
+// first call and reused for all following calls with the same key. This
+// allows to share serialized or derived geometries between all tables an
+// element is inserted into.
+func (g *Geometry) Shared(key string, build func() interface{}) interface{} {
+	if v, ok := g.shared[key]; ok {
+		return v
+	}
+	v := build()
+	if g.shared == nil {
+		g.shared = make(map[string]interface{})
+	}
+	g.shared[key] = v
+	return v
+}
+
+// Area returns the area of Geom. It is only calculated once for all tables.
+func (g *Geometry) Area() float64 {
+	return g.Shared("area", func() interface{} {
+		return g.Geom.Area()
+	}).(float64)
+}
+
+// Length returns the length of Geom. It is only calculated once for all
+// tables.
+func (g *Geometry) Length() float64 {
+	return g.Shared("length", func() interface{} {
+		return g.Geom.Length()
+	}).(float64)
 }
 
 func (e *GeometryError) Error() string {
@@ -145,5 +192,6 @@ func AsGeomElement(g *geos.Geos, geom *geos.Geom) (Geometry, error) {
 	return Geometry{
 		Wkb:  wkb,
 		Geom: geom,
+		Geos: g,
 	}, nil
 }
@@ -197,3 +197,24 @@ func TestUnduplicateNodes(t *testing.T) {
 	}
 
 }
+
+func TestGeometryShared(t *testing.T) {
+	geom := Geometry{Wkb: []byte("0101")}
+	builds := 0
+	build := func() interface{} {
+		builds++
+		return string(geom.Wkb)
+	}
+	for i := 0; i < 3; i++ {
+		if v := geom.Shared("wkb", build); v != "0101" {
+			t.Errorf("unexpected value %v", v)
+		}
+	}
+	if builds != 1 {
+		t.Errorf("expected one build, got %d", builds)
+	}
+	geom.Shared("other", build)
+	if builds != 2 {
+		t.Errorf("expected build for other key, got %d", builds)
+	}
+}
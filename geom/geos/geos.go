@@ -54,6 +54,10 @@ func NewGeos() *Geos {
 
 func (g *Geos) Finish() {
 	if g.v != nil {
+		if g.wkbwriter != nil {
+			C.GEOSWKBWriter_destroy_r(g.v, g.wkbwriter)
+			g.wkbwriter = nil
+		}
 		C.finishGEOS_r(g.v)
 		g.v = nil
 	}
@@ -105,6 +109,11 @@ func (g *Geos) SetHandleSrid(srid int) {
 	g.srid = srid
 }
 
+// Srid returns the SRID of the geometry or 0 if it is not set.
+func (g *Geos) Srid(geom *Geom) int {
+	return int(C.GEOSGetSRID_r(g.v, geom.v))
+}
+
 func (g *Geos) NumGeoms(geom *Geom) int32 {
 	count := int32(C.GEOSGetNumGeometries_r(g.v, geom.v))
 	return count
@@ -250,6 +259,29 @@ func (g *Geos) IsValid(geom *Geom) bool {
 	return false
 }
 
+// IsValidDetail returns whether geom is valid. Returns the reason and the
+// location of the first problem for invalid geometries.
+func (g *Geos) IsValidDetail(geom *Geom) (valid bool, reason string, x, y float64) {
+	var cReason *C.char
+	var location *C.GEOSGeometry
+	if C.GEOSisValidDetail_r(g.v, geom.v, 0, &cReason, &location) != 0 {
+		// valid or exception
+		return true, "", 0, 0
+	}
+	if cReason != nil {
+		reason = C.GoString(cReason)
+		C.GEOSFree_r(g.v, unsafe.Pointer(cReason))
+	}
+	if location != nil {
+		var cx, cy C.double
+		C.GEOSGeomGetX_r(g.v, location, &cx)
+		C.GEOSGeomGetY_r(g.v, location, &cy)
+		C.GEOSGeom_destroy_r(g.v, location)
+		x, y = float64(cx), float64(cy)
+	}
+	return false, reason, x, y
+}
+
 func (g *Geos) IsSimple(geom *Geom) bool {
 	if C.GEOSisSimple_r(g.v, geom.v) == 1 {
 		return true
@@ -285,6 +317,12 @@ func (g *Geos) MakeValid(geom *Geom) (*Geom, error) {
 	if g.IsValid(geom) {
 		return geom, nil
 	}
+	return g.Repair(geom)
+}
+
+// Repair returns a valid geometry of the invalid geom with buffer(0) and
+// destroys geom. Use MakeValid if the validity is not known.
+func (g *Geos) Repair(geom *Geom) (*Geom, error) {
 	fixed := g.Buffer(geom, 0)
 	if fixed == nil {
 		return nil, errors.New("Error while fixing geom with buffer(0)")
@@ -310,6 +348,18 @@ func (g *Geom) Length() float64 {
 	return 0
 }
 
+// IsClosed returns whether the start and end points of all linestrings
+// are equal. Polygons are always closed, points are never closed.
+func (g *Geom) IsClosed() bool {
+	switch C.GEOSGeomTypeId(g.v) {
+	case C.GEOS_POLYGON, C.GEOS_MULTIPOLYGON:
+		return true
+	case C.GEOS_LINESTRING, C.GEOS_LINEARRING, C.GEOS_MULTILINESTRING:
+		return C.GEOSisClosed(g.v) == 1
+	}
+	return false
+}
+
 type Bounds struct {
 	MinX float64
 	MinY float64
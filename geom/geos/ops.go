@@ -42,6 +42,16 @@ func (g *Geos) Buffer(geom *Geom, size float64) *Geom {
 	return &Geom{buffered}
 }
 
+// Simplify simplifies geom with the Douglas-Peucker algorithm. The result
+// can be invalid or empty.
+func (g *Geos) Simplify(geom *Geom, tolerance float64) *Geom {
+	simplified := C.GEOSSimplify_r(g.v, geom.v, C.double(tolerance))
+	if simplified == nil {
+		return nil
+	}
+	return &Geom{simplified}
+}
+
 func (g *Geos) SimplifyPreserveTopology(geom *Geom, tolerance float64) *Geom {
 	simplified := C.GEOSTopologyPreserveSimplify_r(g.v, geom.v, C.double(tolerance))
 	if simplified == nil {
@@ -50,6 +60,24 @@ func (g *Geos) SimplifyPreserveTopology(geom *Geom, tolerance float64) *Geom {
 	return &Geom{simplified}
 }
 
+func (g *Geos) Centroid(geom *Geom) *Geom {
+	centroid := C.GEOSGetCentroid_r(g.v, geom.v)
+	if centroid == nil {
+		return nil
+	}
+	return &Geom{centroid}
+}
+
+// PointOnSurface returns a point that is guaranteed to be inside
+// of the polygon.
+func (g *Geos) PointOnSurface(geom *Geom) *Geom {
+	point := C.GEOSPointOnSurface_r(g.v, geom.v)
+	if point == nil {
+		return nil
+	}
+	return &Geom{point}
+}
+
 // UnionPolygons tries to merge polygons.
 // Returns a single (Multi)Polygon.
 // Destroys polygons and returns new allocated (Multi)Polygon as necessary.
@@ -108,7 +108,24 @@ func splitPolygonAtGrid(g *geos.Geos, geom *geos.Geom, gridWidth, currentGridWid
 	return result, nil
 }
 
+// Modes of the Limiter.
+const (
+	// ModeClip clips geometries at the LimitTo geometry.
+	ModeClip = "clip"
+	// ModeIntersects keeps complete geometries that intersect the LimitTo
+	// geometry.
+	ModeIntersects = "intersects"
+	// ModeCentroidWithin keeps complete geometries with a centroid within
+	// the LimitTo geometry.
+	ModeCentroidWithin = "centroid-within"
+)
+
+// CacheBboxMargin is the margin in degrees around the bbox of the LimitTo
+// geometry, see InCacheBbox.
+const CacheBboxMargin = 0.5
+
 type Limiter struct {
+	mode string
 	// for quick intersections of small geometries
 	index *geos.Index
 	// for direct intersections of large geometries
@@ -123,6 +140,8 @@ type Limiter struct {
 
 	// for quick coarse contains checks
 	bufferedBbox geos.Bounds
+	// bbox of the geometry with CacheBboxMargin, for InCacheBbox
+	cacheBbox geos.Bounds
 	// for quick contains checks
 	bufferedPrep   *geos.PreparedGeom
 	bufferedPrepMu *sync.Mutex
@@ -172,6 +191,12 @@ func NewFromGeoJSON(source string, buffer float64, targetSRID int) (*Limiter, er
 			bufferedPolygons = append(bufferedPolygons, buffered)
 		}
 	}
+	cacheBbox := featuresBbox(features)
+	cacheBbox.MinX -= CacheBboxMargin
+	cacheBbox.MinY -= CacheBboxMargin
+	cacheBbox.MaxX += CacheBboxMargin
+	cacheBbox.MaxY += CacheBboxMargin
+
 	for _, feature := range features {
 		if targetSRID != 4326 {
 			// transforms polygon in-place
@@ -227,7 +252,23 @@ func NewFromGeoJSON(source string, buffer float64, targetSRID int) (*Limiter, er
 		return nil, errors.New("unable to prepare limitto polygons")
 	}
 
-	return &Limiter{index, union, geomPrep, &sync.Mutex{}, bufferedBbox, bufferedPrep, &sync.Mutex{}}, nil
+	return &Limiter{ModeClip, index, union, geomPrep, &sync.Mutex{}, bufferedBbox, cacheBbox, bufferedPrep, &sync.Mutex{}}, nil
+}
+
+// featuresBbox returns the bbox of all feature polygons.
+func featuresBbox(features []geojson.Feature) geos.Bounds {
+	bbox := geos.NilBounds
+	for _, f := range features {
+		for _, ring := range f.Polygon {
+			for _, p := range ring {
+				bbox.MinX = math.Min(bbox.MinX, p.Long)
+				bbox.MinY = math.Min(bbox.MinY, p.Lat)
+				bbox.MaxX = math.Max(bbox.MaxX, p.Long)
+				bbox.MaxY = math.Max(bbox.MaxY, p.Lat)
+			}
+		}
+	}
+	return bbox
 }
 
 func filterGeometryByType(g *geos.Geos, geom *geos.Geom, targetType string) []*geos.Geom {
@@ -268,6 +309,54 @@ func filterGeometryByType(g *geos.Geos, geom *geos.Geom, targetType string) []*g
 	return []*geos.Geom{}
 }
 
+// SetMode sets the mode of Limit to ModeClip, ModeIntersects or
+// ModeCentroidWithin.
+func (l *Limiter) SetMode(mode string) error {
+	switch mode {
+	case "":
+		l.mode = ModeClip
+	case ModeClip, ModeIntersects, ModeCentroidWithin:
+		l.mode = mode
+	default:
+		return errors.New("unknown limitto mode " + mode)
+	}
+	return nil
+}
+
+// Limit returns the parts of geom (in targetSRID) that are imported with the
+// mode of the Limiter. ModeClip returns the clipped parts (see Clip), the
+// other modes return geom or nil if it is outside of the LimitTo geometry.
+func (l *Limiter) Limit(geom *geos.Geom) ([]*geos.Geom, error) {
+	if l.mode == "" || l.mode == ModeClip {
+		return l.Clip(geom)
+	}
+	g := geos.NewGeos()
+	defer g.Finish()
+
+	test := geom
+	if l.mode == ModeCentroidWithin {
+		test = g.Centroid(geom)
+		if test == nil {
+			return nil, errors.New("unable to build centroid")
+		}
+		defer g.Destroy(test)
+		if g.IsEmpty(test) {
+			return nil, nil
+		}
+	}
+
+	l.geomPrepMu.Lock()
+	defer l.geomPrepMu.Unlock()
+	if l.mode == ModeCentroidWithin {
+		if g.PreparedContains(l.geomPrep, test) {
+			return []*geos.Geom{geom}, nil
+		}
+	} else if g.PreparedIntersects(l.geomPrep, test) {
+		return []*geos.Geom{geom}, nil
+	}
+	return nil, nil
+}
+
 // Clip returns geom (in targetSRID) clipped to the LimitTo geometry.
 // Returns nil if geom is outside of the LimitTo geometry.
 // Returns only similar geometry types (e.g. clipped Polygon will return
@@ -316,6 +405,20 @@ func (l *Limiter) Clip(geom *geos.Geom) ([]*geos.Geom, error) {
 	return mergeGeometries(g, intersections, geomType), nil
 }
 
+// HasCacheBuffer returns true if the Limiter was created with a buffer.
+func (l *Limiter) HasCacheBuffer() bool {
+	return l.bufferedPrep != nil
+}
+
+// InCacheBbox returns true if the point (EPSG:4326) is within the bbox of the
+// LimitTo geometry, extended by CacheBboxMargin.
+func (l *Limiter) InCacheBbox(x, y float64) bool {
+	return x >= l.cacheBbox.MinX &&
+		y >= l.cacheBbox.MinY &&
+		x <= l.cacheBbox.MaxX &&
+		y <= l.cacheBbox.MaxY
+}
+
 // IntersectsBuffer returns true if the point (EPSG:4326) intersects the buffered
 // LimitTo geometry.
 func (l *Limiter) IntersectsBuffer(g *geos.Geos, x, y float64) bool {
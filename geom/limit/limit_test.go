@@ -303,6 +303,64 @@ func TestClipper(t *testing.T) {
 	}
 }
 
+func TestLimiterModes(t *testing.T) {
+	g := geos.NewGeos()
+	defer g.Finish()
+	limiter, err := NewFromGeoJSON("./clipping.geojson", 0.0, 3857)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.SetMode("within"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+
+	if err := limiter.SetMode(ModeIntersects); err != nil {
+		t.Fatal(err)
+	}
+	line := g.FromWkt("LINESTRING(1106543 7082055, 1107105.2 7087540.0)")
+	result, err := limiter.Limit(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0] != line {
+		t.Fatalf("expected complete line, got %v", result)
+	}
+	if result, err := limiter.Limit(g.FromWkt("POINT(0 0)")); err != nil || result != nil {
+		t.Fatal(result, err)
+	}
+
+	if err := limiter.SetMode(ModeCentroidWithin); err != nil {
+		t.Fatal(err)
+	}
+	point := g.FromWkt("POINT(1106543 7082055)")
+	if result, err := limiter.Limit(point); err != nil || len(result) != 1 || result[0] != point {
+		t.Fatal(result, err)
+	}
+	if result, err := limiter.Limit(g.FromWkt("LINESTRING(0 0, 10 10)")); err != nil || result != nil {
+		t.Fatal(result, err)
+	}
+}
+
+func TestInCacheBbox(t *testing.T) {
+	g := geos.NewGeos()
+	defer g.Finish()
+	limiter, err := NewFromGeoJSON("./clipping.geojson", 0.0, 3857)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// within bbox and within CacheBboxMargin
+	if !limiter.InCacheBbox(9.94, 53.53) || !limiter.InCacheBbox(9.5, 53.9) {
+		t.Error("expected point in cache bbox")
+	}
+	if limiter.InCacheBbox(9.3, 53.53) || limiter.InCacheBbox(0, 0) {
+		t.Error("expected point outside of cache bbox")
+	}
+	// all points intersect without buffer
+	if !limiter.IntersectsBuffer(g, 0, 0) {
+		t.Error("expected IntersectsBuffer without buffer")
+	}
+}
+
 func TestClipperWithBuffer(t *testing.T) {
 	g := geos.NewGeos()
 	defer g.Finish()
@@ -0,0 +1,163 @@
+package limit
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// The PBF header is decoded by hand, as go-osm does not expose the bbox of
+// the header block. See https://wiki.openstreetmap.org/wiki/PBF_Format
+
+const (
+	pbWireVarint = 0
+	pbWireBytes  = 2
+)
+
+// pbFields calls fn for each varint and length-delimited field in b.
+func pbFields(b []byte, fn func(num int, v uint64, data []byte)) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("invalid protobuf field key")
+		}
+		b = b[n:]
+		num, wire := int(key>>3), key&7
+		switch wire {
+		case pbWireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errors.New("invalid protobuf varint")
+			}
+			b = b[n:]
+			fn(num, v, nil)
+		case pbWireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errors.New("invalid protobuf length")
+			}
+			fn(num, 0, b[n:n+int(l)])
+			b = b[n+int(l):]
+		case 1: // 64bit
+			if len(b) < 8 {
+				return errors.New("invalid protobuf fixed64")
+			}
+			b = b[8:]
+		case 5: // 32bit
+			if len(b) < 4 {
+				return errors.New("invalid protobuf fixed32")
+			}
+			b = b[4:]
+		default:
+			return errors.Errorf("unsupported protobuf wire type %d", wire)
+		}
+	}
+	return nil
+}
+
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// PbfBbox returns the bbox (minx, miny, maxx, maxy in EPSG:4326) from the
+// header of the PBF file. ok is false if the header does not contain a bbox.
+func PbfBbox(filename string) (bbox [4]float64, ok bool, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return bbox, false, err
+	}
+	defer f.Close()
+	return readPbfBbox(f)
+}
+
+func readPbfBbox(r io.Reader) (bbox [4]float64, ok bool, err error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return bbox, false, errors.Wrap(err, "reading PBF blob header size")
+	}
+	if size > 64*1024 {
+		return bbox, false, errors.New("PBF blob header too large")
+	}
+	header := make([]byte, size)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return bbox, false, errors.Wrap(err, "reading PBF blob header")
+	}
+	var blobType string
+	var dataSize uint64
+	if err := pbFields(header, func(num int, v uint64, data []byte) {
+		switch num {
+		case 1:
+			blobType = string(data)
+		case 3:
+			dataSize = v
+		}
+	}); err != nil {
+		return bbox, false, err
+	}
+	if blobType != "OSMHeader" {
+		return bbox, false, errors.Errorf("expected OSMHeader, got %q", blobType)
+	}
+	if dataSize > 32*1024*1024 {
+		return bbox, false, errors.New("PBF header blob too large")
+	}
+	blob := make([]byte, dataSize)
+	if _, err := io.ReadFull(r, blob); err != nil {
+		return bbox, false, errors.Wrap(err, "reading PBF header blob")
+	}
+
+	var raw, zlibData []byte
+	if err := pbFields(blob, func(num int, v uint64, data []byte) {
+		switch num {
+		case 1:
+			raw = data
+		case 3:
+			zlibData = data
+		}
+	}); err != nil {
+		return bbox, false, err
+	}
+	if zlibData != nil {
+		zr, err := zlib.NewReader(bytes.NewReader(zlibData))
+		if err != nil {
+			return bbox, false, errors.Wrap(err, "decompressing PBF header")
+		}
+		raw, err = ioutil.ReadAll(zr)
+		if err != nil {
+			return bbox, false, errors.Wrap(err, "decompressing PBF header")
+		}
+	}
+
+	var bboxData []byte
+	if err := pbFields(raw, func(num int, v uint64, data []byte) {
+		if num == 1 {
+			bboxData = data
+		}
+	}); err != nil {
+		return bbox, false, err
+	}
+	if bboxData == nil {
+		return bbox, false, nil
+	}
+
+	// left, right, top, bottom in nanodegrees
+	var nano [5]int64
+	if err := pbFields(bboxData, func(num int, v uint64, data []byte) {
+		if num >= 1 && num <= 4 {
+			nano[num] = zigzag(v)
+		}
+	}); err != nil {
+		return bbox, false, err
+	}
+	bbox = [4]float64{
+		float64(nano[1]) * 1e-9,
+		float64(nano[4]) * 1e-9,
+		float64(nano[2]) * 1e-9,
+		float64(nano[3]) * 1e-9,
+	}
+	return bbox, true, nil
+}
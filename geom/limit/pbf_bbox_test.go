@@ -0,0 +1,173 @@
+package limit
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func pbVarint(num int, v uint64) []byte {
+	buf := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(num)<<3|pbWireVarint)
+	n += binary.PutUvarint(buf[n:], v)
+	return buf[:n]
+}
+
+func pbBytes(num int, data []byte) []byte {
+	buf := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(num)<<3|pbWireBytes)
+	n += binary.PutUvarint(buf[n:], uint64(len(data)))
+	return append(buf[:n], data...)
+}
+
+func pbSint(num int, v int64) []byte {
+	return pbVarint(num, uint64((v<<1)^(v>>63)))
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func makePbfHeader(t *testing.T, bbox []byte) []byte {
+	headerBlock := concat(bbox, pbBytes(4, []byte("OsmSchema-V0.6")))
+	zbuf := &bytes.Buffer{}
+	zw := zlib.NewWriter(zbuf)
+	zw.Write(headerBlock)
+	zw.Close()
+	blob := concat(pbVarint(2, uint64(len(headerBlock))), pbBytes(3, zbuf.Bytes()))
+	blobHeader := concat(pbBytes(1, []byte("OSMHeader")), pbVarint(3, uint64(len(blob))))
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, uint32(len(blobHeader)))
+	buf.Write(blobHeader)
+	buf.Write(blob)
+	return buf.Bytes()
+}
+
+func TestReadPbfBbox(t *testing.T) {
+	bbox := pbBytes(1, concat(
+		pbSint(1, 8400000000),  // left
+		pbSint(2, 10300000000), // right
+		pbSint(3, 54100000000), // top
+		pbSint(4, -1500000000), // bottom
+	))
+	result, ok, err := readPbfBbox(bytes.NewReader(makePbfHeader(t, bbox)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("missing bbox")
+	}
+	expected := [4]float64{8.4, -1.5, 10.3, 54.1}
+	for i := range expected {
+		if math.Abs(result[i]-expected[i]) > 1e-9 {
+			t.Errorf("%v != %v", result, expected)
+		}
+	}
+
+	_, ok, err = readPbfBbox(bytes.NewReader(makePbfHeader(t, nil)))
+	if err != nil || ok {
+		t.Errorf("expected no bbox: %v %v", ok, err)
+	}
+
+	if _, _, err := readPbfBbox(bytes.NewReader([]byte{0, 0, 0, 4, 1, 2})); err == nil {
+		t.Error("expected error for invalid header")
+	}
+}
+
+func TestResolveSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if src, err := ResolveSource("clip.geojson", dir, ""); err != nil || src != "clip.geojson" {
+		t.Errorf("unexpected source %q %v", src, err)
+	}
+
+	if _, err := ResolveSource(AutoSource, dir, ""); err == nil {
+		t.Error("expected error without derived polygon")
+	}
+
+	pbf := filepath.Join(dir, "extract.osm.pbf")
+	bbox := pbBytes(1, concat(pbSint(1, 8e9), pbSint(2, 10e9), pbSint(3, 54e9), pbSint(4, 53e9)))
+	if err := ioutil.WriteFile(pbf, makePbfHeader(t, bbox), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := ResolveSource(AutoSource, dir, pbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(src)
+	expected := `{"type": "Polygon", "coordinates": [[[8.000000, 53.000000], [10.000000, 53.000000], [10.000000, 54.000000], [8.000000, 54.000000], [8.000000, 53.000000]]]}`
+	if string(b) != expected {
+		t.Errorf("unexpected polygon %s", b)
+	}
+	// diff imports use the derived polygon
+	if src2, err := ResolveSource(AutoSource, dir, ""); err != nil || src2 != src {
+		t.Errorf("unexpected source %q %v", src2, err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "FeatureCollection", "features": [
+			{"type": "Feature", "properties": {"id": "bremen"}, "geometry": {"type": "Polygon", "coordinates": [[[8, 53], [9, 53], [9, 54], [8, 53]]]}}
+		]}`)
+	}))
+	defer ts.Close()
+	indexURL := GeofabrikIndexURL
+	GeofabrikIndexURL = ts.URL
+	defer func() { GeofabrikIndexURL = indexURL }()
+
+	src, err = ResolveSource(GeofabrikPrefix+"bremen", dir, pbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadFile(src)
+	if string(b) != `{"type": "Polygon", "coordinates": [[[8, 53], [9, 53], [9, 54], [8, 53]]]}` {
+		t.Errorf("unexpected polygon %s", b)
+	}
+	if _, err := ResolveSource(GeofabrikPrefix+"hamburg", dir, pbf); err == nil {
+		t.Error("expected error for unknown region")
+	}
+}
+
+func TestFindGeofabrikRegion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "FeatureCollection", "features": [
+			{"type": "Feature", "properties": {"id": "bremen", "parent": "germany", "urls": {
+				"pbf": "https://download.geofabrik.de/europe/germany/bremen-latest.osm.pbf",
+				"updates": "https://download.geofabrik.de/europe/germany/bremen-updates"
+			}}, "geometry": {"type": "Polygon", "coordinates": [[[8, 53], [9, 53], [9, 54], [8, 53]]]}}
+		]}`)
+	}))
+	defer ts.Close()
+	indexURL := GeofabrikIndexURL
+	GeofabrikIndexURL = ts.URL
+	defer func() { GeofabrikIndexURL = indexURL }()
+
+	for _, name := range []string{"bremen", "europe/germany/bremen", "/europe/germany/bremen/"} {
+		r, err := FindGeofabrikRegion(name)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		if r.ID != "bremen" || r.Parent != "germany" ||
+			r.PBFURL != "https://download.geofabrik.de/europe/germany/bremen-latest.osm.pbf" ||
+			r.UpdatesURL != "https://download.geofabrik.de/europe/germany/bremen-updates/" {
+			t.Errorf("unexpected region %#v", r)
+		}
+	}
+	for _, name := range []string{"germany/bremen-latest", "europe/bremen", "hamburg"} {
+		if _, err := FindGeofabrikRegion(name); err == nil {
+			t.Error("expected error for", name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package limit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/log"
+)
+
+const (
+	// AutoSource derives the limitto polygon from the bbox of the PBF file.
+	AutoSource = "auto"
+	// GeofabrikPrefix derives the limitto polygon from a Geofabrik region
+	// (e.g. geofabrik:germany).
+	GeofabrikPrefix = "geofabrik:"
+
+	// DerivedFilename is the file in the cache directory that stores the
+	// derived limitto polygon for later diff imports.
+	DerivedFilename = "limitto.geojson"
+)
+
+// GeofabrikIndexURL is the Geofabrik index with the polygons of all regions.
+var GeofabrikIndexURL = "https://download.geofabrik.de/index-v1.json"
+
+// ResolveSource returns the GeoJSON file for the limitto option. For the
+// AutoSource and GeofabrikPrefix options, the polygon is derived and stored
+// in cacheDir during the import (pbfFile is set) and the stored polygon is
+// used for diff imports (pbfFile is empty). Other values are returned as-is.
+func ResolveSource(limitTo, cacheDir, pbfFile string) (string, error) {
+	if limitTo != AutoSource && !strings.HasPrefix(limitTo, GeofabrikPrefix) {
+		return limitTo, nil
+	}
+	derived := filepath.Join(cacheDir, DerivedFilename)
+	if pbfFile == "" {
+		if _, err := os.Stat(derived); err == nil {
+			return derived, nil
+		}
+		if limitTo == AutoSource {
+			return "", errors.Errorf("-limitto %s requires %s from a previous import with -read", AutoSource, derived)
+		}
+	}
+
+	var feature []byte
+	var err error
+	if limitTo == AutoSource {
+		feature, err = bboxFeature(pbfFile)
+	} else {
+		feature, err = geofabrikFeature(strings.TrimPrefix(limitTo, GeofabrikPrefix))
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(derived, feature, 0644); err != nil {
+		return "", errors.Wrap(err, "writing limitto polygon")
+	}
+	log.Printf("[info] Derived limitto polygon from %s, stored in %s", limitTo, derived)
+	return derived, nil
+}
+
+func bboxFeature(pbfFile string) ([]byte, error) {
+	bbox, ok, err := PbfBbox(pbfFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading bbox from %s", pbfFile)
+	}
+	if !ok {
+		return nil, errors.Errorf("%s contains no bbox in header, -limitto %s not possible", pbfFile, AutoSource)
+	}
+	minx, miny, maxx, maxy := bbox[0], bbox[1], bbox[2], bbox[3]
+	return []byte(fmt.Sprintf(
+		`{"type": "Polygon", "coordinates": [[[%[1]f, %[2]f], [%[3]f, %[2]f], [%[3]f, %[4]f], [%[1]f, %[4]f], [%[1]f, %[2]f]]]}`,
+		minx, miny, maxx, maxy,
+	)), nil
+}
+
+type geofabrikIndex struct {
+	Features []struct {
+		Properties struct {
+			ID     string `json:"id"`
+			Parent string `json:"parent"`
+			URLs   struct {
+				PBF     string `json:"pbf"`
+				Updates string `json:"updates"`
+			} `json:"urls"`
+		} `json:"properties"`
+		Geometry json.RawMessage `json:"geometry"`
+	} `json:"features"`
+}
+
+// GeofabrikRegion is a region of the Geofabrik index.
+type GeofabrikRegion struct {
+	ID     string
+	Parent string
+	PBFURL string
+	// UpdatesURL is the replication URL of the region with trailing slash.
+	UpdatesURL string
+	Geometry   json.RawMessage
+}
+
+// FindGeofabrikRegion returns the region from the Geofabrik index. region
+// is either the ID of the region (e.g. germany) or the path of the
+// download (e.g. europe/germany).
+func FindGeofabrikRegion(region string) (*GeofabrikRegion, error) {
+	resp, err := http.Get(GeofabrikIndexURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "requesting Geofabrik index")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("requesting Geofabrik index: %s", resp.Status)
+	}
+	idx := geofabrikIndex{}
+	if err := json.NewDecoder(resp.Body).Decode(&idx); err != nil {
+		return nil, errors.Wrap(err, "parsing Geofabrik index")
+	}
+	region = strings.Trim(region, "/")
+	for _, f := range idx.Features {
+		p := f.Properties
+		if p.ID == region || (strings.Contains(region, "/") &&
+			strings.HasSuffix(p.URLs.PBF, "/"+region+"-latest.osm.pbf")) {
+			r := &GeofabrikRegion{
+				ID:       p.ID,
+				Parent:   p.Parent,
+				PBFURL:   p.URLs.PBF,
+				Geometry: f.Geometry,
+			}
+			if p.URLs.Updates != "" {
+				r.UpdatesURL = strings.TrimSuffix(p.URLs.Updates, "/") + "/"
+			}
+			return r, nil
+		}
+	}
+	return nil, errors.Errorf("region %q not found in Geofabrik index", region)
+}
+
+func geofabrikFeature(region string) ([]byte, error) {
+	r, err := FindGeofabrikRegion(region)
+	if err != nil {
+		return nil, err
+	}
+	return r.Geometry, nil
+}
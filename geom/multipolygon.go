@@ -2,27 +2,59 @@ package geom
 
 import (
 	"errors"
+	"fmt"
 	"sort"
+	"strings"
 
 	osm "github.com/omniscale/go-osm"
 	"github.com/omniscale/imposm3/geom/geos"
 )
 
+// Reasons of multipolygon issues.
+const (
+	IssueUnclosedRing  = "unclosed_ring"
+	IssueCrossingRings = "crossing_rings"
+	IssueInvalidRings  = "invalid_rings"
+)
+
+// Issue is a problem that was found while building a (multi-)polygon. The
+// relation is still built if possible, e.g. without the unclosed ring.
+type Issue struct {
+	Reason  string
+	Message string
+	// X and Y is the location of the issue in the srid of the relation.
+	X, Y float64
+}
+
 type PreparedRelation struct {
 	rings []*ring
 	rel   *osm.Relation
 	srid  int
+	// Issues found while building the rings and the geometry.
+	Issues []Issue
+	// KeepInvalid disables the buffer(0) repair of invalid geometries in
+	// Build.
+	KeepInvalid bool
+	// DetailedIssues adds the reason and location of invalid geometries to
+	// Issues. The validity is only checked if the geometry is repaired
+	// otherwise.
+	DetailedIssues bool
+	// Invalid is set by Build if the geometry is invalid. It is only set
+	// with DetailedIssues, as the validity is not checked otherwise.
+	Invalid bool
 }
 
 // PrepareRelation is the first step in building a (multi-)polygon of a Relation.
 // It builds rings from all ways and returns an error if there are unclosed rings.
+// Issues of the returned PreparedRelation are set, even if an error is
+// returned.
 func PrepareRelation(rel *osm.Relation, srid int, maxRingGap float64) (PreparedRelation, error) {
-	rings, err := buildRings(rel, maxRingGap)
+	rings, issues, err := buildRings(rel, maxRingGap)
 	if err != nil {
-		return PreparedRelation{}, err
+		return PreparedRelation{Issues: issues}, err
 	}
 
-	return PreparedRelation{rings, rel, srid}, nil
+	return PreparedRelation{rings: rings, rel: rel, srid: srid, Issues: issues}, nil
 }
 
 // Build creates the (multi)polygon Geometry of the Relation.
@@ -31,7 +63,9 @@ func (prep *PreparedRelation) Build() (Geometry, error) {
 	g.SetHandleSrid(prep.srid)
 	defer g.Finish()
 
-	geom, err := buildRelGeometry(g, prep.rel, prep.rings)
+	geom, issues, invalid, err := buildRelGeometry(g, prep.rel, prep.rings, !prep.KeepInvalid, prep.DetailedIssues)
+	prep.Invalid = invalid
+	prep.Issues = append(prep.Issues, issues...)
 	if err != nil {
 		return Geometry{}, err
 	}
@@ -52,8 +86,9 @@ func destroyRings(g *geos.Geos, rings []*ring) {
 	}
 }
 
-func buildRings(rel *osm.Relation, maxRingGap float64) ([]*ring, error) {
+func buildRings(rel *osm.Relation, maxRingGap float64) ([]*ring, []Issue, error) {
 	var rings []*ring
+	var issues []Issue
 	var incompleteRings []*ring
 	var completeRings []*ring
 	var mergedRings []*ring
@@ -81,7 +116,7 @@ func buildRings(rel *osm.Relation, maxRingGap float64) ([]*ring, error) {
 		if r.isClosed() {
 			r.geom, err = Polygon(g, r.nodes)
 			if err != nil {
-				return nil, err
+				return nil, issues, err
 			}
 			completeRings = append(completeRings, r)
 		} else {
@@ -94,18 +129,19 @@ func buildRings(rel *osm.Relation, maxRingGap float64) ([]*ring, error) {
 	// create geometries for merged rings
 	for _, ring := range mergedRings {
 		if !ring.isClosed() && !ring.tryClose(maxRingGap) {
+			issues = append(issues, unclosedRingIssue(ring))
 			continue
 		}
 		ring.geom, err = Polygon(g, ring.nodes)
 		if err != nil {
-			return nil, err
+			return nil, issues, err
 		}
 		completeRings = append(completeRings, ring)
 	}
 
 	if len(completeRings) == 0 {
 		err = ErrorNoRing // for defer
-		return nil, err
+		return nil, issues, err
 	}
 
 	// sort by area (large to small)
@@ -114,7 +150,25 @@ func buildRings(rel *osm.Relation, maxRingGap float64) ([]*ring, error) {
 	}
 	sort.Sort(sortableRingsDesc(completeRings))
 
-	return completeRings, nil
+	return completeRings, issues, nil
+}
+
+func unclosedRingIssue(r *ring) Issue {
+	ids := make([]string, len(r.ways))
+	for i, w := range r.ways {
+		ids[i] = fmt.Sprint(w.ID)
+	}
+	issue := Issue{
+		Reason:  IssueUnclosedRing,
+		Message: fmt.Sprintf("ring of ways %s is not closed", strings.Join(ids, ",")),
+	}
+	if len(r.refs) > 0 {
+		issue.Message += fmt.Sprintf(", ends at nodes %d and %d", r.refs[0], r.refs[len(r.refs)-1])
+	}
+	if len(r.nodes) > 0 {
+		issue.X, issue.Y = r.nodes[0].Long, r.nodes[0].Lat
+	}
+	return issue
 }
 
 type sortableRingsDesc []*ring
@@ -124,14 +178,17 @@ func (r sortableRingsDesc) Less(i, j int) bool { return r[i].area > r[j].area }
 func (r sortableRingsDesc) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
 
 // buildRelGeometry builds the geometry of rel by creating a multipolygon of all rings.
-// rings need to be sorted by area (large to small).
-func buildRelGeometry(g *geos.Geos, rel *osm.Relation, rings []*ring) (*geos.Geom, error) {
+// rings need to be sorted by area (large to small). Invalid geometries are
+// repaired with a buffer(0) if repair is true. The reason of invalid
+// geometries is only returned as issue if detailed is true, invalid is only
+// set in this case.
+func buildRelGeometry(g *geos.Geos, rel *osm.Relation, rings []*ring, repair, detailed bool) (*geos.Geom, []Issue, bool, error) {
 	totalRings := len(rings)
 	shells := map[*ring]bool{rings[0]: true}
 	for i := 0; i < totalRings; i++ {
 		testGeom := g.Prepare(rings[i].geom)
 		if testGeom == nil {
-			return nil, errors.New("Error while preparing geometry")
+			return nil, nil, false, errors.New("Error while preparing geometry")
 		}
 		for j := i + 1; j < totalRings; j++ {
 			if g.PreparedContains(testGeom, rings[j].geom) {
@@ -168,18 +225,18 @@ func buildRelGeometry(g *geos.Geos, rel *osm.Relation, rings []*ring) (*geos.Geo
 			ring := g.Clone(g.ExteriorRing(hole.geom))
 			g.Destroy(hole.geom)
 			if ring == nil {
-				return nil, errors.New("unable to get exterior ring")
+				return nil, nil, false, errors.New("unable to get exterior ring")
 			}
 			interiors = append(interiors, ring)
 		}
 		exterior := g.Clone(g.ExteriorRing(shell.geom))
 		g.Destroy(shell.geom)
 		if exterior == nil {
-			return nil, errors.New("unable to get exterior ring")
+			return nil, nil, false, errors.New("unable to get exterior ring")
 		}
 		polygon := g.Polygon(exterior, interiors)
 		if polygon == nil {
-			return nil, errors.New("unable to build polygon")
+			return nil, nil, false, errors.New("unable to build polygon")
 		}
 		polygons = append(polygons, polygon)
 	}
@@ -190,13 +247,34 @@ func buildRelGeometry(g *geos.Geos, rel *osm.Relation, rings []*ring) (*geos.Geo
 	} else {
 		result = g.MultiPolygon(polygons)
 		if result == nil {
-			return nil, errors.New("unable to build mulipolygon")
+			return nil, nil, false, errors.New("unable to build mulipolygon")
 		}
 	}
-	var err error
-	result, err = g.MakeValid(result)
-	if err != nil {
-		return nil, err
+	var issues []Issue
+	invalid := false
+	if detailed {
+		valid, reason, x, y := g.IsValidDetail(result)
+		if !valid {
+			invalid = true
+			issue := Issue{Reason: IssueInvalidRings, Message: reason, X: x, Y: y}
+			if strings.Contains(strings.ToLower(reason), "intersection") {
+				issue.Reason = IssueCrossingRings
+			}
+			issues = append(issues, issue)
+			if repair {
+				var err error
+				result, err = g.Repair(result)
+				if err != nil {
+					return nil, issues, false, err
+				}
+			}
+		}
+	} else if repair {
+		var err error
+		result, err = g.MakeValid(result)
+		if err != nil {
+			return nil, issues, false, err
+		}
 	}
 
 	g.DestroyLater(result)
@@ -218,7 +296,7 @@ func buildRelGeometry(g *geos.Geos, rel *osm.Relation, rings []*ring) (*geos.Geo
 		}
 	}
 
-	return result, nil
+	return result, issues, invalid, nil
 }
 
 // ringIsHole returns true if rings[idx] is a hole, False if it is a
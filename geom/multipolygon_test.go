@@ -647,6 +647,10 @@ func TestClosedAndOpenRing(t *testing.T) {
 	if len(prep.rings) != 1 {
 		t.Fatal("expected single ring")
 	}
+	if len(prep.Issues) != 1 || prep.Issues[0].Reason != IssueUnclosedRing ||
+		prep.Issues[0].Message != "ring of ways 2 is not closed, ends at nodes 5 and 6" {
+		t.Fatalf("unexpected issues %#v", prep.Issues)
+	}
 	geom, err := prep.Build()
 	if err != nil {
 		t.Fatal(err)
@@ -659,3 +663,47 @@ func TestClosedAndOpenRing(t *testing.T) {
 		t.Fatal("geometry not valid", g.AsWkt(geom.Geom))
 	}
 }
+
+func TestInvalidRingIssues(t *testing.T) {
+	for _, detailed := range []bool{false, true} {
+		w1 := makeWay(1, osm.Tags{}, []coord{
+			{1, 0, 0},
+			{2, 10, 10},
+			{3, 10, 0},
+			{4, 0, 10},
+			{1, 0, 0},
+		})
+		rel := osm.Relation{
+			Element: osm.Element{ID: 1, Tags: osm.Tags{}}}
+		rel.Members = []osm.Member{
+			{ID: 1, Type: osm.WayMember, Role: "outer", Way: &w1},
+		}
+
+		prep, err := PrepareRelation(&rel, 3857, 0.1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prep.DetailedIssues = detailed
+		geom, err := prep.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if detailed {
+			if len(prep.Issues) != 1 || prep.Issues[0].Reason != IssueCrossingRings {
+				t.Errorf("unexpected issues %#v", prep.Issues)
+			}
+			if !prep.Invalid {
+				t.Error("geometry not marked as invalid")
+			}
+		} else if len(prep.Issues) != 0 {
+			t.Errorf("unexpected issues without DetailedIssues %#v", prep.Issues)
+		}
+
+		g := geos.NewGeos()
+		if !g.IsValid(geom.Geom) {
+			t.Error("geometry not repaired", g.AsWkt(geom.Geom))
+		}
+		g.Finish()
+	}
+}
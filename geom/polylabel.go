@@ -0,0 +1,158 @@
+package geom
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Polylabel returns the pole of inaccessibility of a polygon, the point
+// inside the polygon with the largest distance to its boundary. This is a
+// better label position than the centroid for concave polygons. rings
+// contains the x/y coordinates of the exterior ring, followed by the
+// interior rings. The result is within precision of the optimal point,
+// precision defaults to 1/1000 of the size of the polygon.
+func Polylabel(rings [][]float64, precision float64) (float64, float64) {
+	if len(rings) == 0 || len(rings[0]) < 2 {
+		return 0, 0
+	}
+	minX, minY := rings[0][0], rings[0][1]
+	maxX, maxY := minX, minY
+	for i := 0; i+1 < len(rings[0]); i += 2 {
+		x, y := rings[0][i], rings[0][i+1]
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	width, height := maxX-minX, maxY-minY
+	cellSize := math.Min(width, height)
+	if cellSize == 0 {
+		return minX, minY
+	}
+
+	newCell := func(x, y, h float64) *labelCell {
+		d := polygonDistance(x, y, rings)
+		return &labelCell{x: x, y: y, h: h, d: d, max: d + h*math.Sqrt2}
+	}
+
+	// cover the polygon with the initial cells
+	cells := &labelCells{}
+	h := cellSize / 2
+	for x := minX; x < maxX; x += cellSize {
+		for y := minY; y < maxY; y += cellSize {
+			heap.Push(cells, newCell(x+h, y+h, h))
+		}
+	}
+
+	if precision <= 0 {
+		precision = cellSize / 1000
+	}
+
+	cx, cy := ringCentroid(rings[0])
+	best := newCell(cx, cy, 0)
+	if c := newCell(minX+width/2, minY+height/2, 0); c.d > best.d {
+		best = c
+	}
+
+	for cells.Len() > 0 {
+		cell := heap.Pop(cells).(*labelCell)
+		if cell.d > best.d {
+			best = cell
+		}
+		if cell.max-best.d <= precision {
+			continue
+		}
+		// split cell into four
+		h := cell.h / 2
+		heap.Push(cells, newCell(cell.x-h, cell.y-h, h))
+		heap.Push(cells, newCell(cell.x+h, cell.y-h, h))
+		heap.Push(cells, newCell(cell.x-h, cell.y+h, h))
+		heap.Push(cells, newCell(cell.x+h, cell.y+h, h))
+	}
+	return best.x, best.y
+}
+
+// labelCell is a square cell with the center x/y and the half size h. d
+// is the distance of the center to the polygon (negative if outside) and
+// max is the maximum distance of any point within the cell.
+type labelCell struct {
+	x, y, h float64
+	d, max  float64
+}
+
+// labelCells is a priority queue of cells with the largest max first.
+type labelCells []*labelCell
+
+func (c labelCells) Len() int            { return len(c) }
+func (c labelCells) Less(i, j int) bool  { return c[i].max > c[j].max }
+func (c labelCells) Swap(i, j int)       { c[i], c[j] = c[j], c[i] }
+func (c *labelCells) Push(x interface{}) { *c = append(*c, x.(*labelCell)) }
+func (c *labelCells) Pop() interface{} {
+	old := *c
+	cell := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return cell
+}
+
+// polygonDistance returns the distance of x/y to the boundary of the
+// polygon, negative if the point is outside.
+func polygonDistance(x, y float64, rings [][]float64) float64 {
+	inside := false
+	minDist := math.Inf(1)
+	for _, ring := range rings {
+		n := len(ring) / 2
+		for i, j := 0, n-1; i < n; j, i = i, i+1 {
+			ax, ay := ring[i*2], ring[i*2+1]
+			bx, by := ring[j*2], ring[j*2+1]
+			if (ay > y) != (by > y) && x < (bx-ax)*(y-ay)/(by-ay)+ax {
+				inside = !inside
+			}
+			minDist = math.Min(minDist, segmentDistance(x, y, ax, ay, bx, by))
+		}
+	}
+	if !inside {
+		return -minDist
+	}
+	return minDist
+}
+
+// segmentDistance returns the distance of x/y to the segment a-b.
+func segmentDistance(x, y, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	if dx != 0 || dy != 0 {
+		t := ((x-ax)*dx + (y-ay)*dy) / (dx*dx + dy*dy)
+		if t > 1 {
+			ax, ay = bx, by
+		} else if t > 0 {
+			ax, ay = ax+dx*t, ay+dy*t
+		}
+	}
+	return math.Hypot(x-ax, y-ay)
+}
+
+// ringCentroid returns the centroid of the ring, or the first coordinate
+// for rings without area.
+func ringCentroid(ring []float64) (float64, float64) {
+	var area, cx, cy float64
+	n := len(ring) / 2
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		ax, ay := ring[i*2], ring[i*2+1]
+		bx, by := ring[j*2], ring[j*2+1]
+		f := ax*by - bx*ay
+		cx += (ax + bx) * f
+		cy += (ay + by) * f
+		area += f * 3
+	}
+	if area == 0 {
+		return ring[0], ring[1]
+	}
+	return cx / area, cy / area
+}
+
+// RingArea returns the absolute area of the ring.
+func RingArea(ring []float64) float64 {
+	var area float64
+	n := len(ring) / 2
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		area += ring[j*2]*ring[i*2+1] - ring[i*2]*ring[j*2+1]
+	}
+	return math.Abs(area / 2)
+}
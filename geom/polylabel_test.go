@@ -0,0 +1,51 @@
+package geom
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPolylabel(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		rings [][]float64
+		// distance of the optimal point to the boundary
+		dist float64
+	}{
+		{
+			"square",
+			[][]float64{{0, 0, 10, 0, 10, 10, 0, 10, 0, 0}},
+			5,
+		},
+		{
+			// U-shape, centroid is outside of the polygon, best points are
+			// in the lower corners
+			"concave",
+			[][]float64{{0, 0, 30, 0, 30, 30, 20, 30, 20, 10, 10, 10, 10, 30, 0, 30, 0, 0}},
+			10 * math.Sqrt2 / (1 + math.Sqrt2),
+		},
+		{
+			// square with a hole in the lower left quarter
+			"hole",
+			[][]float64{
+				{0, 0, 20, 0, 20, 20, 0, 20, 0, 0},
+				{1, 1, 9, 1, 9, 9, 1, 9, 1, 1},
+			},
+			(20 - 9) * math.Sqrt2 / (1 + math.Sqrt2),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			x, y := Polylabel(tc.rings, 0.01)
+			// multiple points can have the same distance to the boundary
+			if d := polygonDistance(x, y, tc.rings); math.Abs(d-tc.dist) > 0.01 {
+				t.Errorf("%f %f has distance %f, expected %f", x, y, d, tc.dist)
+			}
+		})
+	}
+}
+
+func TestRingArea(t *testing.T) {
+	if a := RingArea([]float64{0, 0, 0, 10, 10, 10, 10, 0, 0, 0}); a != 100 {
+		t.Errorf("unexpected area %f", a)
+	}
+}
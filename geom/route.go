@@ -0,0 +1,115 @@
+package geom
+
+import (
+	"math"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom/geos"
+)
+
+var ErrorNoLines = newGeometryError("no member ways to build route lines", 0)
+
+// RouteLines builds a MultiLineString from the ways of a route relation.
+// Ways are merged at shared end nodes and the ends of lines that are
+// closer than maxGap are connected.
+func RouteLines(g *geos.Geos, ways []*osm.Way, maxGap float64) (*geos.Geom, error) {
+	var lines []*geos.Geom
+	for _, l := range mergeLines(ways, maxGap) {
+		line, err := LineString(g, l.nodes)
+		if err != nil {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil, ErrorNoLines
+	}
+	geom := g.MultiLineString(lines)
+	if geom == nil {
+		return nil, newGeometryError("couldn't create multilinestring", 1)
+	}
+	g.DestroyLater(geom)
+	return geom, nil
+}
+
+// mergeLines merges the ways at shared end nodes and connects the
+// remaining lines if their ends are closer than maxGap. Ways that are
+// included multiple times (e.g. for both directions) are only merged once.
+func mergeLines(ways []*osm.Way, maxGap float64) []*ring {
+	seen := make(map[int64]bool, len(ways))
+	var lines []*ring
+	for _, w := range ways {
+		if seen[w.ID] || len(w.Nodes) != len(w.Refs) {
+			continue
+		}
+		seen[w.ID] = true
+		lines = append(lines, newRing(w))
+	}
+	lines = mergeRings(lines)
+	if maxGap <= 0 {
+		return lines
+	}
+	for {
+		var connected bool
+		lines, connected = connectNearest(lines, maxGap)
+		if !connected {
+			return lines
+		}
+	}
+}
+
+// connectNearest connects the two open lines with the nearest ends if they
+// are closer than maxGap. Returns false if no lines were connected.
+func connectNearest(lines []*ring, maxGap float64) ([]*ring, bool) {
+	bestDist := math.Inf(1)
+	bestA, bestB := -1, -1
+	var reverseA, reverseB bool
+	for a := 0; a < len(lines); a++ {
+		if lines[a].isClosed() {
+			continue
+		}
+		for b := a + 1; b < len(lines); b++ {
+			if lines[b].isClosed() {
+				continue
+			}
+			aStart, aEnd := lines[a].nodes[0], lines[a].nodes[len(lines[a].nodes)-1]
+			bStart, bEnd := lines[b].nodes[0], lines[b].nodes[len(lines[b].nodes)-1]
+			for _, c := range []struct {
+				p, q       osm.Node
+				revA, revB bool
+			}{
+				{aEnd, bStart, false, false},
+				{aEnd, bEnd, false, true},
+				{aStart, bStart, true, false},
+				{aStart, bEnd, true, true},
+			} {
+				dist := math.Hypot(c.p.Long-c.q.Long, c.p.Lat-c.q.Lat)
+				if dist <= maxGap && dist < bestDist {
+					bestDist = dist
+					bestA, bestB = a, b
+					reverseA, reverseB = c.revA, c.revB
+				}
+			}
+		}
+	}
+	if bestA < 0 {
+		return lines, false
+	}
+	a, b := lines[bestA], lines[bestB]
+	if reverseA {
+		reverseRefs(a.refs)
+		reverseNodes(a.nodes)
+	}
+	if reverseB {
+		reverseRefs(b.refs)
+		reverseNodes(b.nodes)
+	}
+	a.refs = append(a.refs, b.refs...)
+	a.nodes = append(a.nodes, b.nodes...)
+	a.ways = append(a.ways, b.ways...)
+
+	// bestA < bestB, a keeps its position
+	last := len(lines) - 1
+	lines[bestB] = lines[last]
+	return lines[:last], true
+}
@@ -0,0 +1,49 @@
+package geom
+
+import (
+	"reflect"
+	"testing"
+
+	osm "github.com/omniscale/go-osm"
+)
+
+func routeWay(id int64, refs ...int64) *osm.Way {
+	w := &osm.Way{Refs: refs}
+	w.ID = id
+	for _, ref := range refs {
+		// nodes on a horizontal line, x is the ref
+		w.Nodes = append(w.Nodes, osm.Node{Long: float64(ref), Lat: 0})
+	}
+	return w
+}
+
+func TestMergeLines(t *testing.T) {
+	ways := []*osm.Way{
+		routeWay(1, 1, 2, 3),
+		routeWay(2, 5, 4, 3), // reversed
+		routeWay(1, 1, 2, 3), // duplicate
+		routeWay(3, 7, 8),    // gap of 2 to 5
+	}
+
+	lines := mergeLines(ways, 0)
+	if len(lines) != 2 {
+		t.Fatalf("expected two lines, got %d", len(lines))
+	}
+
+	lines = mergeLines(ways, 2)
+	if len(lines) != 1 {
+		t.Fatalf("expected one line, got %d", len(lines))
+	}
+	refs := lines[0].refs
+	if refs[0] == 8 {
+		reverseRefs(refs)
+	}
+	if expected := []int64{1, 2, 3, 4, 5, 7, 8}; !reflect.DeepEqual(refs, expected) {
+		t.Errorf("%v != %v", refs, expected)
+	}
+
+	lines = mergeLines(ways, 1.5)
+	if len(lines) != 2 {
+		t.Fatalf("expected two lines for smaller gap, got %d", len(lines))
+	}
+}
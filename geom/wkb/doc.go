@@ -0,0 +1,5 @@
+/*
+Package wkb decodes (E)WKB geometries without GEOS, e.g. the hex encoded
+geometry columns of the mapping.
+*/
+package wkb
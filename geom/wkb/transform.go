@@ -0,0 +1,242 @@
+package wkb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// TransformHex transforms all coordinates of hex encoded (E)WKB with f and
+// sets the SRID of the result. Z and M values are not transformed. f
+// returns +Inf for coordinates that can not be transformed.
+func TransformHex(b []byte, srid int, f func(x, y float64) (float64, float64)) ([]byte, error) {
+	return hexApply(b, func(buf []byte) ([]byte, error) {
+		return Transform(buf, srid, f)
+	})
+}
+
+// Transform transforms all coordinates of (E)WKB with f and sets the SRID
+// of the result. b is not modified.
+func Transform(b []byte, srid int, f func(x, y float64) (float64, float64)) ([]byte, error) {
+	t := &wkbTransformer{b: setSRID(b, srid), f: f}
+	return t.run()
+}
+
+// OrientHex orients the rings of all polygons of hex encoded (E)WKB, see
+// Orient.
+func OrientHex(b []byte, ccw bool) ([]byte, error) {
+	return hexApply(b, func(buf []byte) ([]byte, error) {
+		return Orient(buf, ccw)
+	})
+}
+
+// Orient orients the rings of all polygons of (E)WKB. Exterior rings are
+// counterclockwise and interior rings are clockwise if ccw is true, and the
+// other way around if ccw is false. b is not modified.
+func Orient(b []byte, ccw bool) ([]byte, error) {
+	t := &wkbTransformer{b: append([]byte(nil), b...), orient: orientCW}
+	if ccw {
+		t.orient = orientCCW
+	}
+	return t.run()
+}
+
+func hexApply(b []byte, f func([]byte) ([]byte, error)) ([]byte, error) {
+	buf := make([]byte, hex.DecodedLen(len(b)))
+	if _, err := hex.Decode(buf, b); err != nil {
+		return nil, errors.Wrap(err, "decoding hex WKB")
+	}
+	buf, err := f(buf)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, hex.EncodedLen(len(buf)))
+	hex.Encode(result, buf)
+	return result, nil
+}
+
+// setSRID returns a copy of the EWKB with the SRID of the outer geometry.
+func setSRID(b []byte, srid int) []byte {
+	if len(b) < 5 {
+		return append([]byte(nil), b...)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if b[0] == 0 {
+		order = binary.BigEndian
+	}
+	typ := order.Uint32(b[1:5])
+	if typ&ewkbSridFlag != 0 {
+		result := append([]byte(nil), b...)
+		if len(result) >= 9 {
+			order.PutUint32(result[5:9], uint32(srid))
+		}
+		return result
+	}
+	result := make([]byte, len(b)+4)
+	result[0] = b[0]
+	order.PutUint32(result[1:5], typ|ewkbSridFlag)
+	order.PutUint32(result[5:9], uint32(srid))
+	copy(result[9:], b[5:])
+	return result
+}
+
+const (
+	orientCCW = 1
+	orientCW  = -1
+)
+
+// wkbTransformer modifies WKB in place. It transforms all coordinates with f
+// and orients the rings of polygons if orient is set.
+type wkbTransformer struct {
+	b      []byte
+	pos    int
+	order  binary.ByteOrder
+	dims   int
+	f      func(x, y float64) (float64, float64)
+	orient int
+}
+
+func (t *wkbTransformer) run() ([]byte, error) {
+	if err := t.geometry(); err != nil {
+		return nil, err
+	}
+	if t.pos != len(t.b) {
+		return nil, errors.New("invalid WKB, trailing bytes")
+	}
+	return t.b, nil
+}
+
+func (t *wkbTransformer) geometry() error {
+	if t.pos+5 > len(t.b) {
+		return errors.New("invalid WKB, reading geometry type")
+	}
+	if t.b[t.pos] == 0 {
+		t.order = binary.BigEndian
+	} else {
+		t.order = binary.LittleEndian
+	}
+	typ := t.order.Uint32(t.b[t.pos+1:])
+	t.pos += 5
+	t.dims = 2
+	if typ&ewkbZFlag != 0 {
+		t.dims++
+	}
+	if typ&ewkbMFlag != 0 {
+		t.dims++
+	}
+	if typ&ewkbSridFlag != 0 {
+		t.pos += 4
+	}
+	typ &= 0xffff
+	if typ > 1000 {
+		switch typ / 1000 {
+		case 1, 2:
+			t.dims++
+		case 3:
+			t.dims += 2
+		}
+		typ = typ % 1000
+	}
+
+	switch typ {
+	case Point:
+		return t.coords(1)
+	case LineString:
+		return t.lineString()
+	case Polygon:
+		n, err := t.uint32()
+		for i := uint32(0); err == nil && i < n; i++ {
+			start := t.pos
+			err = t.lineString()
+			if err == nil && t.orient != 0 {
+				t.orientRing(start, i == 0)
+			}
+		}
+		return err
+	case MultiPoint, MultiLineString, MultiPolygon, GeometryCollection:
+		n, err := t.uint32()
+		for i := uint32(0); err == nil && i < n; i++ {
+			err = t.geometry()
+		}
+		return err
+	default:
+		return errors.Errorf("unsupported WKB geometry type %d", typ)
+	}
+}
+
+func (t *wkbTransformer) uint32() (uint32, error) {
+	if t.pos+4 > len(t.b) {
+		return 0, errors.New("invalid WKB, reading count")
+	}
+	v := t.order.Uint32(t.b[t.pos:])
+	t.pos += 4
+	return v, nil
+}
+
+func (t *wkbTransformer) lineString() error {
+	n, err := t.uint32()
+	if err != nil {
+		return err
+	}
+	return t.coords(n)
+}
+
+func (t *wkbTransformer) coords(n uint32) error {
+	size := 8 * t.dims
+	if uint64(t.pos)+uint64(n)*uint64(size) > uint64(len(t.b)) {
+		return errors.New("invalid WKB, reading coordinates")
+	}
+	if t.f == nil {
+		t.pos += int(n) * size
+		return nil
+	}
+	for i := uint32(0); i < n; i++ {
+		c := t.b[t.pos : t.pos+size]
+		x := math.Float64frombits(t.order.Uint64(c[0:8]))
+		y := math.Float64frombits(t.order.Uint64(c[8:16]))
+		x, y = t.f(x, y)
+		if math.IsInf(x, 0) || math.IsInf(y, 0) {
+			return errors.New("coordinate can not be transformed")
+		}
+		t.order.PutUint64(c[0:8], math.Float64bits(x))
+		t.order.PutUint64(c[8:16], math.Float64bits(y))
+		t.pos += size
+	}
+	return nil
+}
+
+// orientRing reverses the ring at start if it does not have the orientation
+// of exterior or interior rings.
+func (t *wkbTransformer) orientRing(start int, exterior bool) {
+	n := int(t.order.Uint32(t.b[start:]))
+	size := 8 * t.dims
+	coords := t.b[start+4 : start+4+n*size]
+	xy := func(i int) (float64, float64) {
+		c := coords[i*size:]
+		return math.Float64frombits(t.order.Uint64(c[0:8])), math.Float64frombits(t.order.Uint64(c[8:16]))
+	}
+	area := 0.0
+	for i := 0; i < n-1; i++ {
+		x1, y1 := xy(i)
+		x2, y2 := xy(i + 1)
+		area += x1*y2 - x2*y1
+	}
+	if area == 0 {
+		return
+	}
+	want := t.orient
+	if !exterior {
+		want = -want
+	}
+	if (area > 0) == (want == orientCCW) {
+		return
+	}
+	tmp := make([]byte, size)
+	for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+		copy(tmp, coords[i*size:(i+1)*size])
+		copy(coords[i*size:(i+1)*size], coords[j*size:(j+1)*size])
+		copy(coords[j*size:(j+1)*size], tmp)
+	}
+}
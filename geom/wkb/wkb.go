@@ -0,0 +1,220 @@
+package wkb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// WKB geometry types
+const (
+	Point              = 1
+	LineString         = 2
+	Polygon            = 3
+	MultiPoint         = 4
+	MultiLineString    = 5
+	MultiPolygon       = 6
+	GeometryCollection = 7
+)
+
+const (
+	ewkbSridFlag = 0x20000000
+	ewkbZFlag    = 0x80000000
+	ewkbMFlag    = 0x40000000
+)
+
+// Geometry is a decoded 2D geometry. XY contains all coordinates of
+// points, linestrings and polygons. Ends contains the end index (in
+// coordinates) of each ring or linestring for polygons and
+// multilinestrings. Parts contains the geometries of multipolygons and
+// geometry collections. SRID is only set for EWKB with SRID.
+type Geometry struct {
+	Type  uint32
+	SRID  uint32
+	XY    []float64
+	Ends  []uint32
+	Parts []Geometry
+}
+
+// ParseHex decodes hex encoded (E)WKB, as returned by the geometry columns
+// of the mapping.
+func ParseHex(s string) (Geometry, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return Geometry{}, errors.Wrap(err, "decoding hex WKB")
+	}
+	return Parse(bytes.NewReader(b))
+}
+
+type wkbReader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	dims  int
+}
+
+// Parse decodes (E)WKB from r. Z and M values are dropped.
+func Parse(r io.Reader) (Geometry, error) {
+	wr := &wkbReader{r: r}
+	return wr.geometry()
+}
+
+func (wr *wkbReader) geometry() (Geometry, error) {
+	var order [1]byte
+	if _, err := io.ReadFull(wr.r, order[:]); err != nil {
+		return Geometry{}, errors.Wrap(err, "reading WKB byte order")
+	}
+	if order[0] == 0 {
+		wr.order = binary.BigEndian
+	} else {
+		wr.order = binary.LittleEndian
+	}
+	typ, err := wr.uint32()
+	if err != nil {
+		return Geometry{}, err
+	}
+	wr.dims = 2
+	if typ&ewkbZFlag != 0 {
+		wr.dims++
+	}
+	if typ&ewkbMFlag != 0 {
+		wr.dims++
+	}
+	var srid uint32
+	if typ&ewkbSridFlag != 0 {
+		if srid, err = wr.uint32(); err != nil {
+			return Geometry{}, err
+		}
+	}
+	typ &= 0xffff
+	// ISO WKB with Z/M (e.g. 1001 for PointZ)
+	if typ > 1000 {
+		switch typ / 1000 {
+		case 1, 2:
+			wr.dims++
+		case 3:
+			wr.dims += 2
+		}
+		typ = typ % 1000
+	}
+
+	g := Geometry{Type: typ, SRID: srid}
+	switch typ {
+	case Point:
+		g.XY, err = wr.coords(1, nil)
+	case LineString:
+		g.XY, err = wr.lineString(nil)
+	case Polygon, MultiLineString:
+		var n uint32
+		n, err = wr.uint32()
+		for i := uint32(0); err == nil && i < n; i++ {
+			if typ == MultiLineString {
+				var sub Geometry
+				sub, err = wr.geometry()
+				g.XY = append(g.XY, sub.XY...)
+			} else {
+				g.XY, err = wr.lineString(g.XY)
+			}
+			g.Ends = append(g.Ends, uint32(len(g.XY)/2))
+		}
+	case MultiPoint:
+		var n uint32
+		n, err = wr.uint32()
+		for i := uint32(0); err == nil && i < n; i++ {
+			var sub Geometry
+			sub, err = wr.geometry()
+			g.XY = append(g.XY, sub.XY...)
+		}
+	case MultiPolygon, GeometryCollection:
+		var n uint32
+		n, err = wr.uint32()
+		for i := uint32(0); err == nil && i < n; i++ {
+			var sub Geometry
+			sub, err = wr.geometry()
+			g.Parts = append(g.Parts, sub)
+		}
+	default:
+		return Geometry{}, errors.Errorf("unsupported WKB geometry type %d", typ)
+	}
+	if err != nil {
+		return Geometry{}, err
+	}
+	return g, nil
+}
+
+func (wr *wkbReader) uint32() (uint32, error) {
+	var v uint32
+	if err := binary.Read(wr.r, wr.order, &v); err != nil {
+		return 0, errors.Wrap(err, "reading WKB")
+	}
+	return v, nil
+}
+
+func (wr *wkbReader) lineString(xy []float64) ([]float64, error) {
+	n, err := wr.uint32()
+	if err != nil {
+		return nil, err
+	}
+	return wr.coords(n, xy)
+}
+
+// coords reads n coordinates and appends x and y to xy. Z and M values are
+// dropped.
+func (wr *wkbReader) coords(n uint32, xy []float64) ([]float64, error) {
+	buf := make([]byte, 8*wr.dims)
+	for i := uint32(0); i < n; i++ {
+		if _, err := io.ReadFull(wr.r, buf); err != nil {
+			return nil, errors.Wrap(err, "reading WKB coordinates")
+		}
+		xy = append(xy,
+			math.Float64frombits(wr.order.Uint64(buf[0:8])),
+			math.Float64frombits(wr.order.Uint64(buf[8:16])),
+		)
+	}
+	return xy, nil
+}
+
+// Rings returns the coordinates of each ring or linestring.
+func (g *Geometry) Rings() [][]float64 {
+	if len(g.Ends) == 0 {
+		if len(g.XY) == 0 {
+			return nil
+		}
+		return [][]float64{g.XY}
+	}
+	rings := make([][]float64, 0, len(g.Ends))
+	start := uint32(0)
+	for _, end := range g.Ends {
+		rings = append(rings, g.XY[start*2:end*2])
+		start = end
+	}
+	return rings
+}
+
+// RemoveSRID converts EWKB into WKB by removing the SRID of the outer
+// geometry (parts of EWKB geometries have no SRID). The result is ISO WKB
+// for 2D geometries.
+func RemoveSRID(b []byte) ([]byte, error) {
+	if len(b) < 5 {
+		return nil, errors.New("invalid WKB")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if b[0] == 0 {
+		order = binary.BigEndian
+	}
+	typ := order.Uint32(b[1:5])
+	if typ&ewkbSridFlag == 0 {
+		return b, nil
+	}
+	if len(b) < 9 {
+		return nil, errors.New("invalid EWKB")
+	}
+	result := make([]byte, len(b)-4)
+	result[0] = b[0]
+	order.PutUint32(result[1:5], typ&^ewkbSridFlag)
+	copy(result[5:], b[9:])
+	return result, nil
+}
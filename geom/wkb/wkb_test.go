@@ -0,0 +1,151 @@
+package wkb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// polygonWKB returns hex EWKB of a polygon with srid 3857.
+func polygonWKB(rings ...[]float64) string {
+	buf := &bytes.Buffer{}
+	buf.WriteByte(1)
+	binary.Write(buf, binary.LittleEndian, uint32(Polygon|ewkbSridFlag))
+	binary.Write(buf, binary.LittleEndian, uint32(3857))
+	binary.Write(buf, binary.LittleEndian, uint32(len(rings)))
+	for _, ring := range rings {
+		binary.Write(buf, binary.LittleEndian, uint32(len(ring)/2))
+		binary.Write(buf, binary.LittleEndian, ring)
+	}
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func TestParseHex(t *testing.T) {
+	g, err := ParseHex(polygonWKB(
+		[]float64{0, 0, 10, 0, 10, 10, 0, 0},
+		[]float64{1, 1, 2, 1, 2, 2, 1, 1},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Type != Polygon || g.SRID != 3857 || len(g.XY) != 16 {
+		t.Fatalf("unexpected geometry %v", g)
+	}
+	if len(g.Ends) != 2 || g.Ends[0] != 4 || g.Ends[1] != 8 {
+		t.Errorf("unexpected ends %v", g.Ends)
+	}
+	if rings := g.Rings(); len(rings) != 2 || rings[1][0] != 1 {
+		t.Errorf("unexpected rings %v", rings)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := ParseHex("zz"); err == nil {
+		t.Error("expected error for invalid hex")
+	}
+	if _, err := ParseHex("0109000000"); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+	if _, err := ParseHex("010100000000"); err == nil {
+		t.Error("expected error for truncated point")
+	}
+}
+
+func TestRemoveSRID(t *testing.T) {
+	b, err := hex.DecodeString(polygonWKB([]float64{0, 0, 10, 0, 10, 10, 0, 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iso, err := RemoveSRID(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(iso) != len(b)-4 || binary.LittleEndian.Uint32(iso[1:]) != Polygon {
+		t.Fatalf("unexpected WKB %x", iso)
+	}
+	g, err := Parse(bytes.NewReader(iso))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Type != Polygon || len(g.XY) != 8 || g.XY[2] != 10 {
+		t.Errorf("unexpected geometry %v", g)
+	}
+	if same, err := RemoveSRID(iso); err != nil || !bytes.Equal(same, iso) {
+		t.Errorf("WKB without SRID changed %x %v", same, err)
+	}
+}
+
+func TestTransformHex(t *testing.T) {
+	double := func(x, y float64) (float64, float64) { return x * 2, y * 2 }
+	b, err := TransformHex([]byte(polygonWKB(
+		[]float64{0, 0, 10, 0, 10, 10, 0, 0},
+		[]float64{1, 1, 2, 1, 2, 2, 1, 1},
+	)), 4326, double)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := ParseHex(string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Type != Polygon || len(g.XY) != 16 || g.XY[2] != 20 || g.XY[9] != 2 {
+		t.Errorf("unexpected geometry %v", g)
+	}
+	raw, _ := hex.DecodeString(string(b))
+	if srid := binary.LittleEndian.Uint32(raw[5:]); srid != 4326 {
+		t.Errorf("unexpected SRID %d", srid)
+	}
+
+	// WKB without SRID
+	iso, _ := hex.DecodeString(polygonWKB([]float64{0, 0, 10, 0, 10, 10, 0, 0}))
+	iso, _ = RemoveSRID(iso)
+	tb, err := Transform(iso, 3857, double)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tb) != len(iso)+4 || binary.LittleEndian.Uint32(tb[5:]) != 3857 {
+		t.Errorf("unexpected EWKB %x", tb)
+	}
+	if g, err := Parse(bytes.NewReader(tb)); err != nil || g.XY[4] != 20 {
+		t.Errorf("unexpected geometry %v %v", g, err)
+	}
+
+	if _, err := TransformHex([]byte("010100000000"), 4326, double); err == nil {
+		t.Error("expected error for truncated point")
+	}
+}
+
+func TestOrientHex(t *testing.T) {
+	// counterclockwise exterior and interior ring
+	b := []byte(polygonWKB(
+		[]float64{0, 0, 10, 0, 10, 10, 0, 0},
+		[]float64{1, 1, 2, 1, 2, 2, 1, 1},
+	))
+	ccw, err := OrientHex(b, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := ParseHex(string(ccw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.XY[2] != 10 || g.XY[3] != 0 || g.XY[10] != 2 || g.XY[11] != 2 {
+		t.Errorf("unexpected ccw rings %v", g.XY)
+	}
+
+	cw, err := OrientHex(b, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err = ParseHex(string(cw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.XY[2] != 10 || g.XY[3] != 10 || g.XY[10] != 2 || g.XY[11] != 1 {
+		t.Errorf("unexpected cw rings %v", g.XY)
+	}
+	if string(b) != polygonWKB([]float64{0, 0, 10, 0, 10, 10, 0, 0}, []float64{1, 1, 2, 1, 2, 2, 1, 1}) {
+		t.Error("input modified")
+	}
+}
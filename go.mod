@@ -5,13 +5,16 @@ go 1.12
 require (
 	github.com/fsnotify/fsnotify v1.4.7 // indirect
 	github.com/gogo/protobuf v0.0.0-20171007142547-342cbe0a0415
+	github.com/google/flatbuffers v1.12.1
 	github.com/jmhodges/levigo v0.0.0-20161115193449-c42d9e0ca023
-	github.com/kr/pretty v0.1.0 // indirect
 	github.com/lib/pq v0.0.0-20171113044440-8c6ee72f3e6b
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/omniscale/go-osm v0.2.1
-	github.com/pkg/errors v0.8.0
-	golang.org/x/sys v0.0.0-20171114162044-bf42f188b9bc // indirect
+	github.com/pelletier/go-toml v1.9.5
+	github.com/pkg/errors v0.9.1
+	github.com/xitongsys/parquet-go v1.5.4
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/fsnotify.v1 v1.4.2 // indirect
-	gopkg.in/yaml.v2 v2.0.0-20170812160011-eb3733d160e7
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,103 @@
+package import_
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// cacheSizeFactor is the estimated size of the cache relative to the
+	// PBF file.
+	cacheSizeFactor = 2.0
+	// cacheSizeFactorDiff is the estimated size of the cache with -diff.
+	cacheSizeFactorDiff = 3.0
+	// dbSizeFactorPerTable is the estimated size of the database relative to the
+	// PBF file for each table.
+	dbSizeFactorPerTable = 0.15
+)
+
+// errDiskSpaceNotSupported is returned by freeDiskSpace on systems
+// without support. The free disk space is not checked on these systems.
+var errDiskSpaceNotSupported = errors.New("checking free disk space not supported")
+
+// estimateCacheSize returns the estimated size of the cache for the PBF file.
+func estimateCacheSize(pbfSize int64, diff bool) uint64 {
+	if diff {
+		return uint64(float64(pbfSize) * cacheSizeFactorDiff)
+	}
+	return uint64(float64(pbfSize) * cacheSizeFactor)
+}
+
+// estimateDBSize returns the estimated size of the imported tables.
+func estimateDBSize(pbfSize int64, tables int) uint64 {
+	return uint64(float64(pbfSize) * dbSizeFactorPerTable * float64(tables))
+}
+
+// checkCacheDiskSpace returns an error if there is not enough free space
+// for the cache of the PBF file.
+func checkCacheDiskSpace(pbfFile, cacheDir string, diff bool) error {
+	fi, err := os.Stat(pbfFile)
+	if err != nil {
+		return errors.Wrap(err, "checking PBF file size")
+	}
+	return checkDiskSpace(cacheDir, "cache", estimateCacheSize(fi.Size(), diff), pbfFile)
+}
+
+// checkDBDiskSpace returns an error if there is not enough free space for
+// the tables of the PBF file in the local output path of the database.
+func checkDBDiskSpace(pbfFile, outputPath string, tables int) error {
+	fi, err := os.Stat(pbfFile)
+	if err != nil {
+		return errors.Wrap(err, "checking PBF file size")
+	}
+	return checkDiskSpace(outputPath, "output", estimateDBSize(fi.Size(), tables), pbfFile)
+}
+
+func checkDiskSpace(path, what string, required uint64, pbfFile string) error {
+	available, err := freeDiskSpace(existingParent(path))
+	if err == errDiskSpaceNotSupported {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "checking free disk space for %s", path)
+	}
+	if available < required {
+		return errors.Errorf(
+			"not enough free disk space for %s in %s: %s available, about %s required for %s",
+			what, path, humanSize(available), humanSize(required), pbfFile,
+		)
+	}
+	return nil
+}
+
+// existingParent returns path or the first parent directory of path that
+// exists, as the cache dir is created during the import.
+func existingParent(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+func humanSize(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,17 @@
+package import_
+
+import "syscall"
+
+// freeDiskSpace returns the number of bytes available to the user on the
+// file system of path.
+func freeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	// F_bavail is negative if the reserved space is in use
+	if stat.F_bavail < 0 {
+		return 0, nil
+	}
+	return uint64(stat.F_bavail) * uint64(stat.F_bsize), nil
+}
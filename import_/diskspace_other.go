@@ -0,0 +1,8 @@
+// +build !linux,!darwin,!freebsd,!openbsd,!windows
+
+package import_
+
+// freeDiskSpace is not supported on this system.
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, errDiskSpaceNotSupported
+}
@@ -0,0 +1,62 @@
+package import_
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHumanSize(t *testing.T) {
+	for _, tt := range []struct {
+		size     uint64
+		expected string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0KiB"},
+		{1536, "1.5KiB"},
+		{5 * 1024 * 1024 * 1024, "5.0GiB"},
+	} {
+		if s := humanSize(tt.size); s != tt.expected {
+			t.Errorf("%d: %s != %s", tt.size, s, tt.expected)
+		}
+	}
+}
+
+func TestCheckCacheDiskSpace(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "imposm3_diskspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	pbf := filepath.Join(tmpdir, "test.osm.pbf")
+	if err := ioutil.WriteFile(pbf, make([]byte, 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// cache dir does not exist yet
+	if err := checkCacheDiskSpace(pbf, filepath.Join(tmpdir, "cache", "sub"), true); err != nil {
+		t.Error(err)
+	}
+	// output file does not exist yet
+	if err := checkDBDiskSpace(pbf, filepath.Join(tmpdir, "out.gpkg"), 10); err != nil {
+		t.Error(err)
+	}
+
+	f, err := os.Create(pbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sparse file with 1 EiB
+	if err := f.Truncate(1 << 60); err != nil {
+		t.Skip("unable to create sparse file", err)
+	}
+	f.Close()
+	if err := checkCacheDiskSpace(pbf, tmpdir, false); err == nil {
+		t.Error("expected error for huge PBF file")
+	}
+	if err := checkDBDiskSpace(pbf, filepath.Join(tmpdir, "out.gpkg"), 10); err == nil {
+		t.Error("expected error for huge PBF file")
+	}
+}
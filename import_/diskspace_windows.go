@@ -0,0 +1,34 @@
+package import_
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// freeDiskSpace returns the number of bytes available to the user on the
+// file system of path.
+func freeDiskSpace(path string) (uint64, error) {
+	kernel32, err := syscall.LoadDLL("kernel32.dll")
+	if err != nil {
+		return 0, err
+	}
+	getDiskFreeSpaceEx, err := kernel32.FindProc("GetDiskFreeSpaceExW")
+	if err != nil {
+		return 0, err
+	}
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	r, _, err := getDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&available)),
+		uintptr(unsafe.Pointer(&total)),
+		uintptr(unsafe.Pointer(&free)),
+	)
+	if r == 0 {
+		return 0, err
+	}
+	return available, nil
+}
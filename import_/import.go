@@ -7,16 +7,19 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/omniscale/go-osm/state"
 	"github.com/omniscale/imposm3/cache"
 	"github.com/omniscale/imposm3/config"
 	"github.com/omniscale/imposm3/database"
+	_ "github.com/omniscale/imposm3/database/file"
+	_ "github.com/omniscale/imposm3/database/mvt"
 	_ "github.com/omniscale/imposm3/database/postgis"
+	_ "github.com/omniscale/imposm3/database/spatialite"
 	"github.com/omniscale/imposm3/geom/limit"
 	"github.com/omniscale/imposm3/log"
 	"github.com/omniscale/imposm3/mapping"
 	"github.com/omniscale/imposm3/reader"
 	"github.com/omniscale/imposm3/stats"
+	"github.com/omniscale/imposm3/throttle"
 	"github.com/omniscale/imposm3/update"
 	"github.com/omniscale/imposm3/writer"
 )
@@ -28,22 +31,32 @@ func Import(importOpts config.Import) {
 		log.Fatal("-revertdeploy and -removebackup not compatible with -read/-write")
 	}
 
+	if importOpts.Resume && (!importOpts.Write || importOpts.Read != "") {
+		log.Fatal("-resume requires -write and is not compatible with -read")
+	}
+
 	if importOpts.RevertDeploy && (importOpts.RemoveBackup || importOpts.DeployProduction) {
 		log.Fatal("-revertdeploy not compatible with -deployproduction/-removebackup")
 	}
 
 	var geometryLimiter *limit.Limiter
 	if (importOpts.Write || importOpts.Read != "") && baseOpts.LimitTo != "" {
-		var err error
 		step := log.Step("Reading limitto geometries")
+		limitTo, err := limit.ResolveSource(baseOpts.LimitTo, baseOpts.CacheDir, importOpts.Read)
+		if err != nil {
+			log.Fatal(err)
+		}
 		geometryLimiter, err = limit.NewFromGeoJSON(
-			baseOpts.LimitTo,
+			limitTo,
 			baseOpts.LimitToCacheBuffer,
 			baseOpts.Srid,
 		)
 		if err != nil {
 			log.Fatal(err)
 		}
+		if err := geometryLimiter.SetMode(baseOpts.LimitToMode); err != nil {
+			log.Fatal(err)
+		}
 		step()
 	}
 
@@ -52,18 +65,33 @@ func Import(importOpts config.Import) {
 		log.Fatal("[error] reading mapping file: ", err)
 	}
 
+	throttler, err := throttle.New(baseOpts.ThrottleWindows, baseOpts.ThrottleRate)
+	if err != nil {
+		log.Fatal("[error] ", err)
+	}
+
 	var db database.DB
 
 	if importOpts.Write || importOpts.DeployProduction || importOpts.RevertDeploy || importOpts.RemoveBackup || importOpts.Optimize {
 		if baseOpts.Connection == "" {
 			log.Fatal("[error] missing connection option in configuration")
 		}
+		checksum, err := tagmapping.Checksum()
+		if err != nil {
+			log.Fatal("[error] ", err)
+		}
 		conf := database.Config{
 			ConnectionParams: baseOpts.Connection,
 			Srid:             baseOpts.Srid,
 			ImportSchema:     baseOpts.Schemas.Import,
 			ProductionSchema: baseOpts.Schemas.Production,
 			BackupSchema:     baseOpts.Schemas.Backup,
+
+			DeployLockTimeout: importOpts.DeployLockTimeout,
+			DeployRetries:     importOpts.DeployRetries,
+			Ordered:           importOpts.Ordered,
+			WriteConcurrency:  importOpts.WriteConcurrency,
+			MappingChecksum:   checksum,
 		}
 		db, err = database.Open(conf, &tagmapping.Conf)
 		if err != nil {
@@ -86,12 +114,41 @@ func Import(importOpts config.Import) {
 		}
 	}
 
+	if importOpts.Read != "" && !importOpts.SkipDiskSpace {
+		if err := checkCacheDiskSpace(importOpts.Read, baseOpts.CacheDir, importOpts.Diff); err != nil {
+			log.Fatal("[fatal] ", err, " (use -skip-diskspace-check to ignore)")
+		}
+	}
+	if importOpts.Read != "" && importOpts.Write {
+		tables := len(tagmapping.Conf.Tables)
+		if out, ok := db.(database.FileOutput); ok {
+			if !importOpts.SkipDiskSpace {
+				if err := checkDBDiskSpace(importOpts.Read, out.OutputPath(), tables); err != nil {
+					log.Fatal("[fatal] ", err, " (use -skip-diskspace-check to ignore)")
+				}
+			}
+		} else if fi, err := os.Stat(importOpts.Read); err == nil {
+			log.Printf("[info] estimated database size for %d tables: %s, free disk space of the database server is not checked",
+				tables, humanSize(estimateDBSize(fi.Size(), tables)))
+		}
+	}
+
+	ctx, stop := update.SignalContext()
+	defer stop()
+
 	step := log.Step("Imposm")
+	span := stats.StartSpan("import")
+	defer span.End()
 
 	var elementCounts *stats.ElementCounts
 
 	if importOpts.Read != "" {
 		step := log.Step("Reading OSM data")
+		readSpan := stats.StartSpan("read")
+		readSpan.SetAttribute("imposm.file", importOpts.Read)
+		if fi, err := os.Stat(importOpts.Read); err == nil {
+			readSpan.SetAttribute("imposm.bytes", fi.Size())
+		}
 		err = osmCache.Open()
 		if err != nil {
 			log.Fatal("[error] opening cache files: ", err)
@@ -104,31 +161,42 @@ func Import(importOpts config.Import) {
 		}
 
 		readLimiter := geometryLimiter
-		if baseOpts.LimitToCacheBuffer == 0.0 {
+		if baseOpts.LimitToCacheBuffer == 0.0 && !baseOpts.LimitToCacheBbox {
 			readLimiter = nil
 		}
 
-		err := reader.ReadPbf(importOpts.Read,
+		err := reader.ReadPbf(ctx, importOpts.Read,
 			osmCache,
 			progress,
 			tagmapping,
 			readLimiter,
 		)
 		if err != nil {
+			osmCache.Close()
+			if ctx.Err() != nil {
+				log.Fatal("[fatal] Reading cancelled, cache is incomplete. Use -overwritecache to start again.")
+			}
 			log.Fatal(err)
 		}
 
 		osmCache.Coords.SetLinearImport(false)
 		elementCounts = progress.Stop()
 		osmCache.Close()
+		readSpan.SetAttribute("imposm.nodes", elementCounts.Nodes.Current)
+		readSpan.SetAttribute("imposm.ways", elementCounts.Ways.Current)
+		readSpan.SetAttribute("imposm.relations", elementCounts.Relations.Current)
+		readSpan.End()
 		step()
+		if err := update.WriteMappingChecksum(baseOpts.CacheDir, tagmapping); err != nil {
+			log.Println("[error] writing mapping checksum:", err)
+		}
 		if importOpts.Diff {
 			diffstate, err := estimateFromPBF(importOpts.Read, baseOpts.DiffStateBefore, baseOpts.ReplicationURL, baseOpts.ReplicationInterval)
 			if err != nil {
 				log.Println("[error] parsing diff state form PBF", err)
 			} else if diffstate != nil {
 				os.MkdirAll(baseOpts.DiffDir, 0755)
-				err := state.WriteFile(filepath.Join(baseOpts.DiffDir, update.LastStateFilename), diffstate)
+				err := update.WriteStateFile(filepath.Join(baseOpts.DiffDir, update.LastStateFilename), diffstate)
 				if err != nil {
 					log.Println("[error] writing last.state.txt: ", err)
 				}
@@ -139,28 +207,43 @@ func Import(importOpts config.Import) {
 	if importOpts.Write {
 		importFinished := log.Step("Importing OSM data")
 		writeFinished := log.Step("Writing OSM data")
+		writeSpan := stats.StartSpan("write")
 		progress := stats.NewStatsReporterWithEstimate(elementCounts)
 
-		err = db.Init()
+		checksum, err := tagmapping.Checksum()
 		if err != nil {
 			log.Fatal(err)
 		}
-
-		bulkDb, ok := db.(database.BulkBeginner)
-		if ok {
-			err = bulkDb.BeginBulk()
+		writeState := &writeState{MappingChecksum: checksum}
+		if importOpts.Resume {
+			writeState, err = readWriteState(baseOpts.CacheDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if writeState == nil {
+				log.Fatal("[fatal] -resume requires an interrupted -write, but no write state found in the cache")
+			}
+			if writeState.MappingChecksum != checksum {
+				log.Fatal("[fatal] -resume requires the same mapping as the interrupted -write")
+			}
+			log.Printf("[info] Resuming write, completed phases: %v", writeState.Completed)
 		} else {
-			err = db.Begin()
-		}
-		if err != nil {
-			log.Fatal(err)
+			err = db.Init()
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := writeWriteState(baseOpts.CacheDir, writeState); err != nil {
+				log.Fatal(err)
+			}
 		}
 
 		var diffCache *cache.DiffCache
 		if importOpts.Diff {
 			diffCache = cache.NewDiffCache(baseOpts.CacheDir)
-			if err = diffCache.Remove(); err != nil {
-				log.Fatal(err)
+			if !importOpts.Resume {
+				if err = diffCache.Remove(); err != nil {
+					log.Fatal(err)
+				}
 			}
 			if err = diffCache.Open(); err != nil {
 				log.Fatal(err)
@@ -177,66 +260,214 @@ func Import(importOpts config.Import) {
 		}
 		osmCache.Coords.SetReadOnly(true)
 
-		relations := osmCache.Relations.Iter()
-		relWriter := writer.NewRelationWriter(osmCache, diffCache,
-			tagmapping.Conf.SingleIDSpace,
-			relations,
-			db, progress,
-			tagmapping.PolygonMatcher,
-			tagmapping.RelationMatcher,
-			tagmapping.RelationMemberMatcher,
-			baseOpts.Srid,
-		)
-		relWriter.SetLimiter(geometryLimiter)
-		relWriter.EnableConcurrent()
-		relWriter.Start()
-		relWriter.Wait() // blocks till the Relations.Iter() finishes
+		if importOpts.SkippedReportDir != "" {
+			stats.SkippedElements.Enable(importOpts.SkippedReportLimit, importOpts.SkippedReportSample)
+		}
+		if importOpts.MultipolygonReportDir != "" || importOpts.MultipolygonErrorsTable {
+			stats.MultipolygonErrors.Enable()
+		}
+
+		// writePhase writes one phase in its own transaction and records
+		// the phase as completed after the commit. Each table is truncated
+		// by the first phase that writes into it. A resumed write starts
+		// all tables of the interrupted (and following) phases from
+		// scratch, completed phases are written again for these tables.
+		incomplete := writeState.incompleteTables(tagmapping)
+		truncated := make(map[string]bool)
+		writePhase := func(phase string, write func(m *mapping.Mapping)) {
+			var tables []string
+			for _, name := range phaseTables(tagmapping, phase) {
+				if incomplete[name] {
+					tables = append(tables, name)
+				}
+			}
+			phaseMapping := tagmapping
+			if writeState.done(phase) {
+				if len(tables) == 0 {
+					log.Printf("[info] Skipping %s, already written", phase)
+					return
+				}
+				log.Printf("[info] Writing %s again for the incomplete tables %v", phase, tables)
+				var err error
+				phaseMapping, err = tagmapping.SelectTables(tables)
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			phaseSpan := stats.StartSpan("write " + phase)
+			defer phaseSpan.End()
+
+			var truncate []string
+			for _, name := range tables {
+				if !truncated[name] {
+					truncate = append(truncate, name)
+					truncated[name] = true
+				}
+			}
+			var err error
+			if bulkDb, ok := db.(database.BulkTruncater); ok {
+				err = bulkDb.BeginBulkTruncate(truncate)
+			} else {
+				err = db.Begin()
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			write(phaseMapping)
+
+			if ctx.Err() != nil {
+				if err := db.Abort(); err != nil {
+					log.Println("[error] aborting import:", err)
+				}
+				log.Fatal("[fatal] Writing cancelled, tables in the import schema are incomplete. Use -resume to continue.")
+			}
+			if err := db.End(); err != nil {
+				log.Fatal(err)
+			}
+			if diffCache != nil {
+				diffCache.Flush()
+			}
+			if writeState.done(phase) {
+				return
+			}
+			writeState.Completed = append(writeState.Completed, phase)
+			if err := writeWriteState(baseOpts.CacheDir, writeState); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// only write multipolygon errors if the relations were written
+		// (and not skipped by -resume)
+		multipolygonsCollected := false
+		// outer ways of old-style multipolygons are inserted with the
+		// relations and skipped by the way writer
+		outerWays := writer.NewOuterWays()
+		writePhase(phaseRelations, func(tagmapping *mapping.Mapping) {
+			multipolygonsCollected = stats.MultipolygonErrors.Enabled()
+			relations := osmCache.Relations.Iter()
+			relWriter := writer.NewRelationWriter(osmCache, diffCache,
+				tagmapping.Conf.SingleIDSpace,
+				relations,
+				db, progress,
+				tagmapping.PolygonMatcher,
+				tagmapping.RelationMatcher,
+				tagmapping.RelationMemberMatcher,
+				baseOpts.Srid,
+			)
+			relWriter.SetLimiter(geometryLimiter)
+			relWriter.SetOldStyleMultipolygons(tagmapping.Conf.OldStyleMultipolygons)
+			relWriter.SetOuterWays(outerWays)
+			relWriter.EnableConcurrent()
+			relWriter.SetContext(ctx)
+			relWriter.SetThrottle(throttler)
+			relWriter.SetMaxTags(tagmapping.SkipMaxTags())
+			if importOpts.Ordered {
+				relWriter.EnableOrdered()
+			}
+			relWriter.Start()
+			relWriter.Wait() // blocks till the Relations.Iter() finishes
+		})
 		osmCache.Relations.Close()
 
-		ways := osmCache.Ways.Iter()
-		wayWriter := writer.NewWayWriter(osmCache, diffCache,
-			tagmapping.Conf.SingleIDSpace,
-			ways, db,
-			progress,
-			tagmapping.PolygonMatcher,
-			tagmapping.LineStringMatcher,
-			baseOpts.Srid,
-		)
-		wayWriter.SetLimiter(geometryLimiter)
-		wayWriter.EnableConcurrent()
-		wayWriter.Start()
-		wayWriter.Wait() // blocks till the Ways.Iter() finishes
+		if multipolygonsCollected {
+			mpErrors := stats.MultipolygonErrors.Errors()
+			if len(mpErrors) > 0 {
+				log.Printf("[warn] %d errors in multipolygon relations", len(mpErrors))
+			}
+			if importOpts.MultipolygonReportDir != "" {
+				filename, err := stats.MultipolygonErrors.WriteReport(importOpts.MultipolygonReportDir)
+				if err != nil {
+					log.Fatal(err)
+				}
+				log.Printf("[info] Wrote multipolygon errors to %s", filename)
+			}
+			if importOpts.MultipolygonErrorsTable {
+				if db, ok := db.(database.MultipolygonErrorWriter); ok {
+					if err := db.WriteMultipolygonErrors(mpErrors); err != nil {
+						log.Fatal(err)
+					}
+				} else {
+					log.Fatal("database does not support the rejects table")
+				}
+			}
+		}
+
+		writePhase(phaseWays, func(tagmapping *mapping.Mapping) {
+			ways := osmCache.Ways.Iter()
+			wayWriter := writer.NewWayWriter(osmCache, diffCache,
+				tagmapping.Conf.SingleIDSpace,
+				ways, db,
+				progress,
+				tagmapping.PolygonMatcher,
+				tagmapping.LineStringMatcher,
+				baseOpts.Srid,
+			)
+			wayWriter.SetLimiter(geometryLimiter)
+			wayWriter.SetOldStyleMultipolygons(tagmapping.Conf.OldStyleMultipolygons)
+			wayWriter.SetOuterWays(outerWays)
+			wayWriter.EnableConcurrent()
+			wayWriter.SetContext(ctx)
+			wayWriter.SetThrottle(throttler)
+			wayWriter.SetMaxTags(tagmapping.SkipMaxTags())
+			if importOpts.Ordered {
+				wayWriter.EnableOrdered()
+			}
+			wayWriter.Start()
+			wayWriter.Wait() // blocks till the Ways.Iter() finishes
+		})
 		osmCache.Ways.Close()
 
-		nodes := osmCache.Nodes.Iter()
-		nodeWriter := writer.NewNodeWriter(osmCache, nodes, db,
-			progress,
-			tagmapping.PointMatcher,
-			baseOpts.Srid,
-		)
-		nodeWriter.SetLimiter(geometryLimiter)
-		nodeWriter.EnableConcurrent()
-		nodeWriter.Start()
-		nodeWriter.Wait() // blocks till the Nodes.Iter() finishes
+		writePhase(phaseNodes, func(tagmapping *mapping.Mapping) {
+			nodes := osmCache.Nodes.Iter()
+			nodeWriter := writer.NewNodeWriter(osmCache, nodes, db,
+				progress,
+				tagmapping.PointMatcher,
+				baseOpts.Srid,
+			)
+			nodeWriter.SetLimiter(geometryLimiter)
+			nodeWriter.EnableConcurrent()
+			nodeWriter.SetContext(ctx)
+			nodeWriter.SetThrottle(throttler)
+			nodeWriter.SetMaxTags(tagmapping.SkipMaxTags())
+			if importOpts.Ordered {
+				nodeWriter.EnableOrdered()
+			}
+			nodeWriter.Start()
+			nodeWriter.Wait() // blocks till the Nodes.Iter() finishes
+		})
 		osmCache.Close()
 
-		err = db.End()
-		if err != nil {
-			log.Fatal(err)
+		if err := removeWriteState(baseOpts.CacheDir); err != nil {
+			log.Println("[error]", err)
+		}
+
+		if importOpts.SkippedReportDir != "" {
+			filename, err := stats.SkippedElements.WriteReport(importOpts.SkippedReportDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("[info] Wrote skipped elements to %s", filename)
 		}
 
 		progress.Stop()
 
 		if importOpts.Diff {
 			diffCache.Close()
+			if err := update.WriteMappingChecksum(baseOpts.CacheDir, tagmapping); err != nil {
+				log.Println("[error] writing mapping checksum:", err)
+			}
 		}
 
+		writeSpan.End()
 		writeFinished()
 
 		if db, ok := db.(database.Generalizer); ok {
+			span := stats.StartSpan("generalize")
 			if err := db.Generalize(); err != nil {
 				log.Fatal(err)
 			}
+			span.End()
 		} else {
 			log.Fatal("database not generalizeable")
 		}
@@ -244,9 +475,11 @@ func Import(importOpts config.Import) {
 		// Optimize before creating indices.
 		if importOpts.Optimize {
 			if db, ok := db.(database.Optimizer); ok {
+				span := stats.StartSpan("optimize")
 				if err := db.Optimize(); err != nil {
 					log.Fatal(err)
 				}
+				span.End()
 			} else {
 				log.Fatal("database not optimizable")
 			}
@@ -254,20 +487,25 @@ func Import(importOpts config.Import) {
 
 		// Create indices in finisher.
 		if db, ok := db.(database.Finisher); ok {
+			span := stats.StartSpan("finish")
 			if err := db.Finish(); err != nil {
 				log.Fatal(err)
 			}
+			span.End()
 		} else {
 			log.Fatal("database not finishable")
 		}
 		importFinished()
+		stats.LogInvalidValues()
 	}
 
 	if importOpts.Optimize && !importOpts.Write { // Optimize already called in Write.
 		if db, ok := db.(database.Optimizer); ok {
+			span := stats.StartSpan("optimize")
 			if err := db.Optimize(); err != nil {
 				log.Fatal(err)
 			}
+			span.End()
 		} else {
 			log.Fatal("database not optimizable")
 		}
@@ -275,9 +513,11 @@ func Import(importOpts config.Import) {
 
 	if importOpts.DeployProduction {
 		if db, ok := db.(database.Deployer); ok {
+			span := stats.StartSpan("deploy")
 			if err := db.Deploy(); err != nil {
 				log.Fatal(err)
 			}
+			span.End()
 		} else {
 			log.Fatal("database not deployable")
 		}
@@ -285,9 +525,11 @@ func Import(importOpts config.Import) {
 
 	if importOpts.RevertDeploy {
 		if db, ok := db.(database.Deployer); ok {
+			span := stats.StartSpan("revert deploy")
 			if err := db.RevertDeploy(); err != nil {
 				log.Fatal(err)
 			}
+			span.End()
 		} else {
 			log.Fatal("database not deployable")
 		}
@@ -295,9 +537,11 @@ func Import(importOpts config.Import) {
 
 	if importOpts.RemoveBackup {
 		if db, ok := db.(database.Deployer); ok {
+			span := stats.StartSpan("remove backup")
 			if err := db.RemoveBackup(); err != nil {
 				log.Fatal(err)
 			}
+			span.End()
 		} else {
 			log.Fatal("database not deployable")
 		}
@@ -0,0 +1,268 @@
+package import_
+
+import (
+	"strings"
+
+	"github.com/omniscale/imposm3/cache"
+	"github.com/omniscale/imposm3/config"
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/database/postgis"
+	"github.com/omniscale/imposm3/geom/limit"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/stats"
+	"github.com/omniscale/imposm3/throttle"
+	"github.com/omniscale/imposm3/update"
+	"github.com/omniscale/imposm3/writer"
+)
+
+// Reimport imports the selected tables (and the generalized tables that
+// are derived from them) again from the existing cache. The tables are
+// written into the import schema and replace the tables in the
+// production schema with -deployproduction. All other tables are not
+// changed.
+func Reimport(opts config.Reimport) {
+	baseOpts := opts.Base
+
+	var geometryLimiter *limit.Limiter
+	if baseOpts.LimitTo != "" {
+		step := log.Step("Reading limitto geometries")
+		limitTo, err := limit.ResolveSource(baseOpts.LimitTo, baseOpts.CacheDir, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		geometryLimiter, err = limit.NewFromGeoJSON(
+			limitTo,
+			baseOpts.LimitToCacheBuffer,
+			baseOpts.Srid,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := geometryLimiter.SetMode(baseOpts.LimitToMode); err != nil {
+			log.Fatal(err)
+		}
+		step()
+	}
+
+	fullMapping, err := mapping.FromFile(baseOpts.MappingFile)
+	if err != nil {
+		log.Fatal("[error] reading mapping file: ", err)
+	}
+	prefix, err := postgis.TablePrefix(baseOpts.Connection)
+	if err != nil {
+		log.Fatal("[error] ", err)
+	}
+	tagmapping, err := fullMapping.SelectTables(tableNames(fullMapping, prefix, opts.Tables))
+	if err != nil {
+		log.Fatal("[error] ", err)
+	}
+
+	throttler, err := throttle.New(baseOpts.ThrottleWindows, baseOpts.ThrottleRate)
+	if err != nil {
+		log.Fatal("[error] ", err)
+	}
+
+	mappingChanged := false
+	if err := update.CheckMappingChecksum(baseOpts.CacheDir, fullMapping, false); err != nil {
+		// the cache only contains the tags of the mapping that was used
+		// for -read
+		if !baseOpts.ForceMappingChange {
+			log.Fatal("[fatal] Mapping changed since the import, tags that are only used by the new mapping are missing in the cache. Use -force-mapping-change to import the tables anyway.")
+		}
+		log.Println("[warn] Mapping changed since the import, tags that are only used by the new mapping are missing in the cache (-force-mapping-change)")
+		mappingChanged = true
+	}
+
+	checksum, err := fullMapping.Checksum()
+	if err != nil {
+		log.Fatal("[error] ", err)
+	}
+	conf := database.Config{
+		ConnectionParams: baseOpts.Connection,
+		Srid:             baseOpts.Srid,
+		ImportSchema:     baseOpts.Schemas.Import,
+		ProductionSchema: baseOpts.Schemas.Production,
+		BackupSchema:     baseOpts.Schemas.Backup,
+
+		DeployLockTimeout: opts.DeployLockTimeout,
+		DeployRetries:     opts.DeployRetries,
+		PartialImport:     true,
+		MappingChecksum:   checksum,
+	}
+	db, err := database.Open(conf, &tagmapping.Conf)
+	if err != nil {
+		log.Fatal("[error] opening database: ", err)
+	}
+	defer db.Close()
+	if vc, ok := db.(database.VersionChecker); ok {
+		if err := vc.CheckVersion(); err != nil {
+			log.Fatal("[fatal] ", err)
+		}
+	}
+
+	osmCache := cache.NewOSMCache(baseOpts.CacheDir)
+	if !osmCache.Exists() {
+		log.Fatal("[fatal] reimport-table requires the cache of a previous import in ", baseOpts.CacheDir)
+	}
+
+	ctx, stop := update.SignalContext()
+	defer stop()
+
+	step := log.Step("Imposm")
+	span := stats.StartSpan("reimport")
+	defer span.End()
+
+	importFinished := log.Step("Importing OSM data")
+	writeFinished := log.Step("Writing OSM data")
+	progress := stats.NewStatsReporter()
+
+	if err := db.Init(); err != nil {
+		log.Fatal(err)
+	}
+
+	// the diff cache is only extended, elements of other tables are
+	// still required for diff imports
+	var diffCache *cache.DiffCache
+	if opts.Diff {
+		diffCache = cache.NewDiffCache(baseOpts.CacheDir)
+		if err = diffCache.Open(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := osmCache.Open(); err != nil {
+		log.Fatal(err)
+	}
+	osmCache.Coords.SetReadOnly(true)
+
+	if bulkDb, ok := db.(database.BulkBeginner); ok {
+		err = bulkDb.BeginBulk()
+	} else {
+		err = db.Begin()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// outer ways of old-style multipolygons are inserted with the
+	// relations and skipped by the way writer
+	outerWays := writer.NewOuterWays()
+	relWriter := writer.NewRelationWriter(osmCache, diffCache,
+		tagmapping.Conf.SingleIDSpace,
+		osmCache.Relations.Iter(),
+		db, progress,
+		tagmapping.PolygonMatcher,
+		tagmapping.RelationMatcher,
+		tagmapping.RelationMemberMatcher,
+		baseOpts.Srid,
+	)
+	relWriter.SetLimiter(geometryLimiter)
+	relWriter.SetOldStyleMultipolygons(tagmapping.Conf.OldStyleMultipolygons)
+	relWriter.SetOuterWays(outerWays)
+	relWriter.EnableConcurrent()
+	relWriter.SetContext(ctx)
+	relWriter.SetThrottle(throttler)
+	relWriter.SetMaxTags(tagmapping.SkipMaxTags())
+	relWriter.Start()
+	relWriter.Wait()
+
+	wayWriter := writer.NewWayWriter(osmCache, diffCache,
+		tagmapping.Conf.SingleIDSpace,
+		osmCache.Ways.Iter(), db,
+		progress,
+		tagmapping.PolygonMatcher,
+		tagmapping.LineStringMatcher,
+		baseOpts.Srid,
+	)
+	wayWriter.SetLimiter(geometryLimiter)
+	wayWriter.SetOldStyleMultipolygons(tagmapping.Conf.OldStyleMultipolygons)
+	wayWriter.SetOuterWays(outerWays)
+	wayWriter.EnableConcurrent()
+	wayWriter.SetContext(ctx)
+	wayWriter.SetThrottle(throttler)
+	wayWriter.SetMaxTags(tagmapping.SkipMaxTags())
+	wayWriter.Start()
+	wayWriter.Wait()
+
+	nodeWriter := writer.NewNodeWriter(osmCache, osmCache.Nodes.Iter(), db,
+		progress,
+		tagmapping.PointMatcher,
+		baseOpts.Srid,
+	)
+	nodeWriter.SetLimiter(geometryLimiter)
+	nodeWriter.EnableConcurrent()
+	nodeWriter.SetContext(ctx)
+	nodeWriter.SetThrottle(throttler)
+	nodeWriter.SetMaxTags(tagmapping.SkipMaxTags())
+	nodeWriter.Start()
+	nodeWriter.Wait()
+
+	if ctx.Err() != nil {
+		if err := db.Abort(); err != nil {
+			log.Println("[error] aborting import:", err)
+		}
+		log.Fatal("[fatal] Writing cancelled, tables in the import schema are incomplete.")
+	}
+	if err := db.End(); err != nil {
+		log.Fatal(err)
+	}
+	osmCache.Close()
+	if diffCache != nil {
+		diffCache.Close()
+	}
+	progress.Stop()
+	writeFinished()
+
+	if db, ok := db.(database.Generalizer); ok {
+		if err := db.Generalize(); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		log.Fatal("database not generalizeable")
+	}
+
+	if db, ok := db.(database.Finisher); ok {
+		if err := db.Finish(); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		log.Fatal("database not finishable")
+	}
+	importFinished()
+
+	if opts.DeployProduction {
+		if db, ok := db.(database.Deployer); ok {
+			if err := db.Deploy(); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			log.Fatal("database not deployable")
+		}
+	}
+
+	// the checksum is only updated after the tables of the new mapping
+	// are deployed, diff imports update the production tables
+	if mappingChanged && opts.DeployProduction {
+		if err := update.WriteMappingChecksum(baseOpts.CacheDir, fullMapping); err != nil {
+			log.Fatal("[fatal] writing mapping checksum: ", err)
+		}
+	}
+	step()
+}
+
+// tableNames returns the names of the tables in the mapping. Names are
+// accepted with or without the table prefix (e.g. osm_buildings or
+// buildings).
+func tableNames(m *mapping.Mapping, prefix string, names []string) []string {
+	var result []string
+	for _, name := range names {
+		if _, ok := m.Conf.Tables[name]; !ok && prefix != "" && strings.HasPrefix(name, prefix) {
+			if _, ok := m.Conf.Tables[strings.TrimPrefix(name, prefix)]; ok {
+				name = strings.TrimPrefix(name, prefix)
+			}
+		}
+		result = append(result, name)
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package import_
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/omniscale/imposm3/mapping"
+)
+
+func TestTableNames(t *testing.T) {
+	m, err := mapping.New([]byte(`
+tables:
+  buildings:
+    type: polygon
+    mapping:
+      building: [__any__]
+  osm_buildings:
+    type: polygon
+    mapping:
+      building: [__any__]
+  admin_areas:
+    type: polygon
+    mapping:
+      boundary: [administrative]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		prefix   string
+		names    []string
+		expected []string
+	}{
+		{"osm_", []string{"buildings", "osm_admin_areas"}, []string{"buildings", "admin_areas"}},
+		// table names with the prefix are not stripped
+		{"osm_", []string{"osm_buildings"}, []string{"osm_buildings"}},
+		// prefixes with underscores
+		{"my_osm_", []string{"my_osm_admin_areas"}, []string{"admin_areas"}},
+		{"my_osm_", []string{"osm_admin_areas"}, []string{"osm_admin_areas"}},
+		{"", []string{"osm_admin_areas"}, []string{"osm_admin_areas"}},
+	} {
+		if names := tableNames(m, tt.prefix, tt.names); !reflect.DeepEqual(names, tt.expected) {
+			t.Errorf("%s %v: unexpected names %v", tt.prefix, tt.names, names)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package import_
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/mapping"
+)
+
+const writeStateFilename = "write.state.json"
+
+// Write phases in the order of the import. Each phase is committed before
+// the next phase starts.
+const (
+	phaseRelations = "relations"
+	phaseWays      = "ways"
+	phaseNodes     = "nodes"
+)
+
+// writeState records the completed phases of a -write, so that an
+// interrupted write (e.g. after a lost database connection) can be resumed
+// with -resume.
+type writeState struct {
+	MappingChecksum string   `json:"mapping_checksum"`
+	Completed       []string `json:"completed"`
+}
+
+func (s *writeState) done(phase string) bool {
+	for _, p := range s.Completed {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// phaseTables returns the names of the tables of m that are written by
+// phase.
+func phaseTables(m *mapping.Mapping, phase string) []string {
+	var types []mapping.TableType
+	switch phase {
+	case phaseRelations:
+		types = []mapping.TableType{mapping.PolygonTable, mapping.RelationTable, mapping.RelationMemberTable}
+	case phaseWays:
+		types = []mapping.TableType{mapping.LineStringTable, mapping.PolygonTable}
+	case phaseNodes:
+		types = []mapping.TableType{mapping.PointTable}
+	}
+	types = append(types, mapping.GeometryTable)
+
+	var names []string
+	for name, t := range m.Conf.Tables {
+		for _, typ := range types {
+			if mapping.TableType(t.Type) == typ {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// incompleteTables returns the tables that are written by any phase that
+// is not completed. These tables can contain partial rows of the
+// interrupted phase and they need to be written again by all phases.
+func (s *writeState) incompleteTables(m *mapping.Mapping) map[string]bool {
+	tables := make(map[string]bool)
+	for _, phase := range []string{phaseRelations, phaseWays, phaseNodes} {
+		if s.done(phase) {
+			continue
+		}
+		for _, name := range phaseTables(m, phase) {
+			tables[name] = true
+		}
+	}
+	return tables
+}
+
+// readWriteState returns the write state from cacheDir, or nil if there is
+// no state.
+func readWriteState(cacheDir string) (*writeState, error) {
+	b, err := ioutil.ReadFile(filepath.Join(cacheDir, writeStateFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading write state")
+	}
+	s := &writeState{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, errors.Wrap(err, "parsing write state")
+	}
+	return s, nil
+}
+
+// writeWriteState writes the state atomically into cacheDir.
+func writeWriteState(cacheDir string, s *writeState) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "serializing write state")
+	}
+	fname := filepath.Join(cacheDir, writeStateFilename)
+	tmp := fname + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.Wrap(err, "writing write state")
+	}
+	if err := os.Rename(tmp, fname); err != nil {
+		return errors.Wrap(err, "writing write state")
+	}
+	return nil
+}
+
+func removeWriteState(cacheDir string) error {
+	err := os.Remove(filepath.Join(cacheDir, writeStateFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "removing write state")
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package import_
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/omniscale/imposm3/mapping"
+)
+
+func TestWriteState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_writestate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := readWriteState(dir)
+	if err != nil || s != nil {
+		t.Fatalf("expected no state, got %v %v", s, err)
+	}
+
+	s = &writeState{MappingChecksum: "abc", Completed: []string{phaseRelations}}
+	if err := writeWriteState(dir, s); err != nil {
+		t.Fatal(err)
+	}
+	s2, err := readWriteState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, s2) {
+		t.Errorf("unexpected state %v", s2)
+	}
+	if !s2.done(phaseRelations) || s2.done(phaseWays) {
+		t.Errorf("unexpected completed phases %v", s2.Completed)
+	}
+
+	if err := removeWriteState(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeWriteState(dir); err != nil {
+		t.Fatal(err)
+	}
+	s, err = readWriteState(dir)
+	if err != nil || s != nil {
+		t.Fatalf("expected no state, got %v %v", s, err)
+	}
+}
+
+func TestIncompleteTables(t *testing.T) {
+	m, err := mapping.New([]byte(`
+tables:
+  pois:
+    type: point
+    mapping:
+      amenity: [__any__]
+  roads:
+    type: linestring
+    mapping:
+      highway: [__any__]
+  buildings:
+    type: polygon
+    mapping:
+      building: [__any__]
+  routes:
+    type: relation
+    mapping:
+      route: [__any__]
+  all:
+    type: geometry
+    type_mappings:
+      points:
+        place: [__any__]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		completed []string
+		expected  []string
+	}{
+		{nil, []string{"all", "buildings", "pois", "roads", "routes"}},
+		{[]string{phaseRelations}, []string{"all", "buildings", "pois", "roads"}},
+		{[]string{phaseRelations, phaseWays}, []string{"all", "pois"}},
+		{[]string{phaseRelations, phaseWays, phaseNodes}, nil},
+	} {
+		s := &writeState{Completed: tc.completed}
+		var tables []string
+		for name := range s.incompleteTables(m) {
+			tables = append(tables, name)
+		}
+		sort.Strings(tables)
+		if !reflect.DeepEqual(tables, tc.expected) {
+			t.Errorf("unexpected incomplete tables for %v: %v", tc.completed, tables)
+		}
+	}
+
+	if tables := phaseTables(m, phaseRelations); !reflect.DeepEqual(tables, []string{"all", "buildings", "routes"}) {
+		t.Errorf("unexpected tables for relations: %v", tables)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"math"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -115,12 +116,39 @@ func Printf(format string, v ...interface{}) {
 	DefaultLogger.Printf(format, v...)
 }
 
+var (
+	fatalHooksMu sync.Mutex
+	fatalHooks   []func()
+)
+
+// OnFatal registers f to be called by Fatal and Fatalf before the process
+// exits, e.g. to flush buffered data.
+func OnFatal(f func()) {
+	fatalHooksMu.Lock()
+	fatalHooks = append(fatalHooks, f)
+	fatalHooksMu.Unlock()
+}
+
+func runFatalHooks() {
+	fatalHooksMu.Lock()
+	hooks := fatalHooks
+	fatalHooks = nil
+	fatalHooksMu.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+}
+
 func Fatal(v ...interface{}) {
-	DefaultLogger.Fatal(v...)
+	DefaultLogger.Output(2, fmt.Sprint(v...))
+	runFatalHooks()
+	os.Exit(1)
 }
 
 func Fatalf(format string, v ...interface{}) {
-	DefaultLogger.Fatalf(format, v...)
+	DefaultLogger.Output(2, fmt.Sprintf(format, v...))
+	runFatalHooks()
+	os.Exit(1)
 }
 
 func Step(name string) func() {
@@ -0,0 +1,134 @@
+package mapping
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+// Table is a table of a mapping that is constructed in Go code, as an
+// alternative to mapping files. Add the table to a mapping with
+// Mapping.AddTable:
+//
+//	roads := mapping.NewTable("roads", mapping.LineStringTable).
+//		AddMapping("highway", "motorway", "primary").
+//		AddColumn(config.Column{Name: "osm_id", Type: "id"}).
+//		AddColumn(config.Column{Name: "geometry", Type: "geometry"}).
+//		AddColumn(config.Column{Name: "name", Key: "name", Type: "string"})
+//
+//	m := &mapping.Mapping{}
+//	if err := m.AddTable(roads); err != nil { ... }
+//	if err := m.Validate(); err != nil { ... }
+type Table struct {
+	conf  *config.Table
+	order int
+}
+
+// NewTable returns a new table without mappings and columns.
+func NewTable(name string, tableType TableType) *Table {
+	return &Table{conf: &config.Table{
+		Name: name,
+		Type: string(tableType),
+	}}
+}
+
+// AddMapping adds the values of key to the mapping of the table. The
+// values keep the order in which they are added, as for mapping files.
+func (t *Table) AddMapping(key string, values ...string) *Table {
+	if t.conf.Mapping == nil {
+		t.conf.Mapping = make(config.KeyValues)
+	}
+	k := config.Key(key)
+	for _, v := range values {
+		t.conf.Mapping[k] = append(t.conf.Mapping[k], config.OrderedValue{Value: config.Value(v), Order: t.order})
+		t.order++
+	}
+	return t
+}
+
+// AddColumn appends a column to the table.
+func (t *Table) AddColumn(c config.Column) *Table {
+	t.conf.Columns = append(t.conf.Columns, &c)
+	return t
+}
+
+// AddFilter adds filters to the table. All filters need to match if
+// AddFilter is called multiple times.
+func (t *Table) AddFilter(f config.Filters) *Table {
+	if t.conf.Filters == nil {
+		t.conf.Filters = &f
+		return t
+	}
+	// geometry filters are only supported at the top level
+	top := t.conf.Filters
+	if f.MinArea != 0 {
+		top.MinArea = f.MinArea
+	}
+	if f.MinLength != 0 {
+		top.MinLength = f.MinLength
+	}
+	if f.ClosedOnly {
+		top.ClosedOnly = true
+	}
+	f.MinArea, f.MinLength, f.ClosedOnly = 0, 0, false
+	top.All = append(top.All, f)
+	return t
+}
+
+// Config returns the configuration of the table, e.g. to set options
+// without a dedicated method.
+func (t *Table) Config() *config.Table {
+	return t.conf
+}
+
+// AddTable adds a table to the mapping. Call Validate after all tables are
+// added. Returns an error if the mapping already contains a table with the
+// same name.
+func (m *Mapping) AddTable(t *Table) error {
+	name := t.conf.Name
+	if name == "" {
+		return errors.New("missing table name")
+	}
+	if _, ok := m.Conf.Tables[name]; ok {
+		return errors.Errorf("duplicate table %s", name)
+	}
+	if _, ok := m.Conf.GeneralizedTables[name]; ok {
+		return errors.Errorf("duplicate table %s", name)
+	}
+	if m.Conf.Tables == nil {
+		m.Conf.Tables = make(config.Tables)
+	}
+	m.Conf.Tables[name] = t.conf
+	return nil
+}
+
+// AddGeneralizedTable adds a generalized table of source to the mapping.
+// sqlFilter is optional.
+func (m *Mapping) AddGeneralizedTable(name, source string, tolerance float64, sqlFilter string) error {
+	if _, ok := m.Conf.Tables[name]; ok {
+		return errors.Errorf("duplicate table %s", name)
+	}
+	if _, ok := m.Conf.GeneralizedTables[name]; ok {
+		return errors.Errorf("duplicate table %s", name)
+	}
+	if m.Conf.GeneralizedTables == nil {
+		m.Conf.GeneralizedTables = make(config.GeneralizedTables)
+	}
+	m.Conf.GeneralizedTables[name] = &config.GeneralizedTable{
+		Name:            name,
+		SourceTableName: source,
+		Tolerance:       tolerance,
+		SQLFilter:       sqlFilter,
+	}
+	return nil
+}
+
+// Validate checks the configuration of the mapping and creates the
+// matchers. Mappings from New and FromFile are already validated, mappings
+// that are constructed in code need to be validated before they are used.
+func (m *Mapping) Validate() error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+	return m.createMatcher()
+}
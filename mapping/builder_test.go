@@ -0,0 +1,78 @@
+package mapping
+
+import (
+	"strings"
+	"testing"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+func TestBuilder(t *testing.T) {
+	roads := NewTable("roads", LineStringTable).
+		AddMapping("highway", "motorway", "primary").
+		AddMapping("railway", "rail").
+		AddColumn(config.Column{Name: "osm_id", Type: "id"}).
+		AddColumn(config.Column{Name: "geometry", Type: "geometry"}).
+		AddColumn(config.Column{Name: "name", Key: "name", Type: "string"}).
+		AddFilter(config.Filters{Reject: config.KeyValues{"area": {{Value: "yes"}}}}).
+		AddFilter(config.Filters{RequireAnyKey: []config.Key{"name", "ref"}, MinLength: 10})
+
+	m := &Mapping{}
+	if err := m.AddTable(roads); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddTable(NewTable("roads", PolygonTable)); err == nil {
+		t.Error("expected error for duplicate table")
+	}
+	if err := m.AddGeneralizedTable("roads_gen0", "roads", 100, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := m.Conf.Tables["roads"].Mapping["railway"]; len(v) != 1 || v[0].Order != 2 {
+		t.Errorf("unexpected order of railway values %v", v)
+	}
+	if f := m.Conf.Tables["roads"].Filters; f.MinLength != 10 || len(f.All) != 1 || f.All[0].MinLength != 0 {
+		t.Errorf("unexpected filters %+v", f)
+	}
+
+	for _, tc := range []struct {
+		tags    osm.Tags
+		matches int
+	}{
+		{osm.Tags{"highway": "primary", "name": "Main St"}, 1},
+		{osm.Tags{"railway": "rail", "ref": "1"}, 1},
+		{osm.Tags{"highway": "primary"}, 0},
+		{osm.Tags{"highway": "primary", "name": "Main St", "area": "yes"}, 0},
+		{osm.Tags{"highway": "residential", "name": "Main St"}, 0},
+	} {
+		w := osm.Way{}
+		w.Tags = tc.tags
+		if matches := m.LineStringMatcher.MatchWay(&w); len(matches) != tc.matches {
+			t.Errorf("unexpected matches for %v: %v", tc.tags, matches)
+		}
+	}
+}
+
+func TestBuilderValidate(t *testing.T) {
+	m := &Mapping{}
+	if err := m.AddTable(NewTable("roads", LineStringTable).
+		AddMapping("highway", "__any__").
+		AddColumn(config.Column{Name: "name", Key: "name", Type: "unknown"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate(); err == nil || !strings.Contains(err.Error(), "unhandled type unknown") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	m = &Mapping{}
+	if err := m.AddTable(NewTable("roads", "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate(); err == nil || !strings.Contains(err.Error(), "missing type for table roads") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package mapping
 import (
 	"math"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -10,6 +11,8 @@ import (
 	"github.com/omniscale/imposm3/log"
 
 	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/geom/geos"
+	"github.com/omniscale/imposm3/geom/wkb"
 	"github.com/omniscale/imposm3/mapping/config"
 	"github.com/pkg/errors"
 )
@@ -18,32 +21,56 @@ var AvailableColumnTypes map[string]ColumnType
 
 func init() {
 	AvailableColumnTypes = map[string]ColumnType{
-		"bool":                 {"bool", "bool", Bool, nil, nil, false},
-		"boolint":              {"boolint", "int8", BoolInt, nil, nil, false},
-		"id":                   {"id", "int64", ID, nil, nil, false},
-		"string":               {"string", "string", String, nil, nil, false},
-		"direction":            {"direction", "int8", Direction, nil, nil, false},
-		"integer":              {"integer", "int32", Integer, nil, nil, false},
-		"mapping_key":          {"mapping_key", "string", KeyName, nil, nil, false},
-		"mapping_value":        {"mapping_value", "string", ValueName, nil, nil, false},
-		"member_id":            {"member_id", "int64", nil, nil, RelationMemberID, true},
-		"member_role":          {"member_role", "string", nil, nil, RelationMemberRole, true},
-		"member_type":          {"member_type", "int8", nil, nil, RelationMemberType, true},
-		"member_index":         {"member_index", "int32", nil, nil, RelationMemberIndex, true},
-		"geometry":             {"geometry", "geometry", Geometry, nil, nil, false},
-		"validated_geometry":   {"validated_geometry", "validated_geometry", Geometry, nil, nil, false},
-		"hstore_tags":          {"hstore_tags", "hstore_string", nil, MakeHStoreString, nil, false},
-		"wayzorder":            {"wayzorder", "int32", nil, MakeWayZOrder, nil, false},
-		"pseudoarea":           {"pseudoarea", "float32", nil, MakePseudoArea, nil, false},
-		"area":                 {"area", "float32", Area, nil, nil, false},
-		"webmerc_area":         {"webmerc_area", "float32", WebmercArea, nil, nil, false},
-		"zorder":               {"zorder", "int32", nil, MakeZOrder, nil, false},
-		"enumerate":            {"enumerate", "int32", nil, MakeEnumerate, nil, false},
-		"string_suffixreplace": {"string_suffixreplace", "string", nil, MakeSuffixReplace, nil, false},
+		"bool":                 {"bool", "bool", Bool, nil, nil, false, false},
+		"boolint":              {"boolint", "int8", BoolInt, nil, nil, false, false},
+		"id":                   {"id", "int64", ID, nil, nil, false, false},
+		"string":               {"string", "string", String, nil, nil, false, false},
+		"direction":            {"direction", "int8", Direction, nil, nil, false, false},
+		"integer":              {"integer", "int32", Integer, nil, nil, false, false},
+		"mapping_key":          {"mapping_key", "string", KeyName, nil, nil, false, false},
+		"mapping_value":        {"mapping_value", "string", ValueName, nil, nil, false, false},
+		"member_id":            {"member_id", "int64", nil, nil, RelationMemberID, true, false},
+		"member_role":          {"member_role", "string", nil, nil, RelationMemberRole, true, false},
+		"member_type":          {"member_type", "int8", nil, nil, RelationMemberType, true, false},
+		"member_index":         {"member_index", "int32", nil, nil, RelationMemberIndex, true, false},
+		"geometry":             {"geometry", "geometry", Geometry, nil, nil, false, true},
+		"validated_geometry":   {"validated_geometry", "validated_geometry", Geometry, nil, nil, false, true},
+		"hstore_tags":          {"hstore_tags", "hstore_string", nil, MakeHStoreString, nil, false, false},
+		"wayzorder":            {"wayzorder", "int32", nil, MakeWayZOrder, nil, false, false},
+		"pseudoarea":           {"pseudoarea", "float32", nil, MakePseudoArea, nil, false, true},
+		"area":                 {"area", "float32", nil, MakeArea, nil, false, true},
+		"length":               {"length", "float32", nil, MakeLength, nil, false, true},
+		"webmerc_area":         {"webmerc_area", "float32", WebmercArea, nil, nil, false, true},
+		"zorder":               {"zorder", "int32", nil, MakeZOrder, nil, false, false},
+		"z_order":              {"z_order", "int32", nil, MakeRankedZOrder, nil, false, false},
+		"enumerate":            {"enumerate", "int32", nil, MakeEnumerate, nil, false, false},
+		"enumerate_map":        {"enumerate_map", "int32", nil, MakeEnumerateMap, nil, false, false},
+		"string_suffixreplace": {"string_suffixreplace", "string", nil, MakeSuffixReplace, nil, false, false},
 
 		"categorize_int":             {Name: "categorize_int", GoType: "int32", MakeFunc: MakeCategorizeInt},
-		"geojson_intersects":         {Name: "geojson_intersects", GoType: "bool", MakeFunc: MakeIntersectsField},
-		"geojson_intersects_feature": {Name: "geojson_intersects_feature", GoType: "string", MakeFunc: MakeIntersectsFeatureField},
+		"geojson_intersects":         {Name: "geojson_intersects", GoType: "bool", MakeFunc: MakeIntersectsField, FromGeometry: true},
+		"geojson_intersects_feature": {Name: "geojson_intersects_feature", GoType: "string", MakeFunc: MakeIntersectsFeatureField, FromGeometry: true},
+		"geometry_centroid":          {Name: "geometry_centroid", GoType: "point_geometry", Func: GeometryCentroid, FromGeometry: true},
+		"geometry_pointonsurface":    {Name: "geometry_pointonsurface", GoType: "point_geometry", Func: GeometryPointOnSurface, FromGeometry: true},
+		"geometry_labelpoint":        {Name: "geometry_labelpoint", GoType: "point_geometry", Func: GeometryLabelPoint, FromGeometry: true},
+		"geohash":                    {Name: "geohash", GoType: "string", MakeFunc: MakeGeohash, FromGeometry: true},
+		"member_node_point":          {Name: "member_node_point", GoType: "point_geometry", MakeFunc: MakeMemberNodePoint, FromGeometry: true},
+		"member_node_id":             {Name: "member_node_id", GoType: "int64", MakeFunc: MakeMemberNodeID, FromGeometry: true},
+		"address_part":               {Name: "address_part", GoType: "string", MakeFunc: MakeAddressPart},
+		"simplified_geometry":        {Name: "simplified_geometry", GoType: "simplified_geometry", MakeFunc: MakeSimplifiedGeometry, FromGeometry: true},
+		"timestamp":                  {Name: "timestamp", GoType: "date", Func: Timestamp},
+		"speed":                      {Name: "speed", GoType: "float32", MakeFunc: MakeSpeed},
+		"distance":                   {Name: "distance", GoType: "float32", MakeFunc: MakeDistance},
+		"weight":                     {Name: "weight", GoType: "float32", MakeFunc: MakeWeight},
+		"string_array":               {Name: "string_array", GoType: "string_array", MakeFunc: MakeStringArray},
+		"osm_version":                {Name: "osm_version", GoType: "int32", Func: OSMVersion},
+		"osm_timestamp":              {Name: "osm_timestamp", GoType: "timestamp", Func: OSMTimestamp},
+		"osm_changeset":              {Name: "osm_changeset", GoType: "int64", Func: OSMChangeset},
+		"osm_uid":                    {Name: "osm_uid", GoType: "int32", Func: OSMUID},
+		"osm_user":                   {Name: "osm_user", GoType: "string", Func: OSMUser},
+		"localized_name":             {Name: "localized_name", GoType: "string", MakeFunc: MakeLocalizedName},
+		"admin_level":                {Name: "admin_level", GoType: "int32", Func: AdminLevel},
+		"disputed":                   {Name: "disputed", GoType: "bool", Func: Disputed},
 	}
 }
 
@@ -62,6 +89,9 @@ type ColumnType struct {
 	MakeFunc   MakeMakeValue
 	MemberFunc MakeMemberValue
 	FromMember bool
+	// FromGeometry is set for types with values that depend on the
+	// geometry of the element.
+	FromGeometry bool
 }
 
 func Bool(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
@@ -134,7 +164,80 @@ func Direction(val string, elem *osm.Element, geom *geom.Geometry, match Match)
 }
 
 func Geometry(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
-	return string(geom.Wkb)
+	return geom.Shared("wkb", func() interface{} {
+		return string(geom.Wkb)
+	})
+}
+
+// GeometryCentroid returns the centroid of the geometry as EWKB hex.
+func GeometryCentroid(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+	return derivedGeometry(geom, "centroid", (*geos.Geos).Centroid)
+}
+
+// GeometryPointOnSurface returns a point inside of the geometry as EWKB hex.
+// Use this for labeling instead of the centroid, which can be outside
+// of concave polygons.
+func GeometryPointOnSurface(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+	return derivedGeometry(geom, "point_on_surface", (*geos.Geos).PointOnSurface)
+}
+
+// MakeSimplifiedGeometry returns the geometry simplified with the
+// tolerance from args (in units of the projection).
+func MakeSimplifiedGeometry(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	tolerance, ok := column.Args["tolerance"]
+	if !ok {
+		return nil, errors.Errorf("missing tolerance in args for simplified_geometry column %s", columnName)
+	}
+	var t float64
+	switch v := tolerance.(type) {
+	case int:
+		t = float64(v)
+	case float64:
+		t = v
+	default:
+		return nil, errors.Errorf("tolerance in args for simplified_geometry column %s not a number", columnName)
+	}
+	simplify := func(g *geos.Geos, geom *geos.Geom) *geos.Geom {
+		return g.SimplifyPreserveTopology(geom, t)
+	}
+	key := "simplified:" + strconv.FormatFloat(t, 'g', -1, 64)
+	return func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+		return derivedGeometry(geom, key, simplify)
+	}, nil
+}
+
+// derivedGeometry returns the result of op as EWKB hex. The result is
+// shared between all tables with the same derived geometry (key).
+func derivedGeometry(geom *geom.Geometry, key string, op func(*geos.Geos, *geos.Geom) *geos.Geom) interface{} {
+	if geom.Geom == nil {
+		return nil
+	}
+	return geom.Shared(key, func() interface{} {
+		return buildDerivedGeometry(geom, op)
+	})
+}
+
+// buildDerivedGeometry uses the GEOS handle of geom. A temporary handle is
+// only created for geometries without one (e.g. from tests).
+func buildDerivedGeometry(geom *geom.Geometry, op func(*geos.Geos, *geos.Geom) *geos.Geom) interface{} {
+	g := geom.Geos
+	if g == nil {
+		g = geos.NewGeos()
+		defer g.Finish()
+		// keep SRID of the source geometry for the EWKB
+		g.SetHandleSrid(g.Srid(geom.Geom))
+	}
+
+	result := op(g, geom.Geom)
+	if result == nil {
+		return nil
+	}
+	defer g.Destroy(result)
+	wkb := g.AsEwkbHex(result)
+	if wkb == nil {
+		return nil
+	}
+	return string(wkb)
 }
 
 func MakePseudoArea(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
@@ -146,7 +249,7 @@ func Area(val string, elem *osm.Element, geom *geom.Geometry, match Match) inter
 	if geom.Geom == nil {
 		return nil
 	}
-	area := geom.Geom.Area()
+	area := geom.Area()
 	if area == 0.0 {
 		return nil
 	}
@@ -157,20 +260,123 @@ func WebmercArea(val string, elem *osm.Element, geom *geom.Geometry, match Match
 	if geom.Geom == nil {
 		return nil
 	}
-	area := geom.Geom.Area()
+	area := geom.Area()
 	if area == 0.0 {
 		return nil
 	}
 
+	area = area * math.Pow(webmercScale(geom), 2)
+
+	return float32(area)
+}
+
+// webmercScale returns the scale factor between EPSG:3857 units and meters
+// at the center of the geometry.
+func webmercScale(geom *geom.Geometry) float64 {
 	bounds := geom.Geom.Bounds()
 	midY := bounds.MinY + (bounds.MaxY-bounds.MinY)/2
 
 	pole := 6378137 * math.Pi // 20037508.342789244
 	midLat := 2*math.Atan(math.Exp((midY/pole)*math.Pi)) - math.Pi/2
 
-	area = area * math.Pow(math.Cos(midLat), 2)
+	return math.Cos(midLat)
+}
 
-	return float32(area)
+// decodeUnitArg returns the factor to convert meters into the configured
+// unit. webmercator returns 0, as the values are used as-is.
+func decodeUnitArg(column config.Column) (float64, error) {
+	unit, ok := column.Args["unit"]
+	if !ok {
+		return 0, nil
+	}
+	switch unit {
+	case "webmercator":
+		return 0, nil
+	case "meters", "m":
+		return 1, nil
+	case "kilometers", "km":
+		return 1e-3, nil
+	}
+	return 0, errors.Errorf("unknown unit %v for %s column %s", unit, column.Type, column.Name)
+}
+
+// MakeArea returns the area of polygons in the configured unit (meters or
+// kilometers for square meters or kilometers, or webmercator).
+// Metric areas are calculated on a sphere.
+func MakeArea(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	factor, err := decodeUnitArg(column)
+	if err != nil {
+		return nil, err
+	}
+	if factor == 0 {
+		return Area, nil
+	}
+	factor = factor * factor
+	area := func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+		return metricValue(elem, geom, geodesicArea, factor)
+	}
+	return area, nil
+}
+
+// MakeLength returns the length of linestrings (or the perimeter of
+// polygons) in the configured unit (meters, kilometers, or webmercator).
+// Metric lengths are calculated on a sphere.
+func MakeLength(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	factor, err := decodeUnitArg(column)
+	if err != nil {
+		return nil, err
+	}
+	if factor != 0 {
+		return func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+			return metricValue(elem, geom, geodesicLength, factor)
+		}, nil
+	}
+	length := func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+		if geom.Geom == nil {
+			return nil
+		}
+		length := geom.Length()
+		if length == 0.0 {
+			return nil
+		}
+		return float32(length)
+	}
+	return length, nil
+}
+
+// metricValue returns the geodesic measure of the geometry multiplied by
+// factor. The coordinates are transformed by the SRID of the geometry.
+func metricValue(
+	elem *osm.Element,
+	geom *geom.Geometry,
+	measure func(wkb.Geometry, func(x, y float64) (float64, float64)) float64,
+	factor float64,
+) interface{} {
+	if geom.Geom == nil {
+		return nil
+	}
+	// parse once for all metric columns of all tables
+	parsed, ok := geom.Shared("parsed_wkb", func() interface{} {
+		parsed, err := wkb.ParseHex(string(geom.Wkb))
+		if err != nil {
+			log.Printf("[warn]: measuring %d: %s", elem.ID, err)
+			return nil
+		}
+		return parsed
+	}).(wkb.Geometry)
+	if !ok {
+		return nil
+	}
+	toWgs, err := wgsTransformer(parsed.SRID)
+	if err != nil {
+		log.Printf("[warn]: measuring %d: %s", elem.ID, err)
+		return nil
+	}
+	v := measure(parsed, toWgs)
+	if v == 0.0 {
+		return nil
+	}
+	return float32(v * factor)
 }
 
 var hstoreReplacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
@@ -188,13 +394,28 @@ func MakeHStoreString(columnName string, columnType ColumnType, column config.Co
 		}
 
 	}
+	maxKeys := 0
+	if v, ok := column.Args["max_keys"]; ok {
+		if maxKeys, ok = v.(int); !ok || maxKeys <= 0 {
+			return nil, errors.Errorf("max_keys in args for hstore_tags column %s not a positive number", columnName)
+		}
+	}
 	hstoreString := func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
-		tags := make([]string, 0, len(elem.Tags))
-		for k, v := range elem.Tags {
+		keys := make([]string, 0, len(elem.Tags))
+		for k := range elem.Tags {
 			if includeAll || include[k] != 0 {
-				tags = append(tags, `"`+hstoreReplacer.Replace(k)+`"=>"`+hstoreReplacer.Replace(v)+`"`)
+				keys = append(keys, k)
 			}
 		}
+		if maxKeys > 0 && len(keys) > maxKeys {
+			// keep the same keys for each update of the element
+			sort.Strings(keys)
+			keys = keys[:maxKeys]
+		}
+		tags := make([]string, 0, len(keys))
+		for _, k := range keys {
+			tags = append(tags, `"`+hstoreReplacer.Replace(k)+`"=>"`+hstoreReplacer.Replace(elem.Tags[k])+`"`)
+		}
 		return strings.Join(tags, ", ")
 	}
 	return hstoreString, nil
@@ -356,6 +577,52 @@ func MakeEnumerate(columnName string, columnType ColumnType, column config.Colum
 	return enumerate, nil
 }
 
+// MakeEnumerateMap stores tag values as integers, like enumerate, but with
+// explicit integers for each value.
+func MakeEnumerateMap(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	_values, ok := column.Args["values"]
+	if !ok {
+		return nil, errors.New("missing 'values' in args for enumerate_map")
+	}
+	valuesMap, ok := _values.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("'values' in args for enumerate_map not a dictionary")
+	}
+
+	values := make(map[string]int)
+	for k, v := range valuesMap {
+		valueName, ok := k.(string)
+		if !ok {
+			return nil, errors.Errorf("value %v in 'values' not a string", k)
+		}
+		i, ok := asInt(v)
+		if !ok {
+			return nil, errors.Errorf("integer for %s in 'values' not a number", valueName)
+		}
+		values[valueName] = i
+	}
+
+	defaultValue := 0
+	if _default, ok := column.Args["default"]; ok {
+		defaultValue, ok = asInt(_default)
+		if !ok {
+			return nil, errors.New("'default' in args for enumerate_map not a number")
+		}
+	}
+
+	enumerate := func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+		if column.Key == "" {
+			val = match.Value
+		}
+		if r, ok := values[val]; ok {
+			return r
+		}
+		return defaultValue
+	}
+
+	return enumerate, nil
+}
+
 func decodeEnumArg(column config.Column, key string) (map[string]int, error) {
 	_valuesList, ok := column.Args[key]
 	if !ok {
@@ -0,0 +1,39 @@
+package mapping
+
+import (
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+// MakeAddressPart returns the value of the first available tag of key or
+// keys (e.g. addr:city). It falls back to the property of the GeoJSON feature
+// that intersects the element, if geojson and property are set in args
+// (e.g. the name of the administrative area).
+func MakeAddressPart(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	var fromFeature MakeValue
+	if _, ok := column.Args["geojson"]; ok {
+		var err error
+		fromFeature, err = MakeIntersectsFeatureField(columnName, columnType, column)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	makeValue := func(val string, elem *osm.Element, geom *geom.Geometry, m Match) interface{} {
+		if val != "" {
+			return val
+		}
+		for _, k := range column.Keys {
+			if v, ok := elem.Tags[string(k)]; ok && v != "" {
+				return v
+			}
+		}
+		if fromFeature != nil && geom != nil && geom.Geom != nil {
+			return fromFeature(val, elem, geom, m)
+		}
+		return nil
+	}
+
+	return makeValue, nil
+}
@@ -0,0 +1,53 @@
+package mapping
+
+import (
+	"strings"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
+)
+
+// MakeStringArray splits values like cuisine=pizza;kebab into a TEXT[]
+// array. The separator defaults to ; and values are trimmed unless trim is
+// false. Empty values are skipped.
+func MakeStringArray(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	separator := ";"
+	if v, ok := column.Args["separator"]; ok {
+		separator, ok = v.(string)
+		if !ok || separator == "" {
+			return nil, errors.Errorf("separator in args for %s column %s not a string", column.Type, column.Name)
+		}
+	}
+	trim := true
+	if v, ok := column.Args["trim"]; ok {
+		trim, ok = v.(bool)
+		if !ok {
+			return nil, errors.Errorf("trim in args for %s column %s not a bool", column.Type, column.Name)
+		}
+	}
+
+	stringArray := func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+		if val == "" {
+			return nil
+		}
+		parts := strings.Split(val, separator)
+		values := make([]string, 0, len(parts))
+		for _, p := range parts {
+			if trim {
+				p = strings.TrimSpace(p)
+			}
+			if p == "" {
+				continue
+			}
+			// same quoting rules as hstore
+			values = append(values, `"`+hstoreReplacer.Replace(p)+`"`)
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		return "{" + strings.Join(values, ",") + "}"
+	}
+	return stringArray, nil
+}
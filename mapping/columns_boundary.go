@@ -0,0 +1,46 @@
+package mapping
+
+import (
+	"strconv"
+	"strings"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+)
+
+// AdminLevel returns the admin_level as integer, to order boundaries by
+// their hierarchy. The value of the admin_level tag is used if the column
+// has no key. Lists of levels (4;6) return the lowest level, values outside
+// of 1 to 12 return nil.
+func AdminLevel(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+	if val == "" {
+		val = elem.Tags["admin_level"]
+	}
+	level := 0
+	for _, part := range strings.Split(val, ";") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || v < 1 || v > 12 {
+			continue
+		}
+		if level == 0 || v < level {
+			level = v
+		}
+	}
+	if level == 0 {
+		return nil
+	}
+	return level
+}
+
+// disputedKeys are the tags that are read by Disputed.
+var disputedKeys = []Key{"disputed", "disputed_by", "boundary"}
+
+// Disputed returns whether the element is a disputed boundary
+// (disputed=yes, boundary=disputed or with a disputed_by tag).
+func Disputed(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+	tags := elem.Tags
+	if tags["disputed"] == "yes" || tags["boundary"] == "disputed" || tags["disputed_by"] != "" {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package mapping
+
+import (
+	"math"
+	"sync"
+
+	"github.com/omniscale/imposm3/geom/wkb"
+	"github.com/omniscale/imposm3/proj"
+)
+
+// earthRadius is the mean radius of the earth in meters.
+const earthRadius = 6371008.8
+
+var (
+	wgsTransformersMu sync.Mutex
+	wgsTransformers   = map[uint32]func(x, y float64) (float64, float64){}
+)
+
+// wgsTransformer returns the (cached) transformation from srid into
+// EPSG:4326.
+func wgsTransformer(srid uint32) (func(x, y float64) (float64, float64), error) {
+	wgsTransformersMu.Lock()
+	defer wgsTransformersMu.Unlock()
+	if t, ok := wgsTransformers[srid]; ok {
+		return t, nil
+	}
+	t, err := proj.Transformer(int(srid), 4326)
+	if err != nil {
+		return nil, err
+	}
+	wgsTransformers[srid] = t
+	return t, nil
+}
+
+// geodesicLength returns the length of all linestrings and rings of g in
+// meters on a sphere. toWgs transforms the coordinates into EPSG:4326.
+func geodesicLength(g wkb.Geometry, toWgs func(x, y float64) (float64, float64)) float64 {
+	if g.Type == wkb.Point || g.Type == wkb.MultiPoint {
+		return 0
+	}
+	length := 0.0
+	for i := range g.Parts {
+		length += geodesicLength(g.Parts[i], toWgs)
+	}
+	for _, ring := range g.Rings() {
+		for i := 2; i+1 < len(ring); i += 2 {
+			long1, lat1 := toWgs(ring[i-2], ring[i-1])
+			long2, lat2 := toWgs(ring[i], ring[i+1])
+			length += haversine(long1, lat1, long2, lat2)
+		}
+	}
+	return length
+}
+
+// haversine returns the great-circle distance between two points in meters.
+func haversine(long1, lat1, long2, lat2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := phi2 - phi1
+	dLambda := (long2 - long1) * math.Pi / 180
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// geodesicArea returns the area of all polygons of g in square meters on a
+// sphere. toWgs transforms the coordinates into EPSG:4326.
+func geodesicArea(g wkb.Geometry, toWgs func(x, y float64) (float64, float64)) float64 {
+	area := 0.0
+	for i := range g.Parts {
+		area += geodesicArea(g.Parts[i], toWgs)
+	}
+	if g.Type != wkb.Polygon {
+		return area
+	}
+	for i, ring := range g.Rings() {
+		if i == 0 {
+			area += sphericalRingArea(ring, toWgs)
+		} else {
+			area -= sphericalRingArea(ring, toWgs)
+		}
+	}
+	return area
+}
+
+// sphericalRingArea returns the absolute area of the closed ring in square
+// meters. See Chamberlain and Duquette, "Some Algorithms for Polygons on a
+// Sphere", JPL Publication 07-03.
+func sphericalRingArea(ring []float64, toWgs func(x, y float64) (float64, float64)) float64 {
+	n := len(ring)/2 - 1 // last point repeats the first
+	if n < 3 {
+		return 0
+	}
+	longs := make([]float64, n)
+	lats := make([]float64, n)
+	for i := 0; i < n; i++ {
+		longs[i], lats[i] = toWgs(ring[i*2], ring[i*2+1])
+		longs[i] *= math.Pi / 180
+		lats[i] *= math.Pi / 180
+	}
+	sum := 0.0
+	for i := 0; i < n; i++ {
+		prev := longs[(i+n-1)%n]
+		next := longs[(i+1)%n]
+		sum += (next - prev) * math.Sin(lats[i])
+	}
+	return math.Abs(sum * earthRadius * earthRadius / 2)
+}
@@ -0,0 +1,79 @@
+package mapping
+
+import (
+	"github.com/pkg/errors"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/geom/geos"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/omniscale/imposm3/proj"
+)
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// MakeGeohash returns the geohash of the center of the bounding box of the
+// geometry, with precision characters (1 by default).
+func MakeGeohash(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	precision := 1
+	if v, ok := column.Args["precision"]; ok {
+		p, ok := v.(int)
+		if !ok || p < 1 || p > 12 {
+			return nil, errors.Errorf("precision of %s needs to be an integer between 1 and 12", columnName)
+		}
+		precision = p
+	}
+	g := geos.NewGeos()
+	geohash := func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+		if geom == nil || geom.Geom == nil {
+			return nil
+		}
+		b := geom.Geom.Bounds()
+		if b == geos.NilBounds {
+			return nil
+		}
+		x, y := (b.MinX+b.MaxX)/2, (b.MinY+b.MaxY)/2
+		if g.Srid(geom.Geom) != 4326 {
+			x, y = proj.MercToWgs(x, y)
+		}
+		return encodeGeohash(x, y, precision)
+	}
+	return geohash, nil
+}
+
+// encodeGeohash returns the geohash of a EPSG:4326 coordinate.
+func encodeGeohash(long, lat float64, precision int) string {
+	minLong, maxLong := -180.0, 180.0
+	minLat, maxLat := -90.0, 90.0
+	hash := make([]byte, 0, precision)
+	even := true
+	bit, ch := 0, 0
+	for len(hash) < precision {
+		if even {
+			mid := (minLong + maxLong) / 2
+			if long >= mid {
+				ch = ch<<1 | 1
+				minLong = mid
+			} else {
+				ch = ch << 1
+				maxLong = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if lat >= mid {
+				ch = ch<<1 | 1
+				minLat = mid
+			} else {
+				ch = ch << 1
+				maxLat = mid
+			}
+		}
+		even = !even
+		bit++
+		if bit == 5 {
+			hash = append(hash, geohashBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
@@ -0,0 +1,56 @@
+package mapping
+
+import (
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/geom/geos"
+	"github.com/omniscale/imposm3/geom/wkb"
+	"github.com/omniscale/imposm3/log"
+)
+
+// GeometryLabelPoint returns the pole of inaccessibility of polygons as EWKB
+// hex, the point inside the polygon that is farthest from the boundary. The
+// largest polygon of multipolygons is used. Returns the point on surface of
+// other geometries.
+func GeometryLabelPoint(val string, elem *osm.Element, g *geom.Geometry, match Match) interface{} {
+	return derivedGeometry(g, "labelpoint", func(gg *geos.Geos, source *geos.Geom) *geos.Geom {
+		parsed, err := wkb.ParseHex(string(g.Wkb))
+		if err != nil {
+			log.Printf("[warn]: label point of %d: %s", elem.ID, err)
+			return gg.PointOnSurface(source)
+		}
+		rings := largestPolygon(parsed)
+		if rings == nil {
+			return gg.PointOnSurface(source)
+		}
+		x, y := geom.Polylabel(rings, 0)
+		return gg.Point(x, y)
+	})
+}
+
+// largestPolygon returns the rings of the polygon, or of the polygon with
+// the largest area of multipolygons. Returns nil for other geometries.
+func largestPolygon(g wkb.Geometry) [][]float64 {
+	switch g.Type {
+	case wkb.Polygon:
+		return g.Rings()
+	case wkb.MultiPolygon:
+		var largest [][]float64
+		largestArea := -1.0
+		for i := range g.Parts {
+			rings := g.Parts[i].Rings()
+			if len(rings) == 0 {
+				continue
+			}
+			area := geom.RingArea(rings[0])
+			for _, hole := range rings[1:] {
+				area -= geom.RingArea(hole)
+			}
+			if area > largestArea {
+				largest, largestArea = rings, area
+			}
+		}
+		return largest
+	}
+	return nil
+}
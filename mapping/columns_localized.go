@@ -0,0 +1,170 @@
+package mapping
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+// Transliterator converts a name into another script. Characters that it
+// does not handle should be kept.
+type Transliterator func(string) string
+
+var (
+	transliteratorsMu sync.RWMutex
+	transliterators   = map[string]Transliterator{
+		"latin": TransliterateLatin,
+	}
+)
+
+// RegisterTransliterator makes a transliterator available for the
+// transliterate option of localized_name columns. Programs that embed
+// Imposm can register their own transliterators before the mapping is
+// loaded.
+func RegisterTransliterator(name string, t Transliterator) {
+	transliteratorsMu.Lock()
+	defer transliteratorsMu.Unlock()
+	transliterators[name] = t
+}
+
+func transliterator(name string) (Transliterator, bool) {
+	transliteratorsMu.RLock()
+	defer transliteratorsMu.RUnlock()
+	t, ok := transliterators[name]
+	return t, ok
+}
+
+type localizedNameOptions struct {
+	// languageKeys are the keys of the localized names (e.g. name:de)
+	languageKeys []string
+	// fallbackKeys are the keys that are used if no localized name is
+	// set (e.g. int_name, name)
+	fallbackKeys  []string
+	transliterate Transliterator
+}
+
+func parseLocalizedNameOptions(column config.Column) (localizedNameOptions, error) {
+	opts := localizedNameOptions{}
+	base := string(column.Key)
+	if base == "" {
+		base = "name"
+	}
+
+	languages, ok := column.Args["languages"].([]interface{})
+	if !ok || len(languages) == 0 {
+		return opts, errors.New("missing languages in args for localized_name")
+	}
+	for _, l := range languages {
+		lang, ok := l.(string)
+		if !ok || lang == "" {
+			return opts, errors.Errorf("language %v in args for localized_name not a string", l)
+		}
+		opts.languageKeys = append(opts.languageKeys, base+":"+lang)
+	}
+	for _, k := range column.Keys {
+		opts.fallbackKeys = append(opts.fallbackKeys, string(k))
+	}
+	opts.fallbackKeys = append(opts.fallbackKeys, base)
+
+	if name, ok := column.Args["transliterate"]; ok {
+		s, ok := name.(string)
+		if !ok {
+			return opts, errors.New("transliterate in args for localized_name not a string")
+		}
+		opts.transliterate, ok = transliterator(s)
+		if !ok {
+			return opts, errors.Errorf("unknown transliterator %q for localized_name", s)
+		}
+	}
+	return opts, nil
+}
+
+// localizedNameKeys returns all keys that a localized_name column reads.
+func localizedNameKeys(column config.Column) []string {
+	opts, err := parseLocalizedNameOptions(column)
+	if err != nil {
+		return nil
+	}
+	return append(opts.languageKeys, opts.fallbackKeys...)
+}
+
+// MakeLocalizedName returns the name in the first language of the
+// languages list in args (e.g. name:de, then name:en). It falls back to the
+// keys and then to the key of the column (name by default). Fallback
+// values are converted with the transliterator in args, if set.
+func MakeLocalizedName(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	opts, err := parseLocalizedNameOptions(column)
+	if err != nil {
+		return nil, err
+	}
+
+	makeValue := func(val string, elem *osm.Element, geom *geom.Geometry, m Match) interface{} {
+		for _, k := range opts.languageKeys {
+			if v := elem.Tags[k]; v != "" {
+				return v
+			}
+		}
+		for _, k := range opts.fallbackKeys {
+			if v := elem.Tags[k]; v != "" {
+				if opts.transliterate != nil {
+					return opts.transliterate(v)
+				}
+				return v
+			}
+		}
+		return nil
+	}
+	return makeValue, nil
+}
+
+var latinTransliteration = map[rune]string{
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g", 'ў': "u", 'ђ': "đ", 'ј': "j",
+	'љ': "lj", 'њ': "nj", 'ћ': "ć", 'џ': "dž",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+	'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+	'ϊ': "i", 'ϋ': "y", 'ΐ': "i", 'ΰ': "y",
+}
+
+// TransliterateLatin converts Cyrillic and Greek characters into Latin
+// characters. All other characters are kept.
+func TransliterateLatin(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	runes := []rune(s)
+	for i, r := range runes {
+		lower := unicode.ToLower(r)
+		t, ok := latinTransliteration[lower]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		if lower != r && t != "" {
+			// keep upper case, e.g. Щ -> Shch, or SHCH if the next
+			// character is upper case as well
+			if i+1 < len(runes) && unicode.IsUpper(runes[i+1]) {
+				t = strings.ToUpper(t)
+			} else {
+				tr := []rune(t)
+				t = string(unicode.ToUpper(tr[0])) + string(tr[1:])
+			}
+		}
+		b.WriteString(t)
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package mapping
+
+import (
+	"github.com/pkg/errors"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+// memberNodeRoles returns the roles from the args of a member_node_point or
+// member_node_id column.
+func memberNodeRoles(columnName string, column config.Column) ([]string, error) {
+	if role, ok := column.Args["role"].(string); ok && role != "" {
+		return []string{role}, nil
+	}
+	roles, ok := column.Args["roles"].([]interface{})
+	if !ok || len(roles) == 0 {
+		return nil, errors.Errorf("missing role or roles in args for %s", columnName)
+	}
+	var result []string
+	for _, r := range roles {
+		role, ok := r.(string)
+		if !ok || role == "" {
+			return nil, errors.Errorf("role %v in args for %s not a string", r, columnName)
+		}
+		result = append(result, role)
+	}
+	return result, nil
+}
+
+// findMemberNode returns the first node member with the first of the roles
+// that is found.
+func findMemberNode(g *geom.Geometry, roles []string) *geom.MemberNode {
+	for _, role := range roles {
+		for i := range g.MemberNodes {
+			if g.MemberNodes[i].Role == role {
+				return &g.MemberNodes[i]
+			}
+		}
+	}
+	return nil
+}
+
+// MakeMemberNodePoint returns the point of the node member of a relation
+// with the role from args, e.g. the admin_centre of a boundary. The roles
+// in args are checked in order.
+func MakeMemberNodePoint(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	roles, err := memberNodeRoles(columnName, column)
+	if err != nil {
+		return nil, err
+	}
+	memberNodePoint := func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+		if n := findMemberNode(geom, roles); n != nil {
+			return string(n.Wkb)
+		}
+		return nil
+	}
+	return memberNodePoint, nil
+}
+
+// MakeMemberNodeID returns the ID of the node member of a relation with
+// the role from args.
+func MakeMemberNodeID(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	roles, err := memberNodeRoles(columnName, column)
+	if err != nil {
+		return nil, err
+	}
+	memberNodeID := func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+		if n := findMemberNode(geom, roles); n != nil {
+			return n.ID
+		}
+		return nil
+	}
+	return memberNodeID, nil
+}
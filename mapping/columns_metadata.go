@@ -0,0 +1,66 @@
+package mapping
+
+import (
+	"time"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+)
+
+// metadataColumnTypes require OSM metadata (version, timestamp, etc.) from
+// the PBF and diff files.
+var metadataColumnTypes = map[string]struct{}{
+	"osm_version":   {},
+	"osm_timestamp": {},
+	"osm_changeset": {},
+	"osm_uid":       {},
+	"osm_user":      {},
+}
+
+// UsesMetadata returns whether any table contains a column that requires
+// OSM metadata.
+func (m *Mapping) UsesMetadata() bool {
+	for _, t := range m.Conf.Tables {
+		for _, col := range t.Columns {
+			if _, ok := metadataColumnTypes[col.Type]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func OSMVersion(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+	if elem.Metadata == nil {
+		return nil
+	}
+	return elem.Metadata.Version
+}
+
+func OSMTimestamp(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+	if elem.Metadata == nil || elem.Metadata.Timestamp.IsZero() {
+		return nil
+	}
+	return elem.Metadata.Timestamp.UTC().Format(time.RFC3339)
+}
+
+func OSMChangeset(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+	if elem.Metadata == nil {
+		return nil
+	}
+	return elem.Metadata.Changeset
+}
+
+func OSMUID(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+	if elem.Metadata == nil {
+		return nil
+	}
+	return elem.Metadata.UserID
+}
+
+func OSMUser(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+	if elem.Metadata == nil || elem.Metadata.UserName == "" {
+		return nil
+	}
+	return elem.Metadata.UserName
+}
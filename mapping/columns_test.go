@@ -1,12 +1,17 @@
 package mapping
 
 import (
+	"math"
 	"testing"
+	"time"
 
 	osm "github.com/omniscale/go-osm"
 	"github.com/omniscale/imposm3/geom"
 	"github.com/omniscale/imposm3/geom/geos"
+	"github.com/omniscale/imposm3/geom/wkb"
 	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/omniscale/imposm3/proj"
+	"github.com/omniscale/imposm3/stats"
 )
 
 func TestBool(t *testing.T) {
@@ -71,6 +76,45 @@ func TestInteger(t *testing.T) {
 	}
 }
 
+func TestAdminLevel(t *testing.T) {
+	for _, tc := range []struct {
+		val      string
+		tags     osm.Tags
+		expected interface{}
+	}{
+		{"4", nil, 4},
+		{"6;4", nil, 4},
+		{" 8 ", nil, 8},
+		{"0", nil, nil},
+		{"13", nil, nil},
+		{"state", nil, nil},
+		{"", osm.Tags{"admin_level": "2"}, 2},
+		{"", nil, nil},
+	} {
+		elem := &osm.Element{Tags: tc.tags}
+		if v := AdminLevel(tc.val, elem, nil, Match{}); v != tc.expected {
+			t.Errorf("%q %v -> %v, expected %v", tc.val, tc.tags, v, tc.expected)
+		}
+	}
+}
+
+func TestDisputed(t *testing.T) {
+	for _, tc := range []struct {
+		tags     osm.Tags
+		expected bool
+	}{
+		{osm.Tags{"boundary": "administrative"}, false},
+		{osm.Tags{"boundary": "administrative", "disputed": "yes"}, true},
+		{osm.Tags{"boundary": "administrative", "disputed": "no"}, false},
+		{osm.Tags{"boundary": "disputed"}, true},
+		{osm.Tags{"boundary": "administrative", "disputed_by": "XY"}, true},
+	} {
+		if v := Disputed("", &osm.Element{Tags: tc.tags}, nil, Match{}); v != tc.expected {
+			t.Errorf("%v -> %v", tc.tags, v)
+		}
+	}
+}
+
 func TestZOrder(t *testing.T) {
 	match := Match{}
 
@@ -234,6 +278,61 @@ func TestWayZOrder(t *testing.T) {
 	}
 }
 
+func TestRankedZOrder(t *testing.T) {
+	zOrder, err := MakeRankedZOrder("z_order",
+		AvailableColumnTypes["z_order"],
+		config.Column{
+			Name: "z_order",
+			Type: "z_order",
+			Args: map[string]interface{}{
+				"default": 1,
+				"ranks": map[interface{}]interface{}{
+					"highway": map[interface{}]interface{}{
+						"motorway":    9,
+						"primary":     6,
+						"residential": 3,
+					},
+					"railway": 7,
+				},
+				"layer_weight": 100,
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tags     osm.Tags
+		expected int
+	}{
+		{osm.Tags{}, 1},
+		{osm.Tags{"highway": "unknown"}, 1},
+		{osm.Tags{"highway": "primary"}, 6},
+		{osm.Tags{"railway": "tram"}, 7},
+		{osm.Tags{"highway": "residential", "railway": "tram"}, 7},
+		{osm.Tags{"highway": "motorway", "railway": "tram"}, 9},
+		{osm.Tags{"highway": "motorway", "bridge": "yes"}, 19},
+		{osm.Tags{"highway": "motorway", "tunnel": "yes"}, -1},
+		{osm.Tags{"highway": "motorway", "layer": "-1"}, -91},
+	}
+	for _, test := range tests {
+		elem := &osm.Element{Tags: test.tags}
+		if v := zOrder("", elem, nil, Match{}); v.(int) != test.expected {
+			t.Errorf("%v %d != %d", test.tags, v, test.expected)
+		}
+	}
+
+	_, err = MakeRankedZOrder("z_order", AvailableColumnTypes["z_order"], config.Column{
+		Name: "z_order",
+		Type: "z_order",
+		Args: map[string]interface{}{"ranks": map[interface{}]interface{}{"highway": "high"}},
+	})
+	if err == nil {
+		t.Error("expected error for invalid weight")
+	}
+}
+
 func TestAreaColumn(t *testing.T) {
 	tests := []struct {
 		wkt      string
@@ -277,6 +376,308 @@ func TestAreaColumn(t *testing.T) {
 	}
 }
 
+func TestGeodesicMeasures(t *testing.T) {
+	near := func(a, b float64) bool { return math.Abs(a-b) < b*1e-6 }
+	wgs, _ := wgsTransformer(4326)
+	merc, _ := wgsTransformer(3857)
+	toMerc := func(xy []float64) []float64 {
+		result := make([]float64, len(xy))
+		for i := 0; i < len(xy); i += 2 {
+			result[i], result[i+1] = proj.WgsToMerc(xy[i], xy[i+1])
+		}
+		return result
+	}
+
+	// one degree along a meridian
+	line := []float64{10, 50, 10, 51}
+	expected := earthRadius * math.Pi / 180
+	if l := geodesicLength(wkb.Geometry{Type: wkb.LineString, XY: line}, wgs); !near(l, expected) {
+		t.Errorf("unexpected length %f != %f", l, expected)
+	}
+	if l := geodesicLength(wkb.Geometry{Type: wkb.LineString, XY: toMerc(line)}, merc); !near(l, expected) {
+		t.Errorf("unexpected webmercator length %f != %f", l, expected)
+	}
+	if l := geodesicLength(wkb.Geometry{Type: wkb.MultiPoint, XY: line}, wgs); l != 0 {
+		t.Errorf("unexpected length of points %f", l)
+	}
+
+	// one square degree at 60°N with a hole of a quarter
+	rings := []float64{
+		0, 60, 1, 60, 1, 61, 0, 61, 0, 60,
+		0, 60, 0.5, 60, 0.5, 60.5, 0, 60.5, 0, 60,
+	}
+	square := func(lat0, lat1, dLong float64) float64 {
+		return earthRadius * earthRadius * dLong * math.Pi / 180 *
+			(math.Sin(lat1*math.Pi/180) - math.Sin(lat0*math.Pi/180))
+	}
+	expected = square(60, 61, 1) - square(60, 60.5, 0.5)
+	polygon := wkb.Geometry{Type: wkb.Polygon, XY: rings, Ends: []uint32{5, 10}}
+	if a := geodesicArea(polygon, wgs); !near(a, expected) {
+		t.Errorf("unexpected area %f != %f", a, expected)
+	}
+	polygon.XY = toMerc(rings)
+	multi := wkb.Geometry{Type: wkb.MultiPolygon, Parts: []wkb.Geometry{polygon, polygon}}
+	if a := geodesicArea(multi, merc); !near(a, 2*expected) {
+		t.Errorf("unexpected webmercator area %f != %f", a, 2*expected)
+	}
+}
+
+func TestDecodeUnitArg(t *testing.T) {
+	for _, test := range []struct {
+		unit     interface{}
+		expected float64
+		err      bool
+	}{
+		{nil, 0, false},
+		{"webmercator", 0, false},
+		{"meters", 1, false},
+		{"kilometers", 1e-3, false},
+		{"miles", 0, true},
+		{42, 0, true},
+	} {
+		column := config.Column{Name: "length", Type: "length", Args: map[string]interface{}{}}
+		if test.unit != nil {
+			column.Args["unit"] = test.unit
+		}
+		factor, err := decodeUnitArg(column)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected error for %v", test.unit)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if factor != test.expected {
+			t.Errorf("%v: %f != %f", test.unit, factor, test.expected)
+		}
+	}
+}
+
+func TestMakeAddressPart(t *testing.T) {
+	street, err := MakeAddressPart("street", AvailableColumnTypes["address_part"], config.Column{
+		Name: "street",
+		Type: "address_part",
+		Key:  "addr:street",
+		Keys: []config.Key{"addr:place"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		tags     osm.Tags
+		expected interface{}
+	}{
+		{osm.Tags{}, nil},
+		{osm.Tags{"addr:street": "Main St"}, "Main St"},
+		{osm.Tags{"addr:place": "Hamlet"}, "Hamlet"},
+		{osm.Tags{"addr:street": "Main St", "addr:place": "Hamlet"}, "Main St"},
+	} {
+		elem := &osm.Element{Tags: test.tags}
+		if v := street(test.tags["addr:street"], elem, &geom.Geometry{}, Match{}); v != test.expected {
+			t.Errorf("%v: %v != %v", test.tags, v, test.expected)
+		}
+	}
+}
+
+func TestEnumerateMap(t *testing.T) {
+	enumerate, err := MakeEnumerateMap("enum", AvailableColumnTypes["enumerate_map"], config.Column{
+		Name: "enum",
+		Type: "enumerate_map",
+		Key:  "highway",
+		Args: map[string]interface{}{
+			"values": map[interface{}]interface{}{
+				"motorway":    10,
+				"primary":     8,
+				"residential": 2.0,
+			},
+			"default": -1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		val      string
+		expected int
+	}{
+		{"motorway", 10},
+		{"primary", 8},
+		{"residential", 2},
+		{"path", -1},
+		{"", -1},
+	} {
+		if v := enumerate(test.val, &osm.Element{}, nil, Match{}); v != test.expected {
+			t.Errorf("%s: %v != %d", test.val, v, test.expected)
+		}
+	}
+
+	_, err = MakeEnumerateMap("enum", AvailableColumnTypes["enumerate_map"], config.Column{
+		Name: "enum",
+		Type: "enumerate_map",
+		Args: map[string]interface{}{"values": []interface{}{"motorway"}},
+	})
+	if err == nil {
+		t.Error("expected error for values list")
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	stats.InvalidValues.Counts() // reset
+	for _, test := range []struct {
+		val      string
+		expected interface{}
+	}{
+		{"", nil},
+		{"2019-05-23", "2019-05-23"},
+		{" 2019-05-23 ", "2019-05-23"},
+		{"2019-05", "2019-05-01"},
+		{"1887", "1887-01-01"},
+		{"2019-05-23T10:00:00Z", "2019-05-23"},
+		{"~1850", nil},
+		{"2019-13-01", nil},
+		{"yes", nil},
+	} {
+		if v := Timestamp(test.val, &osm.Element{}, nil, Match{}); v != test.expected {
+			t.Errorf("%q: %v != %v", test.val, v, test.expected)
+		}
+	}
+	if n := stats.InvalidValues.Counts()["timestamp"]; n != 3 {
+		t.Errorf("expected 3 invalid values, got %d", n)
+	}
+}
+
+func TestUnitColumns(t *testing.T) {
+	stats.InvalidValues.Counts() // reset
+	for _, test := range []struct {
+		typ      string
+		unit     string
+		val      string
+		expected interface{}
+	}{
+		{"speed", "", "", nil},
+		{"speed", "", "50", float32(50)},
+		{"speed", "", "30 mph", float32(48.28032)},
+		{"speed", "", "30mph", float32(48.28032)},
+		{"speed", "", "100 km/h", float32(100)},
+		{"speed", "mph", "30 mph", float32(30)},
+		{"speed", "", "10 knots", float32(18.52)},
+		{"speed", "", "signals", nil},
+		{"speed", "", "50;70", nil},
+		{"distance", "", "3.5", float32(3.5)},
+		{"distance", "", "3,5 m", float32(3.5)},
+		{"distance", "", "12 ft", float32(3.6576)},
+		{"distance", "", "6'7\"", float32(2.0066)},
+		{"distance", "", "6'", float32(1.8288)},
+		{"distance", "cm", "1.2km", float32(120000)},
+		{"weight", "", "7.5", float32(7.5)},
+		{"weight", "", "7.5 t", float32(7.5)},
+		{"weight", "", "3500 kg", float32(3.5)},
+		{"weight", "kg", "2000 lbs", float32(907.18475)},
+		{"weight", "", "heavy", nil},
+	} {
+		column := config.Column{Name: "col", Type: test.typ, Args: map[string]interface{}{}}
+		if test.unit != "" {
+			column.Args["unit"] = test.unit
+		}
+		makeValue, err := AvailableColumnTypes[test.typ].MakeFunc("col", ColumnType{}, column)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := makeValue(test.val, &osm.Element{}, nil, Match{})
+		if f, ok := v.(float32); ok && test.expected != nil {
+			if d := f - test.expected.(float32); d > 1e-3 || d < -1e-3 {
+				t.Errorf("%s %q: %v != %v", test.typ, test.val, v, test.expected)
+			}
+		} else if v != test.expected {
+			t.Errorf("%s %q: %v != %v", test.typ, test.val, v, test.expected)
+		}
+	}
+	counts := stats.InvalidValues.Counts()
+	if counts["speed"] != 2 || counts["weight"] != 1 {
+		t.Errorf("unexpected invalid values %v", counts)
+	}
+
+	_, err := MakeSpeed("col", ColumnType{}, config.Column{Type: "speed", Args: map[string]interface{}{"unit": "furlongs"}})
+	if err == nil {
+		t.Error("expected error for unknown unit")
+	}
+}
+
+func TestMakeStringArray(t *testing.T) {
+	for _, test := range []struct {
+		args     map[string]interface{}
+		val      string
+		expected interface{}
+	}{
+		{nil, "", nil},
+		{nil, "pizza", `{"pizza"}`},
+		{nil, "pizza;kebab", `{"pizza","kebab"}`},
+		{nil, "pizza; kebab ;", `{"pizza","kebab"}`},
+		{nil, " ; ", nil},
+		{nil, `say "hi"\`, `{"say \"hi\"\\"}`},
+		{map[string]interface{}{"separator": ","}, "a,b;c", `{"a","b;c"}`},
+		{map[string]interface{}{"trim": false}, "a; b", `{"a"," b"}`},
+	} {
+		column := config.Column{Name: "cuisine", Type: "string_array", Args: test.args}
+		stringArray, err := MakeStringArray("cuisine", ColumnType{}, column)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := stringArray(test.val, nil, nil, Match{}); v != test.expected {
+			t.Errorf("%q: %v != %v", test.val, v, test.expected)
+		}
+	}
+
+	column := config.Column{Name: "cuisine", Type: "string_array", Args: map[string]interface{}{"trim": "yes"}}
+	if _, err := MakeStringArray("cuisine", ColumnType{}, column); err == nil {
+		t.Error("expected error for invalid trim arg")
+	}
+}
+
+func TestMetadataColumns(t *testing.T) {
+	elem := &osm.Element{}
+	for _, f := range []func(string, *osm.Element, *geom.Geometry, Match) interface{}{
+		OSMVersion, OSMTimestamp, OSMChangeset, OSMUID, OSMUser,
+	} {
+		if v := f("", elem, nil, Match{}); v != nil {
+			t.Errorf("expected nil without metadata, got %v", v)
+		}
+	}
+
+	elem.Metadata = &osm.Metadata{
+		Version:   3,
+		Timestamp: time.Date(2019, 5, 23, 10, 0, 0, 0, time.UTC),
+		Changeset: 70123456,
+		UserID:    42,
+		UserName:  "mapper",
+	}
+	if v := OSMVersion("", elem, nil, Match{}); v != int32(3) {
+		t.Error(v)
+	}
+	if v := OSMTimestamp("", elem, nil, Match{}); v != "2019-05-23T10:00:00Z" {
+		t.Error(v)
+	}
+	if v := OSMChangeset("", elem, nil, Match{}); v != int64(70123456) {
+		t.Error(v)
+	}
+	if v := OSMUID("", elem, nil, Match{}); v != int32(42) {
+		t.Error(v)
+	}
+	if v := OSMUser("", elem, nil, Match{}); v != "mapper" {
+		t.Error(v)
+	}
+
+	m, err := New([]byte("tables:\n  roads:\n    type: linestring\n    columns:\n      - {name: version, type: osm_version}\n    mapping:\n      highway: [__any__]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.UsesMetadata() {
+		t.Error("expected mapping with metadata")
+	}
+}
+
 func TestMakeSuffixReplace(t *testing.T) {
 	column := config.Column{
 		Name: "name", Key: "name", Type: "string_suffixreplace",
@@ -318,6 +719,16 @@ func TestHstoreString(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	column = config.Column{
+		Name: "tags",
+		Type: "hstore_tags",
+		Args: map[string]interface{}{"max_keys": 2},
+	}
+	hstoreMax, err := MakeHStoreString("tags", ColumnType{}, column)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	for _, test := range []struct {
 		column   MakeValue
 		tags     osm.Tags
@@ -331,6 +742,7 @@ func TestHstoreString(t *testing.T) {
 		{hstoreInclude, osm.Tags{"key": "value"}, ``},
 		{hstoreInclude, osm.Tags{"key1": "value"}, `"key1"=>"value"`},
 		{hstoreInclude, osm.Tags{"key": "value", "key2": "value"}, `"key2"=>"value"`},
+		{hstoreMax, osm.Tags{"c": "3", "a": "1", "b": "2"}, `"a"=>"1", "b"=>"2"`},
 	} {
 		actual := test.column("", &osm.Element{Tags: test.tags}, nil, Match{})
 		if actual.(string) != test.expected {
@@ -344,4 +756,207 @@ func TestHstoreString(t *testing.T) {
 		t.Error("unexpected value", actual)
 	}
 
+	column.Args["max_keys"] = 0
+	if _, err := MakeHStoreString("tags", ColumnType{}, column); err == nil {
+		t.Error("expected error for max_keys 0")
+	}
+}
+
+func TestMakeSimplifiedGeometry(t *testing.T) {
+	for _, test := range []struct {
+		args map[string]interface{}
+		err  bool
+	}{
+		{map[string]interface{}{"tolerance": 10}, false},
+		{map[string]interface{}{"tolerance": 2.5}, false},
+		{map[string]interface{}{"tolerance": "10"}, true},
+		{map[string]interface{}{}, true},
+	} {
+		_, err := MakeSimplifiedGeometry("geometry_simple", AvailableColumnTypes["simplified_geometry"], config.Column{
+			Name: "geometry_simple",
+			Type: "simplified_geometry",
+			Args: test.args,
+		})
+		if test.err && err == nil {
+			t.Errorf("expected error for %v", test.args)
+		} else if !test.err && err != nil {
+			t.Errorf("unexpected error for %v: %s", test.args, err)
+		}
+	}
+}
+
+func TestMakeLocalizedName(t *testing.T) {
+	column := config.Column{
+		Name: "name_localized", Type: "localized_name", Keys: []config.Key{"int_name"},
+		Args: map[string]interface{}{"languages": []interface{}{"de", "en"}, "transliterate": "latin"}}
+	localized, err := MakeLocalizedName("name_localized", ColumnType{}, column)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		tags     osm.Tags
+		expected interface{}
+	}{
+		{osm.Tags{"name": "Москва", "name:en": "Moscow", "name:de": "Moskau"}, "Moskau"},
+		{osm.Tags{"name": "Москва", "name:en": "Moscow", "name:de": ""}, "Moscow"},
+		{osm.Tags{"name": "Москва", "int_name": "Moskva"}, "Moskva"},
+		{osm.Tags{"name": "Москва"}, "Moskva"},
+		{osm.Tags{"name": "Αθήνα"}, "Athina"},
+		{osm.Tags{"name": "Zürich"}, "Zürich"},
+		{osm.Tags{"ref": "A1"}, nil},
+	} {
+		elem := &osm.Element{Tags: tc.tags}
+		if result := localized("", elem, nil, Match{}); result != tc.expected {
+			t.Errorf("unexpected name %v for %v, expected %v", result, tc.tags, tc.expected)
+		}
+	}
+
+	column.Args["transliterate"] = "unknown"
+	if _, err := MakeLocalizedName("name_localized", ColumnType{}, column); err == nil {
+		t.Error("expected error for unknown transliterator")
+	}
+	delete(column.Args, "transliterate")
+	delete(column.Args, "languages")
+	if _, err := MakeLocalizedName("name_localized", ColumnType{}, column); err == nil {
+		t.Error("expected error for missing languages")
+	}
+}
+
+func TestLocalizedNameTags(t *testing.T) {
+	places := NewTable("places", PointTable).
+		AddMapping("place", "city").
+		AddColumn(config.Column{Name: "name", Type: "localized_name",
+			Args: map[string]interface{}{"languages": []interface{}{"fr"}}})
+	m := &Mapping{}
+	if err := m.AddTable(places); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tags := osm.Tags{"place": "city", "name": "Wien", "name:fr": "Vienne", "name:it": "Vienna"}
+	m.NodeTagFilter().Filter(&tags)
+	if _, ok := tags["name:fr"]; !ok {
+		t.Error("name:fr removed by tag filter")
+	}
+	if _, ok := tags["name"]; !ok {
+		t.Error("name removed by tag filter")
+	}
+	if _, ok := tags["name:it"]; ok {
+		t.Error("name:it not removed by tag filter")
+	}
+}
+
+func TestTransliterateLatin(t *testing.T) {
+	for _, tc := range []struct {
+		name, expected string
+	}{
+		{"Щёлково", "Shchyolkovo"},
+		{"ЦСКА", "TSSKA"},
+		{"Львів", "Lviv"},
+		{"Θεσσαλονίκη", "Thessaloniki"},
+		{"Berlin 東京", "Berlin 東京"},
+	} {
+		if result := TransliterateLatin(tc.name); result != tc.expected {
+			t.Errorf("unexpected transliteration %q for %q, expected %q", result, tc.name, tc.expected)
+		}
+	}
+}
+
+func TestMemberNodeColumns(t *testing.T) {
+	column := config.Column{Name: "label_point", Type: "member_node_point",
+		Args: map[string]interface{}{"roles": []interface{}{"label", "admin_centre"}}}
+	point, err := MakeMemberNodePoint("label_point", ColumnType{}, column)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := MakeMemberNodeID("label_id", ColumnType{}, config.Column{
+		Args: map[string]interface{}{"role": "admin_centre"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &geom.Geometry{MemberNodes: []geom.MemberNode{
+		{ID: 1, Role: "admin_centre", Wkb: []byte("0101")},
+		{ID: 2, Role: "label", Wkb: []byte("0102")},
+	}}
+	if v := point("", nil, g, Match{}); v != "0102" {
+		t.Errorf("unexpected point %v", v)
+	}
+	if v := id("", nil, g, Match{}); v != int64(1) {
+		t.Errorf("unexpected id %v", v)
+	}
+	g.MemberNodes = g.MemberNodes[:1]
+	if v := point("", nil, g, Match{}); v != "0101" {
+		t.Errorf("unexpected point %v", v)
+	}
+	if v := point("", nil, &geom.Geometry{}, Match{}); v != nil {
+		t.Errorf("unexpected point %v", v)
+	}
+
+	if _, err := MakeMemberNodeID("label_id", ColumnType{}, config.Column{}); err == nil {
+		t.Error("expected error for missing role")
+	}
+}
+
+func TestOrientedGeometry(t *testing.T) {
+	g := geos.NewGeos()
+	defer g.Finish()
+	// clockwise exterior ring
+	geometry, err := geom.AsGeomElement(g, g.FromWkt("POLYGON((0 0, 0 10, 10 10, 10 0, 0 0))"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elem := &osm.Element{}
+	ccw := orientedGeometry(true, Geometry, "wkb")("", elem, &geometry, Match{}).(string)
+	if ccw == string(geometry.Wkb) {
+		t.Fatal("expected reversed ring")
+	}
+	if o, err := wkb.ParseHex(ccw); err != nil || o.XY[2] != 10 || o.XY[3] != 0 {
+		t.Errorf("unexpected geometry %v %v", o, err)
+	}
+	if cw := orientedGeometry(false, Geometry, "wkb")("", elem, &geometry, Match{}); cw != string(geometry.Wkb) {
+		t.Errorf("expected unchanged geometry %v", cw)
+	}
+}
+
+func TestSimplifiedGeometryOption(t *testing.T) {
+	g := geos.NewGeos()
+	defer g.Finish()
+	geometry, err := geom.AsGeomElement(g, g.FromWkt("LINESTRING(0 0, 5 0.1, 10 0, 20 0)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, preserveTopology := range []bool{false, true} {
+		f, _ := simplifiedGeometry(1, preserveTopology)
+		v, ok := f("", &osm.Element{}, &geometry, Match{}).(string)
+		if !ok {
+			t.Fatalf("unexpected value %v", v)
+		}
+		if s, err := wkb.ParseHex(v); err != nil || len(s.XY) != 4 {
+			t.Errorf("unexpected simplified geometry %v %v", s, err)
+		}
+	}
+}
+
+func TestGeometryCentroid(t *testing.T) {
+	g := geos.NewGeos()
+	defer g.Finish()
+	g.SetHandleSrid(3857)
+	geometry, err := geom.AsGeomElement(g, g.FromWkt("POLYGON((0 0, 10 0, 10 10, 0 10, 0 0))"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, ok := GeometryCentroid("", &osm.Element{}, &geometry, Match{}).(string)
+	if !ok {
+		t.Fatalf("unexpected value %v", v)
+	}
+	if c, err := wkb.ParseHex(v); err != nil || c.XY[0] != 5 || c.XY[1] != 5 {
+		t.Errorf("unexpected centroid %v %v", c, err)
+	}
+	if p := GeometryPointOnSurface("", &osm.Element{}, &geometry, Match{}); p == nil {
+		t.Error("expected point on surface")
+	}
 }
@@ -0,0 +1,44 @@
+package mapping
+
+import (
+	"strings"
+	"time"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/stats"
+)
+
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01",
+	"2006",
+	time.RFC3339,
+}
+
+// parseDate parses full and partial dates (YYYY, YYYY-MM) as found in
+// start_date or check_date tags. Partial dates are returned as the
+// first day of the year or month.
+func parseDate(val string) (time.Time, bool) {
+	val = strings.TrimSpace(val)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Timestamp returns the tag value as date (YYYY-MM-DD) or nil if the value
+// is not a valid date. Invalid values are counted in stats.InvalidValues.
+func Timestamp(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+	if val == "" {
+		return nil
+	}
+	t, ok := parseDate(val)
+	if !ok {
+		stats.InvalidValues.Add("timestamp")
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,126 @@
+package mapping
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/omniscale/imposm3/stats"
+	"github.com/pkg/errors"
+)
+
+// unitTable maps unit suffixes to the factor to convert into the base unit
+// of the table (km/h, meters or tonnes).
+type unitTable map[string]float64
+
+var speedUnits = unitTable{
+	"km/h":  1,
+	"kmh":   1,
+	"kph":   1,
+	"mph":   1.609344,
+	"knots": 1.852,
+	"kn":    1.852,
+}
+
+var distanceUnits = unitTable{
+	"m":  1,
+	"km": 1000,
+	"cm": 0.01,
+	"mi": 1609.344,
+	"ft": 0.3048,
+	"'":  0.3048,
+	"in": 0.0254,
+}
+
+var weightUnits = unitTable{
+	"t":   1,
+	"kg":  0.001,
+	"lbs": 0.00045359237,
+	"lb":  0.00045359237,
+}
+
+var (
+	unitValueRe  = regexp.MustCompile(`^(-?[0-9]+(?:[.,][0-9]+)?)\s*(.*)$`)
+	feetInchesRe = regexp.MustCompile(`^([0-9]+)'\s*(?:([0-9]+(?:\.[0-9]+)?)")?$`)
+)
+
+// parseUnitValue parses values like 50, 30 mph or 2.5t and returns the
+// value in the base unit of units. Values without unit are in the base unit.
+func parseUnitValue(val string, units unitTable) (float64, bool) {
+	val = strings.TrimSpace(val)
+	if m := feetInchesRe.FindStringSubmatch(val); m != nil && units["ft"] != 0 {
+		// 6'7" as found in maxheight
+		feet, _ := strconv.ParseFloat(m[1], 64)
+		inches := 0.0
+		if m[2] != "" {
+			inches, _ = strconv.ParseFloat(m[2], 64)
+		}
+		return feet*units["ft"] + inches*units["in"], true
+	}
+	m := unitValueRe.FindStringSubmatch(val)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+	if err != nil {
+		return 0, false
+	}
+	unit := strings.ToLower(m[2])
+	if unit == "" {
+		return v, true
+	}
+	factor, ok := units[unit]
+	if !ok {
+		return 0, false
+	}
+	return v * factor, true
+}
+
+func makeUnitColumn(column config.Column, units unitTable, defaultUnit string) (MakeValue, error) {
+	unit := defaultUnit
+	if u, ok := column.Args["unit"]; ok {
+		unit, ok = u.(string)
+		if !ok {
+			return nil, errors.Errorf("unit for %s column %s not a string", column.Type, column.Name)
+		}
+	}
+	factor, ok := units[unit]
+	if !ok {
+		return nil, errors.Errorf("unknown unit %s for %s column %s", unit, column.Type, column.Name)
+	}
+	columnType := column.Type
+	unitValue := func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+		if val == "" {
+			return nil
+		}
+		v, ok := parseUnitValue(val, units)
+		if !ok {
+			stats.InvalidValues.Add(columnType)
+			return nil
+		}
+		return float32(v / factor)
+	}
+	return unitValue, nil
+}
+
+// MakeSpeed converts speeds (e.g. maxspeed) into the configured unit
+// (km/h, mph or knots). Values without unit are in km/h.
+func MakeSpeed(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	return makeUnitColumn(column, speedUnits, "km/h")
+}
+
+// MakeDistance converts distances (e.g. height, width or maxheight) into
+// the configured unit (m, km, cm, mi, ft or in). Values without unit are in
+// meters.
+func MakeDistance(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	return makeUnitColumn(column, distanceUnits, "m")
+}
+
+// MakeWeight converts weights (e.g. maxweight) into the configured unit
+// (t, kg or lbs). Values without unit are in tonnes.
+func MakeWeight(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	return makeUnitColumn(column, weightUnits, "t")
+}
@@ -0,0 +1,127 @@
+package mapping
+
+import (
+	"strconv"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
+)
+
+// MakeRankedZOrder returns a z_order column. The z-order is the highest
+// weight of all tags listed in the ranks arg. ranks maps a key to a weight
+// for all values, or to a dictionary with value weights.
+// layer, bridge and tunnel tags modify the value by layer_weight,
+// bridge_weight and tunnel_weight.
+func MakeRankedZOrder(columnName string, columnType ColumnType, column config.Column) (MakeValue, error) {
+	_ranks, ok := column.Args["ranks"]
+	if !ok {
+		return nil, errors.New("missing ranks in args for z_order")
+	}
+	ranks, ok := _ranks.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("ranks in args for z_order not a dictionary")
+	}
+
+	keyWeights := make(map[string]int)
+	valueWeights := make(map[string]map[string]int)
+	for k, v := range ranks {
+		key, ok := k.(string)
+		if !ok {
+			return nil, errors.Errorf("key %v in ranks for z_order not a string", k)
+		}
+		if values, ok := v.(map[interface{}]interface{}); ok {
+			valueWeights[key] = make(map[string]int)
+			for value, weight := range values {
+				valueName, ok := value.(string)
+				if !ok {
+					return nil, errors.Errorf("value %v of %s in ranks for z_order not a string", value, key)
+				}
+				w, ok := asInt(weight)
+				if !ok {
+					return nil, errors.Errorf("weight for %s=%s in ranks for z_order not a number", key, valueName)
+				}
+				valueWeights[key][valueName] = w
+			}
+		} else if w, ok := asInt(v); ok {
+			keyWeights[key] = w
+		} else {
+			return nil, errors.Errorf("weight for %s in ranks for z_order not a number or dictionary", key)
+		}
+	}
+
+	intArg := func(name string, defaultValue int) (int, error) {
+		v, ok := column.Args[name]
+		if !ok {
+			return defaultValue, nil
+		}
+		i, ok := asInt(v)
+		if !ok {
+			return 0, errors.Errorf("%s in args for z_order not a number", name)
+		}
+		return i, nil
+	}
+	defaultRank, err := intArg("default", 0)
+	if err != nil {
+		return nil, err
+	}
+	layerWeight, err := intArg("layer_weight", 10)
+	if err != nil {
+		return nil, err
+	}
+	bridgeWeight, err := intArg("bridge_weight", 10)
+	if err != nil {
+		return nil, err
+	}
+	tunnelWeight, err := intArg("tunnel_weight", -10)
+	if err != nil {
+		return nil, err
+	}
+
+	zOrder := func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+		rank := 0
+		found := false
+		for k, v := range elem.Tags {
+			w, ok := keyWeights[k]
+			if !ok {
+				w, ok = valueWeights[k][v]
+			}
+			if ok && (!found || w > rank) {
+				rank = w
+				found = true
+			}
+		}
+		if !found {
+			rank = defaultRank
+		}
+
+		z := rank
+		layer, _ := strconv.ParseInt(elem.Tags["layer"], 10, 64)
+		z += int(layer) * layerWeight
+
+		tunnel := elem.Tags["tunnel"]
+		if tunnel == "true" || tunnel == "yes" || tunnel == "1" {
+			z += tunnelWeight
+		}
+		bridge := elem.Tags["bridge"]
+		if bridge == "true" || bridge == "yes" || bridge == "1" {
+			z += bridgeWeight
+		}
+		return z
+	}
+	return zOrder, nil
+}
+
+// asInt converts YAML/JSON numbers to int.
+func asInt(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
@@ -8,21 +8,49 @@ import (
 
 type Mapping struct {
 	Tables            Tables            `yaml:"tables"`
+	TableTemplates    TableTemplates    `yaml:"table_templates"`
 	GeneralizedTables GeneralizedTables `yaml:"generalized_tables"`
 	Tags              Tags              `yaml:"tags"`
 	Areas             Areas             `yaml:"areas"`
 	// SingleIDSpace mangles the overlapping node/way/relation IDs
 	// to be unique (nodes positive, ways negative, relations negative -1e17)
 	SingleIDSpace bool `yaml:"use_single_id_space"`
+	// NormalizeValues lowercases and trims tag values before they are
+	// matched against the mapping and filter values.
+	NormalizeValues bool `yaml:"normalize_values"`
+	// OldStyleMultipolygons imports multipolygon relations without
+	// matching tags with the common tags of their outer ways.
+	OldStyleMultipolygons bool `yaml:"old_style_multipolygons"`
+	// DeployGroups are rotated in order, each in its own transaction.
+	DeployGroups []DeployGroup `yaml:"deploy_groups"`
+	// SkipElements are never imported, ForceElements are imported
+	// regardless of the tag filters if they match any mapping.
+	SkipElements  ElementIDs `yaml:"skip_elements"`
+	ForceElements ElementIDs `yaml:"force_elements"`
+}
+
+type ElementIDs struct {
+	Nodes     []int64 `yaml:"nodes"`
+	Ways      []int64 `yaml:"ways"`
+	Relations []int64 `yaml:"relations"`
+}
+
+type DeployGroup struct {
+	Name   string   `yaml:"name"`
+	Tables []string `yaml:"tables"`
 }
 
 type Column struct {
-	Name       string                 `yaml:"name"`
-	Key        Key                    `yaml:"key"`
-	Keys       []Key                  `yaml:"keys"`
-	Type       string                 `yaml:"type"`
-	Args       map[string]interface{} `yaml:"args"`
-	FromMember bool                   `yaml:"from_member"`
+	Name        string                 `yaml:"name"`
+	Key         Key                    `yaml:"key"`
+	Keys        []Key                  `yaml:"keys"`
+	Type        string                 `yaml:"type"`
+	Args        map[string]interface{} `yaml:"args"`
+	FromMember  bool                   `yaml:"from_member"`
+	Storage     string                 `yaml:"storage"`
+	Compression string                 `yaml:"compression"`
+	// Description is added as comment to the column.
+	Description string `yaml:"description"`
 }
 
 type Tables map[string]*Table
@@ -36,6 +64,123 @@ type Table struct {
 	OldFields     []*Column             `yaml:"fields"`
 	Filters       *Filters              `yaml:"filters"`
 	RelationTypes []string              `yaml:"relation_types"`
+	MemberRoles   []string              `yaml:"member_roles"`
+	// MemberTypes (node, way, relation) and MemberRolesRegexp restrict the
+	// members of relation_member tables.
+	MemberTypes       []string `yaml:"member_types"`
+	MemberRolesRegexp string   `yaml:"member_roles_regexp"`
+	// IncludeUntagged inserts all nodes without (mapped) tags into point
+	// tables.
+	IncludeUntagged bool `yaml:"include_untagged"`
+	// Extends is the name of the table template of this table.
+	Extends string `yaml:"extends"`
+	// AlsoInto inserts the matches of this table into other tables as
+	// well.
+	AlsoInto []AlsoInto `yaml:"also_into"`
+	// Shard partitions the table by the region of each row.
+	Shard *Shard `yaml:"shard"`
+	// Partition partitions the table by hash, by a list of values or by
+	// geohash.
+	Partition *Partition `yaml:"partition"`
+	// Tiles renders the table into the vector tiles of the mbtiles output.
+	Tiles *Tiles `yaml:"tiles"`
+	// Description is added as comment to the table.
+	Description string `yaml:"description"`
+	// Tablespace and Fillfactor are PostgreSQL storage options of the
+	// table. Unlogged tables are converted to logged tables by
+	// -deployproduction.
+	Tablespace string `yaml:"tablespace"`
+	Fillfactor int    `yaml:"fillfactor"`
+	Unlogged   bool   `yaml:"unlogged"`
+	// GeometryValidation defines how invalid polygons are handled: repair
+	// (default), drop or keep.
+	GeometryValidation string `yaml:"geometry_validation"`
+	// Orientation forces the ring orientation of polygons: counterclockwise
+	// (exterior rings counterclockwise, RFC 7946) or clockwise.
+	Orientation string `yaml:"orientation"`
+	// SimplifyTolerance simplifies the geometries of the table with the
+	// Douglas-Peucker algorithm, or with a topology preserving algorithm if
+	// SimplifyPreserveTopology is set.
+	SimplifyTolerance        float64 `yaml:"simplify_tolerance"`
+	SimplifyPreserveTopology bool    `yaml:"simplify_preserve_topology"`
+	// Boundary builds the polygons of boundary relations. RelationTypes
+	// defaults to boundary and member ways that are included multiple times
+	// are only used once.
+	Boundary bool `yaml:"boundary"`
+	// RouteGeometry merges the member ways of relations in relation tables
+	// to a MultiLineString geometry.
+	RouteGeometry *RouteGeometry `yaml:"route_geometry"`
+	// Srid overrides the -srid of the import for the geometries of this
+	// table.
+	Srid int `yaml:"srid"`
+	// Indexes are created in addition to the geometry and id indexes.
+	Indexes []Index `yaml:"indexes"`
+}
+
+// Index is an additional index of a table. Method is btree (default), gist,
+// gin, brin, hash or spgist. Where creates a partial index. Name defaults
+// to the table name with the columns and the method.
+type Index struct {
+	Name    string   `yaml:"name"`
+	Columns []string `yaml:"columns"`
+	Method  string   `yaml:"method"`
+	Where   string   `yaml:"where"`
+}
+
+// Shard defines the regions of a sharded table. The region of a row is the
+// Property of the first GeoJSON feature that intersects the geometry. It is
+// stored in Column (region by default).
+type Shard struct {
+	GeoJSON  string `yaml:"geojson"`
+	Property string `yaml:"property"`
+	Column   string `yaml:"column"`
+}
+
+// Partition defines the declarative partitioning of a table. By is hash,
+// list or geohash. Hash partitioning creates Partitions partitions by the
+// hash of Column (the id column by default). List partitioning creates a
+// partition for each of the Values of Column and a default partition.
+// Geohash partitioning stores the geohash of the geometry with Precision
+// characters in Column (geohash by default) and creates a partition for
+// each geohash.
+type Partition struct {
+	By         string   `yaml:"by"`
+	Column     string   `yaml:"column"`
+	Partitions int      `yaml:"partitions"`
+	Values     []string `yaml:"values"`
+	Precision  int      `yaml:"precision"`
+}
+
+// RouteGeometry defines the members of the route geometry. Roles are the
+// roles of the included way members, all roles except the stop and
+// platform roles by default. Line ends that are closer than GapTolerance
+// are connected.
+type RouteGeometry struct {
+	Roles        []string `yaml:"roles"`
+	GapTolerance float64  `yaml:"gap_tolerance"`
+}
+
+// Tiles defines the zoom levels and the vector tile layer of a table. The
+// layer defaults to the name of the table.
+type Tiles struct {
+	MinZoom int    `yaml:"minzoom"`
+	MaxZoom int    `yaml:"maxzoom"`
+	Layer   string `yaml:"layer"`
+}
+
+type AlsoInto struct {
+	Table   string   `yaml:"table"`
+	Filters *Filters `yaml:"filters"`
+}
+
+// TableTemplates define the type, columns and filters that tables can
+// inherit with extends.
+type TableTemplates map[string]*TableTemplate
+type TableTemplate struct {
+	Extends string    `yaml:"extends"`
+	Type    string    `yaml:"type"`
+	Columns []*Column `yaml:"columns"`
+	Filters *Filters  `yaml:"filters"`
 }
 
 type GeneralizedTables map[string]*GeneralizedTable
@@ -44,6 +189,19 @@ type GeneralizedTable struct {
 	SourceTableName string  `yaml:"source"`
 	Tolerance       float64 `yaml:"tolerance"`
 	SQLFilter       string  `yaml:"sql_filter"`
+	// Columns are additional columns, computed with SQL expressions
+	// over the source table.
+	Columns []GeneralizedColumn `yaml:"columns"`
+	// Merge dissolves touching polygons with the same GroupBy values.
+	Merge   bool     `yaml:"merge"`
+	GroupBy []string `yaml:"group_by"`
+	// Description is added as comment to the table.
+	Description string `yaml:"description"`
+}
+
+type GeneralizedColumn struct {
+	Name string `yaml:"name"`
+	SQL  string `yaml:"sql"`
 }
 
 type Filters struct {
@@ -52,6 +210,28 @@ type Filters struct {
 	Require       KeyValues      `yaml:"require"`
 	RejectRegexp  KeyRegexpValue `yaml:"reject_regexp"`
 	RequireRegexp KeyRegexpValue `yaml:"require_regexp"`
+	// RequireGte, RequireGt, RequireLte and RequireLt compare numeric tag
+	// values against a threshold. Elements without the tag or with
+	// non-numeric values do not match.
+	RequireGte KeyNumber `yaml:"require_gte"`
+	RequireGt  KeyNumber `yaml:"require_gt"`
+	RequireLte KeyNumber `yaml:"require_lte"`
+	RequireLt  KeyNumber `yaml:"require_lt"`
+	// RequireAnyKey requires at least one of the keys, RejectAllKeys
+	// rejects elements that have all of the keys.
+	RequireAnyKey []Key `yaml:"require_any_key"`
+	RejectAllKeys []Key `yaml:"reject_all_keys"`
+	// MinArea, MinLength and ClosedOnly filter on the geometry and are
+	// only supported at the top level of the table filters.
+	MinArea    float64 `yaml:"min_area"`
+	MinLength  float64 `yaml:"min_length"`
+	ClosedOnly bool    `yaml:"closed_only"`
+	// All, Any and Not combine nested filters. All requires that all
+	// nested filters match, Any that at least one matches and Not that
+	// the nested filter does not match.
+	All []Filters `yaml:"all"`
+	Any []Filters `yaml:"any"`
+	Not *Filters  `yaml:"not"`
 }
 
 type Areas struct {
@@ -63,6 +243,10 @@ type Tags struct {
 	LoadAll bool  `yaml:"load_all"`
 	Exclude []Key `yaml:"exclude"`
 	Include []Key `yaml:"include"`
+	// MaxTags limits the number of tags of each element. MaxTagsPolicy
+	// is truncate (default), hstore or skip.
+	MaxTags       int    `yaml:"max_tags"`
+	MaxTagsPolicy string `yaml:"max_tags_policy"`
 }
 
 type Key string
@@ -75,6 +259,7 @@ type OrderedValue struct {
 
 type KeyValues map[Key][]OrderedValue
 type KeyRegexpValue map[Key]string
+type KeyNumber map[Key]float64
 
 func (kv *KeyValues) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if *kv == nil {
@@ -109,6 +294,9 @@ func (kv *KeyValues) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 type SubMapping struct {
 	Mapping KeyValues
+	// Filters only apply to matches of this sub-mapping, in addition to
+	// the filters of the table.
+	Filters *Filters
 }
 
 type TypeMappings struct {
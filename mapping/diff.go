@@ -0,0 +1,205 @@
+package mapping
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+// MappingDiff contains the differences between two mappings.
+type MappingDiff struct {
+	AddedTables   []string
+	RemovedTables []string
+	ChangedTables []TableDiff
+
+	AddedGeneralizedTables   []string
+	RemovedGeneralizedTables []string
+	ChangedGeneralizedTables []string
+}
+
+// TableDiff contains the differences of a table that is in both mappings.
+type TableDiff struct {
+	Name string
+	// TypeChanged is true if the table type changed, e.g. from linestring
+	// to polygon. The table needs to be imported again.
+	TypeChanged bool
+	// PartitionsChanged is true if the shard or partition options changed.
+	// The table needs to be imported again.
+	PartitionsChanged bool
+	// MatchingChanged is true if the mapping, the filters or other options
+	// that select the elements of the table changed. Existing rows are not
+	// updated.
+	MatchingChanged bool
+	// SridChanged is true if the SRID of the table changed.
+	SridChanged bool
+	// StorageChanged is true if the tablespace or the fillfactor changed.
+	StorageChanged bool
+	// CommentsChanged is true if the description of the table or of a
+	// column changed.
+	CommentsChanged bool
+	AddedColumns    []*config.Column
+	RemovedColumns  []*config.Column
+	ChangedColumns  []ColumnChange
+	// AddedIndexes and RemovedIndexes contain the changed indexes, in the
+	// old and in the new version.
+	AddedIndexes   []config.Index
+	RemovedIndexes []config.Index
+}
+
+// ColumnChange is a column with a different type, key or args.
+type ColumnChange struct {
+	Old, New *config.Column
+}
+
+// Empty returns whether both mappings are equal.
+func (d *MappingDiff) Empty() bool {
+	return len(d.AddedTables) == 0 && len(d.RemovedTables) == 0 && len(d.ChangedTables) == 0 &&
+		len(d.AddedGeneralizedTables) == 0 && len(d.RemovedGeneralizedTables) == 0 &&
+		len(d.ChangedGeneralizedTables) == 0
+}
+
+// DiffMappings returns the differences between the old and the new mapping.
+// Tables are sorted by name, columns are in the order of the mapping.
+func DiffMappings(old, new *Mapping) MappingDiff {
+	diff := MappingDiff{}
+	for _, name := range sortedTableNames(new.Conf.Tables) {
+		if _, ok := old.Conf.Tables[name]; !ok {
+			diff.AddedTables = append(diff.AddedTables, name)
+		}
+	}
+	for _, name := range sortedTableNames(old.Conf.Tables) {
+		newTable, ok := new.Conf.Tables[name]
+		if !ok {
+			diff.RemovedTables = append(diff.RemovedTables, name)
+			continue
+		}
+		if td, changed := diffTable(old.Conf.Tables[name], newTable); changed {
+			diff.ChangedTables = append(diff.ChangedTables, td)
+		}
+	}
+
+	for _, name := range sortedGeneralizedTableNames(new.Conf.GeneralizedTables) {
+		if _, ok := old.Conf.GeneralizedTables[name]; !ok {
+			diff.AddedGeneralizedTables = append(diff.AddedGeneralizedTables, name)
+		}
+	}
+	for _, name := range sortedGeneralizedTableNames(old.Conf.GeneralizedTables) {
+		newTable, ok := new.Conf.GeneralizedTables[name]
+		if !ok {
+			diff.RemovedGeneralizedTables = append(diff.RemovedGeneralizedTables, name)
+			continue
+		}
+		if !reflect.DeepEqual(old.Conf.GeneralizedTables[name], newTable) {
+			diff.ChangedGeneralizedTables = append(diff.ChangedGeneralizedTables, name)
+		}
+	}
+	return diff
+}
+
+func diffTable(old, new *config.Table) (TableDiff, bool) {
+	td := TableDiff{Name: new.Name}
+	td.TypeChanged = old.Type != new.Type
+	td.PartitionsChanged = !reflect.DeepEqual(old.Shard, new.Shard) || !reflect.DeepEqual(old.Partition, new.Partition)
+	td.MatchingChanged = !reflect.DeepEqual(matchingOptions(old), matchingOptions(new))
+	td.SridChanged = old.Srid != new.Srid
+	td.StorageChanged = old.Tablespace != new.Tablespace || old.Fillfactor != new.Fillfactor
+	td.CommentsChanged = old.Description != new.Description
+
+	oldColumns := make(map[string]*config.Column)
+	for _, c := range old.Columns {
+		oldColumns[c.Name] = c
+	}
+	newColumns := make(map[string]bool)
+	for _, c := range new.Columns {
+		newColumns[c.Name] = true
+		oc, ok := oldColumns[c.Name]
+		if !ok {
+			td.AddedColumns = append(td.AddedColumns, c)
+		} else {
+			if oc.Description != c.Description {
+				td.CommentsChanged = true
+			}
+			if !reflect.DeepEqual(withoutDescription(oc), withoutDescription(c)) {
+				td.ChangedColumns = append(td.ChangedColumns, ColumnChange{Old: oc, New: c})
+			}
+		}
+	}
+	for _, c := range old.Columns {
+		if !newColumns[c.Name] {
+			td.RemovedColumns = append(td.RemovedColumns, c)
+		}
+	}
+
+	oldIndexes := make(map[string]config.Index)
+	for _, idx := range old.Indexes {
+		oldIndexes[idx.Name] = idx
+	}
+	newIndexes := make(map[string]bool)
+	for _, idx := range new.Indexes {
+		newIndexes[idx.Name] = true
+		oi, ok := oldIndexes[idx.Name]
+		if ok && reflect.DeepEqual(oi, idx) {
+			continue
+		}
+		if ok {
+			td.RemovedIndexes = append(td.RemovedIndexes, oi)
+		}
+		td.AddedIndexes = append(td.AddedIndexes, idx)
+	}
+	for _, idx := range old.Indexes {
+		if !newIndexes[idx.Name] {
+			td.RemovedIndexes = append(td.RemovedIndexes, idx)
+		}
+	}
+
+	changed := td.TypeChanged || td.PartitionsChanged || td.MatchingChanged || td.SridChanged || td.StorageChanged ||
+		td.CommentsChanged || len(td.AddedColumns) > 0 || len(td.RemovedColumns) > 0 || len(td.ChangedColumns) > 0 ||
+		len(td.AddedIndexes) > 0 || len(td.RemovedIndexes) > 0
+	return td, changed
+}
+
+// matchingOptions returns a copy of the table without the options that
+// do not affect which elements are imported.
+func matchingOptions(t *config.Table) config.Table {
+	c := *t
+	c.Name = ""
+	c.Type = ""
+	c.Columns = nil
+	c.OldFields = nil
+	c.Extends = ""
+	c.Description = ""
+	c.Shard = nil
+	c.Partition = nil
+	c.Tablespace = ""
+	c.Fillfactor = 0
+	c.Unlogged = false
+	c.Indexes = nil
+	c.Srid = 0
+	return c
+}
+
+// withoutDescription returns a copy of the column without the description.
+func withoutDescription(c *config.Column) config.Column {
+	cc := *c
+	cc.Description = ""
+	return cc
+}
+
+func sortedTableNames(tables config.Tables) []string {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedGeneralizedTableNames(tables config.GeneralizedTables) []string {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
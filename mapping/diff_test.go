@@ -0,0 +1,141 @@
+package mapping
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffMappings(t *testing.T) {
+	old, err := New([]byte(`
+tables:
+  roads:
+    type: linestring
+    mapping:
+      highway: [__any__]
+    columns:
+      - {name: osm_id, type: id}
+      - {name: geometry, type: geometry}
+      - {name: name, key: name, type: string}
+      - {name: layer, key: layer, type: integer}
+    indexes:
+      - {columns: [name]}
+      - {name: roads_layer, columns: [layer]}
+  buildings:
+    type: polygon
+    mapping:
+      building: [__any__]
+    columns:
+      - {name: osm_id, type: id}
+  water:
+    type: polygon
+    mapping:
+      natural: [water]
+    columns:
+      - {name: osm_id, type: id}
+generalized_tables:
+  roads_gen0:
+    source: roads
+    tolerance: 100
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := New([]byte(`
+tables:
+  roads:
+    type: linestring
+    mapping:
+      highway: [__any__]
+      railway: [rail]
+    srid: 4326
+    columns:
+      - {name: osm_id, type: id}
+      - {name: geometry, type: geometry}
+      - {name: ref, key: ref, type: string}
+      - {name: layer, key: layer, type: string}
+    indexes:
+      - {name: roads_layer, columns: [layer], where: layer <> '0'}
+      - {columns: [ref], method: gin}
+  buildings:
+    type: polygon
+    description: All buildings
+    mapping:
+      building: [__any__]
+    partition: {by: hash, partitions: 4}
+    fillfactor: 90
+    unlogged: true
+    columns:
+      - {name: osm_id, type: id, description: OSM ID of the way or relation}
+  water:
+    type: linestring
+    mapping:
+      natural: [water]
+    columns:
+      - {name: osm_id, type: id}
+  places:
+    type: point
+    mapping:
+      place: [__any__]
+    columns:
+      - {name: osm_id, type: id}
+generalized_tables:
+  roads_gen0:
+    source: roads
+    tolerance: 200
+  roads_gen1:
+    source: roads
+    tolerance: 50
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := DiffMappings(old, new)
+	if !reflect.DeepEqual(diff.AddedTables, []string{"places"}) {
+		t.Errorf("unexpected added tables %v", diff.AddedTables)
+	}
+	if len(diff.RemovedTables) != 0 {
+		t.Errorf("unexpected removed tables %v", diff.RemovedTables)
+	}
+	if len(diff.ChangedTables) != 3 {
+		t.Fatalf("unexpected changed tables %v", diff.ChangedTables)
+	}
+	buildings := diff.ChangedTables[0]
+	if buildings.Name != "buildings" || buildings.TypeChanged || buildings.MatchingChanged ||
+		!buildings.PartitionsChanged || buildings.SridChanged || !buildings.StorageChanged || !buildings.CommentsChanged || len(buildings.ChangedColumns) != 0 {
+		t.Errorf("unexpected diff for buildings %+v", buildings)
+	}
+	roads := diff.ChangedTables[1]
+	if roads.Name != "roads" || roads.TypeChanged || roads.PartitionsChanged || !roads.SridChanged || roads.StorageChanged || !roads.MatchingChanged || roads.CommentsChanged {
+		t.Errorf("unexpected diff for roads %+v", roads)
+	}
+	if len(roads.AddedColumns) != 1 || roads.AddedColumns[0].Name != "ref" {
+		t.Errorf("unexpected added columns %v", roads.AddedColumns)
+	}
+	if len(roads.RemovedColumns) != 1 || roads.RemovedColumns[0].Name != "name" {
+		t.Errorf("unexpected removed columns %v", roads.RemovedColumns)
+	}
+	if len(roads.ChangedColumns) != 1 || roads.ChangedColumns[0].New.Type != "string" {
+		t.Errorf("unexpected changed columns %v", roads.ChangedColumns)
+	}
+	if len(roads.AddedIndexes) != 2 || roads.AddedIndexes[0].Where == "" || roads.AddedIndexes[1].Name != "roads_ref_gin" {
+		t.Errorf("unexpected added indexes %v", roads.AddedIndexes)
+	}
+	if len(roads.RemovedIndexes) != 2 || roads.RemovedIndexes[0].Name != "roads_layer" || roads.RemovedIndexes[1].Name != "roads_name_btree" {
+		t.Errorf("unexpected removed indexes %v", roads.RemovedIndexes)
+	}
+	water := diff.ChangedTables[2]
+	if water.Name != "water" || !water.TypeChanged || water.MatchingChanged {
+		t.Errorf("unexpected diff for water %+v", water)
+	}
+	if !reflect.DeepEqual(diff.AddedGeneralizedTables, []string{"roads_gen1"}) {
+		t.Errorf("unexpected added generalized tables %v", diff.AddedGeneralizedTables)
+	}
+	if !reflect.DeepEqual(diff.ChangedGeneralizedTables, []string{"roads_gen0"}) {
+		t.Errorf("unexpected changed generalized tables %v", diff.ChangedGeneralizedTables)
+	}
+
+	if diff := DiffMappings(old, old); !diff.Empty() {
+		t.Errorf("expected empty diff, got %+v", diff)
+	}
+}
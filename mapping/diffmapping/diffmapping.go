@@ -0,0 +1,55 @@
+package diffmapping
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/omniscale/imposm3/database/postgis"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+)
+
+var flags = flag.NewFlagSet("diff-mapping", flag.ExitOnError)
+
+var (
+	schema     = flags.String("dbschema", "public", "db schema of the existing tables")
+	prefix     = flags.String("prefix", "osm_", "table prefix (NONE for no prefix)")
+	srid       = flags.Int("srid", 3857, "srs id of the existing tables")
+	lossyCasts = flags.Bool("allow-lossy-casts", false, "convert the values of columns with a new type, even if values can be lost")
+)
+
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s %s: [args] old-mapping new-mapping\n\n", os.Args[0], os.Args[1])
+	flags.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nPrint the SQL to migrate the tables of an existing import to a new mapping.")
+	os.Exit(1)
+}
+
+// DiffMapping prints the changes between two mappings as SQL statements
+// and comments.
+func DiffMapping(args []string) {
+	flags.Usage = Usage
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		Usage()
+	}
+
+	oldMapping, err := mapping.FromFile(flags.Arg(0))
+	if err != nil {
+		log.Fatal("[fatal] reading old mapping: ", err)
+	}
+	newMapping, err := mapping.FromFile(flags.Arg(1))
+	if err != nil {
+		log.Fatal("[fatal] reading new mapping: ", err)
+	}
+
+	diff := mapping.DiffMappings(oldMapping, newMapping)
+	stmts, err := postgis.MigrationSQL(diff, &newMapping.Conf, *schema, *prefix, *srid, *lossyCasts)
+	if err != nil {
+		log.Fatal("[fatal] ", err)
+	}
+	for _, stmt := range stmts {
+		fmt.Println(stmt)
+	}
+}
@@ -0,0 +1,5 @@
+/*
+Package diffmapping provides the diff-mapping sub command to compare two
+mappings and to print the SQL to migrate an existing import.
+*/
+package diffmapping
@@ -2,7 +2,8 @@
 Package mapping provides implements mapping and convertion between OSM elements and database tables, rows and columns.
 
 The core logic of Imposm is accesible with the Mapping struct.
-A Mapping creates filters and matchers based on mapping configuration (.yaml or .json file).
+A Mapping creates filters and matchers based on mapping configuration (.yaml, .json or .toml file).
+Mappings can also be constructed in Go code with NewTable, Mapping.AddTable and Mapping.Validate.
 
 Filters are for initial filtering (during -read). They remove all tags that are not needed.
 
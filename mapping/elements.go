@@ -0,0 +1,72 @@
+package mapping
+
+import (
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+type elementType byte
+
+const (
+	nodeElement elementType = iota
+	wayElement
+	relationElement
+)
+
+type elementID struct {
+	typ elementType
+	id  int64
+}
+
+// elementLists contains the IDs of the skip_elements and force_elements
+// lists. A nil elementLists contains no elements.
+type elementLists struct {
+	skip  map[elementID]struct{}
+	force map[elementID]struct{}
+}
+
+func newElementLists(conf *config.Mapping) *elementLists {
+	skip := elementIDSet(conf.SkipElements)
+	force := elementIDSet(conf.ForceElements)
+	if len(skip) == 0 && len(force) == 0 {
+		return nil
+	}
+	return &elementLists{skip: skip, force: force}
+}
+
+func elementIDSet(ids config.ElementIDs) map[elementID]struct{} {
+	set := make(map[elementID]struct{})
+	for _, id := range ids.Nodes {
+		set[elementID{nodeElement, id}] = struct{}{}
+	}
+	for _, id := range ids.Ways {
+		set[elementID{wayElement, id}] = struct{}{}
+	}
+	for _, id := range ids.Relations {
+		set[elementID{relationElement, id}] = struct{}{}
+	}
+	return set
+}
+
+func osmID(typ elementType, id int64) elementID {
+	if typ == wayElement && id < 0 {
+		// ways have negative IDs with use_single_id_space
+		id = -id
+	}
+	return elementID{typ, id}
+}
+
+func (l *elementLists) skipped(typ elementType, id int64) bool {
+	if l == nil {
+		return false
+	}
+	_, ok := l.skip[osmID(typ, id)]
+	return ok
+}
+
+func (l *elementLists) forced(typ elementType, id int64) bool {
+	if l == nil {
+		return false
+	}
+	_, ok := l.force[osmID(typ, id)]
+	return ok
+}
@@ -0,0 +1,295 @@
+package mapping
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
+)
+
+// Explanation describes how an element matches a single table.
+type Explanation struct {
+	// Geometry is the geometry type that is matched: point, linestring,
+	// polygon, relation or relation_member.
+	Geometry   string
+	Table      DestTable
+	Key, Value string
+	// AlsoInto is set if the table was added by an also_into rule.
+	AlsoInto   bool
+	Conditions []ConditionResult
+	// Matched is set if the element is inserted into the table.
+	Matched bool
+	// Columns are the values of the row, only set if Matched.
+	Columns []ColumnValue
+}
+
+// ColumnValue is the value of a single column. Values of columns that
+// depend on the geometry are not calculated.
+type ColumnValue struct {
+	Name     string
+	Value    interface{}
+	Geometry bool
+}
+
+// ConditionResult is the result of a single filter condition.
+type ConditionResult struct {
+	Condition string
+	Passed    bool
+}
+
+type explainMatcher struct {
+	geometry string
+	// unfiltered matches all tables by the mapping only
+	unfiltered *tagMatcher
+	matcher    *tagMatcher
+}
+
+// Explain returns an explanation for each table that the mapping of an
+// element with these tags matches. elemType is node, way or relation.
+// Geometry filters are not evaluated.
+func (m *Mapping) Explain(elemType string, tags osm.Tags, closed bool) ([]Explanation, error) {
+	var matchers []explainMatcher
+	add := func(geometry string, tableType TableType, matcher interface{}) {
+		mappings := make(TagTableMapping)
+		m.mappings(tableType, mappings)
+		tables, _ := m.tables(tableType)
+		tm := matcher.(*tagMatcher)
+		matchers = append(matchers, explainMatcher{
+			geometry: geometry,
+			unfiltered: &tagMatcher{
+				mappings:        mappings,
+				tables:          tables,
+				matchAreas:      tm.matchAreas,
+				untagged:        tm.untagged,
+				normalizeValues: tm.normalizeValues,
+			},
+			matcher: tm,
+		})
+	}
+
+	var elem osm.Element
+	elem.Tags = tags
+	var way *osm.Way
+	var rel *osm.Relation
+	switch elemType {
+	case "node":
+		add("point", PointTable, m.PointMatcher)
+	case "way":
+		way = &osm.Way{Element: elem, Refs: []int64{1, 2}}
+		if closed {
+			way.Refs = []int64{1, 2, 3, 1}
+		}
+		add("linestring", LineStringTable, m.LineStringMatcher)
+		add("polygon", PolygonTable, m.PolygonMatcher)
+	case "relation":
+		rel = &osm.Relation{Element: elem}
+		add("polygon", PolygonTable, m.PolygonMatcher)
+		add("relation", RelationTable, m.RelationMatcher)
+		add("relation_member", RelationMemberTable, m.RelationMemberMatcher)
+	default:
+		return nil, errors.Errorf("unknown element type %q", elemType)
+	}
+
+	filterTags := tags
+	if m.Conf.NormalizeValues {
+		filterTags = normalizeTags(tags)
+	}
+
+	var result []Explanation
+	for _, em := range matchers {
+		var candidates, matches []Match
+		switch elemType {
+		case "node":
+			n := &osm.Node{Element: elem}
+			candidates = em.unfiltered.MatchNode(n)
+			matches = em.matcher.MatchNode(n)
+		case "way":
+			candidates = em.unfiltered.MatchWay(way)
+			matches = em.matcher.MatchWay(way)
+		case "relation":
+			candidates = em.unfiltered.MatchRelation(rel)
+			matches = em.matcher.MatchRelation(rel)
+		}
+
+		matched := make(map[DestTable]*Match)
+		for i := range matches {
+			matched[matches[i].Table] = &matches[i]
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			return destTableLess(candidates[i].Table, candidates[j].Table)
+		})
+		for _, c := range candidates {
+			e := Explanation{
+				Geometry: em.geometry,
+				Table:    c.Table,
+				Key:      c.Key,
+				Value:    c.Value,
+			}
+			if match, ok := matched[c.Table]; ok {
+				e.Matched = true
+				e.Columns = m.explainColumns(match, &elem)
+			}
+			delete(matched, c.Table)
+			t := m.Conf.Tables[c.Table.Name]
+			if t.Filters != nil {
+				e.Conditions = append(e.Conditions, explainFilters(c.Table.Name, t.Filters, filterTags, Key(c.Key), closed)...)
+			}
+			if sub, ok := t.Mappings[c.Table.SubMapping]; ok && sub.Filters != nil {
+				e.Conditions = append(e.Conditions, explainFilters(c.Table.Name, sub.Filters, filterTags, Key(c.Key), closed)...)
+			}
+			result = append(result, e)
+		}
+
+		// remaining matches are from also_into rules
+		var alsoInto []Explanation
+		for t, match := range matched {
+			alsoInto = append(alsoInto, Explanation{
+				Geometry: em.geometry,
+				Table:    t,
+				Key:      match.Key,
+				Value:    match.Value,
+				AlsoInto: true,
+				Matched:  true,
+				Columns:  m.explainColumns(match, &elem),
+			})
+		}
+		sort.Slice(alsoInto, func(i, j int) bool {
+			return destTableLess(alsoInto[i].Table, alsoInto[j].Table)
+		})
+		result = append(result, alsoInto...)
+	}
+	return result, nil
+}
+
+func (m *Mapping) explainColumns(match *Match, elem *osm.Element) []ColumnValue {
+	var result []ColumnValue
+	for i, c := range m.Conf.Tables[match.Table.Name].Columns {
+		if AvailableColumnTypes[c.Type].FromGeometry {
+			result = append(result, ColumnValue{Name: c.Name, Geometry: true})
+			continue
+		}
+		result = append(result, ColumnValue{
+			Name:  c.Name,
+			Value: match.builder.columns[i].Value(elem, &geom.Geometry{}, *match),
+		})
+	}
+	return result
+}
+
+func destTableLess(a, b DestTable) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.SubMapping < b.SubMapping
+}
+
+// explainFilters evaluates each condition of f on its own.
+func explainFilters(table string, f *config.Filters, tags osm.Tags, key Key, closed bool) []ConditionResult {
+	var result []ConditionResult
+	add := func(desc string, cond *config.Filters) {
+		passed := true
+		for _, filter := range makeFilters(table, cond) {
+			if !filter(tags, key, closed) {
+				passed = false
+			}
+		}
+		result = append(result, ConditionResult{Condition: desc, Passed: passed})
+	}
+
+	if f.ExcludeTags != nil {
+		for _, kv := range *f.ExcludeTags {
+			add(fmt.Sprintf("exclude_tags %s=%s", kv[0], kv[1]), &config.Filters{ExcludeTags: &[][]string{kv}})
+		}
+	}
+	for _, k := range sortedKeys(f.Require) {
+		add(fmt.Sprintf("require %s: %s", k, formatValues(f.Require[k])),
+			&config.Filters{Require: config.KeyValues{k: f.Require[k]}})
+	}
+	for _, k := range sortedKeys(f.Reject) {
+		add(fmt.Sprintf("reject %s: %s", k, formatValues(f.Reject[k])),
+			&config.Filters{Reject: config.KeyValues{k: f.Reject[k]}})
+	}
+	for _, k := range sortedRegexpKeys(f.RequireRegexp) {
+		add(fmt.Sprintf("require_regexp %s: %s", k, f.RequireRegexp[k]),
+			&config.Filters{RequireRegexp: config.KeyRegexpValue{k: f.RequireRegexp[k]}})
+	}
+	for _, k := range sortedRegexpKeys(f.RejectRegexp) {
+		add(fmt.Sprintf("reject_regexp %s: %s", k, f.RejectRegexp[k]),
+			&config.Filters{RejectRegexp: config.KeyRegexpValue{k: f.RejectRegexp[k]}})
+	}
+	for _, cmp := range []struct {
+		name string
+		kn   config.KeyNumber
+		cond func(config.KeyNumber) *config.Filters
+	}{
+		{"require_gte", f.RequireGte, func(kn config.KeyNumber) *config.Filters { return &config.Filters{RequireGte: kn} }},
+		{"require_gt", f.RequireGt, func(kn config.KeyNumber) *config.Filters { return &config.Filters{RequireGt: kn} }},
+		{"require_lte", f.RequireLte, func(kn config.KeyNumber) *config.Filters { return &config.Filters{RequireLte: kn} }},
+		{"require_lt", f.RequireLt, func(kn config.KeyNumber) *config.Filters { return &config.Filters{RequireLt: kn} }},
+	} {
+		keys := make([]string, 0, len(cmp.kn))
+		for k := range cmp.kn {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := cmp.kn[config.Key(k)]
+			add(fmt.Sprintf("%s %s: %v", cmp.name, k, v), cmp.cond(config.KeyNumber{config.Key(k): v}))
+		}
+	}
+	if len(f.RequireAnyKey) > 0 {
+		add(fmt.Sprintf("require_any_key: %s", formatKeys(f.RequireAnyKey)), &config.Filters{RequireAnyKey: f.RequireAnyKey})
+	}
+	if len(f.RejectAllKeys) > 0 {
+		add(fmt.Sprintf("reject_all_keys: %s", formatKeys(f.RejectAllKeys)), &config.Filters{RejectAllKeys: f.RejectAllKeys})
+	}
+	if len(f.All) > 0 {
+		add(fmt.Sprintf("all: %d conditions", len(f.All)), &config.Filters{All: f.All})
+	}
+	if len(f.Any) > 0 {
+		add(fmt.Sprintf("any: %d conditions", len(f.Any)), &config.Filters{Any: f.Any})
+	}
+	if f.Not != nil {
+		add("not", &config.Filters{Not: f.Not})
+	}
+	return result
+}
+
+func sortedKeys(kv config.KeyValues) []config.Key {
+	keys := make([]config.Key, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func sortedRegexpKeys(kv config.KeyRegexpValue) []config.Key {
+	keys := make([]config.Key, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func formatValues(values []config.OrderedValue) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = string(v.Value)
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+func formatKeys(keys []config.Key) string {
+	s := make([]string, len(keys))
+	for i, k := range keys {
+		s[i] = string(k)
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
@@ -0,0 +1,5 @@
+/*
+Package explain provides the explain sub command to show how the mapping
+handles a single element.
+*/
+package explain
@@ -0,0 +1,124 @@
+package explain
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+)
+
+var flags = flag.NewFlagSet("explain", flag.ExitOnError)
+
+var (
+	mappingFile = flags.String("mapping", "", "mapping file")
+	tags        = flags.String("tags", "", "tags of the element (key=value,key=value)")
+	elemType    = flags.String("type", "way", "element type (node, way or relation)")
+	closed      = flags.Bool("closed", false, "way is closed")
+)
+
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s %s:\n\n", os.Args[0], os.Args[1])
+	flags.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nExplain how the mapping handles an element with these tags.")
+	os.Exit(1)
+}
+
+// Explain prints the tables that an element with the given tags matches,
+// the result of each filter condition and the column values.
+func Explain(args []string) {
+	flags.Usage = Usage
+	flags.Parse(args)
+	if *mappingFile == "" {
+		Usage()
+	}
+
+	elemTags, err := parseTags(*tags)
+	if err != nil {
+		log.Fatal("[fatal] ", err)
+	}
+
+	tagmapping, err := mapping.FromFile(*mappingFile)
+	if err != nil {
+		log.Fatal("[fatal] reading mapping: ", err)
+	}
+
+	explanations, err := tagmapping.Explain(*elemType, elemTags, *closed)
+	if err != nil {
+		log.Fatal("[fatal] ", err)
+	}
+	printExplanations(os.Stdout, explanations)
+}
+
+func parseTags(s string) (osm.Tags, error) {
+	tags := make(osm.Tags)
+	if s == "" {
+		return tags, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", kv)
+		}
+		tags[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return tags, nil
+}
+
+func printExplanations(w io.Writer, explanations []mapping.Explanation) {
+	if len(explanations) == 0 {
+		fmt.Fprintln(w, "no matching tables")
+		return
+	}
+	for _, e := range explanations {
+		name := e.Table.Name
+		if e.Table.SubMapping != "" {
+			name += " (sub-mapping " + e.Table.SubMapping + ")"
+		}
+		status := "rejected"
+		if e.Matched {
+			status = "inserted"
+		}
+		fmt.Fprintf(w, "%s %s: %s=%s, %s\n", e.Geometry, name, e.Key, e.Value, status)
+		if e.AlsoInto {
+			fmt.Fprintln(w, "  added by also_into")
+		}
+		failed := false
+		for _, c := range e.Conditions {
+			result := "pass"
+			if !c.Passed {
+				result = "FAIL"
+				failed = true
+			}
+			fmt.Fprintf(w, "  [%s] %s\n", result, c.Condition)
+		}
+		if !e.Matched && !failed {
+			fmt.Fprintln(w, "  rejected by relation_types or areas handling")
+		}
+		for _, c := range e.Columns {
+			if c.Geometry {
+				fmt.Fprintf(w, "    %s: (geometry)\n", c.Name)
+				continue
+			}
+			fmt.Fprintf(w, "    %s: %s\n", c.Name, formatValue(c.Value))
+		}
+	}
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return fmt.Sprintf("%q", string(v))
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
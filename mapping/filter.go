@@ -2,6 +2,7 @@ package mapping
 
 import (
 	"path"
+	"sort"
 	"strings"
 
 	osm "github.com/omniscale/go-osm"
@@ -13,21 +14,15 @@ type TagFilterer interface {
 }
 
 func (m *Mapping) NodeTagFilter() TagFilterer {
-	if m.Conf.Tags.LoadAll {
-		return newExcludeFilter(m.Conf.Tags.Exclude)
-	}
 	mappings := make(TagTableMapping)
 	m.mappings(PointTable, mappings)
 	tags := make(map[Key]bool)
 	m.extraTags(PointTable, tags)
 	m.extraTags(RelationMemberTable, tags)
-	return &tagFilter{mappings.asTagMap(), tags}
+	return m.tagFilter(&tagFilter{mappings.asTagMap(), tags})
 }
 
 func (m *Mapping) WayTagFilter() TagFilterer {
-	if m.Conf.Tags.LoadAll {
-		return newExcludeFilter(m.Conf.Tags.Exclude)
-	}
 	mappings := make(TagTableMapping)
 	m.mappings(LineStringTable, mappings)
 	m.mappings(PolygonTable, mappings)
@@ -35,13 +30,10 @@ func (m *Mapping) WayTagFilter() TagFilterer {
 	m.extraTags(LineStringTable, tags)
 	m.extraTags(PolygonTable, tags)
 	m.extraTags(RelationMemberTable, tags)
-	return &tagFilter{mappings.asTagMap(), tags}
+	return m.tagFilter(&tagFilter{mappings.asTagMap(), tags})
 }
 
 func (m *Mapping) RelationTagFilter() TagFilterer {
-	if m.Conf.Tags.LoadAll {
-		return newExcludeFilter(m.Conf.Tags.Exclude)
-	}
 	mappings := make(TagTableMapping)
 	// do not filter out type tag for common relations
 	mappings["type"] = map[Value][]orderedDestTable{
@@ -58,7 +50,21 @@ func (m *Mapping) RelationTagFilter() TagFilterer {
 	m.extraTags(PolygonTable, tags)
 	m.extraTags(RelationTable, tags)
 	m.extraTags(RelationMemberTable, tags)
-	return &tagFilter{mappings.asTagMap(), tags}
+	return m.tagFilter(&tagFilter{mappings.asTagMap(), tags})
+}
+
+// tagFilter returns the filter for the mapped tags, or the exclude filter
+// with load_all. The tags of elements with more than max_tags tags are
+// truncated with the truncate policy.
+func (m *Mapping) tagFilter(mapped *tagFilter) TagFilterer {
+	var f TagFilterer = mapped
+	if m.Conf.Tags.LoadAll {
+		f = newExcludeFilter(m.Conf.Tags.Exclude)
+	}
+	if m.Conf.Tags.MaxTags > 0 && maxTagsPolicy(m.Conf.Tags) == MaxTagsTruncate {
+		return &truncateFilter{filter: f, mapped: mapped, max: m.Conf.Tags.MaxTags}
+	}
+	return f
 }
 
 type tagMap map[Key]map[Value]struct{}
@@ -73,21 +79,70 @@ func (f *tagFilter) Filter(tags *osm.Tags) {
 		return
 	}
 	for k, v := range *tags {
-		values, ok := f.mappings[Key(k)]
-		if ok {
-			if _, ok := values["__any__"]; ok {
-				continue
-			} else if _, ok := values[Value(v)]; ok {
-				continue
-			} else if _, ok := f.extraTags[Key(k)]; !ok {
-				delete(*tags, k)
-			}
-		} else if _, ok := f.extraTags[Key(k)]; !ok {
+		if !f.keep(k, v) {
 			delete(*tags, k)
 		}
 	}
 }
 
+// keep returns whether the tag is used by the mapping.
+func (f *tagFilter) keep(k, v string) bool {
+	if values, ok := f.mappings[Key(k)]; ok {
+		if _, ok := values["__any__"]; ok {
+			return true
+		} else if _, ok := values[Value(v)]; ok {
+			return true
+		}
+	}
+	_, ok := f.extraTags[Key(k)]
+	return ok
+}
+
+// truncateFilter removes the tags of elements with more than max tags
+// after filter. Keys that are used by the mapping are always kept, the
+// other tags are kept in the order of their keys till max is reached.
+type truncateFilter struct {
+	filter TagFilterer
+	mapped *tagFilter
+	max    int
+}
+
+func (f *truncateFilter) Filter(tags *osm.Tags) {
+	if tags == nil {
+		return
+	}
+	f.filter.Filter(tags)
+	if len(*tags) <= f.max {
+		return
+	}
+	kept := 0
+	others := make([]string, 0, len(*tags))
+	for k := range *tags {
+		if f.mapped.mappedKey(k) {
+			kept++
+		} else {
+			others = append(others, k)
+		}
+	}
+	sort.Strings(others)
+	for i, k := range others {
+		if kept+i >= f.max {
+			delete(*tags, k)
+		}
+	}
+}
+
+// mappedKey returns whether the key is used by the mapping, independent
+// of the value. Values are not checked, as they can match after
+// normalization.
+func (f *tagFilter) mappedKey(k string) bool {
+	if _, ok := f.mappings[Key(k)]; ok {
+		return true
+	}
+	_, ok := f.extraTags[Key(k)]
+	return ok
+}
+
 type excludeFilter struct {
 	keys    map[Key]struct{}
 	matches []string
@@ -444,6 +444,182 @@ tables:
 	)
 }
 
+func TestFilters_any_all_not(t *testing.T) {
+	filterTest(
+		t,
+		`
+tables:
+  footways:
+    columns:
+    - name: id
+      type: id
+    filters:
+      any:
+        - require:
+            highway: [footway]
+        - all:
+          - require:
+              highway: [path]
+          - require:
+              foot: [designated]
+      not:
+        require:
+          access: ["private", "no"]
+    mapping:
+      highway: [footway, path]
+    type: linestring
+`,
+		// Accept
+		[]osm.Tags{
+			osm.Tags{"highway": "footway"},
+			osm.Tags{"highway": "footway", "access": "yes"},
+			osm.Tags{"highway": "path", "foot": "designated"},
+		},
+		// Reject
+		[]osm.Tags{
+			osm.Tags{"highway": "path"},
+			osm.Tags{"highway": "path", "foot": "yes"},
+			osm.Tags{"highway": "footway", "access": "private"},
+			osm.Tags{"highway": "path", "foot": "designated", "access": "no"},
+			osm.Tags{"foot": "designated"},
+		},
+	)
+}
+
+func TestFilters_compare(t *testing.T) {
+	filterTest(
+		t,
+		`
+tables:
+  buildings:
+    columns:
+    - name: id
+      type: id
+    filters:
+      require_gte:
+        building:levels: 5
+      require_lt:
+        height: 100.5
+    mapping:
+      building: [__any__]
+    type: linestring
+`,
+		// Accept
+		[]osm.Tags{
+			osm.Tags{"building": "yes", "building:levels": "5", "height": "20"},
+			osm.Tags{"building": "yes", "building:levels": " 12 ", "height": "100.4"},
+			osm.Tags{"building": "yes", "building:levels": "5.5", "height": "-1"},
+		},
+		// Reject
+		[]osm.Tags{
+			osm.Tags{"building": "yes", "building:levels": "4", "height": "20"},
+			osm.Tags{"building": "yes", "building:levels": "5", "height": "100.5"},
+			osm.Tags{"building": "yes", "building:levels": "5"},
+			osm.Tags{"building": "yes", "building:levels": "many", "height": "20"},
+			osm.Tags{"building": "yes", "building:levels": "NaN", "height": "20"},
+			osm.Tags{"building": "yes", "height": "20"},
+		},
+	)
+}
+
+func TestFilters_require_any_key(t *testing.T) {
+	filterTest(
+		t,
+		`
+tables:
+  roads:
+    columns:
+    - name: id
+      type: id
+    filters:
+      require_any_key: [name, ref]
+      reject_all_keys: [disused, abandoned]
+    mapping:
+      highway: [__any__]
+    type: linestring
+`,
+		// Accept
+		[]osm.Tags{
+			osm.Tags{"highway": "primary", "name": "Main Street"},
+			osm.Tags{"highway": "primary", "ref": "B4"},
+			osm.Tags{"highway": "primary", "name": "Main Street", "ref": "B4"},
+			osm.Tags{"highway": "primary", "ref": "B4", "disused": "yes"},
+		},
+		// Reject
+		[]osm.Tags{
+			osm.Tags{"highway": "primary"},
+			osm.Tags{"highway": "primary", "oneway": "yes"},
+			osm.Tags{"highway": "primary", "ref": "B4", "disused": "yes", "abandoned": "yes"},
+		},
+	)
+}
+
+func TestFilters_nil(t *testing.T) {
+	filterTest(
+		t,
+		`
+tables:
+  roads:
+    columns:
+    - name: id
+      type: id
+    filters:
+      require:
+        tunnel: ["no", __nil__]
+      reject:
+        ref: [__nil__]
+    mapping:
+      highway: [__any__]
+    type: linestring
+`,
+		// Accept
+		[]osm.Tags{
+			osm.Tags{"highway": "primary", "ref": "B4"},
+			osm.Tags{"highway": "primary", "ref": "B4", "tunnel": "no"},
+		},
+		// Reject
+		[]osm.Tags{
+			osm.Tags{"highway": "primary"},
+			osm.Tags{"highway": "primary", "tunnel": "no"},
+			osm.Tags{"highway": "primary", "ref": "B4", "tunnel": "yes"},
+		},
+	)
+}
+
+func TestFilters_normalize_values(t *testing.T) {
+	filterTest(
+		t,
+		`
+normalize_values: true
+tables:
+  roads:
+    columns:
+    - name: id
+      type: id
+    filters:
+      reject:
+        access: [Private]
+    mapping:
+      highway: [primary]
+      cycleway: [__any__]
+    type: linestring
+`,
+		// Accept
+		[]osm.Tags{
+			osm.Tags{"highway": "primary"},
+			osm.Tags{"highway": "Primary "},
+			osm.Tags{"highway": "PRIMARY", "access": "yes"},
+			osm.Tags{"cycleway": "Lane"},
+		},
+		// Reject
+		[]osm.Tags{
+			osm.Tags{"highway": "primary", "access": "private"},
+			osm.Tags{"highway": " Primary", "access": "PRIVATE "},
+			osm.Tags{"highway": "secondary"},
+		},
+	)
+}
+
 func filterTest(t *testing.T, mapping string, accept []osm.Tags, reject []osm.Tags) {
 	var configTestMapping *Mapping
 	var err error
@@ -490,3 +666,72 @@ func filterTest(t *testing.T, mapping string, accept []osm.Tags, reject []osm.Ta
 	}
 
 }
+
+func TestFilters_negative_values(t *testing.T) {
+	filterTest(
+		t,
+		`
+tables:
+  roads:
+    columns:
+    - name: id
+      type: id
+    mapping:
+      highway: [__any__, -construction, -proposed]
+      layer: ["-1"]
+    type: linestring
+`,
+		// Accept
+		[]osm.Tags{
+			osm.Tags{"highway": "primary"},
+			osm.Tags{"highway": "constructions"},
+			osm.Tags{"layer": "-1"},
+			osm.Tags{"highway": "construction", "layer": "-1"},
+		},
+		// Reject
+		[]osm.Tags{
+			osm.Tags{"highway": "construction"},
+			osm.Tags{"highway": "proposed"},
+			osm.Tags{"layer": "1"},
+		},
+	)
+}
+
+func TestFilters_sub_mapping(t *testing.T) {
+	filterTest(
+		t,
+		`
+tables:
+  transport:
+    columns:
+    - name: id
+      type: id
+    filters:
+      reject:
+        highway: [proposed]
+    mappings:
+      rail:
+        mapping:
+          railway: [__any__]
+      roads:
+        mapping:
+          highway: [__any__]
+        filters:
+          reject:
+            access: [private]
+    type: linestring
+`,
+		// Accept
+		[]osm.Tags{
+			osm.Tags{"highway": "primary"},
+			osm.Tags{"railway": "rail", "access": "private"},
+			osm.Tags{"railway": "tram", "highway": "primary", "access": "private"},
+		},
+		// Reject
+		[]osm.Tags{
+			osm.Tags{"highway": "primary", "access": "private"},
+			osm.Tags{"highway": "proposed"},
+			osm.Tags{"railway": "rail", "highway": "proposed"},
+		},
+	)
+}
@@ -558,6 +558,322 @@ func TestPolygonMatcher_MatchRelation(t *testing.T) {
 	}
 }
 
+func TestRelationMatcher_RelationTypes(t *testing.T) {
+	mapping, err := New([]byte(`
+    tables:
+      routes:
+        type: relation
+        relation_types: [route, route_master]
+        mapping:
+          route: [bus]
+          route_master: [bus]
+      route_members:
+        type: relation_member
+        relation_types: [route]
+        mapping:
+          route: [bus]
+      any_relations:
+        type: relation
+        mapping:
+          route: [bus]
+    `))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tags          osm.Tags
+		matches       []Match
+		memberMatches []Match
+	}{
+		{osm.Tags{"route": "bus"}, []Match{{"route", "bus", DestTable{Name: "any_relations"}, nil}}, []Match{}},
+		{osm.Tags{"route": "bus", "type": "multipolygon"}, []Match{{"route", "bus", DestTable{Name: "any_relations"}, nil}}, []Match{}},
+		{osm.Tags{"route": "bus", "type": "route"}, []Match{
+			{"route", "bus", DestTable{Name: "routes"}, nil},
+			{"route", "bus", DestTable{Name: "any_relations"}, nil},
+		}, []Match{{"route", "bus", DestTable{Name: "route_members"}, nil}}},
+		{osm.Tags{"route_master": "bus", "type": "route_master"}, []Match{{"route_master", "bus", DestTable{Name: "routes"}, nil}}, []Match{}},
+	}
+
+	elem := osm.Relation{}
+	for i, test := range tests {
+		elem.Tags = test.tags
+		actual := mapping.RelationMatcher.MatchRelation(&elem)
+		if !matchesEqual(actual, test.matches) {
+			t.Errorf("unexpected result for case %d: %v != %v", i+1, actual, test.matches)
+		}
+		actual = mapping.RelationMemberMatcher.MatchRelation(&elem)
+		if !matchesEqual(actual, test.memberMatches) {
+			t.Errorf("unexpected member result for case %d: %v != %v", i+1, actual, test.memberMatches)
+		}
+	}
+}
+
+func TestRelationTypes_InvalidTableType(t *testing.T) {
+	_, err := New([]byte(`
+    tables:
+      roads:
+        type: linestring
+        relation_types: [route]
+        mapping:
+          highway: [__any__]
+    `))
+	if err == nil {
+		t.Fatal("expected error for relation_types in linestring table")
+	}
+}
+
+func TestRelationMemberMatcher_MatchMember(t *testing.T) {
+	mapping, err := New([]byte(`
+    tables:
+      stops:
+        type: relation_member
+        relation_types: [route]
+        member_roles: [stop, platform]
+        mapping:
+          route: [bus]
+      members:
+        type: relation_member
+        relation_types: [route]
+        mapping:
+          route: [bus]
+    `))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	elem := osm.Relation{}
+	elem.Tags = osm.Tags{"route": "bus", "type": "route"}
+	m := mapping.RelationMemberMatcher
+	matches := m.MatchRelation(&elem)
+	if !matchesEqual(matches, []Match{
+		{"route", "bus", DestTable{Name: "stops"}, nil},
+		{"route", "bus", DestTable{Name: "members"}, nil},
+	}) {
+		t.Fatal("unexpected relation matches", matches)
+	}
+
+	tests := []struct {
+		member  osm.Member
+		matches []Match
+	}{
+		{osm.Member{Role: "stop"}, []Match{
+			{"route", "bus", DestTable{Name: "stops"}, nil},
+			{"route", "bus", DestTable{Name: "members"}, nil},
+		}},
+		{osm.Member{Role: "platform"}, []Match{
+			{"route", "bus", DestTable{Name: "stops"}, nil},
+			{"route", "bus", DestTable{Name: "members"}, nil},
+		}},
+		{osm.Member{Role: ""}, []Match{{"route", "bus", DestTable{Name: "members"}, nil}}},
+		{osm.Member{Role: "stop_entry_only"}, []Match{{"route", "bus", DestTable{Name: "members"}, nil}}},
+	}
+	for i, test := range tests {
+		actual := m.MatchMember(&test.member, matches)
+		if !matchesEqual(actual, test.matches) {
+			t.Errorf("unexpected result for case %d: %v != %v", i+1, actual, test.matches)
+		}
+	}
+}
+
+func TestRelationMemberMatcher_MatchMemberTypes(t *testing.T) {
+	mapping, err := New([]byte(`
+    tables:
+      stops:
+        type: relation_member
+        relation_types: [route]
+        member_types: [node]
+        member_roles_regexp: '^(stop|platform)(_entry_only|_exit_only)?$'
+        mapping:
+          route: [bus]
+      ways:
+        type: relation_member
+        relation_types: [route]
+        member_types: [way, relation]
+        mapping:
+          route: [bus]
+    `))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	elem := osm.Relation{}
+	elem.Tags = osm.Tags{"route": "bus", "type": "route"}
+	m := mapping.RelationMemberMatcher
+	matches := m.MatchRelation(&elem)
+
+	tests := []struct {
+		member  osm.Member
+		matches []Match
+	}{
+		{osm.Member{Type: osm.NodeMember, Role: "stop"}, []Match{{"route", "bus", DestTable{Name: "stops"}, nil}}},
+		{osm.Member{Type: osm.NodeMember, Role: "stop_entry_only"}, []Match{{"route", "bus", DestTable{Name: "stops"}, nil}}},
+		{osm.Member{Type: osm.NodeMember, Role: "stops"}, nil},
+		{osm.Member{Type: osm.WayMember, Role: "platform"}, []Match{{"route", "bus", DestTable{Name: "ways"}, nil}}},
+		{osm.Member{Type: osm.RelationMember, Role: ""}, []Match{{"route", "bus", DestTable{Name: "ways"}, nil}}},
+	}
+	for i, test := range tests {
+		actual := m.MatchMember(&test.member, matches)
+		if !matchesEqual(actual, test.matches) {
+			t.Errorf("unexpected result for case %d: %v != %v", i+1, actual, test.matches)
+		}
+	}
+}
+
+func TestMemberTypes_Invalid(t *testing.T) {
+	for _, table := range []string{
+		`
+        type: relation
+        member_types: [node]`,
+		`
+        type: relation_member
+        member_types: [point]`,
+		`
+        type: relation_member
+        member_roles_regexp: '(stop'`,
+	} {
+		_, err := New([]byte(`
+    tables:
+      routes:` + table + `
+        mapping:
+          route: [bus]
+    `))
+		if err == nil {
+			t.Errorf("expected error for %q", table)
+		}
+	}
+}
+
+func TestMemberRoles_InvalidTableType(t *testing.T) {
+	_, err := New([]byte(`
+    tables:
+      routes:
+        type: relation
+        member_roles: [stop]
+        mapping:
+          route: [bus]
+    `))
+	if err == nil {
+		t.Fatal("expected error for member_roles in relation table")
+	}
+}
+
+func TestTagFilterMaxTags(t *testing.T) {
+	for _, loadAll := range []string{"false", "true"} {
+		mapping, err := New([]byte(`
+    tags:
+      load_all: ` + loadAll + `
+      max_tags: 3
+    tables:
+      places:
+        type: point
+        columns:
+        - key: name
+          name: name
+          type: string
+        - key: population
+          name: population
+          type: integer
+        - key: ref
+          name: ref
+          type: string
+        mapping:
+          place: [city]
+    `))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes := mapping.NodeTagFilter()
+
+		tags := osm.Tags{"place": "city", "name": "Foo"}
+		nodes.Filter(&tags)
+		if len(tags) != 2 {
+			t.Errorf("unexpected tags %v", tags)
+		}
+
+		tags = osm.Tags{"place": "city", "name": "Foo", "a": "1", "b": "2", "c": "3", "d": "4"}
+		nodes.Filter(&tags)
+		expected := osm.Tags{"place": "city", "name": "Foo"}
+		if loadAll == "true" {
+			// mapped tags first, then by key
+			expected["a"] = "1"
+		}
+		if !stringMapEqual(tags, expected) {
+			t.Errorf("unexpected tags for load_all %s: %v", loadAll, tags)
+		}
+
+		// mapped keys are always kept, even above max_tags
+		tags = osm.Tags{"place": "city", "name": "Foo", "population": "100", "ref": "1", "a": "1"}
+		nodes.Filter(&tags)
+		expected = osm.Tags{"place": "city", "name": "Foo", "population": "100", "ref": "1"}
+		if !stringMapEqual(tags, expected) {
+			t.Errorf("unexpected tags for load_all %s: %v", loadAll, tags)
+		}
+	}
+}
+
+func TestMaxTagsPolicy(t *testing.T) {
+	mapping, err := New([]byte(`
+    tags:
+      max_tags: 100
+      max_tags_policy: hstore
+    tables:
+      places:
+        type: point
+        columns:
+        - name: tags
+          type: hstore_tags
+        - name: other_tags
+          type: hstore_tags
+          args:
+            max_keys: 10
+        mapping:
+          place: [city]
+    `))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols := mapping.Conf.Tables["places"].Columns
+	if cols[0].Args["max_keys"] != 100 || cols[1].Args["max_keys"] != 10 {
+		t.Errorf("unexpected max_keys %v %v", cols[0].Args, cols[1].Args)
+	}
+	if n := mapping.SkipMaxTags(); n != 0 {
+		t.Errorf("unexpected SkipMaxTags %d", n)
+	}
+	// tags are not truncated
+	tags := osm.Tags{}
+	for i := 0; i < 200; i++ {
+		tags[string(rune('a'+i%26))+string(rune('a'+i/26))] = "x"
+	}
+	tags["place"] = "city"
+	mapping.NodeTagFilter().Filter(&tags)
+	if len(tags) != 1 {
+		t.Errorf("unexpected tags %v", tags)
+	}
+
+	mapping, err = New([]byte(`
+    tags:
+      max_tags: 100
+      max_tags_policy: skip
+    tables: {}
+    `))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := mapping.SkipMaxTags(); n != 100 {
+		t.Errorf("unexpected SkipMaxTags %d", n)
+	}
+
+	for _, tags := range []string{
+		"max_tags: -1",
+		"max_tags: 10\n      max_tags_policy: drop",
+	} {
+		if _, err := New([]byte("tags:\n      " + tags + "\n")); err == nil {
+			t.Errorf("expected error for %q", tags)
+		}
+	}
+}
+
 func TestExcludeFilter(t *testing.T) {
 	var f TagFilterer
 	var tags osm.Tags
@@ -0,0 +1,118 @@
+package mapping
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
+)
+
+// SortedGeneralizedTables returns the names of all generalized tables in
+// topological order: each generalized table comes after the generalized
+// table it uses as source. Returns an error if a source table is missing or
+// if the generalized tables depend on each other in a cycle.
+func SortedGeneralizedTables(conf *config.Mapping) ([]string, error) {
+	names := make([]string, 0, len(conf.GeneralizedTables))
+	for name, t := range conf.GeneralizedTables {
+		if _, ok := conf.Tables[t.SourceTableName]; !ok {
+			if _, ok := conf.GeneralizedTables[t.SourceTableName]; !ok {
+				return nil, errors.Errorf("missing source %q for generalized table %q",
+					t.SourceTableName, name)
+			}
+		}
+		names = append(names, name)
+	}
+	// sort names for a stable order
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(names))
+	sorted := make([]string, 0, len(names))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i := range path {
+				if path[i] == name {
+					path = path[i:]
+					break
+				}
+			}
+			return errors.Errorf("cycle in generalized tables: %s -> %s",
+				strings.Join(path, " -> "), name)
+		}
+		state[name] = visiting
+		source := conf.GeneralizedTables[name].SourceTableName
+		if _, ok := conf.Tables[source]; !ok {
+			if err := visit(source, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		sorted = append(sorted, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// checkMergedTables checks the merge and group_by options of all generalized
+// tables. sorted needs to be in topological order.
+func checkMergedTables(conf *config.Mapping, sorted []string) error {
+	// columns of each generalized table, nil for all source columns
+	groupColumns := make(map[string]map[string]bool)
+	baseTables := make(map[string]*config.Table)
+
+	for _, name := range sorted {
+		t := conf.GeneralizedTables[name]
+		var available map[string]bool
+		if source, ok := conf.Tables[t.SourceTableName]; ok {
+			baseTables[name] = source
+		} else {
+			baseTables[name] = baseTables[t.SourceTableName]
+			available = groupColumns[t.SourceTableName]
+		}
+		if !t.Merge {
+			if len(t.GroupBy) > 0 {
+				return errors.Errorf("group_by of generalized table %s requires merge", name)
+			}
+			if available != nil {
+				return errors.Errorf("generalized table %s requires merge for merged source %s", name, t.SourceTableName)
+			}
+			continue
+		}
+		switch TableType(baseTables[name].Type) {
+		case PolygonTable, GeometryTable:
+		default:
+			return errors.Errorf("merge of generalized table %s requires polygon source, not %s", name, baseTables[name].Type)
+		}
+		columns := make(map[string]bool)
+		for _, col := range baseTables[name].Columns {
+			if available == nil || available[col.Name] {
+				columns[col.Name] = true
+			}
+		}
+		group := make(map[string]bool)
+		for _, col := range t.GroupBy {
+			if !columns[col] {
+				return errors.Errorf("unknown group_by column %s for generalized table %s", col, name)
+			}
+			group[col] = true
+		}
+		groupColumns[name] = group
+	}
+	return nil
+}
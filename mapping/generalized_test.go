@@ -0,0 +1,179 @@
+package mapping
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortedGeneralizedTables(t *testing.T) {
+	m, err := New([]byte(`
+    tables:
+      roads:
+        type: linestring
+        mapping:
+          highway: [__any__]
+    generalized_tables:
+      roads_gen2:
+        source: roads_gen1
+        tolerance: 200
+      roads_gen0:
+        source: roads
+        tolerance: 10
+      roads_gen1:
+        source: roads_gen0
+        tolerance: 50
+      roads_other:
+        source: roads
+        tolerance: 50
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorted, err := SortedGeneralizedTables(&m.Conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"roads_gen0", "roads_gen1", "roads_gen2", "roads_other"}
+	if !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("unexpected order %v, expected %v", sorted, expected)
+	}
+}
+
+func TestSortedGeneralizedTablesErrors(t *testing.T) {
+	for _, tc := range []struct {
+		generalized string
+		err         string
+	}{
+		{`
+      roads_gen0:
+        source: missing
+`, `missing source "missing" for generalized table "roads_gen0"`},
+		{`
+      roads_gen0:
+        source: roads_gen0
+`, `cycle in generalized tables: roads_gen0 -> roads_gen0`},
+		{`
+      roads_gen0:
+        source: roads_gen2
+      roads_gen1:
+        source: roads_gen0
+      roads_gen2:
+        source: roads_gen1
+      roads_gen3:
+        source: roads_gen2
+`, `cycle in generalized tables: roads_gen0 -> roads_gen2 -> roads_gen1 -> roads_gen0`},
+	} {
+		_, err := New([]byte(`
+    tables:
+      roads:
+        type: linestring
+        mapping:
+          highway: [__any__]
+    generalized_tables:` + tc.generalized))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestGeneralizedColumns(t *testing.T) {
+	mapping := `
+    tables:
+      landusages:
+        type: polygon
+        mapping:
+          landuse: [__any__]
+    generalized_tables:
+      landusages_gen1:
+        source: landusages
+        tolerance: 50
+        columns:
+          - name: area
+`
+	_, err := New([]byte(mapping + "            sql: ST_Area(geometry)\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = New([]byte(mapping))
+	if err == nil || !strings.Contains(err.Error(), "require name and sql") {
+		t.Error("expected error for column without sql, got", err)
+	}
+}
+
+func TestMergedGeneralizedTables(t *testing.T) {
+	tables := `
+    tables:
+      landusages:
+        type: polygon
+        columns:
+          - {name: osm_id, type: id}
+          - {name: geometry, type: geometry}
+          - {name: type, type: mapping_value}
+          - {name: name, type: string, key: name}
+        mapping:
+          landuse: [__any__]
+      roads:
+        type: linestring
+        mapping:
+          highway: [__any__]
+    generalized_tables:`
+
+	for _, tc := range []struct {
+		generalized string
+		err         string
+	}{
+		{`
+      landusages_gen1:
+        source: landusages
+        merge: true
+        group_by: [type]
+      landusages_gen0:
+        source: landusages_gen1
+        merge: true
+        group_by: [type]
+`, ""},
+		{`
+      landusages_gen1:
+        source: landusages
+        group_by: [type]
+`, "group_by of generalized table landusages_gen1 requires merge"},
+		{`
+      landusages_gen1:
+        source: landusages
+        merge: true
+        group_by: [unknown]
+`, "unknown group_by column unknown"},
+		{`
+      landusages_gen1:
+        source: landusages
+        merge: true
+        group_by: [type]
+      landusages_gen0:
+        source: landusages_gen1
+        merge: true
+        group_by: [name]
+`, "unknown group_by column name"},
+		{`
+      landusages_gen1:
+        source: landusages
+        merge: true
+      landusages_gen0:
+        source: landusages_gen1
+`, "requires merge for merged source"},
+		{`
+      roads_gen1:
+        source: roads
+        merge: true
+`, "requires polygon source"},
+	} {
+		_, err := New([]byte(tables + tc.generalized))
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error %q, got %v", tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package mapping
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+var indexMethods = map[string]bool{
+	"btree":  true,
+	"gist":   true,
+	"gin":    true,
+	"brin":   true,
+	"hash":   true,
+	"spgist": true,
+}
+
+// prepareIndexes checks the indexes of a table and sets the default method
+// and name. The names do not include the table prefix.
+func prepareIndexes(t *config.Table) error {
+	columns := make(map[string]bool)
+	for _, c := range t.Columns {
+		columns[c.Name] = true
+	}
+	names := make(map[string]bool)
+	for i := range t.Indexes {
+		idx := &t.Indexes[i]
+		if len(idx.Columns) == 0 {
+			return errors.New("columns are required")
+		}
+		for _, c := range idx.Columns {
+			if !columns[c] {
+				return errors.Errorf("unknown column %s", c)
+			}
+		}
+		if idx.Method == "" {
+			idx.Method = "btree"
+		}
+		idx.Method = strings.ToLower(idx.Method)
+		if !indexMethods[idx.Method] {
+			return errors.Errorf("unknown method %q (btree, gist, gin, brin, hash or spgist)", idx.Method)
+		}
+		if idx.Method == "hash" && len(idx.Columns) > 1 {
+			return errors.New("hash indexes only support a single column")
+		}
+		if idx.Name == "" {
+			idx.Name = t.Name + "_" + strings.Join(idx.Columns, "_") + "_" + idx.Method
+		}
+		if names[idx.Name] {
+			return errors.Errorf("duplicate index %s", idx.Name)
+		}
+		names[idx.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+func TestPrepareIndexes(t *testing.T) {
+	columns := []*config.Column{
+		{Name: "osm_id", Type: "id"},
+		{Name: "name", Type: "string"},
+		{Name: "type", Type: "mapping_value"},
+		{Name: "tags", Type: "hstore_tags"},
+	}
+	tbl := &config.Table{
+		Name:    "roads",
+		Columns: columns,
+		Indexes: []config.Index{
+			{Columns: []string{"name", "type"}},
+			{Name: "roads_tags", Columns: []string{"tags"}, Method: "GIN", Where: "name IS NOT NULL"},
+		},
+	}
+	if err := prepareIndexes(tbl); err != nil {
+		t.Fatal(err)
+	}
+	if idx := tbl.Indexes[0]; idx.Name != "roads_name_type_btree" || idx.Method != "btree" {
+		t.Errorf("unexpected defaults %+v", idx)
+	}
+	if idx := tbl.Indexes[1]; idx.Name != "roads_tags" || idx.Method != "gin" {
+		t.Errorf("unexpected index %+v", idx)
+	}
+
+	for _, tc := range []struct {
+		indexes []config.Index
+		err     string
+	}{
+		{[]config.Index{{Method: "gin"}}, "columns are required"},
+		{[]config.Index{{Columns: []string{"ref"}}}, "unknown column ref"},
+		{[]config.Index{{Columns: []string{"name"}, Method: "rtree"}},
+			`unknown method "rtree" (btree, gist, gin, brin, hash or spgist)`},
+		{[]config.Index{{Columns: []string{"name", "type"}, Method: "hash"}},
+			"hash indexes only support a single column"},
+		{[]config.Index{{Columns: []string{"name"}}, {Columns: []string{"name"}, Where: "type = 'primary'"}},
+			"duplicate index roads_name_btree"},
+	} {
+		tbl := &config.Table{Name: "roads", Columns: columns, Indexes: tc.indexes}
+		if err := prepareIndexes(tbl); err == nil || err.Error() != tc.err {
+			t.Errorf("expected error %q, got %v", tc.err, err)
+		}
+	}
+}
@@ -1,10 +1,18 @@
 package mapping
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"strconv"
+	"strings"
 
 	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
 	"github.com/omniscale/imposm3/log"
 	"github.com/omniscale/imposm3/mapping/config"
 
@@ -15,15 +23,27 @@ import (
 type orderedDestTable struct {
 	DestTable
 	order int
+	// excluded values for __any__ mappings
+	excluded map[Value]struct{}
 }
 
 type TagTableMapping map[Key]map[Value][]orderedDestTable
 
+// addFromMapping adds all key/values of the mapping for table. Values with
+// a leading - are excluded from __any__ if the same key also maps
+// __any__, e.g. [__any__, -construction].
 func (tt TagTableMapping) addFromMapping(mapping config.KeyValues, table DestTable) {
 	for key, vals := range mapping {
+		excluded := excludedValues(vals)
 		for _, v := range vals {
-			vals, ok := tt[Key(key)]
+			if excluded != nil && strings.HasPrefix(string(v.Value), "-") {
+				continue
+			}
 			tbl := orderedDestTable{DestTable: table, order: v.Order}
+			if v.Value == "__any__" {
+				tbl.excluded = excluded
+			}
+			vals, ok := tt[Key(key)]
 			if ok {
 				vals[Value(v.Value)] = append(vals[Value(v.Value)], tbl)
 			} else {
@@ -34,6 +54,24 @@ func (tt TagTableMapping) addFromMapping(mapping config.KeyValues, table DestTab
 	}
 }
 
+// excludedValues returns all values with a leading - (without the -), if
+// vals contains __any__. Returns nil otherwise.
+func excludedValues(vals []config.OrderedValue) map[Value]struct{} {
+	if !findValueInOrderedValue("__any__", vals) {
+		return nil
+	}
+	var excluded map[Value]struct{}
+	for _, v := range vals {
+		if strings.HasPrefix(string(v.Value), "-") {
+			if excluded == nil {
+				excluded = make(map[Value]struct{})
+			}
+			excluded[Value(v.Value[1:])] = struct{}{}
+		}
+	}
+	return excluded
+}
+
 func (tt TagTableMapping) asTagMap() tagMap {
 	result := make(tagMap)
 	for k, vals := range tt {
@@ -81,43 +119,219 @@ const (
 	RelationMemberTable TableType = "relation_member"
 )
 
+// GeometryValidation defines how invalid polygons of a table are handled.
+type GeometryValidation string
+
+const (
+	// RepairGeometry repairs invalid polygons with a buffer(0).
+	RepairGeometry GeometryValidation = "repair"
+	// DropGeometry skips invalid polygons.
+	DropGeometry GeometryValidation = "drop"
+	// KeepGeometry inserts invalid polygons as they are.
+	KeepGeometry GeometryValidation = "keep"
+)
+
 type Mapping struct {
 	Conf                  config.Mapping
 	PointMatcher          NodeMatcher
 	LineStringMatcher     WayMatcher
 	PolygonMatcher        RelWayMatcher
 	RelationMatcher       RelationMatcher
-	RelationMemberMatcher RelationMatcher
+	RelationMemberMatcher RelationMemberMatcher
 }
 
 func FromFile(filename string) (*Mapping, error) {
+	if strings.HasPrefix(filename, BuiltinPrefix) {
+		return FromBuiltin(strings.TrimPrefix(filename, BuiltinPrefix))
+	}
 	b, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
+	if strings.ToLower(filepath.Ext(filename)) == ".toml" {
+		return NewTOML(b)
+	}
 	return New(b)
 }
 
+// FromBuiltin returns one of the mappings that are included in Imposm.
+func FromBuiltin(name string) (*Mapping, error) {
+	conf, ok := builtinMappings[name]
+	if !ok {
+		return nil, errors.Errorf("unknown builtin mapping %q", name)
+	}
+	return newFromConfig(conf())
+}
+
 func New(b []byte) (*Mapping, error) {
-	mapping := Mapping{}
-	err := yaml.Unmarshal(b, &mapping.Conf)
+	conf := config.Mapping{}
+	err := yaml.Unmarshal(b, &conf)
 	if err != nil {
 		return nil, err
 	}
+	return newFromConfig(conf)
+}
 
-	err = mapping.prepare()
+// NewTOML returns the mapping from a TOML document. TOML mappings have the
+// same structure as YAML mappings.
+func NewTOML(b []byte) (*Mapping, error) {
+	b, err := tomlToYAML(b)
 	if err != nil {
 		return nil, err
 	}
+	return New(b)
+}
 
-	err = mapping.createMatcher()
-	if err != nil {
+func newFromConfig(conf config.Mapping) (*Mapping, error) {
+	mapping := Mapping{Conf: conf}
+	if err := mapping.Validate(); err != nil {
 		return nil, err
 	}
 	return &mapping, nil
 }
 
+// IncludesUntaggedNodes returns whether any point table imports nodes
+// without tags.
+func (m *Mapping) IncludesUntaggedNodes() bool {
+	for _, t := range m.Conf.Tables {
+		if TableType(t.Type) == PointTable && t.IncludeUntagged {
+			return true
+		}
+	}
+	return false
+}
+
+// Checksum returns a SHA256 checksum of the mapping configuration. The
+// checksum does not change for formatting changes or comments, as it is
+// calculated from the parsed configuration. Options that are not set are
+// ignored, so that new options do not change the checksum of existing
+// mappings.
+// Descriptions are ignored as well, as they do not change the imported rows.
+func (m *Mapping) Checksum() (string, error) {
+	b, err := yaml.Marshal(m.Conf)
+	if err != nil {
+		return "", errors.Wrap(err, "serializing mapping for checksum")
+	}
+	var conf interface{}
+	if err := yaml.Unmarshal(b, &conf); err != nil {
+		return "", errors.Wrap(err, "serializing mapping for checksum")
+	}
+	removeDescriptions(conf)
+	pruneDefaults(reflect.ValueOf(m.Conf), conf)
+	b, err = yaml.Marshal(conf)
+	if err != nil {
+		return "", errors.Wrap(err, "serializing mapping for checksum")
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// removeDescriptions removes the descriptions of all tables and columns
+// from the serialized mapping.
+func removeDescriptions(conf interface{}) {
+	root, _ := conf.(map[interface{}]interface{})
+	for _, section := range []string{"tables", "table_templates", "generalized_tables"} {
+		tables, _ := root[section].(map[interface{}]interface{})
+		for _, t := range tables {
+			table, ok := t.(map[interface{}]interface{})
+			if !ok {
+				continue
+			}
+			delete(table, "description")
+			columns, _ := table["columns"].([]interface{})
+			for _, c := range columns {
+				if col, ok := c.(map[interface{}]interface{}); ok {
+					delete(col, "description")
+				}
+			}
+		}
+	}
+}
+
+// pruneDefaults removes all options from conf that are not set in v, with
+// conf as the parsed YAML of v. Only struct fields with their zero value
+// (and empty lists and maps) are removed, as this is the value of options
+// that are not set. Explicit values in lists, maps and column args are
+// kept, e.g. args with a false value.
+func pruneDefaults(v reflect.Value, conf interface{}) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		m, ok := conf.(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			if isDefaultValue(v.Field(i)) {
+				delete(m, name)
+				continue
+			}
+			pruneDefaults(v.Field(i), m[name])
+			if sub, ok := m[name].(map[interface{}]interface{}); ok && len(sub) == 0 && isStruct(f.Type) {
+				// e.g. filters: {}
+				delete(m, name)
+			}
+		}
+	case reflect.Map:
+		m, ok := conf.(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		for _, k := range v.MapKeys() {
+			var key interface{} = k.Interface()
+			if k.Kind() == reflect.String {
+				key = k.String()
+			}
+			pruneDefaults(v.MapIndex(k), m[key])
+		}
+	case reflect.Slice:
+		l, ok := conf.([]interface{})
+		if !ok || len(l) != v.Len() {
+			return
+		}
+		for i := range l {
+			pruneDefaults(v.Index(i), l[i])
+		}
+	}
+}
+
+func isDefaultValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
 func (m *Mapping) prepare() error {
+	if err := applyTableTemplates(&m.Conf); err != nil {
+		return err
+	}
+	if m.Conf.NormalizeValues {
+		normalizeConfigValues(&m.Conf)
+	}
 	for name, t := range m.Conf.Tables {
 		t.Name = name
 		if t.OldFields != nil {
@@ -133,10 +347,159 @@ func (m *Mapping) prepare() error {
 				return errors.Errorf("table with type:geometry requires type_mapping for table %s", name)
 			}
 		}
+
+		if t.RelationTypes != nil {
+			switch TableType(t.Type) {
+			case PolygonTable, GeometryTable, RelationTable, RelationMemberTable:
+			default:
+				return errors.Errorf("relation_types not supported for %s tables (table %s)", t.Type, name)
+			}
+		}
+
+		if t.MemberRoles != nil && TableType(t.Type) != RelationMemberTable {
+			return errors.Errorf("member_roles only supported for relation_member tables, not for %s", name)
+		}
+		if (t.MemberTypes != nil || t.MemberRolesRegexp != "") && TableType(t.Type) != RelationMemberTable {
+			return errors.Errorf("member_types and member_roles_regexp only supported for relation_member tables, not for %s", name)
+		}
+		for _, typ := range t.MemberTypes {
+			if _, ok := memberTypes[typ]; !ok {
+				return errors.Errorf("unknown member type %q in member_types of table %s, use node, way or relation", typ, name)
+			}
+		}
+		if t.MemberRolesRegexp != "" {
+			if _, err := regexp.Compile(t.MemberRolesRegexp); err != nil {
+				return errors.Wrapf(err, "member_roles_regexp of table %s", name)
+			}
+		}
+
+		if t.Filters != nil {
+			if err := checkGeomFilters(t.Filters, false); err != nil {
+				return errors.Wrapf(err, "filters of table %s", name)
+			}
+		}
+		for subName, sub := range t.Mappings {
+			if sub.Filters == nil {
+				continue
+			}
+			f := sub.Filters
+			if f.MinArea != 0 || f.MinLength != 0 || f.ClosedOnly {
+				return errors.Errorf("min_area, min_length and closed_only are not supported in filters of mapping %s of table %s", subName, name)
+			}
+			if err := checkGeomFilters(f, false); err != nil {
+				return errors.Wrapf(err, "filters of mapping %s of table %s", subName, name)
+			}
+		}
+		if t.Shard != nil {
+			if err := prepareShard(t); err != nil {
+				return errors.Wrapf(err, "shard of table %s", name)
+			}
+		}
+		if t.Partition != nil {
+			if err := preparePartition(t); err != nil {
+				return errors.Wrapf(err, "partition of table %s", name)
+			}
+		}
+		switch GeometryValidation(t.GeometryValidation) {
+		case "", RepairGeometry, DropGeometry, KeepGeometry:
+		default:
+			return errors.Errorf("unknown geometry_validation %q of table %s (repair, drop or keep)", t.GeometryValidation, name)
+		}
+		if t.SimplifyTolerance < 0 {
+			return errors.Errorf("negative simplify_tolerance of table %s", name)
+		}
+		switch t.Orientation {
+		case "", "counterclockwise", "clockwise":
+		default:
+			return errors.Errorf("unknown orientation %q of table %s (counterclockwise or clockwise)", t.Orientation, name)
+		}
+		if t.Boundary {
+			if TableType(t.Type) != PolygonTable {
+				return errors.Errorf("boundary only supported for polygon tables, not for %s", name)
+			}
+			if t.RelationTypes == nil {
+				t.RelationTypes = []string{"boundary"}
+			}
+		}
+		if t.RouteGeometry != nil {
+			if TableType(t.Type) != RelationTable {
+				return errors.Errorf("route_geometry only supported for relation tables, not for %s", name)
+			}
+			if t.RouteGeometry.GapTolerance < 0 {
+				return errors.Errorf("negative gap_tolerance in route_geometry of table %s", name)
+			}
+		}
+		if err := prepareIndexes(t); err != nil {
+			return errors.Wrapf(err, "indexes of table %s", name)
+		}
+	}
+
+	if err := prepareMaxTags(&m.Conf); err != nil {
+		return err
 	}
 
 	for name, t := range m.Conf.GeneralizedTables {
 		t.Name = name
+		for _, col := range t.Columns {
+			if col.Name == "" || col.SQL == "" {
+				return errors.Errorf("columns of generalized table %s require name and sql", name)
+			}
+		}
+	}
+	if err := m.checkAlsoInto(); err != nil {
+		return err
+	}
+	sorted, err := SortedGeneralizedTables(&m.Conf)
+	if err != nil {
+		return err
+	}
+	if err := checkMergedTables(&m.Conf, sorted); err != nil {
+		return err
+	}
+	return m.checkDeployGroups()
+}
+
+func (m *Mapping) checkAlsoInto() error {
+	for name, t := range m.Conf.Tables {
+		for _, rule := range t.AlsoInto {
+			target, ok := m.Conf.Tables[rule.Table]
+			if !ok {
+				return errors.Errorf("unknown table %s in also_into of table %s", rule.Table, name)
+			}
+			if target.Type != t.Type && TableType(target.Type) != GeometryTable {
+				return errors.Errorf("also_into of %s table %s requires %s or geometry table, not %s",
+					t.Type, name, t.Type, rule.Table)
+			}
+			if f := rule.Filters; f != nil {
+				if f.MinArea != 0 || f.MinLength != 0 || f.ClosedOnly {
+					return errors.Errorf("min_area, min_length and closed_only are not supported in also_into of table %s", name)
+				}
+				if err := checkGeomFilters(f, false); err != nil {
+					return errors.Wrapf(err, "also_into of table %s", name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Mapping) checkDeployGroups() error {
+	grouped := make(map[string]string)
+	for _, g := range m.Conf.DeployGroups {
+		if g.Name == "" {
+			return errors.New("missing name for deploy group")
+		}
+		for _, name := range g.Tables {
+			_, isTable := m.Conf.Tables[name]
+			_, isGeneralized := m.Conf.GeneralizedTables[name]
+			if !isTable && !isGeneralized {
+				return errors.Errorf("unknown table %s in deploy group %s", name, g.Name)
+			}
+			if other, ok := grouped[name]; ok {
+				return errors.Errorf("table %s in deploy groups %s and %s", name, other, g.Name)
+			}
+			grouped[name] = g.Name
+		}
 	}
 	return nil
 }
@@ -209,17 +572,94 @@ func makeRowBuilder(tbl *config.Table) (*rowBuilder, error) {
 	for _, mappingColumn := range tbl.Columns {
 		column := valueBuilder{}
 		column.key = Key(mappingColumn.Key)
+		for _, k := range mappingColumn.Keys {
+			column.keys = append(column.keys, Key(k))
+		}
+		// only string defaults, other types use default in args for their own purposes
+		if defaultValue, ok := mappingColumn.Args["default"].(string); ok {
+			column.defaultValue = defaultValue
+		}
 
 		columnType, err := MakeColumnType(mappingColumn)
 		if err != nil {
 			return nil, errors.Wrapf(err, "creating column %s", mappingColumn.Name)
 		}
 		column.colType = *columnType
+		if columnType.Name == "member_node_point" || columnType.Name == "member_node_id" {
+			result.memberNodes = true
+		}
+		if columnType.GoType == "geometry" || columnType.GoType == "validated_geometry" {
+			column.colType.Func = geometryFunc(tbl, column.colType.Func)
+		}
 		result.columns = append(result.columns, column)
 	}
+	if tbl.Filters != nil {
+		result.geomFilters = makeGeomFilters(tbl.Filters)
+	}
+	result.geomValidation = GeometryValidation(tbl.GeometryValidation)
+	if result.geomValidation == "" {
+		result.geomValidation = RepairGeometry
+	}
+	result.routeGeometry = tbl.RouteGeometry
+	result.boundary = tbl.Boundary
 	return &result, nil
 }
 
+// geometryFunc returns the function for the geometry columns of tbl, with
+// the simplification and the orientation of the table.
+func geometryFunc(tbl *config.Table, f MakeValue) MakeValue {
+	key := "wkb"
+	if tbl.SimplifyTolerance > 0 {
+		f, key = simplifiedGeometry(tbl.SimplifyTolerance, tbl.SimplifyPreserveTopology)
+	}
+	if tbl.Orientation != "" {
+		f = orientedGeometry(tbl.Orientation == "counterclockwise", f, key)
+	}
+	return f
+}
+
+func makeGeomFilters(f *config.Filters) []geomFilter {
+	var filters []geomFilter
+	if f.MinArea > 0 {
+		filters = append(filters, func(g *geom.Geometry) bool {
+			return g.Area() >= f.MinArea
+		})
+	}
+	if f.MinLength > 0 {
+		filters = append(filters, func(g *geom.Geometry) bool {
+			return g.Length() >= f.MinLength
+		})
+	}
+	if f.ClosedOnly {
+		filters = append(filters, func(g *geom.Geometry) bool {
+			return g.Geom.IsClosed()
+		})
+	}
+	return filters
+}
+
+// checkGeomFilters checks that geometry filters are not used in nested
+// filters, as they are evaluated after the tag filters.
+func checkGeomFilters(f *config.Filters, nested bool) error {
+	if nested && (f.MinArea != 0 || f.MinLength != 0 || f.ClosedOnly) {
+		return errors.New("min_area, min_length and closed_only are not supported in all, any or not filters")
+	}
+	for i := range f.All {
+		if err := checkGeomFilters(&f.All[i], true); err != nil {
+			return err
+		}
+	}
+	for i := range f.Any {
+		if err := checkGeomFilters(&f.Any[i], true); err != nil {
+			return err
+		}
+	}
+	if f.Not != nil {
+		return checkGeomFilters(f.Not, true)
+	}
+	return nil
+}
+
 func MakeColumnType(c *config.Column) (*ColumnType, error) {
 	columnType, ok := AvailableColumnTypes[c.Type]
 	if !ok {
@@ -231,7 +671,7 @@ func MakeColumnType(c *config.Column) (*ColumnType, error) {
 		if err != nil {
 			return nil, err
 		}
-		columnType = ColumnType{columnType.Name, columnType.GoType, makeValue, nil, nil, columnType.FromMember}
+		columnType = ColumnType{columnType.Name, columnType.GoType, makeValue, nil, nil, columnType.FromMember, columnType.FromGeometry}
 	}
 	columnType.FromMember = c.FromMember
 	return &columnType, nil
@@ -250,11 +690,32 @@ func (m *Mapping) extraTags(tableType TableType, tags map[Key]bool) {
 			for _, k := range col.Keys {
 				tags[Key(k)] = true
 			}
+			if col.Type == "localized_name" {
+				for _, k := range localizedNameKeys(*col) {
+					tags[Key(k)] = true
+				}
+			}
+			if col.Type == "admin_level" && col.Key == "" {
+				tags["admin_level"] = true
+			}
+			if col.Type == "disputed" {
+				for _, k := range disputedKeys {
+					tags[k] = true
+				}
+			}
 		}
 
-		if t.Filters != nil && t.Filters.ExcludeTags != nil {
-			for _, keyVal := range *t.Filters.ExcludeTags {
-				tags[Key(keyVal[0])] = true
+		if t.Filters != nil {
+			addFilterKeys(t.Filters, tags)
+		}
+		for _, sub := range t.Mappings {
+			if sub.Filters != nil {
+				addFilterKeys(sub.Filters, tags)
+			}
+		}
+		for _, rule := range t.AlsoInto {
+			if rule.Filters != nil {
+				addFilterKeys(rule.Filters, tags)
 			}
 		}
 
@@ -361,51 +822,260 @@ func (m *Mapping) addRelationFilters(tableType TableType, filters tableElementFi
 	}
 }
 
+type memberFilter func(member *osm.Member) bool
+
+var memberTypes = map[string]osm.MemberType{
+	"node":     osm.NodeMember,
+	"way":      osm.WayMember,
+	"relation": osm.RelationMember,
+}
+
+type tableMemberFilters map[string][]memberFilter
+
+func (m *Mapping) addMemberFilters(tableType TableType, filters tableMemberFilters) {
+	for name, t := range m.Conf.Tables {
+		if TableType(t.Type) != tableType {
+			continue
+		}
+		if t.MemberRoles != nil {
+			roles := make(map[string]struct{}, len(t.MemberRoles))
+			for _, role := range t.MemberRoles {
+				roles[role] = struct{}{}
+			}
+			f := func(member *osm.Member) bool {
+				_, ok := roles[member.Role]
+				return ok
+			}
+			filters[name] = append(filters[name], f)
+		}
+		if t.MemberTypes != nil {
+			types := make(map[osm.MemberType]struct{}, len(t.MemberTypes))
+			for _, typ := range t.MemberTypes {
+				types[memberTypes[typ]] = struct{}{}
+			}
+			f := func(member *osm.Member) bool {
+				_, ok := types[member.Type]
+				return ok
+			}
+			filters[name] = append(filters[name], f)
+		}
+		if t.MemberRolesRegexp != "" {
+			r := regexp.MustCompile(t.MemberRolesRegexp)
+			f := func(member *osm.Member) bool {
+				return r.MatchString(member.Role)
+			}
+			filters[name] = append(filters[name], f)
+		}
+	}
+}
+
 func (m *Mapping) addFilters(filters tableElementFilters) {
 	for name, t := range m.Conf.Tables {
 		if t.Filters == nil {
 			continue
 		}
-		if t.Filters.ExcludeTags != nil {
-			log.Println("[warn]: exclude_tags filter is deprecated and will be removed. See require and reject filter.")
-			for _, filterKeyVal := range *t.Filters.ExcludeTags {
-				// Convert `exclude_tags`` filter to `reject` filter !
-				keyname := filterKeyVal[0]
-				vararr := []config.OrderedValue{
-					{
-						Value: config.Value(filterKeyVal[1]),
-						Order: 1,
-					},
-				}
-				filters[name] = append(filters[name], makeFiltersFunction(name, false, true, keyname, vararr))
+		filters[name] = append(filters[name], makeFilters(name, t.Filters)...)
+	}
+}
+
+type alsoIntoRule struct {
+	table   string
+	filters []elementFilter
+}
 
+// alsoIntoRules returns the also_into rules of all tables.
+func (m *Mapping) alsoIntoRules() map[string][]alsoIntoRule {
+	rules := make(map[string][]alsoIntoRule)
+	for name, t := range m.Conf.Tables {
+		for _, r := range t.AlsoInto {
+			rule := alsoIntoRule{table: r.Table}
+			if r.Filters != nil {
+				rule.filters = makeFilters(name, r.Filters)
 			}
+			rules[name] = append(rules[name], rule)
 		}
+	}
+	return rules
+}
 
-		if t.Filters.Require != nil {
-			for keyname, vararr := range t.Filters.Require {
-				filters[name] = append(filters[name], makeFiltersFunction(name, true, false, string(keyname), vararr))
+// subMappingFilters returns the filters of all sub-mappings with filters.
+func (m *Mapping) subMappingFilters() map[DestTable][]elementFilter {
+	filters := make(map[DestTable][]elementFilter)
+	for name, t := range m.Conf.Tables {
+		for subName, sub := range t.Mappings {
+			if sub.Filters == nil {
+				continue
 			}
+			filters[DestTable{Name: name, SubMapping: subName}] = makeFilters(name, sub.Filters)
 		}
+	}
+	return filters
+}
 
-		if t.Filters.Reject != nil {
-			for keyname, vararr := range t.Filters.Reject {
-				filters[name] = append(filters[name], makeFiltersFunction(name, false, true, string(keyname), vararr))
+// makeFilters returns the filters for all conditions of f. All returned
+// filters need to match.
+func makeFilters(name string, f *config.Filters) []elementFilter {
+	var filters []elementFilter
+	if f.ExcludeTags != nil {
+		log.Println("[warn]: exclude_tags filter is deprecated and will be removed. See require and reject filter.")
+		for _, filterKeyVal := range *f.ExcludeTags {
+			// Convert `exclude_tags`` filter to `reject` filter !
+			keyname := filterKeyVal[0]
+			vararr := []config.OrderedValue{
+				{
+					Value: config.Value(filterKeyVal[1]),
+					Order: 1,
+				},
 			}
+			filters = append(filters, makeFiltersFunction(name, false, true, keyname, vararr))
+
 		}
+	}
 
-		if t.Filters.RequireRegexp != nil {
-			for keyname, regexp := range t.Filters.RequireRegexp {
-				filters[name] = append(filters[name], makeRegexpFiltersFunction(name, true, false, string(keyname), regexp))
-			}
+	if f.Require != nil {
+		for keyname, vararr := range f.Require {
+			filters = append(filters, makeFiltersFunction(name, true, false, string(keyname), vararr))
 		}
+	}
 
-		if t.Filters.RejectRegexp != nil {
-			for keyname, regexp := range t.Filters.RejectRegexp {
-				filters[name] = append(filters[name], makeRegexpFiltersFunction(name, false, true, string(keyname), regexp))
+	if f.Reject != nil {
+		for keyname, vararr := range f.Reject {
+			filters = append(filters, makeFiltersFunction(name, false, true, string(keyname), vararr))
+		}
+	}
+
+	if f.RequireRegexp != nil {
+		for keyname, regexp := range f.RequireRegexp {
+			filters = append(filters, makeRegexpFiltersFunction(name, true, false, string(keyname), regexp))
+		}
+	}
+
+	if f.RejectRegexp != nil {
+		for keyname, regexp := range f.RejectRegexp {
+			filters = append(filters, makeRegexpFiltersFunction(name, false, true, string(keyname), regexp))
+		}
+	}
+
+	for keyname, threshold := range f.RequireGte {
+		threshold := threshold
+		filters = append(filters, makeCompareFiltersFunction(string(keyname), func(v float64) bool { return v >= threshold }))
+	}
+	for keyname, threshold := range f.RequireGt {
+		threshold := threshold
+		filters = append(filters, makeCompareFiltersFunction(string(keyname), func(v float64) bool { return v > threshold }))
+	}
+	for keyname, threshold := range f.RequireLte {
+		threshold := threshold
+		filters = append(filters, makeCompareFiltersFunction(string(keyname), func(v float64) bool { return v <= threshold }))
+	}
+	for keyname, threshold := range f.RequireLt {
+		threshold := threshold
+		filters = append(filters, makeCompareFiltersFunction(string(keyname), func(v float64) bool { return v < threshold }))
+	}
+
+	if len(f.RequireAnyKey) > 0 {
+		keys := f.RequireAnyKey
+		filters = append(filters, func(tags osm.Tags, key Key, closed bool) bool {
+			for _, k := range keys {
+				if _, ok := tags[string(k)]; ok {
+					return true
+				}
+			}
+			return false
+		})
+	}
+
+	if len(f.RejectAllKeys) > 0 {
+		keys := f.RejectAllKeys
+		filters = append(filters, func(tags osm.Tags, key Key, closed bool) bool {
+			for _, k := range keys {
+				if _, ok := tags[string(k)]; !ok {
+					return true
+				}
 			}
+			return false
+		})
+	}
+
+	for i := range f.All {
+		filters = append(filters, makeFilters(name, &f.All[i])...)
+	}
+
+	if len(f.Any) > 0 {
+		anyFilters := make([]elementFilter, len(f.Any))
+		for i := range f.Any {
+			anyFilters[i] = allFilter(makeFilters(name, &f.Any[i]))
 		}
+		filters = append(filters, func(tags osm.Tags, key Key, closed bool) bool {
+			for _, f := range anyFilters {
+				if f(tags, key, closed) {
+					return true
+				}
+			}
+			return false
+		})
+	}
 
+	if f.Not != nil {
+		notFilter := allFilter(makeFilters(name, f.Not))
+		filters = append(filters, func(tags osm.Tags, key Key, closed bool) bool {
+			return !notFilter(tags, key, closed)
+		})
+	}
+	return filters
+}
+
+// addFilterKeys adds the keys of all (nested) filter conditions to tags.
+func addFilterKeys(f *config.Filters, tags map[Key]bool) {
+	if f.ExcludeTags != nil {
+		for _, keyVal := range *f.ExcludeTags {
+			tags[Key(keyVal[0])] = true
+		}
+	}
+	for k := range f.Require {
+		tags[Key(k)] = true
+	}
+	for k := range f.Reject {
+		tags[Key(k)] = true
+	}
+	for k := range f.RequireRegexp {
+		tags[Key(k)] = true
+	}
+	for k := range f.RejectRegexp {
+		tags[Key(k)] = true
+	}
+	for _, k := range f.RequireAnyKey {
+		tags[Key(k)] = true
+	}
+	for _, k := range f.RejectAllKeys {
+		tags[Key(k)] = true
+	}
+	for _, kn := range []config.KeyNumber{f.RequireGte, f.RequireGt, f.RequireLte, f.RequireLt} {
+		for k := range kn {
+			tags[Key(k)] = true
+		}
+	}
+	for i := range f.All {
+		addFilterKeys(&f.All[i], tags)
+	}
+	for i := range f.Any {
+		addFilterKeys(&f.Any[i], tags)
+	}
+	if f.Not != nil {
+		addFilterKeys(f.Not, tags)
+	}
+}
+
+// allFilter combines filters into a single filter that requires all
+// filters to match.
+func allFilter(filters []elementFilter) elementFilter {
+	return func(tags osm.Tags, key Key, closed bool) bool {
+		for _, f := range filters {
+			if !f(tags, key, closed) {
+				return false
+			}
+		}
+		return true
 	}
 }
 
@@ -431,10 +1101,36 @@ func makeRegexpFiltersFunction(tablename string, virtualTrue bool, virtualFalse
 	}
 }
 
+// makeCompareFiltersFunction returns a filter that parses the value of
+// vKeyname as a number and checks it with cmp. Missing or non-numeric values
+// do not match.
+func makeCompareFiltersFunction(vKeyname string, cmp func(float64) bool) func(tags osm.Tags, key Key, closed bool) bool {
+	return func(tags osm.Tags, key Key, closed bool) bool {
+		v, ok := tags[vKeyname]
+		if !ok {
+			return false
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsNaN(f) {
+			return false
+		}
+		return cmp(f)
+	}
+}
+
 func makeFiltersFunction(tablename string, virtualTrue bool, virtualFalse bool, vKeyname string, vVararr []config.OrderedValue) func(tags osm.Tags, key Key, closed bool) bool {
 
-	if findValueInOrderedValue("__nil__", vVararr) { // check __nil__
-		log.Println("[warn] Filter value '__nil__' is not supported ! (tablename:" + tablename + ")")
+	// __nil__ matches elements without this key
+	matchNil := false
+	if findValueInOrderedValue("__nil__", vVararr) {
+		matchNil = true
+		var values []config.OrderedValue
+		for _, v := range vVararr {
+			if v.Value != "__nil__" {
+				values = append(values, v)
+			}
+		}
+		vVararr = values
 	}
 
 	if findValueInOrderedValue("__any__", vVararr) { // check __any__
@@ -442,7 +1138,14 @@ func makeFiltersFunction(tablename string, virtualTrue bool, virtualFalse bool,
 			log.Println("[warn] Multiple filter value with '__any__' keywords is not valid! (tablename:" + tablename + ")")
 		}
 		return func(tags osm.Tags, key Key, closed bool) bool {
-			if _, ok := tags[vKeyname]; ok {
+			if _, ok := tags[vKeyname]; ok || matchNil {
+				return virtualTrue
+			}
+			return virtualFalse
+		}
+	} else if len(vVararr) == 0 { // only __nil__
+		return func(tags osm.Tags, key Key, closed bool) bool {
+			if _, ok := tags[vKeyname]; !ok {
 				return virtualTrue
 			}
 			return virtualFalse
@@ -453,6 +1156,8 @@ func makeFiltersFunction(tablename string, virtualTrue bool, virtualFalse bool,
 				if config.Value(v) == vVararr[0].Value {
 					return virtualTrue
 				}
+			} else if matchNil {
+				return virtualTrue
 			}
 			return virtualFalse
 		}
@@ -462,6 +1167,8 @@ func makeFiltersFunction(tablename string, virtualTrue bool, virtualFalse bool,
 				if findValueInOrderedValue(config.Value(v), vVararr) {
 					return virtualTrue
 				}
+			} else if matchNil {
+				return virtualTrue
 			}
 			return virtualFalse
 		}
@@ -0,0 +1,523 @@
+package mapping
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	osm "github.com/omniscale/go-osm"
+)
+
+func TestDeployGroups(t *testing.T) {
+	tables := `
+    tables:
+      roads:
+        type: linestring
+        mapping:
+          highway: [__any__]
+      buildings:
+        type: polygon
+        mapping:
+          building: [__any__]
+    generalized_tables:
+      roads_gen0:
+        source: roads
+        tolerance: 100
+    deploy_groups:`
+
+	for _, tc := range []struct {
+		groups string
+		err    string
+	}{
+		{`
+      - name: roads
+        tables: [roads, roads_gen0]
+      - name: buildings
+        tables: [buildings]
+`, ""},
+		{`
+      - tables: [roads]
+`, "missing name for deploy group"},
+		{`
+      - name: roads
+        tables: [roads, unknown]
+`, "unknown table unknown in deploy group roads"},
+		{`
+      - name: roads
+        tables: [roads]
+      - name: all
+        tables: [roads, buildings]
+`, "table roads in deploy groups roads and all"},
+	} {
+		_, err := New([]byte(tables + tc.groups))
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestGeomFilters(t *testing.T) {
+	tables := `
+    tables:
+      buildings:
+        type: polygon
+        mapping:
+          building: [__any__]
+        filters:`
+
+	for _, tc := range []struct {
+		filters string
+		err     string
+	}{
+		{`
+          min_area: 10
+          closed_only: true
+`, ""},
+		{`
+          any:
+            - min_area: 10
+            - require:
+                name: [__any__]
+`, "filters of table buildings: min_area, min_length and closed_only are not supported"},
+		{`
+          not:
+            closed_only: true
+`, "not supported in all, any or not filters"},
+	} {
+		m, err := New([]byte(tables + tc.filters))
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+				continue
+			}
+			if n := len(m.PolygonMatcher.(*tagMatcher).tables["buildings"].geomFilters); n != 2 {
+				t.Errorf("expected 2 geometry filters, got %d", n)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestElementLists(t *testing.T) {
+	m, err := New([]byte(`
+    use_single_id_space: true
+    tables:
+      roads:
+        type: linestring
+        mapping:
+          highway: [__any__]
+        filters:
+          reject:
+            access: [private]
+    skip_elements:
+      ways: [1]
+    force_elements:
+      ways: [2]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		id      int64
+		tags    osm.Tags
+		matches int
+	}{
+		{1, osm.Tags{"highway": "primary"}, 0},
+		{-1, osm.Tags{"highway": "primary"}, 0},
+		{2, osm.Tags{"highway": "primary", "access": "private"}, 1},
+		{-2, osm.Tags{"highway": "primary", "access": "private"}, 1},
+		{2, osm.Tags{"building": "yes"}, 0},
+		{3, osm.Tags{"highway": "primary", "access": "private"}, 0},
+		{3, osm.Tags{"highway": "primary"}, 1},
+	} {
+		way := &osm.Way{Element: osm.Element{ID: tc.id, Tags: tc.tags}, Refs: []int64{1, 2}}
+		if n := len(m.LineStringMatcher.MatchWay(way)); n != tc.matches {
+			t.Errorf("unexpected number of matches for %d %v: %d", tc.id, tc.tags, n)
+		}
+	}
+}
+
+func TestTableTemplates(t *testing.T) {
+	m, err := New([]byte(`
+    table_templates:
+      base:
+        columns:
+        - {name: osm_id, type: id}
+        - {name: geometry, type: geometry}
+        - {name: name, type: string, key: name}
+      named_lines:
+        extends: base
+        type: linestring
+        filters:
+          require:
+            name: [__any__]
+    tables:
+      roads:
+        extends: named_lines
+        columns:
+        - {name: name, type: string, key: "name:en"}
+        - {name: type, type: mapping_value}
+        mapping:
+          highway: [__any__]
+      buildings:
+        extends: base
+        type: polygon
+        mapping:
+          building: [__any__]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roads := m.Conf.Tables["roads"]
+	if roads.Type != "linestring" {
+		t.Errorf("unexpected type %s", roads.Type)
+	}
+	var columns []string
+	for _, c := range roads.Columns {
+		columns = append(columns, c.Name+":"+string(c.Key))
+	}
+	if s := strings.Join(columns, " "); s != "osm_id: geometry: name:name:en type:" {
+		t.Errorf("unexpected columns %s", s)
+	}
+	if roads.Filters == nil || roads.Filters.Require == nil {
+		t.Error("missing filters")
+	}
+	if b := m.Conf.Tables["buildings"]; b.Filters != nil || len(b.Columns) != 3 {
+		t.Errorf("unexpected buildings table %+v", b)
+	}
+
+	for _, tc := range []struct {
+		templates string
+		err       string
+	}{
+		{`
+      a: {extends: b}
+      b: {extends: a}
+`, "cycle in table templates: b -> a -> b"},
+		{`
+      b: {extends: unknown}
+`, "unknown table template unknown"},
+	} {
+		_, err := New([]byte(`
+    tables:
+      roads:
+        extends: b
+        type: linestring
+        mapping:
+          highway: [__any__]
+    table_templates:` + tc.templates))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestAlsoInto(t *testing.T) {
+	m, err := New([]byte(`
+    tables:
+      admin:
+        type: linestring
+        mapping:
+          boundary: [administrative]
+        also_into:
+        - table: boundaries
+          filters:
+            require:
+              admin_level: ["2", "4"]
+        - table: all_lines
+      boundaries:
+        type: linestring
+      all_lines:
+        type: geometry
+        type_mappings:
+          linestrings:
+            highway: [__any__]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		tags   osm.Tags
+		tables []string
+	}{
+		{osm.Tags{"boundary": "administrative", "admin_level": "2"}, []string{"admin", "all_lines", "boundaries"}},
+		{osm.Tags{"boundary": "administrative", "admin_level": "8"}, []string{"admin", "all_lines"}},
+		{osm.Tags{"boundary": "administrative", "highway": "track"}, []string{"admin", "all_lines"}},
+		{osm.Tags{"highway": "track", "admin_level": "2"}, []string{"all_lines"}},
+	} {
+		way := &osm.Way{Element: osm.Element{ID: 1, Tags: tc.tags}, Refs: []int64{1, 2}}
+		var tables []string
+		for _, match := range m.LineStringMatcher.MatchWay(way) {
+			tables = append(tables, match.Table.Name)
+		}
+		sort.Strings(tables)
+		if strings.Join(tables, " ") != strings.Join(tc.tables, " ") {
+			t.Errorf("unexpected tables for %v: %v", tc.tags, tables)
+		}
+	}
+
+	_, err = New([]byte(`
+    tables:
+      admin:
+        type: linestring
+        mapping:
+          boundary: [administrative]
+        also_into:
+        - table: boundaries
+      boundaries:
+        type: polygon
+`))
+	if err == nil || !strings.Contains(err.Error(), "also_into of linestring table admin requires linestring or geometry table, not boundaries") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestGeometryValidation(t *testing.T) {
+	m, err := New([]byte(`
+    tables:
+      buildings:
+        type: polygon
+        geometry_validation: drop
+        mapping:
+          building: [__any__]
+      landuse:
+        type: polygon
+        mapping:
+          building: [__any__]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	way := &osm.Way{Element: osm.Element{ID: 1, Tags: osm.Tags{"building": "yes"}}, Refs: []int64{1, 2, 3, 1}}
+	validations := map[string]GeometryValidation{}
+	for _, match := range m.PolygonMatcher.MatchWay(way) {
+		validations[match.Table.Name] = match.GeometryValidation()
+	}
+	if validations["buildings"] != DropGeometry || validations["landuse"] != RepairGeometry {
+		t.Errorf("unexpected geometry validations %v", validations)
+	}
+
+	_, err = New([]byte(`
+    tables:
+      buildings:
+        type: polygon
+        geometry_validation: fix
+        mapping:
+          building: [__any__]
+`))
+	if err == nil || err.Error() != `unknown geometry_validation "fix" of table buildings (repair, drop or keep)` {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestRouteGeometry(t *testing.T) {
+	m, err := New([]byte(`
+    tables:
+      routes:
+        type: relation
+        route_geometry:
+          roles: ['', forward, backward]
+          gap_tolerance: 10
+        relation_types: [route]
+        mapping:
+          route: [hiking]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel := &osm.Relation{Element: osm.Element{ID: 1, Tags: osm.Tags{"type": "route", "route": "hiking"}}}
+	matches := m.RelationMatcher.MatchRelation(rel)
+	if len(matches) != 1 {
+		t.Fatalf("unexpected matches %v", matches)
+	}
+	route := matches[0].RouteGeometry()
+	if route == nil || route.GapTolerance != 10 || len(route.Roles) != 3 {
+		t.Errorf("unexpected route geometry %v", route)
+	}
+
+	_, err = New([]byte(`
+    tables:
+      routes:
+        type: linestring
+        route_geometry: {}
+        mapping:
+          route: [hiking]
+`))
+	if err == nil || err.Error() != `route_geometry only supported for relation tables, not for routes` {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestBoundary(t *testing.T) {
+	m, err := New([]byte(`
+    tables:
+      admin:
+        type: polygon
+        boundary: true
+        mapping:
+          boundary: [administrative]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel := &osm.Relation{Element: osm.Element{ID: 1, Tags: osm.Tags{"type": "boundary", "boundary": "administrative"}}}
+	matches := m.PolygonMatcher.MatchRelation(rel)
+	if len(matches) != 1 || !matches[0].Boundary() {
+		t.Errorf("unexpected matches %v", matches)
+	}
+	rel.Tags["type"] = "multipolygon"
+	if matches := m.PolygonMatcher.MatchRelation(rel); len(matches) != 0 {
+		t.Errorf("unexpected matches for multipolygon %v", matches)
+	}
+
+	_, err = New([]byte(`
+    tables:
+      admin:
+        type: linestring
+        boundary: true
+        mapping:
+          boundary: [administrative]
+`))
+	if err == nil || err.Error() != `boundary only supported for polygon tables, not for admin` {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	m, err := New([]byte(`
+    tables:
+      roads:
+        type: linestring
+        columns:
+        - name: name
+          type: string
+          key: name
+        - name: geometry
+          type: geometry
+        mapping:
+          highway: [__any__]
+        filters:
+          reject:
+            area: ["yes"]
+          require:
+            name: [__any__]
+        also_into:
+        - table: names
+      names:
+        type: linestring
+        columns:
+        - name: type
+          type: mapping_value
+      areas:
+        type: polygon
+        mapping:
+          highway: [pedestrian]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explanations, err := m.Explain("way", osm.Tags{"highway": "pedestrian", "name": "Foo"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(explanations) != 2 {
+		t.Fatalf("unexpected explanations %#v", explanations)
+	}
+	e := explanations[0]
+	if e.Table.Name != "roads" || !e.Matched || e.AlsoInto || len(e.Conditions) != 2 {
+		t.Errorf("unexpected explanation %#v", e)
+	}
+	if len(e.Columns) != 2 || e.Columns[0].Value != "Foo" || !e.Columns[1].Geometry {
+		t.Errorf("unexpected columns %#v", e.Columns)
+	}
+	for name, ct := range AvailableColumnTypes {
+		if strings.HasSuffix(ct.GoType, "geometry") && !ct.FromGeometry {
+			t.Errorf("geometry column type %s not marked as FromGeometry", name)
+		}
+	}
+	e = explanations[1]
+	if e.Table.Name != "names" || !e.Matched || !e.AlsoInto || e.Columns[0].Value != "pedestrian" {
+		t.Errorf("unexpected explanation %#v", e)
+	}
+
+	explanations, err = m.Explain("way", osm.Tags{"highway": "pedestrian", "area": "yes", "name": "Foo"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []string
+	for _, e := range explanations {
+		results = append(results, fmt.Sprintf("%s %s %v", e.Geometry, e.Table.Name, e.Matched))
+		for _, c := range e.Conditions {
+			results = append(results, fmt.Sprintf("%s %v", c.Condition, c.Passed))
+		}
+	}
+	expected := []string{
+		"polygon areas true",
+	}
+	if strings.Join(results, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected results:\n%s", strings.Join(results, "\n"))
+	}
+
+	explanations, err = m.Explain("way", osm.Tags{"highway": "pedestrian", "area": "yes"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = nil
+	for _, e := range explanations {
+		results = append(results, fmt.Sprintf("%s %s %v", e.Geometry, e.Table.Name, e.Matched))
+		for _, c := range e.Conditions {
+			results = append(results, fmt.Sprintf("%s %v", c.Condition, c.Passed))
+		}
+	}
+	expected = []string{
+		"linestring roads false",
+		"require name: [__any__] false",
+		"reject area: [yes] false",
+	}
+	if strings.Join(results, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected results:\n%s", strings.Join(results, "\n"))
+	}
+
+	if _, err := m.Explain("changeset", nil, false); err == nil {
+		t.Error("expected error for unknown element type")
+	}
+}
+
+func TestMatchMemberNodes(t *testing.T) {
+	m, err := New([]byte(`
+    tables:
+      admin:
+        type: polygon
+        columns:
+          - {name: osm_id, type: id}
+          - {name: geometry, type: geometry}
+          - {name: admin_centre, type: member_node_point, args: {role: admin_centre}}
+        mapping:
+          boundary: [administrative]
+      landuse:
+        type: polygon
+        columns:
+          - {name: osm_id, type: id}
+          - {name: geometry, type: geometry}
+        mapping:
+          boundary: [administrative]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel := &osm.Relation{Element: osm.Element{ID: 1, Tags: osm.Tags{"type": "multipolygon", "boundary": "administrative"}}}
+	memberNodes := map[string]bool{}
+	for _, match := range m.PolygonMatcher.MatchRelation(rel) {
+		memberNodes[match.Table.Name] = match.MemberNodes()
+	}
+	if len(memberNodes) != 2 || !memberNodes["admin"] || memberNodes["landuse"] {
+		t.Errorf("unexpected member nodes %v", memberNodes)
+	}
+}
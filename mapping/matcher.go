@@ -3,6 +3,7 @@ package mapping
 import (
 	osm "github.com/omniscale/go-osm"
 	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping/config"
 )
 
 func (m *Mapping) pointMatcher() (NodeMatcher, error) {
@@ -12,11 +13,23 @@ func (m *Mapping) pointMatcher() (NodeMatcher, error) {
 	m.addFilters(filters)
 	m.addTypedFilters(PointTable, filters)
 	tables, err := m.tables(PointTable)
+	var untagged []DestTable
+	for name, t := range m.Conf.Tables {
+		if TableType(t.Type) == PointTable && t.IncludeUntagged {
+			untagged = append(untagged, DestTable{Name: name})
+		}
+	}
 	return &tagMatcher{
 		mappings:   mappings,
 		filters:    filters,
 		tables:     tables,
+		untagged:   untagged,
 		matchAreas: false,
+
+		subMappingFilters: m.subMappingFilters(),
+		alsoInto:          m.alsoIntoRules(),
+		normalizeValues:   m.Conf.NormalizeValues,
+		elements:          newElementLists(&m.Conf),
 	}, err
 }
 
@@ -32,6 +45,11 @@ func (m *Mapping) lineStringMatcher() (WayMatcher, error) {
 		filters:    filters,
 		tables:     tables,
 		matchAreas: false,
+
+		subMappingFilters: m.subMappingFilters(),
+		alsoInto:          m.alsoIntoRules(),
+		normalizeValues:   m.Conf.NormalizeValues,
+		elements:          newElementLists(&m.Conf),
 	}, err
 }
 
@@ -50,6 +68,11 @@ func (m *Mapping) polygonMatcher() (RelWayMatcher, error) {
 		tables:     tables,
 		relFilters: relFilters,
 		matchAreas: true,
+
+		subMappingFilters: m.subMappingFilters(),
+		alsoInto:          m.alsoIntoRules(),
+		normalizeValues:   m.Conf.NormalizeValues,
+		elements:          newElementLists(&m.Conf),
 	}, err
 }
 
@@ -69,10 +92,15 @@ func (m *Mapping) relationMatcher() (RelationMatcher, error) {
 		tables:     tables,
 		relFilters: relFilters,
 		matchAreas: true,
+
+		subMappingFilters: m.subMappingFilters(),
+		alsoInto:          m.alsoIntoRules(),
+		normalizeValues:   m.Conf.NormalizeValues,
+		elements:          newElementLists(&m.Conf),
 	}, err
 }
 
-func (m *Mapping) relationMemberMatcher() (RelationMatcher, error) {
+func (m *Mapping) relationMemberMatcher() (RelationMemberMatcher, error) {
 	mappings := make(TagTableMapping)
 	m.mappings(RelationMemberTable, mappings)
 	filters := make(tableElementFilters)
@@ -80,13 +108,21 @@ func (m *Mapping) relationMemberMatcher() (RelationMatcher, error) {
 	m.addTypedFilters(RelationMemberTable, filters)
 	relFilters := make(tableElementFilters)
 	m.addRelationFilters(RelationMemberTable, relFilters)
+	memberFilters := make(tableMemberFilters)
+	m.addMemberFilters(RelationMemberTable, memberFilters)
 	tables, err := m.tables(RelationMemberTable)
 	return &tagMatcher{
-		mappings:   mappings,
-		filters:    filters,
-		tables:     tables,
-		relFilters: relFilters,
-		matchAreas: true,
+		mappings:      mappings,
+		filters:       filters,
+		tables:        tables,
+		relFilters:    relFilters,
+		memberFilters: memberFilters,
+		matchAreas:    true,
+
+		subMappingFilters: m.subMappingFilters(),
+		alsoInto:          m.alsoIntoRules(),
+		normalizeValues:   m.Conf.NormalizeValues,
+		elements:          newElementLists(&m.Conf),
 	}, err
 }
 
@@ -102,6 +138,13 @@ type RelationMatcher interface {
 	MatchRelation(rel *osm.Relation) []Match
 }
 
+// RelationMemberMatcher matches relations and selects the matches
+// that apply to each single member of the relation.
+type RelationMemberMatcher interface {
+	RelationMatcher
+	MatchMember(member *osm.Member, matches []Match) []Match
+}
+
 type RelWayMatcher interface {
 	WayMatcher
 	RelationMatcher
@@ -118,44 +161,137 @@ func (m *Match) Row(elem *osm.Element, geom *geom.Geometry) []interface{} {
 	return m.builder.MakeRow(elem, geom, *m)
 }
 
+// AcceptGeometry returns whether the geometry passes the geometry filters
+// (min_area, min_length and closed_only) of the table. Elements without
+// geometry are always accepted.
+func (m *Match) AcceptGeometry(geom *geom.Geometry) bool {
+	if geom.Geom == nil {
+		return true
+	}
+	for _, f := range m.builder.geomFilters {
+		if !f(geom) {
+			return false
+		}
+	}
+	return true
+}
+
+// GeometryValidation returns how invalid polygons are handled for the table
+// of this match.
+func (m *Match) GeometryValidation() GeometryValidation {
+	if m.builder == nil || m.builder.geomValidation == "" {
+		return RepairGeometry
+	}
+	return m.builder.geomValidation
+}
+
+// RouteGeometry returns the route_geometry options of the table of this
+// match, or nil if the member ways are not merged.
+func (m *Match) RouteGeometry() *config.RouteGeometry {
+	if m.builder == nil {
+		return nil
+	}
+	return m.builder.routeGeometry
+}
+
+// Boundary returns whether the table of this match builds boundary
+// relations.
+func (m *Match) Boundary() bool {
+	return m.builder != nil && m.builder.boundary
+}
+
+// MemberNodes returns whether the table of this match requires the node
+// members of relations (member_node_point and member_node_id columns).
+func (m *Match) MemberNodes() bool {
+	return m.builder != nil && m.builder.memberNodes
+}
+
 func (m *Match) MemberRow(rel *osm.Relation, member *osm.Member, geom *geom.Geometry) []interface{} {
 	return m.builder.MakeMemberRow(rel, member, geom, *m)
 }
 
 type tagMatcher struct {
-	mappings   TagTableMapping
-	tables     map[string]*rowBuilder
-	filters    tableElementFilters
-	relFilters tableElementFilters
+	mappings      TagTableMapping
+	tables        map[string]*rowBuilder
+	filters       tableElementFilters
+	relFilters    tableElementFilters
+	memberFilters tableMemberFilters
+	// subMappingFilters apply to matches of a sub-mapping, in addition
+	// to the filters of the table
+	subMappingFilters map[DestTable][]elementFilter
+	// alsoInto inserts the matches of a table into other tables
+	alsoInto   map[string][]alsoIntoRule
 	matchAreas bool
+	// untagged tables match all elements without tags
+	untagged []DestTable
+	// normalizeValues lowercases and trims tag values before matching
+	normalizeValues bool
+	// elements are skipped or bypass all filters
+	elements *elementLists
 }
 
 func (tm *tagMatcher) MatchNode(node *osm.Node) []Match {
-	return tm.match(node.Tags, false, false)
+	if tm.elements.skipped(nodeElement, node.ID) {
+		return nil
+	}
+	if len(node.Tags) == 0 && len(tm.untagged) > 0 {
+		matches := make([]Match, 0, len(tm.untagged))
+		for _, t := range tm.untagged {
+			matches = append(matches, Match{Table: t, builder: tm.tables[t.Name]})
+		}
+		return matches
+	}
+	return tm.match(node.Tags, false, false, tm.elements.forced(nodeElement, node.ID))
 }
 
 func (tm *tagMatcher) MatchWay(way *osm.Way) []Match {
+	if tm.elements.skipped(wayElement, way.ID) {
+		return nil
+	}
+	force := tm.elements.forced(wayElement, way.ID)
 	if tm.matchAreas { // match way as polygon
 		if way.IsClosed() {
 			if way.Tags["area"] == "no" {
 				return nil
 			}
-			return tm.match(way.Tags, true, false)
+			return tm.match(way.Tags, true, false, force)
 		}
 	} else { // match way as linestring
 		if way.IsClosed() {
 			if way.Tags["area"] == "yes" {
 				return nil
 			}
-			return tm.match(way.Tags, true, false)
+			return tm.match(way.Tags, true, false, force)
 		}
-		return tm.match(way.Tags, false, false)
+		return tm.match(way.Tags, false, false, force)
 	}
 	return nil
 }
 
 func (tm *tagMatcher) MatchRelation(rel *osm.Relation) []Match {
-	return tm.match(rel.Tags, true, true)
+	if tm.elements.skipped(relationElement, rel.ID) {
+		return nil
+	}
+	return tm.match(rel.Tags, true, true, tm.elements.forced(relationElement, rel.ID))
+}
+
+// MatchMember returns all matches (from MatchRelation) where the member
+// passes the member filters of the destination table.
+func (tm *tagMatcher) MatchMember(member *osm.Member, matches []Match) []Match {
+	if len(tm.memberFilters) == 0 {
+		return matches
+	}
+	var result []Match
+NextMatch:
+	for _, match := range matches {
+		for _, filter := range tm.memberFilters[match.Table.Name] {
+			if !filter(member) {
+				continue NextMatch
+			}
+		}
+		result = append(result, match)
+	}
+	return result
 }
 
 type orderedMatch struct {
@@ -163,11 +299,19 @@ type orderedMatch struct {
 	order int
 }
 
-func (tm *tagMatcher) match(tags osm.Tags, closed bool, relation bool) []Match {
+// match returns the matches for the tags. Forced matches bypass all tag
+// filters.
+func (tm *tagMatcher) match(tags osm.Tags, closed bool, relation bool, force bool) []Match {
+	if tm.normalizeValues {
+		tags = normalizeTags(tags)
+	}
 	tables := make(map[DestTable]orderedMatch)
 
 	addTables := func(k, v string, tbls []orderedDestTable) {
 		for _, t := range tbls {
+			if _, ok := t.excluded[Value(v)]; ok {
+				continue
+			}
 			this := orderedMatch{
 				Match: Match{
 					Key:     k,
@@ -203,6 +347,10 @@ func (tm *tagMatcher) match(tags osm.Tags, closed bool, relation bool) []Match {
 	}
 	var matches []Match
 	for t, match := range tables {
+		if force {
+			matches = append(matches, match.Match)
+			continue
+		}
 		filters, ok := tm.filters[t.Name]
 		filteredOut := false
 		if ok {
@@ -213,6 +361,14 @@ func (tm *tagMatcher) match(tags osm.Tags, closed bool, relation bool) []Match {
 				}
 			}
 		}
+		if !filteredOut {
+			for _, filter := range tm.subMappingFilters[t] {
+				if !filter(tags, Key(match.Key), closed) {
+					filteredOut = true
+					break
+				}
+			}
+		}
 		if relation && !filteredOut {
 			filters, ok := tm.relFilters[t.Name]
 			if ok {
@@ -229,17 +385,70 @@ func (tm *tagMatcher) match(tags osm.Tags, closed bool, relation bool) []Match {
 			matches = append(matches, match.Match)
 		}
 	}
+	if len(tm.alsoInto) > 0 {
+		matches = tm.addAlsoInto(matches, tags, closed)
+	}
+	return matches
+}
+
+// addAlsoInto adds matches for the also_into rules of all matched tables.
+// Tables that are already matched are not added again.
+func (tm *tagMatcher) addAlsoInto(matches []Match, tags osm.Tags, closed bool) []Match {
+	matched := make(map[DestTable]struct{}, len(matches))
+	for _, m := range matches {
+		matched[m.Table] = struct{}{}
+	}
+	n := len(matches)
+	for i := 0; i < n; i++ {
+		m := matches[i]
+	NextRule:
+		for _, rule := range tm.alsoInto[m.Table.Name] {
+			t := DestTable{Name: rule.table}
+			if _, ok := matched[t]; ok {
+				continue
+			}
+			for _, filter := range rule.filters {
+				if !filter(tags, Key(m.Key), closed) {
+					continue NextRule
+				}
+			}
+			matched[t] = struct{}{}
+			matches = append(matches, Match{
+				Key:     m.Key,
+				Value:   m.Value,
+				Table:   t,
+				builder: tm.tables[rule.table],
+			})
+		}
+	}
 	return matches
 }
 
 type valueBuilder struct {
 	key     Key
 	colType ColumnType
+	// keys are checked in order if key is not set or empty
+	keys         []Key
+	defaultValue string
+}
+
+// tagValue returns the value of the first key that is set, or the
+// default value.
+func (v *valueBuilder) tagValue(tags osm.Tags) string {
+	if val := tags[string(v.key)]; val != "" || (len(v.keys) == 0 && v.defaultValue == "") {
+		return val
+	}
+	for _, k := range v.keys {
+		if val := tags[string(k)]; val != "" {
+			return val
+		}
+	}
+	return v.defaultValue
 }
 
 func (v *valueBuilder) Value(elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
 	if v.colType.Func != nil {
-		return v.colType.Func(elem.Tags[string(v.key)], elem, geom, match)
+		return v.colType.Func(v.tagValue(elem.Tags), elem, geom, match)
 	}
 	return nil
 }
@@ -250,9 +459,9 @@ func (v *valueBuilder) MemberValue(rel *osm.Relation, member *osm.Member, geom *
 			if member.Element == nil {
 				return nil
 			}
-			return v.colType.Func(member.Element.Tags[string(v.key)], member.Element, geom, match)
+			return v.colType.Func(v.tagValue(member.Element.Tags), member.Element, geom, match)
 		}
-		return v.colType.Func(rel.Tags[string(v.key)], &rel.Element, geom, match)
+		return v.colType.Func(v.tagValue(rel.Tags), &rel.Element, geom, match)
 	}
 	if v.colType.MemberFunc != nil {
 		return v.colType.MemberFunc(rel, member, match)
@@ -261,9 +470,18 @@ func (v *valueBuilder) MemberValue(rel *osm.Relation, member *osm.Member, geom *
 }
 
 type rowBuilder struct {
-	columns []valueBuilder
+	columns        []valueBuilder
+	geomFilters    []geomFilter
+	geomValidation GeometryValidation
+	routeGeometry  *config.RouteGeometry
+	boundary       bool
+	// memberNodes is set if the table has member_node_* columns
+	memberNodes bool
 }
 
+// geomFilter returns whether a geometry should be inserted.
+type geomFilter func(g *geom.Geometry) bool
+
 func (r *rowBuilder) MakeRow(elem *osm.Element, geom *geom.Geometry, match Match) []interface{} {
 	var row []interface{}
 	for _, column := range r.columns {
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/mapping/config"
 )
 
 func BenchmarkTagMatch(b *testing.B) {
@@ -20,3 +21,182 @@ func BenchmarkTagMatch(b *testing.B) {
 		}
 	}
 }
+
+func TestPlanetOSMMapping(t *testing.T) {
+	m, err := FromFile(BuiltinPrefix + "planet_osm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := osm.Node{}
+	n.Tags = osm.Tags{"amenity": "pub", "name": "Pub"}
+	if matches := m.PointMatcher.MatchNode(&n); len(matches) != 1 || matches[0].Table.Name != "point" {
+		t.Error("unexpected matches for point", matches)
+	}
+
+	w := osm.Way{}
+	w.Tags = osm.Tags{"highway": "primary"}
+	if matches := m.LineStringMatcher.MatchWay(&w); len(matches) != 2 {
+		t.Error("expected line and roads match", matches)
+	}
+	w.Tags = osm.Tags{"highway": "residential"}
+	if matches := m.LineStringMatcher.MatchWay(&w); len(matches) != 1 || matches[0].Table.Name != "line" {
+		t.Error("unexpected matches for line", matches)
+	}
+
+	if _, err := FromFile(BuiltinPrefix + "unknown"); err == nil {
+		t.Error("expected error for unknown builtin mapping")
+	}
+}
+
+func TestFirstMatchKeys(t *testing.T) {
+	rb, err := makeRowBuilder(&config.Table{Columns: []*config.Column{
+		{Name: "name", Type: "string", Keys: []config.Key{"name:en", "int_name", "name"}, Args: map[string]interface{}{"default": "unnamed"}},
+		{Name: "ref", Type: "string", Key: "ref", Keys: []config.Key{"official_ref"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		tags     osm.Tags
+		expected []interface{}
+	}{
+		{osm.Tags{"name:en": "Munich", "int_name": "Muenchen", "name": "München"}, []interface{}{"Munich", ""}},
+		{osm.Tags{"int_name": "Muenchen", "name": "München", "ref": "M"}, []interface{}{"Muenchen", "M"}},
+		{osm.Tags{"name:en": "", "name": "München", "official_ref": "09162000"}, []interface{}{"München", "09162000"}},
+		{osm.Tags{"ref": "M", "official_ref": "09162000"}, []interface{}{"unnamed", "M"}},
+	} {
+		row := rb.MakeRow(&osm.Element{Tags: test.tags}, nil, Match{})
+		if len(row) != 2 || row[0] != test.expected[0] || row[1] != test.expected[1] {
+			t.Errorf("%v: %v != %v", test.tags, row, test.expected)
+		}
+	}
+}
+
+func TestMappingChecksum(t *testing.T) {
+	m1, err := New([]byte("tables:\n  roads:\n    type: linestring\n    mapping:\n      highway: [__any__]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same mapping with different formatting and comments
+	m2, err := New([]byte("# roads\ntables:\n  roads: {type: linestring, mapping: {highway: [\"__any__\"]}}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m3, err := New([]byte("tables:\n  roads:\n    type: linestring\n    mapping:\n      railway: [__any__]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same mapping with descriptions
+	m4, err := New([]byte("tables:\n  roads:\n    type: linestring\n    description: All roads\n    mapping:\n      highway: [__any__]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, _ := m1.Checksum()
+	c2, _ := m2.Checksum()
+	c3, _ := m3.Checksum()
+	c4, _ := m4.Checksum()
+	if c1 != c2 {
+		t.Errorf("checksum changed for formatting: %s != %s", c1, c2)
+	}
+	if c1 != c4 {
+		t.Errorf("checksum changed for description: %s != %s", c1, c4)
+	}
+	if c1 == c3 {
+		t.Errorf("checksum did not change for different mapping: %s", c1)
+	}
+}
+
+func TestMappingChecksumDefaults(t *testing.T) {
+	checksum := func(doc string) string {
+		m, err := New([]byte(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := m.Checksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	base := checksum(`
+tables:
+  roads:
+    type: linestring
+    columns:
+      - {name: type, type: enumerate, args: {values: [a, b]}}
+    mapping:
+      highway: [__any__]
+`)
+	// options with default values do not change the checksum
+	withDefaults := checksum(`
+tables:
+  roads:
+    type: linestring
+    include_untagged: false
+    fillfactor: 0
+    indexes: []
+    filters: {}
+    columns:
+      - {name: type, type: enumerate, args: {values: [a, b]}, from_member: false}
+    mapping:
+      highway: [__any__]
+`)
+	if base != withDefaults {
+		t.Errorf("checksum changed for default values: %s != %s", base, withDefaults)
+	}
+	// explicit false and 0 in args are not defaults
+	for _, args := range []string{"{values: [a, b], first: false}", "{values: [a, b], first: 0}"} {
+		c := checksum(`
+tables:
+  roads:
+    type: linestring
+    columns:
+      - {name: type, type: enumerate, args: ` + args + `}
+    mapping:
+      highway: [__any__]
+`)
+		if base == c {
+			t.Errorf("checksum did not change for args %s", args)
+		}
+	}
+}
+
+func TestIncludeUntagged(t *testing.T) {
+	m, err := New([]byte(`
+tables:
+  pois:
+    type: point
+    mapping:
+      amenity: [__any__]
+  raw_nodes:
+    type: point
+    include_untagged: true
+    columns:
+      - {name: osm_id, type: id}
+    mapping:
+      entrance: [__any__]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.IncludesUntaggedNodes() {
+		t.Error("expected untagged nodes")
+	}
+
+	n := osm.Node{}
+	n.ID = 42
+	matches := m.PointMatcher.MatchNode(&n)
+	if len(matches) != 1 || matches[0].Table.Name != "raw_nodes" {
+		t.Fatalf("unexpected matches %v", matches)
+	}
+	if row := matches[0].Row(&n.Element, nil); len(row) != 1 || row[0] != int64(42) {
+		t.Errorf("unexpected row %v", row)
+	}
+
+	n.Tags = osm.Tags{"amenity": "cafe"}
+	matches = m.PointMatcher.MatchNode(&n)
+	if len(matches) != 1 || matches[0].Table.Name != "pois" {
+		t.Errorf("unexpected matches %v", matches)
+	}
+}
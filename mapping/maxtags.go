@@ -0,0 +1,66 @@
+package mapping
+
+import (
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
+)
+
+// Policies for elements with more than max_tags tags.
+const (
+	// MaxTagsTruncate removes the tags above the limit before the
+	// elements are cached, tags that are used by the mapping are kept.
+	MaxTagsTruncate = "truncate"
+	// MaxTagsHstore only limits the keys of hstore_tags columns.
+	MaxTagsHstore = "hstore"
+	// MaxTagsSkip does not import the elements.
+	MaxTagsSkip = "skip"
+)
+
+func maxTagsPolicy(tags config.Tags) string {
+	if tags.MaxTagsPolicy == "" {
+		return MaxTagsTruncate
+	}
+	return tags.MaxTagsPolicy
+}
+
+// prepareMaxTags checks the max_tags options and sets max_keys of all
+// hstore_tags columns for the hstore policy.
+func prepareMaxTags(conf *config.Mapping) error {
+	if conf.Tags.MaxTags < 0 {
+		return errors.New("max_tags needs to be positive")
+	}
+	policy := maxTagsPolicy(conf.Tags)
+	switch policy {
+	case MaxTagsTruncate, MaxTagsSkip:
+	case MaxTagsHstore:
+		if conf.Tags.MaxTags == 0 {
+			return nil
+		}
+		for _, t := range conf.Tables {
+			for _, col := range t.Columns {
+				if col.Type != "hstore_tags" {
+					continue
+				}
+				if _, ok := col.Args["max_keys"]; ok {
+					continue
+				}
+				if col.Args == nil {
+					col.Args = make(map[string]interface{})
+				}
+				col.Args["max_keys"] = conf.Tags.MaxTags
+			}
+		}
+	default:
+		return errors.Errorf("unknown max_tags_policy %q, use truncate, hstore or skip", policy)
+	}
+	return nil
+}
+
+// SkipMaxTags returns the max number of tags of imported elements for the
+// skip policy, or 0 if no elements are skipped.
+func (m *Mapping) SkipMaxTags() int {
+	if maxTagsPolicy(m.Conf.Tags) != MaxTagsSkip {
+		return 0
+	}
+	return m.Conf.Tags.MaxTags
+}
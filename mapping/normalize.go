@@ -0,0 +1,86 @@
+package mapping
+
+import (
+	"strings"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+// normalizeValue lowercases and trims a tag value.
+func normalizeValue(v string) string {
+	return strings.ToLower(strings.TrimSpace(v))
+}
+
+// normalizeTags returns a copy of tags with normalized values. Returns tags
+// itself if all values are already normalized.
+func normalizeTags(tags osm.Tags) osm.Tags {
+	var result osm.Tags
+	for k, v := range tags {
+		if nv := normalizeValue(v); nv != v {
+			if result == nil {
+				result = make(osm.Tags, len(tags))
+				for k, v := range tags {
+					result[k] = v
+				}
+			}
+			result[k] = nv
+		}
+	}
+	if result == nil {
+		return tags
+	}
+	return result
+}
+
+// normalizeConfigValues normalizes all values of the mappings and the
+// require/reject filters, so that they match the normalized tag values.
+func normalizeConfigValues(conf *config.Mapping) {
+	for _, t := range conf.Tables {
+		normalizeKeyValues(t.Mapping)
+		for _, sub := range t.Mappings {
+			normalizeKeyValues(sub.Mapping)
+			if sub.Filters != nil {
+				normalizeFilterValues(sub.Filters)
+			}
+		}
+		normalizeKeyValues(t.TypeMappings.Points)
+		normalizeKeyValues(t.TypeMappings.LineStrings)
+		normalizeKeyValues(t.TypeMappings.Polygons)
+		if t.Filters != nil {
+			normalizeFilterValues(t.Filters)
+		}
+		for _, rule := range t.AlsoInto {
+			if rule.Filters != nil {
+				normalizeFilterValues(rule.Filters)
+			}
+		}
+	}
+}
+
+func normalizeKeyValues(kv config.KeyValues) {
+	for _, values := range kv {
+		for i := range values {
+			values[i].Value = config.Value(normalizeValue(string(values[i].Value)))
+		}
+	}
+}
+
+func normalizeFilterValues(f *config.Filters) {
+	if f.ExcludeTags != nil {
+		for _, keyVal := range *f.ExcludeTags {
+			keyVal[1] = normalizeValue(keyVal[1])
+		}
+	}
+	normalizeKeyValues(f.Require)
+	normalizeKeyValues(f.Reject)
+	for i := range f.All {
+		normalizeFilterValues(&f.All[i])
+	}
+	for i := range f.Any {
+		normalizeFilterValues(&f.Any[i])
+	}
+	if f.Not != nil {
+		normalizeFilterValues(f.Not)
+	}
+}
@@ -0,0 +1,34 @@
+package mapping
+
+import (
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/geom/wkb"
+	"github.com/omniscale/imposm3/log"
+)
+
+// orientedGeometry returns a geometry column function that orients the rings
+// of the polygons from source. Exterior rings are counterclockwise and
+// interior rings clockwise if ccw is true (RFC 7946), and the other way
+// around otherwise. sourceKey is the shared key of the source geometry.
+func orientedGeometry(ccw bool, source MakeValue, sourceKey string) MakeValue {
+	key := "oriented_cw:" + sourceKey
+	if ccw {
+		key = "oriented_ccw:" + sourceKey
+	}
+	return func(val string, elem *osm.Element, g *geom.Geometry, match Match) interface{} {
+		sv := source(val, elem, g, match)
+		v, ok := sv.(string)
+		if !ok || v == "" {
+			return sv
+		}
+		return g.Shared(key, func() interface{} {
+			b, err := wkb.OrientHex([]byte(v), ccw)
+			if err != nil {
+				log.Printf("[warn]: orienting geometry of %d: %s", elem.ID, err)
+				return v
+			}
+			return string(b)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package mapping
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+const (
+	defaultGeohashColumn    = "geohash"
+	defaultGeohashPrecision = 1
+	maxGeohashPrecision     = 2
+)
+
+// preparePartition checks the partition options of a table and adds the
+// geohash column for geohash partitions.
+func preparePartition(t *config.Table) error {
+	if t.Shard != nil {
+		return errors.New("shard and partition can not be combined")
+	}
+	p := t.Partition
+	switch p.By {
+	case "hash":
+		if p.Partitions < 2 {
+			return errors.New("hash partitioning requires two or more partitions")
+		}
+		if p.Column == "" {
+			for _, c := range t.Columns {
+				if c.Type == "id" {
+					p.Column = c.Name
+					break
+				}
+			}
+			if p.Column == "" {
+				return errors.New("column is required for tables without id column")
+			}
+		}
+		return checkPartitionColumn(t, p.Column)
+	case "list":
+		if p.Column == "" || len(p.Values) == 0 {
+			return errors.New("column and values are required")
+		}
+		return checkPartitionColumn(t, p.Column)
+	case "geohash":
+		if TableType(t.Type) == RelationTable {
+			return errors.New("relation tables have no geometry")
+		}
+		if p.Precision == 0 {
+			p.Precision = defaultGeohashPrecision
+		}
+		if p.Precision < 1 || p.Precision > maxGeohashPrecision {
+			return errors.Errorf("precision needs to be between 1 and %d", maxGeohashPrecision)
+		}
+		if p.Column == "" {
+			p.Column = defaultGeohashColumn
+		}
+		for _, c := range t.Columns {
+			if c.Name != p.Column {
+				continue
+			}
+			if c.Type == "geohash" && c.Args["precision"] == p.Precision {
+				// already added
+				return nil
+			}
+			return errors.Errorf("column %s already defined", p.Column)
+		}
+		t.Columns = append(t.Columns, &config.Column{
+			Name: p.Column,
+			Type: "geohash",
+			Args: map[string]interface{}{"precision": p.Precision},
+		})
+		return nil
+	default:
+		return errors.Errorf("unknown partitioning %q (hash, list or geohash)", p.By)
+	}
+}
+
+func checkPartitionColumn(t *config.Table, name string) error {
+	for _, c := range t.Columns {
+		if c.Name != name {
+			continue
+		}
+		switch c.Type {
+		case "geometry", "validated_geometry", "geometry_centroid", "geometry_pointonsurface", "geometry_labelpoint", "simplified_geometry":
+			return errors.Errorf("geometry column %s can not be used for partitioning", name)
+		}
+		return nil
+	}
+	return errors.Errorf("unknown column %s", name)
+}
+
+// PartitionValues returns the values of the list partitions of a table, or
+// all geohashes with the precision of geohash partitions.
+func PartitionValues(p *config.Partition) []string {
+	if p.By != "geohash" {
+		return p.Values
+	}
+	values := []string{""}
+	for i := 0; i < p.Precision; i++ {
+		var next []string
+		for _, v := range values {
+			for _, c := range geohashBase32 {
+				next = append(next, v+string(c))
+			}
+		}
+		values = next
+	}
+	return values
+}
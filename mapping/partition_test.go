@@ -0,0 +1,106 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+func TestPreparePartition(t *testing.T) {
+	tbl := &config.Table{
+		Type:      "polygon",
+		Columns:   []*config.Column{{Name: "osm_id", Type: "id"}},
+		Partition: &config.Partition{By: "geohash"},
+	}
+	if err := preparePartition(tbl); err != nil {
+		t.Fatal(err)
+	}
+	// second call does not add the column again
+	if err := preparePartition(tbl); err != nil {
+		t.Fatal(err)
+	}
+	if tbl.Partition.Column != "geohash" || tbl.Partition.Precision != 1 {
+		t.Errorf("unexpected defaults %+v", tbl.Partition)
+	}
+	if len(tbl.Columns) != 2 || tbl.Columns[1].Name != "geohash" || tbl.Columns[1].Type != "geohash" {
+		t.Errorf("unexpected columns %v", tbl.Columns)
+	}
+
+	tbl = &config.Table{
+		Type:      "point",
+		Columns:   []*config.Column{{Name: "osm_id", Type: "id"}},
+		Partition: &config.Partition{By: "hash", Partitions: 8},
+	}
+	if err := preparePartition(tbl); err != nil {
+		t.Fatal(err)
+	}
+	if tbl.Partition.Column != "osm_id" {
+		t.Errorf("unexpected default column %q", tbl.Partition.Column)
+	}
+
+	columns := []*config.Column{
+		{Name: "osm_id", Type: "id"},
+		{Name: "type", Type: "mapping_value"},
+		{Name: "geometry", Type: "geometry"},
+	}
+	for _, tc := range []struct {
+		table *config.Table
+		err   string
+	}{
+		{&config.Table{Type: "point", Columns: columns, Partition: &config.Partition{By: "list", Column: "type", Values: []string{"a"}}},
+			""},
+		{&config.Table{Type: "point", Columns: columns, Partition: &config.Partition{By: "range"}},
+			`unknown partitioning "range" (hash, list or geohash)`},
+		{&config.Table{Type: "point", Columns: columns, Partition: &config.Partition{By: "hash", Partitions: 1}},
+			"hash partitioning requires two or more partitions"},
+		{&config.Table{Type: "point", Columns: columns, Partition: &config.Partition{By: "hash", Partitions: 4, Column: "name"}},
+			"unknown column name"},
+		{&config.Table{Type: "point", Columns: columns, Partition: &config.Partition{By: "list", Column: "type"}},
+			"column and values are required"},
+		{&config.Table{Type: "point", Columns: columns, Partition: &config.Partition{By: "list", Column: "geometry", Values: []string{"a"}}},
+			"geometry column geometry can not be used for partitioning"},
+		{&config.Table{Type: "relation", Partition: &config.Partition{By: "geohash"}},
+			"relation tables have no geometry"},
+		{&config.Table{Type: "point", Partition: &config.Partition{By: "geohash", Precision: 3}},
+			"precision needs to be between 1 and 2"},
+		{&config.Table{Type: "point", Columns: columns, Partition: &config.Partition{By: "geohash", Column: "type"}},
+			"column type already defined"},
+		{&config.Table{Type: "point", Columns: columns, Shard: &config.Shard{}, Partition: &config.Partition{By: "hash", Partitions: 4}},
+			"shard and partition can not be combined"},
+	} {
+		err := preparePartition(tc.table)
+		if tc.err == "" && err != nil {
+			t.Errorf("unexpected error %v", err)
+		} else if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("expected error %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestPartitionValues(t *testing.T) {
+	values := PartitionValues(&config.Partition{By: "geohash", Precision: 2})
+	if len(values) != 1024 || values[0] != "00" || values[1023] != "zz" {
+		t.Errorf("unexpected values %d %v", len(values), values[:2])
+	}
+	values = PartitionValues(&config.Partition{By: "list", Values: []string{"a", "b"}})
+	if len(values) != 2 {
+		t.Errorf("unexpected values %v", values)
+	}
+}
+
+func TestEncodeGeohash(t *testing.T) {
+	for _, tc := range []struct {
+		long, lat float64
+		precision int
+		hash      string
+	}{
+		{-5.6, 42.6, 5, "ezs42"},
+		{10.40744, 57.64911, 11, "u4pruydqqvj"},
+		{8.2, 53.1, 1, "u"},
+		{-180, -90, 2, "00"},
+	} {
+		if h := encodeGeohash(tc.long, tc.lat, tc.precision); h != tc.hash {
+			t.Errorf("unexpected geohash for %f %f: %s != %s", tc.long, tc.lat, h, tc.hash)
+		}
+	}
+}
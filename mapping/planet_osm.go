@@ -0,0 +1,162 @@
+package mapping
+
+import (
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+// BuiltinPrefix marks mapping file names that refer to a built-in
+// mapping (e.g. builtin:planet_osm).
+const BuiltinPrefix = "builtin:"
+
+var builtinMappings = map[string]func() config.Mapping{
+	"planet_osm": planetOSMMapping,
+}
+
+// planetOSMColumns are the tag columns of the default osm2pgsql style.
+var planetOSMColumns = []string{
+	"access", "addr:housename", "addr:housenumber", "addr:interpolation",
+	"admin_level", "aerialway", "aeroway", "amenity", "area", "barrier",
+	"bicycle", "brand", "bridge", "boundary", "building", "construction",
+	"covered", "culvert", "cutting", "denomination", "disused", "embankment",
+	"foot", "generator:source", "harbour", "highway", "historic", "horse",
+	"intermittent", "junction", "landuse", "layer", "leisure", "lock",
+	"man_made", "military", "motorcar", "name", "natural", "office", "oneway",
+	"operator", "place", "population", "power", "power_source",
+	"public_transport", "railway", "ref", "religion", "route", "service",
+	"shop", "sport", "surface", "toll", "tourism", "tower:type", "tracktype",
+	"tunnel", "water", "waterway", "wetland", "width", "wood",
+}
+
+var planetOSMPointKeys = []string{
+	"addr:housenumber", "aerialway", "aeroway", "amenity", "barrier",
+	"building", "highway", "historic", "leisure", "man_made", "military",
+	"natural", "office", "place", "power", "public_transport", "railway",
+	"shop", "sport", "tourism", "water", "waterway",
+}
+
+var planetOSMLineKeys = []string{
+	"aerialway", "aeroway", "barrier", "boundary", "highway", "historic",
+	"man_made", "natural", "power", "railway", "route", "waterway",
+}
+
+var planetOSMPolygonKeys = []string{
+	"addr:housenumber", "aeroway", "amenity", "boundary", "building",
+	"harbour", "historic", "landuse", "leisure", "man_made", "military",
+	"natural", "office", "place", "power", "public_transport", "shop",
+	"sport", "tourism", "water", "waterway", "wetland",
+}
+
+// planetOSMZOrder is the z_order ranking of the osm2pgsql style.
+var planetOSMZOrder = map[interface{}]interface{}{
+	"railway": 440,
+	"highway": map[interface{}]interface{}{
+		"motorway":       380,
+		"trunk":          370,
+		"primary":        360,
+		"secondary":      350,
+		"tertiary":       340,
+		"residential":    330,
+		"unclassified":   330,
+		"road":           330,
+		"living_street":  320,
+		"pedestrian":     310,
+		"raceway":        300,
+		"motorway_link":  240,
+		"trunk_link":     230,
+		"primary_link":   220,
+		"secondary_link": 210,
+		"tertiary_link":  200,
+		"service":        150,
+		"track":          110,
+		"path":           100,
+		"footway":        100,
+		"bridleway":      100,
+		"cycleway":       100,
+		"steps":          90,
+		"platform":       90,
+	},
+	"aeroway": map[interface{}]interface{}{
+		"runway":  60,
+		"taxiway": 50,
+	},
+}
+
+// planetOSMMapping returns a mapping for osm2pgsql compatible
+// point, line, polygon and roads tables. All tables have an osm_id,
+// way geometry, tags hstore, z_order and a column for each tag of the default
+// osm2pgsql style. Use planet_osm_ as table prefix.
+func planetOSMMapping() config.Mapping {
+	anyValue := func(keys ...string) config.KeyValues {
+		kv := make(config.KeyValues)
+		for i, k := range keys {
+			kv[config.Key(k)] = []config.OrderedValue{{Value: "__any__", Order: i}}
+		}
+		return kv
+	}
+	columns := func(polygon bool) []*config.Column {
+		cols := []*config.Column{
+			{Name: "osm_id", Type: "id"},
+			{Name: "way", Type: "geometry"},
+		}
+		for _, k := range planetOSMColumns {
+			cols = append(cols, &config.Column{Name: k, Key: config.Key(k), Type: "string"})
+		}
+		cols = append(cols,
+			&config.Column{Name: "tags", Type: "hstore_tags"},
+			&config.Column{Name: "z_order", Type: "z_order", Args: map[string]interface{}{
+				"ranks":         planetOSMZOrder,
+				"layer_weight":  100,
+				"bridge_weight": 0,
+				"tunnel_weight": 0,
+			}},
+		)
+		if polygon {
+			cols = append(cols, &config.Column{Name: "way_area", Type: "area"})
+		}
+		return cols
+	}
+
+	roads := anyValue("railway")
+	roads["boundary"] = []config.OrderedValue{{Value: "administrative"}}
+	for i, v := range []string{
+		"motorway", "motorway_link", "trunk", "trunk_link",
+		"primary", "primary_link", "secondary", "secondary_link",
+	} {
+		roads["highway"] = append(roads["highway"], config.OrderedValue{Value: config.Value(v), Order: i})
+	}
+
+	return config.Mapping{
+		Tags: config.Tags{LoadAll: true},
+		Areas: config.Areas{
+			AreaTags: []config.Key{
+				"aeroway", "amenity", "building", "harbour", "historic",
+				"landuse", "leisure", "man_made", "military", "natural",
+				"office", "place", "power", "public_transport", "shop",
+				"sport", "tourism", "water", "wetland",
+			},
+			LinearTags: []config.Key{"highway", "barrier"},
+		},
+		Tables: config.Tables{
+			"point": {
+				Type:    string(PointTable),
+				Mapping: anyValue(planetOSMPointKeys...),
+				Columns: columns(false),
+			},
+			"line": {
+				Type:    string(LineStringTable),
+				Mapping: anyValue(planetOSMLineKeys...),
+				Columns: columns(false),
+			},
+			"polygon": {
+				Type:    string(PolygonTable),
+				Mapping: anyValue(planetOSMPolygonKeys...),
+				Columns: columns(true),
+			},
+			"roads": {
+				Type:    string(LineStringTable),
+				Mapping: roads,
+				Columns: columns(false),
+			},
+		},
+	}
+}
@@ -0,0 +1,141 @@
+package mapping
+
+import (
+	osm "github.com/omniscale/go-osm"
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+// SelectTables returns a mapping that only imports into the named tables
+// and all generalized tables that are derived from them. Elements are
+// matched with the complete mapping, so that also_into rules of other
+// tables still insert into the selected tables.
+func (m *Mapping) SelectTables(names []string) (*Mapping, error) {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := m.Conf.Tables[name]; ok {
+			selected[name] = true
+			continue
+		}
+		if _, ok := m.Conf.GeneralizedTables[name]; ok {
+			return nil, errors.Errorf("%s is a generalized table, select its source table instead", name)
+		}
+		return nil, errors.Errorf("unknown table %s", name)
+	}
+
+	conf := m.Conf
+	conf.Tables = make(config.Tables)
+	for name := range selected {
+		conf.Tables[name] = m.Conf.Tables[name]
+	}
+	conf.GeneralizedTables = make(config.GeneralizedTables)
+	for name, t := range m.Conf.GeneralizedTables {
+		if selected[generalizedSource(m.Conf.GeneralizedTables, t)] {
+			conf.GeneralizedTables[name] = t
+		}
+	}
+	conf.DeployGroups = nil
+	for _, g := range m.Conf.DeployGroups {
+		group := config.DeployGroup{Name: g.Name}
+		for _, name := range g.Tables {
+			if _, ok := conf.Tables[name]; ok {
+				group.Tables = append(group.Tables, name)
+			} else if _, ok := conf.GeneralizedTables[name]; ok {
+				group.Tables = append(group.Tables, name)
+			}
+		}
+		if len(group.Tables) > 0 {
+			conf.DeployGroups = append(conf.DeployGroups, group)
+		}
+	}
+
+	return &Mapping{
+		Conf:                  conf,
+		PointMatcher:          selectedNodeMatcher{m.PointMatcher, selected},
+		LineStringMatcher:     selectedWayMatcher{m.LineStringMatcher, selected},
+		PolygonMatcher:        selectedRelWayMatcher{m.PolygonMatcher, selected},
+		RelationMatcher:       selectedRelationMatcher{m.RelationMatcher, selected},
+		RelationMemberMatcher: selectedRelationMemberMatcher{m.RelationMemberMatcher, selected},
+	}, nil
+}
+
+// generalizedSource returns the name of the (non-generalized) table that
+// t is derived from.
+func generalizedSource(tables config.GeneralizedTables, t *config.GeneralizedTable) string {
+	for i := 0; i < len(tables); i++ {
+		source, ok := tables[t.SourceTableName]
+		if !ok {
+			break
+		}
+		t = source
+	}
+	return t.SourceTableName
+}
+
+func selectMatches(matches []Match, selected map[string]bool) []Match {
+	n := 0
+	for _, m := range matches {
+		if selected[m.Table.Name] {
+			matches[n] = m
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	return matches[:n]
+}
+
+type selectedNodeMatcher struct {
+	m        NodeMatcher
+	selected map[string]bool
+}
+
+func (s selectedNodeMatcher) MatchNode(node *osm.Node) []Match {
+	return selectMatches(s.m.MatchNode(node), s.selected)
+}
+
+type selectedWayMatcher struct {
+	m        WayMatcher
+	selected map[string]bool
+}
+
+func (s selectedWayMatcher) MatchWay(way *osm.Way) []Match {
+	return selectMatches(s.m.MatchWay(way), s.selected)
+}
+
+type selectedRelationMatcher struct {
+	m        RelationMatcher
+	selected map[string]bool
+}
+
+func (s selectedRelationMatcher) MatchRelation(rel *osm.Relation) []Match {
+	return selectMatches(s.m.MatchRelation(rel), s.selected)
+}
+
+type selectedRelWayMatcher struct {
+	m        RelWayMatcher
+	selected map[string]bool
+}
+
+func (s selectedRelWayMatcher) MatchWay(way *osm.Way) []Match {
+	return selectMatches(s.m.MatchWay(way), s.selected)
+}
+
+func (s selectedRelWayMatcher) MatchRelation(rel *osm.Relation) []Match {
+	return selectMatches(s.m.MatchRelation(rel), s.selected)
+}
+
+type selectedRelationMemberMatcher struct {
+	m        RelationMemberMatcher
+	selected map[string]bool
+}
+
+func (s selectedRelationMemberMatcher) MatchRelation(rel *osm.Relation) []Match {
+	return selectMatches(s.m.MatchRelation(rel), s.selected)
+}
+
+func (s selectedRelationMemberMatcher) MatchMember(member *osm.Member, matches []Match) []Match {
+	return selectMatches(s.m.MatchMember(member, matches), s.selected)
+}
@@ -0,0 +1,72 @@
+package mapping
+
+import (
+	"testing"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+func TestSelectTables(t *testing.T) {
+	roads := NewTable("roads", LineStringTable).
+		AddMapping("highway", "primary").
+		AddColumn(config.Column{Name: "osm_id", Type: "id"})
+	roads.Config().AlsoInto = []config.AlsoInto{{Table: "bridges"}}
+	bridges := NewTable("bridges", LineStringTable).
+		AddMapping("man_made", "bridge").
+		AddColumn(config.Column{Name: "osm_id", Type: "id"})
+	pois := NewTable("pois", PointTable).
+		AddMapping("amenity", "__any__").
+		AddColumn(config.Column{Name: "osm_id", Type: "id"})
+
+	m := &Mapping{}
+	for _, tbl := range []*Table{roads, bridges, pois} {
+		if err := m.AddTable(tbl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.AddGeneralizedTable("bridges_gen1", "bridges", 10, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddGeneralizedTable("bridges_gen0", "bridges_gen1", 100, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddGeneralizedTable("roads_gen0", "roads", 100, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	sel, err := m.SelectTables([]string{"bridges"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sel.Conf.Tables) != 1 || sel.Conf.Tables["bridges"] == nil {
+		t.Errorf("unexpected tables %v", sel.Conf.Tables)
+	}
+	if len(sel.Conf.GeneralizedTables) != 2 || sel.Conf.GeneralizedTables["roads_gen0"] != nil {
+		t.Errorf("unexpected generalized tables %v", sel.Conf.GeneralizedTables)
+	}
+	if len(m.Conf.Tables) != 3 {
+		t.Error("original mapping modified")
+	}
+
+	w := osm.Way{}
+	w.Tags = osm.Tags{"highway": "primary"}
+	if matches := sel.LineStringMatcher.MatchWay(&w); len(matches) != 1 || matches[0].Table.Name != "bridges" {
+		t.Errorf("unexpected matches %v", matches)
+	}
+	n := osm.Node{}
+	n.Tags = osm.Tags{"amenity": "cafe"}
+	if matches := sel.PointMatcher.MatchNode(&n); len(matches) != 0 {
+		t.Errorf("unexpected matches %v", matches)
+	}
+
+	if _, err := m.SelectTables([]string{"roads_gen0"}); err == nil {
+		t.Error("expected error for generalized table")
+	}
+	if _, err := m.SelectTables([]string{"unknown"}); err == nil {
+		t.Error("expected error for unknown table")
+	}
+}
@@ -0,0 +1,75 @@
+package mapping
+
+import (
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/geom/geojson"
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+const defaultShardColumn = "region"
+
+// prepareShard adds the region column of a sharded table.
+func prepareShard(t *config.Table) error {
+	s := t.Shard
+	if s.GeoJSON == "" || s.Property == "" {
+		return errors.New("geojson and property are required")
+	}
+	if TableType(t.Type) == RelationTable {
+		return errors.New("relation tables have no geometry")
+	}
+	if s.Column == "" {
+		s.Column = defaultShardColumn
+	}
+	for _, c := range t.Columns {
+		if c.Name != s.Column {
+			continue
+		}
+		if c.Type == "geojson_intersects_feature" && c.Args["geojson"] == s.GeoJSON && c.Args["property"] == s.Property {
+			// already added
+			return nil
+		}
+		return errors.Errorf("column %s already defined", s.Column)
+	}
+	t.Columns = append(t.Columns, &config.Column{
+		Name: s.Column,
+		Type: "geojson_intersects_feature",
+		Args: map[string]interface{}{
+			"geojson":  s.GeoJSON,
+			"property": s.Property,
+		},
+	})
+	return nil
+}
+
+// ShardRegions returns the sorted regions of a shard.
+func ShardRegions(s *config.Shard) ([]string, error) {
+	f, err := os.Open(s.GeoJSON)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading shard regions")
+	}
+	defer f.Close()
+	features, err := geojson.ParseGeoJSON(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading shard regions from %s", s.GeoJSON)
+	}
+
+	found := make(map[string]bool)
+	var regions []string
+	for _, feature := range features {
+		r, ok := feature.Properties[s.Property]
+		if !ok || r == "" || found[r] {
+			continue
+		}
+		found[r] = true
+		regions = append(regions, r)
+	}
+	if len(regions) == 0 {
+		return nil, errors.Errorf("no features with property %s in %s", s.Property, s.GeoJSON)
+	}
+	sort.Strings(regions)
+	return regions, nil
+}
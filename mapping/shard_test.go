@@ -0,0 +1,59 @@
+package mapping
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/omniscale/imposm3/mapping/config"
+)
+
+func TestPrepareShard(t *testing.T) {
+	tbl := &config.Table{
+		Type:    "polygon",
+		Columns: []*config.Column{{Name: "osm_id", Type: "id"}},
+		Shard:   &config.Shard{GeoJSON: "be_nl_bounds.geojson", Property: "FIPS_CNTRY"},
+	}
+	if err := prepareShard(tbl); err != nil {
+		t.Fatal(err)
+	}
+	// second call does not add the column again
+	if err := prepareShard(tbl); err != nil {
+		t.Fatal(err)
+	}
+	if tbl.Shard.Column != "region" {
+		t.Errorf("unexpected default column %q", tbl.Shard.Column)
+	}
+	if len(tbl.Columns) != 2 || tbl.Columns[1].Name != "region" || tbl.Columns[1].Type != "geojson_intersects_feature" {
+		t.Errorf("unexpected columns %v", tbl.Columns)
+	}
+
+	for _, tc := range []struct {
+		table *config.Table
+		err   string
+	}{
+		{&config.Table{Type: "polygon", Shard: &config.Shard{GeoJSON: "be_nl_bounds.geojson"}},
+			"geojson and property are required"},
+		{&config.Table{Type: "relation", Shard: &config.Shard{GeoJSON: "be_nl_bounds.geojson", Property: "FIPS_CNTRY"}},
+			"relation tables have no geometry"},
+		{&config.Table{Type: "polygon", Columns: []*config.Column{{Name: "region", Type: "string"}},
+			Shard: &config.Shard{GeoJSON: "be_nl_bounds.geojson", Property: "FIPS_CNTRY"}},
+			"column region already defined"},
+	} {
+		if err := prepareShard(tc.table); err == nil || err.Error() != tc.err {
+			t.Errorf("expected error %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestShardRegions(t *testing.T) {
+	regions, err := ShardRegions(&config.Shard{GeoJSON: "be_nl_bounds.geojson", Property: "FIPS_CNTRY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(regions, []string{"BE", "NL"}) {
+		t.Errorf("unexpected regions %v", regions)
+	}
+	if _, err := ShardRegions(&config.Shard{GeoJSON: "be_nl_bounds.geojson", Property: "unknown"}); err == nil {
+		t.Error("expected error for unknown property")
+	}
+}
@@ -0,0 +1,29 @@
+package mapping
+
+import (
+	"strconv"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/geom/geos"
+)
+
+// simplifiedGeometry returns a geometry column function that simplifies the
+// geometry with tolerance, and the shared key of the simplified geometry.
+// The Douglas-Peucker algorithm is used, unless preserveTopology is true.
+func simplifiedGeometry(tolerance float64, preserveTopology bool) (MakeValue, string) {
+	simplify := func(g *geos.Geos, geom *geos.Geom) *geos.Geom {
+		return g.Simplify(geom, tolerance)
+	}
+	key := "simplified_dp:" + strconv.FormatFloat(tolerance, 'g', -1, 64)
+	if preserveTopology {
+		// same key as simplified_geometry columns
+		simplify = func(g *geos.Geos, geom *geos.Geom) *geos.Geom {
+			return g.SimplifyPreserveTopology(geom, tolerance)
+		}
+		key = "simplified:" + strconv.FormatFloat(tolerance, 'g', -1, 64)
+	}
+	return func(val string, elem *osm.Element, geom *geom.Geometry, match Match) interface{} {
+		return derivedGeometry(geom, key, simplify)
+	}, key
+}
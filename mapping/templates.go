@@ -0,0 +1,90 @@
+package mapping
+
+import (
+	"strings"
+
+	"github.com/omniscale/imposm3/mapping/config"
+	"github.com/pkg/errors"
+)
+
+// applyTableTemplates sets the type, columns and filters of all tables
+// that extend a table template.
+func applyTableTemplates(conf *config.Mapping) error {
+	for name, t := range conf.Tables {
+		if t.Extends == "" {
+			continue
+		}
+		tmpl, err := resolveTableTemplate(conf.TableTemplates, t.Extends, nil)
+		if err != nil {
+			return errors.Wrapf(err, "table %s", name)
+		}
+		if t.OldFields != nil {
+			t.Columns = t.OldFields
+			t.OldFields = nil
+		}
+		if t.Type == "" {
+			t.Type = tmpl.Type
+		}
+		t.Columns = mergeColumns(tmpl.Columns, t.Columns)
+		if t.Filters == nil {
+			t.Filters = tmpl.Filters
+		}
+	}
+	return nil
+}
+
+// resolveTableTemplate returns the template with all options of the
+// templates it extends. path contains the names of the extending
+// templates, to detect cycles.
+func resolveTableTemplate(templates config.TableTemplates, name string, path []string) (*config.TableTemplate, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return nil, errors.Errorf("unknown table template %s", name)
+	}
+	for _, p := range path {
+		if p == name {
+			return nil, errors.Errorf("cycle in table templates: %s -> %s",
+				strings.Join(path, " -> "), name)
+		}
+	}
+	if tmpl.Extends == "" {
+		return tmpl, nil
+	}
+	base, err := resolveTableTemplate(templates, tmpl.Extends, append(path, name))
+	if err != nil {
+		return nil, err
+	}
+	result := *tmpl
+	if result.Type == "" {
+		result.Type = base.Type
+	}
+	result.Columns = mergeColumns(base.Columns, tmpl.Columns)
+	if result.Filters == nil {
+		result.Filters = base.Filters
+	}
+	return &result, nil
+}
+
+// mergeColumns returns the base columns followed by the additional
+// columns. Additional columns replace base columns with the same name.
+func mergeColumns(base, columns []*config.Column) []*config.Column {
+	result := make([]*config.Column, 0, len(base)+len(columns))
+	replaced := make(map[string]bool)
+	for _, bc := range base {
+		col := bc
+		for _, c := range columns {
+			if c.Name == bc.Name {
+				col = c
+				replaced[c.Name] = true
+				break
+			}
+		}
+		result = append(result, col)
+	}
+	for _, c := range columns {
+		if !replaced[c.Name] {
+			result = append(result, c)
+		}
+	}
+	return result
+}
@@ -0,0 +1,5 @@
+/*
+Package testmapping provides the test-mapping sub command to test a mapping
+against sample OSM data without a database.
+*/
+package testmapping
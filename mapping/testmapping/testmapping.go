@@ -0,0 +1,250 @@
+package testmapping
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/cache"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/reader"
+	"github.com/omniscale/imposm3/stats"
+	"github.com/omniscale/imposm3/writer"
+)
+
+var flags = flag.NewFlagSet("test-mapping", flag.ExitOnError)
+
+var (
+	mappingFile = flags.String("mapping", "", "mapping file")
+	input       = flags.String("i", "", "sample OSM data (PBF)")
+	srid        = flags.Int("srid", 3857, "srs id")
+	samples     = flags.Int("samples", 3, "number of sample elements for each table")
+)
+
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s %s:\n\n", os.Args[0], os.Args[1])
+	flags.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\nTest mapping against sample OSM data without a database.")
+	os.Exit(1)
+}
+
+// TestMapping reads the OSM data into a temporary cache and matches and
+// builds all elements like an import. It prints the number of rows of each
+// table and a few sample rows.
+func TestMapping(args []string) {
+	flags.Usage = Usage
+	flags.Parse(args)
+	if *mappingFile == "" || *input == "" {
+		Usage()
+	}
+
+	tagmapping, err := mapping.FromFile(*mappingFile)
+	if err != nil {
+		log.Fatal("[fatal] reading mapping: ", err)
+	}
+
+	cacheDir, err := ioutil.TempDir("", "imposm-test-mapping")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	osmCache := cache.NewOSMCache(cacheDir)
+	if err := osmCache.Open(); err != nil {
+		log.Fatal("[fatal] opening cache files: ", err)
+	}
+	progress := stats.NewStatsReporter()
+	err = reader.ReadPbf(context.Background(), *input, osmCache, progress, tagmapping, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	progress.Stop()
+	osmCache.Close()
+
+	if err := osmCache.Open(); err != nil {
+		log.Fatal("[fatal] opening cache files: ", err)
+	}
+	defer osmCache.Close()
+	osmCache.Coords.SetReadOnly(true)
+
+	rows := newRowCollector(tagmapping, *samples)
+	progress = stats.NewStatsReporter()
+
+	// writers are not concurrent, to get the same samples for each run
+	outerWays := writer.NewOuterWays()
+	relWriter := writer.NewRelationWriter(osmCache, nil,
+		tagmapping.Conf.SingleIDSpace,
+		osmCache.Relations.Iter(),
+		rows, progress,
+		tagmapping.PolygonMatcher,
+		tagmapping.RelationMatcher,
+		tagmapping.RelationMemberMatcher,
+		*srid,
+	)
+	relWriter.SetOldStyleMultipolygons(tagmapping.Conf.OldStyleMultipolygons)
+	relWriter.SetOuterWays(outerWays)
+	relWriter.Start()
+	relWriter.Wait()
+
+	wayWriter := writer.NewWayWriter(osmCache, nil,
+		tagmapping.Conf.SingleIDSpace,
+		osmCache.Ways.Iter(), rows,
+		progress,
+		tagmapping.PolygonMatcher,
+		tagmapping.LineStringMatcher,
+		*srid,
+	)
+	wayWriter.SetOldStyleMultipolygons(tagmapping.Conf.OldStyleMultipolygons)
+	wayWriter.SetOuterWays(outerWays)
+	wayWriter.Start()
+	wayWriter.Wait()
+
+	nodeWriter := writer.NewNodeWriter(osmCache, osmCache.Nodes.Iter(), rows,
+		progress,
+		tagmapping.PointMatcher,
+		*srid,
+	)
+	nodeWriter.Start()
+	nodeWriter.Wait()
+	progress.Stop()
+
+	rows.print(os.Stdout)
+}
+
+type sampleRow struct {
+	id       int64
+	geomType string
+	key      string
+	value    string
+	values   []interface{}
+}
+
+type tableRows struct {
+	count   int
+	samples []sampleRow
+}
+
+// rowCollector is a database.Inserter that counts the rows of each table
+// and keeps the first rows as samples.
+type rowCollector struct {
+	mu         sync.Mutex
+	tagmapping *mapping.Mapping
+	maxSamples int
+	tables     map[string]*tableRows
+}
+
+func newRowCollector(tagmapping *mapping.Mapping, maxSamples int) *rowCollector {
+	rc := &rowCollector{
+		tagmapping: tagmapping,
+		maxSamples: maxSamples,
+		tables:     make(map[string]*tableRows),
+	}
+	for name := range tagmapping.Conf.Tables {
+		rc.tables[name] = &tableRows{}
+	}
+	return rc
+}
+
+func (rc *rowCollector) add(elem osm.Element, geomType string, g geom.Geometry, matches []mapping.Match, row func(*mapping.Match) []interface{}) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for i := range matches {
+		match := &matches[i]
+		if !match.AcceptGeometry(&g) {
+			continue
+		}
+		t := rc.tables[match.Table.Name]
+		t.count++
+		if len(t.samples) < rc.maxSamples {
+			t.samples = append(t.samples, sampleRow{
+				id:       elem.ID,
+				geomType: geomType,
+				key:      match.Key,
+				value:    match.Value,
+				values:   row(match),
+			})
+		}
+	}
+}
+
+func (rc *rowCollector) InsertPoint(elem osm.Element, g geom.Geometry, matches []mapping.Match) error {
+	rc.add(elem, "point", g, matches, func(m *mapping.Match) []interface{} { return m.Row(&elem, &g) })
+	return nil
+}
+
+func (rc *rowCollector) InsertLineString(elem osm.Element, g geom.Geometry, matches []mapping.Match) error {
+	rc.add(elem, "linestring", g, matches, func(m *mapping.Match) []interface{} { return m.Row(&elem, &g) })
+	return nil
+}
+
+func (rc *rowCollector) InsertPolygon(elem osm.Element, g geom.Geometry, matches []mapping.Match) error {
+	geomType := "polygon"
+	if g.Geom == nil {
+		geomType = "relation"
+	}
+	rc.add(elem, geomType, g, matches, func(m *mapping.Match) []interface{} { return m.Row(&elem, &g) })
+	return nil
+}
+
+func (rc *rowCollector) InsertRelationMember(rel osm.Relation, member osm.Member, g geom.Geometry, matches []mapping.Match) error {
+	rc.add(rel.Element, "relation member", g, matches, func(m *mapping.Match) []interface{} { return m.MemberRow(&rel, &member, &g) })
+	return nil
+}
+
+func (rc *rowCollector) print(w io.Writer) {
+	names := make([]string, 0, len(rc.tables))
+	for name := range rc.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w)
+	for _, name := range names {
+		fmt.Fprintf(w, "%-30s %10d\n", name, rc.tables[name].count)
+	}
+
+	for _, name := range names {
+		t := rc.tables[name]
+		if len(t.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s (%d of %d):\n", name, len(t.samples), t.count)
+		columns := rc.tagmapping.Conf.Tables[name].Columns
+		for _, s := range t.samples {
+			fmt.Fprintf(w, "  %s %d %s=%s\n", s.geomType, s.id, s.key, s.value)
+			for i, v := range s.values {
+				if i >= len(columns) {
+					break
+				}
+				switch columns[i].Type {
+				case "geometry", "validated_geometry":
+					continue
+				}
+				fmt.Fprintf(w, "    %s: %s\n", columns[i].Name, formatValue(v))
+			}
+		}
+	}
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return fmt.Sprintf("%q", string(v))
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,95 @@
+package mapping
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	toml "github.com/pelletier/go-toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// tomlToYAML converts a TOML document to YAML, so that TOML mappings are
+// decoded with the same rules as YAML mappings. The order of all keys is
+// kept, as the order of the mapping values is significant. Datetimes are
+// converted to strings.
+func tomlToYAML(b []byte) ([]byte, error) {
+	tree, err := toml.LoadBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(tomlTreeToYAML(tree))
+}
+
+// tomlTreeToYAML returns the values of the tree, ordered by their position
+// in the document.
+func tomlTreeToYAML(tree *toml.Tree) yaml.MapSlice {
+	keys := tree.Keys()
+	positions := make(map[string]toml.Position, len(keys))
+	for _, k := range keys {
+		positions[k] = tomlPosition(tree, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return tomlBefore(positions[keys[i]], positions[keys[j]])
+	})
+
+	result := make(yaml.MapSlice, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, yaml.MapItem{Key: k, Value: tomlValueToYAML(tree.GetPath([]string{k}))})
+	}
+	return result
+}
+
+// tomlPosition returns the position of the key. Arrays of tables are
+// positioned by their first table and implicit tables of dotted keys by
+// their first value.
+func tomlPosition(tree *toml.Tree, key string) toml.Position {
+	switch v := tree.GetPath([]string{key}).(type) {
+	case []*toml.Tree:
+		if len(v) > 0 {
+			return v[0].Position()
+		}
+	case *toml.Tree:
+		if v.Position().Invalid() {
+			var first toml.Position
+			for _, k := range v.Keys() {
+				if pos := tomlPosition(v, k); first.Invalid() || tomlBefore(pos, first) {
+					first = pos
+				}
+			}
+			return first
+		}
+	}
+	return tree.GetPositionPath([]string{key})
+}
+
+func tomlBefore(a, b toml.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Col < b.Col
+}
+
+func tomlValueToYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *toml.Tree:
+		return tomlTreeToYAML(v)
+	case []*toml.Tree:
+		result := make([]interface{}, len(v))
+		for i, t := range v {
+			result[i] = tomlTreeToYAML(t)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = tomlValueToYAML(item)
+		}
+		return result
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case toml.LocalDate, toml.LocalTime, toml.LocalDateTime:
+		return fmt.Sprint(v)
+	}
+	return v
+}
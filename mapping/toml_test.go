@@ -0,0 +1,207 @@
+package mapping
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTOMLToYAML(t *testing.T) {
+	for _, tc := range []struct {
+		toml string
+		yaml string
+	}{
+		{`a = 1`, "a: 1\n"},
+		{`# comment
+b = "x" # comment
+a = 'y'`, "b: x\na: \"y\"\n"},
+		{`a.b = true
+a.c = false`, "a:\n  b: true\n  c: false\n"},
+		{`"addr:street" = 1_000`, "addr:street: 1000\n"},
+		{`a = [1, 2.5, "no"]`, "a:\n- 1\n- 2.5\n- \"no\"\n"},
+		{`a = [
+  "x", # comment
+  "y",
+]`, "a:\n- x\n- \"y\"\n"},
+		{`a = {b = 1, c.d = "e"}`, "a:\n  b: 1\n  c:\n    d: e\n"},
+		{`a = "\u00e4\t\"b\""`, "a: \"ä\\t\\\"b\\\"\"\n"},
+		{`a = """
+x \
+  y"""`, "a: x y\n"},
+		{`a = '''
+c:\x'''`, "a: c:\\x\n"},
+		{`a = [0x1f, 0o17, 0b11, -3, +4, 1e3]`, "a:\n- 31\n- 15\n- 3\n- -3\n- 4\n- 1000\n"},
+		{`a = 1979-05-27T07:32:00Z
+b = 1979-05-27 07:32:00`, "a: \"1979-05-27T07:32:00Z\"\nb: 1979-05-27T07:32:00\n"},
+		{`[z]
+b = 1
+[a]
+b = 2`, "z:\n  b: 1\na:\n  b: 2\n"},
+		{`[a.b]
+c = 1
+[a]
+d = 2`, "a:\n  b:\n    c: 1\n  d: 2\n"},
+		{`[[a]]
+b = 1
+[[a]]
+b = 2
+[a.c]
+d = 3`, "a:\n- b: 1\n- b: 2\n  c:\n    d: 3\n"},
+	} {
+		t.Run(tc.toml, func(t *testing.T) {
+			b, err := tomlToYAML([]byte(tc.toml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.yaml {
+				t.Errorf("unexpected yaml\n%s\nexpected\n%s", b, tc.yaml)
+			}
+		})
+	}
+}
+
+func TestTOMLToYAMLErrors(t *testing.T) {
+	for _, tc := range []struct {
+		toml string
+		err  string
+	}{
+		{"a = 1\na = 2", "(2, 1): The following key was defined twice: a"},
+		{"[a]\n[a]", "(2, 2): duplicated tables"},
+		{"a = 1\n[a]", "(2, 2): unknown type for path a"},
+		{"a = {b = 1}\n[a.c]", "(2, 2): could not re-define exist inline table"},
+		{"a = [1]\n[[a]]", "(2, 3): key \"a\" is already assigned and not of type table array"},
+		{"a = 1 b = 2", "(1, 7): parsing error"},
+		{"a = \"b", "(1, 6): unclosed string"},
+		{"a = 012", "invalid base"},
+		{"a = 1__0", "(1, 5): invalid use of _ in number"},
+		{"a = yes", "(1, 5): no value can start with y"},
+		{"a =", "(1, 4): expecting a value"},
+		{"= 1", "(1, 1): unexpected token"},
+	} {
+		t.Run(tc.toml, func(t *testing.T) {
+			_, err := tomlToYAML([]byte(tc.toml))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+const tomlTestMapping = `
+# roads with z-order
+[tables.roads]
+type = "linestring"
+
+[[tables.roads.columns]]
+name = "osm_id"
+type = "id"
+
+[[tables.roads.columns]]
+name = "geometry"
+type = "geometry"
+
+[[tables.roads.columns]]
+name = "type"
+type = "mapping_value"
+
+[tables.roads.mapping]
+highway = ["motorway", "primary"]
+railway = ["rail"]
+
+[tables.roads.filters]
+reject = {area = ["yes"]}
+
+[generalized_tables.roads_gen0]
+source = "roads"
+tolerance = 100
+`
+
+const yamlTestMapping = `
+tables:
+  roads:
+    type: linestring
+    columns:
+      - name: osm_id
+        type: id
+      - name: geometry
+        type: geometry
+      - name: type
+        type: mapping_value
+    mapping:
+      highway: [motorway, primary]
+      railway: [rail]
+    filters:
+      reject:
+        area: ["yes"]
+generalized_tables:
+  roads_gen0:
+    source: roads
+    tolerance: 100.0
+`
+
+func TestNewTOML(t *testing.T) {
+	tm, err := NewTOML([]byte(tomlTestMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ym, err := New([]byte(yamlTestMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// order of the values is kept across keys
+	tmValues := tm.Conf.Tables["roads"].Mapping
+	for k, values := range ym.Conf.Tables["roads"].Mapping {
+		if len(tmValues[k]) != len(values) {
+			t.Fatalf("unexpected values for %s: %v", k, tmValues[k])
+		}
+		for i, v := range values {
+			if tmValues[k][i] != v {
+				t.Errorf("unexpected value for %s: %v != %v", k, tmValues[k][i], v)
+			}
+		}
+	}
+
+	tmChecksum, err := tm.Checksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ymChecksum, err := ym.Checksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmChecksum != ymChecksum {
+		t.Errorf("TOML and YAML mapping differ")
+	}
+}
+
+func TestFromFileTOML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imposm_mapping_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "mapping.toml")
+	if err := ioutil.WriteFile(filename, []byte(tomlTestMapping), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := FromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Conf.Tables["roads"]; !ok {
+		t.Error("missing roads table")
+	}
+
+	// TOML is not valid YAML
+	filename = filepath.Join(dir, "mapping.yml")
+	if err := ioutil.WriteFile(filename, []byte(tomlTestMapping), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromFile(filename); err == nil {
+		t.Error("expected error for TOML in .yml file")
+	}
+}
@@ -59,6 +59,17 @@ BUILD_TMP=$BUILD_BASE/imposm-build
 
 GEOS_VERSION=3.6.2
 
+case `uname -m` in
+    aarch64|arm64)
+        GOARCH_NAME=arm64
+        ARCH_NAME=arm64
+        ;;
+    *)
+        GOARCH_NAME=amd64
+        ARCH_NAME=x86-64
+        ;;
+esac
+
 # If set, build with HyperLevelDB instead of LevelDB
 #WITH_HYPERLEVELDB=1
 
@@ -90,8 +101,8 @@ fi
 if [ ! -e $BUILD_BASE/go/bin/go ]; then
     echo "-> installing go"
     pushd $SRC
-        $CURL https://storage.googleapis.com/golang/go1.9.2.linux-amd64.tar.gz -O
-        tar xzf go1.9.2.linux-amd64.tar.gz -C $BUILD_BASE/
+        $CURL https://storage.googleapis.com/golang/go1.12.17.linux-$GOARCH_NAME.tar.gz -O
+        tar xzf go1.12.17.linux-$GOARCH_NAME.tar.gz -C $BUILD_BASE/
     popd
 fi
 
@@ -212,7 +223,7 @@ popd
 
 
 pushd $BUILD_BASE
-    VERSION=`$BUILD_TMP/imposm version`-linux-x86-64
+    VERSION=`$BUILD_TMP/imposm version`-linux-$ARCH_NAME
     rm -rf imposm-$VERSION
     mv imposm-build imposm-$VERSION
     tar zcvf imposm-$VERSION.tar.gz imposm-$VERSION
@@ -29,3 +29,19 @@ func NodesToMerc(nodes []osm.Node) {
 func NodeToMerc(node *osm.Node) {
 	node.Long, node.Lat = WgsToMerc(node.Long, node.Lat)
 }
+
+// Transformer returns a function that transforms coordinates from one SRID
+// into another. Transformations between EPSG:4326 and EPSG:3857 are built
+// in, all other SRIDs require PROJ (build tag proj). The function returns
+// +Inf for coordinates that can not be transformed.
+func Transformer(from, to int) (func(x, y float64) (float64, float64), error) {
+	switch {
+	case from == to:
+		return func(x, y float64) (float64, float64) { return x, y }, nil
+	case from == 4326 && to == 3857:
+		return WgsToMerc, nil
+	case from == 3857 && to == 4326:
+		return MercToWgs, nil
+	}
+	return projTransformer(from, to)
+}
@@ -27,3 +27,23 @@ func TestMercToWgs(t *testing.T) {
 		t.Fatalf("%v %v", long, lat)
 	}
 }
+
+func TestTransformer(t *testing.T) {
+	f, err := Transformer(4326, 3857)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, y := f(8, 53); math.Abs(x-890555.9263461898) > 1e-6 || math.Abs(y-6982997.920389788) > 1e-6 {
+		t.Errorf("%v %v", x, y)
+	}
+	f, err = Transformer(3857, 4326)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if long, lat := f(890555.9263461898, 6982997.920389788); math.Abs(long-8) > 1e-6 || math.Abs(lat-53) > 1e-6 {
+		t.Errorf("%v %v", long, lat)
+	}
+	if _, err := Transformer(3857, 25832); err == nil {
+		t.Error("expected error for unsupported SRID")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !proj
+// +build !proj
+
+package proj
+
+import "github.com/pkg/errors"
+
+func projTransformer(from, to int) (func(x, y float64) (float64, float64), error) {
+	return nil, errors.Errorf("transformation from EPSG:%d to EPSG:%d requires Imposm built with the proj build tag", from, to)
+}
@@ -0,0 +1,80 @@
+//go:build proj
+// +build proj
+
+package proj
+
+/*
+#cgo LDFLAGS: -lproj
+#include <proj.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// pj is a PROJ transformation with its own context.
+type pj struct {
+	ctx *C.PJ_CONTEXT
+	p   *C.PJ
+}
+
+func newPJ(from, to int) (*pj, error) {
+	ctx := C.proj_context_create()
+	src := C.CString(fmt.Sprintf("EPSG:%d", from))
+	defer C.free(unsafe.Pointer(src))
+	dst := C.CString(fmt.Sprintf("EPSG:%d", to))
+	defer C.free(unsafe.Pointer(dst))
+
+	p := C.proj_create_crs_to_crs(ctx, src, dst, nil)
+	if p == nil {
+		C.proj_context_destroy(ctx)
+		return nil, errors.Errorf("transformation from EPSG:%d to EPSG:%d not supported by PROJ", from, to)
+	}
+	// always use long/lat and east/north order, like EPSG:4326 in PostGIS
+	norm := C.proj_normalize_for_visualization(ctx, p)
+	C.proj_destroy(p)
+	if norm == nil {
+		C.proj_context_destroy(ctx)
+		return nil, errors.Errorf("transformation from EPSG:%d to EPSG:%d not supported by PROJ", from, to)
+	}
+	t := &pj{ctx: ctx, p: norm}
+	runtime.SetFinalizer(t, (*pj).destroy)
+	return t, nil
+}
+
+func (t *pj) destroy() {
+	C.proj_destroy(t.p)
+	C.proj_context_destroy(t.ctx)
+}
+
+// trans returns +Inf for coordinates that can not be transformed.
+func (t *pj) trans(x, y float64) (float64, float64) {
+	c := C.proj_coord(C.double(x), C.double(y), 0, 0)
+	r := C.proj_trans(t.p, C.PJ_FWD, c)
+	xy := (*[4]C.double)(unsafe.Pointer(&r))
+	return float64(xy[0]), float64(xy[1])
+}
+
+// projTransformer returns a transformation with PROJ. The PROJ
+// transformation is created once and shared by all goroutines, as PROJ
+// objects can not be used concurrently.
+func projTransformer(from, to int) (func(x, y float64) (float64, float64), error) {
+	t, err := newPJ(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	return func(x, y float64) (float64, float64) {
+		mu.Lock()
+		x, y = t.trans(x, y)
+		mu.Unlock()
+		return x, y
+	}, nil
+}
@@ -51,6 +51,7 @@ func readersForCpus(cpus int) (int64, int64, int64, int64, int64) {
 }
 
 func ReadPbf(
+	ctx context.Context,
 	filename string,
 	cache *osmcache.OSMCache,
 	progress *stats.Statistics,
@@ -62,17 +63,26 @@ func ReadPbf(
 	ways := make(chan []osm.Way, 4)
 	relations := make(chan []osm.Relation, 4)
 
-	withLimiter := false
-	if limiter != nil {
-		withLimiter = true
-	}
+	// withLimiter only caches nodes within the buffered -limitto geometry
+	// (or within the extended bbox of -limitto, see inCacheArea), and ways
+	// and relations with cached nodes and members.
+	withLimiter := limiter != nil
 
 	config := pbf.Config{
-		Coords:    coords,
-		Nodes:     nodes,
-		Ways:      ways,
-		Relations: relations,
+		Coords:          coords,
+		Nodes:           nodes,
+		Ways:            ways,
+		Relations:       relations,
+		IncludeMetadata: tagmapping.UsesMetadata(),
+	}
+
+	includeUntagged := tagmapping.IncludesUntaggedNodes()
+	if includeUntagged {
+		// parser sends all nodes (with and without tags) to Nodes
+		// if Coords is nil, we store the coords in the nodes loop
+		config.Coords = nil
 	}
+	cache.Nodes.SetIncludeUntagged(includeUntagged)
 
 	// wait for all coords/nodes to be processed before continuing with
 	// ways. required for -limitto checks
@@ -214,7 +224,7 @@ func ReadPbf(
 				}
 				if withLimiter {
 					for i := range nds {
-						if !limiter.IntersectsBuffer(g, nds[i].Long, nds[i].Lat) {
+						if !inCacheArea(limiter, g, nds[i].Long, nds[i].Lat) {
 							skip++
 							nds[i].ID = osmcache.SKIP
 						} else {
@@ -252,18 +262,21 @@ func ReadPbf(
 						numWithTags++
 					}
 					if withLimiter {
-						if !limiter.IntersectsBuffer(g, nds[i].Long, nds[i].Lat) {
+						if !inCacheArea(limiter, g, nds[i].Long, nds[i].Lat) {
 							nds[i].ID = osmcache.SKIP
 						}
 					}
 				}
+				if includeUntagged {
+					cache.Coords.PutCoords(nds)
+					progress.AddCoords(len(nds))
+				}
 				cache.Nodes.PutNodes(nds)
 				progress.AddNodes(numWithTags)
 			}
 			waitWriter.Done()
 		}()
 	}
-	ctx := context.Background()
 	if err := parser.Parse(ctx); err != nil {
 		return errors.Wrap(err, "parsing PBF")
 	}
@@ -271,3 +284,14 @@ func ReadPbf(
 
 	return nil
 }
+
+// inCacheArea returns true if the coord should be cached. This is the
+// buffered -limitto geometry, or the extended bbox of -limitto if the
+// limiter has no buffer (-limittocachebbox). The bbox check is much faster
+// for large -limitto geometries.
+func inCacheArea(limiter *limit.Limiter, g *geos.Geos, long, lat float64) bool {
+	if limiter.HasCacheBuffer() {
+		return limiter.IntersectsBuffer(g, long, lat)
+	}
+	return limiter.InCacheBbox(long, lat)
+}
@@ -0,0 +1,6 @@
+/*
+Package serve provides the serve sub command that renders vector tiles of the
+production tables on the fly and optionally serves a web map to preview
+the imported data.
+*/
+package serve
@@ -0,0 +1,129 @@
+package serve
+
+// layerColors are the colors of the layers in the web map, repeated for
+// mappings with more tables.
+var layerColors = []string{
+	"#e41a1c", "#377eb8", "#4daf4a", "#984ea3", "#ff7f00",
+	"#a65628", "#f781bf", "#999999", "#66c2a5", "#8da0cb",
+}
+
+// style returns the MapLibre style of the web map with a layer for each
+// geometry type of each table. baseURL is the URL of the server.
+func (s *server) style(baseURL string) map[string]interface{} {
+	layers := []interface{}{
+		map[string]interface{}{
+			"id":    "background",
+			"type":  "background",
+			"paint": map[string]interface{}{"background-color": "#f8f8f8"},
+		},
+	}
+	for i, l := range s.tiles.TileLayers() {
+		color := layerColors[i%len(layerColors)]
+		polygons := l.GeometryType != "point" && l.GeometryType != "linestring"
+		lines := l.GeometryType != "point"
+		points := l.GeometryType != "linestring" && l.GeometryType != "polygon"
+		if polygons {
+			layers = append(layers, styleLayer(l.Name, "fill", "Polygon", map[string]interface{}{
+				"fill-color":   color,
+				"fill-opacity": 0.3,
+			}))
+		}
+		if lines {
+			layers = append(layers, styleLayer(l.Name, "line", "", map[string]interface{}{
+				"line-color": color,
+				"line-width": 1.5,
+			}))
+		}
+		if points {
+			layers = append(layers, styleLayer(l.Name, "circle", "Point", map[string]interface{}{
+				"circle-color":  color,
+				"circle-radius": 3,
+			}))
+		}
+	}
+	return map[string]interface{}{
+		"version": 8,
+		"sources": map[string]interface{}{
+			"imposm": map[string]interface{}{
+				"type":    "vector",
+				"tiles":   []string{baseURL + "/tiles/{z}/{x}/{y}.pbf"},
+				"minzoom": s.minZoom,
+				"maxzoom": maxZoom,
+			},
+		},
+		"layers": layers,
+	}
+}
+
+// styleLayer returns a style layer for the features of the table with the
+// geometry type. Lines include the outlines of polygons.
+func styleLayer(table, typ, geometryType string, paint map[string]interface{}) map[string]interface{} {
+	filter := []interface{}{"!=", "$type", "Point"}
+	if geometryType != "" {
+		filter = []interface{}{"==", "$type", geometryType}
+	}
+	return map[string]interface{}{
+		"id":           table + "-" + typ,
+		"type":         typ,
+		"source":       "imposm",
+		"source-layer": table,
+		"filter":       filter,
+		"paint":        paint,
+	}
+}
+
+// previewHTML is the web map. It loads MapLibre GL JS from unpkg.com and
+// shows the properties of the features on click.
+const previewHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Imposm preview</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<link rel="stylesheet" href="https://unpkg.com/maplibre-gl@4/dist/maplibre-gl.css">
+<script src="https://unpkg.com/maplibre-gl@4/dist/maplibre-gl.js"></script>
+<style>
+  body { margin: 0; }
+  #map { position: absolute; top: 0; bottom: 0; width: 100%; }
+  #info { position: absolute; top: 10px; left: 10px; padding: 4px 8px; background: #fff; font: 12px sans-serif; }
+  .maplibregl-popup-content { font: 12px monospace; max-height: 300px; overflow: auto; }
+</style>
+</head>
+<body>
+<div id="map"></div>
+<div id="info"></div>
+<script>
+var map = new maplibregl.Map({container: 'map', style: '/style.json', center: [0, 0], zoom: 1, hash: true});
+map.addControl(new maplibregl.NavigationControl());
+
+function updateInfo() {
+  var minzoom = map.getSource('imposm').minzoom;
+  var info = 'zoom ' + map.getZoom().toFixed(1);
+  if (map.getZoom() < minzoom) {
+    info += ', zoom in to level ' + minzoom + ' to see features';
+  }
+  document.getElementById('info').textContent = info;
+}
+map.on('load', updateInfo);
+map.on('zoomend', updateInfo);
+
+map.on('click', function(e) {
+  var features = map.queryRenderedFeatures(e.point);
+  if (!features.length) {
+    return;
+  }
+  var content = document.createElement('div');
+  features.forEach(function(f) {
+    var title = document.createElement('b');
+    title.textContent = f.sourceLayer;
+    content.appendChild(title);
+    var props = document.createElement('pre');
+    props.textContent = JSON.stringify(f.properties, null, 2);
+    content.appendChild(props);
+  });
+  new maplibregl.Popup().setLngLat(e.lngLat).setDOMContent(content).addTo(map);
+});
+</script>
+</body>
+</html>
+`
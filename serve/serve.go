@@ -0,0 +1,133 @@
+package serve
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/omniscale/imposm3/config"
+	"github.com/omniscale/imposm3/database"
+	_ "github.com/omniscale/imposm3/database/postgis"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/pkg/errors"
+)
+
+// maxZoom is the highest zoom level of the tiles. The web map scales the
+// tiles of this level for higher zoom levels.
+const maxZoom = 20
+
+// Serve renders the vector tiles of the production tables and serves them
+// (and the web map with -preview) till the process is stopped.
+func Serve(opts config.Serve) {
+	tagmapping, err := mapping.FromFile(opts.Base.MappingFile)
+	if err != nil {
+		log.Fatal("[fatal] reading mapping: ", err)
+	}
+
+	dbConf := database.Config{
+		ConnectionParams: opts.Base.Connection,
+		Srid:             opts.Base.Srid,
+		// we serve the tables of the Production schema
+		ImportSchema:     opts.Base.Schemas.Production,
+		ProductionSchema: opts.Base.Schemas.Production,
+		BackupSchema:     opts.Base.Schemas.Backup,
+	}
+	db, err := database.Open(dbConf, &tagmapping.Conf)
+	if err != nil {
+		log.Fatal("[fatal] opening database: ", err)
+	}
+	defer db.Close()
+
+	renderer, ok := db.(database.TileRenderer)
+	if !ok {
+		log.Fatal("[fatal] database does not support vector tiles")
+	}
+
+	s := &server{tiles: renderer, minZoom: opts.MinZoom, preview: opts.Preview}
+	log.Printf("[info] Serving vector tiles of schema %s at http://%s/tiles/{z}/{x}/{y}.pbf",
+		opts.Base.Schemas.Production, opts.Addr)
+	if opts.Preview {
+		log.Printf("[info] Serving preview at http://%s/", opts.Addr)
+	}
+	if err := http.ListenAndServe(opts.Addr, s.handler()); err != nil {
+		log.Fatal("[fatal] ", err)
+	}
+}
+
+type server struct {
+	tiles   database.TileRenderer
+	minZoom int
+	preview bool
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tiles/", s.serveTile)
+	if s.preview {
+		mux.HandleFunc("/style.json", s.serveStyle)
+		mux.HandleFunc("/", s.servePreview)
+	}
+	return mux
+}
+
+// parseTilePath returns the tile of paths like /tiles/14/8800/5373.pbf.
+func parseTilePath(path string) (z, x, y int, err error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/tiles/"), "/")
+	if len(parts) != 3 || !strings.HasSuffix(parts[2], ".pbf") {
+		return 0, 0, 0, errors.Errorf("invalid tile path %q", path)
+	}
+	parts[2] = strings.TrimSuffix(parts[2], ".pbf")
+	var zxy [3]int
+	for i, p := range parts {
+		if zxy[i], err = strconv.Atoi(p); err != nil {
+			return 0, 0, 0, errors.Errorf("invalid tile path %q", path)
+		}
+	}
+	z, x, y = zxy[0], zxy[1], zxy[2]
+	if z < 0 || z > maxZoom || x < 0 || y < 0 || x >= 1<<uint(z) || y >= 1<<uint(z) {
+		return 0, 0, 0, errors.Errorf("invalid tile %d/%d/%d", z, x, y)
+	}
+	return z, x, y, nil
+}
+
+func (s *server) serveTile(w http.ResponseWriter, r *http.Request) {
+	z, x, y, err := parseTilePath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var tile []byte
+	if z >= s.minZoom {
+		tile, err = s.tiles.Tile(z, x, y)
+		if err != nil {
+			log.Printf("[error] Rendering tile %d/%d/%d: %s", z, x, y, err)
+			http.Error(w, "rendering tile failed", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	// the tables change with each diff import
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(tile)
+}
+
+func (s *server) servePreview(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(previewHTML))
+}
+
+func (s *server) serveStyle(w http.ResponseWriter, r *http.Request) {
+	b, err := json.Marshal(s.style("http://" + r.Host))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,153 @@
+package serve
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/omniscale/imposm3/database"
+)
+
+func TestParseTilePath(t *testing.T) {
+	for _, tt := range []struct {
+		path    string
+		z, x, y int
+		err     bool
+	}{
+		{"/tiles/0/0/0.pbf", 0, 0, 0, false},
+		{"/tiles/14/8800/5373.pbf", 14, 8800, 5373, false},
+		{"/tiles/14/8800/5373", 0, 0, 0, true},
+		{"/tiles/1/2/0.pbf", 0, 0, 0, true},
+		{"/tiles/-1/0/0.pbf", 0, 0, 0, true},
+		{"/tiles/21/0/0.pbf", 0, 0, 0, true},
+		{"/tiles/1/0.pbf", 0, 0, 0, true},
+		{"/tiles/a/0/0.pbf", 0, 0, 0, true},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			z, x, y, err := parseTilePath(tt.path)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if z != tt.z || x != tt.x || y != tt.y {
+				t.Errorf("unexpected tile %d/%d/%d", z, x, y)
+			}
+		})
+	}
+}
+
+type testTiles struct {
+	rendered []int
+}
+
+func (t *testTiles) TileLayers() []database.TileLayer {
+	return []database.TileLayer{
+		{Name: "buildings", GeometryType: "polygon"},
+		{Name: "roads", GeometryType: "linestring"},
+		{Name: "members", GeometryType: "relation_member"},
+	}
+}
+
+func (t *testTiles) Tile(z, x, y int) ([]byte, error) {
+	t.rendered = append(t.rendered, z, x, y)
+	return []byte{0x1a, 0x00}, nil
+}
+
+func TestServeTile(t *testing.T) {
+	tiles := &testTiles{}
+	s := &server{tiles: tiles, minZoom: 10}
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		path   string
+		status int
+		size   int
+	}{
+		{"/tiles/12/2200/1343.pbf", 200, 2},
+		{"/tiles/9/275/167.pbf", 200, 0},
+		{"/tiles/9/275/1670.pbf", 404, -1},
+		{"/style.json", 404, -1},
+	} {
+		resp, err := http.Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: unexpected status %d", tt.path, resp.StatusCode)
+			continue
+		}
+		if tt.size != -1 && len(body) != tt.size {
+			t.Errorf("%s: unexpected tile size %d", tt.path, len(body))
+		}
+	}
+	if len(tiles.rendered) != 3 || tiles.rendered[0] != 12 {
+		t.Errorf("unexpected rendered tiles %v", tiles.rendered)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	s := &server{tiles: &testTiles{}, minZoom: 10, preview: true}
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/style.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	style := struct {
+		Sources map[string]struct {
+			Tiles   []string
+			MinZoom int
+		}
+		Layers []struct {
+			ID          string
+			SourceLayer string `json:"source-layer"`
+		}
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&style); err != nil {
+		t.Fatal(err)
+	}
+	src := style.Sources["imposm"]
+	if len(src.Tiles) != 1 || src.Tiles[0] != srv.URL+"/tiles/{z}/{x}/{y}.pbf" || src.MinZoom != 10 {
+		t.Errorf("unexpected source %v", src)
+	}
+	ids := []string{}
+	for _, l := range style.Layers {
+		ids = append(ids, l.ID)
+	}
+	expected := []string{
+		"background",
+		"buildings-fill", "buildings-line",
+		"roads-line",
+		"members-fill", "members-line", "members-circle",
+	}
+	if len(ids) != len(expected) {
+		t.Fatalf("unexpected layers %v", ids)
+	}
+	for i := range ids {
+		if ids[i] != expected[i] {
+			t.Errorf("unexpected layers %v", ids)
+			break
+		}
+	}
+
+	resp, err = http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("unexpected response %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
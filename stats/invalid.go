@@ -0,0 +1,46 @@
+package stats
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/omniscale/imposm3/log"
+)
+
+// InvalidValues counts tag values that could not be converted by a column
+// (e.g. unparsable dates), by column type.
+var InvalidValues = &invalidValues{counts: make(map[string]int64)}
+
+type invalidValues struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (iv *invalidValues) Add(columnType string) {
+	iv.mu.Lock()
+	iv.counts[columnType]++
+	iv.mu.Unlock()
+}
+
+// Counts returns the current counts and resets all counters.
+func (iv *invalidValues) Counts() map[string]int64 {
+	iv.mu.Lock()
+	defer iv.mu.Unlock()
+	counts := iv.counts
+	iv.counts = make(map[string]int64)
+	return counts
+}
+
+// LogInvalidValues logs the number of invalid values for each column
+// type and resets all counters.
+func LogInvalidValues() {
+	counts := InvalidValues.Counts()
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		log.Printf("[warn] %d invalid values for %s columns inserted as NULL", counts[t], t)
+	}
+}
@@ -0,0 +1,112 @@
+package stats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MultipolygonError is a problem of a multipolygon relation. The relation
+// is skipped or only partially imported (e.g. without an unclosed ring).
+type MultipolygonError struct {
+	RelationID int64 `json:"relation_id"`
+	// MemberID is the ID of the missing member, if known.
+	MemberID int64  `json:"member_id,omitempty"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message"`
+	// Location is the X and Y coordinate (in the SRID of the import) of
+	// the problem, if known.
+	Location []float64 `json:"location,omitempty"`
+}
+
+// MultipolygonErrors collects the errors of all multipolygon relations that
+// are built during an import. It is disabled till Enable is called.
+var MultipolygonErrors = &multipolygonErrors{}
+
+type multipolygonErrors struct {
+	mu      sync.Mutex
+	enabled bool
+	errors  []MultipolygonError
+}
+
+// Enable starts the collection.
+func (m *multipolygonErrors) Enable() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = true
+	m.errors = nil
+}
+
+// Enabled returns whether errors are collected.
+func (m *multipolygonErrors) Enabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.enabled
+}
+
+// Add records an error.
+func (m *multipolygonErrors) Add(e MultipolygonError) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.enabled {
+		return
+	}
+	m.errors = append(m.errors, e)
+}
+
+// Errors returns all collected errors, sorted by relation ID and reason.
+func (m *multipolygonErrors) Errors() []MultipolygonError {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := append([]MultipolygonError{}, m.errors...)
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.RelationID != b.RelationID {
+			return a.RelationID < b.RelationID
+		}
+		if a.Reason != b.Reason {
+			return a.Reason < b.Reason
+		}
+		return a.Message < b.Message
+	})
+	return result
+}
+
+type multipolygonReport struct {
+	Created time.Time           `json:"created"`
+	Counts  map[string]int      `json:"counts"`
+	Errors  []MultipolygonError `json:"errors"`
+}
+
+// WriteReport writes all collected errors as JSON into a new report file
+// in dir. Returns the name of the report file.
+func (m *multipolygonErrors) WriteReport(dir string) (string, error) {
+	now := time.Now().UTC()
+	report := multipolygonReport{
+		Created: now,
+		Counts:  make(map[string]int),
+		Errors:  m.Errors(),
+	}
+	for _, e := range report.Errors {
+		report.Counts[e.Reason]++
+	}
+
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", errors.Wrap(err, "encoding multipolygon report")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.Wrap(err, "creating report dir")
+	}
+	filename := filepath.Join(dir, "multipolygons-"+now.Format("20060102T150405Z")+".json")
+	if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+		return "", errors.Wrap(err, "writing multipolygon report")
+	}
+	return filename, nil
+}
@@ -0,0 +1,185 @@
+package stats
+
+import (
+	"container/heap"
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Reasons for skipped elements.
+const (
+	SkipMissingRefs     = "missing_refs"
+	SkipInvalidGeometry = "invalid_geometry"
+	SkipOutsideLimitTo  = "outside_limitto"
+	SkipFiltered        = "filtered"
+	SkipTooManyTags     = "too_many_tags"
+	SkipPanic           = "panic"
+)
+
+// SkippedElements collects the IDs of elements that matched the mapping but
+// were not imported, by reason and element type. It is disabled till
+// Enable is called.
+//
+// The collected IDs do not depend on the order of the Add calls: only
+// IDs that pass the sampling are collected and only the lowest IDs are
+// kept if there are more than the limit. The same import results in the
+// same report, regardless of the number of parallel writers.
+var SkippedElements = &skippedElements{}
+
+type skippedElements struct {
+	mu      sync.Mutex
+	enabled bool
+	limit   int
+	sample  int
+	skipped map[skippedKey]*skippedIDs
+}
+
+type skippedKey struct {
+	reason   string
+	elemType string
+}
+
+type skippedIDs struct {
+	count int64
+	ids   idHeap
+}
+
+// Enable starts the collection. limit is the max number of IDs for each
+// reason and element type, sample only collects every n-th ID (based on a
+// hash of the ID). All IDs are counted.
+func (s *skippedElements) Enable(limit, sample int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sample < 1 {
+		sample = 1
+	}
+	s.enabled = true
+	s.limit = limit
+	s.sample = sample
+	s.skipped = make(map[skippedKey]*skippedIDs)
+}
+
+// Add records that the element with the OSM ID was skipped.
+// elemType is node, way or relation.
+func (s *skippedElements) Add(reason, elemType string, id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.enabled {
+		return
+	}
+	key := skippedKey{reason, elemType}
+	ids, ok := s.skipped[key]
+	if !ok {
+		ids = &skippedIDs{}
+		s.skipped[key] = ids
+	}
+	ids.count++
+	if !sampled(id, s.sample) || s.limit <= 0 {
+		return
+	}
+	if len(ids.ids) < s.limit {
+		heap.Push(&ids.ids, id)
+	} else if id < ids.ids[0] {
+		ids.ids[0] = id
+		heap.Fix(&ids.ids, 0)
+	}
+}
+
+func sampled(id int64, sample int) bool {
+	if sample <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	b := [8]byte{}
+	for i := range b {
+		b[i] = byte(id >> (8 * uint(i)))
+	}
+	h.Write(b[:])
+	return h.Sum32()%uint32(sample) == 0
+}
+
+type skippedReport struct {
+	Created time.Time           `json:"created"`
+	Limit   int                 `json:"limit"`
+	Sample  int                 `json:"sample"`
+	Skipped []skippedReportItem `json:"skipped"`
+}
+
+type skippedReportItem struct {
+	Reason string  `json:"reason"`
+	Type   string  `json:"type"`
+	Count  int64   `json:"count"`
+	IDs    []int64 `json:"ids"`
+}
+
+// WriteReport writes all collected IDs as JSON into a new report file in
+// dir and resets the collection. Returns the name of the report file or an
+// empty string if the collection is disabled.
+func (s *skippedElements) WriteReport(dir string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.enabled {
+		return "", nil
+	}
+
+	now := time.Now().UTC()
+	report := skippedReport{
+		Created: now,
+		Limit:   s.limit,
+		Sample:  s.sample,
+		Skipped: []skippedReportItem{},
+	}
+	for key, ids := range s.skipped {
+		item := skippedReportItem{
+			Reason: key.reason,
+			Type:   key.elemType,
+			Count:  ids.count,
+			IDs:    append([]int64{}, ids.ids...),
+		}
+		sort.Slice(item.IDs, func(i, j int) bool { return item.IDs[i] < item.IDs[j] })
+		report.Skipped = append(report.Skipped, item)
+	}
+	sort.Slice(report.Skipped, func(i, j int) bool {
+		a, b := report.Skipped[i], report.Skipped[j]
+		if a.Reason != b.Reason {
+			return a.Reason < b.Reason
+		}
+		return a.Type < b.Type
+	})
+
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", errors.Wrap(err, "encoding skipped elements report")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.Wrap(err, "creating report dir")
+	}
+	filename := filepath.Join(dir, "skipped-"+now.Format("20060102T150405Z")+".json")
+	if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+		return "", errors.Wrap(err, "writing skipped elements report")
+	}
+	s.skipped = make(map[skippedKey]*skippedIDs)
+	return filename, nil
+}
+
+// idHeap is a max-heap, to drop the largest ID if the limit is reached.
+type idHeap []int64
+
+func (h idHeap) Len() int            { return len(h) }
+func (h idHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h idHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *idHeap) Push(x interface{}) { *h = append(*h, x.(int64)) }
+func (h *idHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,367 @@
+package stats
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/log"
+)
+
+const (
+	traceBatchSize     = 256
+	traceFlushInterval = 5 * time.Second
+	traceStopTimeout   = 10 * time.Second
+)
+
+// tracer exports spans of the import and diff processes to an
+// OpenTelemetry collector with OTLP/HTTP (JSON encoding). All span
+// functions are no-ops till StartTracing is called.
+var tracer struct {
+	mu      sync.Mutex
+	enabled bool
+	url     string
+	headers map[string]string
+	service string
+	// active spans, started with StartSpan
+	active []*Span
+	spans  chan *Span
+	done   chan struct{}
+}
+
+// Span is a single timed operation. A nil *Span is valid and all methods
+// are no-ops, so callers do not need to check whether tracing is enabled.
+type Span struct {
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	err      string
+
+	mu    sync.Mutex
+	attrs map[string]interface{}
+}
+
+// StartTracing enables the export of spans to the OTLP/HTTP endpoint
+// (e.g. http://localhost:4318). The service name and additional HTTP
+// headers are taken from OTEL_SERVICE_NAME and OTEL_EXPORTER_OTLP_HEADERS.
+func StartTracing(endpoint string) {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	if tracer.enabled {
+		return
+	}
+	tracer.enabled = true
+	tracer.url = strings.TrimRight(endpoint, "/") + "/v1/traces"
+	tracer.service = os.Getenv("OTEL_SERVICE_NAME")
+	if tracer.service == "" {
+		tracer.service = "imposm"
+	}
+	tracer.headers = make(map[string]string)
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			tracer.headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	tracer.spans = make(chan *Span, traceBatchSize*4)
+	tracer.done = make(chan struct{})
+	go exportSpans(tracer.spans, tracer.done)
+	// log.Fatal exits without returning to the caller of StartTracing
+	log.OnFatal(StopTracing)
+}
+
+// StopTracing exports all remaining spans. Spans that end after
+// StopTracing are dropped.
+func StopTracing() {
+	tracer.mu.Lock()
+	if !tracer.enabled {
+		tracer.mu.Unlock()
+		return
+	}
+	tracer.enabled = false
+	close(tracer.spans)
+	done := tracer.done
+	tracer.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(traceStopTimeout):
+		log.Println("[warn] Timeout while exporting traces")
+	}
+}
+
+// StartSpan starts a new span as a child of the active span. The new span
+// is the active span till it ends. Use this for the sequential phases of
+// an import. Returns nil if tracing is disabled.
+func StartSpan(name string) *Span {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	if !tracer.enabled {
+		return nil
+	}
+	var parent *Span
+	if len(tracer.active) > 0 {
+		parent = tracer.active[len(tracer.active)-1]
+	}
+	s := newSpan(parent, name)
+	tracer.active = append(tracer.active, s)
+	return s
+}
+
+// StartChildSpan starts a new span as a child of parent, or as a child
+// of the active span if parent is nil. The active span is not changed, so
+// this can be used for concurrent operations. Returns nil if tracing is
+// disabled.
+func StartChildSpan(parent *Span, name string) *Span {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	if !tracer.enabled {
+		return nil
+	}
+	if parent == nil && len(tracer.active) > 0 {
+		parent = tracer.active[len(tracer.active)-1]
+	}
+	return newSpan(parent, name)
+}
+
+func newSpan(parent *Span, name string) *Span {
+	s := &Span{
+		spanID: randomHex(8),
+		name:   name,
+		start:  time.Now(),
+	}
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		s.traceID = randomHex(16)
+	}
+	return s
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// fall back to the time, IDs only need to be unique
+		for i := range b {
+			b[i] = byte(time.Now().UnixNano() >> (8 * uint(i%8)))
+		}
+	}
+	return hex.EncodeToString(b)
+}
+
+// SetAttribute sets an attribute of the span. value should be a string,
+// bool, integer or float.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+// SetError marks the span as failed if err is not nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End ends the span and queues it for the export.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	for i := len(tracer.active) - 1; i >= 0; i-- {
+		if tracer.active[i] == s {
+			tracer.active = append(tracer.active[:i], tracer.active[i+1:]...)
+			break
+		}
+	}
+	if !tracer.enabled || !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+	select {
+	case tracer.spans <- s:
+	default:
+		// do not block the import if the collector is slow
+	}
+}
+
+func exportSpans(spans chan *Span, done chan struct{}) {
+	defer close(done)
+	tick := time.NewTicker(traceFlushInterval)
+	defer tick.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := postSpans(batch); err != nil {
+			log.Println("[warn] Exporting traces:", err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case s, ok := <-spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= traceBatchSize {
+				flush()
+			}
+		case <-tick.C:
+			flush()
+		}
+	}
+}
+
+// OTLP JSON encoding, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusError      = 2
+)
+
+func otlpValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int32:
+		return map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float32:
+		return map[string]interface{}{"doubleValue": float64(v)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+}
+
+func postSpans(spans []*Span) error {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/omniscale/imposm3"}}
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		for k, v := range s.attrs {
+			span.Attributes = append(span.Attributes, otlpKeyValue{k, otlpValue(v)})
+		}
+		if s.err != "" {
+			span.Status = &otlpStatus{Code: otlpStatusError, Message: s.err}
+		}
+		s.mu.Unlock()
+		scope.Spans = append(scope.Spans, span)
+	}
+	body, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{
+			{"service.name", otlpValue(tracer.service)},
+		}},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}})
+	if err != nil {
+		return errors.Wrap(err, "encoding spans")
+	}
+
+	req, err := http.NewRequest("POST", tracer.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range tracer.headers {
+		req.Header.Set(k, v)
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("unexpected status %s from %s", resp.Status, tracer.url)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package throttle
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule is a time window in the format of a crontab entry: minute,
+// hour, day of month, month and day of week. Each field is *, a number, a
+// range (8-19) or a list of these (1,3,5), optionally with a step (*/15,
+// 8-18/2). Day of week is 0-7, with 0 and 7 for Sunday. A time is in the
+// window if all fields match, except that day of month or day of week
+// needs to match if both are restricted (as in cron).
+type Schedule struct {
+	spec   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool
+	anyDow bool
+}
+
+type fieldRange struct {
+	name     string
+	min, max int
+}
+
+var fieldRanges = []fieldRange{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseSchedule parses a time window in the crontab format, e.g.
+// "* 8-19 * * 1-5" for working days from 8:00 to 19:59.
+func ParseSchedule(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("schedule %q requires 5 fields, found %d", spec, len(fields))
+	}
+	s := &Schedule{spec: spec}
+	bits := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, f := range fields {
+		b, err := parseField(f, fieldRanges[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "schedule %q", spec)
+		}
+		*bits[i] = b
+	}
+	s.anyDom = fields[2] == "*"
+	s.anyDow = fields[4] == "*"
+	if s.dow&(1<<7) != 0 {
+		// 7 is Sunday as well
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseField(field string, r fieldRange) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[idx+1:])
+			if err != nil || step < 1 {
+				return 0, errors.Errorf("invalid step in %s %q", r.name, part)
+			}
+			part = part[:idx]
+		}
+		min, max := r.min, r.max
+		if part != "*" {
+			var err error
+			if idx := strings.Index(part, "-"); idx >= 0 {
+				min, err = strconv.Atoi(part[:idx])
+				if err == nil {
+					max, err = strconv.Atoi(part[idx+1:])
+				}
+			} else {
+				min, err = strconv.Atoi(part)
+				max = min
+			}
+			if err != nil {
+				return 0, errors.Errorf("invalid %s %q", r.name, part)
+			}
+			if min < r.min || max > r.max || min > max {
+				return 0, errors.Errorf("%s %q not within %d-%d", r.name, part, r.min, r.max)
+			}
+		}
+		for i := min; i <= max; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+// Match returns whether t is within the window.
+func (s *Schedule) Match(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 ||
+		s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if !s.anyDom && !s.anyDow {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
@@ -0,0 +1,112 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, tc := range []struct {
+		spec  string
+		time  string
+		match bool
+	}{
+		// Monday
+		{"* 8-19 * * 1-5", "2019-06-03 08:00", true},
+		{"* 8-19 * * 1-5", "2019-06-03 19:59", true},
+		{"* 8-19 * * 1-5", "2019-06-03 20:00", false},
+		{"* 8-19 * * 1-5", "2019-06-03 07:59", false},
+		// Sunday
+		{"* 8-19 * * 1-5", "2019-06-02 12:00", false},
+		{"* * * * 7", "2019-06-02 12:00", true},
+		{"* * * * 0", "2019-06-02 12:00", true},
+		{"*/15 * * * *", "2019-06-02 12:30", true},
+		{"*/15 * * * *", "2019-06-02 12:31", false},
+		{"0-29 12,18 * * *", "2019-06-02 18:10", true},
+		{"0-29 12,18 * * *", "2019-06-02 18:40", false},
+		{"* * 1 6 *", "2019-06-01 00:00", true},
+		{"* * 1 6 *", "2019-07-01 00:00", false},
+		// day of month or day of week if both are restricted
+		{"* * 1 * 1", "2019-06-03 00:00", true},
+		{"* * 1 * 1", "2019-06-01 00:00", true},
+		{"* * 1 * 1", "2019-06-04 00:00", false},
+	} {
+		s, err := ParseSchedule(tc.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tm, err := time.Parse("2006-01-02 15:04", tc.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := s.Match(tm); m != tc.match {
+			t.Errorf("unexpected match %v of %q for %s", m, tc.spec, tc.time)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"* 19-8 * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	if th, err := New(nil, 0); err != nil || th != nil {
+		t.Fatal("expected nil throttle without windows", th, err)
+	}
+	if _, err := New([]string{"* * * * *"}, 0); err == nil {
+		t.Fatal("expected error for missing rate")
+	}
+
+	th, err := New([]string{"* 8-19 * * *"}, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now, _ := time.Parse("2006-01-02 15:04", "2019-06-03 07:00")
+	th.now = func() time.Time { return now }
+	th.Wait(context.Background(), 1)
+	if !th.next.IsZero() {
+		t.Error("throttled outside of window")
+	}
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 10; i++ {
+		th.Wait(context.Background(), 1)
+	}
+	th.Wait(context.Background(), 0)
+	if d := th.next.Sub(now); d != 10*time.Millisecond {
+		t.Errorf("unexpected delay %s", d)
+	}
+
+	// 500 rows in 200ms need a pause of 300ms, but no pause outside of
+	// the windows
+	if d := th.pause(500, now.Add(-200*time.Millisecond)); d != 300*time.Millisecond {
+		t.Errorf("unexpected pause %s", d)
+	}
+	if d := th.pause(100, now.Add(-200*time.Millisecond)); d > 0 {
+		t.Errorf("unexpected pause %s", d)
+	}
+	now = now.Add(12 * time.Hour)
+	if d := th.pause(500, now.Add(-200*time.Millisecond)); d > 0 {
+		t.Errorf("paused outside of window %s", d)
+	}
+
+	var nilThrottle *Throttle
+	nilThrottle.Wait(context.Background(), 1)
+	nilThrottle.Pause(context.Background(), 1, now)
+}
@@ -0,0 +1,141 @@
+/*
+Package throttle limits the rate of written rows during configured time
+windows, e.g. to reduce the load of imports on shared database hosts during
+the day.
+*/
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/log"
+)
+
+// Throttle limits the number of written rows per second while the current
+// time is within one of the windows. Rows are not limited outside of the
+// windows. A nil Throttle never limits.
+type Throttle struct {
+	windows  []*Schedule
+	interval time.Duration
+
+	mu     sync.Mutex
+	next   time.Time
+	active bool
+	now    func() time.Time
+}
+
+// New returns a Throttle that limits to rate rows per second during
+// the windows (in the crontab format of ParseSchedule). Returns nil if no
+// windows are configured.
+func New(windows []string, rate int) (*Throttle, error) {
+	if len(windows) == 0 {
+		return nil, nil
+	}
+	if rate <= 0 {
+		return nil, errors.New("throttle rate needs to be larger than 0")
+	}
+	t := &Throttle{
+		interval: time.Second / time.Duration(rate),
+		now:      time.Now,
+	}
+	for _, w := range windows {
+		s, err := ParseSchedule(w)
+		if err != nil {
+			return nil, err
+		}
+		t.windows = append(t.windows, s)
+	}
+	return t, nil
+}
+
+// Active returns whether now is within one of the windows.
+func (t *Throttle) Active(now time.Time) bool {
+	for _, w := range t.windows {
+		if w.Match(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait blocks until the next rows can be written. It returns immediately
+// outside of the windows or if ctx is done. Wait is safe for concurrent
+// use and the rate is shared by all callers. Wait is only suited for bulk
+// imports, use Pause between the transactions of diff imports.
+func (t *Throttle) Wait(ctx context.Context, rows int) {
+	if t == nil || rows <= 0 {
+		return
+	}
+	now := t.now()
+	if !t.checkActive(now) {
+		return
+	}
+
+	t.mu.Lock()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	wait := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(rows) * t.interval)
+	t.mu.Unlock()
+
+	sleep(ctx, wait)
+}
+
+// Pause blocks after a transaction that started at start and wrote rows,
+// till the rate of the transaction is within the limit. Transactions are
+// not paused outside of the windows, so that they do not hold any locks
+// while waiting.
+func (t *Throttle) Pause(ctx context.Context, rows int64, start time.Time) {
+	if t == nil {
+		return
+	}
+	sleep(ctx, t.pause(rows, start))
+}
+
+// pause returns the time to wait after rows were written since start.
+func (t *Throttle) pause(rows int64, start time.Time) time.Duration {
+	now := t.now()
+	if rows <= 0 || !t.checkActive(now) {
+		return 0
+	}
+	return start.Add(time.Duration(rows) * t.interval).Sub(now)
+}
+
+// checkActive returns whether now is within one of the windows and logs
+// when the throttling starts or stops.
+func (t *Throttle) checkActive(now time.Time) bool {
+	active := t.Active(now)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if active != t.active {
+		t.active = active
+		if active {
+			log.Printf("[info] Throttling to %d rows/s", time.Second/t.interval)
+		} else {
+			log.Printf("[info] Throttling stopped")
+		}
+	}
+	return active
+}
+
+// sleep blocks for d or till ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	if ctx == nil {
+		time.Sleep(d)
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/omniscale/imposm3/element"
 	"github.com/omniscale/imposm3/expire"
 	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/writer"
 )
 
 type Deleter struct {
@@ -20,12 +21,17 @@ type Deleter struct {
 	tmRelationMember mapping.RelationMatcher
 	expireor         expire.Expireor
 	singleIDSpace    bool
+	rejects          database.RejectWriter
+	// oldStyleMultipolygons matches multipolygon relations with the tags
+	// of their outer ways, like the RelationWriter
+	oldStyleMultipolygons bool
 
 	// Cache deleted nodes with lat/long and ways with refs, to be able to
 	// calculate expire tiles when nodes/ways are removed before the depending
 	// ways/relations.
-	deletedNodes map[int64]osm.Node
-	deletedWays  map[int64][]int64
+	deletedNodes   map[int64]osm.Node
+	deletedWays    map[int64][]int64
+	deletedWayTags map[int64]osm.Tags
 
 	// Cache deleted elements to avoid processing them multiple times.
 	deletedRelations map[int64]struct{}
@@ -40,8 +46,10 @@ func NewDeleter(db database.Deleter, osmCache *cache.OSMCache, diffCache *cache.
 	tmRelation mapping.RelationMatcher,
 	tmRelationMember mapping.RelationMatcher,
 ) *Deleter {
+	rejects, _ := db.(database.RejectWriter)
 	return &Deleter{
 		delDb:            db,
+		rejects:          rejects,
 		osmCache:         osmCache,
 		diffCache:        diffCache,
 		tmPoints:         tmPoints,
@@ -53,14 +61,30 @@ func NewDeleter(db database.Deleter, osmCache *cache.OSMCache, diffCache *cache.
 		deletedNodes:     make(map[int64]osm.Node),
 		deletedRelations: make(map[int64]struct{}),
 		deletedWays:      make(map[int64][]int64),
+		deletedWayTags:   make(map[int64]osm.Tags),
 		deletedMembers:   make(map[int64]struct{}),
 	}
 }
 
+// deleteRejects removes the rejects of an element that is written again
+// or deleted.
+func (d *Deleter) deleteRejects(elemType string, id int64) error {
+	if d.rejects == nil {
+		return nil
+	}
+	return d.rejects.DeleteRejects(elemType, id)
+}
+
 func (d *Deleter) SetExpireor(exp expire.Expireor) {
 	d.expireor = exp
 }
 
+// SetOldStyleMultipolygons enables the matching of multipolygon relations
+// with the tags of their outer ways. Needs to match the RelationWriter.
+func (d *Deleter) SetOldStyleMultipolygons(enabled bool) {
+	d.oldStyleMultipolygons = enabled
+}
+
 func (d *Deleter) DeletedMemberWays() map[int64]struct{} {
 	return d.deletedMembers
 }
@@ -96,6 +120,31 @@ func (d *Deleter) deleteRelation(id int64, deleteRefs bool, deleteMembers bool)
 	if elem.Tags == nil {
 		return nil
 	}
+	if err := d.deleteRejects("relation", id); err != nil {
+		return err
+	}
+
+	if d.oldStyleMultipolygons && writer.IsOldStyleMultipolygon(elem, d.tmPolygons) {
+		members := make([]osm.Member, len(elem.Members))
+		copy(members, elem.Members)
+		if err := d.fillOuterWays(members); err != nil {
+			return err
+		}
+		writer.AddOuterWayTags(elem, members)
+		if deleteMembers {
+			// outer ways were not inserted as separate polygons, re-insert
+			// them in case they are no longer part of the relation
+			for _, m := range members {
+				if m.Way == nil || m.Role != "outer" {
+					continue
+				}
+				if err := d.deleteWay(m.ID, false); err != nil {
+					return err
+				}
+				d.deletedMembers[m.ID] = struct{}{}
+			}
+		}
+	}
 
 	deleted := false
 	deletedPolygon := false
@@ -168,9 +217,13 @@ func (d *Deleter) deleteWay(id int64, deleteRefs bool) error {
 	}
 
 	d.deletedWays[id] = elem.Refs
+	d.deletedWayTags[id] = elem.Tags
 	if elem.Tags == nil {
 		return nil
 	}
+	if err := d.deleteRejects("way", id); err != nil {
+		return err
+	}
 	deleted := false
 	deletedPolygon := false
 	if matches := d.tmPolygons.MatchWay(elem); len(matches) > 0 {
@@ -225,6 +278,9 @@ func (d *Deleter) deleteNode(id int64) error {
 	if elem.Tags == nil {
 		return nil
 	}
+	if err := d.deleteRejects("node", id); err != nil {
+		return err
+	}
 	deleted := false
 
 	if matches := d.tmPoints.MatchNode(elem); len(matches) > 0 {
@@ -326,6 +382,27 @@ func (d *Deleter) fillWayFromDeleted(w *osm.Way) {
 	}
 }
 
+// fillOuterWays sets the ways of all outer members, including ways that
+// were deleted before the relation.
+func (d *Deleter) fillOuterWays(members []osm.Member) error {
+	for i, m := range members {
+		if m.Type != osm.WayMember || m.Role != "outer" {
+			continue
+		}
+		way, err := d.osmCache.Ways.GetWay(m.ID)
+		if err == cache.NotFound {
+			if tags, ok := d.deletedWayTags[m.ID]; ok {
+				members[i].Way = &osm.Way{Element: osm.Element{ID: m.ID, Tags: tags}}
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		members[i].Way = way
+	}
+	return nil
+}
+
 func (d *Deleter) fillMembersFromDeleted(members []osm.Member) {
 	for i, m := range members {
 		if m.Type == osm.WayMember && m.Way == nil {
@@ -0,0 +1,251 @@
+package update
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/cache"
+	"github.com/omniscale/imposm3/element"
+	geomp "github.com/omniscale/imposm3/geom"
+	geosp "github.com/omniscale/imposm3/geom/geos"
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/proj"
+)
+
+// elementHandler serves /element/{node,way,relation}/<id> with the cached
+// element, the geometries that are built from the cache and the rows that
+// the element maps to. The geometries are not clipped to -limitto.
+type elementHandler struct {
+	osmCache   *cache.OSMCache
+	tagmapping *mapping.Mapping
+	srid       int
+}
+
+type elementResponse struct {
+	Type       string            `json:"type"`
+	ID         int64             `json:"id"`
+	Element    interface{}       `json:"element"`
+	Geometries []elementGeometry `json:"geometries"`
+}
+
+type elementGeometry struct {
+	Type  string       `json:"type"`
+	WKT   string       `json:"wkt,omitempty"`
+	Error string       `json:"error,omitempty"`
+	Rows  []elementRow `json:"rows"`
+}
+
+type elementRow struct {
+	Table   string                 `json:"table"`
+	Key     string                 `json:"key"`
+	Value   string                 `json:"value"`
+	Columns map[string]interface{} `json:"columns"`
+}
+
+func (h *elementHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/element/"), "/"), "/")
+	if len(parts) != 2 {
+		http.Error(w, "expected /element/{node,way,relation}/<id>", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	g := geosp.NewGeos()
+	g.SetHandleSrid(h.srid)
+	defer g.Finish()
+
+	var resp *elementResponse
+	switch parts[0] {
+	case "node":
+		resp, err = h.node(g, id)
+	case "way":
+		resp, err = h.way(g, id)
+	case "relation":
+		resp, err = h.relation(g, id)
+	default:
+		http.Error(w, "unknown element type "+parts[0], http.StatusBadRequest)
+		return
+	}
+	if err == cache.NotFound {
+		http.Error(w, "element not found in cache", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(resp)
+}
+
+func (h *elementHandler) node(g *geosp.Geos, id int64) (*elementResponse, error) {
+	nd, err := h.osmCache.Nodes.GetNode(id)
+	if err == cache.NotFound {
+		// untagged nodes are only in the coords cache
+		nd, err = h.osmCache.Coords.GetCoord(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp := &elementResponse{Type: "node", ID: id, Element: nd, Geometries: []elementGeometry{}}
+
+	matches := h.tagmapping.PointMatcher.MatchNode(nd)
+	if len(matches) == 0 {
+		return resp, nil
+	}
+	projected := *nd
+	projected.Long, projected.Lat = h.project(nd.Long, nd.Lat)
+	geom, err := geomp.Point(g, projected)
+	resp.Geometries = append(resp.Geometries, h.geometry(g, "point", nd.Element, geom, err, matches))
+	return resp, nil
+}
+
+func (h *elementHandler) way(g *geosp.Geos, id int64) (*elementResponse, error) {
+	way, err := h.osmCache.Ways.GetWay(id)
+	if err != nil {
+		return nil, err
+	}
+	resp := &elementResponse{Type: "way", ID: id, Element: way, Geometries: []elementGeometry{}}
+
+	lineMatches := h.tagmapping.LineStringMatcher.MatchWay(way)
+	polygonMatches := h.tagmapping.PolygonMatcher.MatchWay(way)
+	if len(lineMatches) == 0 && len(polygonMatches) == 0 {
+		return resp, nil
+	}
+	if err := h.osmCache.Coords.FillWay(way); err != nil {
+		return nil, err
+	}
+	h.projectNodes(way.Nodes)
+
+	elem := way.Element
+	if h.tagmapping.Conf.SingleIDSpace {
+		elem.ID = -id
+	}
+	if len(lineMatches) > 0 {
+		geom, err := geomp.LineString(g, way.Nodes)
+		resp.Geometries = append(resp.Geometries, h.geometry(g, "linestring", elem, geom, err, lineMatches))
+	}
+	if len(polygonMatches) > 0 && way.IsClosed() {
+		geom, err := geomp.Polygon(g, way.Nodes)
+		resp.Geometries = append(resp.Geometries, h.geometry(g, "polygon", elem, geom, err, polygonMatches))
+	}
+	return resp, nil
+}
+
+func (h *elementHandler) relation(g *geosp.Geos, id int64) (*elementResponse, error) {
+	rel, err := h.osmCache.Relations.GetRelation(id)
+	if err != nil {
+		return nil, err
+	}
+	resp := &elementResponse{Type: "relation", ID: id, Element: rel, Geometries: []elementGeometry{}}
+
+	elem := rel.Element
+	if h.tagmapping.Conf.SingleIDSpace {
+		elem.ID = element.RelIDOffset - id
+	} else {
+		elem.ID = -id
+	}
+
+	if matches := h.tagmapping.RelationMatcher.MatchRelation(rel); len(matches) > 0 {
+		resp.Geometries = append(resp.Geometries, h.geometry(g, "none", elem, nil, nil, matches))
+	}
+
+	matches := h.tagmapping.PolygonMatcher.MatchRelation(rel)
+	if len(matches) == 0 {
+		return resp, nil
+	}
+	geom, err := h.buildRelation(rel)
+	if geom.Geom != nil {
+		defer g.Destroy(geom.Geom)
+	}
+	resp.Geometries = append(resp.Geometries, h.geometry(g, "polygon", elem, geom.Geom, err, matches))
+	return resp, nil
+}
+
+func (h *elementHandler) buildRelation(rel *osm.Relation) (geomp.Geometry, error) {
+	if err := h.osmCache.Ways.FillMembers(rel.Members); err != nil {
+		return geomp.Geometry{}, err
+	}
+	for i, m := range rel.Members {
+		if m.Way == nil {
+			continue
+		}
+		if err := h.osmCache.Coords.FillWay(m.Way); err != nil {
+			return geomp.Geometry{}, err
+		}
+		h.projectNodes(m.Way.Nodes)
+		rel.Members[i].Element = &m.Way.Element
+	}
+	maxGap := 1e-1 // 0.1m
+	if h.srid == 4326 {
+		maxGap = 1e-6 // ~0.1m
+	}
+	prepedRel, err := geomp.PrepareRelation(rel, h.srid, maxGap)
+	if err != nil {
+		return geomp.Geometry{}, err
+	}
+	return prepedRel.Build()
+}
+
+// geometry returns the WKT of geom and the rows for all matches. err is the
+// error from building geom.
+func (h *elementHandler) geometry(g *geosp.Geos, geomType string, elem osm.Element, geom *geosp.Geom, err error, matches []mapping.Match) elementGeometry {
+	result := elementGeometry{Type: geomType, Rows: []elementRow{}}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	var geomElem geomp.Geometry
+	if geom != nil {
+		result.WKT = g.AsWkt(geom)
+		geomElem, err = geomp.AsGeomElement(g, geom)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+	for _, match := range matches {
+		if !match.AcceptGeometry(&geomElem) {
+			// rejected by geometry filters
+			continue
+		}
+		row := elementRow{
+			Table:   match.Table.Name,
+			Key:     match.Key,
+			Value:   match.Value,
+			Columns: make(map[string]interface{}),
+		}
+		columns := h.tagmapping.Conf.Tables[match.Table.Name].Columns
+		for i, v := range match.Row(&elem, &geomElem) {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			row.Columns[columns[i].Name] = v
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result
+}
+
+func (h *elementHandler) projectNodes(nodes []osm.Node) {
+	for i := range nodes {
+		nodes[i].Long, nodes[i].Lat = h.project(nodes[i].Long, nodes[i].Lat)
+	}
+}
+
+func (h *elementHandler) project(long, lat float64) (float64, float64) {
+	if h.srid == 3857 {
+		return proj.WgsToMerc(long, lat)
+	}
+	return long, lat
+}
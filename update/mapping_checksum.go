@@ -0,0 +1,56 @@
+package update
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+)
+
+// MappingChecksumFilename is the file in the cache directory that contains
+// the checksum of the mapping that was used for the import.
+const MappingChecksumFilename = "mapping.checksum"
+
+// WriteMappingChecksum stores the checksum of m in cacheDir.
+func WriteMappingChecksum(cacheDir string, m *mapping.Mapping) error {
+	checksum, err := m.Checksum()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(cacheDir, MappingChecksumFilename), []byte(checksum+"\n"), 0644)
+}
+
+// CheckMappingChecksum returns an error if m differs from the mapping that
+// was used for the import. Caches of older Imposm versions without a
+// checksum are accepted. If force is true, the checksum of m replaces the
+// stored checksum.
+func CheckMappingChecksum(cacheDir string, m *mapping.Mapping, force bool) error {
+	b, err := ioutil.ReadFile(filepath.Join(cacheDir, MappingChecksumFilename))
+	if os.IsNotExist(err) {
+		log.Printf("[warn] No mapping checksum in %s, unable to verify that the mapping did not change", cacheDir)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "reading mapping checksum")
+	}
+	checksum, err := m.Checksum()
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(b)) == checksum {
+		return nil
+	}
+	if !force {
+		return errors.New("mapping changed since the import, re-import or use -force-mapping-change")
+	}
+	log.Println("[warn] Mapping changed since the import, updating mapping checksum (-force-mapping-change)")
+	return WriteMappingChecksum(cacheDir, m)
+}
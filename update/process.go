@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -13,15 +14,18 @@ import (
 	"github.com/omniscale/go-osm/parser/diff"
 	diffstate "github.com/omniscale/go-osm/state"
 	"github.com/omniscale/imposm3/cache"
+	"github.com/omniscale/imposm3/changes"
 	"github.com/omniscale/imposm3/config"
 	"github.com/omniscale/imposm3/database"
 	_ "github.com/omniscale/imposm3/database/postgis"
+	_ "github.com/omniscale/imposm3/database/spatialite"
 	"github.com/omniscale/imposm3/expire"
 	"github.com/omniscale/imposm3/geom/geos"
 	"github.com/omniscale/imposm3/geom/limit"
 	"github.com/omniscale/imposm3/log"
 	"github.com/omniscale/imposm3/mapping"
 	"github.com/omniscale/imposm3/stats"
+	"github.com/omniscale/imposm3/throttle"
 	"github.com/omniscale/imposm3/writer"
 )
 
@@ -34,20 +38,43 @@ func Diff(baseOpts config.Base, files []string) {
 
 	var geometryLimiter *limit.Limiter
 	if baseOpts.LimitTo != "" {
-		var err error
 		step := log.Step("Reading limitto geometries")
+		limitTo, err := limit.ResolveSource(baseOpts.LimitTo, baseOpts.CacheDir, "")
+		if err != nil {
+			log.Fatal("[fatal] Reading limitto geometry:", err)
+		}
 		geometryLimiter, err = limit.NewFromGeoJSON(
-			baseOpts.LimitTo,
+			limitTo,
 			baseOpts.LimitToCacheBuffer,
 			baseOpts.Srid,
 		)
 		if err != nil {
 			log.Fatal("[fatal] Reading limitto geometry:", err)
 		}
+		if err := geometryLimiter.SetMode(baseOpts.LimitToMode); err != nil {
+			log.Fatal("[fatal] Reading limitto geometry:", err)
+		}
 		step()
 	}
+	throttler, err := throttle.New(baseOpts.ThrottleWindows, baseOpts.ThrottleRate)
+	if err != nil {
+		log.Fatal("[fatal] ", err)
+	}
+	tagmapping, err := mapping.FromFile(baseOpts.MappingFile)
+	if err != nil {
+		log.Fatal("[fatal] Reading mapping file:", err)
+	}
+	if err := CheckMappingChecksum(baseOpts.CacheDir, tagmapping, baseOpts.ForceMappingChange); err != nil {
+		log.Fatal("[fatal] ", err)
+	}
+	if baseOpts.RepairState {
+		if err := RepairState(baseOpts, tagmapping); err != nil {
+			log.Fatal("[fatal] Repairing state: ", err)
+		}
+	}
+
 	osmCache := cache.NewOSMCache(baseOpts.CacheDir)
-	err := osmCache.Open()
+	err = osmCache.Open()
 	if err != nil {
 		log.Fatal("[fatal] Opening OSM cache:", err)
 	}
@@ -63,6 +90,9 @@ func Diff(baseOpts config.Base, files []string) {
 
 	if baseOpts.ExpireTilesDir != "" {
 		tileexpire := expire.NewTileList(baseOpts.ExpireTilesZoom, baseOpts.ExpireTilesDir)
+		if baseOpts.ExpireTilesChecksum {
+			tileexpire.EnableChecksums()
+		}
 		exp = tileexpire
 		defer func() {
 			if err := tileexpire.Flush(); err != nil {
@@ -71,8 +101,15 @@ func Diff(baseOpts config.Base, files []string) {
 		}()
 	}
 
+	ctx, stop := SignalContext()
+	defer stop()
+
 	for _, oscFile := range files {
-		err := Update(baseOpts, oscFile, geometryLimiter, exp, osmCache, diffCache, baseOpts.ForceDiffImport)
+		err := Update(ctx, baseOpts, oscFile, geometryLimiter, exp, throttler, osmCache, diffCache, baseOpts.ForceDiffImport)
+		if err == context.Canceled {
+			log.Println("[info] Exiting. (SIGTERM/SIGINT/SIGHUP)")
+			break
+		}
 		if err != nil {
 			osmCache.Close()
 			diffCache.Close()
@@ -84,15 +121,30 @@ func Diff(baseOpts config.Base, files []string) {
 	diffCache.Close()
 }
 
+// Update imports a single diff file. The database transaction is aborted
+// and no state is written if ctx is cancelled, so that the diff can be
+// imported again.
 func Update(
+	ctx context.Context,
 	baseOpts config.Base,
 	oscFile string,
 	geometryLimiter *limit.Limiter,
 	expireor expire.Expireor,
+	throttler *throttle.Throttle,
 	osmCache *cache.OSMCache,
 	diffCache *cache.DiffCache,
 	force bool,
-) error {
+) (err error) {
+	span := stats.StartSpan("diff")
+	span.SetAttribute("imposm.file", oscFile)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	if fi, err := os.Stat(oscFile); err == nil {
+		span.SetAttribute("imposm.bytes", fi.Size())
+	}
+
 	var state *diffstate.DiffState
 	if strings.HasSuffix(oscFile, ".osc.gz") {
 		var err error
@@ -102,8 +154,11 @@ func Update(
 			return errors.Wrapf(err, "reading state %s", stateFile)
 		}
 	}
+	if state != nil {
+		span.SetAttribute("imposm.sequence", state.Sequence)
+	}
 	lastStateFile := filepath.Join(baseOpts.DiffDir, LastStateFilename)
-	lastState, err := diffstate.ParseFile(lastStateFile)
+	lastState, err := ReadStateFile(lastStateFile)
 	if err != nil && !os.IsNotExist(err) {
 		return errors.Wrapf(err, "parsing last state from %s", lastStateFile)
 	}
@@ -111,15 +166,22 @@ func Update(
 	if lastState != nil && lastState.Sequence != 0 && state != nil && state.Sequence <= lastState.Sequence {
 		if !force {
 			log.Println("[warn] Skipping ", state, ", already imported")
+			span.SetAttribute("imposm.skipped", true)
 			return nil
 		}
 	}
 
 	defer log.Step(fmt.Sprintf("Processing %s", oscFile))()
 
+	tagmapping, err := mapping.FromFile(baseOpts.MappingFile)
+	if err != nil {
+		return err
+	}
+
 	diffs := make(chan osm.Diff)
 	config := diff.Config{
-		Diffs: diffs,
+		Diffs:           diffs,
+		IncludeMetadata: tagmapping.UsesMetadata(),
 	}
 
 	f, err := os.Open(oscFile)
@@ -132,11 +194,6 @@ func Update(
 		return errors.Wrap(err, "initializing diff parser")
 	}
 
-	tagmapping, err := mapping.FromFile(baseOpts.MappingFile)
-	if err != nil {
-		return err
-	}
-
 	dbConf := database.Config{
 		ConnectionParams: baseOpts.Connection,
 		Srid:             baseOpts.Srid,
@@ -151,6 +208,26 @@ func Update(
 	}
 	defer db.Close()
 
+	if vc, ok := db.(database.VersionChecker); ok {
+		if err := vc.CheckVersion(); err != nil {
+			return err
+		}
+	}
+	if mc, ok := db.(database.MappingChecksumChecker); ok {
+		checksum, err := tagmapping.Checksum()
+		if err != nil {
+			return err
+		}
+		if err := mc.CheckMappingChecksum(checksum, baseOpts.ForceMappingChange); err != nil {
+			return err
+		}
+	}
+
+	if seqDb, ok := db.(database.SequenceRecorder); ok && state != nil {
+		seqDb.SetSequence(state.Sequence)
+	}
+
+	begin := time.Now()
 	err = db.Begin()
 	if err != nil {
 		return err
@@ -161,6 +238,12 @@ func Update(
 		return errors.New("database not deletable")
 	}
 
+	var recorder *changes.Recorder
+	if baseOpts.ExportChangesDir != "" {
+		recorder = changes.NewRecorder(delDb, &tagmapping.Conf, baseOpts.ExportChangesDir)
+		delDb = recorder
+	}
+
 	genDb, ok := db.(database.Generalizer)
 	if ok {
 		genDb.EnableGeneralizeUpdates()
@@ -178,12 +261,15 @@ func Update(
 		tagmapping.RelationMemberMatcher,
 	)
 	deleter.SetExpireor(expireor)
+	deleter.SetOldStyleMultipolygons(tagmapping.Conf.OldStyleMultipolygons)
 
 	progress := stats.NewStatsReporter()
 
 	relTagFilter := tagmapping.RelationTagFilter()
 	wayTagFilter := tagmapping.WayTagFilter()
 	nodeTagFilter := tagmapping.NodeTagFilter()
+	includeUntagged := tagmapping.IncludesUntaggedNodes()
+	osmCache.Nodes.SetIncludeUntagged(includeUntagged)
 
 	relations := make(chan *osm.Relation)
 	ways := make(chan *osm.Way)
@@ -192,32 +278,40 @@ func Update(
 	relWriter := writer.NewRelationWriter(osmCache, diffCache,
 		tagmapping.Conf.SingleIDSpace,
 		relations,
-		db, progress,
+		delDb, progress,
 		tagmapping.PolygonMatcher,
 		tagmapping.RelationMatcher,
 		tagmapping.RelationMemberMatcher,
 		baseOpts.Srid)
 	relWriter.SetLimiter(geometryLimiter)
+	relWriter.SetOldStyleMultipolygons(tagmapping.Conf.OldStyleMultipolygons)
 	relWriter.SetExpireor(expireor)
+	relWriter.SetContext(ctx)
+	relWriter.SetMaxTags(tagmapping.SkipMaxTags())
 	relWriter.Start()
 
 	wayWriter := writer.NewWayWriter(osmCache, diffCache,
 		tagmapping.Conf.SingleIDSpace,
-		ways, db,
+		ways, delDb,
 		progress,
 		tagmapping.PolygonMatcher,
 		tagmapping.LineStringMatcher,
 		baseOpts.Srid)
 	wayWriter.SetLimiter(geometryLimiter)
+	wayWriter.SetOldStyleMultipolygons(tagmapping.Conf.OldStyleMultipolygons)
 	wayWriter.SetExpireor(expireor)
+	wayWriter.SetContext(ctx)
+	wayWriter.SetMaxTags(tagmapping.SkipMaxTags())
 	wayWriter.Start()
 
-	nodeWriter := writer.NewNodeWriter(osmCache, nodes, db,
+	nodeWriter := writer.NewNodeWriter(osmCache, nodes, delDb,
 		progress,
 		tagmapping.PointMatcher,
 		baseOpts.Srid)
 	nodeWriter.SetLimiter(geometryLimiter)
 	nodeWriter.SetExpireor(expireor)
+	nodeWriter.SetContext(ctx)
+	nodeWriter.SetMaxTags(tagmapping.SkipMaxTags())
 	nodeWriter.Start()
 
 	nodeIDs := make(map[int64]struct{})
@@ -228,7 +322,7 @@ func Update(
 
 	g := geos.NewGeos()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel() // make sure parser is stopped if we return early with an error
 
 	parseError := make(chan error)
@@ -237,6 +331,10 @@ func Update(
 	}()
 
 	for elem := range diffs {
+		if ctx.Err() != nil {
+			// drain diffs, parser stops sending after cancel
+			continue
+		}
 		if elem.Rel != nil {
 			relTagFilter.Filter(&elem.Rel.Tags)
 			progress.AddRelations(1)
@@ -269,6 +367,9 @@ func Update(
 				if err := diffCache.Ways.Delete(elem.Way.ID); err != nil && err != cache.NotFound {
 					return errors.Wrapf(err, "delete way references %v", elem.Way)
 				}
+				if err := osmCache.MemberGeoms.DeleteWay(elem.Way.ID); err != nil {
+					return errors.Wrapf(err, "delete member geometry %v", elem.Way)
+				}
 			} else if elem.Node != nil {
 				if err := osmCache.Nodes.DeleteNode(elem.Node.ID); err != nil && err != cache.NotFound {
 					return errors.Wrapf(err, "delete node %v", elem.Node)
@@ -278,7 +379,7 @@ func Update(
 				}
 			}
 		}
-		if elem.Modify && elem.Node != nil && elem.Node.Tags == nil {
+		if elem.Modify && elem.Node != nil && elem.Node.Tags == nil && !includeUntagged {
 			// handle modifies where a node drops all tags
 			if err := osmCache.Nodes.DeleteNode(elem.Node.ID); err != nil && err != cache.NotFound {
 				return errors.Wrapf(err, "delete node %v", elem.Node)
@@ -340,13 +441,26 @@ func Update(
 		wayIDs[id] = struct{}{}
 	}
 
-	progress.Stop()
+	counts := progress.Stop()
+	span.SetAttribute("imposm.nodes", counts.Nodes.Current)
+	span.SetAttribute("imposm.ways", counts.Ways.Current)
+	span.SetAttribute("imposm.relations", counts.Relations.Current)
 	step()
 
 	err = <-parseError
 	if err != nil {
 		return errors.Wrapf(err, "parsing diff %s", oscFile)
 	}
+	if ctx.Err() != nil {
+		close(relations)
+		close(ways)
+		close(nodes)
+		nodeWriter.Wait()
+		relWriter.Wait()
+		wayWriter.Wait()
+		db.Abort()
+		return ctx.Err()
+	}
 
 	step = log.Step("Importing added/modified elements")
 
@@ -360,6 +474,14 @@ func Update(
 		}
 	}
 
+	// remove outdated geometries of modified ways and ways with modified
+	// nodes before relations are rebuilt
+	for wayID := range wayIDs {
+		if err := osmCache.MemberGeoms.DeleteWay(wayID); err != nil {
+			return errors.Wrapf(err, "delete member geometry %v", wayID)
+		}
+	}
+
 	// mark depending relations for (re)insert
 	for nodeID := range nodeIDs {
 		dependers := diffCache.CoordsRel.Get(nodeID)
@@ -385,7 +507,16 @@ func Update(
 		}
 		// insert new relation
 		progress.AddRelations(1)
-		relations <- rel
+		select {
+		case relations <- rel:
+		case <-ctx.Done():
+		}
+	}
+	close(relations)
+	if tagmapping.Conf.OldStyleMultipolygons {
+		// ways check the relations in the diff cache to skip outer ways
+		// of old-style multipolygons, wait till they are updated
+		relWriter.Wait()
 	}
 
 	for wayID := range wayIDs {
@@ -398,7 +529,10 @@ func Update(
 		}
 		// insert new way
 		progress.AddWays(1)
-		ways <- way
+		select {
+		case ways <- way:
+		case <-ctx.Done():
+		}
 	}
 
 	for nodeID := range nodeIDs {
@@ -413,11 +547,13 @@ func Update(
 		if node != nil {
 			// insert new node
 			progress.AddNodes(1)
-			nodes <- node
+			select {
+			case nodes <- node:
+			case <-ctx.Done():
+			}
 		}
 	}
 
-	close(relations)
 	close(ways)
 	close(nodes)
 
@@ -425,10 +561,22 @@ func Update(
 	relWriter.Wait()
 	wayWriter.Wait()
 
+	if ctx.Err() != nil {
+		db.Abort()
+		return ctx.Err()
+	}
+
 	if genDb != nil {
-		genDb.GeneralizeUpdates()
+		if err := genDb.GeneralizeUpdates(); err != nil {
+			db.Abort()
+			return errors.Wrap(err, "updating generalized tables")
+		}
 	}
 
+	var writtenRows int64
+	if counter, ok := db.(database.RowCounter); ok {
+		writtenRows = counter.WrittenRows()
+	}
 	err = db.End()
 	if err != nil {
 		return err
@@ -441,15 +589,26 @@ func Update(
 	step()
 
 	progress.Stop()
+	stats.LogInvalidValues()
+
+	if recorder != nil {
+		if err := recorder.Flush(); err != nil {
+			log.Println("[error] Writing changes:", err)
+		}
+	}
 
 	if state != nil {
 		if lastState != nil {
 			state.URL = lastState.URL
 		}
-		err = diffstate.WriteFile(filepath.Join(baseOpts.DiffDir, LastStateFilename), state)
+		err = WriteStateFile(filepath.Join(baseOpts.DiffDir, LastStateFilename), state)
 		if err != nil {
 			log.Println("[error] Unable to write last state:", err)
 		}
 	}
+
+	// throttle between the diff imports, waiting within the transaction
+	// would hold the locks of all modified rows
+	throttler.Pause(ctx, writtenRows, begin)
 	return nil
 }
@@ -1,20 +1,23 @@
 package update
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"syscall"
 	"time"
 
 	"github.com/omniscale/go-osm/replication/diff"
-	"github.com/omniscale/go-osm/state"
 	"github.com/omniscale/imposm3/cache"
 	"github.com/omniscale/imposm3/config"
+	"github.com/omniscale/imposm3/database"
 	"github.com/omniscale/imposm3/expire"
 	"github.com/omniscale/imposm3/geom/limit"
 	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+	"github.com/omniscale/imposm3/stats"
+	"github.com/omniscale/imposm3/throttle"
 )
 
 func Run(baseOpts config.Base) {
@@ -24,20 +27,43 @@ func Run(baseOpts config.Base) {
 
 	var geometryLimiter *limit.Limiter
 	if baseOpts.LimitTo != "" {
-		var err error
 		step := log.Step("Reading limitto geometries")
+		limitTo, err := limit.ResolveSource(baseOpts.LimitTo, baseOpts.CacheDir, "")
+		if err != nil {
+			log.Fatal("[error] Reading limit to geometry", err)
+		}
 		geometryLimiter, err = limit.NewFromGeoJSON(
-			baseOpts.LimitTo,
+			limitTo,
 			baseOpts.LimitToCacheBuffer,
 			baseOpts.Srid,
 		)
 		if err != nil {
 			log.Fatal("[error] Reading limit to geometry", err)
 		}
+		if err := geometryLimiter.SetMode(baseOpts.LimitToMode); err != nil {
+			log.Fatal("[error] Reading limit to geometry", err)
+		}
 		step()
 	}
 
-	s, err := state.ParseFile(filepath.Join(baseOpts.DiffDir, LastStateFilename))
+	throttler, err := throttle.New(baseOpts.ThrottleWindows, baseOpts.ThrottleRate)
+	if err != nil {
+		log.Fatal("[fatal] ", err)
+	}
+	tagmapping, err := mapping.FromFile(baseOpts.MappingFile)
+	if err != nil {
+		log.Fatal("[fatal] Reading mapping file:", err)
+	}
+	if err := CheckMappingChecksum(baseOpts.CacheDir, tagmapping, baseOpts.ForceMappingChange); err != nil {
+		log.Fatal("[fatal] ", err)
+	}
+	if baseOpts.RepairState {
+		if err := RepairState(baseOpts, tagmapping); err != nil {
+			log.Fatal("[fatal] Repairing state: ", err)
+		}
+	}
+
+	s, err := ReadStateFile(filepath.Join(baseOpts.DiffDir, LastStateFilename))
 	if err != nil {
 		log.Fatal("[fatal] Unable to read last.state.txt:", err)
 	}
@@ -73,14 +99,25 @@ func Run(baseOpts config.Base) {
 	}
 	defer diffCache.Close()
 
-	sigc := make(chan os.Signal, 1)
-	signal.Notify(sigc, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	if baseOpts.HTTPProfile != "" {
+		http.Handle("/element/", &elementHandler{
+			osmCache:   osmCache,
+			tagmapping: tagmapping,
+			srid:       baseOpts.Srid,
+		})
+	}
+
+	ctx, stop := SignalContext()
+	defer stop()
 
 	var tilelist *expire.TileList
 	var lastTlFlush = time.Now()
 	var tileExpireor expire.Expireor
 	if baseOpts.ExpireTilesDir != "" {
 		tilelist = expire.NewTileList(baseOpts.ExpireTilesZoom, baseOpts.ExpireTilesDir)
+		if baseOpts.ExpireTilesChecksum {
+			tilelist.EnableChecksums()
+		}
 		tileExpireor = tilelist
 	}
 
@@ -95,14 +132,37 @@ func Run(baseOpts config.Base) {
 				log.Println("[error] Writing tile expire list", err)
 			}
 		}
+		stats.StopTracing()
 		os.Exit(0)
 	}
 
+	var vacuum *vacuumMonitor
+	if baseOpts.VacuumThreshold > 0 {
+		dbConf := database.Config{
+			ConnectionParams: baseOpts.Connection,
+			Srid:             baseOpts.Srid,
+			// we apply diff imports on the Production schema
+			ImportSchema:     baseOpts.Schemas.Production,
+			ProductionSchema: baseOpts.Schemas.Production,
+			BackupSchema:     baseOpts.Schemas.Backup,
+		}
+		db, err := database.Open(dbConf, &tagmapping.Conf)
+		if err != nil {
+			log.Fatal("[fatal] Opening database:", err)
+		}
+		defer db.Close()
+		vacuumer, ok := db.(database.Vacuumer)
+		if !ok {
+			log.Fatal("[fatal] Database does not support -vacuum-threshold")
+		}
+		vacuum = newVacuumMonitor(vacuumer, baseOpts.VacuumThreshold, baseOpts.Vacuum)
+	}
+
 	exp := newExpBackoff(2*time.Second, 5*time.Minute)
 
 	for {
 		select {
-		case <-sigc:
+		case <-ctx.Done():
 			shutdown()
 		case seq := <-nextSeq:
 			if seq.Error != nil {
@@ -116,7 +176,7 @@ func Run(baseOpts config.Base) {
 				log.Printf("[info] Importing #%d including changes till %s (%s behind)", seqID, seqTime, time.Since(seqTime).Truncate(time.Second))
 				finishedImport := log.Step(fmt.Sprintf("Importing #%d", seqID))
 
-				err := Update(baseOpts, fname, geometryLimiter, tileExpireor, osmCache, diffCache, false)
+				err := Update(ctx, baseOpts, fname, geometryLimiter, tileExpireor, throttler, osmCache, diffCache, false)
 
 				osmCache.Coords.Flush()
 				diffCache.Flush()
@@ -133,19 +193,19 @@ func Run(baseOpts config.Base) {
 
 				finishedImport()
 
-				select {
-				case <-sigc:
+				if ctx.Err() != nil {
 					shutdown()
-				default:
 				}
 
 				if err != nil {
 					log.Printf("[error] Importing #%d: %s", seqID, err)
 					log.Println("[info] Retrying in", exp.Duration())
-					// TODO handle <-sigc during wait
-					exp.Wait()
+					exp.Wait(ctx)
 				} else {
 					exp.Reset()
+					if vacuum != nil {
+						vacuum.Check()
+					}
 					break
 				}
 			}
@@ -170,8 +230,12 @@ func (eb *expBackoff) Duration() time.Duration {
 	return eb.current
 }
 
-func (eb *expBackoff) Wait() {
-	time.Sleep(eb.current)
+// Wait sleeps for the current duration or till ctx is done.
+func (eb *expBackoff) Wait(ctx context.Context) {
+	select {
+	case <-time.After(eb.current):
+	case <-ctx.Done():
+	}
 	eb.current = eb.current * 2
 	if eb.current > eb.max {
 		eb.current = eb.max
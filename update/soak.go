@@ -0,0 +1,359 @@
+package update
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/cache"
+	"github.com/omniscale/imposm3/config"
+	"github.com/omniscale/imposm3/geom/limit"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+)
+
+// soakPoolSize is the number of ways and nodes that are sampled from the
+// cache as candidates for the synthetic changes.
+const soakPoolSize = 10000
+
+// SoakTest generates diffs with random changes of cached elements and
+// imports them into the production tables, to load-test the diff import.
+// The changes are:
+//   - moves: one node of a way is moved by a few meters
+//   - retags: the name of a way is changed
+//   - deletes: a tagged node that is not part of any way is deleted
+func SoakTest(opts config.SoakTest) {
+	baseOpts := opts.Base
+	if baseOpts.Quiet {
+		log.SetMinLevel(log.LInfo)
+	}
+
+	var geometryLimiter *limit.Limiter
+	if baseOpts.LimitTo != "" {
+		step := log.Step("Reading limitto geometries")
+		limitTo, err := limit.ResolveSource(baseOpts.LimitTo, baseOpts.CacheDir, "")
+		if err != nil {
+			log.Fatal("[fatal] Reading limitto geometry:", err)
+		}
+		geometryLimiter, err = limit.NewFromGeoJSON(
+			limitTo,
+			baseOpts.LimitToCacheBuffer,
+			baseOpts.Srid,
+		)
+		if err != nil {
+			log.Fatal("[fatal] Reading limitto geometry:", err)
+		}
+		if err := geometryLimiter.SetMode(baseOpts.LimitToMode); err != nil {
+			log.Fatal("[fatal] Reading limitto geometry:", err)
+		}
+		step()
+	}
+	tagmapping, err := mapping.FromFile(baseOpts.MappingFile)
+	if err != nil {
+		log.Fatal("[fatal] Reading mapping file:", err)
+	}
+	if err := CheckMappingChecksum(baseOpts.CacheDir, tagmapping, baseOpts.ForceMappingChange); err != nil {
+		log.Fatal("[fatal] ", err)
+	}
+
+	osmCache := cache.NewOSMCache(baseOpts.CacheDir)
+	if err := osmCache.Open(); err != nil {
+		log.Fatal("[fatal] Opening OSM cache:", err)
+	}
+	defer osmCache.Close()
+
+	diffCache := cache.NewDiffCache(baseOpts.CacheDir)
+	if err := diffCache.Open(); err != nil {
+		log.Fatal("[fatal] Opening diff cache:", err)
+	}
+	defer diffCache.Close()
+
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Printf("[info] Soak test with seed %d", seed)
+	gen := &soakGenerator{
+		rnd:       rand.New(rand.NewSource(seed)),
+		osmCache:  osmCache,
+		diffCache: diffCache,
+	}
+	step := log.Step("Sampling cached elements")
+	gen.sample()
+	step()
+	if len(gen.ways) == 0 {
+		log.Fatal("[fatal] No ways in cache")
+	}
+
+	tmpDir, err := ioutil.TempDir(baseOpts.CacheDir, "soak")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx, stop := SignalContext()
+	defer stop()
+
+	var durations []time.Duration
+	for i := 0; i < opts.Diffs; i++ {
+		if i > 0 && opts.Interval > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(opts.Interval):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		oscFile := filepath.Join(tmpDir, fmt.Sprintf("%06d.osc.gz", i))
+		if err := gen.writeDiff(oscFile, opts.Changes); err != nil {
+			log.Fatal("[fatal] Writing synthetic diff:", err)
+		}
+		start := time.Now()
+		err := Update(ctx, baseOpts, oscFile, geometryLimiter, nil, nil, osmCache, diffCache, true)
+		if err == context.Canceled {
+			log.Println("[info] Exiting. (SIGTERM/SIGINT/SIGHUP)")
+			break
+		}
+		if err != nil {
+			osmCache.Close()
+			diffCache.Close()
+			log.Fatalf("[fatal] Unable to process synthetic diff %d: %v", i, err)
+		}
+		durations = append(durations, time.Since(start))
+	}
+
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		var total time.Duration
+		for _, d := range durations {
+			total += d
+		}
+		log.Printf("[info] Imported %d diffs with %d moves, %d retags and %d deletes",
+			len(durations), gen.moves, gen.retags, gen.deletes)
+		log.Printf("[info] Diff import durations: min %s, median %s, max %s, avg %s",
+			durations[0], durations[len(durations)/2], durations[len(durations)-1],
+			total/time.Duration(len(durations)))
+	}
+	// explicitly Close since os.Exit prevents defers
+	osmCache.Close()
+	diffCache.Close()
+	os.RemoveAll(tmpDir)
+}
+
+type soakGenerator struct {
+	rnd       *rand.Rand
+	osmCache  *cache.OSMCache
+	diffCache *cache.DiffCache
+	ways      []int64
+	nodes     []int64
+
+	moves, retags, deletes int
+}
+
+// sample collects random way and tagged node IDs with reservoir sampling.
+func (g *soakGenerator) sample() {
+	n := 0
+	for w := range g.osmCache.Ways.Iter() {
+		n++
+		if len(g.ways) < soakPoolSize {
+			g.ways = append(g.ways, w.ID)
+		} else if i := g.rnd.Intn(n); i < soakPoolSize {
+			g.ways[i] = w.ID
+		}
+	}
+	n = 0
+	for nd := range g.osmCache.Nodes.Iter() {
+		n++
+		if len(g.nodes) < soakPoolSize {
+			g.nodes = append(g.nodes, nd.ID)
+		} else if i := g.rnd.Intn(n); i < soakPoolSize {
+			g.nodes[i] = nd.ID
+		}
+	}
+}
+
+type oscAction struct {
+	action string
+	elem   interface{}
+}
+
+// writeDiff writes a gzipped osmChange file with the given number of
+// random changes. Changes of elements that are no longer cached are
+// skipped.
+func (g *soakGenerator) writeDiff(filename string, changes int) error {
+	var actions []oscAction
+	for i := 0; i < changes; i++ {
+		r := g.rnd.Float64()
+		switch {
+		case r < 0.2 && len(g.nodes) > 0:
+			if a, ok := g.deleteNode(); ok {
+				actions = append(actions, a)
+				g.deletes++
+			}
+		case r < 0.5:
+			if a, ok := g.retagWay(); ok {
+				actions = append(actions, a)
+				g.retags++
+			}
+		default:
+			if a, ok := g.moveNode(); ok {
+				actions = append(actions, a)
+				g.moves++
+			}
+		}
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	if err := writeOsmChange(gz, actions); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (g *soakGenerator) moveNode() (oscAction, bool) {
+	way, err := g.osmCache.Ways.GetWay(g.ways[g.rnd.Intn(len(g.ways))])
+	if err != nil || len(way.Refs) == 0 {
+		return oscAction{}, false
+	}
+	id := way.Refs[g.rnd.Intn(len(way.Refs))]
+	nd, err := g.osmCache.Nodes.GetNode(id)
+	if err != nil {
+		// untagged node
+		nd, err = g.osmCache.Coords.GetCoord(id)
+		if err != nil {
+			return oscAction{}, false
+		}
+	}
+	// ~10m
+	nd.Long += (g.rnd.Float64() - 0.5) * 0.0002
+	nd.Lat += (g.rnd.Float64() - 0.5) * 0.0002
+	nextVersion(&nd.Element)
+	return oscAction{"modify", nd}, true
+}
+
+func (g *soakGenerator) retagWay() (oscAction, bool) {
+	way, err := g.osmCache.Ways.GetWay(g.ways[g.rnd.Intn(len(g.ways))])
+	if err != nil {
+		return oscAction{}, false
+	}
+	tags := make(osm.Tags, len(way.Tags)+1)
+	for k, v := range way.Tags {
+		tags[k] = v
+	}
+	tags["name"] = "soak " + strconv.Itoa(g.rnd.Int())
+	way.Tags = tags
+	nextVersion(&way.Element)
+	return oscAction{"modify", way}, true
+}
+
+func (g *soakGenerator) deleteNode() (oscAction, bool) {
+	i := g.rnd.Intn(len(g.nodes))
+	id := g.nodes[i]
+	if len(g.diffCache.Coords.Get(id)) > 0 {
+		// part of a way
+		return oscAction{}, false
+	}
+	nd, err := g.osmCache.Nodes.GetNode(id)
+	if err != nil {
+		return oscAction{}, false
+	}
+	// remove from pool, node is gone after this diff
+	g.nodes[i] = g.nodes[len(g.nodes)-1]
+	g.nodes = g.nodes[:len(g.nodes)-1]
+	nextVersion(&nd.Element)
+	return oscAction{"delete", nd}, true
+}
+
+func nextVersion(elem *osm.Element) {
+	if elem.Metadata != nil {
+		md := *elem.Metadata
+		md.Version++
+		md.Timestamp = time.Now().UTC()
+		elem.Metadata = &md
+	}
+}
+
+func writeOsmChange(w io.Writer, actions []oscAction) error {
+	ew := &errWriter{w: w}
+	ew.printf("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	ew.printf("<osmChange version=\"0.6\" generator=\"imposm soak-test\">\n")
+	for _, a := range actions {
+		ew.printf("<%s>\n", a.action)
+		switch elem := a.elem.(type) {
+		case *osm.Node:
+			ew.printf(`  <node id="%d"%s lat="%.7f" lon="%.7f">`+"\n",
+				elem.ID, metadataAttrs(elem.Metadata), elem.Lat, elem.Long)
+			writeTags(ew, elem.Tags)
+			ew.printf("  </node>\n")
+		case *osm.Way:
+			ew.printf(`  <way id="%d"%s>`+"\n", elem.ID, metadataAttrs(elem.Metadata))
+			for _, ref := range elem.Refs {
+				ew.printf(`    <nd ref="%d"/>`+"\n", ref)
+			}
+			writeTags(ew, elem.Tags)
+			ew.printf("  </way>\n")
+		}
+		ew.printf("</%s>\n", a.action)
+	}
+	ew.printf("</osmChange>\n")
+	return errors.Wrap(ew.err, "writing osmChange")
+}
+
+func metadataAttrs(md *osm.Metadata) string {
+	if md == nil {
+		return ""
+	}
+	return fmt.Sprintf(` version="%d" timestamp="%s"`, md.Version, md.Timestamp.Format(time.RFC3339))
+}
+
+func writeTags(ew *errWriter, tags osm.Tags) {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ew.printf(`    <tag k="%s" v="%s"/>`+"\n", xmlEscape(k), xmlEscape(tags[k]))
+	}
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// errWriter keeps the first write error.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
@@ -0,0 +1,148 @@
+package update
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/omniscale/go-osm/state"
+	"github.com/pkg/errors"
+
+	"github.com/omniscale/imposm3/atomicfile"
+	"github.com/omniscale/imposm3/config"
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
+)
+
+const checksumPrefix = "# sha256="
+
+// prevStateSuffix is appended to the name of the state file for the copy of
+// the previous state.
+const prevStateSuffix = ".prev"
+
+// formatState returns the state in the format of the state.txt files of
+// the replication servers, with an additional comment line with the
+// checksum of all other lines.
+func formatState(s *state.DiffState) []byte {
+	buf := &bytes.Buffer{}
+	// colons are escaped as in Java properties files
+	fmt.Fprintf(buf, "timestamp=%s\n", s.Time.UTC().Format(`2006-01-02T15\:04\:05Z`))
+	if s.Sequence != 0 {
+		fmt.Fprintf(buf, "sequenceNumber=%d\n", s.Sequence)
+	}
+	fmt.Fprintf(buf, "replicationUrl=%s\n", s.URL)
+	fmt.Fprintf(buf, "%s%s\n", checksumPrefix, atomicfile.Checksum(buf.Bytes()))
+	return buf.Bytes()
+}
+
+// parseState parses a state file and verifies the checksum. Files without
+// checksum (from older versions or from replication servers) are accepted.
+func parseState(b []byte) (*state.DiffState, error) {
+	if idx := bytes.Index(b, []byte(checksumPrefix)); idx >= 0 {
+		checksum := strings.TrimSpace(string(b[idx+len(checksumPrefix):]))
+		if checksum != atomicfile.Checksum(b[:idx]) {
+			return nil, errors.New("checksum does not match, file is incomplete or modified")
+		}
+	}
+	return state.Parse(bytes.NewReader(b))
+}
+
+// WriteStateFile writes the state atomically, with a checksum. The current
+// state file is kept as a copy with the .prev suffix.
+func WriteStateFile(filename string, s *state.DiffState) error {
+	if b, err := ioutil.ReadFile(filename); err == nil {
+		if _, err := parseState(b); err == nil {
+			if err := atomicfile.WriteFile(filename+prevStateSuffix, b, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return atomicfile.WriteFile(filename, formatState(s), 0644)
+}
+
+// ReadStateFile reads a state file. It falls back to the previous state if
+// the file is incomplete (e.g. after a crash). The diffs after the
+// previous state are imported again in this case. Returns an error that
+// satisfies os.IsNotExist if there is no state file.
+func ReadStateFile(filename string) (*state.DiffState, error) {
+	atomicfile.RemoveTempFiles(filename)
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	s, err := parseState(b)
+	if err == nil {
+		return s, nil
+	}
+	prev, prevErr := ioutil.ReadFile(filename + prevStateSuffix)
+	if prevErr == nil {
+		if s, prevErr := parseState(prev); prevErr == nil {
+			log.Printf("[warn] %s is invalid (%s), using previous state with sequence %d", filename, err, s.Sequence)
+			return s, nil
+		}
+	}
+	return nil, errors.Wrapf(err, "parsing %s, use -repair-state to restore the state from the database", filename)
+}
+
+// RepairState restores the state file in the diff directory from the
+// last sequence that was recorded in the database. The replication URL is
+// taken from the options or from the existing (invalid) state file.
+func RepairState(baseOpts config.Base, tagmapping *mapping.Mapping) error {
+	dbConf := database.Config{
+		ConnectionParams: baseOpts.Connection,
+		Srid:             baseOpts.Srid,
+		// we apply diff imports on the Production schema
+		ImportSchema:     baseOpts.Schemas.Production,
+		ProductionSchema: baseOpts.Schemas.Production,
+		BackupSchema:     baseOpts.Schemas.Backup,
+	}
+	db, err := database.Open(dbConf, &tagmapping.Conf)
+	if err != nil {
+		return errors.Wrap(err, "opening database")
+	}
+	defer db.Close()
+
+	seqDb, ok := db.(database.SequenceReader)
+	if !ok {
+		return errors.New("database does not record the sequence")
+	}
+	seq, modified, err := seqDb.LastSequence()
+	if err != nil {
+		return errors.Wrap(err, "querying last sequence")
+	}
+	if seq == 0 {
+		return errors.New("no sequence recorded in the database")
+	}
+
+	filename := filepath.Join(baseOpts.DiffDir, LastStateFilename)
+	if err := repairStateFile(filename, baseOpts.ReplicationURL, seq, modified); err != nil {
+		return err
+	}
+	log.Printf("[info] Restored %s with sequence %d from the database", filename, seq)
+	return nil
+}
+
+// repairStateFile writes a new state file with seq. The replication URL is
+// taken from the existing state files if url is empty.
+func repairStateFile(filename, url string, seq int, modified time.Time) error {
+	if url == "" {
+		for _, fname := range []string{filename, filename + prevStateSuffix} {
+			if b, err := ioutil.ReadFile(fname); err == nil {
+				// ignore the checksum, only the URL is required
+				if s, err := state.Parse(bytes.NewReader(b)); err == nil && s.URL != "" {
+					url = s.URL
+					break
+				}
+			}
+		}
+	}
+
+	// modified is the time of the import and not of the diff, which is
+	// only used for logging
+	s := &state.DiffState{Time: modified, Sequence: seq, URL: url}
+	return WriteStateFile(filename, s)
+}
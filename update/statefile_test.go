@@ -0,0 +1,150 @@
+package update
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omniscale/go-osm/state"
+)
+
+func tempStateDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "imposm_statefile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestParseState(t *testing.T) {
+	s := &state.DiffState{
+		Time:     time.Date(2020, 3, 1, 12, 30, 0, 0, time.UTC),
+		Sequence: 4242,
+		URL:      "https://planet.openstreetmap.org/replication/minute/",
+	}
+	b := formatState(s)
+
+	parsed, err := parseState(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Time.Equal(s.Time) || parsed.Sequence != s.Sequence || parsed.URL != s.URL {
+		t.Errorf("unexpected state %v", parsed)
+	}
+
+	// state files from replication servers have no checksum
+	parsed, err = parseState([]byte("timestamp=2020-03-01T12\\:30\\:00Z\nsequenceNumber=4242\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Sequence != 4242 {
+		t.Errorf("unexpected sequence %d", parsed.Sequence)
+	}
+}
+
+func TestParseStateChecksumMismatch(t *testing.T) {
+	b := formatState(&state.DiffState{
+		Time:     time.Date(2020, 3, 1, 12, 30, 0, 0, time.UTC),
+		Sequence: 4242,
+	})
+	for _, tc := range []string{
+		strings.Replace(string(b), "4242", "4243", 1),
+		// truncated after the checksum prefix
+		string(b[:len(b)-10]),
+	} {
+		if _, err := parseState([]byte(tc)); err == nil || !strings.Contains(err.Error(), "checksum") {
+			t.Errorf("expected checksum error for %q, got %v", tc, err)
+		}
+	}
+}
+
+func TestReadStateFilePrevFallback(t *testing.T) {
+	dir := tempStateDir(t)
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, LastStateFilename)
+
+	for _, seq := range []int{100, 101} {
+		s := &state.DiffState{Time: time.Now(), Sequence: seq}
+		if err := WriteStateFile(fname, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := ReadStateFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Sequence != 101 {
+		t.Errorf("unexpected sequence %d", s.Sequence)
+	}
+
+	// corrupt state file and a left over temp file from a crash
+	if err := ioutil.WriteFile(fname, []byte("timestamp=2020-03-01T12\\:30\\:00Z\nsequenceNumber=1\n# sha256=1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmpname := filepath.Join(dir, "."+LastStateFilename+".tmp123")
+	if err := ioutil.WriteFile(tmpname, []byte("timestamp="), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = ReadStateFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Sequence != 100 {
+		t.Errorf("expected sequence of previous state, got %d", s.Sequence)
+	}
+	if _, err := os.Stat(tmpname); !os.IsNotExist(err) {
+		t.Errorf("temp file not removed: %v", err)
+	}
+
+	// no fallback without previous state
+	if err := os.Remove(fname + prevStateSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadStateFile(fname); err == nil || !strings.Contains(err.Error(), "-repair-state") {
+		t.Errorf("expected error with -repair-state hint, got %v", err)
+	}
+
+	if _, err := ReadStateFile(filepath.Join(dir, "missing.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestRepairStateFile(t *testing.T) {
+	dir := tempStateDir(t)
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, LastStateFilename)
+
+	url := "https://planet.openstreetmap.org/replication/minute/"
+	// invalid state file, but with a replication URL
+	if err := ioutil.WriteFile(fname, []byte("timestamp=2020-03-01T12\\:30\\:00Z\nsequenceNumber=1\nreplicationUrl="+url+"\n# sha256=1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	modified := time.Date(2020, 3, 2, 8, 0, 0, 0, time.UTC)
+	if err := repairStateFile(fname, "", 4242, modified); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ReadStateFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Sequence != 4242 || s.URL != url || !s.Time.Equal(modified) {
+		t.Errorf("unexpected state %v", s)
+	}
+
+	// URL from the options
+	if err := repairStateFile(fname, "http://example.org/", 4243, modified); err != nil {
+		t.Fatal(err)
+	}
+	s, err = ReadStateFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Sequence != 4243 || s.URL != "http://example.org/" {
+		t.Errorf("unexpected state %v", s)
+	}
+}
@@ -0,0 +1,79 @@
+package update
+
+import (
+	"time"
+
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/log"
+)
+
+const (
+	vacuumCheckInterval = 10 * time.Minute
+	// tables with fewer dead tuples are never vacuumed
+	vacuumMinDeadTuples = 10000
+)
+
+// vacuumMonitor tracks the dead tuples of all tables and vacuums tables
+// (or logs a recommendation) when the ratio of dead tuples exceeds the
+// threshold. Diff imports delete and insert all modified rows, which bloats
+// tables with many changes faster than autovacuum cleans them up.
+type vacuumMonitor struct {
+	db        database.Vacuumer
+	threshold float64
+	vacuum    bool
+	lastCheck time.Time
+	lastDead  map[string]int64
+}
+
+func newVacuumMonitor(db database.Vacuumer, threshold float64, vacuum bool) *vacuumMonitor {
+	return &vacuumMonitor{
+		db:        db,
+		threshold: threshold,
+		vacuum:    vacuum,
+		lastCheck: time.Now(),
+		lastDead:  make(map[string]int64),
+	}
+}
+
+// Check checks all tables if the last check is older than
+// vacuumCheckInterval.
+func (v *vacuumMonitor) Check() {
+	if time.Since(v.lastCheck) < vacuumCheckInterval {
+		return
+	}
+	v.lastCheck = time.Now()
+
+	stats, err := v.db.TableStats()
+	if err != nil {
+		log.Println("[warn] Checking dead tuples:", err)
+		return
+	}
+	for _, s := range stats {
+		if last, ok := v.lastDead[s.Table]; ok && s.DeadTuples > last {
+			log.Printf("[debug] %s: %d dead tuples (+%d)", s.Table, s.DeadTuples, s.DeadTuples-last)
+		}
+		v.lastDead[s.Table] = s.DeadTuples
+
+		if !needsVacuum(s, v.threshold) {
+			continue
+		}
+		ratio := float64(s.DeadTuples) / float64(s.LiveTuples+s.DeadTuples)
+		if !v.vacuum {
+			log.Printf("[warn] %s has %d dead tuples (%.0f%%), VACUUM recommended", s.Table, s.DeadTuples, ratio*100)
+			continue
+		}
+		log.Printf("[info] %s has %d dead tuples (%.0f%%), running VACUUM", s.Table, s.DeadTuples, ratio*100)
+		if err := v.db.Vacuum(s.Table); err != nil {
+			log.Printf("[warn] Vacuum %s: %s", s.Table, err)
+			continue
+		}
+		v.lastDead[s.Table] = 0
+	}
+}
+
+func needsVacuum(s database.TableStats, threshold float64) bool {
+	if s.DeadTuples < vacuumMinDeadTuples {
+		return false
+	}
+	return float64(s.DeadTuples)/float64(s.LiveTuples+s.DeadTuples) >= threshold
+}
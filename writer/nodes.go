@@ -43,55 +43,83 @@ func NewNodeWriter(
 	return &nw.OsmElemWriter
 }
 
-func (nw *NodeWriter) loop() {
+func (nw *NodeWriter) loop(worker int) {
 	geos := geos.NewGeos()
 	geos.SetHandleSrid(nw.srid)
 	defer geos.Finish()
 
-	for n := range nw.nodes {
+	inserter := nw.workerInserter()
+	for {
+		var n *osm.Node
+		if !nw.receive(worker, inserter, func() (ok bool) { n, ok = <-nw.nodes; return ok }) {
+			break
+		}
+		if nw.cancelled() {
+			nw.done(inserter)
+			break
+		}
 		nw.progress.AddNodes(1)
-		if matches := nw.pointMatcher.MatchNode(n); len(matches) > 0 {
-			nw.NodeToSrid(n)
-			point, err := geomp.Point(geos, *n)
-			if err != nil {
-				if errl, ok := err.(ErrorLevel); !ok || errl.Level() > 0 {
-					log.Println("[warn]: ", err)
-				}
-				continue
-			}
+		nw.writeNode(geos, inserter, n)
+		nw.done(inserter)
+	}
+	nw.stop()
+}
 
-			geom, err := geomp.AsGeomElement(geos, point)
-			if err != nil {
-				log.Println("[warn]: ", err)
-				continue
-			}
+func (nw *NodeWriter) writeNode(geos *geos.Geos, inserter database.Inserter, n *osm.Node) {
+	defer nw.recoverPanic("node", n.ID, n.Tags)
+	matches := nw.pointMatcher.MatchNode(n)
+	if len(matches) == 0 {
+		return
+	}
+	if nw.tooManyTags(n.Tags) {
+		nw.skip(stats.SkipTooManyTags, "node", n.ID, n.Tags, nil)
+		return
+	}
+	nw.NodeToSrid(n)
+	point, err := geomp.Point(geos, *n)
+	if err != nil {
+		nw.skip(stats.SkipInvalidGeometry, "node", n.ID, n.Tags, err)
+		if errl, ok := err.(ErrorLevel); !ok || errl.Level() > 0 {
+			log.Println("[warn]: ", err)
+		}
+		return
+	}
 
-			inserted := false
-			if nw.limiter != nil {
-				parts, err := nw.limiter.Clip(geom.Geom)
-				if err != nil {
-					log.Println("[warn]: ", err)
-					continue
-				}
-				if len(parts) >= 1 {
-					if err := nw.inserter.InsertPoint(n.Element, geom, matches); err != nil {
-						log.Println("[warn]: ", err)
-						continue
-					}
-					inserted = true
-				}
-			} else {
-				if err := nw.inserter.InsertPoint(n.Element, geom, matches); err != nil {
-					log.Println("[warn]: ", err)
-					continue
-				}
-				inserted = true
-			}
+	geom, err := geomp.AsGeomElement(geos, point)
+	if err != nil {
+		log.Println("[warn]: ", err)
+		return
+	}
+	if matches = acceptedMatches(matches, &geom); len(matches) == 0 {
+		nw.skip(stats.SkipFiltered, "node", n.ID, n.Tags, nil)
+		return
+	}
 
-			if inserted && nw.expireor != nil {
-				expire.ExpireProjectedNode(nw.expireor, *n, nw.srid)
+	inserted := false
+	if nw.limiter != nil {
+		parts, err := nw.limiter.Limit(geom.Geom)
+		if err != nil {
+			log.Println("[warn]: ", err)
+			return
+		}
+		if len(parts) >= 1 {
+			if err := inserter.InsertPoint(n.Element, geom, matches); err != nil {
+				log.Println("[warn]: ", err)
+				return
 			}
+			inserted = true
+		} else {
+			nw.skip(stats.SkipOutsideLimitTo, "node", n.ID, n.Tags, nil)
+		}
+	} else {
+		if err := inserter.InsertPoint(n.Element, geom, matches); err != nil {
+			log.Println("[warn]: ", err)
+			return
 		}
+		inserted = true
+	}
+
+	if inserted && nw.expireor != nil {
+		expire.ExpireProjectedNode(nw.expireor, *n, nw.srid)
 	}
-	nw.wg.Done()
 }
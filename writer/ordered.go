@@ -0,0 +1,158 @@
+package writer
+
+import (
+	"sync"
+
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping"
+)
+
+// schedule assigns the elements of the input channel to the workers in
+// turns and orders the inserts of all workers by the position of the
+// element in the input. Two imports with the same input insert all rows in
+// the same order, regardless of the timing of the workers.
+type schedule struct {
+	workers int64
+
+	recvMu   sync.Mutex
+	recvCond *sync.Cond
+	received int64
+	closed   bool
+
+	commitMu   sync.Mutex
+	commitCond *sync.Cond
+	committed  int64
+}
+
+func newSchedule(workers int) *schedule {
+	s := &schedule{workers: int64(workers)}
+	s.recvCond = sync.NewCond(&s.recvMu)
+	s.commitCond = sync.NewCond(&s.commitMu)
+	return s
+}
+
+// receive waits till the next element is assigned to worker and receives
+// it with recv. It returns the position of the element and false if the
+// input is closed.
+func (s *schedule) receive(worker int, recv func() bool) (int64, bool) {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	for !s.closed && s.received%s.workers != int64(worker) {
+		s.recvCond.Wait()
+	}
+	if s.closed {
+		return 0, false
+	}
+	if !recv() {
+		s.closed = true
+		s.recvCond.Broadcast()
+		return 0, false
+	}
+	seq := s.received
+	s.received++
+	s.recvCond.Broadcast()
+	return seq, true
+}
+
+// close stops all workers that wait for their next element.
+func (s *schedule) close() {
+	s.recvMu.Lock()
+	s.closed = true
+	s.recvCond.Broadcast()
+	s.recvMu.Unlock()
+}
+
+// wait blocks till all elements before seq are committed.
+func (s *schedule) wait(seq int64) {
+	s.commitMu.Lock()
+	for s.committed != seq {
+		s.commitCond.Wait()
+	}
+	s.commitMu.Unlock()
+}
+
+// commit marks the element seq as written. Requires a previous wait(seq).
+func (s *schedule) commit(seq int64) {
+	s.commitMu.Lock()
+	s.committed = seq + 1
+	s.commitCond.Broadcast()
+	s.commitMu.Unlock()
+}
+
+// orderedInserter waits for the turn of the current element of a worker
+// before the first insert. The geometries are still built concurrently.
+type orderedInserter struct {
+	database.Inserter
+	schedule *schedule
+	seq      int64
+	waited   bool
+}
+
+func (o *orderedInserter) turn() {
+	if !o.waited {
+		o.schedule.wait(o.seq)
+		o.waited = true
+	}
+}
+
+func (o *orderedInserter) InsertPoint(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	o.turn()
+	return o.Inserter.InsertPoint(elem, geom, matches)
+}
+
+func (o *orderedInserter) InsertLineString(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	o.turn()
+	return o.Inserter.InsertLineString(elem, geom, matches)
+}
+
+func (o *orderedInserter) InsertPolygon(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	o.turn()
+	return o.Inserter.InsertPolygon(elem, geom, matches)
+}
+
+func (o *orderedInserter) InsertRelationMember(rel osm.Relation, m osm.Member, geom geom.Geometry, matches []mapping.Match) error {
+	o.turn()
+	return o.Inserter.InsertRelationMember(rel, m, geom, matches)
+}
+
+// workerInserter returns the inserter for a new worker.
+func (writer *OsmElemWriter) workerInserter() database.Inserter {
+	inserter := writer.inserter
+	if writer.throttle != nil {
+		inserter = &throttledInserter{Inserter: inserter, writer: writer}
+	}
+	if writer.schedule == nil {
+		return inserter
+	}
+	return &orderedInserter{Inserter: inserter, schedule: writer.schedule}
+}
+
+// receive receives the next element of worker with recv, which returns
+// false if the input is closed.
+func (writer *OsmElemWriter) receive(worker int, inserter database.Inserter, recv func() bool) bool {
+	if writer.schedule == nil {
+		return recv()
+	}
+	o := inserter.(*orderedInserter)
+	seq, ok := writer.schedule.receive(worker, recv)
+	o.seq, o.waited = seq, false
+	return ok
+}
+
+// done marks the last received element of the worker as written.
+func (writer *OsmElemWriter) done(inserter database.Inserter) {
+	if o, ok := inserter.(*orderedInserter); ok {
+		o.turn()
+		writer.schedule.commit(o.seq)
+	}
+}
+
+// stop is called after the loop of a worker ends.
+func (writer *OsmElemWriter) stop() {
+	if writer.schedule != nil {
+		writer.schedule.close()
+	}
+	writer.wg.Done()
+}
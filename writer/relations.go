@@ -1,6 +1,7 @@
 package writer
 
 import (
+	"strings"
 	"sync"
 	"time"
 
@@ -16,13 +17,20 @@ import (
 	"github.com/omniscale/imposm3/stats"
 )
 
+// Reasons of multipolygon errors, in addition to the issues from
+// geom.PrepareRelation and Build.
+const (
+	multipolygonMissingMembers  = "missing_members"
+	multipolygonInvalidGeometry = "invalid_geometry"
+)
+
 type RelationWriter struct {
 	OsmElemWriter
 	singleIDSpace         bool
 	rel                   chan *osm.Relation
 	polygonMatcher        mapping.RelWayMatcher
 	relationMatcher       mapping.RelationMatcher
-	relationMemberMatcher mapping.RelationMatcher
+	relationMemberMatcher mapping.RelationMemberMatcher
 	maxGap                float64
 }
 
@@ -35,7 +43,7 @@ func NewRelationWriter(
 	progress *stats.Statistics,
 	matcher mapping.RelWayMatcher,
 	relMatcher mapping.RelationMatcher,
-	relMemberMatcher mapping.RelationMatcher,
+	relMemberMatcher mapping.RelationMemberMatcher,
 	srid int,
 ) *OsmElemWriter {
 	maxGap := 1e-1 // 0.1m
@@ -69,102 +77,462 @@ func (rw *RelationWriter) relID(id int64) int64 {
 	return element.RelIDOffset - id
 }
 
-func (rw *RelationWriter) loop() {
+func (rw *RelationWriter) loop(worker int) {
 	geos := geosp.NewGeos()
 	geos.SetHandleSrid(rw.srid)
 	defer geos.Finish()
 
-NextRel:
-	for r := range rw.rel {
+	inserter := rw.workerInserter()
+	for {
+		var r *osm.Relation
+		if !rw.receive(worker, inserter, func() (ok bool) { r, ok = <-rw.rel; return ok }) {
+			break
+		}
+		if rw.cancelled() {
+			rw.done(inserter)
+			break
+		}
 		rw.progress.AddRelations(1)
-		err := rw.osmCache.Ways.FillMembers(r.Members)
-		if err != nil {
-			if err != cache.NotFound {
+		rw.writeRelation(geos, inserter, r)
+		rw.done(inserter)
+	}
+	rw.stop()
+}
+
+func (rw *RelationWriter) writeRelation(geos *geosp.Geos, inserter database.Inserter, r *osm.Relation) {
+	defer rw.recoverPanic("relation", r.ID, r.Tags)
+	oldStyle := rw.oldStyleMultipolygons && IsOldStyleMultipolygon(r, rw.polygonMatcher)
+	if oldStyle {
+		rw.addOuterWayTags(r)
+	}
+	if !rw.matchesAny(r) {
+		// skip relations without any match (e.g. relations with a type
+		// that is not in relation_types) before we load all members
+		return
+	}
+	if rw.tooManyTags(r.Tags) {
+		rw.skip(stats.SkipTooManyTags, "relation", r.ID, r.Tags, nil)
+		return
+	}
+	err := rw.osmCache.Ways.FillMembers(r.Members)
+	if err != nil {
+		if err != cache.NotFound {
+			log.Println("[warn]: ", err)
+		} else {
+			rw.skip(stats.SkipMissingRefs, "relation", r.ID, r.Tags, nil)
+			rw.addMissingMembersError(r, missingWay(r.Members), "member way not found in cache")
+		}
+		return
+	}
+	builtWays, err := rw.fillMemberWays(r.Members)
+	if err != nil {
+		if err != cache.NotFound {
+			log.Println("[warn]: ", err)
+		} else {
+			rw.skip(stats.SkipMissingRefs, "relation", r.ID, r.Tags, nil)
+			rw.addMissingMembersError(r, 0, "nodes of member way not found in cache")
+		}
+		return
+	}
+	for i, m := range r.Members {
+		if m.Way != nil {
+			r.Members[i].Element = &m.Way.Element
+		}
+	}
+	memberNodes := rw.needsMemberNodes(r)
+	if memberNodes {
+		rw.fillMemberNodes(r.Members)
+	}
+
+	// handleRelation updates r.Members but we need all of them
+	// for the diffCache
+	allMembers := r.Members
+
+	inserted := false
+
+	if handleRelationMembers(rw, inserter, r, geos) {
+		inserted = true
+	}
+	if handleRelation(rw, inserter, r, geos) {
+		inserted = true
+	}
+	polygonMatches := rw.polygonMatcher.MatchRelation(r)
+	if handleMultiPolygon(rw, inserter, r, geos) {
+		inserted = true
+		if oldStyle && rw.outerWays != nil {
+			// the outer ways are already inserted as part of the relation
+			rw.outerWays.add(outerWayIDs(allMembers), polygonMatches)
+		}
+	}
+
+	if inserted && rw.diffCache != nil {
+		rw.diffCache.Ways.AddFromMembers(r.ID, allMembers)
+		if memberNodes {
+			rw.diffCache.CoordsRel.AddFromMembers(r.ID, allMembers)
+		}
+		for _, member := range allMembers {
+			if member.Way != nil {
+				rw.diffCache.Coords.AddFromWay(member.Way)
+			}
+		}
+		// only cache member geometries of inserted relations, as only
+		// those are tracked in the diffCache and invalidated on updates
+		for _, way := range builtWays {
+			if err := rw.osmCache.MemberGeoms.PutWayGeom(way); err != nil {
 				log.Println("[warn]: ", err)
 			}
+		}
+	}
+	if inserted && rw.expireor != nil {
+		for _, m := range allMembers {
+			if m.Way != nil {
+				expire.ExpireProjectedNodes(rw.expireor, m.Way.Nodes, rw.srid, true)
+			}
+		}
+	}
+}
+
+// IsOldStyleMultipolygon returns whether r is a multipolygon relation that
+// does not match any polygon table with its own tags. These relations are
+// imported with the tags of their outer ways, see AddOuterWayTags.
+func IsOldStyleMultipolygon(r *osm.Relation, polygonMatcher mapping.RelWayMatcher) bool {
+	return r.Tags["type"] == "multipolygon" && len(polygonMatcher.MatchRelation(r)) == 0
+}
+
+// AddOuterWayTags adds the tags that all outer ways have in common to the
+// relation r. Tags of the relation are not overwritten. members are the
+// members of r with their ways, members without a way are ignored.
+func AddOuterWayTags(r *osm.Relation, members []osm.Member) {
+	var tags osm.Tags
+	for _, m := range members {
+		if m.Way == nil || m.Role != "outer" {
 			continue
 		}
-		for i, m := range r.Members {
-			if m.Way == nil {
-				continue
+		if tags == nil {
+			tags = make(osm.Tags, len(m.Way.Tags))
+			for k, v := range m.Way.Tags {
+				tags[k] = v
 			}
-			err := rw.osmCache.Coords.FillWay(m.Way)
-			if err != nil {
-				if err != cache.NotFound {
-					log.Println("[warn]: ", err)
-				}
-				continue NextRel
+			continue
+		}
+		for k, v := range tags {
+			if m.Way.Tags[k] != v {
+				delete(tags, k)
 			}
-			rw.NodesToSrid(m.Way.Nodes)
-			r.Members[i].Element = &m.Way.Element
 		}
+	}
+	if len(tags) == 0 {
+		return
+	}
+	if r.Tags == nil {
+		r.Tags = make(osm.Tags)
+	}
+	for k, v := range tags {
+		if _, ok := r.Tags[k]; !ok {
+			r.Tags[k] = v
+		}
+	}
+}
 
-		// handleRelation updates r.Members but we need all of them
-		// for the diffCache
-		allMembers := r.Members
+// addOuterWayTags adds the tags of the outer ways to the old-style
+// multipolygon r.
+func (rw *RelationWriter) addOuterWayTags(r *osm.Relation) {
+	members := make([]osm.Member, len(r.Members))
+	copy(members, r.Members)
+	if err := rw.osmCache.Ways.FillMembers(members); err != nil {
+		if err != cache.NotFound {
+			log.Println("[warn]: ", err)
+		}
+		return
+	}
+	AddOuterWayTags(r, members)
+}
 
-		inserted := false
+// outerWayIDs returns the IDs of all outer ways of the relation.
+func outerWayIDs(members []osm.Member) []int64 {
+	var ids []int64
+	for _, m := range members {
+		if m.Type == osm.WayMember && m.Role == "outer" {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
 
-		if handleRelationMembers(rw, r, geos) {
-			inserted = true
+// fillMemberWays sets the projected nodes of all member ways. The
+// geometries are taken from the member geometry cache if available,
+// otherwise they are built from the cached coordinates. Returns the built
+// ways.
+func (rw *RelationWriter) fillMemberWays(members []osm.Member) ([]*osm.Way, error) {
+	var builtWays []*osm.Way
+	for _, m := range members {
+		if m.Way == nil {
+			continue
 		}
-		if handleRelation(rw, r, geos) {
-			inserted = true
+		if rw.diffCache != nil {
+			err := rw.osmCache.MemberGeoms.FillWay(m.Way)
+			if err == nil {
+				continue
+			}
+			if err != cache.NotFound {
+				log.Println("[warn]: ", err)
+			}
 		}
-		if handleMultiPolygon(rw, r, geos) {
-			inserted = true
+		builtWays = append(builtWays, m.Way)
+	}
+
+	// load coords of large relations in sorted order
+	if err := rw.osmCache.Coords.Prefetch(builtWays); err != nil {
+		log.Println("[warn]: ", err)
+	}
+	for _, way := range builtWays {
+		if err := rw.osmCache.Coords.FillWay(way); err != nil {
+			return nil, err
 		}
+		rw.NodesToSrid(way.Nodes)
+	}
+	return builtWays, nil
+}
 
-		if inserted && rw.diffCache != nil {
-			rw.diffCache.Ways.AddFromMembers(r.ID, allMembers)
-			rw.diffCache.CoordsRel.AddFromMembers(r.ID, allMembers)
-			for _, member := range allMembers {
-				if member.Way != nil {
-					rw.diffCache.Coords.AddFromWay(member.Way)
-				}
+// fillMemberNodes sets the projected node of all node members. Members
+// of nodes that are not in the cache are left empty.
+func (rw *RelationWriter) fillMemberNodes(members []osm.Member) {
+	for i, m := range members {
+		if m.Type != osm.NodeMember {
+			continue
+		}
+		nd, err := rw.osmCache.Nodes.GetNode(m.ID)
+		if err == cache.NotFound {
+			nd, err = rw.osmCache.Coords.GetCoord(m.ID)
+		}
+		if err != nil {
+			if err != cache.NotFound {
+				log.Println("[warn]: ", err)
 			}
+			continue
 		}
-		if inserted && rw.expireor != nil {
-			for _, m := range allMembers {
-				if m.Way != nil {
-					expire.ExpireProjectedNodes(rw.expireor, m.Way.Nodes, rw.srid, true)
-				}
+		rw.NodeToSrid(nd)
+		members[i].Node = nd
+		members[i].Element = &nd.Element
+	}
+}
+
+// memberNodes returns the points of all node members.
+func memberNodes(geos *geosp.Geos, members []osm.Member) []geomp.MemberNode {
+	var result []geomp.MemberNode
+	for _, m := range members {
+		if m.Node == nil {
+			continue
+		}
+		g, err := geomp.Point(geos, *m.Node)
+		if err != nil {
+			log.Println("[warn]: ", err)
+			continue
+		}
+		result = append(result, geomp.MemberNode{ID: m.ID, Role: m.Role, Wkb: geos.AsEwkbHex(g)})
+	}
+	return result
+}
+
+// addMissingMembersError records a multipolygon error for a relation with
+// missing members. Only relations that match a polygon table are recorded.
+func (rw *RelationWriter) addMissingMembersError(r *osm.Relation, memberID int64, msg string) {
+	if !stats.MultipolygonErrors.Enabled() || len(rw.polygonMatcher.MatchRelation(r)) == 0 {
+		return
+	}
+	stats.MultipolygonErrors.Add(stats.MultipolygonError{
+		RelationID: r.ID,
+		MemberID:   memberID,
+		Reason:     multipolygonMissingMembers,
+		Message:    msg,
+	})
+}
+
+// missingWay returns the ID of the first way member that was not filled
+// by FillMembers, which stops at the first missing way.
+func missingWay(members []osm.Member) int64 {
+	for _, m := range members {
+		if m.Type == osm.WayMember && m.Way == nil {
+			return m.ID
+		}
+	}
+	return 0
+}
+
+// addMultipolygonErrors records the issues found while building the
+// multipolygon, or err if there are none.
+func addMultipolygonErrors(r *osm.Relation, issues []geomp.Issue, err error) {
+	for _, issue := range issues {
+		if issue.Reason == geomp.IssueUnclosedRing {
+			log.Printf("[warn]: multipolygon relation %d: %s", r.ID, issue.Message)
+		}
+	}
+	if !stats.MultipolygonErrors.Enabled() {
+		return
+	}
+	for _, issue := range issues {
+		stats.MultipolygonErrors.Add(stats.MultipolygonError{
+			RelationID: r.ID,
+			Reason:     issue.Reason,
+			Message:    issue.Message,
+			Location:   []float64{issue.X, issue.Y},
+		})
+	}
+	if err != nil && len(issues) == 0 {
+		stats.MultipolygonErrors.Add(stats.MultipolygonError{
+			RelationID: r.ID,
+			Reason:     multipolygonInvalidGeometry,
+			Message:    err.Error(),
+		})
+	}
+}
+
+// matchesAny returns whether the relation matches any polygon, relation or
+// relation_member table.
+func (rw *RelationWriter) matchesAny(r *osm.Relation) bool {
+	if len(rw.polygonMatcher.MatchRelation(r)) > 0 {
+		return true
+	}
+	if len(rw.relationMatcher.MatchRelation(r)) > 0 {
+		return true
+	}
+	if len(rw.relationMemberMatcher.MatchRelation(r)) > 0 {
+		return true
+	}
+	return false
+}
+
+// needsMemberNodes returns whether the relation matches a table that
+// requires the node members, i.e. relation_member tables or tables with
+// member_node_* columns.
+func (rw *RelationWriter) needsMemberNodes(r *osm.Relation) bool {
+	if len(rw.relationMemberMatcher.MatchRelation(r)) > 0 {
+		return true
+	}
+	for _, matches := range [][]mapping.Match{
+		rw.polygonMatcher.MatchRelation(r),
+		rw.relationMatcher.MatchRelation(r),
+	} {
+		for i := range matches {
+			if matches[i].MemberNodes() {
+				return true
 			}
 		}
 	}
-	rw.wg.Done()
+	return false
 }
 
-func handleMultiPolygon(rw *RelationWriter, r *osm.Relation, geos *geosp.Geos) bool {
+func handleMultiPolygon(rw *RelationWriter, inserter database.Inserter, r *osm.Relation, geos *geosp.Geos) bool {
 	matches := rw.polygonMatcher.MatchRelation(r)
 	if matches == nil {
 		return false
 	}
 
+	rel := r
+	for _, m := range matches {
+		if m.Boundary() {
+			// boundaries often include ways of enclaves or coastlines twice
+			rel = &osm.Relation{Element: r.Element, Members: uniqueWayMembers(r.Members)}
+			break
+		}
+	}
+
 	// prepare relation (build rings)
-	prepedRel, err := geomp.PrepareRelation(r, rw.srid, rw.maxGap)
+	prepedRel, err := geomp.PrepareRelation(rel, rw.srid, rw.maxGap)
 	if err != nil {
+		rw.skip(stats.SkipInvalidGeometry, "relation", r.ID, r.Tags, err)
+		addMultipolygonErrors(r, prepedRel.Issues, err)
 		if errl, ok := err.(ErrorLevel); !ok || errl.Level() > 0 {
 			log.Println("[warn]: ", err)
 		}
 		return false
 	}
 
-	// build the multipolygon
+	// build the multipolygon, invalid geometries are repaired by Build,
+	// unless a table keeps or drops them
+	for _, m := range matches {
+		if m.GeometryValidation() != mapping.RepairGeometry {
+			prepedRel.KeepInvalid = true
+		}
+	}
+	// the reason of invalid geometries is only needed for the report
+	prepedRel.DetailedIssues = stats.MultipolygonErrors.Enabled()
 	geom, err := prepedRel.Build()
 	if geom.Geom != nil {
 		defer geos.Destroy(geom.Geom)
 	}
+	addMultipolygonErrors(r, prepedRel.Issues, err)
 	if err != nil {
+		rw.skip(stats.SkipInvalidGeometry, "relation", r.ID, r.Tags, err)
 		if errl, ok := err.(ErrorLevel); !ok || errl.Level() > 0 {
 			log.Println("[warn]: ", err)
 		}
 		return false
 	}
 
+	groups := []geomMatches{{geom.Geom, matches}}
+	if prepedRel.KeepInvalid && !isValid(geos, &prepedRel, geom.Geom) {
+		var dropped []mapping.Match
+		groups, dropped, err = groupInvalidPolygon(geos, geom.Geom, matches)
+		if err != nil {
+			rw.skip(stats.SkipInvalidGeometry, "relation", r.ID, r.Tags, err)
+			log.Println("[warn]: ", err)
+			return false
+		}
+		if len(dropped) > 0 {
+			rw.dropInvalid("relation", r.ID, r.Tags, dropped, len(groups) == 0)
+		}
+	}
+
+	nodes := memberNodes(geos, r.Members)
+	inserted := false
+	for _, gm := range groups {
+		gelem := geom
+		if gm.geom != geom.Geom {
+			// repaired geometry
+			gelem, err = geomp.AsGeomElement(geos, gm.geom)
+			if err != nil {
+				log.Println("[warn]: ", err)
+				continue
+			}
+		}
+		gelem.MemberNodes = nodes
+		// geom was built with the handle of PreparedRelation.Build
+		gelem.Geos = geos
+		if insertRelationGeometry(rw, inserter, r, geos, gelem, gm.matches) {
+			inserted = true
+		}
+	}
+	return inserted
+}
+
+// isValid returns whether the built geometry of the relation is valid. It
+// reuses the validity check of Build, if available.
+func isValid(g *geosp.Geos, prep *geomp.PreparedRelation, geom *geosp.Geom) bool {
+	if prep.DetailedIssues {
+		return !prep.Invalid
+	}
+	return g.IsValid(geom)
+}
+
+// insertRelationGeometry inserts the geometry of the relation into the
+// tables of matches.
+func insertRelationGeometry(
+	rw *RelationWriter,
+	inserter database.Inserter,
+	r *osm.Relation,
+	geos *geosp.Geos,
+	geom geomp.Geometry,
+	matches []mapping.Match,
+) bool {
+	if matches = acceptedMatches(matches, &geom); len(matches) == 0 {
+		rw.skip(stats.SkipFiltered, "relation", r.ID, r.Tags, nil)
+		return false
+	}
+
 	if rw.limiter != nil {
 		start := time.Now()
-		parts, err := rw.limiter.Clip(geom.Geom)
+		parts, err := rw.limiter.Limit(geom.Geom)
 		if err != nil {
 			log.Println("[warn]: ", err)
 			return false
@@ -173,13 +541,19 @@ func handleMultiPolygon(rw *RelationWriter, r *osm.Relation, geos *geosp.Geos) b
 			log.Printf("[warn]: clipping relation %d to -limitto took %s", r.ID, duration)
 		}
 		if len(parts) == 0 {
+			rw.skip(stats.SkipOutsideLimitTo, "relation", r.ID, r.Tags, nil)
 			return false
 		}
 		for _, g := range parts {
 			rel := osm.Relation(*r)
 			rel.ID = rw.relID(r.ID)
-			geom = geomp.Geometry{Geom: g, Wkb: geos.AsEwkbHex(g)}
-			err := rw.inserter.InsertPolygon(rel.Element, geom, matches)
+			geom = geomp.Geometry{Geom: g, Wkb: geos.AsEwkbHex(g), MemberNodes: geom.MemberNodes, Geos: geos}
+			// geometry filters apply to the clipped parts
+			partMatches := acceptedMatches(matches, &geom)
+			if len(partMatches) == 0 {
+				continue
+			}
+			err := inserter.InsertPolygon(rel.Element, geom, partMatches)
 			if err != nil {
 				if errl, ok := err.(ErrorLevel); !ok || errl.Level() > 0 {
 					log.Println("[warn]: ", err)
@@ -190,7 +564,7 @@ func handleMultiPolygon(rw *RelationWriter, r *osm.Relation, geos *geosp.Geos) b
 	} else {
 		rel := osm.Relation(*r)
 		rel.ID = rw.relID(r.ID)
-		err := rw.inserter.InsertPolygon(rel.Element, geom, matches)
+		err := inserter.InsertPolygon(rel.Element, geom, matches)
 		if err != nil {
 			if errl, ok := err.(ErrorLevel); !ok || errl.Level() > 0 {
 				log.Println("[warn]: ", err)
@@ -202,18 +576,85 @@ func handleMultiPolygon(rw *RelationWriter, r *osm.Relation, geos *geosp.Geos) b
 	return true
 }
 
-func handleRelation(rw *RelationWriter, r *osm.Relation, geos *geosp.Geos) bool {
+func handleRelation(rw *RelationWriter, inserter database.Inserter, r *osm.Relation, geos *geosp.Geos) bool {
 	relMatches := rw.relationMatcher.MatchRelation(r)
 	if relMatches == nil {
 		return false
 	}
-	rel := osm.Relation(*r)
-	rel.ID = rw.relID(r.ID)
-	rw.inserter.InsertPolygon(rel.Element, geomp.Geometry{}, relMatches)
+	nodes := memberNodes(geos, r.Members)
+	var plainMatches []mapping.Match
+	for _, m := range relMatches {
+		route := m.RouteGeometry()
+		if route == nil {
+			plainMatches = append(plainMatches, m)
+			continue
+		}
+		g, err := geomp.RouteLines(geos, routeWays(r.Members, route.Roles), route.GapTolerance)
+		if err != nil {
+			if err != geomp.ErrorNoLines {
+				log.Printf("[warn]: route relation %d: %s", r.ID, err)
+			}
+			continue
+		}
+		gelem, err := geomp.AsGeomElement(geos, g)
+		if err != nil {
+			log.Println("[warn]: ", err)
+			continue
+		}
+		gelem.MemberNodes = nodes
+		insertRelationGeometry(rw, inserter, r, geos, gelem, []mapping.Match{m})
+	}
+	if len(plainMatches) > 0 {
+		rel := osm.Relation(*r)
+		rel.ID = rw.relID(r.ID)
+		inserter.InsertPolygon(rel.Element, geomp.Geometry{MemberNodes: nodes}, plainMatches)
+	}
 	return true
 }
 
-func handleRelationMembers(rw *RelationWriter, r *osm.Relation, geos *geosp.Geos) bool {
+// uniqueWayMembers returns the members without the way members that are
+// included multiple times.
+func uniqueWayMembers(members []osm.Member) []osm.Member {
+	seen := make(map[int64]bool, len(members))
+	result := make([]osm.Member, 0, len(members))
+	for _, m := range members {
+		if m.Type == osm.WayMember {
+			if seen[m.ID] {
+				continue
+			}
+			seen[m.ID] = true
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+// routeWays returns the member ways with one of the roles. All members
+// except stops and platforms are returned if roles is empty.
+func routeWays(members []osm.Member, roles []string) []*osm.Way {
+	var ways []*osm.Way
+	for _, m := range members {
+		if m.Way == nil {
+			continue
+		}
+		if len(roles) == 0 {
+			if strings.HasPrefix(m.Role, "stop") || strings.HasPrefix(m.Role, "platform") {
+				continue
+			}
+			ways = append(ways, m.Way)
+			continue
+		}
+		for _, role := range roles {
+			if m.Role == role {
+				ways = append(ways, m.Way)
+				break
+			}
+		}
+	}
+	return ways
+}
+
+func handleRelationMembers(rw *RelationWriter, inserter database.Inserter, r *osm.Relation, geos *geosp.Geos) bool {
 	relMemberMatches := rw.relationMemberMatcher.MatchRelation(r)
 	if relMemberMatches == nil {
 		return false
@@ -228,29 +669,18 @@ func handleRelationMembers(rw *RelationWriter, r *osm.Relation, geos *geosp.Geos
 				return false
 			}
 			r.Members[i].Element = &mrel.Element
-		} else if m.Type == osm.NodeMember {
-			nd, err := rw.osmCache.Nodes.GetNode(m.ID)
-			if err != nil {
-				if err == cache.NotFound {
-					nd, err = rw.osmCache.Coords.GetCoord(m.ID)
-					if err != nil {
-						if err != cache.NotFound {
-							log.Println("[warn]: ", err)
-						}
-						return false
-					}
-				} else {
-					log.Println("[warn]: ", err)
-					return false
-				}
-			}
-			rw.NodeToSrid(nd)
-			r.Members[i].Node = nd
-			r.Members[i].Element = &nd.Element
+		} else if m.Type == osm.NodeMember && m.Node == nil {
+			// not found by fillMemberNodes
+			return false
 		}
 	}
 
 	for _, m := range r.Members {
+		memberMatches := rw.relationMemberMatcher.MatchMember(&m, relMemberMatches)
+		if len(memberMatches) == 0 {
+			continue
+		}
+
 		var g *geosp.Geom
 		var err error
 		if m.Node != nil {
@@ -267,7 +697,7 @@ func handleRelationMembers(rw *RelationWriter, r *osm.Relation, geos *geosp.Geos
 		var gelem geomp.Geometry
 		if g == nil {
 			g = geos.FromWkt("POLYGON EMPTY")
-			gelem = geomp.Geometry{Geom: g, Wkb: geos.AsEwkbHex(g)}
+			gelem = geomp.Geometry{Geom: g, Wkb: geos.AsEwkbHex(g), Geos: geos}
 		} else {
 			gelem, err = geomp.AsGeomElement(geos, g)
 			if err != nil {
@@ -275,9 +705,13 @@ func handleRelationMembers(rw *RelationWriter, r *osm.Relation, geos *geosp.Geos
 				return false
 			}
 		}
+		memberMatches = acceptedMatches(memberMatches, &gelem)
+		if len(memberMatches) == 0 {
+			continue
+		}
 		rel := osm.Relation(*r)
 		rel.ID = rw.relID(r.ID)
-		rw.inserter.InsertRelationMember(rel, m, gelem, relMemberMatches)
+		inserter.InsertRelationMember(rel, m, gelem, memberMatches)
 	}
 	return true
 }
@@ -0,0 +1,39 @@
+package writer
+
+import (
+	osm "github.com/omniscale/go-osm"
+	"github.com/omniscale/imposm3/database"
+	"github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/mapping"
+)
+
+// throttledInserter waits for the throttle of the writer before each
+// insert. Each match is one row.
+type throttledInserter struct {
+	database.Inserter
+	writer *OsmElemWriter
+}
+
+func (t *throttledInserter) wait(matches []mapping.Match) {
+	t.writer.throttle.Wait(t.writer.ctx, len(matches))
+}
+
+func (t *throttledInserter) InsertPoint(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	t.wait(matches)
+	return t.Inserter.InsertPoint(elem, geom, matches)
+}
+
+func (t *throttledInserter) InsertLineString(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	t.wait(matches)
+	return t.Inserter.InsertLineString(elem, geom, matches)
+}
+
+func (t *throttledInserter) InsertPolygon(elem osm.Element, geom geom.Geometry, matches []mapping.Match) error {
+	t.wait(matches)
+	return t.Inserter.InsertPolygon(elem, geom, matches)
+}
+
+func (t *throttledInserter) InsertRelationMember(rel osm.Relation, m osm.Member, geom geom.Geometry, matches []mapping.Match) error {
+	t.wait(matches)
+	return t.Inserter.InsertRelationMember(rel, m, geom, matches)
+}
@@ -19,7 +19,7 @@ type WayWriter struct {
 	singleIDSpace  bool
 	ways           chan *osm.Way
 	lineMatcher    mapping.WayMatcher
-	polygonMatcher mapping.WayMatcher
+	polygonMatcher mapping.RelWayMatcher
 	maxGap         float64
 }
 
@@ -30,7 +30,7 @@ func NewWayWriter(
 	ways chan *osm.Way,
 	inserter database.Inserter,
 	progress *stats.Statistics,
-	polygonMatcher mapping.WayMatcher,
+	polygonMatcher mapping.RelWayMatcher,
 	lineMatcher mapping.WayMatcher,
 	srid int,
 ) *OsmElemWriter {
@@ -64,75 +64,170 @@ func (ww *WayWriter) wayID(id int64) int64 {
 	return -id
 }
 
-func (ww *WayWriter) loop() {
+func (ww *WayWriter) loop(worker int) {
 	geos := geos.NewGeos()
 	geos.SetHandleSrid(ww.srid)
 	defer geos.Finish()
-	for w := range ww.ways {
+
+	inserter := ww.workerInserter()
+	for {
+		var w *osm.Way
+		if !ww.receive(worker, inserter, func() (ok bool) { w, ok = <-ww.ways; return ok }) {
+			break
+		}
+		if ww.cancelled() {
+			ww.done(inserter)
+			break
+		}
 		ww.progress.AddWays(1)
-		if len(w.Tags) == 0 {
-			continue
+		ww.writeWay(geos, inserter, w)
+		ww.done(inserter)
+	}
+	ww.stop()
+}
+
+func (ww *WayWriter) writeWay(geos *geos.Geos, inserter database.Inserter, w *osm.Way) {
+	defer ww.recoverPanic("way", w.ID, w.Tags)
+	if len(w.Tags) == 0 {
+		return
+	}
+	if ww.tooManyTags(w.Tags) {
+		if len(ww.lineMatcher.MatchWay(w)) > 0 || len(ww.polygonMatcher.MatchWay(w)) > 0 {
+			ww.skip(stats.SkipTooManyTags, "way", w.ID, w.Tags, nil)
 		}
+		return
+	}
 
-		filled := false
-		// fill loads all coords. call only if we have a match
-		fill := func(w *osm.Way) bool {
-			if filled {
-				return true
-			}
-			err := ww.osmCache.Coords.FillWay(w)
-			if err != nil {
-				return false
-			}
-			ww.NodesToSrid(w.Nodes)
-			filled = true
+	filled := false
+	// fill loads all coords. call only if we have a match
+	fill := func(w *osm.Way) bool {
+		if filled {
 			return true
 		}
+		err := ww.osmCache.Coords.FillWay(w)
+		if err != nil {
+			if err == cache.NotFound {
+				// wayID also reverts the ID
+				ww.skip(stats.SkipMissingRefs, "way", ww.wayID(w.ID), w.Tags, nil)
+			}
+			return false
+		}
+		ww.NodesToSrid(w.Nodes)
+		filled = true
+		return true
+	}
 
-		w.ID = ww.wayID(w.ID)
+	osmID := w.ID
+	w.ID = ww.wayID(w.ID)
 
-		var err error
-		inserted := false
-		insertedPolygon := false
-		if matches := ww.lineMatcher.MatchWay(w); len(matches) > 0 {
-			if !fill(w) {
-				continue
+	var err error
+	inserted := false
+	insertedPolygon := false
+	if matches := ww.lineMatcher.MatchWay(w); len(matches) > 0 {
+		if !fill(w) {
+			return
+		}
+		err, inserted = ww.buildAndInsert(geos, inserter, w, matches, false)
+		if err != nil {
+			if errl, ok := err.(ErrorLevel); !ok || errl.Level() > 0 {
+				log.Println("[warn]: ", err)
 			}
-			err, inserted = ww.buildAndInsert(geos, w, matches, false)
+			return
+		}
+	}
+	matches := ww.polygonMatcher.MatchWay(w)
+	if ww.oldStyleMultipolygons && len(matches) > 0 {
+		matches = withoutMatches(matches, ww.outerWayMatches(osmID))
+	}
+	if len(matches) > 0 {
+		if !fill(w) {
+			return
+		}
+		if w.IsClosed() {
+			err, insertedPolygon = ww.buildAndInsert(geos, inserter, w, matches, true)
 			if err != nil {
 				if errl, ok := err.(ErrorLevel); !ok || errl.Level() > 0 {
 					log.Println("[warn]: ", err)
 				}
-				continue
+				return
 			}
 		}
-		if matches := ww.polygonMatcher.MatchWay(w); len(matches) > 0 {
-			if !fill(w) {
-				continue
+	}
+
+	if (inserted || insertedPolygon) && ww.expireor != nil {
+		expire.ExpireProjectedNodes(ww.expireor, w.Nodes, ww.srid, insertedPolygon)
+	}
+	if (inserted || insertedPolygon) && ww.diffCache != nil {
+		ww.diffCache.Coords.AddFromWay(w)
+	}
+}
+
+// outerWayMatches returns the polygon matches of the old-style
+// multipolygons with the outer way id.
+func (ww *WayWriter) outerWayMatches(id int64) []mapping.Match {
+	if ww.outerWays != nil {
+		return ww.outerWays.get(id)
+	}
+	if ww.diffCache == nil {
+		return nil
+	}
+	var matches []mapping.Match
+	for _, relID := range ww.diffCache.Ways.Get(id) {
+		r, err := ww.osmCache.Relations.GetRelation(relID)
+		if err != nil {
+			if err != cache.NotFound {
+				log.Println("[warn]: ", err)
 			}
-			if w.IsClosed() {
-				err, insertedPolygon = ww.buildAndInsert(geos, w, matches, true)
-				if err != nil {
-					if errl, ok := err.(ErrorLevel); !ok || errl.Level() > 0 {
-						log.Println("[warn]: ", err)
-					}
-					continue
-				}
+			continue
+		}
+		if !IsOldStyleMultipolygon(r, ww.polygonMatcher) || !containsID(outerWayIDs(r.Members), id) {
+			continue
+		}
+		if err := ww.osmCache.Ways.FillMembers(r.Members); err != nil {
+			if err != cache.NotFound {
+				log.Println("[warn]: ", err)
 			}
+			continue
 		}
+		AddOuterWayTags(r, r.Members)
+		matches = append(matches, ww.polygonMatcher.MatchRelation(r)...)
+	}
+	return matches
+}
 
-		if (inserted || insertedPolygon) && ww.expireor != nil {
-			expire.ExpireProjectedNodes(ww.expireor, w.Nodes, ww.srid, insertedPolygon)
+// withoutMatches returns all matches that are not in exclude.
+func withoutMatches(matches, exclude []mapping.Match) []mapping.Match {
+	if len(exclude) == 0 {
+		return matches
+	}
+	var result []mapping.Match
+	for _, m := range matches {
+		found := false
+		for _, e := range exclude {
+			if m.Table == e.Table && m.Key == e.Key && m.Value == e.Value {
+				found = true
+				break
+			}
 		}
-		if (inserted || insertedPolygon) && ww.diffCache != nil {
-			ww.diffCache.Coords.AddFromWay(w)
+		if !found {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
 		}
 	}
-	ww.wg.Done()
+	return false
 }
 
 func (ww *WayWriter) buildAndInsert(
 	g *geos.Geos,
+	inserter database.Inserter,
 	w *osm.Way,
 	matches []mapping.Match,
 	isPolygon bool,
@@ -146,57 +241,97 @@ func (ww *WayWriter) buildAndInsert(
 
 	if isPolygon {
 		geosgeom, err = geomp.Polygon(g, way.Nodes)
-		if err == nil {
-			if g.NumCoordinates(geosgeom) > 5 {
-				// only check for valididty for non-simple geometries
-				geosgeom, err = g.MakeValid(geosgeom)
-			}
-		}
 	} else {
 		geosgeom, err = geomp.LineString(g, way.Nodes)
 	}
 	if err != nil {
+		ww.skip(stats.SkipInvalidGeometry, "way", ww.wayID(w.ID), w.Tags, err)
 		return err, false
 	}
 
+	groups := []geomMatches{{geosgeom, matches}}
+	if isPolygon && !g.IsValid(geosgeom) {
+		var dropped []mapping.Match
+		groups, dropped, err = groupInvalidPolygon(g, geosgeom, matches)
+		if err != nil {
+			ww.skip(stats.SkipInvalidGeometry, "way", ww.wayID(w.ID), w.Tags, err)
+			return err, false
+		}
+		if len(dropped) > 0 {
+			ww.dropInvalid("way", ww.wayID(w.ID), w.Tags, dropped, len(groups) == 0)
+		}
+	}
+
+	inserted := false
+	for _, gm := range groups {
+		ok, err := ww.insert(g, inserter, w, gm.geom, gm.matches, isPolygon)
+		if err != nil {
+			return err, false
+		}
+		inserted = inserted || ok
+	}
+	return nil, inserted
+}
+
+// insert inserts the geometry of the way into the tables of matches.
+func (ww *WayWriter) insert(
+	g *geos.Geos,
+	inserter database.Inserter,
+	w *osm.Way,
+	geosgeom *geos.Geom,
+	matches []mapping.Match,
+	isPolygon bool,
+) (bool, error) {
+	way := osm.Way(*w)
+
 	geom, err := geomp.AsGeomElement(g, geosgeom)
 	if err != nil {
-		return err, false
+		return false, err
+	}
+	if matches = acceptedMatches(matches, &geom); len(matches) == 0 {
+		ww.skip(stats.SkipFiltered, "way", ww.wayID(w.ID), w.Tags, nil)
+		return false, nil
 	}
 
 	inserted := true
 	if ww.limiter != nil {
-		parts, err := ww.limiter.Clip(geom.Geom)
+		parts, err := ww.limiter.Limit(geom.Geom)
 		if err != nil {
-			return err, false
+			return false, err
 		}
 		if len(parts) == 0 {
 			// outside of limitto
+			ww.skip(stats.SkipOutsideLimitTo, "way", ww.wayID(w.ID), w.Tags, nil)
 			inserted = false
 		}
 		for _, p := range parts {
 			way := osm.Way(*w)
-			geom = geomp.Geometry{Geom: p, Wkb: g.AsEwkbHex(p)}
+			geom = geomp.Geometry{Geom: p, Wkb: g.AsEwkbHex(p), Geos: g}
+			// geometry filters apply to the clipped parts
+			partMatches := acceptedMatches(matches, &geom)
+			if len(partMatches) == 0 {
+				continue
+			}
 			if isPolygon {
-				if err := ww.inserter.InsertPolygon(way.Element, geom, matches); err != nil {
-					return err, false
+				if err := inserter.InsertPolygon(way.Element, geom, partMatches); err != nil {
+					return false, err
 				}
 			} else {
-				if err := ww.inserter.InsertLineString(way.Element, geom, matches); err != nil {
-					return err, false
+				if err := inserter.InsertLineString(way.Element, geom, partMatches); err != nil {
+					return false, err
 				}
 			}
 		}
 	} else {
 		if isPolygon {
-			if err := ww.inserter.InsertPolygon(way.Element, geom, matches); err != nil {
-				return err, false
+			if err := inserter.InsertPolygon(way.Element, geom, matches); err != nil {
+				return false, err
 			}
 		} else {
-			if err := ww.inserter.InsertLineString(way.Element, geom, matches); err != nil {
-				return err, false
+			if err := inserter.InsertLineString(way.Element, geom, matches); err != nil {
+				return false, err
 			}
 		}
 	}
-	return nil, inserted
+	return inserted, nil
 }
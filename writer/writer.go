@@ -1,16 +1,24 @@
 package writer
 
 import (
+	"context"
 	"runtime"
+	"runtime/debug"
 	"sync"
 
 	osm "github.com/omniscale/go-osm"
 	"github.com/omniscale/imposm3/cache"
 	"github.com/omniscale/imposm3/database"
 	"github.com/omniscale/imposm3/expire"
+	geomp "github.com/omniscale/imposm3/geom"
+	"github.com/omniscale/imposm3/geom/geos"
 	"github.com/omniscale/imposm3/geom/limit"
+	"github.com/omniscale/imposm3/log"
+	"github.com/omniscale/imposm3/mapping"
 	"github.com/omniscale/imposm3/proj"
 	"github.com/omniscale/imposm3/stats"
+	"github.com/omniscale/imposm3/throttle"
+	"github.com/pkg/errors"
 )
 
 type ErrorLevel interface {
@@ -18,7 +26,7 @@ type ErrorLevel interface {
 }
 
 type looper interface {
-	loop()
+	loop(worker int)
 }
 
 type OsmElemWriter struct {
@@ -32,12 +40,99 @@ type OsmElemWriter struct {
 	srid       int
 	expireor   expire.Expireor
 	concurrent bool
+	ctx        context.Context
+	throttle   *throttle.Throttle
+	ordered    bool
+	schedule   *schedule
+	// maxTags skips elements with more tags, if not 0
+	maxTags int
+	// oldStyleMultipolygons adds the tags of the outer ways to
+	// multipolygon relations without matching tags
+	oldStyleMultipolygons bool
+	outerWays             *OuterWays
 }
 
 func (writer *OsmElemWriter) SetLimiter(limiter *limit.Limiter) {
 	writer.limiter = limiter
 }
 
+// SetMaxTags skips all elements with more than max tags. They are
+// reported as too_many_tags.
+func (writer *OsmElemWriter) SetMaxTags(max int) {
+	writer.maxTags = max
+}
+
+// SetOldStyleMultipolygons enables the import of multipolygon relations
+// with the tags on their outer ways, instead of the relation.
+func (writer *OsmElemWriter) SetOldStyleMultipolygons(enabled bool) {
+	writer.oldStyleMultipolygons = enabled
+}
+
+// SetOuterWays sets the outer ways of old-style multipolygons that are
+// shared between the RelationWriter and the WayWriter. The RelationWriter
+// adds all outer ways of inserted multipolygons and the WayWriter does not
+// insert these ways again with the same matches. Without OuterWays, the
+// WayWriter looks up the relations of a way in the diff cache.
+func (writer *OsmElemWriter) SetOuterWays(outerWays *OuterWays) {
+	writer.outerWays = outerWays
+}
+
+// OuterWays stores the polygon matches of old-style multipolygons for each
+// of their outer ways.
+type OuterWays struct {
+	mu      sync.Mutex
+	matches map[int64][]mapping.Match
+}
+
+func NewOuterWays() *OuterWays {
+	return &OuterWays{matches: make(map[int64][]mapping.Match)}
+}
+
+func (o *OuterWays) add(ids []int64, matches []mapping.Match) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, id := range ids {
+		o.matches[id] = append(o.matches[id], matches...)
+	}
+}
+
+func (o *OuterWays) get(id int64) []mapping.Match {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.matches[id]
+}
+
+// tooManyTags returns whether an element with these tags needs to be
+// skipped, see SetMaxTags.
+func (writer *OsmElemWriter) tooManyTags(tags osm.Tags) bool {
+	return writer.maxTags > 0 && len(tags) > writer.maxTags
+}
+
+// skip records an element that matched the mapping but is not imported.
+// Elements that failed (invalid geometries, too many tags or panics) are
+// also stored as reject if the database supports it. Filtered elements,
+// elements outside of the -limitto geometry and elements with missing
+// references are expected and not stored.
+func (writer *OsmElemWriter) skip(reason, elemType string, id int64, tags osm.Tags, err error) {
+	stats.SkippedElements.Add(reason, elemType, id)
+	switch reason {
+	case stats.SkipInvalidGeometry, stats.SkipTooManyTags, stats.SkipPanic:
+	default:
+		return
+	}
+	rw, ok := writer.inserter.(database.RejectWriter)
+	if !ok {
+		return
+	}
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	if err := rw.InsertReject(elemType, id, reason, message, tags); err != nil {
+		log.Println("[warn]: ", err)
+	}
+}
+
 func (writer *OsmElemWriter) EnableConcurrent() {
 	writer.concurrent = true
 }
@@ -47,9 +142,12 @@ func (writer *OsmElemWriter) Start() {
 	if writer.concurrent {
 		concurrency = runtime.NumCPU()
 	}
+	if writer.ordered {
+		writer.schedule = newSchedule(concurrency)
+	}
 	for i := 0; i < concurrency; i++ {
 		writer.wg.Add(1)
-		go writer.writer.loop()
+		go writer.writer.loop(i)
 	}
 }
 
@@ -57,10 +155,112 @@ func (writer *OsmElemWriter) SetExpireor(exp expire.Expireor) {
 	writer.expireor = exp
 }
 
+// SetContext sets a context to stop the writer before all elements are
+// written. Remaining elements are not consumed after ctx is done.
+func (writer *OsmElemWriter) SetContext(ctx context.Context) {
+	writer.ctx = ctx
+}
+
+// SetThrottle limits the rate of written rows during the time windows of
+// t. Only for bulk imports, as the writer waits within the transaction.
+func (writer *OsmElemWriter) SetThrottle(t *throttle.Throttle) {
+	writer.throttle = t
+}
+
+// EnableOrdered inserts all rows in the order of the input elements.
+func (writer *OsmElemWriter) EnableOrdered() {
+	writer.ordered = true
+}
+
+func (writer *OsmElemWriter) cancelled() bool {
+	return writer.ctx != nil && writer.ctx.Err() != nil
+}
+
 func (writer *OsmElemWriter) Wait() {
 	writer.wg.Wait()
 }
 
+// acceptedMatches returns the matches with tables that accept the
+// geometry (min_area, min_length and closed_only filters). The geometry
+// filters are applied here for all databases.
+func acceptedMatches(matches []mapping.Match, geom *geomp.Geometry) []mapping.Match {
+	for i := range matches {
+		if matches[i].AcceptGeometry(geom) {
+			continue
+		}
+		// copy matches only if at least one table rejects the geometry
+		accepted := append([]mapping.Match{}, matches[:i]...)
+		for j := i + 1; j < len(matches); j++ {
+			if matches[j].AcceptGeometry(geom) {
+				accepted = append(accepted, matches[j])
+			}
+		}
+		return accepted
+	}
+	return matches
+}
+
+// geomMatches are matches that are inserted with the same geometry.
+type geomMatches struct {
+	geom    *geos.Geom
+	matches []mapping.Match
+}
+
+// groupInvalidPolygon groups the matches of an invalid polygon by the
+// geometry_validation of their tables. The polygon is repaired with a
+// buffer(0) or kept as it is. The matches of tables that drop invalid
+// polygons are returned separately.
+func groupInvalidPolygon(g *geos.Geos, geom *geos.Geom, matches []mapping.Match) ([]geomMatches, []mapping.Match, error) {
+	var repair, keep, drop []mapping.Match
+	for _, m := range matches {
+		switch m.GeometryValidation() {
+		case mapping.KeepGeometry:
+			keep = append(keep, m)
+		case mapping.DropGeometry:
+			drop = append(drop, m)
+		default:
+			repair = append(repair, m)
+		}
+	}
+
+	var result []geomMatches
+	if len(repair) > 0 {
+		fixed, err := g.Repair(g.Clone(geom))
+		if err != nil {
+			return nil, nil, err
+		}
+		g.DestroyLater(fixed)
+		result = append(result, geomMatches{fixed, repair})
+	}
+	if len(keep) > 0 {
+		result = append(result, geomMatches{geom, keep})
+	}
+	return result, drop, nil
+}
+
+// recoverPanic skips an element if writing it panicked, e.g. in a filter
+// or a column of the mapping. Call it deferred for each element.
+func (writer *OsmElemWriter) recoverPanic(elemType string, id int64, tags osm.Tags) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err := errors.Errorf("panic: %v", r)
+	log.Printf("[warn]: %s %d skipped after %s\n%s", elemType, id, err, debug.Stack())
+	writer.skip(stats.SkipPanic, elemType, id, tags, err)
+}
+
+// dropInvalid logs and records polygons that are dropped because they are
+// invalid.
+func (writer *OsmElemWriter) dropInvalid(elemType string, id int64, tags osm.Tags, matches []mapping.Match, all bool) {
+	for _, m := range matches {
+		log.Printf("[warn]: dropped invalid polygon of %s %d for table %s", elemType, id, m.Table.Name)
+	}
+	if all {
+		writer.skip(stats.SkipInvalidGeometry, elemType, id, tags, errors.New("invalid polygon"))
+	}
+}
+
 func (writer *OsmElemWriter) NodesToSrid(nodes []osm.Node) {
 	if writer.srid == 4326 {
 		return